@@ -0,0 +1,253 @@
+// Command matcheratorctl runs operator tasks against the database, for
+// operators without database console access:
+//
+//	matcheratorctl create-admin -email ops@example.org [-role provider]
+//	matcheratorctl reset-password -user ops@example.org
+//	matcheratorctl recalculate -user 42
+//	matcheratorctl migrate [-file init.sql]
+//	matcheratorctl stats [-report all|geo|sectors] [-out stats.json]
+//
+// Passwords are read from standard input unless -password is given, so they
+// don't end up in shell history. DATABASE_URL is read from the environment or
+// a .env file, like the server does.
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/joho/godotenv"
+	_ "github.com/lib/pq"
+
+	"matcherator/backend/handlers/admin"
+	"matcherator/backend/services/accounts"
+	"matcherator/backend/services/matches"
+)
+
+// command is a subcommand; run gets the arguments after its name
+type command struct {
+	usage string
+	run   func(db *sql.DB, args []string) error
+}
+
+var commands = map[string]command{
+	"create-admin":   {"create an administrator, or promote an existing account", createAdmin},
+	"reset-password": {"set an account's password and sign it out everywhere", resetPassword},
+	"recalculate":    {"recalculate an account's matches now", recalculate},
+	"migrate":        {"apply the database schema (init.sql is idempotent)", migrate},
+	"stats":          {"export the admin stats reports as JSON", stats},
+}
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		printUsage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", os.Args[1])
+		printUsage()
+		os.Exit(2)
+	}
+
+	// Load environment variables from .env file
+	if err := godotenv.Load(); err != nil && !os.IsNotExist(err) {
+		log.Printf("Warning: error loading .env file: %v", err)
+	}
+	if os.Getenv("DATABASE_URL") == "" {
+		log.Fatalf("Required environment variable DATABASE_URL is not set")
+	}
+
+	db, err := sql.Open("postgres", os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := cmd.run(db, os.Args[2:]); err != nil {
+		log.Fatalf("%s: %v", os.Args[1], err)
+	}
+}
+
+func printUsage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(os.Stderr, "usage: matcheratorctl <command> [flags]")
+	fmt.Fprintln(os.Stderr, "\ncommands:")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-16s %s\n", name, commands[name].usage)
+	}
+	fmt.Fprintln(os.Stderr, "\nrun matcheratorctl <command> -h for its flags")
+}
+
+func createAdmin(db *sql.DB, args []string) error {
+	flags := flag.NewFlagSet("create-admin", flag.ExitOnError)
+	email := flags.String("email", "", "email of the administrator")
+	role := flags.String("role", "provider", "role of a new account: provider or recipient")
+	password := flags.String("password", "", "password of a new account (read from stdin when empty)")
+	flags.Parse(args)
+	if *email == "" {
+		return fmt.Errorf("-email is required")
+	}
+
+	// Existing accounts keep their password
+	if _, err := accounts.Find(db, *email); err == accounts.ErrNotFound && *password == "" {
+		if *password, err = readPassword(); err != nil {
+			return err
+		}
+	} else if err != nil && err != accounts.ErrNotFound {
+		return err
+	}
+
+	account, created, err := accounts.CreateAdmin(db, *email, *password, *role)
+	if err != nil {
+		return err
+	}
+	if created {
+		fmt.Printf("Created administrator %s (ID %d, %s)\n", account.Email, account.ID, account.Role)
+	} else {
+		fmt.Printf("Promoted %s (ID %d) to administrator\n", account.Email, account.ID)
+	}
+	return nil
+}
+
+func resetPassword(db *sql.DB, args []string) error {
+	flags := flag.NewFlagSet("reset-password", flag.ExitOnError)
+	user := flags.String("user", "", "ID or email of the account")
+	password := flags.String("password", "", "new password (read from stdin when empty)")
+	flags.Parse(args)
+
+	account, err := findUser(db, *user)
+	if err != nil {
+		return err
+	}
+	if *password == "" {
+		if *password, err = readPassword(); err != nil {
+			return err
+		}
+	}
+
+	if err := accounts.ResetPassword(db, account.ID, *password); err != nil {
+		return err
+	}
+	fmt.Printf("Reset the password of %s (ID %d); its sessions were signed out\n", account.Email, account.ID)
+	return nil
+}
+
+func recalculate(db *sql.DB, args []string) error {
+	flags := flag.NewFlagSet("recalculate", flag.ExitOnError)
+	user := flags.String("user", "", "ID or email of the account")
+	flags.Parse(args)
+
+	account, err := findUser(db, *user)
+	if err != nil {
+		return err
+	}
+	if err := matches.CalculateAndStoreMatches(db, int64(account.ID), account.Role); err != nil {
+		return err
+	}
+
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM matches WHERE user_id = $1`, account.ID).Scan(&n); err != nil {
+		return fmt.Errorf("error counting matches: %v", err)
+	}
+	fmt.Printf("Recalculated %d matches for %s (ID %d)\n", n, account.Email, account.ID)
+	return nil
+}
+
+func migrate(db *sql.DB, args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	file := flags.String("file", "init.sql", "schema file to apply")
+	flags.Parse(args)
+
+	schema, err := os.ReadFile(*file)
+	if err != nil {
+		return err
+	}
+	// Without arguments the file runs as one multi-statement query
+	if _, err := db.Exec(string(schema)); err != nil {
+		return fmt.Errorf("error applying %s: %v", *file, err)
+	}
+	fmt.Printf("Applied %s\n", *file)
+	return nil
+}
+
+// statsExport holds the reports stats writes
+type statsExport struct {
+	Geo     *admin.GeoStats        `json:"geo,omitempty"`
+	Sectors *admin.SectorGapReport `json:"sectors,omitempty"`
+}
+
+func stats(db *sql.DB, args []string) error {
+	flags := flag.NewFlagSet("stats", flag.ExitOnError)
+	report := flags.String("report", "all", "report to export: all, geo or sectors")
+	ratio := flags.Float64("ratio", admin.DefaultGapRatio, "recipients per provider above which a sector is under-served")
+	out := flags.String("out", "", "file to write (standard output when empty)")
+	flags.Parse(args)
+
+	var export statsExport
+	var err error
+	switch *report {
+	case "all", "geo", "sectors":
+	default:
+		return fmt.Errorf("-report must be all, geo or sectors")
+	}
+	if *report != "sectors" {
+		if export.Geo, err = admin.LoadGeoStats(db); err != nil {
+			return err
+		}
+	}
+	if *report != "geo" {
+		if export.Sectors, err = admin.LoadSectorGaps(db, *ratio); err != nil {
+			return err
+		}
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(export)
+}
+
+// findUser looks up the account a -user flag names
+func findUser(db *sql.DB, ref string) (*accounts.Account, error) {
+	if ref == "" {
+		return nil, fmt.Errorf("-user is required")
+	}
+	account, err := accounts.Find(db, ref)
+	if err == accounts.ErrNotFound {
+		return nil, fmt.Errorf("no account with ID or email %q", ref)
+	}
+	return account, err
+}
+
+// readPassword reads a password from the first line of standard input
+func readPassword() (string, error) {
+	fmt.Fprint(os.Stderr, "Password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("error reading password: %v", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
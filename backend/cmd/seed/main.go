@@ -0,0 +1,65 @@
+// Command seed loads a fixture of organizations, grants, connections and
+// conversations into the database, for demos and local development:
+//
+//	go run ./cmd/seed -file cmd/seed/fixtures/demo.yaml
+//
+// Records the database already has are kept, so a fixture can be loaded
+// again. Matches are recalculated by the server's job worker afterwards.
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/joho/godotenv"
+
+	"matcherator/backend/services/fieldcrypt"
+	"matcherator/backend/services/matches"
+	"matcherator/backend/services/seed"
+)
+
+func main() {
+	file := flag.String("file", "cmd/seed/fixtures/demo.yaml", "YAML or JSON fixture to load")
+	recalculate := flag.Bool("recalculate", true, "queue a recalculation of all matches after seeding")
+	flag.Parse()
+
+	// Load environment variables from .env file
+	if err := godotenv.Load(); err != nil {
+		log.Printf("Warning: .env file not found: %v", err)
+	}
+	if os.Getenv("DATABASE_URL") == "" {
+		log.Fatalf("Required environment variable DATABASE_URL is not set")
+	}
+
+	// Seeded EINs and contact emails are encrypted like the server's
+	fieldcrypt.ConfigureFromEnv()
+
+	fixture, err := seed.Load(*file)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := sql.Open("postgres", os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	summary, err := seed.Apply(db, fixture)
+	if err != nil {
+		log.Fatalf("Error seeding %s: %v", *file, err)
+	}
+	fmt.Printf("Seeded %s: %d organizations (%d already existed), %d grants, %d connections, %d messages\n",
+		*file, summary.Organizations, summary.Existing, summary.Grants, summary.Connections, summary.Messages)
+
+	if *recalculate {
+		jobID, err := matches.EnqueueRecalculateAll(db)
+		if err != nil {
+			log.Fatalf("Error queueing match recalculation: %v", err)
+		}
+		fmt.Printf("Queued match recalculation as job %d\n", jobID)
+	}
+}
@@ -0,0 +1,76 @@
+package admin
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"matcherator/backend/handlers/auth"
+	"matcherator/backend/services/backups"
+)
+
+const (
+	defaultBackupLimit = 50
+	maxBackupLimit     = 200
+)
+
+// CreateBackupHandler queues an export of the database to object storage. A
+// backup already pending or running is returned instead of queueing another.
+// Used by: /api/admin/backups
+// Response: 202 Accepted, backups.Backup
+func CreateBackupHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		adminID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		backup, err := backups.Create(db, adminID)
+		if err == backups.ErrNotConfigured {
+			http.Error(w, "Object storage is not configured", http.StatusServiceUnavailable)
+			return
+		} else if err != nil {
+			log.Printf("Error queueing backup: %v", err)
+			http.Error(w, "Error queueing backup", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("Admin %d requested backup %d", adminID, backup.ID)
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(backup)
+	}
+}
+
+// ListBackupsHandler lists the most recent backups with their status and
+// where ready ones are stored
+// Used by: /api/admin/backups?limit=
+// Response: []backups.Backup
+func ListBackupsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		limit := defaultBackupLimit
+		if value := r.URL.Query().Get("limit"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+				return
+			}
+			limit = min(n, maxBackupLimit)
+		}
+
+		list, err := backups.List(db, limit)
+		if err != nil {
+			log.Printf("Error listing backups: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(list)
+	}
+}
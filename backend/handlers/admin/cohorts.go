@@ -0,0 +1,270 @@
+package admin
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"matcherator/backend/services/track"
+)
+
+const (
+	defaultCohortWeeks = 12
+	maxCohortWeeks     = 104
+)
+
+// cohortWeek is how cohort weeks are formatted: the Monday they start on
+const cohortWeek = "2006-01-02"
+
+// RetentionPoint is how much of a cohort was active some weeks after signing up
+type RetentionPoint struct {
+	WeekOffset int     `json:"week_offset"` // 0 is the signup week
+	Users      int     `json:"users"`
+	Rate       float64 `json:"rate"` // Of the cohort, 0-1
+}
+
+// CohortRetention is the weekly activity of users who signed up in one week
+type CohortRetention struct {
+	Week      string           `json:"week"`
+	Users     int              `json:"users"`
+	Retention []RetentionPoint `json:"retention"` // Up to the current week
+}
+
+// FunnelStep is how much of a cohort reached a funnel event
+type FunnelStep struct {
+	Event    string  `json:"event"`
+	Users    int     `json:"users"`
+	Rate     float64 `json:"rate"`      // Of the cohort, 0-1
+	StepRate float64 `json:"step_rate"` // Of the users who reached the previous event, 0-1
+}
+
+// CohortConversion is the funnel of users who signed up in one week
+type CohortConversion struct {
+	Week   string       `json:"week"`
+	Users  int          `json:"users"`
+	Events []FunnelStep `json:"events"`
+}
+
+// RetentionReport lists weekly signup cohorts, oldest first
+type RetentionReport struct {
+	Since   string            `json:"since"`
+	Role    string            `json:"role,omitempty"`
+	Cohorts []CohortRetention `json:"cohorts"`
+}
+
+// ConversionReport lists weekly signup cohorts, oldest first
+type ConversionReport struct {
+	Since   string             `json:"since"`
+	Role    string             `json:"role,omitempty"`
+	Cohorts []CohortConversion `json:"cohorts"`
+}
+
+// cohortUsers selects providers and recipients who signed up since $1, with
+// the week they did, for role $2 or both
+const cohortUsers = `
+	WITH cohort AS (
+		SELECT id, date_trunc('week', created_at AT TIME ZONE 'UTC')::date AS week
+		FROM users
+		WHERE role IN ('provider', 'recipient')
+			AND created_at >= $1
+			AND ($2 = '' OR role = $2)
+	)
+`
+
+// CohortRetentionHandler reports, per weekly signup cohort, the share of users
+// active in each following week
+// Used by: /api/admin/analytics/cohorts/retention?weeks=&role=
+// Response: RetentionReport
+func CohortRetentionHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		since, role, ok := cohortParams(w, r)
+		if !ok {
+			return
+		}
+
+		cohorts, sizes, err := loadCohorts(db, since, role)
+		if err != nil {
+			log.Printf("Error loading signup cohorts: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		// Every week from signup to now, also those nobody was active in
+		thisWeek := startOfWeek(time.Now())
+		retention := map[string][]RetentionPoint{}
+		for _, week := range cohorts {
+			start, _ := time.Parse(cohortWeek, week)
+			points := make([]RetentionPoint, int(thisWeek.Sub(start).Hours()/(24*7))+1)
+			for i := range points {
+				points[i].WeekOffset = i
+			}
+			retention[week] = points
+		}
+
+		err = queryRows(db, cohortUsers+`
+			SELECT c.week, (a.week - c.week) / 7, COUNT(*)
+			FROM cohort c
+			JOIN user_active_weeks a ON a.user_id = c.id AND a.week >= c.week
+			GROUP BY 1, 2
+		`, func(rows *sql.Rows) error {
+			var week time.Time
+			var offset, n int
+			if err := rows.Scan(&week, &offset, &n); err != nil {
+				return err
+			}
+			points := retention[week.Format(cohortWeek)]
+			if offset < len(points) {
+				points[offset].Users = n
+			}
+			return nil
+		}, since, role)
+		if err != nil {
+			log.Printf("Error loading cohort retention: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		report := RetentionReport{Since: since.Format(cohortWeek), Role: role, Cohorts: []CohortRetention{}}
+		for _, week := range cohorts {
+			points := retention[week]
+			for i := range points {
+				points[i].Rate = rate(points[i].Users, sizes[week])
+			}
+			report.Cohorts = append(report.Cohorts, CohortRetention{Week: week, Users: sizes[week], Retention: points})
+		}
+
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+// CohortConversionHandler reports, per weekly signup cohort, the share of
+// users who reached each funnel event
+// Used by: /api/admin/analytics/cohorts/conversion?weeks=&role=
+// Response: ConversionReport
+func CohortConversionHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		since, role, ok := cohortParams(w, r)
+		if !ok {
+			return
+		}
+
+		cohorts, sizes, err := loadCohorts(db, since, role)
+		if err != nil {
+			log.Printf("Error loading signup cohorts: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		reached := map[string]map[string]int{}
+		err = queryRows(db, cohortUsers+`
+			SELECT c.week, e.event, COUNT(*)
+			FROM cohort c
+			JOIN analytics_events e ON e.user_id = c.id
+			GROUP BY 1, 2
+		`, func(rows *sql.Rows) error {
+			var week time.Time
+			var event string
+			var n int
+			if err := rows.Scan(&week, &event, &n); err != nil {
+				return err
+			}
+			key := week.Format(cohortWeek)
+			if reached[key] == nil {
+				reached[key] = map[string]int{}
+			}
+			reached[key][event] = n
+			return nil
+		}, since, role)
+		if err != nil {
+			log.Printf("Error loading cohort conversion: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		report := ConversionReport{Since: since.Format(cohortWeek), Role: role, Cohorts: []CohortConversion{}}
+		for _, week := range cohorts {
+			cohort := CohortConversion{Week: week, Users: sizes[week], Events: []FunnelStep{}}
+			previous := sizes[week]
+			for _, event := range track.Funnel {
+				n := reached[week][event]
+				cohort.Events = append(cohort.Events, FunnelStep{
+					Event:    event,
+					Users:    n,
+					Rate:     rate(n, sizes[week]),
+					StepRate: rate(n, previous),
+				})
+				previous = n
+			}
+			report.Cohorts = append(report.Cohorts, cohort)
+		}
+
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+// cohortParams parses the weeks and role parameters, writing the error
+// response when they are invalid
+func cohortParams(w http.ResponseWriter, r *http.Request) (time.Time, string, bool) {
+	weeks := defaultCohortWeeks
+	if value := r.URL.Query().Get("weeks"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxCohortWeeks {
+			http.Error(w, "weeks must be between 1 and 104", http.StatusBadRequest)
+			return time.Time{}, "", false
+		}
+		weeks = n
+	}
+
+	role := r.URL.Query().Get("role")
+	if role != "" && role != "provider" && role != "recipient" {
+		http.Error(w, "role must be provider or recipient", http.StatusBadRequest)
+		return time.Time{}, "", false
+	}
+
+	return startOfWeek(time.Now()).AddDate(0, 0, -7*(weeks-1)), role, true
+}
+
+// loadCohorts returns the signup weeks since the given Monday, oldest first,
+// and how many users signed up in each. Weeks without signups are listed too.
+func loadCohorts(db *sql.DB, since time.Time, role string) ([]string, map[string]int, error) {
+	var weeks []string
+	sizes := map[string]int{}
+	for week := since; !week.After(time.Now()); week = week.AddDate(0, 0, 7) {
+		weeks = append(weeks, week.Format(cohortWeek))
+		sizes[week.Format(cohortWeek)] = 0
+	}
+
+	err := queryRows(db, cohortUsers+`
+		SELECT week, COUNT(*) FROM cohort GROUP BY week
+	`, func(rows *sql.Rows) error {
+		var week time.Time
+		var n int
+		if err := rows.Scan(&week, &n); err != nil {
+			return err
+		}
+		sizes[week.Format(cohortWeek)] = n
+		return nil
+	}, since, role)
+	return weeks, sizes, err
+}
+
+// startOfWeek returns midnight UTC of the Monday starting t's week
+func startOfWeek(t time.Time) time.Time {
+	t = t.UTC().Truncate(24 * time.Hour)
+	return t.AddDate(0, 0, -((int(t.Weekday()) + 6) % 7))
+}
+
+// rate returns n as a share of total, 0 when total is
+func rate(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total)
+}
@@ -0,0 +1,265 @@
+package admin
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"matcherator/backend/handlers/auth"
+	"matcherator/backend/handlers/httputil"
+	"matcherator/backend/services/datasets"
+)
+
+const (
+	defaultDatasetLimit = 50
+	maxDatasetLimit     = 200
+
+	// defaultDatasetLinkValidity is how long a dataset link works unless asked
+	// otherwise
+	defaultDatasetLinkValidity = 7 * 24 * time.Hour
+)
+
+// CreateDatasetRequest asks for an open dataset; k defaults to datasets.DefaultK
+type CreateDatasetRequest struct {
+	K *int `json:"k"`
+}
+
+// CreateDatasetLinkRequest asks for a download link valid for the given
+// hours, 168 by default
+type CreateDatasetLinkRequest struct {
+	ValidHours *int `json:"valid_hours"`
+}
+
+// CreateDatasetHandler queues an anonymized open dataset of matches and their
+// outcomes, every published group of organizations at least k strong
+// Used by: /api/admin/datasets
+// Response: 202 Accepted, datasets.Dataset
+func CreateDatasetHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		adminID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req CreateDatasetRequest
+		if !httputil.DecodeOptionalJSON(w, r, &req) {
+			return
+		}
+		k := datasets.DefaultK
+		if req.K != nil {
+			k = *req.K
+		}
+		if k < datasets.MinK || k > datasets.MaxK {
+			http.Error(w, fmt.Sprintf("k must be between %d and %d", datasets.MinK, datasets.MaxK), http.StatusBadRequest)
+			return
+		}
+
+		dataset, err := datasets.Create(db, adminID, k)
+		if err != nil {
+			log.Printf("Error queueing dataset: %v", err)
+			http.Error(w, "Error queueing dataset", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("Admin %d requested dataset %d with k=%d", adminID, dataset.ID, k)
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(dataset)
+	}
+}
+
+// ListDatasetsHandler lists the most recent datasets with their status
+// Used by: /api/admin/datasets?limit=
+// Response: []datasets.Dataset
+func ListDatasetsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		limit := defaultDatasetLimit
+		if value := r.URL.Query().Get("limit"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+				return
+			}
+			limit = min(n, maxDatasetLimit)
+		}
+
+		list, err := datasets.List(db, limit)
+		if err != nil {
+			log.Printf("Error listing datasets: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(list)
+	}
+}
+
+// GetDatasetHandler reports whether a dataset is ready
+// Used by: /api/admin/datasets/{id}
+// Response: datasets.Dataset
+func GetDatasetHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		dataset, ok := loadDataset(w, r, db)
+		if !ok {
+			return
+		}
+
+		json.NewEncoder(w).Encode(dataset)
+	}
+}
+
+// CreateDatasetLinkHandler signs a link that downloads a ready dataset
+// without signing in, for publishing
+// Used by: /api/admin/datasets/{id}/link
+// Response: datasets.Link
+func CreateDatasetLinkHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		var req CreateDatasetLinkRequest
+		if !httputil.DecodeOptionalJSON(w, r, &req) {
+			return
+		}
+		validity := defaultDatasetLinkValidity
+		if req.ValidHours != nil {
+			validity = time.Duration(*req.ValidHours) * time.Hour
+			if validity <= 0 || validity > datasets.MaxLinkValidity {
+				http.Error(w, fmt.Sprintf("valid_hours must be between 1 and %d", int(datasets.MaxLinkValidity.Hours())), http.StatusBadRequest)
+				return
+			}
+		}
+
+		dataset, ok := loadDataset(w, r, db)
+		if !ok {
+			return
+		}
+
+		link, err := datasets.SignLink(dataset, validity)
+		if err == datasets.ErrLinksNotConfigured {
+			http.Error(w, "Dataset links are not configured", http.StatusServiceUnavailable)
+			return
+		} else if err == datasets.ErrNotReady {
+			http.Error(w, fmt.Sprintf("Dataset is not available (%s)", dataset.Status), http.StatusConflict)
+			return
+		} else if err != nil {
+			log.Printf("Error signing link for dataset %d: %v", dataset.ID, err)
+			http.Error(w, "Error signing link", http.StatusInternalServerError)
+			return
+		}
+
+		if adminID, err := auth.GetUserIDFromToken(r); err == nil {
+			log.Printf("Admin %d signed a link to dataset %d until %s", adminID, dataset.ID, link.ExpiresAt.Format(time.RFC3339))
+		}
+		json.NewEncoder(w).Encode(link)
+	}
+}
+
+// DeleteDatasetHandler deletes a dataset's file, so its links stop working
+// Used by: /api/admin/datasets/{id}
+// Response: 204 No Content
+func DeleteDatasetHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid dataset ID", http.StatusBadRequest)
+			return
+		}
+
+		if err := datasets.Delete(db, id); err == datasets.ErrNotFound {
+			http.Error(w, "Dataset not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error deleting dataset %d: %v", id, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// DownloadDatasetHandler serves a dataset to anyone holding a signed link: a
+// ZIP of manifest.json and matches.csv. No authentication is required.
+// Used by: /api/public/datasets/{id}/download?expires=&signature=
+// Response: the ZIP, as an attachment
+func DownloadDatasetHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid dataset ID", http.StatusBadRequest)
+			return
+		}
+
+		query := r.URL.Query()
+		if err := datasets.VerifyLink(id, query.Get("expires"), query.Get("signature")); err != nil {
+			http.Error(w, "This link is invalid or has expired", http.StatusForbidden)
+			return
+		}
+
+		dataset, err := datasets.Get(db, id)
+		if err == datasets.ErrNotFound {
+			http.Error(w, "Dataset not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error loading dataset %d: %v", id, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		path := dataset.FilePath()
+		if path == "" {
+			http.Error(w, "Dataset is no longer available", http.StatusGone)
+			return
+		}
+		file, err := os.Open(path)
+		if os.IsNotExist(err) {
+			http.Error(w, "Dataset file not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error opening dataset %d: %v", id, err)
+			http.Error(w, "Error reading dataset", http.StatusInternalServerError)
+			return
+		}
+		defer file.Close()
+
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("matcherator-dataset-%d.zip", id)))
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Cache-Control", "private, no-store")
+		http.ServeContent(w, r, "", *dataset.CompletedAt, file)
+	}
+}
+
+// loadDataset reads the dataset named by the id route variable, writing the
+// error response when there is none
+func loadDataset(w http.ResponseWriter, r *http.Request, db *sql.DB) (*datasets.Dataset, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid dataset ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	dataset, err := datasets.Get(db, id)
+	if err == datasets.ErrNotFound {
+		http.Error(w, "Dataset not found", http.StatusNotFound)
+		return nil, false
+	} else if err != nil {
+		log.Printf("Error loading dataset %d: %v", id, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return nil, false
+	}
+	return dataset, true
+}
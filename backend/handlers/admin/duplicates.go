@@ -0,0 +1,131 @@
+package admin
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"matcherator/backend/handlers/auth"
+	"matcherator/backend/handlers/httputil"
+	"matcherator/backend/services/dedup"
+)
+
+// DuplicateScanResponse identifies the queued duplicate scan; its progress
+// (dedup.ScanProgress) is listed with the other jobs
+type DuplicateScanResponse struct {
+	JobID int64 `json:"job_id"`
+}
+
+// DuplicateReviewRequest merges a candidate's imported provider into the
+// registered one, or dismisses the candidate
+type DuplicateReviewRequest struct {
+	Action string `json:"action"` // "merge" or "dismiss"
+}
+
+// ScanDuplicatesHandler queues a scan for imported providers that duplicate
+// registered ones, returning the scan already queued or running if there is one
+// Used by: /api/admin/duplicates/scan
+// Response: DuplicateScanResponse
+func ScanDuplicatesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		jobID, err := dedup.EnqueueScan(db)
+		if err != nil {
+			log.Printf("Error queueing duplicate scan: %v", err)
+			http.Error(w, "Error queueing scan", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(DuplicateScanResponse{JobID: jobID})
+	}
+}
+
+// ListDuplicatesHandler lists duplicate candidates, most likely first
+// Used by: /api/admin/duplicates?status=
+// Response: []dedup.Candidate
+func ListDuplicatesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		status := r.URL.Query().Get("status")
+		switch status {
+		case "":
+			status = dedup.StatusOpen
+		case dedup.StatusOpen, dedup.StatusMerged, dedup.StatusDismissed:
+		default:
+			http.Error(w, "status must be open, merged or dismissed", http.StatusBadRequest)
+			return
+		}
+
+		candidates, err := dedup.List(db, status)
+		if err != nil {
+			log.Printf("Error listing duplicate candidates: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(candidates)
+	}
+}
+
+// ReviewDuplicateHandler merges or dismisses an open duplicate candidate
+// Used by: /api/admin/duplicates/{id}/review
+// Response: dedup.Candidate
+func ReviewDuplicateHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		adminID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid candidate ID", http.StatusBadRequest)
+			return
+		}
+
+		var req DuplicateReviewRequest
+		if !httputil.DecodeJSON(w, r, &req) {
+			return
+		}
+
+		switch req.Action {
+		case "merge":
+			err = dedup.Merge(db, id, adminID)
+		case "dismiss":
+			err = dedup.Dismiss(db, id, adminID)
+		default:
+			http.Error(w, "action must be merge or dismiss", http.StatusBadRequest)
+			return
+		}
+		if err == dedup.ErrNotFound {
+			http.Error(w, "Open candidate not found", http.StatusNotFound)
+			return
+		} else if err == dedup.ErrClaimed {
+			http.Error(w, "The imported provider was claimed or merged since it was detected", http.StatusConflict)
+			return
+		} else if err != nil {
+			log.Printf("Error reviewing duplicate candidate %d: %v", id, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		candidate, err := dedup.Get(db, id)
+		if err != nil {
+			log.Printf("Error loading duplicate candidate %d: %v", id, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(candidate)
+	}
+}
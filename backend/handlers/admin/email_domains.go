@@ -0,0 +1,145 @@
+package admin
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"matcherator/backend/handlers/auth"
+	"matcherator/backend/handlers/httputil"
+	"matcherator/backend/services/emaildomains"
+)
+
+const maxOverrideNoteLen = 500
+
+// EmailDomainOverride lets signups from a domain the disposable email block
+// list has wrong
+type EmailDomainOverride struct {
+	Domain    string    `json:"domain"`
+	Note      string    `json:"note"`
+	Listed    bool      `json:"listed"` // Whether the block list still has the domain
+	CreatedBy *int      `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// EmailDomainOverrideRequest says why a domain is allowed
+type EmailDomainOverrideRequest struct {
+	Note string `json:"note"`
+}
+
+// ListEmailDomainOverridesHandler lists the domains allowed despite the
+// disposable email block list
+// Used by: /api/admin/email-domains/overrides
+// Response: []EmailDomainOverride
+func ListEmailDomainOverridesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		rows, err := db.Query(`
+			SELECT domain, note, created_by, created_at
+			FROM email_domain_overrides
+			ORDER BY domain
+		`)
+		if err != nil {
+			log.Printf("Error listing email domain overrides: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		overrides := []EmailDomainOverride{}
+		for rows.Next() {
+			var override EmailDomainOverride
+			if err := rows.Scan(&override.Domain, &override.Note, &override.CreatedBy, &override.CreatedAt); err != nil {
+				log.Printf("Error scanning email domain override: %v", err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+			_, override.Listed = emaildomains.Listed(override.Domain)
+			overrides = append(overrides, override)
+		}
+		if err := rows.Err(); err != nil {
+			log.Printf("Error listing email domain overrides: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(overrides)
+	}
+}
+
+// SaveEmailDomainOverrideHandler allows signups and email changes to a domain,
+// and its subdomains, despite the disposable email block list
+// Used by: /api/admin/email-domains/overrides/{domain}
+// Response: EmailDomainOverride
+func SaveEmailDomainOverrideHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		adminID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		domain := emaildomains.Domain("@" + mux.Vars(r)["domain"])
+		if domain == "" || strings.ContainsAny(domain, "@ /") {
+			http.Error(w, "Invalid domain", http.StatusBadRequest)
+			return
+		}
+
+		var req EmailDomainOverrideRequest
+		if !httputil.DecodeJSON(w, r, &req) {
+			return
+		}
+		req.Note = strings.TrimSpace(req.Note)
+		if len(req.Note) > maxOverrideNoteLen {
+			http.Error(w, "Note is too long", http.StatusBadRequest)
+			return
+		}
+
+		override := EmailDomainOverride{Domain: domain}
+		err = db.QueryRow(`
+			INSERT INTO email_domain_overrides (domain, note, created_by)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (domain) DO UPDATE SET note = EXCLUDED.note
+			RETURNING note, created_by, created_at
+		`, domain, req.Note, adminID).Scan(&override.Note, &override.CreatedBy, &override.CreatedAt)
+		if err != nil {
+			log.Printf("Error saving email domain override for %s: %v", domain, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		_, override.Listed = emaildomains.Listed(domain)
+		log.Printf("Admin %d allowed email domain %s", adminID, domain)
+		json.NewEncoder(w).Encode(override)
+	}
+}
+
+// DeleteEmailDomainOverrideHandler blocks a domain again
+// Used by: /api/admin/email-domains/overrides/{domain}
+// Response: 204 No Content
+func DeleteEmailDomainOverrideHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		domain := emaildomains.Domain("@" + mux.Vars(r)["domain"])
+
+		result, err := db.Exec("DELETE FROM email_domain_overrides WHERE domain = $1", domain)
+		if err != nil {
+			log.Printf("Error deleting email domain override for %s: %v", domain, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			http.Error(w, "Override not found", http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,207 @@
+package admin
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+
+	"matcherator/backend/handlers/auth"
+	"matcherator/backend/handlers/httputil"
+	"matcherator/backend/services/experiments"
+	"matcherator/backend/services/matches"
+)
+
+const (
+	maxExperimentNameLen        = 100
+	maxExperimentDescriptionLen = 2000
+	maxExperimentVariants       = 10
+)
+
+// variantNamePattern keeps variant names short and safe to show in reports
+var variantNamePattern = regexp.MustCompile(`^[a-z0-9_-]{1,50}$`)
+
+// ExperimentRequest creates an experiment. Variants need distinct names and
+// a positive traffic share; their configs are checked against the scorers.
+type ExperimentRequest struct {
+	Name        string                `json:"name"`
+	Description string                `json:"description"`
+	Variants    []experiments.Variant `json:"variants"`
+}
+
+// ListExperimentsHandler lists matching experiments, newest first
+// Used by: /api/admin/experiments
+// Response: []experiments.Experiment
+func ListExperimentsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		list, err := experiments.List(db)
+		if err != nil {
+			log.Printf("Error listing experiments: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(list)
+	}
+}
+
+// CreateExperimentHandler creates a draft experiment
+// Used by: /api/admin/experiments
+// Response: 201 Created, experiments.Experiment
+func CreateExperimentHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		adminID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req ExperimentRequest
+		if !httputil.DecodeJSON(w, r, &req) {
+			return
+		}
+		req.Name = strings.TrimSpace(req.Name)
+		req.Description = strings.TrimSpace(req.Description)
+		if message := validateExperiment(&req); message != "" {
+			http.Error(w, message, http.StatusBadRequest)
+			return
+		}
+
+		experiment, err := experiments.Create(db, req.Name, req.Description, req.Variants, adminID)
+		if err != nil {
+			log.Printf("Error creating experiment: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("Admin %d created experiment %d (%s)", adminID, experiment.ID, experiment.Name)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(experiment)
+	}
+}
+
+// StartExperimentHandler runs a draft experiment. Users are assigned to its
+// variants as their matches are recalculated.
+// Used by: /api/admin/experiments/{id}/start
+// Response: experiments.Experiment
+func StartExperimentHandler(db *sql.DB) http.HandlerFunc {
+	return experimentTransition(db, experiments.Start, experiments.StatusDraft, "started")
+}
+
+// StopExperimentHandler ends a running experiment, keeping its results
+// Used by: /api/admin/experiments/{id}/stop
+// Response: experiments.Experiment
+func StopExperimentHandler(db *sql.DB) http.HandlerFunc {
+	return experimentTransition(db, experiments.Stop, experiments.StatusRunning, "stopped")
+}
+
+// ExperimentResultsHandler reports, per variant, how many users were assigned
+// and shown matches, and the connection and dismissal rates of those matches
+// Used by: /api/admin/experiments/{id}/results
+// Response: experiments.Results
+func ExperimentResultsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid experiment ID", http.StatusBadRequest)
+			return
+		}
+
+		results, err := experiments.LoadResults(db, id)
+		if err == experiments.ErrNotFound {
+			http.Error(w, "Experiment not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error loading results of experiment %d: %v", id, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(results)
+	}
+}
+
+// experimentTransition handles starting and stopping experiments. from is the
+// status the transition applies to and done describes it for responses and logs.
+func experimentTransition(db *sql.DB, transition func(*sql.DB, int) (*experiments.Experiment, error), from, done string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		adminID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid experiment ID", http.StatusBadRequest)
+			return
+		}
+
+		experiment, err := transition(db, id)
+		switch err {
+		case nil:
+		case experiments.ErrNotFound:
+			http.Error(w, "Experiment not found", http.StatusNotFound)
+			return
+		case experiments.ErrAlreadyRunning:
+			http.Error(w, "Another experiment is already running. Stop it first", http.StatusConflict)
+			return
+		case experiments.ErrInvalidStatus:
+			http.Error(w, fmt.Sprintf("Only %s experiments can be %s", from, done), http.StatusConflict)
+			return
+		default:
+			log.Printf("Error changing status of experiment %d: %v", id, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("Admin %d %s experiment %d", adminID, done, id)
+		json.NewEncoder(w).Encode(experiment)
+	}
+}
+
+// validateExperiment returns why an experiment request is invalid, or ""
+func validateExperiment(req *ExperimentRequest) string {
+	if req.Name == "" || utf8.RuneCountInString(req.Name) > maxExperimentNameLen {
+		return fmt.Sprintf("name is required and at most %d characters", maxExperimentNameLen)
+	}
+	if utf8.RuneCountInString(req.Description) > maxExperimentDescriptionLen {
+		return fmt.Sprintf("description must be at most %d characters", maxExperimentDescriptionLen)
+	}
+	if len(req.Variants) < 2 || len(req.Variants) > maxExperimentVariants {
+		return fmt.Sprintf("an experiment needs between 2 and %d variants", maxExperimentVariants)
+	}
+
+	seen := make(map[string]bool)
+	for _, variant := range req.Variants {
+		if !variantNamePattern.MatchString(variant.Name) {
+			return fmt.Sprintf("variant name %q must be 1-50 lowercase letters, digits, '-' or '_'", variant.Name)
+		}
+		if seen[variant.Name] {
+			return fmt.Sprintf("variant name %q is used twice", variant.Name)
+		}
+		seen[variant.Name] = true
+		if variant.Traffic < 1 || variant.Traffic > 100 {
+			return fmt.Sprintf("traffic of variant %s must be between 1 and 100", variant.Name)
+		}
+		if _, err := matches.PipelineFor(variant.Name, variant.Config); err != nil {
+			return fmt.Sprintf("config of variant %s: %v", variant.Name, err)
+		}
+	}
+	return ""
+}
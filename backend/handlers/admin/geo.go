@@ -0,0 +1,312 @@
+package admin
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Census regions states are grouped into
+const (
+	RegionNortheast   = "Northeast"
+	RegionMidwest     = "Midwest"
+	RegionSouth       = "South"
+	RegionWest        = "West"
+	RegionTerritories = "Territories"
+	RegionUnknown     = "Unknown"
+)
+
+// regionOrder lists the regions in the order they are reported
+var regionOrder = []string{RegionNortheast, RegionMidwest, RegionSouth, RegionWest, RegionTerritories, RegionUnknown}
+
+// unknownState collects profiles without a recognizable state
+const unknownState = "unknown"
+
+// stateRegions maps state and territory codes to their census region
+var stateRegions = map[string]string{
+	"CT": RegionNortheast, "ME": RegionNortheast, "MA": RegionNortheast, "NH": RegionNortheast,
+	"RI": RegionNortheast, "VT": RegionNortheast, "NJ": RegionNortheast, "NY": RegionNortheast,
+	"PA": RegionNortheast,
+	"IL": RegionMidwest, "IN": RegionMidwest, "MI": RegionMidwest, "OH": RegionMidwest,
+	"WI": RegionMidwest, "IA": RegionMidwest, "KS": RegionMidwest, "MN": RegionMidwest,
+	"MO": RegionMidwest, "NE": RegionMidwest, "ND": RegionMidwest, "SD": RegionMidwest,
+	"DE": RegionSouth, "DC": RegionSouth, "FL": RegionSouth, "GA": RegionSouth,
+	"MD": RegionSouth, "NC": RegionSouth, "SC": RegionSouth, "VA": RegionSouth,
+	"WV": RegionSouth, "AL": RegionSouth, "KY": RegionSouth, "MS": RegionSouth,
+	"TN": RegionSouth, "AR": RegionSouth, "LA": RegionSouth, "OK": RegionSouth,
+	"TX": RegionSouth,
+	"AZ": RegionWest, "CO": RegionWest, "ID": RegionWest, "MT": RegionWest,
+	"NV": RegionWest, "NM": RegionWest, "UT": RegionWest, "WY": RegionWest,
+	"AK": RegionWest, "CA": RegionWest, "HI": RegionWest, "OR": RegionWest,
+	"WA": RegionWest,
+	"PR": RegionTerritories, "GU": RegionTerritories, "VI": RegionTerritories,
+	"AS": RegionTerritories, "MP": RegionTerritories,
+}
+
+// stateNames maps upper-cased state names to their codes, for profiles that
+// spell the state out
+var stateNames = map[string]string{
+	"ALABAMA": "AL", "ALASKA": "AK", "ARIZONA": "AZ", "ARKANSAS": "AR", "CALIFORNIA": "CA",
+	"COLORADO": "CO", "CONNECTICUT": "CT", "DELAWARE": "DE", "DISTRICT OF COLUMBIA": "DC",
+	"FLORIDA": "FL", "GEORGIA": "GA", "HAWAII": "HI", "IDAHO": "ID", "ILLINOIS": "IL",
+	"INDIANA": "IN", "IOWA": "IA", "KANSAS": "KS", "KENTUCKY": "KY", "LOUISIANA": "LA",
+	"MAINE": "ME", "MARYLAND": "MD", "MASSACHUSETTS": "MA", "MICHIGAN": "MI", "MINNESOTA": "MN",
+	"MISSISSIPPI": "MS", "MISSOURI": "MO", "MONTANA": "MT", "NEBRASKA": "NE", "NEVADA": "NV",
+	"NEW HAMPSHIRE": "NH", "NEW JERSEY": "NJ", "NEW MEXICO": "NM", "NEW YORK": "NY",
+	"NORTH CAROLINA": "NC", "NORTH DAKOTA": "ND", "OHIO": "OH", "OKLAHOMA": "OK", "OREGON": "OR",
+	"PENNSYLVANIA": "PA", "RHODE ISLAND": "RI", "SOUTH CAROLINA": "SC", "SOUTH DAKOTA": "SD",
+	"TENNESSEE": "TN", "TEXAS": "TX", "UTAH": "UT", "VERMONT": "VT", "VIRGINIA": "VA",
+	"WASHINGTON": "WA", "WEST VIRGINIA": "WV", "WISCONSIN": "WI", "WYOMING": "WY",
+	"PUERTO RICO": "PR", "GUAM": "GU", "U.S. VIRGIN ISLANDS": "VI", "AMERICAN SAMOA": "AS",
+	"NORTHERN MARIANA ISLANDS": "MP",
+}
+
+// nationwideScopes are provider region scopes that cover every state
+var nationwideScopes = map[string]bool{
+	"NATIONAL": true, "NATIONWIDE": true, "US": true, "USA": true, "UNITED STATES": true,
+}
+
+// GeoCounts are the platform's active users and activity in a state or region.
+// Matches and connections are counted under the recipient's state.
+type GeoCounts struct {
+	Providers         int `json:"providers"`          // Based there
+	ProvidersServing  int `json:"providers_serving"`  // Whose region scope names it, or based there without a scope; unknown for scopes that name no state
+	Recipients        int `json:"recipients"`         // Based there
+	RecipientsMatched int `json:"recipients_matched"` // Recipients with at least one provider match
+	Matches           int `json:"matches"`
+	Connections       int `json:"connections"`
+}
+
+// StateStats are the counts of one state
+type StateStats struct {
+	State  string `json:"state"` // Two-letter code, or "unknown"
+	Region string `json:"region"`
+	GeoCounts
+	// CoverageGap is set when the state has recipients but no provider
+	// serves it, not counting nationwide providers
+	CoverageGap bool `json:"coverage_gap"`
+}
+
+// RegionStats are the counts of one census region
+type RegionStats struct {
+	Region string `json:"region"`
+	GeoCounts
+	CoverageGaps int `json:"coverage_gaps"` // States with a coverage gap
+}
+
+// GeoStats is the platform's coverage by state and region
+type GeoStats struct {
+	GeneratedAt         time.Time     `json:"generated_at"`
+	NationwideProviders int           `json:"nationwide_providers"` // Providers serving every state
+	States              []StateStats  `json:"states"`
+	Regions             []RegionStats `json:"regions"`
+}
+
+// GeoStatsHandler aggregates active providers, recipients, matches and
+// connections by state and census region. Every state is listed, also without
+// users, so dashboards can show where coverage is missing.
+// Used by: /api/admin/stats/geo
+// Response: GeoStats
+func GeoStatsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		stats, err := LoadGeoStats(db)
+		if err != nil {
+			log.Printf("Error loading geo stats: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(stats)
+	}
+}
+
+// geoActiveUsers selects active providers and recipients with their upper-cased
+// state and region scope
+const geoActiveUsers = `
+	WITH active AS (
+		SELECT u.id, u.role,
+			UPPER(TRIM(COALESCE(p.state, ''))) AS state,
+			UPPER(TRIM(COALESCE(pd.region_scope, ''))) AS scope
+		FROM users u
+		LEFT JOIN profiles p ON p.user_id = u.id
+		LEFT JOIN provider_data pd ON pd.user_id = u.id
+		WHERE u.role IN ('provider', 'recipient')
+			AND u.deactivated_at IS NULL AND u.deleted_at IS NULL
+	)
+`
+
+// LoadGeoStats aggregates the counts by state, then rolls them up into regions
+func LoadGeoStats(db *sql.DB) (*GeoStats, error) {
+	stats := &GeoStats{GeneratedAt: time.Now().UTC()}
+	byState := map[string]*GeoCounts{unknownState: {}}
+	for code := range stateRegions {
+		byState[code] = &GeoCounts{}
+	}
+
+	// Users, by where they are based and, for providers, the scope they serve
+	err := queryRows(db, geoActiveUsers+`
+		SELECT role, state, scope, COUNT(*) FROM active GROUP BY role, state, scope
+	`, func(rows *sql.Rows) error {
+		var role, state, scope string
+		var n int
+		if err := rows.Scan(&role, &state, &scope, &n); err != nil {
+			return err
+		}
+
+		counts := byState[normalizeState(state)]
+		if role == "recipient" {
+			counts.Recipients += n
+			return nil
+		}
+		counts.Providers += n
+		if served, nationwide := servedState(state, scope); nationwide {
+			stats.NationwideProviders += n
+		} else {
+			byState[served].ProvidersServing += n
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error counting users: %v", err)
+	}
+
+	// Provider matches of recipients
+	err = queryRows(db, geoActiveUsers+`
+		SELECT a.state, COUNT(DISTINCT m.user_id), COUNT(*)
+		FROM active a
+		JOIN matches m ON m.user_id = a.id
+		JOIN active provider ON provider.id = m.match_id AND provider.role = 'provider'
+		WHERE a.role = 'recipient'
+		GROUP BY a.state
+	`, func(rows *sql.Rows) error {
+		var state string
+		var matched, n int
+		if err := rows.Scan(&state, &matched, &n); err != nil {
+			return err
+		}
+		counts := byState[normalizeState(state)]
+		counts.RecipientsMatched += matched
+		counts.Matches += n
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error counting matches: %v", err)
+	}
+
+	// Connections between providers and recipients
+	err = queryRows(db, geoActiveUsers+`
+		SELECT recipient.state, COUNT(*)
+		FROM connections c
+		JOIN active recipient ON recipient.id IN (c.initiator_id, c.target_id) AND recipient.role = 'recipient'
+		JOIN active provider ON provider.id IN (c.initiator_id, c.target_id) AND provider.role = 'provider'
+		GROUP BY recipient.state
+	`, func(rows *sql.Rows) error {
+		var state string
+		var n int
+		if err := rows.Scan(&state, &n); err != nil {
+			return err
+		}
+		byState[normalizeState(state)].Connections += n
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error counting connections: %v", err)
+	}
+
+	regions := map[string]*RegionStats{}
+	for _, region := range regionOrder {
+		regions[region] = &RegionStats{Region: region}
+	}
+	for state, counts := range byState {
+		region := regionOf(state)
+		s := StateStats{State: state, Region: region, GeoCounts: *counts}
+		s.CoverageGap = state != unknownState && s.Recipients > 0 && s.ProvidersServing == 0
+		stats.States = append(stats.States, s)
+
+		total := regions[region]
+		total.Providers += s.Providers
+		total.ProvidersServing += s.ProvidersServing
+		total.Recipients += s.Recipients
+		total.RecipientsMatched += s.RecipientsMatched
+		total.Matches += s.Matches
+		total.Connections += s.Connections
+		if s.CoverageGap {
+			total.CoverageGaps++
+		}
+	}
+
+	sort.Slice(stats.States, func(i, j int) bool {
+		// Unknown last, states alphabetically
+		if (stats.States[i].State == unknownState) != (stats.States[j].State == unknownState) {
+			return stats.States[j].State == unknownState
+		}
+		return stats.States[i].State < stats.States[j].State
+	})
+	for _, region := range regionOrder {
+		stats.Regions = append(stats.Regions, *regions[region])
+	}
+	return stats, nil
+}
+
+// queryRows runs query and passes each row to scan
+func queryRows(db *sql.DB, query string, scan func(*sql.Rows) error, args ...interface{}) error {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// servedState returns the state a provider serves: the one its region scope
+// names or, without a scope, the one it is based in. Nationwide providers
+// serve every state.
+func servedState(state, scope string) (string, bool) {
+	if nationwideScopes[scope] {
+		return "", true
+	}
+	if scope == "" {
+		return normalizeState(state), false
+	}
+	return normalizeState(scope), false
+}
+
+// CensusRegion returns the census region of a state code or name, as written
+// on a profile
+func CensusRegion(state string) string {
+	return regionOf(normalizeState(strings.ToUpper(strings.TrimSpace(state))))
+}
+
+// regionOf returns the census region of a normalized state
+func regionOf(state string) string {
+	if region, ok := stateRegions[state]; ok {
+		return region
+	}
+	return RegionUnknown
+}
+
+// normalizeState returns the code of an upper-cased state code or name, or
+// unknownState
+func normalizeState(state string) string {
+	state = strings.TrimSuffix(state, ".")
+	if _, ok := stateRegions[state]; ok {
+		return state
+	}
+	if code, ok := stateNames[state]; ok {
+		return code
+	}
+	return unknownState
+}
@@ -0,0 +1,124 @@
+package admin
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"matcherator/backend/services/jobs"
+	"matcherator/backend/services/matches"
+)
+
+// PairExplanation reports the matching pipeline for both directions of a pair
+type PairExplanation struct {
+	AToB *matches.Explanation `json:"a_to_b"`
+	BToA *matches.Explanation `json:"b_to_a"`
+}
+
+// ExplainMatchHandler runs the scoring pipeline for two users and returns every
+// dimension's inputs, intermediate values and final score
+// Used by: /api/admin/matching/explain?user_a=&user_b=
+// Response: PairExplanation
+func ExplainMatchHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userA, errA := strconv.ParseInt(r.URL.Query().Get("user_a"), 10, 64)
+		userB, errB := strconv.ParseInt(r.URL.Query().Get("user_b"), 10, 64)
+		if errA != nil || errB != nil {
+			http.Error(w, "user_a and user_b must be valid user IDs", http.StatusBadRequest)
+			return
+		}
+
+		var response PairExplanation
+		var err error
+		response.AToB, err = matches.ExplainMatch(db, userA, userB)
+		if err == nil {
+			response.BToA, err = matches.ExplainMatch(db, userB, userA)
+		}
+
+		if err == matches.ErrUserNotFound {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error explaining match between %d and %d: %v", userA, userB, err)
+			http.Error(w, "Error explaining match", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// RecalculateAllResponse identifies the batch recalculation job
+type RecalculateAllResponse struct {
+	JobID int64 `json:"job_id"`
+}
+
+// RecalculateAllHandler queues a recalculation of every active user's matches,
+// returning the batch already queued or running if there is one
+// Used by: /api/admin/matching/recalculate-all
+// Response: RecalculateAllResponse
+func RecalculateAllHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		jobID, err := matches.EnqueueRecalculateAll(db)
+		if err != nil {
+			log.Printf("Error queueing batch recalculation: %v", err)
+			http.Error(w, "Error queueing recalculation", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(RecalculateAllResponse{JobID: jobID})
+	}
+}
+
+// RecalculationJobResponse reports a batch recalculation's state and progress
+type RecalculationJobResponse struct {
+	Job      *jobs.Job              `json:"job"`
+	Progress *matches.BatchProgress `json:"progress"`
+}
+
+// GetRecalculationJobHandler reports the progress of a batch recalculation
+// Used by: /api/admin/matching/jobs/{id}
+// Response: RecalculationJobResponse
+func GetRecalculationJobHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid job ID", http.StatusBadRequest)
+			return
+		}
+
+		job, err := jobs.Get(db, id)
+		if err == jobs.ErrNotFound || (err == nil && job.Kind != matches.RecalculateAllJob) {
+			http.Error(w, "Recalculation job not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error loading job %d: %v", id, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		response := RecalculationJobResponse{Job: job}
+		if len(job.Progress) > 0 {
+			response.Progress = &matches.BatchProgress{}
+			if err := json.Unmarshal(job.Progress, response.Progress); err != nil {
+				log.Printf("Error decoding progress of job %d: %v", id, err)
+				response.Progress = nil
+			}
+		}
+		// The raw progress is reported decoded
+		job.Progress = nil
+
+		json.NewEncoder(w).Encode(response)
+	}
+}
@@ -0,0 +1,93 @@
+package admin
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"matcherator/backend/services/jobs"
+)
+
+const (
+	defaultJobsLimit = 50
+	maxJobsLimit     = 200
+)
+
+// JobsResponse lists background jobs with queue totals per status
+type JobsResponse struct {
+	Counts map[string]int `json:"counts"`
+	Jobs   []jobs.Job     `json:"jobs"`
+}
+
+// ListJobsHandler lists the most recent background jobs; ?status=dead shows the
+// dead-letter queue
+// Used by: /api/admin/jobs?status=&kind=&limit=
+// Response: JobsResponse
+func ListJobsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		query := r.URL.Query()
+		status := query.Get("status")
+		switch status {
+		case "", jobs.StatusPending, jobs.StatusRunning, jobs.StatusSucceeded, jobs.StatusDead:
+		default:
+			http.Error(w, "status must be pending, running, succeeded or dead", http.StatusBadRequest)
+			return
+		}
+
+		limit := defaultJobsLimit
+		if value := query.Get("limit"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+				return
+			}
+			limit = min(n, maxJobsLimit)
+		}
+
+		var response JobsResponse
+		var err error
+		if response.Counts, err = jobs.Counts(db); err == nil {
+			response.Jobs, err = jobs.List(db, status, query.Get("kind"), limit)
+		}
+		if err != nil {
+			log.Printf("Error listing jobs: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// RetryJobHandler moves a dead-lettered job back to the queue
+// Used by: /api/admin/jobs/{id}/retry
+// Response: {"message": string}
+func RetryJobHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid job ID", http.StatusBadRequest)
+			return
+		}
+
+		err = jobs.Retry(db, id)
+		if err == jobs.ErrNotFound {
+			http.Error(w, "Dead job not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error retrying job %d: %v", id, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{"message": "Job queued for retry"})
+	}
+}
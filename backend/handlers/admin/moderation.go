@@ -0,0 +1,252 @@
+package admin
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+
+	"matcherator/backend/handlers/auth"
+	"matcherator/backend/handlers/httputil"
+	"matcherator/backend/handlers/notifications"
+	"matcherator/backend/services/moderation"
+)
+
+// NotificationContentRemoved tells a user an admin took down their content
+const NotificationContentRemoved = "content_removed"
+
+const (
+	defaultModerationLimit = 50
+	maxModerationLimit     = 200
+	maxReviewNoteLen       = 1000
+)
+
+// ModerationReviewRequest dismisses a flag, keeping the content, or removes
+// the flagged content
+type ModerationReviewRequest struct {
+	Action string `json:"action"` // "dismiss" or "remove"
+	Note   string `json:"note"`
+}
+
+// AdminProfile is a profile as listed for admins, with its moderation state
+type AdminProfile struct {
+	UserID           int       `json:"user_id"`
+	Email            string    `json:"email"`
+	Role             string    `json:"role"`
+	OrganizationName string    `json:"organization_name"`
+	PublicListing    bool      `json:"public_listing"`
+	ModerationState  string    `json:"moderation_state"` // "flagged" while flags await review, else "clear"
+	PendingFlags     int       `json:"pending_flags"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// ListModerationFlagsHandler lists flagged content, oldest first
+// Used by: /api/admin/moderation/flags?status=&limit=
+// Response: []moderation.ReviewFlag
+func ListModerationFlagsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		status := r.URL.Query().Get("status")
+		switch status {
+		case "":
+			status = moderation.StatusPending
+		case moderation.StatusPending, moderation.StatusDismissed, moderation.StatusRemoved:
+		default:
+			http.Error(w, "status must be pending, dismissed or removed", http.StatusBadRequest)
+			return
+		}
+
+		limit, ok := moderationLimit(w, r)
+		if !ok {
+			return
+		}
+
+		flags, err := moderation.ListFlags(db, status, limit)
+		if err != nil {
+			log.Printf("Error listing moderation flags: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(flags)
+	}
+}
+
+// ReviewModerationFlagHandler dismisses a flag or removes the flagged content,
+// telling its author when it was removed
+// Used by: /api/admin/moderation/flags/{id}/review
+// Response: moderation.ReviewFlag
+func ReviewModerationFlagHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		adminID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid flag ID", http.StatusBadRequest)
+			return
+		}
+
+		var req ModerationReviewRequest
+		if !httputil.DecodeJSON(w, r, &req) {
+			return
+		}
+		if req.Action != "dismiss" && req.Action != "remove" {
+			http.Error(w, "action must be dismiss or remove", http.StatusBadRequest)
+			return
+		}
+		req.Note = strings.TrimSpace(req.Note)
+		if utf8.RuneCountInString(req.Note) > maxReviewNoteLen {
+			http.Error(w, fmt.Sprintf("Note must be at most %d characters", maxReviewNoteLen), http.StatusBadRequest)
+			return
+		}
+
+		flag, err := moderation.Resolve(db, id, adminID, req.Action == "remove", req.Note)
+		if err == moderation.ErrNotFound {
+			http.Error(w, "Flag not found", http.StatusNotFound)
+			return
+		} else if err == moderation.ErrReviewed {
+			http.Error(w, "Flag was already reviewed", http.StatusConflict)
+			return
+		} else if err != nil {
+			log.Printf("Error reviewing moderation flag %d: %v", id, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		if flag.Status == moderation.StatusRemoved {
+			notifyRemoval(db, flag)
+		}
+
+		json.NewEncoder(w).Encode(flag)
+	}
+}
+
+// ListProfilesHandler lists profiles for admins with their moderation state,
+// newest first
+// Used by: /api/admin/profiles?moderation=flagged|clear&role=&limit=&offset=
+// Response: []AdminProfile
+func ListProfilesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		query := r.URL.Query()
+		state := query.Get("moderation")
+		if state != "" && state != "flagged" && state != "clear" {
+			http.Error(w, "moderation must be flagged or clear", http.StatusBadRequest)
+			return
+		}
+		role := query.Get("role")
+		if role != "" && role != "provider" && role != "recipient" {
+			http.Error(w, "role must be provider or recipient", http.StatusBadRequest)
+			return
+		}
+
+		limit, ok := moderationLimit(w, r)
+		if !ok {
+			return
+		}
+		offset := 0
+		if value := query.Get("offset"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				http.Error(w, "offset must be a non-negative integer", http.StatusBadRequest)
+				return
+			}
+			offset = n
+		}
+
+		rows, err := db.Query(`
+			SELECT u.id, u.email, u.role, COALESCE(p.organization_name, ''), COALESCE(p.public_listing, false),
+				COALESCE(f.pending, 0), u.created_at
+			FROM users u
+			LEFT JOIN profiles p ON p.user_id = u.id
+			LEFT JOIN (
+				SELECT user_id, COUNT(*) AS pending
+				FROM moderation_flags
+				WHERE status = 'pending'
+				GROUP BY user_id
+			) f ON f.user_id = u.id
+			WHERE u.deleted_at IS NULL
+				AND ($1 = '' OR u.role = $1)
+				AND ($2 = '' OR ($2 = 'flagged') = (f.pending IS NOT NULL))
+			ORDER BY u.created_at DESC, u.id DESC
+			LIMIT $3 OFFSET $4
+		`, role, state, limit, offset)
+		if err != nil {
+			log.Printf("Error listing profiles: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		profiles := []AdminProfile{}
+		for rows.Next() {
+			var p AdminProfile
+			if err := rows.Scan(&p.UserID, &p.Email, &p.Role, &p.OrganizationName, &p.PublicListing, &p.PendingFlags, &p.CreatedAt); err != nil {
+				log.Printf("Error scanning profile: %v", err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+			p.ModerationState = "clear"
+			if p.PendingFlags > 0 {
+				p.ModerationState = "flagged"
+			}
+			profiles = append(profiles, p)
+		}
+		if err := rows.Err(); err != nil {
+			log.Printf("Error iterating profiles: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(profiles)
+	}
+}
+
+// moderationLimit parses the limit parameter, writing the error response when
+// it is invalid
+func moderationLimit(w http.ResponseWriter, r *http.Request) (int, bool) {
+	value := r.URL.Query().Get("limit")
+	if value == "" {
+		return defaultModerationLimit, true
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+		return 0, false
+	}
+	return min(n, maxModerationLimit), true
+}
+
+// notifyRemoval tells the author that an admin took their content down
+func notifyRemoval(db *sql.DB, flag *moderation.ReviewFlag) {
+	what := "An FAQ entry on your profile"
+	if flag.ContentType == moderation.ContentProfile {
+		what = "Your " + strings.ReplaceAll(flag.Field, "_", " ")
+	}
+	content := what + " was removed for breaking the content guidelines"
+	if flag.ReviewNote != nil {
+		content += ": " + *flag.ReviewNote
+	}
+
+	if _, err := db.Exec("INSERT INTO notifications (user_id, type, content) VALUES ($1, $2, $3)", flag.UserID, NotificationContentRemoved, content); err != nil {
+		// Don't return error here as the content was still removed successfully
+		log.Printf("Error creating %s notification for user %d: %v", NotificationContentRemoved, flag.UserID, err)
+		return
+	}
+	notifications.SendNotification(flag.UserID, NotificationContentRemoved)
+}
@@ -0,0 +1,140 @@
+package admin
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"matcherator/backend/handlers/auth"
+	"matcherator/backend/handlers/httputil"
+	"matcherator/backend/handlers/notifications"
+	"matcherator/backend/services/virusscan"
+)
+
+// Notifications about quarantined uploads. The uploader learns the outcome;
+// the other side of the connection learns a released file is now available.
+const (
+	NotificationUploadReleased  = "upload_released"
+	NotificationUploadDeleted   = "upload_deleted"
+	NotificationUploadAvailable = "upload_available"
+)
+
+// QuarantineReviewRequest releases a quarantined upload, serving it again, or
+// deletes it
+type QuarantineReviewRequest struct {
+	Action string `json:"action"` // "release" or "delete"
+}
+
+// ListQuarantineHandler lists the uploads quarantined by the virus scan, with
+// the scanner's verdict, oldest first
+// Used by: /api/admin/quarantine
+// Response: []virusscan.Upload
+func ListQuarantineHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		uploads, err := virusscan.List(db)
+		if err != nil {
+			log.Printf("Error listing quarantined uploads: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(uploads)
+	}
+}
+
+// ReviewQuarantineHandler releases or deletes a quarantined upload and tells
+// the uploader
+// Used by: /api/admin/quarantine/{kind}/{id}/review
+// Response: virusscan.Upload
+func ReviewQuarantineHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		adminID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		vars := mux.Vars(r)
+		kind := vars["kind"]
+		if !virusscan.ValidKind(kind) {
+			http.Error(w, "kind must be requirement_document or report_attachment", http.StatusBadRequest)
+			return
+		}
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			http.Error(w, "Invalid upload ID", http.StatusBadRequest)
+			return
+		}
+
+		var req QuarantineReviewRequest
+		if !httputil.DecodeJSON(w, r, &req) {
+			return
+		}
+
+		var upload *virusscan.Upload
+		switch req.Action {
+		case "release":
+			upload, err = virusscan.Release(db, kind, id)
+		case "delete":
+			upload, err = virusscan.Delete(db, kind, id)
+		default:
+			http.Error(w, "action must be release or delete", http.StatusBadRequest)
+			return
+		}
+		if err == virusscan.ErrNotFound {
+			http.Error(w, "Quarantined upload not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error reviewing quarantined %s %d: %v", kind, id, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Admin %d chose to %s quarantined %s %d (%s)", adminID, req.Action, kind, id, upload.Verdict)
+
+		if req.Action == "release" {
+			notifyUpload(db, upload.UploadedBy, NotificationUploadReleased,
+				fmt.Sprintf("Your file %q was reviewed after its virus scan and is now available", upload.FileName))
+			notifyCounterpart(db, upload)
+		} else {
+			notifyUpload(db, upload.UploadedBy, NotificationUploadDeleted,
+				fmt.Sprintf("Your file %q was deleted because it failed its virus scan", upload.FileName))
+		}
+
+		json.NewEncoder(w).Encode(upload)
+	}
+}
+
+// notifyCounterpart tells the other side of the upload's connection that the
+// released file can now be downloaded
+func notifyCounterpart(db *sql.DB, upload *virusscan.Upload) {
+	var userID int
+	err := db.QueryRow(`
+		SELECT CASE WHEN initiator_id = $2 THEN target_id ELSE initiator_id END
+		FROM connections WHERE id = $1
+	`, upload.ConnectionID, upload.UploadedBy).Scan(&userID)
+	if err != nil {
+		log.Printf("Error loading connection %d: %v", upload.ConnectionID, err)
+		return
+	}
+	notifyUpload(db, userID, NotificationUploadAvailable,
+		fmt.Sprintf("The file %q was shared with you and is now available", upload.FileName))
+}
+
+// notifyUpload stores a notification about a quarantined upload and pushes it
+func notifyUpload(db *sql.DB, userID int, notificationType, content string) {
+	if _, err := db.Exec("INSERT INTO notifications (user_id, type, content) VALUES ($1, $2, $3)", userID, notificationType, content); err != nil {
+		// Don't return error here as the upload was still reviewed successfully
+		log.Printf("Error creating %s notification for user %d: %v", notificationType, userID, err)
+		return
+	}
+	notifications.SendNotification(userID, notificationType)
+}
@@ -0,0 +1,31 @@
+package admin
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"matcherator/backend/handlers/httputil"
+)
+
+// ListRoutesHandler lists the API's routes with their methods and what
+// authentication they need, for generating clients and debugging 405s. auth
+// names what each subrouter's middleware requires.
+// Used by: /api/routes
+// Response: []httputil.RouteInfo
+func ListRoutesHandler(router *mux.Router, auth map[*mux.Router]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		routes, err := httputil.ListRoutes(router, auth)
+		if err != nil {
+			log.Printf("Error listing routes: %v", err)
+			http.Error(w, "Error listing routes", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(routes)
+	}
+}
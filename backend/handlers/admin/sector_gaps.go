@@ -0,0 +1,249 @@
+package admin
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// DefaultGapRatio is the recipients per provider above which a sector is
+// under-served, used when ratio is not given
+const DefaultGapRatio = 5.0
+
+// SectorSupply compares recipient demand with provider supply for a sector
+type SectorSupply struct {
+	Sector                string   `json:"sector"`
+	Recipients            int      `json:"recipients"`
+	Providers             int      `json:"providers"`               // Serving the region
+	NationwideProviders   int      `json:"nationwide_providers"`    // Serving every region
+	RecipientsPerProvider *float64 `json:"recipients_per_provider"` // Null without providers
+	UnderServed           bool     `json:"under_served"`
+}
+
+// TermCount is how many active users listed a need or funding type
+type TermCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// RegionSectorGaps is the sector supply and demand of one census region
+type RegionSectorGaps struct {
+	Region       string         `json:"region"`
+	Sectors      []SectorSupply `json:"sectors"`       // Most demanded first
+	UnderServed  []string       `json:"under_served"`  // Sectors, most demanded first
+	Needs        []TermCount    `json:"needs"`         // Of recipients in the region
+	FundingTypes []TermCount    `json:"funding_types"` // Of providers serving the region, nationwide ones included
+}
+
+// SectorGapReport is the sector gap analysis across regions
+type SectorGapReport struct {
+	GeneratedAt time.Time          `json:"generated_at"`
+	Ratio       float64            `json:"ratio"`
+	Regions     []RegionSectorGaps `json:"regions"`
+}
+
+// SectorGapsHandler compares the sectors and needs of active recipients with
+// the sectors and funding types of the active providers serving them, per
+// census region. A sector is under-served where it has recipients but no
+// provider, or more than ratio recipients per provider.
+// Used by: /api/admin/stats/sectors?region=&ratio=
+// Response: SectorGapReport
+func SectorGapsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		region := r.URL.Query().Get("region")
+		if region != "" {
+			valid := false
+			for _, known := range regionOrder {
+				valid = valid || region == known
+			}
+			if !valid {
+				http.Error(w, "region must be Northeast, Midwest, South, West, Territories or Unknown", http.StatusBadRequest)
+				return
+			}
+		}
+
+		ratio := DefaultGapRatio
+		if value := r.URL.Query().Get("ratio"); value != "" {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil || parsed <= 0 {
+				http.Error(w, "ratio must be a positive number", http.StatusBadRequest)
+				return
+			}
+			ratio = parsed
+		}
+
+		report, err := LoadSectorGaps(db, ratio)
+		if err != nil {
+			log.Printf("Error loading sector gaps: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		if region != "" {
+			for _, gaps := range report.Regions {
+				if gaps.Region == region {
+					report.Regions = []RegionSectorGaps{gaps}
+					break
+				}
+			}
+		}
+
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+// regionTally accumulates a region's counts while loading
+type regionTally struct {
+	sectors      map[string]*SectorSupply
+	needs        map[string]int
+	fundingTypes map[string]int
+}
+
+// LoadSectorGaps counts demand and supply per region and sector
+func LoadSectorGaps(db *sql.DB, ratio float64) (*SectorGapReport, error) {
+	tallies := map[string]*regionTally{}
+	for _, region := range regionOrder {
+		tallies[region] = &regionTally{sectors: map[string]*SectorSupply{}, needs: map[string]int{}, fundingTypes: map[string]int{}}
+	}
+	sector := func(region, name string) *SectorSupply {
+		if tallies[region].sectors[name] == nil {
+			tallies[region].sectors[name] = &SectorSupply{Sector: name}
+		}
+		return tallies[region].sectors[name]
+	}
+
+	// Sectors: recipients count where they are based, providers where they serve
+	nationwideSectors := map[string]int{}
+	err := queryRows(db, geoActiveUsers+`
+		SELECT a.role, a.state, a.scope, TRIM(s.sector), COUNT(*)
+		FROM active a
+		JOIN profiles p ON p.user_id = a.id
+		CROSS JOIN LATERAL unnest(p.sectors) AS s(sector)
+		WHERE TRIM(s.sector) <> ''
+		GROUP BY 1, 2, 3, 4
+	`, func(rows *sql.Rows) error {
+		var role, state, scope, name string
+		var n int
+		if err := rows.Scan(&role, &state, &scope, &name, &n); err != nil {
+			return err
+		}
+		if role == "recipient" {
+			sector(regionOf(normalizeState(state)), name).Recipients += n
+		} else if served, nationwide := servedState(state, scope); nationwide {
+			nationwideSectors[name] += n
+		} else {
+			sector(regionOf(served), name).Providers += n
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error counting sectors: %v", err)
+	}
+
+	err = queryRows(db, geoActiveUsers+`
+		SELECT a.state, TRIM(n.need), COUNT(*)
+		FROM active a
+		JOIN recipient_data rd ON rd.user_id = a.id
+		CROSS JOIN LATERAL unnest(rd.needs) AS n(need)
+		WHERE a.role = 'recipient' AND TRIM(n.need) <> ''
+		GROUP BY 1, 2
+	`, func(rows *sql.Rows) error {
+		var state, name string
+		var n int
+		if err := rows.Scan(&state, &name, &n); err != nil {
+			return err
+		}
+		tallies[regionOf(normalizeState(state))].needs[name] += n
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error counting needs: %v", err)
+	}
+
+	err = queryRows(db, geoActiveUsers+`
+		SELECT a.state, a.scope, TRIM(pd.funding_type), COUNT(*)
+		FROM active a
+		JOIN provider_data pd ON pd.user_id = a.id
+		WHERE a.role = 'provider' AND TRIM(COALESCE(pd.funding_type, '')) <> ''
+		GROUP BY 1, 2, 3
+	`, func(rows *sql.Rows) error {
+		var state, scope, name string
+		var n int
+		if err := rows.Scan(&state, &scope, &name, &n); err != nil {
+			return err
+		}
+		if served, nationwide := servedState(state, scope); nationwide {
+			for _, tally := range tallies {
+				tally.fundingTypes[name] += n
+			}
+		} else {
+			tallies[regionOf(served)].fundingTypes[name] += n
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error counting funding types: %v", err)
+	}
+
+	report := &SectorGapReport{GeneratedAt: time.Now().UTC(), Ratio: ratio}
+	for _, region := range regionOrder {
+		tally := tallies[region]
+		gaps := RegionSectorGaps{
+			Region:       region,
+			Sectors:      []SectorSupply{},
+			UnderServed:  []string{},
+			Needs:        sortedCounts(tally.needs),
+			FundingTypes: sortedCounts(tally.fundingTypes),
+		}
+
+		// Nationwide providers supply every region, also where no one else does
+		for name, n := range nationwideSectors {
+			sector(region, name).NationwideProviders = n
+		}
+		for _, supply := range tally.sectors {
+			providers := supply.Providers + supply.NationwideProviders
+			if providers > 0 {
+				perProvider := float64(supply.Recipients) / float64(providers)
+				supply.RecipientsPerProvider = &perProvider
+			}
+			supply.UnderServed = supply.Recipients > 0 && (providers == 0 || *supply.RecipientsPerProvider > ratio)
+			gaps.Sectors = append(gaps.Sectors, *supply)
+		}
+
+		sort.Slice(gaps.Sectors, func(i, j int) bool {
+			if gaps.Sectors[i].Recipients != gaps.Sectors[j].Recipients {
+				return gaps.Sectors[i].Recipients > gaps.Sectors[j].Recipients
+			}
+			return gaps.Sectors[i].Sector < gaps.Sectors[j].Sector
+		})
+		for _, supply := range gaps.Sectors {
+			if supply.UnderServed {
+				gaps.UnderServed = append(gaps.UnderServed, supply.Sector)
+			}
+		}
+		report.Regions = append(report.Regions, gaps)
+	}
+	return report, nil
+}
+
+// sortedCounts lists counts, largest first
+func sortedCounts(counts map[string]int) []TermCount {
+	list := make([]TermCount, 0, len(counts))
+	for name, n := range counts {
+		list = append(list, TermCount{Name: name, Count: n})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Count != list[j].Count {
+			return list[i].Count > list[j].Count
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
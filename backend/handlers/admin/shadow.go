@@ -0,0 +1,206 @@
+package admin
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+
+	"matcherator/backend/handlers/auth"
+	"matcherator/backend/handlers/httputil"
+	"matcherator/backend/services/experiments"
+	"matcherator/backend/services/matches"
+)
+
+const (
+	defaultShadowLargest = 20
+	maxShadowLargest     = 100
+)
+
+// ShadowRunRequest starts a shadow run of a candidate scoring config
+type ShadowRunRequest struct {
+	Name        string                    `json:"name"`
+	Description string                    `json:"description"`
+	Config      experiments.ScoringConfig `json:"config"`
+}
+
+// ListShadowRunsHandler lists shadow runs, newest first
+// Used by: /api/admin/shadow-runs
+// Response: []experiments.ShadowRun
+func ListShadowRunsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		runs, err := experiments.ListShadows(db)
+		if err != nil {
+			log.Printf("Error listing shadow runs: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(runs)
+	}
+}
+
+// CreateShadowRunHandler starts scoring a candidate config in shadow mode
+// Used by: /api/admin/shadow-runs
+// Response: 201 Created, experiments.ShadowRun
+func CreateShadowRunHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		adminID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req ShadowRunRequest
+		if !httputil.DecodeJSON(w, r, &req) {
+			return
+		}
+		req.Name = strings.TrimSpace(req.Name)
+		req.Description = strings.TrimSpace(req.Description)
+		if req.Name == "" || utf8.RuneCountInString(req.Name) > maxExperimentNameLen {
+			http.Error(w, fmt.Sprintf("name is required and at most %d characters", maxExperimentNameLen), http.StatusBadRequest)
+			return
+		}
+		if utf8.RuneCountInString(req.Description) > maxExperimentDescriptionLen {
+			http.Error(w, fmt.Sprintf("description must be at most %d characters", maxExperimentDescriptionLen), http.StatusBadRequest)
+			return
+		}
+		if _, err := matches.PipelineFor("", req.Config); err != nil {
+			http.Error(w, fmt.Sprintf("config: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		run, err := experiments.CreateShadow(db, req.Name, req.Description, req.Config, adminID)
+		if err == experiments.ErrAlreadyRunning {
+			http.Error(w, "Another shadow run is active. Stop it first", http.StatusConflict)
+			return
+		} else if err != nil {
+			log.Printf("Error creating shadow run: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("Admin %d started shadow run %d (%s)", adminID, run.ID, run.Name)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(run)
+	}
+}
+
+// StopShadowRunHandler stops a shadow run, keeping its diffs
+// Used by: /api/admin/shadow-runs/{id}/stop
+// Response: experiments.ShadowRun
+func StopShadowRunHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		adminID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid shadow run ID", http.StatusBadRequest)
+			return
+		}
+
+		run, err := experiments.StopShadow(db, id)
+		if err == experiments.ErrNotFound {
+			http.Error(w, "Shadow run not found", http.StatusNotFound)
+			return
+		} else if err == experiments.ErrInvalidStatus {
+			http.Error(w, "Shadow run is already stopped", http.StatusConflict)
+			return
+		} else if err != nil {
+			log.Printf("Error stopping shadow run %d: %v", id, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("Admin %d stopped shadow run %d", adminID, id)
+		json.NewEncoder(w).Encode(run)
+	}
+}
+
+// ShadowReportHandler aggregates how a shadow run's lists differ from the
+// stored ones, with the users whose lists would change most
+// Used by: /api/admin/shadow-runs/{id}/report?largest=
+// Response: experiments.ShadowReport
+func ShadowReportHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid shadow run ID", http.StatusBadRequest)
+			return
+		}
+
+		largest := defaultShadowLargest
+		if value := r.URL.Query().Get("largest"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				http.Error(w, "largest must be a non-negative integer", http.StatusBadRequest)
+				return
+			}
+			largest = min(n, maxShadowLargest)
+		}
+
+		report, err := experiments.LoadShadowReport(db, id, largest)
+		if err == experiments.ErrNotFound {
+			http.Error(w, "Shadow run not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error loading report of shadow run %d: %v", id, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+// ShadowDiffHandler returns a user's latest diff in a shadow run, with every
+// match that would be added, lost or moved
+// Used by: /api/admin/shadow-runs/{id}/users/{user_id}
+// Response: experiments.ShadowDiff
+func ShadowDiffHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			http.Error(w, "Invalid shadow run ID", http.StatusBadRequest)
+			return
+		}
+		userID, err := strconv.Atoi(vars["user_id"])
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		diff, err := experiments.GetShadowDiff(db, id, userID)
+		if err == experiments.ErrNotFound {
+			http.Error(w, "No diff for this user yet; it is recorded when their matches are recalculated", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error loading shadow diff of user %d in run %d: %v", userID, id, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(diff)
+	}
+}
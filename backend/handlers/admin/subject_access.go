@@ -0,0 +1,197 @@
+package admin
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"matcherator/backend/handlers/auth"
+	"matcherator/backend/services/subjectaccess"
+)
+
+const (
+	defaultSubjectAccessLimit = 50
+	maxSubjectAccessLimit     = 200
+)
+
+// CreateSubjectAccessHandler queues a report of everything stored about a user
+// Used by: /api/admin/users/{id}/subject-access
+// Response: 202 Accepted, subjectaccess.Request
+func CreateSubjectAccessHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		adminID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		userID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		request, err := subjectaccess.Create(db, userID, adminID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error queueing subject-access report for user %d: %v", userID, err)
+			http.Error(w, "Error queueing report", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("Admin %d requested a subject-access report for user %d", adminID, userID)
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(request)
+	}
+}
+
+// ListSubjectAccessHandler lists the most recent subject-access requests
+// Used by: /api/admin/subject-access?user_id=&limit=
+// Response: []subjectaccess.Request
+func ListSubjectAccessHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		query := r.URL.Query()
+		userID := 0
+		if value := query.Get("user_id"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				http.Error(w, "user_id must be a user ID", http.StatusBadRequest)
+				return
+			}
+			userID = n
+		}
+
+		limit := defaultSubjectAccessLimit
+		if value := query.Get("limit"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+				return
+			}
+			limit = min(n, maxSubjectAccessLimit)
+		}
+
+		requests, err := subjectaccess.List(db, userID, limit)
+		if err != nil {
+			log.Printf("Error listing subject-access requests: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(requests)
+	}
+}
+
+// GetSubjectAccessHandler reports whether a subject-access report is ready
+// Used by: /api/admin/subject-access/{id}
+// Response: subjectaccess.Request
+func GetSubjectAccessHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		request, ok := loadSubjectAccess(w, r, db)
+		if !ok {
+			return
+		}
+
+		json.NewEncoder(w).Encode(request)
+	}
+}
+
+// DownloadSubjectAccessHandler serves a compiled report: a ZIP of report.json
+// and the user's uploads
+// Used by: /api/admin/subject-access/{id}/download
+// Response: the ZIP, as an attachment
+func DownloadSubjectAccessHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		request, ok := loadSubjectAccess(w, r, db)
+		if !ok {
+			return
+		}
+
+		path := request.FilePath()
+		if path == "" {
+			http.Error(w, fmt.Sprintf("Report is not available (%s)", request.Status), http.StatusConflict)
+			return
+		}
+
+		file, err := os.Open(path)
+		if os.IsNotExist(err) {
+			http.Error(w, "Report file not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error opening subject-access report %d: %v", request.ID, err)
+			http.Error(w, "Error reading report", http.StatusInternalServerError)
+			return
+		}
+		defer file.Close()
+
+		if adminID, err := auth.GetUserIDFromToken(r); err == nil {
+			log.Printf("Admin %d downloaded subject-access report %d of user %d", adminID, request.ID, request.UserID)
+		}
+
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("subject-access-%d-%d.zip", request.UserID, request.ID)))
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Cache-Control", "private, no-store")
+		http.ServeContent(w, r, "", *request.CompletedAt, file)
+	}
+}
+
+// DeleteSubjectAccessHandler deletes a report's file once it was handed over;
+// the request stays listed
+// Used by: /api/admin/subject-access/{id}
+// Response: 204 No Content
+func DeleteSubjectAccessHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid request ID", http.StatusBadRequest)
+			return
+		}
+
+		if err := subjectaccess.Delete(db, id); err == subjectaccess.ErrNotFound {
+			http.Error(w, "Subject-access request not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error deleting subject-access report %d: %v", id, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// loadSubjectAccess loads the {id} request, writing the error response when
+// there is none
+func loadSubjectAccess(w http.ResponseWriter, r *http.Request, db *sql.DB) (*subjectaccess.Request, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid request ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	request, err := subjectaccess.Get(db, id)
+	if err == subjectaccess.ErrNotFound {
+		http.Error(w, "Subject-access request not found", http.StatusNotFound)
+		return nil, false
+	} else if err != nil {
+		log.Printf("Error loading subject-access request %d: %v", id, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return nil, false
+	}
+	return request, true
+}
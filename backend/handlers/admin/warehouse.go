@@ -0,0 +1,45 @@
+package admin
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"matcherator/backend/services/warehouse"
+)
+
+const (
+	defaultWarehouseExportLimit = 50
+	maxWarehouseExportLimit     = 200
+)
+
+// ListWarehouseExportsHandler lists the most recent daily table exports for BI
+// tooling, with the rows they cover and where unexpired ones are stored
+// Used by: /api/admin/warehouse/exports?limit=
+// Response: []warehouse.Export
+func ListWarehouseExportsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		limit := defaultWarehouseExportLimit
+		if value := r.URL.Query().Get("limit"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+				return
+			}
+			limit = min(n, maxWarehouseExportLimit)
+		}
+
+		list, err := warehouse.List(db, limit)
+		if err != nil {
+			log.Printf("Error listing warehouse exports: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(list)
+	}
+}
@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"matcherator/backend/services/track"
+)
+
+// activityWriteInterval throttles last_active_at writes to one per user per interval
+const activityWriteInterval = 5 * time.Minute
+
+// lastActivityWrites maps user IDs to when their activity was last written
+var lastActivityWrites sync.Map
+
+// TouchActivity records that the user is active. Writes are throttled per user
+// and made in the background, so it is cheap to call on every request or
+// WebSocket message.
+func TouchActivity(db *sql.DB, userID int) {
+	now := time.Now()
+	if last, ok := lastActivityWrites.Load(userID); ok && now.Sub(last.(time.Time)) < activityWriteInterval {
+		return
+	}
+	lastActivityWrites.Store(userID, now)
+
+	go func() {
+		_, err := db.Exec(`
+			UPDATE users SET last_active_at = CURRENT_TIMESTAMP
+			WHERE id = $1 AND (last_active_at IS NULL OR last_active_at < CURRENT_TIMESTAMP - INTERVAL '1 minute')
+		`, userID)
+		if err != nil {
+			log.Printf("Error recording activity for user %d: %v", userID, err)
+		}
+		if err := track.Active(db, userID); err != nil {
+			log.Printf("Error recording weekly activity for user %d: %v", userID, err)
+		}
+	}()
+}
+
+// ActivityMiddleware records the activity of authenticated requests. It must
+// run after AuthMiddleware.
+func ActivityMiddleware(db *sql.DB) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if userID, ok := r.Context().Value("user_id").(int); ok {
+				TouchActivity(db, userID)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
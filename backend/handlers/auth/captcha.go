@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"matcherator/backend/services/captcha"
+)
+
+// CaptchaRequiredHeader is set to "true" on responses telling the client to
+// show a CAPTCHA and send its token as captcha_token with the next attempt
+const CaptchaRequiredHeader = "X-Captcha-Required"
+
+const (
+	// defaultCaptchaLoginThreshold is used when CAPTCHA_LOGIN_THRESHOLD is unset or invalid
+	defaultCaptchaLoginThreshold = 3
+	// failedLoginWindow is how long failed logins count towards the threshold
+	failedLoginWindow = 15 * time.Minute
+)
+
+// checkCaptcha verifies the request's CAPTCHA token and, when it is missing
+// or rejected, returns the status and message to respond with
+func checkCaptcha(w http.ResponseWriter, r *http.Request, token string) (int, string, bool) {
+	switch err := captcha.Verify(token, ClientIP(r)); err {
+	case nil:
+		return 0, "", true
+	case captcha.ErrRequired:
+		w.Header().Set(CaptchaRequiredHeader, "true")
+		return http.StatusForbidden, "Please complete the CAPTCHA", false
+	default:
+		w.Header().Set(CaptchaRequiredHeader, "true")
+		return http.StatusForbidden, "CAPTCHA verification failed. Please try again", false
+	}
+}
+
+// loginNeedsCaptcha reports whether recent failed logins for the email or
+// from the client's address call for a CAPTCHA
+func loginNeedsCaptcha(db *sql.DB, email, ip string) bool {
+	if !captcha.Enabled() {
+		return false
+	}
+
+	var failures int
+	err := db.QueryRow(`
+		SELECT COUNT(*) FROM failed_logins
+		WHERE (email = $1 OR ip_address = $2) AND created_at > $3
+	`, strings.ToLower(email), ip, time.Now().Add(-failedLoginWindow)).Scan(&failures)
+	if err != nil {
+		// Fail closed: ask for a CAPTCHA rather than allow unlimited guesses
+		log.Printf("Error counting failed logins: %v", err)
+		return true
+	}
+	return failures >= captchaLoginThreshold()
+}
+
+// recordFailedLogin counts a failed login towards the CAPTCHA threshold and
+// reports whether the next attempt needs a CAPTCHA
+func recordFailedLogin(db *sql.DB, email, ip string) bool {
+	if !captcha.Enabled() {
+		return false
+	}
+
+	if _, err := db.Exec(`
+		INSERT INTO failed_logins (email, ip_address) VALUES ($1, $2)
+	`, strings.ToLower(email), ip); err != nil {
+		log.Printf("Error recording failed login: %v", err)
+	}
+	// Keep the table small; only the window matters
+	if _, err := db.Exec(`
+		DELETE FROM failed_logins WHERE created_at <= $1
+	`, time.Now().Add(-failedLoginWindow)); err != nil {
+		log.Printf("Error pruning failed logins: %v", err)
+	}
+	return loginNeedsCaptcha(db, email, ip)
+}
+
+// invalidCredentials records a failed login and rejects it, telling the
+// client when the next attempt needs a CAPTCHA
+func invalidCredentials(w http.ResponseWriter, db *sql.DB, email, ip string) {
+	if recordFailedLogin(db, email, ip) {
+		w.Header().Set(CaptchaRequiredHeader, "true")
+	}
+	http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+}
+
+// clearFailedLogins forgets the failed logins for an email after it signed in
+func clearFailedLogins(db *sql.DB, email string) {
+	if !captcha.Enabled() {
+		return
+	}
+	if _, err := db.Exec("DELETE FROM failed_logins WHERE email = $1", strings.ToLower(email)); err != nil {
+		log.Printf("Error clearing failed logins: %v", err)
+	}
+}
+
+// captchaLoginThreshold returns how many failed logins within 15 minutes,
+// per email or address, make login require a CAPTCHA
+func captchaLoginThreshold() int {
+	value := os.Getenv("CAPTCHA_LOGIN_THRESHOLD")
+	if value == "" {
+		return defaultCaptchaLoginThreshold
+	}
+
+	threshold, err := strconv.Atoi(value)
+	if err != nil || threshold < 0 {
+		log.Printf("Invalid CAPTCHA_LOGIN_THRESHOLD %q, using %d", value, defaultCaptchaLoginThreshold)
+		return defaultCaptchaLoginThreshold
+	}
+	return threshold
+}
@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	netmail "net/mail"
+	"strings"
+
+	"matcherator/backend/handlers/httputil"
+	"matcherator/backend/services/emaildomains"
+	"matcherator/backend/services/mail"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// disposableEmailMessage is returned for addresses at throwaway providers
+const disposableEmailMessage = "Please use a permanent email address. Disposable email providers are not accepted"
+
+// ChangeEmailRequest moves the account to a new login email. The current
+// password confirms the change.
+type ChangeEmailRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// ChangeEmailHandler changes the user's login email and tells the old address
+// Used by: /api/me/email
+// Response: {"email": string}
+func ChangeEmailHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req ChangeEmailRequest
+		if !httputil.DecodeJSON(w, r, &req) {
+			return
+		}
+		email := strings.TrimSpace(req.Email)
+		address, err := netmail.ParseAddress(email)
+		if err != nil || address.Address != email || len(email) > 255 {
+			http.Error(w, "Invalid email", http.StatusBadRequest)
+			return
+		}
+
+		if blocked, err := emaildomains.Blocked(db, email); err != nil {
+			log.Printf("Error checking email domain for user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		} else if blocked {
+			http.Error(w, disposableEmailMessage, http.StatusBadRequest)
+			return
+		}
+
+		var oldEmail, hashedPassword string
+		err = db.QueryRow("SELECT email, password_hash FROM users WHERE id = $1", userID).Scan(&oldEmail, &hashedPassword)
+		if err != nil {
+			log.Printf("Error loading user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(req.Password)) != nil {
+			http.Error(w, "Incorrect password", http.StatusForbidden)
+			return
+		}
+
+		if _, err := db.Exec("UPDATE users SET email = $2 WHERE id = $1", userID, email); err != nil {
+			if strings.Contains(err.Error(), "unique constraint") {
+				http.Error(w, "Email already exists", http.StatusConflict)
+				return
+			}
+			log.Printf("Error changing email of user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		if oldEmail != email {
+			body := "The login email of your Grant Matcherator account was changed to " + email + ".\n\nIf you did not make this change, reset your password and contact support.\n"
+			if err := mail.Enqueue(db, oldEmail, "Your login email was changed", body); err != nil && err != mail.ErrNotConfigured {
+				// Don't return error here as the email was still changed successfully
+				log.Printf("Error queueing email change notice for user %d: %v", userID, err)
+			}
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{"email": email})
+	}
+}
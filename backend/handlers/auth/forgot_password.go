@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"matcherator/backend/handlers/httputil"
+	"matcherator/backend/services/mail"
+)
+
+// maxPasswordResetsPerAccount caps the reset links emailed to one account per
+// passwordResetValidity; further requests are accepted but send nothing
+const maxPasswordResetsPerAccount = 3
+
+// ForgotPasswordRequest asks for a password reset link by email
+type ForgotPasswordRequest struct {
+	Email        string `json:"email"`
+	CaptchaToken string `json:"captcha_token"`
+}
+
+// ForgotPasswordHandler emails a single-use link for setting a new password
+// with ResetPasswordHandler. The response is the same whether or not the
+// email has an account.
+// Used by: /api/auth/forgot-password
+// Response: 202 Accepted, {"message": string}
+func ForgotPasswordHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		var req ForgotPasswordRequest
+		if !httputil.DecodeJSON(w, r, &req) {
+			return
+		}
+		email := strings.TrimSpace(req.Email)
+		if email == "" {
+			http.Error(w, "Email is required", http.StatusBadRequest)
+			return
+		}
+
+		if status, message, ok := checkCaptcha(w, r, req.CaptchaToken); !ok {
+			http.Error(w, message, status)
+			return
+		}
+		if !mail.Configured() {
+			http.Error(w, "Password resets by email are not available. Please contact support", http.StatusServiceUnavailable)
+			return
+		}
+
+		accepted := map[string]string{"message": "If an account exists for that email, we sent it a password reset link"}
+
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		// The link goes to the account's own address, however the request spelled it
+		var userID, recent int
+		err = tx.QueryRow(`
+			SELECT u.id, u.email, (
+				SELECT COUNT(*) FROM password_reset_tokens pr
+				WHERE pr.user_id = u.id AND pr.created_at > $2
+			)
+			FROM users u
+			WHERE LOWER(u.email) = LOWER($1) AND u.deleted_at IS NULL
+		`, email, time.Now().Add(-passwordResetValidity)).Scan(&userID, &email, &recent)
+		if err == sql.ErrNoRows {
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(accepted)
+			return
+		} else if err != nil {
+			log.Printf("Error looking up password reset account: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if recent >= maxPasswordResetsPerAccount {
+			// Answer as usual so the limit does not reveal that the account exists
+			log.Printf("Password reset limit reached for user %d", userID)
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(accepted)
+			return
+		}
+
+		reset, err := IssuePasswordReset(tx, userID, passwordResetValidity)
+		if err != nil {
+			log.Printf("Error storing password reset for user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		link := strings.TrimRight(os.Getenv("FRONTEND_URL"), "/") + "/reset-password#token=" + reset.ResetToken
+		body := fmt.Sprintf(`Use the link below to choose a new password for your Grant Matcherator account. It works once and expires in %d minutes:
+%s
+
+Setting a new password signs out every device. If you didn't ask for this link, you can ignore this email; your password stays the same.
+`, int(passwordResetValidity.Minutes()), link)
+
+		if err := mail.Enqueue(tx, email, "Reset your Grant Matcherator password", body); err != nil {
+			log.Printf("Error queueing password reset to user %d: %v", userID, err)
+			http.Error(w, "Could not send the password reset link", http.StatusServiceUnavailable)
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(accepted)
+	}
+}
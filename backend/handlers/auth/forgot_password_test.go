@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"matcherator/backend/services/mail"
+	"matcherator/backend/services/tokens"
+)
+
+// discardSender accepts every email, so that email counts as configured
+type discardSender struct{}
+
+func (discardSender) Send(to, subject, body string) error { return nil }
+
+var resetAccountQuery = `FROM users u\s+WHERE LOWER\(u.email\) = LOWER\(\$1\)`
+
+// forgotPassword posts body to ForgotPasswordHandler
+func forgotPassword(t *testing.T, handler http.HandlerFunc, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodPost, "/api/auth/forgot-password", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+func TestForgotPasswordEmailsResetLink(t *testing.T) {
+	t.Setenv("FRONTEND_URL", "https://matcherator.example/")
+	mail.SetSender(discardSender{})
+	t.Cleanup(func() { mail.SetSender(nil) })
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var tokenHash, payload capture
+	mock.ExpectBegin()
+	mock.ExpectQuery(resetAccountQuery).WithArgs("User@Example.org", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "recent"}).AddRow(7, "user@example.org", 0))
+	mock.ExpectExec(`INSERT INTO password_reset_tokens`).WithArgs(7, &tokenHash, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(`INSERT INTO jobs`).WithArgs(mail.SendJob, &payload, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(12))
+	mock.ExpectCommit()
+
+	w := forgotPassword(t, ForgotPasswordHandler(db), `{"email":" User@Example.org "}`)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusAccepted, w.Body)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The link goes to the account's address and carries the token stored hashed
+	var message mail.Message
+	if err := json.Unmarshal(payload.value.([]byte), &message); err != nil {
+		t.Fatal(err)
+	}
+	if message.To != "user@example.org" {
+		t.Errorf("reset link sent to %q, want the account's address", message.To)
+	}
+	const prefix = "https://matcherator.example/reset-password#token="
+	start := strings.Index(message.Body, prefix)
+	if start < 0 {
+		t.Fatalf("no reset link in %q", message.Body)
+	}
+	token, _, _ := strings.Cut(message.Body[start+len(prefix):], "\n")
+	if tokenHash.value != tokens.Hash(token) {
+		t.Errorf("emailed token %q doesn't match the stored hash", token)
+	}
+}
+
+func TestForgotPasswordSendsNothing(t *testing.T) {
+	mail.SetSender(discardSender{})
+	t.Cleanup(func() { mail.SetSender(nil) })
+
+	tests := []struct {
+		name    string
+		account *sqlmock.Rows
+	}{
+		{"unknown email", sqlmock.NewRows([]string{"id", "email", "recent"})},
+		{"limit reached", sqlmock.NewRows([]string{"id", "email", "recent"}).AddRow(7, "user@example.org", maxPasswordResetsPerAccount)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			// The answer is the same as when a link is sent, but nothing is stored
+			mock.ExpectBegin()
+			mock.ExpectQuery(resetAccountQuery).WillReturnRows(tt.account)
+			mock.ExpectRollback()
+
+			w := forgotPassword(t, ForgotPasswordHandler(db), `{"email":"user@example.org"}`)
+			if w.Code != http.StatusAccepted {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusAccepted)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestForgotPasswordWithoutMail(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if w := forgotPassword(t, ForgotPasswordHandler(db), `{"email":"user@example.org"}`); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+	if w := forgotPassword(t, ForgotPasswordHandler(db), `{"email":"  "}`); w.Code != http.StatusBadRequest {
+		t.Errorf("blank email: status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
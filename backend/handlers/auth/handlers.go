@@ -9,8 +9,12 @@ import (
 	"strings"
 	"time"
 
+	"matcherator/backend/handlers/httputil"
 	"matcherator/backend/handlers/user_status"
+	"matcherator/backend/services/emaildomains"
 	"matcherator/backend/services/matches"
+	"matcherator/backend/services/referrals"
+	"matcherator/backend/services/track"
 
 	"golang.org/x/crypto/bcrypt"
 )
@@ -33,7 +37,7 @@ import (
 //     "omitempty": false
 //   },
 //   "LoginResponse": {
-//     "fields": ["ID", "Email", "Token", "Role"],
+//     "fields": ["ID", "Email", "Token", "Role", "RefreshToken"],
 //     "json_tags": true,
 //     "omitempty": false
 //   }
@@ -49,10 +53,11 @@ type User struct {
 }
 
 type LoginResponse struct {
-	ID    int    `json:"id"`
-	Email string `json:"email"`
-	Token string `json:"token"`
-	Role  string `json:"role"`
+	ID           int    `json:"id"`
+	Email        string `json:"email"`
+	Token        string `json:"token"`
+	Role         string `json:"role"`
+	RefreshToken string `json:"refresh_token"` // Exchanged at /api/auth/refresh for a new token
 }
 
 // SignupHandler handles user registration
@@ -64,13 +69,21 @@ func SignupHandler(db *sql.DB) http.HandlerFunc {
 		w.Header().Set("Content-Type", "application/json")
 
 		var signupRequest struct {
-			Email    string `json:"email"`
-			Password string `json:"password"`
-			Role     string `json:"role"`
+			Email        string `json:"email"`
+			Password     string `json:"password"`
+			Role         string `json:"role"`
+			CaptchaToken string `json:"captcha_token"`
 		}
 
-		if err := json.NewDecoder(r.Body).Decode(&signupRequest); err != nil {
-			json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body"})
+		if reqErr := httputil.ReadJSON(r, &signupRequest); reqErr != nil {
+			w.WriteHeader(reqErr.Status)
+			json.NewEncoder(w).Encode(map[string]string{"error": reqErr.Message})
+			return
+		}
+
+		if status, message, ok := checkCaptcha(w, r, signupRequest.CaptchaToken); !ok {
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(map[string]string{"error": message})
 			return
 		}
 
@@ -81,6 +94,17 @@ func SignupHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		if blocked, err := emaildomains.Blocked(db, signupRequest.Email); err != nil {
+			log.Printf("Error checking email domain at signup: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Database error"})
+			return
+		} else if blocked {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": disposableEmailMessage})
+			return
+		}
+
 		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(signupRequest.Password), bcrypt.DefaultCost)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
@@ -164,10 +188,7 @@ func SignupHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		_, err = tx.Exec(`
-			INSERT INTO tokens (user_id, token, expires_at)
-			VALUES ($1, $2, $3)
-		`, userID, token, time.Now().Add(time.Hour*24))
+		refreshToken, err := StoreSession(tx, userID, token, r)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(map[string]string{"error": "Error storing token"})
@@ -180,11 +201,22 @@ func SignupHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		track.Event(db, userID, track.Signup, track.Properties{"method": "password", "role": signupRequest.Role})
+
+		// Credit the organization whose referral link brought the user here
+		if code := r.URL.Query().Get("ref"); code != "" {
+			if _, err := referrals.Attribute(db, userID, code); err != nil {
+				log.Printf("Error attributing signup of user %d to referral code: %v", userID, err)
+				// Don't return error here as the user was still created successfully
+			}
+		}
+
 		response := LoginResponse{
-			ID:    userID,
-			Email: signupRequest.Email,
-			Token: token,
-			Role:  signupRequest.Role,
+			ID:           userID,
+			Email:        signupRequest.Email,
+			Token:        token,
+			Role:         signupRequest.Role,
+			RefreshToken: refreshToken,
 		}
 
 		w.WriteHeader(http.StatusOK)
@@ -199,22 +231,32 @@ func SignupHandler(db *sql.DB) http.HandlerFunc {
 func LoginHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var loginRequest struct {
-			Email    string `json:"email"`
-			Password string `json:"password"`
+			Email        string `json:"email"`
+			Password     string `json:"password"`
+			CaptchaToken string `json:"captcha_token"`
 		}
 
-		if err := json.NewDecoder(r.Body).Decode(&loginRequest); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+		if !httputil.DecodeJSON(w, r, &loginRequest) {
 			return
 		}
 
+		// Repeated failures for the account or from the client call for a CAPTCHA
+		ip := ClientIP(r)
+		if loginNeedsCaptcha(db, loginRequest.Email, ip) {
+			if status, message, ok := checkCaptcha(w, r, loginRequest.CaptchaToken); !ok {
+				http.Error(w, message, status)
+				return
+			}
+		}
+
 		var user User
 		var hashedPassword string
-		query := `SELECT id, email, password_hash, role FROM users WHERE email = $1`
-		err := db.QueryRow(query, loginRequest.Email).Scan(&user.ID, &user.Email, &hashedPassword, &user.Role)
+		var resetRequired bool
+		query := `SELECT id, email, password_hash, role, password_reset_required FROM users WHERE email = $1`
+		err := db.QueryRow(query, loginRequest.Email).Scan(&user.ID, &user.Email, &hashedPassword, &user.Role, &resetRequired)
 		if err != nil {
 			if err == sql.ErrNoRows {
-				http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+				invalidCredentials(w, db, loginRequest.Email, ip)
 				return
 			}
 			http.Error(w, "Database error", http.StatusInternalServerError)
@@ -223,7 +265,14 @@ func LoginHandler(db *sql.DB) http.HandlerFunc {
 
 		err = bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(loginRequest.Password))
 		if err != nil {
-			http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+			invalidCredentials(w, db, loginRequest.Email, ip)
+			return
+		}
+		clearFailedLogins(db, loginRequest.Email)
+
+		// A login reported as "this wasn't me" locks the password until it is reset
+		if resetRequired {
+			http.Error(w, "A password reset is required. Use the link from your security alert email.", http.StatusForbidden)
 			return
 		}
 
@@ -239,10 +288,7 @@ func LoginHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		_, err = tx.Exec(`
-			INSERT INTO tokens (user_id, token, expires_at)
-			VALUES ($1, $2, $3)
-		`, user.ID, token, time.Now().Add(time.Hour*24))
+		refreshToken, err := StoreSession(tx, user.ID, token, r)
 		if err != nil {
 			tx.Rollback()
 			http.Error(w, "Error storing token", http.StatusInternalServerError)
@@ -254,18 +300,20 @@ func LoginHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		// Alert the user about logins from new countries or devices
+		go recordLogin(db, user.ID, user.Email, newLoginContext(r))
+
 		// Calculate matches after successful login
-		go func() {
-			if err := matches.CalculateAndStoreMatches(db, int64(user.ID), user.Role); err != nil {
-				log.Printf("Error calculating matches for user %d: %v", user.ID, err)
-			}
-		}()
+		if err := matches.EnqueueRecalculation(db, int64(user.ID), user.Role); err != nil {
+			log.Printf("Error queueing match calculation for user %d: %v", user.ID, err)
+		}
 
 		response := LoginResponse{
-			ID:    user.ID,
-			Email: user.Email,
-			Token: token,
-			Role:  user.Role,
+			ID:           user.ID,
+			Email:        user.Email,
+			Token:        token,
+			Role:         user.Role,
+			RefreshToken: refreshToken,
 		}
 
 		w.Header().Set("Content-Type", "application/json")
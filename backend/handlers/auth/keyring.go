@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// defaultKeyID names JWT_SECRET_KEY when JWT_KEY_ID is not set
+const defaultKeyID = "default"
+
+// signingKey is an HMAC secret identified by the JWT "kid" header
+type signingKey struct {
+	ID     string
+	Secret []byte
+}
+
+// keyRing returns the current signing key followed by the previous keys that are
+// still accepted for verification. The current key is JWT_SECRET_KEY named
+// JWT_KEY_ID; JWT_PREVIOUS_KEYS lists retired keys as comma-separated kid:secret
+// pairs. To rotate, move the current key into JWT_PREVIOUS_KEYS and set a new
+// JWT_SECRET_KEY and JWT_KEY_ID; drop the old key once its tokens have expired.
+func keyRing() ([]signingKey, error) {
+	secretKey := os.Getenv("JWT_SECRET_KEY")
+	if secretKey == "" {
+		return nil, fmt.Errorf("JWT_SECRET_KEY environment variable not set")
+	}
+
+	keyID := os.Getenv("JWT_KEY_ID")
+	if keyID == "" {
+		keyID = defaultKeyID
+	}
+	keys := []signingKey{{ID: keyID, Secret: []byte(secretKey)}}
+
+	for _, entry := range strings.Split(os.Getenv("JWT_PREVIOUS_KEYS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, secret, ok := strings.Cut(entry, ":")
+		if !ok || id == "" || secret == "" {
+			return nil, fmt.Errorf("JWT_PREVIOUS_KEYS entries must be kid:secret")
+		}
+		if id == keyID {
+			return nil, fmt.Errorf("JWT_PREVIOUS_KEYS reuses the current key ID %q", id)
+		}
+		keys = append(keys, signingKey{ID: id, Secret: []byte(secret)})
+	}
+
+	return keys, nil
+}
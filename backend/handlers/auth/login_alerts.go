@@ -0,0 +1,321 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+
+	"matcherator/backend/handlers/httputil"
+	"matcherator/backend/services/geoip"
+	"matcherator/backend/services/mail"
+	"matcherator/backend/services/tokens"
+)
+
+const (
+	// loginAlertValidity is how long the "this wasn't me" link in an alert works
+	loginAlertValidity = 7 * 24 * time.Hour
+	// passwordResetValidity is how long a password reset token works
+	passwordResetValidity = time.Hour
+	// minPasswordLength is the shortest password accepted on reset
+	minPasswordLength = 8
+)
+
+// loginContext is what we know about the client of a successful login
+type loginContext struct {
+	IP             string
+	UserAgent      string
+	AcceptLanguage string
+}
+
+// PasswordResetResponse returns a reset token after a login was reported
+type PasswordResetResponse struct {
+	ResetToken string    `json:"reset_token"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// PasswordResetRequest sets a new password with a reset token
+type PasswordResetRequest struct {
+	Token        string `json:"token"`
+	Password     string `json:"password"`
+	CaptchaToken string `json:"captcha_token"`
+}
+
+// newLoginContext captures the client details of a login request
+func newLoginContext(r *http.Request) loginContext {
+	return loginContext{
+		IP:             ClientIP(r),
+		UserAgent:      r.UserAgent(),
+		AcceptLanguage: r.Header.Get("Accept-Language"),
+	}
+}
+
+// ClientIP returns the address of the client, honouring X-Forwarded-For only when
+// TRUST_PROXY_HEADERS=true (the backend runs behind a trusted reverse proxy)
+func ClientIP(r *http.Request) string {
+	if os.Getenv("TRUST_PROXY_HEADERS") == "true" {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			first, _, _ := strings.Cut(forwarded, ",")
+			return strings.TrimSpace(first)
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// deviceFingerprint identifies a browser by its user agent and languages
+func deviceFingerprint(c loginContext) string {
+	return tokens.Hash(c.UserAgent + "\x00" + c.AcceptLanguage)
+}
+
+// recordLogin stores a successful login and, when it comes from a country or
+// device the user has not logged in from before, notifies them in-app and by
+// email with a "this wasn't me" link. The first login only sets a baseline.
+func recordLogin(db *sql.DB, userID int, email string, c loginContext) {
+	country := geoip.Country(c.IP)
+	fingerprint := deviceFingerprint(c)
+
+	var previous, sameDevice, withCountry, sameCountry int
+	err := db.QueryRow(`
+		SELECT
+			COUNT(*),
+			COUNT(*) FILTER (WHERE device_fingerprint = $2),
+			COUNT(*) FILTER (WHERE country IS NOT NULL),
+			COUNT(*) FILTER (WHERE country = NULLIF($3, ''))
+		FROM login_events
+		WHERE user_id = $1
+	`, userID, fingerprint, country).Scan(&previous, &sameDevice, &withCountry, &sameCountry)
+	if err != nil {
+		log.Printf("Error loading login history for user %d: %v", userID, err)
+		return
+	}
+
+	newDevice := previous > 0 && sameDevice == 0
+	newCountry := country != "" && withCountry > 0 && sameCountry == 0
+	suspicious := newDevice || newCountry
+
+	var alertToken, alertTokenHash string
+	if suspicious {
+		if alertToken, err = tokens.NewSecret(); err != nil {
+			log.Printf("Error generating login alert token: %v", err)
+			return
+		}
+		alertTokenHash = tokens.Hash(alertToken)
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO login_events (
+			user_id, ip_address, country, device_fingerprint,
+			user_agent, suspicious, alert_token_hash
+		) VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, NULLIF($7, ''))
+	`, userID, c.IP, country, fingerprint, c.UserAgent, suspicious, alertTokenHash)
+	if err != nil {
+		log.Printf("Error recording login for user %d: %v", userID, err)
+		return
+	}
+
+	if !suspicious {
+		return
+	}
+
+	where := "a new device"
+	if newCountry {
+		where = "a new country (" + country + ")"
+	}
+
+	// The in-app notification is visible to whoever just logged in, so only the
+	// email carries the "this wasn't me" link
+	_, err = db.Exec(`
+		INSERT INTO notifications (user_id, type, content)
+		VALUES ($1, 'security_alert', $2)
+	`, userID, fmt.Sprintf("New sign-in to your account from %s. If this wasn't you, use the link in the email we sent you.", where))
+	if err != nil {
+		log.Printf("Error creating login alert notification for user %d: %v", userID, err)
+	}
+
+	link := strings.TrimRight(os.Getenv("FRONTEND_URL"), "/") + "/login-alert#token=" + alertToken
+	body := fmt.Sprintf(`We noticed a new sign-in to your Grant Matcherator account from %s.
+
+Time: %s
+IP address: %s
+Browser: %s
+
+If this was you, you can ignore this email.
+
+If this wasn't you, open the link below. We'll sign out all sessions and ask you to choose a new password:
+%s
+`, where, time.Now().UTC().Format(time.RFC1123), c.IP, c.UserAgent, link)
+
+	if err := mail.Enqueue(db, email, "New sign-in to your Grant Matcherator account", body); err != nil {
+		log.Printf("Error queueing login alert to user %d: %v", userID, err)
+	}
+}
+
+// DenyLoginHandler handles "this wasn't me" for a login alert: it signs out all
+// of the user's sessions, blocks password login until the password is reset, and
+// returns a reset token
+// Used by: /api/auth/login-alerts/{token}/deny
+// Response: PasswordResetResponse
+func DenyLoginHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		var userID int
+		err = tx.QueryRow(`
+			UPDATE login_events
+			SET denied_at = CURRENT_TIMESTAMP
+			WHERE alert_token_hash = $1
+				AND denied_at IS NULL
+				AND created_at > $2
+			RETURNING user_id
+		`, tokens.Hash(mux.Vars(r)["token"]), time.Now().Add(-loginAlertValidity)).Scan(&userID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Invalid or expired link", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error denying login: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		if _, err := tx.Exec(`UPDATE users SET password_reset_required = true WHERE id = $1`, userID); err != nil {
+			log.Printf("Error requiring password reset: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		if _, err := tx.Exec(`DELETE FROM tokens WHERE user_id = $1`, userID); err != nil {
+			log.Printf("Error revoking tokens: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		response, err := IssuePasswordReset(tx, userID, passwordResetValidity)
+		if err != nil {
+			log.Printf("Error storing password reset: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("User %d reported a login as not theirs; sessions revoked", userID)
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// IssuePasswordReset stores a single-use token that lets whoever holds it set
+// the user's password with ResetPasswordHandler until it expires
+func IssuePasswordReset(tx *sql.Tx, userID int, validity time.Duration) (PasswordResetResponse, error) {
+	token, err := tokens.NewSecret()
+	if err != nil {
+		return PasswordResetResponse{}, err
+	}
+	response := PasswordResetResponse{ResetToken: token, ExpiresAt: time.Now().Add(validity)}
+
+	_, err = tx.Exec(`
+		INSERT INTO password_reset_tokens (user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)
+	`, userID, tokens.Hash(token), response.ExpiresAt)
+	if err != nil {
+		return PasswordResetResponse{}, err
+	}
+	return response, nil
+}
+
+// ResetPasswordHandler sets a new password using a reset token and signs out
+// all existing sessions
+// Used by: /api/auth/reset-password (and /api/auth/password-reset)
+// Response: 204 No Content
+func ResetPasswordHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req PasswordResetRequest
+		if !httputil.DecodeJSON(w, r, &req) {
+			return
+		}
+
+		if status, message, ok := checkCaptcha(w, r, req.CaptchaToken); !ok {
+			http.Error(w, message, status)
+			return
+		}
+
+		if len(req.Password) < minPasswordLength {
+			http.Error(w, fmt.Sprintf("Password must be at least %d characters", minPasswordLength), http.StatusBadRequest)
+			return
+		}
+
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			http.Error(w, "Error hashing password", http.StatusInternalServerError)
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		var userID int
+		err = tx.QueryRow(`
+			UPDATE password_reset_tokens
+			SET used_at = CURRENT_TIMESTAMP
+			WHERE token_hash = $1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+			RETURNING user_id
+		`, tokens.Hash(req.Token)).Scan(&userID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Invalid or expired reset token", http.StatusBadRequest)
+			return
+		} else if err != nil {
+			log.Printf("Error consuming password reset: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		_, err = tx.Exec(`
+			UPDATE users
+			SET password_hash = $1, password_reset_required = false
+			WHERE id = $2
+		`, string(hashedPassword), userID)
+		if err != nil {
+			log.Printf("Error updating password: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		if _, err := tx.Exec(`DELETE FROM tokens WHERE user_id = $1`, userID); err != nil {
+			log.Printf("Error revoking tokens: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
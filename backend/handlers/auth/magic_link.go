@@ -0,0 +1,222 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"matcherator/backend/handlers/httputil"
+	"matcherator/backend/services/mail"
+	"matcherator/backend/services/matches"
+	"matcherator/backend/services/tokens"
+)
+
+const (
+	// magicLinkValidity is how long an emailed login link works
+	magicLinkValidity = 15 * time.Minute
+	// maxMagicLinksPerAccount caps the links emailed to one account per validity
+	// period; further requests are accepted but send nothing
+	maxMagicLinksPerAccount = 3
+	// maxMagicLinksPerIP caps the links requested from one address per hour
+	maxMagicLinksPerIP = 10
+)
+
+// MagicLinkRequest asks for a login link by email
+type MagicLinkRequest struct {
+	Email string `json:"email"`
+}
+
+// MagicLinkExchangeRequest trades the token from a login link for a session
+type MagicLinkExchangeRequest struct {
+	Token string `json:"token"`
+}
+
+// RequestMagicLinkHandler emails a one-time login link. The response is the
+// same whether or not the email has an account.
+// Used by: /api/auth/magic-link
+// Response: 202 Accepted, {"message": string}
+func RequestMagicLinkHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		var req MagicLinkRequest
+		if !httputil.DecodeJSON(w, r, &req) {
+			return
+		}
+		email := strings.TrimSpace(req.Email)
+		if email == "" {
+			http.Error(w, "Email is required", http.StatusBadRequest)
+			return
+		}
+		if !mail.Configured() {
+			http.Error(w, "Login links are not available. Please sign in with your password", http.StatusServiceUnavailable)
+			return
+		}
+
+		ip := ClientIP(r)
+		var fromIP int
+		err := db.QueryRow(`
+			SELECT COUNT(*) FROM magic_links WHERE ip_address = $1 AND created_at > $2
+		`, ip, time.Now().Add(-time.Hour)).Scan(&fromIP)
+		if err != nil {
+			log.Printf("Error counting magic links: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if fromIP >= maxMagicLinksPerIP {
+			w.Header().Set("Retry-After", "3600")
+			http.Error(w, "Too many login links requested. Please try again later", http.StatusTooManyRequests)
+			return
+		}
+
+		accepted := map[string]string{"message": "If an account exists for that email, we sent it a login link"}
+
+		// The link goes to the account's own address, however the request spelled it
+		var userID, recent int
+		err = db.QueryRow(`
+			SELECT u.id, u.email, (
+				SELECT COUNT(*) FROM magic_links m
+				WHERE m.user_id = u.id AND m.created_at > $2
+			)
+			FROM users u
+			WHERE LOWER(u.email) = LOWER($1)
+		`, email, time.Now().Add(-magicLinkValidity)).Scan(&userID, &email, &recent)
+		if err == sql.ErrNoRows {
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(accepted)
+			return
+		} else if err != nil {
+			log.Printf("Error looking up magic link account: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if recent >= maxMagicLinksPerAccount {
+			// Answer as usual so the limit does not reveal that the account exists
+			log.Printf("Magic link limit reached for user %d", userID)
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(accepted)
+			return
+		}
+
+		token, err := tokens.NewSecret()
+		if err != nil {
+			http.Error(w, "Error generating login link", http.StatusInternalServerError)
+			return
+		}
+		expiresAt := time.Now().Add(magicLinkValidity)
+
+		_, err = db.Exec(`
+			INSERT INTO magic_links (user_id, token_hash, ip_address, expires_at)
+			VALUES ($1, $2, $3, $4)
+		`, userID, tokens.Hash(token), ip, expiresAt)
+		if err != nil {
+			log.Printf("Error storing magic link for user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		link := strings.TrimRight(os.Getenv("FRONTEND_URL"), "/") + "/magic-link#token=" + token
+		body := fmt.Sprintf(`Use the link below to sign in to your Grant Matcherator account. It works once and expires in %d minutes:
+%s
+
+If you didn't ask for this link, you can ignore this email; nobody can sign in without it.
+`, int(magicLinkValidity.Minutes()), link)
+
+		if err := mail.Enqueue(db, email, "Your Grant Matcherator login link", body); err != nil {
+			log.Printf("Error queueing magic link to user %d: %v", userID, err)
+			http.Error(w, "Could not send the login link", http.StatusServiceUnavailable)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(accepted)
+	}
+}
+
+// ExchangeMagicLinkHandler signs the user in with the token from a login link.
+// Each link works once, until it expires.
+// Used by: /api/auth/magic-link/exchange
+// Response: LoginResponse
+func ExchangeMagicLinkHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		var req MagicLinkExchangeRequest
+		if !httputil.DecodeJSON(w, r, &req) {
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		var user User
+		var resetRequired bool
+		err = tx.QueryRow(`
+			UPDATE magic_links m
+			SET used_at = CURRENT_TIMESTAMP
+			FROM users u
+			WHERE m.token_hash = $1
+				AND m.used_at IS NULL
+				AND m.expires_at > CURRENT_TIMESTAMP
+				AND u.id = m.user_id
+			RETURNING u.id, u.email, u.role, u.password_reset_required
+		`, tokens.Hash(req.Token)).Scan(&user.ID, &user.Email, &user.Role, &resetRequired)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Invalid or expired login link", http.StatusUnauthorized)
+			return
+		} else if err != nil {
+			log.Printf("Error consuming magic link: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		// A login reported as "this wasn't me" locks the account until the password is reset
+		if resetRequired {
+			http.Error(w, "A password reset is required. Use the link from your security alert email.", http.StatusForbidden)
+			return
+		}
+
+		token, err := GenerateToken(user.ID)
+		if err != nil {
+			http.Error(w, "Error generating token", http.StatusInternalServerError)
+			return
+		}
+
+		refreshToken, err := StoreSession(tx, user.ID, token, r)
+		if err != nil {
+			http.Error(w, "Error storing token", http.StatusInternalServerError)
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Error completing login", http.StatusInternalServerError)
+			return
+		}
+		clearFailedLogins(db, user.Email)
+
+		// Alert the user about logins from new countries or devices
+		go recordLogin(db, user.ID, user.Email, newLoginContext(r))
+
+		// Calculate matches after successful login
+		if err := matches.EnqueueRecalculation(db, int64(user.ID), user.Role); err != nil {
+			log.Printf("Error queueing match calculation for user %d: %v", user.ID, err)
+		}
+
+		json.NewEncoder(w).Encode(LoginResponse{
+			ID:           user.ID,
+			Email:        user.Email,
+			Token:        token,
+			Role:         user.Role,
+			RefreshToken: refreshToken,
+		})
+	}
+}
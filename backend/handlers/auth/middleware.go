@@ -2,20 +2,57 @@ package auth
 
 import (
 	"context"
+	"database/sql"
+	"log"
 	"net/http"
 )
 
-// AuthMiddleware is a middleware that checks for a valid JWT token and sets the user_id in the context
-func AuthMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		userID, err := GetUserIDFromToken(r)
-		if err != nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
+// AuthMiddleware is a middleware that checks for a valid JWT token of an active
+// session and sets the user_id in the context
+func AuthMiddleware(db *sql.DB) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, err := GetUserIDFromToken(r)
+			if err != nil {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
 
-		// Create a new context with the user ID
-		ctx := context.WithValue(r.Context(), "user_id", userID)
-		next.ServeHTTP(w, r.WithContext(ctx))
-	})
+			// Signed-out sessions keep valid signatures until they expire
+			if _, err := sessionFor(db, userID, bearerToken(r)); err == ErrSessionRevoked {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			} else if err != nil {
+				log.Printf("Error checking session of user %d: %v", userID, err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+
+			// Create a new context with the user ID
+			ctx := context.WithValue(r.Context(), "user_id", userID)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// AdminMiddleware rejects requests from users that are not administrators
+func AdminMiddleware(db *sql.DB) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, err := GetUserIDFromToken(r)
+			if err != nil {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			var isAdmin bool
+			err = db.QueryRow("SELECT is_admin FROM users WHERE id = $1", userID).Scan(&isAdmin)
+			if err != nil || !isAdmin {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
 }
@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"matcherator/backend/handlers/httputil"
+	"matcherator/backend/services/tokens"
+)
+
+// DefaultRefreshTokenTTL is used when REFRESH_TOKEN_TTL is unset or invalid
+const DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+
+// RefreshTokenTTL is how long a session can go unrefreshed before it ends,
+// from REFRESH_TOKEN_TTL (a Go duration). Each refresh starts it over.
+func RefreshTokenTTL() time.Duration {
+	if value := os.Getenv("REFRESH_TOKEN_TTL"); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d > 0 {
+			return d
+		}
+		log.Printf("Invalid REFRESH_TOKEN_TTL %q, using %s", value, DefaultRefreshTokenTTL)
+	}
+	return DefaultRefreshTokenTTL
+}
+
+// issueRefreshToken creates a refresh token for a session, stored hashed
+func issueRefreshToken(tx *sql.Tx, sessionID int) (string, error) {
+	token, err := tokens.NewSecret()
+	if err != nil {
+		return "", err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO refresh_tokens (session_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)
+	`, sessionID, tokens.Hash(token), time.Now().Add(RefreshTokenTTL()))
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// RefreshHandler exchanges a refresh token for a new token and refresh token,
+// extending the session. A refresh token presented a second time signs its
+// session out, since one of the two holders must have stolen it.
+// Used by: /api/auth/refresh
+// Response: LoginResponse
+func RefreshHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			RefreshToken string `json:"refresh_token"`
+		}
+		if !httputil.DecodeJSON(w, r, &req) {
+			return
+		}
+		if req.RefreshToken == "" {
+			http.Error(w, "refresh_token is required", http.StatusBadRequest)
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		var refreshID, sessionID int
+		var used, expired, blocked bool
+		var user User
+		err = tx.QueryRow(`
+			SELECT rt.id, rt.session_id, rt.used_at IS NOT NULL, rt.expires_at <= CURRENT_TIMESTAMP,
+				u.id, u.email, u.role, u.deleted_at IS NOT NULL OR u.password_reset_required
+			FROM refresh_tokens rt
+			JOIN tokens t ON t.id = rt.session_id
+			JOIN users u ON u.id = t.user_id
+			WHERE rt.token_hash = $1
+			FOR UPDATE OF rt, t
+		`, tokens.Hash(req.RefreshToken)).Scan(&refreshID, &sessionID, &used, &expired, &user.ID, &user.Email, &user.Role, &blocked)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Invalid or expired refresh token", http.StatusUnauthorized)
+			return
+		} else if err != nil {
+			log.Printf("Error loading refresh token: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		if used {
+			if _, err := tx.Exec(`DELETE FROM tokens WHERE id = $1`, sessionID); err != nil {
+				log.Printf("Error revoking session %d: %v", sessionID, err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+			if err := tx.Commit(); err != nil {
+				log.Printf("Error revoking session %d: %v", sessionID, err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+			lastSessionTouches.Delete(sessionID)
+			log.Printf("Refresh token of session %d of user %d was reused; session revoked", sessionID, user.ID)
+			http.Error(w, "Invalid or expired refresh token", http.StatusUnauthorized)
+			return
+		}
+		if expired || blocked {
+			http.Error(w, "Invalid or expired refresh token", http.StatusUnauthorized)
+			return
+		}
+
+		token, err := GenerateToken(user.ID)
+		if err != nil {
+			http.Error(w, "Error generating token", http.StatusInternalServerError)
+			return
+		}
+
+		if _, err := tx.Exec(`UPDATE refresh_tokens SET used_at = CURRENT_TIMESTAMP WHERE id = $1`, refreshID); err != nil {
+			log.Printf("Error using refresh token of session %d: %v", sessionID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		_, err = tx.Exec(`
+			UPDATE tokens SET jti = $2, expires_at = $3, last_used_at = CURRENT_TIMESTAMP
+			WHERE id = $1
+		`, sessionID, sessionKey(token), time.Now().Add(RefreshTokenTTL()))
+		if err != nil {
+			log.Printf("Error refreshing session %d: %v", sessionID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		refreshToken, err := issueRefreshToken(tx, sessionID)
+		if err != nil {
+			log.Printf("Error issuing refresh token for session %d: %v", sessionID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Error completing refresh", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(LoginResponse{
+			ID:           user.ID,
+			Email:        user.Email,
+			Token:        token,
+			Role:         user.Role,
+			RefreshToken: refreshToken,
+		})
+	}
+}
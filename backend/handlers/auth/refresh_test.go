@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"matcherator/backend/services/tokens"
+)
+
+const presentedRefreshToken = "presented-refresh-token"
+
+var refreshLookupQuery = `FROM refresh_tokens rt\s+JOIN tokens t ON t.id = rt.session_id`
+
+// capture is a sqlmock argument that matches anything and keeps the value
+type capture struct{ value driver.Value }
+
+func (c *capture) Match(v driver.Value) bool {
+	c.value = v
+	return true
+}
+
+// refreshRow is the refresh token lookup's row for session 3 of user 7
+func refreshRow(used, expired bool) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "session_id", "used", "expired", "user_id", "email", "role", "blocked"}).
+		AddRow(10, 3, used, expired, 7, "user@example.org", "provider", false)
+}
+
+// refresh posts body to a refresh handler
+func refresh(handler http.HandlerFunc, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/api/auth/refresh", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+func TestRefreshRotatesTokens(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", "test-secret")
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var jti, refreshHash capture
+	mock.ExpectBegin()
+	mock.ExpectQuery(refreshLookupQuery).WithArgs(tokens.Hash(presentedRefreshToken)).WillReturnRows(refreshRow(false, false))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE refresh_tokens SET used_at = CURRENT_TIMESTAMP WHERE id = $1`)).
+		WithArgs(10).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE tokens SET jti = \$2`).WithArgs(3, &jti, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO refresh_tokens`).WithArgs(3, &refreshHash, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(11, 1))
+	mock.ExpectCommit()
+
+	w := refresh(RefreshHandler(db), `{"refresh_token":"`+presentedRefreshToken+`"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	var response LoginResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+
+	// The session moves to the new token, and only the new refresh token's hash is kept
+	if jti.value != sessionKey(response.Token) {
+		t.Errorf("session jti = %v, want the new token's %q", jti.value, sessionKey(response.Token))
+	}
+	if response.RefreshToken == presentedRefreshToken || refreshHash.value != tokens.Hash(response.RefreshToken) {
+		t.Errorf("refresh token %q not rotated (stored hash %v)", response.RefreshToken, refreshHash.value)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRefreshTokenReuseRevokesSession(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	lastSessionTouches.Store(3, time.Now())
+	t.Cleanup(func() { lastSessionTouches.Delete(3) })
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(refreshLookupQuery).WithArgs(tokens.Hash(presentedRefreshToken)).WillReturnRows(refreshRow(true, false))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM tokens WHERE id = $1`)).WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	w := refresh(RefreshHandler(db), `{"refresh_token":"`+presentedRefreshToken+`"}`)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if _, ok := lastSessionTouches.Load(3); ok {
+		t.Error("revoked session's last use kept")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRefreshRejectsExpiredToken(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// An expired refresh token neither rotates nor signs the session out
+	mock.ExpectBegin()
+	mock.ExpectQuery(refreshLookupQuery).WillReturnRows(refreshRow(false, true))
+	mock.ExpectRollback()
+
+	w := refresh(RefreshHandler(db), `{"refresh_token":"`+presentedRefreshToken+`"}`)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+
+	if w := refresh(RefreshHandler(db), `{"refresh_token":""}`); w.Code != http.StatusBadRequest {
+		t.Errorf("empty refresh token: status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
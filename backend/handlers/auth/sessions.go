@@ -0,0 +1,301 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// sessionTouchInterval throttles last_used_at writes to one per session per interval
+const sessionTouchInterval = 5 * time.Minute
+
+// maxUserAgentLen caps the user agent stored with a session
+const maxUserAgentLen = 512
+
+// sessionPurgeInterval is how often expired sessions are deleted
+const sessionPurgeInterval = time.Hour
+
+// ErrSessionRevoked is returned for a valid token whose session was signed out
+// or has expired
+var ErrSessionRevoked = errors.New("session revoked or expired")
+
+// lastSessionTouches maps session IDs to when their last use was last written
+var lastSessionTouches sync.Map
+
+// Session is a signed-in device: one issued token
+type Session struct {
+	ID         int        `json:"id"`
+	UserAgent  string     `json:"user_agent"`
+	IPAddress  string     `json:"ip_address"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	Current    bool       `json:"current"` // The session making the request
+}
+
+// StoreSession records an issued token as a session of the client that asked
+// for it and returns the session's first refresh token. Tokens only work while
+// their session exists, which is as long as it can be refreshed.
+func StoreSession(tx *sql.Tx, userID int, token string, r *http.Request) (string, error) {
+	userAgent := r.UserAgent()
+	if len(userAgent) > maxUserAgentLen {
+		userAgent = userAgent[:maxUserAgentLen]
+	}
+
+	// Expired sessions are no longer listed; drop them while we are here
+	if _, err := tx.Exec(`DELETE FROM tokens WHERE user_id = $1 AND expires_at <= CURRENT_TIMESTAMP`, userID); err != nil {
+		return "", err
+	}
+
+	var sessionID int
+	err := tx.QueryRow(`
+		INSERT INTO tokens (user_id, jti, expires_at, user_agent, ip_address)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''))
+		RETURNING id
+	`, userID, sessionKey(token), time.Now().Add(RefreshTokenTTL()), userAgent, ClientIP(r)).Scan(&sessionID)
+	if err != nil {
+		return "", err
+	}
+	return issueRefreshToken(tx, sessionID)
+}
+
+// ValidateToken checks a bearer token's signature and that its session is
+// still active, returning the user ID. WebSocket handlers, which get the
+// token as a query parameter, use it in place of AuthMiddleware.
+func ValidateToken(db *sql.DB, token string) (int, error) {
+	userID, err := GetUserIDFromToken(&http.Request{
+		Header: http.Header{"Authorization": []string{"Bearer " + token}},
+	})
+	if err != nil {
+		return 0, err
+	}
+	if _, err := sessionFor(db, userID, token); err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
+
+// sessionFor returns the active session of a token and records that it was used
+func sessionFor(db *sql.DB, userID int, token string) (int, error) {
+	var sessionID int
+	err := db.QueryRow(`
+		SELECT id FROM tokens
+		WHERE jti = $1 AND user_id = $2 AND expires_at > CURRENT_TIMESTAMP
+	`, sessionKey(token), userID).Scan(&sessionID)
+	if err == sql.ErrNoRows {
+		return 0, ErrSessionRevoked
+	} else if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	if last, ok := lastSessionTouches.Load(sessionID); !ok || now.Sub(last.(time.Time)) >= sessionTouchInterval {
+		lastSessionTouches.Store(sessionID, now)
+		go func() {
+			if _, err := db.Exec(`UPDATE tokens SET last_used_at = CURRENT_TIMESTAMP WHERE id = $1`, sessionID); err != nil {
+				log.Printf("Error recording use of session %d: %v", sessionID, err)
+			}
+		}()
+	}
+	return sessionID, nil
+}
+
+// bearerToken returns the token of the request's Authorization header
+func bearerToken(r *http.Request) string {
+	return strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
+
+// StartSessionPurger deletes expired sessions every hour until ctx is done
+func StartSessionPurger(ctx context.Context, db *sql.DB) {
+	go func() {
+		ticker := time.NewTicker(sessionPurgeInterval)
+		defer ticker.Stop()
+
+		for {
+			if err := purgeExpiredSessions(db); err != nil {
+				log.Printf("Error purging expired sessions: %v", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// purgeExpiredSessions deletes sessions and refresh tokens past their expiry
+// and forgets when the sessions were last used
+func purgeExpiredSessions(db *sql.DB) error {
+	if _, err := db.Exec(`DELETE FROM refresh_tokens WHERE expires_at <= CURRENT_TIMESTAMP`); err != nil {
+		return err
+	}
+
+	rows, err := db.Query(`DELETE FROM tokens WHERE expires_at <= CURRENT_TIMESTAMP RETURNING id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var sessionID int
+		if err := rows.Scan(&sessionID); err != nil {
+			return err
+		}
+		lastSessionTouches.Delete(sessionID)
+	}
+	return rows.Err()
+}
+
+// LogoutHandler signs out the session making the request; its token is
+// rejected from then on
+// Used by: /api/auth/logout
+// Response: 204 No Content
+func LogoutHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var sessionID int
+		err = db.QueryRow(`DELETE FROM tokens WHERE user_id = $1 AND jti = $2 RETURNING id`, userID, sessionKey(bearerToken(r))).Scan(&sessionID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		} else if err != nil {
+			log.Printf("Error signing out user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		lastSessionTouches.Delete(sessionID)
+
+		log.Printf("User %d signed out session %d", userID, sessionID)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// GetSessionsHandler lists the user's signed-in devices, most recent first
+// Used by: /api/me/sessions
+// Response: []Session
+func GetSessionsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		rows, err := db.Query(`
+			SELECT id, COALESCE(user_agent, ''), COALESCE(ip_address, ''),
+				created_at, last_used_at, expires_at, jti = $2
+			FROM tokens
+			WHERE user_id = $1 AND expires_at > CURRENT_TIMESTAMP
+			ORDER BY COALESCE(last_used_at, created_at) DESC
+		`, userID, sessionKey(bearerToken(r)))
+		if err != nil {
+			log.Printf("Error listing sessions of user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		sessions := []Session{}
+		for rows.Next() {
+			var session Session
+			if err := rows.Scan(
+				&session.ID, &session.UserAgent, &session.IPAddress,
+				&session.CreatedAt, &session.LastUsedAt, &session.ExpiresAt, &session.Current,
+			); err != nil {
+				log.Printf("Error scanning session: %v", err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+			sessions = append(sessions, session)
+		}
+		if err := rows.Err(); err != nil {
+			log.Printf("Error listing sessions of user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(sessions)
+	}
+}
+
+// DeleteSessionHandler signs out one of the user's devices, which may be the
+// current one
+// Used by: /api/me/sessions/{id}
+// Response: 204 No Content
+func DeleteSessionHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		sessionID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid session ID", http.StatusBadRequest)
+			return
+		}
+
+		result, err := db.Exec(`DELETE FROM tokens WHERE id = $1 AND user_id = $2`, sessionID, userID)
+		if err != nil {
+			log.Printf("Error deleting session %d of user %d: %v", sessionID, userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// DeleteSessionsHandler signs the user out everywhere; with
+// ?keep_current=true the device making the request stays signed in
+// Used by: /api/me/sessions?keep_current=
+// Response: {"revoked": int}
+func DeleteSessionsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		keep := ""
+		if r.URL.Query().Get("keep_current") == "true" {
+			keep = sessionKey(bearerToken(r))
+		}
+
+		result, err := db.Exec(`DELETE FROM tokens WHERE user_id = $1 AND jti <> $2`, userID, keep)
+		if err != nil {
+			log.Printf("Error deleting sessions of user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		revoked, _ := result.RowsAffected()
+
+		json.NewEncoder(w).Encode(map[string]int64{"revoked": revoked})
+	}
+}
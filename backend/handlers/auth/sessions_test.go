@@ -0,0 +1,280 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+)
+
+// activeSessionQuery is the lookup sessionFor makes; a session past its
+// expiry is never returned by it
+var activeSessionQuery = regexp.QuoteMeta(`
+		SELECT id FROM tokens
+		WHERE jti = $1 AND user_id = $2 AND expires_at > CURRENT_TIMESTAMP
+	`)
+
+var logoutQuery = regexp.QuoteMeta(`DELETE FROM tokens WHERE user_id = $1 AND jti = $2 RETURNING id`)
+
+// sessionToken issues a token for userID as a login would
+func sessionToken(t *testing.T, userID int) string {
+	t.Helper()
+	t.Setenv("JWT_SECRET_KEY", "test-secret")
+	token, err := GenerateToken(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// serveAuthenticated sends a request with token through AuthMiddleware and
+// reports the response status and whether the protected handler ran
+func serveAuthenticated(t *testing.T, middleware func(http.Handler) http.Handler, token string) (int, bool) {
+	t.Helper()
+	reached := false
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+		if userID, _ := r.Context().Value("user_id").(int); userID != 7 {
+			t.Errorf("user_id in context = %v, want 7", r.Context().Value("user_id"))
+		}
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/api/me", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	middleware(next).ServeHTTP(w, r)
+	return w.Code, reached
+}
+
+func TestLogoutRevokesSession(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	token := sessionToken(t, 7)
+	jti := sessionKey(token)
+	middleware := AuthMiddleware(db)
+
+	// A recent touch keeps the middleware from recording the use in the background
+	lastSessionTouches.Store(3, time.Now())
+	t.Cleanup(func() { lastSessionTouches.Delete(3) })
+
+	mock.ExpectQuery(activeSessionQuery).WithArgs(jti, 7).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+	if status, reached := serveAuthenticated(t, middleware, token); !reached {
+		t.Fatalf("token of an active session rejected with %d", status)
+	}
+
+	mock.ExpectQuery(logoutQuery).WithArgs(7, jti).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+	r := httptest.NewRequest(http.MethodPost, "/api/auth/logout", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	LogoutHandler(db)(w, r)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("logout status = %d, want %d: %s", w.Code, http.StatusNoContent, w.Body)
+	}
+	if _, ok := lastSessionTouches.Load(3); ok {
+		t.Error("logout kept the session's last use")
+	}
+
+	// The token's signature is still valid, but its session row is gone
+	mock.ExpectQuery(activeSessionQuery).WithArgs(jti, 7).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	if status, reached := serveAuthenticated(t, middleware, token); reached || status != http.StatusUnauthorized {
+		t.Errorf("token of a signed-out session: status %d, reached %v; want 401", status, reached)
+	}
+
+	// Signing out the same session twice fails
+	mock.ExpectQuery(logoutQuery).WithArgs(7, jti).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	w = httptest.NewRecorder()
+	LogoutHandler(db)(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("second logout status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAuthMiddlewareSessions(t *testing.T) {
+	token := sessionToken(t, 7)
+	expired, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": 7,
+		"exp":     time.Now().Add(-time.Minute).Unix(),
+		"jti":     "expired",
+	}).SignedString([]byte("test-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lastSessionTouches.Store(3, time.Now())
+	t.Cleanup(func() { lastSessionTouches.Delete(3) })
+
+	tests := []struct {
+		name        string
+		token       string
+		session     *sqlmock.Rows // nil when the session must not be looked up
+		sessionErr  error
+		wantStatus  int
+		wantReached bool
+	}{
+		{"active session", token, sqlmock.NewRows([]string{"id"}).AddRow(3), nil, http.StatusOK, true},
+		{"revoked or expired session", token, sqlmock.NewRows([]string{"id"}), nil, http.StatusUnauthorized, false},
+		{"session lookup fails", token, nil, errors.New("connection refused"), http.StatusInternalServerError, false},
+		{"expired token", expired, nil, nil, http.StatusUnauthorized, false},
+		{"forged token", token + "x", nil, nil, http.StatusUnauthorized, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			if tt.session != nil {
+				mock.ExpectQuery(activeSessionQuery).WithArgs(sessionKey(tt.token), 7).WillReturnRows(tt.session)
+			} else if tt.sessionErr != nil {
+				mock.ExpectQuery(activeSessionQuery).WillReturnError(tt.sessionErr)
+			}
+
+			status, reached := serveAuthenticated(t, AuthMiddleware(db), tt.token)
+			if status != tt.wantStatus || reached != tt.wantReached {
+				t.Errorf("status %d, reached %v; want %d, %v", status, reached, tt.wantStatus, tt.wantReached)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestPurgeExpiredSessions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	for _, sessionID := range []int{4, 5, 6} {
+		lastSessionTouches.Store(sessionID, now)
+	}
+	t.Cleanup(func() {
+		for _, sessionID := range []int{4, 5, 6} {
+			lastSessionTouches.Delete(sessionID)
+		}
+	})
+
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM refresh_tokens WHERE expires_at <= CURRENT_TIMESTAMP`)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectQuery(regexp.QuoteMeta(`DELETE FROM tokens WHERE expires_at <= CURRENT_TIMESTAMP RETURNING id`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4).AddRow(5))
+
+	if err := purgeExpiredSessions(db); err != nil {
+		t.Fatal(err)
+	}
+	for sessionID, want := range map[int]bool{4: false, 5: false, 6: true} {
+		if _, ok := lastSessionTouches.Load(sessionID); ok != want {
+			t.Errorf("last use of session %d kept = %v, want %v", sessionID, ok, want)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+
+	// Sessions are left alone when their refresh tokens can't be purged
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM refresh_tokens`)).WillReturnError(errors.New("connection refused"))
+	if err := purgeExpiredSessions(db); err == nil {
+		t.Error("purgeExpiredSessions returned no error")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetSessionsMarksCurrent(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	token := sessionToken(t, 7)
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	expires := created.Add(30 * 24 * time.Hour)
+	mock.ExpectQuery(`FROM tokens\s+WHERE user_id = \$1 AND expires_at > CURRENT_TIMESTAMP`).
+		WithArgs(7, sessionKey(token)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_agent", "ip_address", "created_at", "last_used_at", "expires_at", "current"}).
+			AddRow(3, "Firefox", "203.0.113.7", created, created.Add(time.Hour), expires, true).
+			AddRow(2, "", "", created, nil, expires, false))
+
+	r := httptest.NewRequest(http.MethodGet, "/api/me/sessions", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	GetSessionsHandler(db)(w, r)
+
+	want := `[{"id":3,"user_agent":"Firefox","ip_address":"203.0.113.7","created_at":"2024-05-01T12:00:00Z","last_used_at":"2024-05-01T13:00:00Z","expires_at":"2024-05-31T12:00:00Z","current":true},` +
+		`{"id":2,"user_agent":"","ip_address":"","created_at":"2024-05-01T12:00:00Z","last_used_at":null,"expires_at":"2024-05-31T12:00:00Z","current":false}]`
+	if got := strings.TrimSpace(w.Body.String()); w.Code != http.StatusOK || got != want {
+		t.Errorf("status %d, body\n%s\nwant\n%s", w.Code, got, want)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDeleteSessionOnlyDeletesOwnSessions(t *testing.T) {
+	token := sessionToken(t, 7)
+	deleteQuery := regexp.QuoteMeta(`DELETE FROM tokens WHERE id = $1 AND user_id = $2`)
+
+	tests := []struct {
+		name    string
+		id      string
+		deleted int64 // rows the delete affects; -1 when it must not run
+		want    int
+	}{
+		{"own session", "3", 1, http.StatusNoContent},
+		{"another user's session", "4", 0, http.StatusNotFound},
+		{"invalid id", "abc", -1, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			if tt.deleted >= 0 {
+				sessionID, _ := strconv.Atoi(tt.id)
+				mock.ExpectExec(deleteQuery).WithArgs(sessionID, 7).WillReturnResult(sqlmock.NewResult(0, tt.deleted))
+			}
+
+			r := httptest.NewRequest(http.MethodDelete, "/api/me/sessions/"+tt.id, nil)
+			r = mux.SetURLVars(r, map[string]string{"id": tt.id})
+			r.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			DeleteSessionHandler(db)(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -3,10 +3,11 @@ package auth
 import (
 	"fmt"
 	"net/http"
-	"os"
 	"strings"
 	"time"
 
+	"matcherator/backend/services/tokens"
+
 	"github.com/golang-jwt/jwt/v5"
 )
 
@@ -25,27 +26,41 @@ import (
 //   "token_type": "JWT",
 //   "algorithm": "HS256",
 //   "expiration": "24h",
-//   "claims": ["user_id", "exp"],
-//   "secret_key": "environment_variable_required"
+//   "refresh": "single-use refresh tokens, REFRESH_TOKEN_TTL",
+//   "claims": ["user_id", "exp", "jti"],
+//   "headers": ["kid"],
+//   "secret_key": "environment_variable_required",
+//   "previous_keys": "JWT_PREVIOUS_KEYS, accepted for verification only"
 // }
 // [AI_SECURITY_END]
 
-// GenerateToken creates a JWT token for user authentication
-// Used by: SignupHandler, LoginHandler
+// AccessTokenTTL is how long a token works before it must be refreshed
+const AccessTokenTTL = 24 * time.Hour
+
+// GenerateToken creates a JWT token for user authentication. Its random jti
+// claim keys the token's session, so tokens issued to the same user in the
+// same second still differ.
+// Used by: SignupHandler, LoginHandler, RefreshHandler
 // Dependencies: jwt package
 func GenerateToken(userID int) (string, error) {
+	jti, err := tokens.NewSecret()
+	if err != nil {
+		return "", err
+	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"user_id": userID,
-		"exp":     time.Now().Add(time.Hour * 24).Unix(),
+		"exp":     time.Now().Add(AccessTokenTTL).Unix(),
+		"jti":     jti,
 	})
 
-	secretKey := os.Getenv("JWT_SECRET_KEY")
-	fmt.Printf("Debug: JWT_SECRET_KEY length: %d\n", len(secretKey))
-	if secretKey == "" {
-		return "", fmt.Errorf("JWT_SECRET_KEY environment variable not set")
+	keys, err := keyRing()
+	if err != nil {
+		return "", err
 	}
 
-	return token.SignedString([]byte(secretKey))
+	// Tokens are always signed with the current key
+	token.Header["kid"] = keys[0].ID
+	return token.SignedString(keys[0].Secret)
 }
 
 // GetUserIDFromToken extracts user ID from JWT token
@@ -59,16 +74,32 @@ func GetUserIDFromToken(r *http.Request) (int, error) {
 
 	tokenString = strings.TrimPrefix(tokenString, "Bearer ")
 
-	secretKey := os.Getenv("JWT_SECRET_KEY")
-	if secretKey == "" {
-		return 0, fmt.Errorf("JWT_SECRET_KEY environment variable not set")
+	keys, err := keyRing()
+	if err != nil {
+		return 0, err
 	}
 
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method")
 		}
-		return []byte(secretKey), nil
+
+		// Tokens issued before key rotation have no kid; try every key
+		kid, ok := token.Header["kid"].(string)
+		if !ok {
+			keySet := jwt.VerificationKeySet{}
+			for _, key := range keys {
+				keySet.Keys = append(keySet.Keys, key.Secret)
+			}
+			return keySet, nil
+		}
+
+		for _, key := range keys {
+			if key.ID == kid {
+				return key.Secret, nil
+			}
+		}
+		return nil, fmt.Errorf("unknown signing key %q", kid)
 	})
 
 	if err != nil {
@@ -82,3 +113,16 @@ func GetUserIDFromToken(r *http.Request) (int, error) {
 
 	return int(claims["user_id"].(float64)), nil
 }
+
+// sessionKey returns the key a token's session is stored under: its jti
+// claim, or the token itself for tokens issued before they carried one. The
+// token's signature must already have been checked.
+func sessionKey(token string) string {
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(token, claims); err == nil {
+		if jti, ok := claims["jti"].(string); ok && jti != "" {
+			return jti
+		}
+	}
+	return token
+}
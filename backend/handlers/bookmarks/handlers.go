@@ -0,0 +1,181 @@
+package bookmarks
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"matcherator/backend/handlers/auth"
+	"matcherator/backend/handlers/httputil"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// CreateBookmarkHandler shortlists an organization without connecting to it.
+// Bookmarking one already bookmarked returns the existing bookmark.
+// Used by: /api/me/bookmarks/{userId}
+// Response: 201 Created (200 when already bookmarked), Bookmark
+func CreateBookmarkHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		targetID, ok := targetVar(w, r)
+		if !ok {
+			return
+		}
+		if targetID == userID {
+			http.Error(w, "You can't bookmark yourself", http.StatusBadRequest)
+			return
+		}
+
+		var bookmarkable bool
+		if err := db.QueryRow(SelectBookmarkableQuery, targetID).Scan(&bookmarkable); err != nil {
+			log.Printf("Error checking bookmark target %d: %v", targetID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if !bookmarkable {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+
+		status := http.StatusCreated
+		var inserted int
+		err = db.QueryRow(InsertBookmarkQuery, userID, targetID).Scan(&inserted)
+		if err == sql.ErrNoRows {
+			status = http.StatusOK
+		} else if err != nil {
+			log.Printf("Error bookmarking user %d for user %d: %v", targetID, userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		bookmark, err := scanBookmark(db.QueryRow(SelectBookmarkQuery, userID, targetID))
+		if err != nil {
+			log.Printf("Error fetching bookmark of user %d for user %d: %v", targetID, userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(bookmark)
+	}
+}
+
+// GetBookmarksHandler lists the user's bookmarks, newest first
+// Used by: /api/me/bookmarks?limit=&offset=
+// Response: BookmarksResponse
+func GetBookmarksHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		limit, offset, ok := httputil.ParsePage(w, r, defaultPageSize, maxPageSize)
+		if !ok {
+			return
+		}
+
+		response := BookmarksResponse{Bookmarks: []Bookmark{}, Limit: limit, Offset: offset}
+		if err := db.QueryRow(CountBookmarksQuery, userID).Scan(&response.Total); err != nil {
+			log.Printf("Error counting bookmarks of user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		rows, err := db.Query(SelectBookmarksQuery, userID, limit, offset)
+		if err != nil {
+			log.Printf("Error querying bookmarks of user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			bookmark, err := scanBookmark(rows)
+			if err != nil {
+				log.Printf("Error scanning bookmark: %v", err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+			response.Bookmarks = append(response.Bookmarks, bookmark)
+		}
+		if err := rows.Err(); err != nil {
+			log.Printf("Error iterating bookmarks: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// DeleteBookmarkHandler removes an organization from the user's bookmarks
+// Used by: /api/me/bookmarks/{userId}
+// Response: 204 No Content
+func DeleteBookmarkHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		targetID, ok := targetVar(w, r)
+		if !ok {
+			return
+		}
+
+		result, err := db.Exec(DeleteBookmarkQuery, userID, targetID)
+		if err != nil {
+			log.Printf("Error removing bookmark of user %d for user %d: %v", targetID, userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			http.Error(w, "Bookmark not found", http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// targetVar reads the bookmarked user's ID from the route, writing the error
+// response when it is invalid
+func targetVar(w http.ResponseWriter, r *http.Request) (int, bool) {
+	targetID, err := strconv.Atoi(mux.Vars(r)["userId"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return targetID, true
+}
+
+// scanBookmark reads a row selected with bookmarkColumns
+func scanBookmark(row interface{ Scan(...interface{}) error }) (Bookmark, error) {
+	var b Bookmark
+	err := row.Scan(&b.UserID, &b.OrganizationName, &b.ProfilePictureURL, &b.Role,
+		pq.Array(&b.Sectors), &b.State, &b.City, &b.BookmarkedAt)
+	return b, err
+}
@@ -0,0 +1,24 @@
+package bookmarks
+
+import "time"
+
+// Bookmark is an organization the user shortlisted. Only the user sees it;
+// the organization is not told.
+type Bookmark struct {
+	UserID            int       `json:"user_id"`
+	OrganizationName  string    `json:"organization_name"`
+	ProfilePictureURL *string   `json:"profile_picture_url"`
+	Role              string    `json:"role"`
+	Sectors           []string  `json:"sectors"`
+	State             string    `json:"state"`
+	City              string    `json:"city"`
+	BookmarkedAt      time.Time `json:"bookmarked_at"`
+}
+
+// BookmarksResponse is one page of the user's bookmarks
+type BookmarksResponse struct {
+	Bookmarks []Bookmark `json:"bookmarks"`
+	Total     int        `json:"total"`
+	Limit     int        `json:"limit"`
+	Offset    int        `json:"offset"`
+}
@@ -0,0 +1,63 @@
+package bookmarks
+
+// bookmarkColumns are the columns read by scanBookmark, for bookmarks b of
+// users u
+const bookmarkColumns = `
+		SELECT
+			u.id,
+			COALESCE(p.organization_name, ''),
+			p.profile_picture_url,
+			u.role,
+			COALESCE(p.sectors, '{}'),
+			COALESCE(p.state, ''),
+			COALESCE(p.city, ''),
+			b.created_at
+		FROM bookmarks b
+		JOIN users u ON u.id = b.bookmarked_id
+		LEFT JOIN profiles p ON p.user_id = u.id
+`
+
+const (
+	// SelectBookmarksQuery pages through the user's bookmarks of accounts
+	// that still exist, newest first
+	SelectBookmarksQuery = bookmarkColumns + `
+		WHERE b.user_id = $1 AND u.deleted_at IS NULL
+		ORDER BY b.created_at DESC, u.id
+		LIMIT $2 OFFSET $3
+	`
+
+	// CountBookmarksQuery counts the bookmarks SelectBookmarksQuery pages through
+	CountBookmarksQuery = `
+		SELECT COUNT(*)
+		FROM bookmarks b
+		JOIN users u ON u.id = b.bookmarked_id
+		WHERE b.user_id = $1 AND u.deleted_at IS NULL
+	`
+
+	// SelectBookmarkQuery fetches one of the user's bookmarks
+	SelectBookmarkQuery = bookmarkColumns + `
+		WHERE b.user_id = $1 AND b.bookmarked_id = $2
+	`
+
+	// SelectBookmarkableQuery reports whether a user can be bookmarked: an
+	// active account other than the user's own
+	SelectBookmarkableQuery = `
+		SELECT EXISTS (
+			SELECT 1 FROM users
+			WHERE id = $1 AND status = 'active' AND deactivated_at IS NULL AND deleted_at IS NULL
+		)
+	`
+
+	// InsertBookmarkQuery bookmarks a user, returning nothing when they already were
+	InsertBookmarkQuery = `
+		INSERT INTO bookmarks (user_id, bookmarked_id)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id, bookmarked_id) DO NOTHING
+		RETURNING bookmarked_id
+	`
+
+	// DeleteBookmarkQuery removes a bookmark
+	DeleteBookmarkQuery = `
+		DELETE FROM bookmarks WHERE user_id = $1 AND bookmarked_id = $2
+	`
+)
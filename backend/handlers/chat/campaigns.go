@@ -0,0 +1,314 @@
+package chat
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+
+	"matcherator/backend/handlers/auth"
+	"matcherator/backend/handlers/httputil"
+	"matcherator/backend/handlers/notifications"
+	"matcherator/backend/handlers/plans"
+	"matcherator/backend/services/campaigns"
+	"matcherator/backend/services/entitlements"
+	"matcherator/backend/services/moderation"
+	"matcherator/backend/services/track"
+)
+
+// Notification types of campaigns
+const (
+	NotificationCampaignMessage = "campaign_message"
+	NotificationCampaignSent    = "campaign_sent"
+)
+
+const (
+	maxCampaignLen        = 2000
+	maxCampaignFilterSize = 50
+)
+
+// CampaignRequest is an announcement to the provider's connections, all of
+// them or those matching the filter
+type CampaignRequest struct {
+	Content string           `json:"content"`
+	Filter  campaigns.Filter `json:"filter"`
+}
+
+// CampaignDetail is a campaign with its per-recipient delivery status
+type CampaignDetail struct {
+	campaigns.Campaign
+	Deliveries []campaigns.Delivery `json:"deliveries"`
+}
+
+// CampaignHooks pushes campaign messages to open chats and notifies both sides
+func CampaignHooks(db *sql.DB) campaigns.Hooks {
+	return campaigns.Hooks{
+		Delivered: func(message campaigns.Message) {
+			chatMessage := ChatMessage{
+				ID:        message.MessageID,
+				MatchID:   message.ConnectionID,
+				SenderID:  message.ProviderID,
+				Content:   message.Content,
+				Timestamp: message.SentAt,
+			}
+			broadcastMessage(message.ConnectionID, websocket.TextMessage, chatMessage)
+			deliverToDevices(db, chatMessage)
+			track.Event(db, message.ProviderID, track.FirstMessage, nil)
+
+			var name string
+			if err := db.QueryRow("SELECT COALESCE(organization_name, '') FROM profiles WHERE user_id = $1", message.ProviderID).Scan(&name); err != nil || name == "" {
+				name = "A funder you are connected with"
+			}
+			notifyCampaign(db, message.RecipientID, NotificationCampaignMessage, fmt.Sprintf("%s sent you a message.", name))
+		},
+		Finished: func(campaign *campaigns.Campaign) {
+			notifyCampaign(db, campaign.ProviderID, NotificationCampaignSent, fmt.Sprintf(
+				"Your announcement was delivered to %d of %d connections.", campaign.Delivered, campaign.Recipients,
+			))
+		},
+	}
+}
+
+// PreviewCampaignHandler counts the connections a campaign would reach
+// Used by: /api/me/campaigns/preview
+// Response: {"recipients": n}
+func PreviewCampaignHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, ok := campaignProvider(w, r, db)
+		if !ok {
+			return
+		}
+
+		var filter campaigns.Filter
+		if !httputil.DecodeJSON(w, r, &filter) {
+			return
+		}
+		if message := validateCampaignFilter(&filter); message != "" {
+			http.Error(w, message, http.StatusBadRequest)
+			return
+		}
+
+		count, err := campaigns.CountRecipients(db, userID, filter)
+		if err != nil {
+			log.Printf("Error counting campaign recipients of user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]int{"recipients": count})
+	}
+}
+
+// CreateCampaignHandler queues an announcement to the provider's connections.
+// Each recipient gets it as a chat message from the provider.
+// Used by: /api/me/campaigns
+// Response: 202 Accepted, campaigns.Campaign
+func CreateCampaignHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, ok := campaignProvider(w, r, db)
+		if !ok {
+			return
+		}
+
+		var req CampaignRequest
+		if !httputil.DecodeJSON(w, r, &req) {
+			return
+		}
+		req.Content = strings.TrimSpace(req.Content)
+		if req.Content == "" || utf8.RuneCountInString(req.Content) > maxCampaignLen {
+			http.Error(w, fmt.Sprintf("Content is required and at most %d characters", maxCampaignLen), http.StatusBadRequest)
+			return
+		}
+		if message := validateCampaignFilter(&req.Filter); message != "" {
+			http.Error(w, message, http.StatusBadRequest)
+			return
+		}
+		if blocked := moderation.Review(moderation.Field{Name: "message", Text: req.Content}).Blocked(); blocked != nil {
+			http.Error(w, blocked.Message(), http.StatusBadRequest)
+			return
+		}
+
+		campaign, err := campaigns.Create(db, userID, req.Content, req.Filter, func() error {
+			return entitlements.Consume(db, userID, entitlements.QuotaMonthlyCampaigns)
+		})
+		switch err {
+		case nil:
+		case entitlements.ErrQuotaExceeded:
+			plans.QuotaExceeded(w, "You have used this month's announcements")
+			return
+		case campaigns.ErrNoRecipients:
+			http.Error(w, "None of your connections match. Only connections with chat turned on can be messaged", http.StatusBadRequest)
+			return
+		case campaigns.ErrTooManyRecipients:
+			http.Error(w, fmt.Sprintf("An announcement can reach at most %d connections. Narrow the filter", campaigns.MaxRecipients), http.StatusBadRequest)
+			return
+		case campaigns.ErrInProgress:
+			http.Error(w, "Your previous announcement is still being sent", http.StatusConflict)
+			return
+		case campaigns.ErrTooSoon:
+			http.Error(w, "You can send one announcement a day. Please try again later", http.StatusTooManyRequests)
+			return
+		default:
+			log.Printf("Error creating campaign for user %d: %v", userID, err)
+			http.Error(w, "Error creating announcement", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(campaign)
+	}
+}
+
+// GetCampaignsHandler lists the provider's campaigns, newest first
+// Used by: /api/me/campaigns
+// Response: []campaigns.Campaign
+func GetCampaignsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, ok := campaignProvider(w, r, db)
+		if !ok {
+			return
+		}
+
+		list, err := campaigns.List(db, userID)
+		if err != nil {
+			log.Printf("Error listing campaigns of user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(list)
+	}
+}
+
+// GetCampaignHandler returns a campaign with the delivery status per recipient
+// Used by: /api/me/campaigns/{id}
+// Response: CampaignDetail
+func GetCampaignHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, ok := campaignProvider(w, r, db)
+		if !ok {
+			return
+		}
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid campaign ID", http.StatusBadRequest)
+			return
+		}
+
+		campaign, err := campaigns.Get(db, userID, id)
+		if err == campaigns.ErrNotFound {
+			http.Error(w, "Announcement not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error loading campaign %d: %v", id, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		deliveries, err := campaigns.Deliveries(db, id)
+		if err != nil {
+			log.Printf("Error loading deliveries of campaign %d: %v", id, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(CampaignDetail{Campaign: *campaign, Deliveries: deliveries})
+	}
+}
+
+// CancelCampaignHandler stops a campaign that is still being sent. Messages
+// already delivered stay in the chats.
+// Used by: /api/me/campaigns/{id}/cancel
+// Response: campaigns.Campaign
+func CancelCampaignHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, ok := campaignProvider(w, r, db)
+		if !ok {
+			return
+		}
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid campaign ID", http.StatusBadRequest)
+			return
+		}
+
+		campaign, err := campaigns.Cancel(db, userID, id)
+		if err == campaigns.ErrNotFound {
+			http.Error(w, "Announcement not found", http.StatusNotFound)
+			return
+		} else if err == campaigns.ErrFinished {
+			http.Error(w, "Announcement was already sent or canceled", http.StatusConflict)
+			return
+		} else if err != nil {
+			log.Printf("Error canceling campaign %d: %v", id, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(campaign)
+	}
+}
+
+// campaignProvider returns the user when they are a provider, writing the
+// error response when not
+func campaignProvider(w http.ResponseWriter, r *http.Request, db *sql.DB) (int, bool) {
+	userID, err := auth.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return 0, false
+	}
+
+	var role string
+	var dualRole bool
+	if err := db.QueryRow("SELECT role, dual_role FROM users WHERE id = $1", userID).Scan(&role, &dualRole); err != nil {
+		log.Printf("Error getting role of user %d: %v", userID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return 0, false
+	}
+	if role != "provider" && !dualRole {
+		http.Error(w, "Only providers can send announcements", http.StatusForbidden)
+		return 0, false
+	}
+	return userID, true
+}
+
+// validateCampaignFilter returns why a filter is invalid, or ""
+func validateCampaignFilter(filter *campaigns.Filter) string {
+	if len(filter.Sectors) > maxCampaignFilterSize || len(filter.States) > maxCampaignFilterSize {
+		return fmt.Sprintf("Filter by at most %d sectors and states", maxCampaignFilterSize)
+	}
+	if len(filter.ConnectionIDs) > campaigns.MaxRecipients {
+		return fmt.Sprintf("Pick at most %d connections", campaigns.MaxRecipients)
+	}
+	for i := range filter.States {
+		filter.States[i] = strings.ToUpper(strings.TrimSpace(filter.States[i]))
+	}
+	return ""
+}
+
+// notifyCampaign records an in-app notification and pushes it to the user
+func notifyCampaign(db *sql.DB, userID int, notificationType, content string) {
+	if _, err := db.Exec("INSERT INTO notifications (user_id, type, content) VALUES ($1, $2, $3)", userID, notificationType, content); err != nil {
+		// Don't return error here as the message was still delivered successfully
+		log.Printf("Error creating %s notification for user %d: %v", notificationType, userID, err)
+		return
+	}
+	notifications.SendNotification(userID, notificationType)
+}
@@ -0,0 +1,108 @@
+package chat
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+	"time"
+
+	"matcherator/backend/handlers/notifications"
+)
+
+// Event types pushed to the participants' notification sockets, which every
+// device of a signed-in user keeps open
+const (
+	EventChatMessage = "chat_message"
+	EventChatPreview = "chat_preview"
+	EventChatUnread  = "chat_unread"
+)
+
+// snippetLen is how much of a message a chat list preview shows
+const snippetLen = 120
+
+// MessageEvent carries a new message to every device of both participants,
+// whether or not they have the conversation open
+type MessageEvent struct {
+	Message ChatMessage `json:"message"`
+}
+
+// PreviewEvent updates a conversation's entry in the chat list: who wrote
+// last, when, and the start of what they wrote
+type PreviewEvent struct {
+	MatchID    int       `json:"match_id"`
+	SenderID   int       `json:"sender_id"`
+	SenderName string    `json:"sender_name"`
+	Snippet    string    `json:"snippet"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// UnreadEvent tells every device of a user how many messages they have not
+// read, in one conversation and in all of them, so the counts agree across
+// devices
+type UnreadEvent struct {
+	MatchID     int `json:"match_id"`
+	Unread      int `json:"unread"`
+	TotalUnread int `json:"total_unread"`
+}
+
+// deliverToDevices pushes a stored message and the chat list preview to the
+// devices of both participants, and the reader's new unread counts, so a
+// client needs no socket per conversation to stay current
+func deliverToDevices(db *sql.DB, message ChatMessage) {
+	var initiatorID, targetID int
+	err := db.QueryRow("SELECT initiator_id, target_id FROM connections WHERE id = $1", message.MatchID).Scan(&initiatorID, &targetID)
+	if err != nil {
+		log.Printf("Error loading participants of chat %d: %v", message.MatchID, err)
+		return
+	}
+
+	if message.SenderName == "" {
+		message.SenderName = senderName(db, message.SenderID)
+	}
+	preview := PreviewEvent{
+		MatchID:    message.MatchID,
+		SenderID:   message.SenderID,
+		SenderName: message.SenderName,
+		Snippet:    snippet(message.Content),
+		Timestamp:  message.Timestamp,
+	}
+
+	for _, userID := range []int{initiatorID, targetID} {
+		notifications.SendToUser(userID, EventChatMessage, MessageEvent{Message: message})
+		notifications.SendToUser(userID, EventChatPreview, preview)
+		if userID != message.SenderID {
+			pushUnread(db, message.MatchID, userID)
+		}
+	}
+}
+
+// pushUnread sends the user's current unread counts to all of their devices
+func pushUnread(db *sql.DB, matchID, userID int) {
+	event := UnreadEvent{MatchID: matchID}
+	err := db.QueryRow(`
+		SELECT
+			COUNT(*) FILTER (WHERE cm.match_id = $1),
+			COUNT(*)
+		FROM chat_messages cm
+		JOIN connections c ON c.id = cm.match_id
+		WHERE (c.initiator_id = $2 OR c.target_id = $2)
+		AND cm.sender_id != $2
+		AND cm.read = false
+	`, matchID, userID).Scan(&event.Unread, &event.TotalUnread)
+	if err != nil {
+		log.Printf("Error counting unread messages of user %d: %v", userID, err)
+		return
+	}
+
+	notifications.SendToUser(userID, EventChatUnread, event)
+}
+
+// snippet shortens a message to its first snippetLen characters on one line
+func snippet(content string) string {
+	content = strings.Join(strings.Fields(content), " ")
+	runes := []rune(content)
+	if len(runes) <= snippetLen {
+		return content
+	}
+	return strings.TrimSpace(string(runes[:snippetLen])) + "…"
+}
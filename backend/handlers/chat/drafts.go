@@ -0,0 +1,104 @@
+package chat
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"matcherator/backend/handlers/httputil"
+)
+
+// maxDraftLen bounds a saved draft, well above any reply typed by hand
+const maxDraftLen = 10000
+
+// Draft is the user's unsent reply in a conversation
+type Draft struct {
+	Content   string     `json:"content"`
+	UpdatedAt *time.Time `json:"updated_at"` // nil when there is no draft
+}
+
+// GetDraftHandler returns the user's draft in a conversation
+// Used by: /api/chat/{id}/draft
+// Response: Draft
+func GetDraftHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, matchID, ok := chatParticipant(w, r, db)
+		if !ok {
+			return
+		}
+
+		var draft Draft
+		err := db.QueryRow(`
+			SELECT content, updated_at FROM chat_drafts WHERE match_id = $1 AND user_id = $2
+		`, matchID, userID).Scan(&draft.Content, &draft.UpdatedAt)
+		if err != nil && err != sql.ErrNoRows {
+			log.Printf("Error loading draft of user %d in chat %d: %v", userID, matchID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(draft)
+	}
+}
+
+// SaveDraftHandler saves the user's draft in a conversation, replacing the
+// previous one. Saving blank content removes the draft.
+// Used by: /api/chat/{id}/draft
+// Response: Draft
+func SaveDraftHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, matchID, ok := chatParticipant(w, r, db)
+		if !ok {
+			return
+		}
+
+		var draft Draft
+		if !httputil.DecodeJSON(w, r, &draft) {
+			return
+		}
+		if utf8.RuneCountInString(draft.Content) > maxDraftLen {
+			http.Error(w, fmt.Sprintf("Draft must be at most %d characters", maxDraftLen), http.StatusBadRequest)
+			return
+		}
+
+		if strings.TrimSpace(draft.Content) == "" {
+			if err := clearDraft(db, matchID, userID); err != nil {
+				log.Printf("Error clearing draft of user %d in chat %d: %v", userID, matchID, err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+			json.NewEncoder(w).Encode(Draft{})
+			return
+		}
+
+		err := db.QueryRow(`
+			INSERT INTO chat_drafts (match_id, user_id, content)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (match_id, user_id) DO UPDATE SET content = EXCLUDED.content, updated_at = CURRENT_TIMESTAMP
+			RETURNING updated_at
+		`, matchID, userID, draft.Content).Scan(&draft.UpdatedAt)
+		if err != nil {
+			log.Printf("Error saving draft of user %d in chat %d: %v", userID, matchID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(draft)
+	}
+}
+
+// clearDraft removes the user's draft in a conversation, once it is sent or
+// emptied
+func clearDraft(db *sql.DB, matchID, userID int) error {
+	_, err := db.Exec("DELETE FROM chat_drafts WHERE match_id = $1 AND user_id = $2", matchID, userID)
+	return err
+}
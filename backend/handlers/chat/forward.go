@@ -0,0 +1,151 @@
+package chat
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+
+	"matcherator/backend/handlers/auth"
+	"matcherator/backend/handlers/httputil"
+	"matcherator/backend/services/accounts"
+	"matcherator/backend/services/chat"
+	"matcherator/backend/services/track"
+)
+
+// ForwardedFrom is the provenance of a forwarded message: who first wrote it
+// and when. The conversation it came from is not shown to the new reader.
+type ForwardedFrom struct {
+	MessageID  *int      `json:"message_id"` // nil once the original is deleted
+	SenderID   *int      `json:"sender_id"`
+	SenderName string    `json:"sender_name"`
+	SentAt     time.Time `json:"sent_at"`
+}
+
+// ForwardRequest names the conversation a message is forwarded to
+type ForwardRequest struct {
+	MatchID int `json:"match_id"`
+}
+
+// ForwardMessageHandler copies a message into another conversation of the
+// user, keeping who first wrote it. The user must take part in both
+// conversations and chat must be available in both.
+// Used by: /api/chat/{id}/messages/{message_id}/forward
+// Response: 201 Created, ChatMessage
+func ForwardMessageHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		vars := mux.Vars(r)
+		fromID, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			http.Error(w, "Invalid match ID", http.StatusBadRequest)
+			return
+		}
+		messageID, err := strconv.Atoi(vars["message_id"])
+		if err != nil {
+			http.Error(w, "Invalid message ID", http.StatusBadRequest)
+			return
+		}
+
+		var req ForwardRequest
+		if !httputil.DecodeJSON(w, r, &req) {
+			return
+		}
+		if req.MatchID == fromID {
+			http.Error(w, "Pick another conversation to forward to", http.StatusBadRequest)
+			return
+		}
+
+		for _, matchID := range []int{fromID, req.MatchID} {
+			ok, err := chat.CanChat(db, matchID, userID)
+			if err != nil {
+				log.Printf("Error checking chat %d of user %d: %v", matchID, userID, err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+			if !ok {
+				http.Error(w, "Unauthorized or chat not available", http.StatusUnauthorized)
+				return
+			}
+		}
+
+		// A forwarded message keeps its first author, so forwarding a forward
+		// credits the original rather than the user in between
+		var original ForwardedFrom
+		var content string
+		err = db.QueryRow(`
+			SELECT
+				cm.content,
+				CASE WHEN cm.forwarded_sent_at IS NULL THEN cm.id ELSE cm.forwarded_from END,
+				CASE WHEN cm.forwarded_sent_at IS NULL THEN cm.sender_id ELSE cm.forwarded_sender_id END,
+				COALESCE(cm.forwarded_sent_at, cm.timestamp)
+			FROM chat_messages cm
+			WHERE cm.id = $1 AND cm.match_id = $2
+		`, messageID, fromID).Scan(&content, &original.MessageID, &original.SenderID, &original.SentAt)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Message not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error loading message %d: %v", messageID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		message := ChatMessage{
+			MatchID:   req.MatchID,
+			SenderID:  userID,
+			Content:   content,
+			Timestamp: time.Now(),
+		}
+		err = db.QueryRow(`
+			INSERT INTO chat_messages (match_id, sender_id, content, timestamp, forwarded_from, forwarded_sender_id, forwarded_sent_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			RETURNING id
+		`, message.MatchID, userID, content, message.Timestamp, original.MessageID, original.SenderID, original.SentAt).Scan(&message.ID)
+		if err != nil {
+			log.Printf("Error forwarding message %d to chat %d: %v", messageID, req.MatchID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		original.SenderName = accounts.DeletedName
+		if original.SenderID != nil {
+			original.SenderName = senderName(db, *original.SenderID)
+		}
+		message.ForwardedFrom = &original
+
+		track.Event(db, userID, track.FirstMessage, nil)
+		broadcastMessage(message.MatchID, websocket.TextMessage, message)
+		deliverToDevices(db, message)
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(message)
+	}
+}
+
+// senderName is the organization name shown for a message's author
+func senderName(db *sql.DB, userID int) string {
+	var name string
+	err := db.QueryRow(`
+		SELECT CASE WHEN u.deleted_at IS NULL THEN COALESCE(p.organization_name, '') ELSE $2 END
+		FROM users u
+		LEFT JOIN profiles p ON p.user_id = u.id
+		WHERE u.id = $1
+	`, userID, accounts.DeletedName).Scan(&name)
+	if err != nil {
+		return accounts.DeletedName
+	}
+	return name
+}
@@ -7,11 +7,15 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"matcherator/backend/handlers/auth"
+	"matcherator/backend/handlers/httputil"
 	"matcherator/backend/handlers/status"
+	"matcherator/backend/handlers/wsproto"
+	"matcherator/backend/services/accounts"
+	"matcherator/backend/services/chat"
+	"matcherator/backend/services/translate"
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
@@ -24,6 +28,33 @@ type ChatMessage struct {
 	Content   string    `json:"content"`
 	Timestamp time.Time `json:"timestamp"`
 	Read      bool      `json:"read"`
+
+	// The sender's organization name when loaded from history; "Deleted
+	// organization" once the sender's account is deleted
+	SenderName string `json:"sender_name,omitempty"`
+
+	// Set when the sender's language differs from the reader's and a translation is available
+	TranslatedContent *string `json:"translated_content,omitempty"`
+
+	// Set when the message was forwarded from another conversation
+	ForwardedFrom *ForwardedFrom `json:"forwarded_from,omitempty"`
+}
+
+// SentMessage is a message a client sends over the WebSocket. ClientID is the
+// client's own reference, echoed in the ack.
+type SentMessage struct {
+	ClientID string `json:"client_id,omitempty"`
+	Content  string `json:"content"`
+}
+
+// MessageAck confirms a sent message to the connection that sent it, with
+// the ID and time the server stored it under
+type MessageAck struct {
+	Ack       bool      `json:"ack"`
+	ClientID  string    `json:"client_id,omitempty"`
+	ID        int       `json:"id"`
+	MatchID   int       `json:"match_id"`
+	Timestamp time.Time `json:"timestamp"`
 }
 
 type TypingMessage struct {
@@ -42,8 +73,6 @@ var (
 		WriteBufferSize: 1024,
 		CheckOrigin:     func(r *http.Request) bool { return true },
 	}
-	connections = make(map[int]map[*websocket.Conn]bool) // map[matchID]map[conn]bool
-	connLock    sync.Mutex
 )
 
 // UpdateChatPreferencesHandler allows users to opt in/out of chat
@@ -58,8 +87,7 @@ func UpdateChatPreferencesHandler(db *sql.DB) http.HandlerFunc {
 		}
 
 		var prefs ChatPreferences
-		if err := json.NewDecoder(r.Body).Decode(&prefs); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+		if !httputil.DecodeJSON(w, r, &prefs) {
 			return
 		}
 
@@ -102,8 +130,8 @@ func GetChatPreferencesHandler(db *sql.DB) http.HandlerFunc {
 
 		var prefs ChatPreferences
 		err = db.QueryRow(`
-			SELECT chat_opt_in 
-			FROM profiles 
+			SELECT COALESCE(chat_opt_in, false)
+			FROM profiles
 			WHERE user_id = $1
 		`, userID).Scan(&prefs.OptIn)
 
@@ -124,7 +152,6 @@ func HandleWebSocket(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("WebSocket connection attempt received")
 		log.Printf("Request URL: %s", r.URL.String())
-		log.Printf("Request Headers: %v", r.Header)
 		log.Printf("Request Method: %s", r.Method)
 		log.Printf("Request Protocol: %s", r.Proto)
 		log.Printf("Request Host: %s", r.Host)
@@ -136,11 +163,8 @@ func HandleWebSocket(db *sql.DB) http.HandlerFunc {
 			http.Error(w, "No token provided", http.StatusUnauthorized)
 			return
 		}
-		log.Printf("Token received: %s", token)
 
-		userID, err := auth.GetUserIDFromToken(&http.Request{
-			Header: http.Header{"Authorization": []string{"Bearer " + token}},
-		})
+		userID, err := auth.ValidateToken(db, token)
 		if err != nil {
 			log.Printf("Invalid token in WebSocket connection: %v", err)
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
@@ -156,43 +180,25 @@ func HandleWebSocket(db *sql.DB) http.HandlerFunc {
 		}
 		log.Printf("Match ID: %d", matchID)
 
-		// Verify user is part of this connection and both users are active and opted in
-		var count int
-		err = db.QueryRow(`
-			SELECT COUNT(*) 
-			FROM connections c
-			JOIN users u1 ON c.initiator_id = u1.id
-			JOIN users u2 ON c.target_id = u2.id
-			JOIN profiles p1 ON u1.id = p1.user_id
-			JOIN profiles p2 ON u2.id = p2.user_id
-			WHERE c.id = $1 
-			AND (c.initiator_id = $2 OR c.target_id = $2)
-			AND p1.chat_opt_in = true 
-			AND p2.chat_opt_in = true
-			AND u1.role = 'provider' 
-			AND u2.role = 'recipient'
-			AND (
-				(u1.id = c.initiator_id AND u1.status = 'active') OR
-				(u2.id = c.initiator_id AND u2.status = 'active')
-			)
-			AND (
-				(u1.id = c.target_id AND u1.status = 'active') OR
-				(u2.id = c.target_id AND u2.status = 'active')
-			)
-		`, matchID, userID).Scan(&count)
-
+		ok, err := chat.CanChat(db, matchID, userID)
 		if err != nil {
 			log.Printf("Database error checking connection: %v", err)
 			http.Error(w, "Database error", http.StatusInternalServerError)
 			return
 		}
-		if count == 0 {
+		if !ok {
 			log.Printf("No valid connection found for match ID %d and user ID %d", matchID, userID)
 			http.Error(w, "Unauthorized or chat not available", http.StatusUnauthorized)
 			return
 		}
 		log.Printf("Connection verified for match ID %d and user ID %d", matchID, userID)
 
+		version, err := wsproto.ClientVersion(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
 		conn, err := upgrader.Upgrade(w, r, nil)
 		if err != nil {
 			log.Printf("Error upgrading connection: %v", err)
@@ -201,110 +207,83 @@ func HandleWebSocket(db *sql.DB) http.HandlerFunc {
 		defer conn.Close()
 
 		log.Printf("WebSocket connection established successfully")
+		auth.TouchActivity(db, userID)
 
 		// Store connection
-		connLock.Lock()
-		if connections[matchID] == nil {
-			connections[matchID] = make(map[*websocket.Conn]bool)
-		}
-		connections[matchID][conn] = true
-		connLock.Unlock()
+		chatHub.join(matchID, userID, version, conn)
+
+		// Cleanup on disconnect, or when a message handler panics
+		defer func() {
+			chatHub.leave(matchID, conn)
+			conn.Close()
+		}()
 
 		// Listen for messages
+		session := &chatSession{db: db, ctx: r.Context(), conn: conn, matchID: matchID, userID: userID}
 		for {
 			messageType, p, err := conn.ReadMessage()
 			if err != nil {
 				break
 			}
-
-			if strings.Contains(string(p), `"typing"`) {
-				var typingMessage TypingMessage
-				if err := json.Unmarshal(p, &typingMessage); err != nil {
-					continue
-				}
-				typingMessage.UserID = userID
-				broadcastTyping(matchID, messageType, typingMessage)
-				continue
-			}
-
-			var message ChatMessage
-			if err := json.Unmarshal(p, &message); err != nil {
-				continue
-			}
-
-			message.MatchID = matchID
-			message.SenderID = userID
-			message.Timestamp = time.Now()
-
-			_, err = db.Exec(`
-				INSERT INTO chat_messages (id, match_id, sender_id, content, timestamp) 
-				VALUES ($1, $2, $3, $4, $5)
-			`, message.ID, message.MatchID, message.SenderID, message.Content, message.Timestamp)
-			if err != nil {
-				continue
-			}
-
-			// Broadcast message
-			broadcastMessage(matchID, messageType, message)
+			auth.TouchActivity(db, userID)
+			session.handle(messageType, p)
 		}
-
-		// Cleanup on disconnect
-		connLock.Lock()
-		delete(connections[matchID], conn)
-		if len(connections[matchID]) == 0 {
-			delete(connections, matchID)
-		}
-		connLock.Unlock()
 	}
 }
 
 func broadcastMessage(matchID, messageType int, message ChatMessage) {
-	connLock.Lock()
-	defer connLock.Unlock()
-
-	msgData, err := json.Marshal(message)
-	if err != nil {
-		return
-	}
+	chatHub.broadcast(matchID, messageType, wsproto.TypeMessage, message)
+}
 
-	for conn := range connections[matchID] {
-		if err := conn.WriteMessage(messageType, msgData); err != nil {
-			conn.Close()
-			delete(connections[matchID], conn)
-		}
-	}
+// ChatPreview is a chat in the chat list, seen from one of its participants
+type ChatPreview struct {
+	ID               int        `json:"id"`
+	InitiatorID      int        `json:"initiator_id"`
+	TargetID         int        `json:"target_id"`
+	LastMessage      string     `json:"last_message,omitempty"`
+	LastMessageAt    *time.Time `json:"last_message_at,omitempty"`
+	OtherUserName    string     `json:"other_user_name"`
+	OtherUserPicture string     `json:"other_user_picture"`
+	OtherUserAlt     string     `json:"other_user_picture_alt"`
 }
 
-func broadcastTyping(matchID, messageType int, typingMessage TypingMessage) {
-	connLock.Lock()
-	defer connLock.Unlock()
+// chatRow is a chat as listed by GetChatsHandler, before it becomes a
+// ChatPreview; pictures are NULL until uploaded and the last message is NULL
+// until the first one is sent
+type chatRow struct {
+	ID               int
+	InitiatorID      int
+	TargetID         int
+	InitiatorName    sql.NullString
+	TargetName       sql.NullString
+	InitiatorPicture sql.NullString
+	TargetPicture    sql.NullString
+	InitiatorAlt     sql.NullString
+	TargetAlt        sql.NullString
+	LastMessageTime  sql.NullTime
+	LastMessage      sql.NullString
+}
 
-	msgData, err := json.Marshal(typingMessage)
-	if err != nil {
-		return
+// preview maps the row to the ChatPreview userID sees, naming the other
+// participant
+func (row chatRow) preview(userID int) ChatPreview {
+	chat := ChatPreview{
+		ID:            row.ID,
+		InitiatorID:   row.InitiatorID,
+		TargetID:      row.TargetID,
+		LastMessage:   row.LastMessage.String,
+		LastMessageAt: httputil.TimePtr(row.LastMessageTime),
 	}
-
-	for conn := range connections[matchID] {
-		if err := conn.WriteMessage(messageType, msgData); err != nil {
-			conn.Close()
-			delete(connections[matchID], conn)
-		}
+	if row.InitiatorID == userID {
+		chat.OtherUserName = row.TargetName.String
+		chat.OtherUserPicture = row.TargetPicture.String
+		chat.OtherUserAlt = row.TargetAlt.String
+	} else {
+		chat.OtherUserName = row.InitiatorName.String
+		chat.OtherUserPicture = row.InitiatorPicture.String
+		chat.OtherUserAlt = row.InitiatorAlt.String
 	}
-}
-
-type ChatPreview struct {
-	ID               int            `json:"id"`
-	InitiatorID      int            `json:"initiator_id"`
-	TargetID         int            `json:"target_id"`
-	InitiatorName    sql.NullString `json:"-"`
-	TargetName       sql.NullString `json:"-"`
-	InitiatorPicture sql.NullString `json:"-"`
-	TargetPicture    sql.NullString `json:"-"`
-	LastMessageTime  sql.NullTime   `json:"-"`
-	LastMessage      string         `json:"last_message,omitempty"`
-	LastMessageAt    *time.Time     `json:"last_message_at,omitempty"`
-	OtherUserName    string         `json:"other_user_name"`
-	OtherUserPicture string         `json:"other_user_picture"`
+	return chat
 }
 
 func GetChatsHandler(db *sql.DB) http.HandlerFunc {
@@ -318,7 +297,7 @@ func GetChatsHandler(db *sql.DB) http.HandlerFunc {
 		// Check if user is active and opted in
 		var chatOptIn bool
 		err = db.QueryRow(`
-			SELECT p.chat_opt_in 
+			SELECT COALESCE(p.chat_opt_in, false)
 			FROM profiles p
 			JOIN users u ON p.user_id = u.id
 			WHERE p.user_id = $1 AND u.status = 'active'
@@ -350,92 +329,58 @@ func GetChatsHandler(db *sql.DB) http.HandlerFunc {
 				c.id,
 				c.initiator_id,
 				c.target_id,
-				COALESCE(p1.organization_name, '') as initiator_name,
-				COALESCE(p2.organization_name, '') as target_name,
-				COALESCE(p1.profile_picture_url, '') as initiator_picture,
-				COALESCE(p2.profile_picture_url, '') as target_picture,
-				COALESCE(lm.last_message_time, CURRENT_TIMESTAMP) as last_message_time,
-				COALESCE(lm.last_message, '') as last_message
+				CASE WHEN u1.deleted_at IS NULL THEN COALESCE(p1.organization_name, '') ELSE $2 END as initiator_name,
+				CASE WHEN u2.deleted_at IS NULL THEN COALESCE(p2.organization_name, '') ELSE $2 END as target_name,
+				p1.profile_picture_url as initiator_picture,
+				p2.profile_picture_url as target_picture,
+				p1.profile_picture_alt as initiator_picture_alt,
+				p2.profile_picture_alt as target_picture_alt,
+				lm.last_message_time as last_message_time,
+				lm.last_message as last_message
 			FROM connections c
+			JOIN users u1 ON c.initiator_id = u1.id
+			JOIN users u2 ON c.target_id = u2.id
 			JOIN profiles p1 ON c.initiator_id = p1.user_id
 			JOIN profiles p2 ON c.target_id = p2.user_id
 			LEFT JOIN LastMessage lm ON c.id = lm.match_id AND lm.rn = 1
 			WHERE (c.initiator_id = $1 OR c.target_id = $1)
-			ORDER BY last_message_time DESC NULLS LAST
-		`, userID)
+			ORDER BY last_message_time DESC NULLS FIRST
+		`, userID, accounts.DeletedName)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			log.Printf("Error listing chats of user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
 			return
 		}
 		defer rows.Close()
 
-		// Get column types and names once before the loop
-		types, _ := rows.ColumnTypes()
-		columns, _ := rows.Columns()
-		log.Printf("Query returns %d columns", len(columns))
-		for i, t := range types {
-			log.Printf("Column %d: %s has type %s", i+1, columns[i], t.DatabaseTypeName())
-		}
-
-		var chats []ChatPreview
+		chats := []ChatPreview{}
 		for rows.Next() {
-			var chat ChatPreview
-			// Debug values before scan
-			var id, initiatorID, targetID int
-			var initiatorName, targetName, initiatorPicture, targetPicture, lastMessage sql.NullString
-			var lastMessageTime sql.NullTime
-
+			var row chatRow
 			err := rows.Scan(
-				&id,
-				&initiatorID,
-				&targetID,
-				&initiatorName,
-				&targetName,
-				&initiatorPicture,
-				&targetPicture,
-				&lastMessageTime,
-				&lastMessage,
+				&row.ID,
+				&row.InitiatorID,
+				&row.TargetID,
+				&row.InitiatorName,
+				&row.TargetName,
+				&row.InitiatorPicture,
+				&row.TargetPicture,
+				&row.InitiatorAlt,
+				&row.TargetAlt,
+				&row.LastMessageTime,
+				&row.LastMessage,
 			)
 			if err != nil {
-				log.Printf("Debug row values: id=%d, initiatorID=%d, targetID=%d, initiatorName=%v, targetName=%v, initiatorPic=%v, targetPic=%v, lastMessageTime=%v, lastMessage=%v",
-					id, initiatorID, targetID, initiatorName, targetName, initiatorPicture, targetPicture, lastMessageTime, lastMessage)
-				log.Printf("Failed to scan chat row: %v", err)
-				http.Error(w, "Failed to scan chat row: "+err.Error(), http.StatusInternalServerError)
+				log.Printf("Error scanning chat of user %d: %v", userID, err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
 				return
 			}
 
-			chat.ID = id
-			chat.InitiatorID = initiatorID
-			chat.TargetID = targetID
-			chat.InitiatorName = initiatorName
-			chat.TargetName = targetName
-			chat.InitiatorPicture = initiatorPicture
-			chat.TargetPicture = targetPicture
-			chat.LastMessageTime = lastMessageTime
-			chat.LastMessage = lastMessage.String
-
-			// Set the other user's name and picture based on whether the current user is initiator or target
-			if chat.InitiatorID == userID {
-				if chat.TargetName.Valid {
-					chat.OtherUserName = chat.TargetName.String
-				}
-				if chat.TargetPicture.Valid {
-					chat.OtherUserPicture = chat.TargetPicture.String
-				}
-			} else {
-				if chat.InitiatorName.Valid {
-					chat.OtherUserName = chat.InitiatorName.String
-				}
-				if chat.InitiatorPicture.Valid {
-					chat.OtherUserPicture = chat.InitiatorPicture.String
-				}
-			}
-
-			if chat.LastMessageTime.Valid {
-				chat.LastMessageAt = &chat.LastMessageTime.Time
-			}
-
-			chats = append(chats, chat)
+			chats = append(chats, row.preview(userID))
+		}
+		if err := rows.Err(); err != nil {
+			log.Printf("Error listing chats of user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
 		}
 
 		json.NewEncoder(w).Encode(chats)
@@ -444,70 +389,31 @@ func GetChatsHandler(db *sql.DB) http.HandlerFunc {
 
 func GetChatMessagesHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		userID, err := auth.GetUserIDFromToken(r)
-		if err != nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		userID, matchID, ok := chatParticipant(w, r, db)
+		if !ok {
 			return
 		}
 
-		matchID, err := strconv.Atoi(mux.Vars(r)["id"])
-		if err != nil {
-			http.Error(w, "Invalid match ID", http.StatusBadRequest)
-			return
-		}
-
-		// Verify user is part of this connection and both users are active and opted in
-		var count int
-		err = db.QueryRow(`
-			SELECT COUNT(*) 
-			FROM connections c
-			JOIN users u1 ON c.initiator_id = u1.id
-			JOIN users u2 ON c.target_id = u2.id
-			JOIN profiles p1 ON u1.id = p1.user_id
-			JOIN profiles p2 ON u2.id = p2.user_id
-			WHERE c.id = $1 
-			AND (c.initiator_id = $2 OR c.target_id = $2)
-			AND p1.chat_opt_in = true 
-			AND p2.chat_opt_in = true
-			AND u1.role = 'provider' 
-			AND u2.role = 'recipient'
-			AND (
-				(u1.id = c.initiator_id AND u1.status = 'active') OR
-				(u2.id = c.initiator_id AND u2.status = 'active')
-			)
-			AND (
-				(u1.id = c.target_id AND u1.status = 'active') OR
-				(u2.id = c.target_id AND u2.status = 'active')
-			)
-		`, matchID, userID).Scan(&count)
-
-		if err != nil || count == 0 {
-			http.Error(w, "Unauthorized or chat not available", http.StatusUnauthorized)
-			return
-		}
-
-		rows, err := db.Query(`
-			SELECT id, sender_id, content, timestamp, read
-			FROM chat_messages
-			WHERE match_id = $1
-			ORDER BY timestamp ASC
-		`, matchID)
+		messages, err := chatMessages(db, matchID, 0, 0)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		defer rows.Close()
 
-		var messages []ChatMessage
-		for rows.Next() {
-			var msg ChatMessage
-			err := rows.Scan(&msg.ID, &msg.SenderID, &msg.Content, &msg.Timestamp, &msg.Read)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
+		// Translate the other party's messages into the reader's language
+		readerLanguage := translate.UserLanguage(db, userID)
+		senderLanguages := make(map[int]string)
+		for i := range messages {
+			senderID := messages[i].SenderID
+			if senderID == userID {
+				continue
+			}
+			if _, ok := senderLanguages[senderID]; !ok {
+				senderLanguages[senderID] = translate.UserLanguage(db, senderID)
+			}
+			if translated, ok := translate.Translate(db, messages[i].Content, senderLanguages[senderID], readerLanguage); ok {
+				messages[i].TranslatedContent = &translated
 			}
-			msg.MatchID = matchID
-			messages = append(messages, msg)
 		}
 
 		json.NewEncoder(w).Encode(messages)
@@ -516,49 +422,12 @@ func GetChatMessagesHandler(db *sql.DB) http.HandlerFunc {
 
 func MarkMessagesAsReadHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		userID, err := auth.GetUserIDFromToken(r)
-		if err != nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
-
-		matchID, err := strconv.Atoi(mux.Vars(r)["id"])
-		if err != nil {
-			http.Error(w, "Invalid match ID", http.StatusBadRequest)
-			return
-		}
-
-		// Verify user is part of this connection and both users are active and opted in
-		var count int
-		err = db.QueryRow(`
-			SELECT COUNT(*) 
-			FROM connections c
-			JOIN users u1 ON c.initiator_id = u1.id
-			JOIN users u2 ON c.target_id = u2.id
-			JOIN profiles p1 ON u1.id = p1.user_id
-			JOIN profiles p2 ON u2.id = p2.user_id
-			WHERE c.id = $1 
-			AND (c.initiator_id = $2 OR c.target_id = $2)
-			AND p1.chat_opt_in = true 
-			AND p2.chat_opt_in = true
-			AND u1.role = 'provider' 
-			AND u2.role = 'recipient'
-			AND (
-				(u1.id = c.initiator_id AND u1.status = 'active') OR
-				(u2.id = c.initiator_id AND u2.status = 'active')
-			)
-			AND (
-				(u1.id = c.target_id AND u1.status = 'active') OR
-				(u2.id = c.target_id AND u2.status = 'active')
-			)
-		`, matchID, userID).Scan(&count)
-
-		if err != nil || count == 0 {
-			http.Error(w, "Unauthorized or chat not available", http.StatusUnauthorized)
+		userID, matchID, ok := chatParticipant(w, r, db)
+		if !ok {
 			return
 		}
 
-		_, err = db.Exec(`
+		_, err := db.Exec(`
 			UPDATE chat_messages
 			SET read = true
 			WHERE match_id = $1 AND sender_id != $2 AND read = false
@@ -569,6 +438,9 @@ func MarkMessagesAsReadHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		// The user's other devices clear the conversation's unread badge too
+		pushUnread(db, matchID, userID)
+
 		w.WriteHeader(http.StatusOK)
 	}
 }
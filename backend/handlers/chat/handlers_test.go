@@ -0,0 +1,62 @@
+package chat
+
+import (
+	"database/sql"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestChatRowPreview(t *testing.T) {
+	sent := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	row := chatRow{
+		ID:               7,
+		InitiatorID:      1,
+		TargetID:         2,
+		InitiatorName:    sql.NullString{String: "Initiator", Valid: true},
+		TargetName:       sql.NullString{String: "Target", Valid: true},
+		TargetPicture:    sql.NullString{String: "/uploads/2.png", Valid: true},
+		TargetAlt:        sql.NullString{String: "Logo", Valid: true},
+		InitiatorPicture: sql.NullString{},
+	}
+	withMessage := row
+	withMessage.LastMessage = sql.NullString{String: "Hi", Valid: true}
+	withMessage.LastMessageTime = sql.NullTime{Time: sent, Valid: true}
+
+	tests := []struct {
+		name   string
+		row    chatRow
+		userID int
+		want   string
+	}{
+		{
+			name:   "initiator sees the target, no messages yet",
+			row:    row,
+			userID: 1,
+			want:   `{"id":7,"initiator_id":1,"target_id":2,"other_user_name":"Target","other_user_picture":"/uploads/2.png","other_user_picture_alt":"Logo"}`,
+		},
+		{
+			name:   "target sees the initiator without a picture",
+			row:    row,
+			userID: 2,
+			want:   `{"id":7,"initiator_id":1,"target_id":2,"other_user_name":"Initiator","other_user_picture":"","other_user_picture_alt":""}`,
+		},
+		{
+			name:   "last message",
+			row:    withMessage,
+			userID: 1,
+			want:   `{"id":7,"initiator_id":1,"target_id":2,"last_message":"Hi","last_message_at":"2024-05-01T12:00:00Z","other_user_name":"Target","other_user_picture":"/uploads/2.png","other_user_picture_alt":"Logo"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.Marshal(tt.row.preview(tt.userID))
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("JSON = %s\nwant   %s", got, tt.want)
+			}
+		})
+	}
+}
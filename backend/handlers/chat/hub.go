@@ -0,0 +1,222 @@
+package chat
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"matcherator/backend/handlers/wsproto"
+)
+
+// typingInterval is the least time between two "started typing" events of a
+// user in a conversation
+const typingInterval = 3 * time.Second
+
+// legacyEvents are the events clients of the unframed protocol get, as bare
+// JSON; they get no others
+var legacyEvents = map[string]bool{
+	wsproto.TypeMessage: true,
+	wsproto.TypeTyping:  true,
+	wsproto.TypeAck:     true,
+	wsproto.TypeResumed: true,
+	wsproto.TypePin:     true,
+}
+
+// PresenceEvent tells a conversation's participants the other side opened
+// or closed it
+type PresenceEvent struct {
+	MatchID int  `json:"match_id"`
+	UserID  int  `json:"user_id"`
+	Online  bool `json:"online"`
+}
+
+// hub tracks the WebSocket connections open on each conversation and fans
+// events out to them
+type hub struct {
+	mu     sync.Mutex
+	rooms  map[int]map[*websocket.Conn]client // map[matchID]map[conn]client
+	typing map[typingKey]typingState
+}
+
+// client is the user behind a connection and the protocol version it speaks
+type client struct {
+	userID  int
+	version int
+}
+
+type typingKey struct {
+	matchID int
+	userID  int
+}
+
+// typingState is the last typing event of a user that was passed on
+type typingState struct {
+	startedAt time.Time
+	typing    bool
+}
+
+var chatHub = &hub{
+	rooms:  make(map[int]map[*websocket.Conn]client),
+	typing: make(map[typingKey]typingState),
+}
+
+// join adds the user's connection to a conversation. When it is the user's
+// first there, the others learn they are online; the new connection learns
+// who else is.
+func (h *hub) join(matchID, userID, version int, conn *websocket.Conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.rooms[matchID] == nil {
+		h.rooms[matchID] = make(map[*websocket.Conn]client)
+	}
+	first := !h.present(matchID, userID)
+	h.rooms[matchID][conn] = client{userID: userID, version: version}
+
+	online := make(map[int]bool)
+	for _, other := range h.rooms[matchID] {
+		if other.userID != userID && !online[other.userID] {
+			online[other.userID] = true
+			h.send(matchID, websocket.TextMessage, wsproto.TypePresence, PresenceEvent{MatchID: matchID, UserID: other.userID, Online: true}, only(conn))
+		}
+	}
+	if first {
+		h.send(matchID, websocket.TextMessage, wsproto.TypePresence, PresenceEvent{MatchID: matchID, UserID: userID, Online: true}, exceptUser(userID))
+	}
+}
+
+// leave removes a connection from a conversation
+func (h *hub) leave(matchID int, conn *websocket.Conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.remove(matchID, conn)
+}
+
+// broadcast sends an event to every connection of a conversation
+func (h *hub) broadcast(matchID, messageType int, eventType string, event interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.send(matchID, messageType, eventType, event, func(*websocket.Conn, client) bool { return false })
+}
+
+// broadcastFrom sends an event to every connection of a conversation but the
+// one it came from. The sender's other devices still get it.
+func (h *hub) broadcastFrom(matchID int, origin *websocket.Conn, messageType int, eventType string, event interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.send(matchID, messageType, eventType, event, func(conn *websocket.Conn, _ client) bool { return conn == origin })
+}
+
+// reply sends an event to one connection of a conversation
+func (h *hub) reply(matchID int, conn *websocket.Conn, messageType int, eventType string, event interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.send(matchID, messageType, eventType, event, only(conn))
+}
+
+// typingEvent passes a typing event on to the other connections of the
+// conversation; the typist's own connections don't get it back. A user
+// starts typing at most once per typingInterval; stopping is passed on only
+// after a start, so a client can't flood the conversation either way.
+func (h *hub) typingEvent(matchID, messageType int, message TypingMessage) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := typingKey{matchID: matchID, userID: message.UserID}
+	last := h.typing[key]
+	now := time.Now()
+	if message.Typing {
+		if now.Sub(last.startedAt) < typingInterval {
+			return
+		}
+		last.startedAt = now
+	} else if !last.typing {
+		return
+	}
+	last.typing = message.Typing
+	h.typing[key] = last
+
+	h.send(matchID, messageType, wsproto.TypeTyping, message, exceptUser(message.UserID))
+}
+
+// send writes an event to the conversation's connections, except those skip
+// returns true for, framed for each connection's protocol version. Failing
+// connections are dropped. The caller holds h.mu.
+func (h *hub) send(matchID, messageType int, eventType string, event interface{}, skip func(*websocket.Conn, client) bool) {
+	frames := make(map[int][]byte)
+	for conn, c := range h.rooms[matchID] {
+		if skip(conn, c) {
+			continue
+		}
+		if c.version == 0 && !legacyEvents[eventType] {
+			continue
+		}
+
+		data, ok := frames[c.version]
+		if !ok {
+			var err error
+			if c.version == 0 {
+				data, err = json.Marshal(event)
+			} else {
+				data, err = wsproto.Encode(eventType, event)
+			}
+			if err != nil {
+				return
+			}
+			frames[c.version] = data
+		}
+
+		if err := conn.WriteMessage(messageType, data); err != nil {
+			conn.Close()
+			h.remove(matchID, conn)
+		}
+	}
+}
+
+// remove drops a connection. Once the user has no connection left in the
+// conversation, their typing state is forgotten and the others see them go
+// offline. The caller holds h.mu.
+func (h *hub) remove(matchID int, conn *websocket.Conn) {
+	c, ok := h.rooms[matchID][conn]
+	if !ok {
+		return
+	}
+	delete(h.rooms[matchID], conn)
+	if h.present(matchID, c.userID) {
+		return
+	}
+
+	delete(h.typing, typingKey{matchID: matchID, userID: c.userID})
+	if len(h.rooms[matchID]) == 0 {
+		delete(h.rooms, matchID)
+		return
+	}
+	h.send(matchID, websocket.TextMessage, wsproto.TypePresence, PresenceEvent{MatchID: matchID, UserID: c.userID, Online: false}, exceptUser(c.userID))
+}
+
+// present reports whether the user has a connection in the conversation. The
+// caller holds h.mu.
+func (h *hub) present(matchID, userID int) bool {
+	for _, c := range h.rooms[matchID] {
+		if c.userID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// only skips every connection but conn
+func only(conn *websocket.Conn) func(*websocket.Conn, client) bool {
+	return func(other *websocket.Conn, _ client) bool { return other != conn }
+}
+
+// exceptUser skips the user's connections
+func exceptUser(userID int) func(*websocket.Conn, client) bool {
+	return func(_ *websocket.Conn, c client) bool { return c.userID == userID }
+}
@@ -0,0 +1,257 @@
+package chat
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+
+	"matcherator/backend/handlers/auth"
+	"matcherator/backend/handlers/wsproto"
+	"matcherator/backend/services/accounts"
+	"matcherator/backend/services/chat"
+)
+
+// MaxPins is how many messages a conversation can have pinned at once
+const MaxPins = 5
+
+// PinnedMessage is a message pinned to the top of a conversation
+type PinnedMessage struct {
+	ChatMessage
+	PinnedBy int       `json:"pinned_by"`
+	PinnedAt time.Time `json:"pinned_at"`
+}
+
+// PinEvent is sent over the WebSocket when a message is pinned or unpinned
+type PinEvent struct {
+	MatchID   int  `json:"match_id"`
+	MessageID int  `json:"message_id"`
+	Pinned    bool `json:"pinned"`
+	UserID    int  `json:"user_id"`
+}
+
+// GetPinnedMessagesHandler lists a conversation's pinned messages, most
+// recently pinned first
+// Used by: /api/chat/{id}/pins
+// Response: []PinnedMessage
+func GetPinnedMessagesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, matchID, ok := chatParticipant(w, r, db)
+		if !ok {
+			return
+		}
+
+		pins, err := pinnedMessages(db, matchID)
+		if err != nil {
+			log.Printf("Error listing pins of chat %d for user %d: %v", matchID, userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(pins)
+	}
+}
+
+// PinMessageHandler pins a message of the conversation. Pinning a pinned
+// message does nothing; pinning more than MaxPins is refused.
+// Used by: /api/chat/{id}/messages/{message_id}/pin
+// Response: []PinnedMessage
+func PinMessageHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, matchID, ok := chatParticipant(w, r, db)
+		if !ok {
+			return
+		}
+		messageID, err := strconv.Atoi(mux.Vars(r)["message_id"])
+		if err != nil {
+			http.Error(w, "Invalid message ID", http.StatusBadRequest)
+			return
+		}
+
+		pinned, err := pinMessage(db, matchID, messageID, userID)
+		switch err {
+		case nil:
+		case sql.ErrNoRows:
+			http.Error(w, "Message not found", http.StatusNotFound)
+			return
+		case errTooManyPins:
+			http.Error(w, fmt.Sprintf("A conversation can have at most %d pinned messages. Unpin one first", MaxPins), http.StatusConflict)
+			return
+		default:
+			log.Printf("Error pinning message %d in chat %d: %v", messageID, matchID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		if pinned {
+			broadcastPin(matchID, websocket.TextMessage, PinEvent{MatchID: matchID, MessageID: messageID, Pinned: true, UserID: userID})
+		}
+		writePins(w, db, matchID)
+	}
+}
+
+// UnpinMessageHandler unpins a message of the conversation
+// Used by: /api/chat/{id}/messages/{message_id}/pin
+// Response: []PinnedMessage
+func UnpinMessageHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, matchID, ok := chatParticipant(w, r, db)
+		if !ok {
+			return
+		}
+		messageID, err := strconv.Atoi(mux.Vars(r)["message_id"])
+		if err != nil {
+			http.Error(w, "Invalid message ID", http.StatusBadRequest)
+			return
+		}
+
+		result, err := db.Exec("DELETE FROM chat_pins WHERE match_id = $1 AND message_id = $2", matchID, messageID)
+		if err != nil {
+			log.Printf("Error unpinning message %d in chat %d: %v", messageID, matchID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		if n, _ := result.RowsAffected(); n > 0 {
+			broadcastPin(matchID, websocket.TextMessage, PinEvent{MatchID: matchID, MessageID: messageID, Pinned: false, UserID: userID})
+		}
+		writePins(w, db, matchID)
+	}
+}
+
+var errTooManyPins = errors.New("too many pinned messages")
+
+// pinMessage pins a message, reporting whether it was newly pinned. It returns
+// sql.ErrNoRows when the message is not part of the conversation.
+func pinMessage(db *sql.DB, matchID, messageID, userID int) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// Lock the conversation so concurrent pins can't pass the limit together
+	var locked int
+	if err := tx.QueryRow("SELECT id FROM connections WHERE id = $1 FOR UPDATE", matchID).Scan(&locked); err != nil {
+		return false, err
+	}
+
+	var exists, pinned bool
+	var pins int
+	err = tx.QueryRow(`
+		SELECT
+			EXISTS (SELECT 1 FROM chat_messages WHERE id = $2 AND match_id = $1),
+			EXISTS (SELECT 1 FROM chat_pins WHERE match_id = $1 AND message_id = $2),
+			(SELECT COUNT(*) FROM chat_pins WHERE match_id = $1)
+	`, matchID, messageID).Scan(&exists, &pinned, &pins)
+	if err != nil {
+		return false, err
+	}
+	if !exists {
+		return false, sql.ErrNoRows
+	}
+	if pinned {
+		return false, nil
+	}
+	if pins >= MaxPins {
+		return false, errTooManyPins
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO chat_pins (match_id, message_id, pinned_by) VALUES ($1, $2, $3)
+	`, matchID, messageID, userID); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// pinnedMessages returns a conversation's pinned messages, most recently
+// pinned first
+func pinnedMessages(db *sql.DB, matchID int) ([]PinnedMessage, error) {
+	rows, err := db.Query(`
+		SELECT cm.id, cm.sender_id,
+			CASE WHEN u.deleted_at IS NULL THEN COALESCE(p.organization_name, '') ELSE $2 END,
+			cm.content, cm.timestamp, COALESCE(cm.read, false), cp.pinned_by, cp.pinned_at
+		FROM chat_pins cp
+		JOIN chat_messages cm ON cm.id = cp.message_id
+		JOIN users u ON u.id = cm.sender_id
+		LEFT JOIN profiles p ON p.user_id = cm.sender_id
+		WHERE cp.match_id = $1
+		ORDER BY cp.pinned_at DESC
+	`, matchID, accounts.DeletedName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pins := []PinnedMessage{}
+	for rows.Next() {
+		var pin PinnedMessage
+		err := rows.Scan(
+			&pin.ID, &pin.SenderID, &pin.SenderName, &pin.Content, &pin.Timestamp, &pin.Read,
+			&pin.PinnedBy, &pin.PinnedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		pin.MatchID = matchID
+		pins = append(pins, pin)
+	}
+	return pins, rows.Err()
+}
+
+// writePins responds with the conversation's pinned messages
+func writePins(w http.ResponseWriter, db *sql.DB, matchID int) {
+	pins, err := pinnedMessages(db, matchID)
+	if err != nil {
+		log.Printf("Error listing pins of chat %d: %v", matchID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(pins)
+}
+
+// chatParticipant returns the user and the conversation of a request, writing the
+// error response when the user can't chat in it
+func chatParticipant(w http.ResponseWriter, r *http.Request, db *sql.DB) (int, int, bool) {
+	userID, err := auth.GetUserIDFromToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return 0, 0, false
+	}
+
+	matchID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid match ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+
+	ok, err := chat.CanChat(db, matchID, userID)
+	if err != nil {
+		log.Printf("Error checking chat %d of user %d: %v", matchID, userID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return 0, 0, false
+	}
+	if !ok {
+		http.Error(w, "Unauthorized or chat not available", http.StatusUnauthorized)
+		return 0, 0, false
+	}
+	return userID, matchID, true
+}
+
+func broadcastPin(matchID, messageType int, pinEvent PinEvent) {
+	chatHub.broadcast(matchID, messageType, wsproto.TypePin, pinEvent)
+}
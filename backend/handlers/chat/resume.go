@@ -0,0 +1,95 @@
+package chat
+
+import (
+	"database/sql"
+	"log"
+
+	"github.com/gorilla/websocket"
+
+	"matcherator/backend/handlers/wsproto"
+	"matcherator/backend/services/accounts"
+)
+
+// maxReplay bounds how many missed messages a reconnecting client is sent;
+// beyond that it reloads the conversation over REST
+const maxReplay = 200
+
+// ResumeRequest is sent by a reconnecting client with the ID of the last
+// message it has, to be sent the ones stored since
+type ResumeRequest struct {
+	ResumeFrom *int `json:"resume_from"`
+}
+
+// ResumeDone follows the replayed messages. Complete is false when more than
+// maxReplay were missed and the client should reload the conversation.
+type ResumeDone struct {
+	Resumed  bool `json:"resumed"`
+	Count    int  `json:"count"`
+	Complete bool `json:"complete"`
+}
+
+// replayMessages sends the connection the conversation's messages stored
+// after afterID, oldest first, in the same shape as live ones
+func replayMessages(db *sql.DB, conn *websocket.Conn, messageType, matchID, afterID int) {
+	messages, err := chatMessages(db, matchID, afterID, maxReplay+1)
+	if err != nil {
+		log.Printf("Error loading messages of chat %d after %d: %v", matchID, afterID, err)
+		return
+	}
+
+	complete := len(messages) <= maxReplay
+	if !complete {
+		messages = messages[:maxReplay]
+	}
+	for _, message := range messages {
+		chatHub.reply(matchID, conn, messageType, wsproto.TypeMessage, message)
+	}
+	chatHub.reply(matchID, conn, messageType, wsproto.TypeResumed, ResumeDone{Resumed: true, Count: len(messages), Complete: complete})
+}
+
+// chatMessages loads a conversation's messages with an ID above afterID,
+// oldest first, with their senders' names and where forwarded messages came
+// from. A limit of 0 loads them all.
+func chatMessages(db *sql.DB, matchID, afterID, limit int) ([]ChatMessage, error) {
+	rows, err := db.Query(`
+		SELECT cm.id, cm.sender_id,
+			CASE WHEN u.deleted_at IS NULL THEN COALESCE(p.organization_name, '') ELSE $2 END,
+			cm.content, cm.timestamp, COALESCE(cm.read, false),
+			cm.forwarded_from, cm.forwarded_sender_id,
+			CASE WHEN fu.deleted_at IS NULL AND fu.id IS NOT NULL THEN COALESCE(fp.organization_name, '') ELSE $2 END,
+			cm.forwarded_sent_at
+		FROM chat_messages cm
+		JOIN users u ON u.id = cm.sender_id
+		LEFT JOIN profiles p ON p.user_id = cm.sender_id
+		LEFT JOIN users fu ON fu.id = cm.forwarded_sender_id
+		LEFT JOIN profiles fp ON fp.user_id = cm.forwarded_sender_id
+		WHERE cm.match_id = $1 AND cm.id > $3
+		ORDER BY cm.timestamp ASC, cm.id ASC
+		LIMIT NULLIF($4, 0)
+	`, matchID, accounts.DeletedName, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []ChatMessage{}
+	for rows.Next() {
+		var msg ChatMessage
+		var forwarded ForwardedFrom
+		var forwardedAt sql.NullTime
+		err := rows.Scan(
+			&msg.ID, &msg.SenderID, &msg.SenderName, &msg.Content, &msg.Timestamp, &msg.Read,
+			&forwarded.MessageID, &forwarded.SenderID, &forwarded.SenderName, &forwardedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		msg.MatchID = matchID
+		if forwardedAt.Valid {
+			forwarded.SentAt = forwardedAt.Time
+			msg.ForwardedFrom = &forwarded
+		}
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
@@ -0,0 +1,111 @@
+package chat
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"matcherator/backend/handlers/httputil"
+	"matcherator/backend/handlers/wsproto"
+	"matcherator/backend/services/telemetry"
+	"matcherator/backend/services/track"
+)
+
+// SendMessageHandler sends a message over HTTP, for clients whose WebSocket is
+// unavailable. The message is stored and delivered as if it came over the
+// socket.
+// Used by: /api/chat/{id}/messages
+// Response: 201 Created, ChatMessage
+func SendMessageHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, matchID, ok := chatParticipant(w, r, db)
+		if !ok {
+			return
+		}
+
+		var sent SentMessage
+		if !httputil.DecodeJSON(w, r, &sent) {
+			return
+		}
+		if err := sent.validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		message, err := storeMessage(r.Context(), db, matchID, userID, sent.Content)
+		if err != nil {
+			telemetry.ReportError(r.Context(), err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		deliverMessage(db, nil, websocket.TextMessage, message)
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(message)
+	}
+}
+
+// validate checks a sent message before it is stored
+func (sent SentMessage) validate() error {
+	if strings.TrimSpace(sent.Content) == "" || utf8.RuneCountInString(sent.Content) > maxMessageLen {
+		return fmt.Errorf("content is required and at most %d characters", maxMessageLen)
+	}
+	if len(sent.ClientID) > maxClientIDLen {
+		return fmt.Errorf("client_id must be at most %d characters", maxClientIDLen)
+	}
+	return nil
+}
+
+// storeMessage stores a message the user sent in a conversation, whichever
+// way it came, and clears the draft it was written in
+func storeMessage(ctx context.Context, db *sql.DB, matchID, userID int, content string) (ChatMessage, error) {
+	message := ChatMessage{
+		MatchID:   matchID,
+		SenderID:  userID,
+		Content:   content,
+		Timestamp: time.Now(),
+	}
+
+	// Each message gets its own span within the request's trace
+	ctx, span := telemetry.Tracer().Start(ctx, "chat.message", trace.WithAttributes(
+		attribute.Int("chat.match_id", matchID),
+		attribute.Int("chat.sender_id", userID),
+	))
+	defer span.End()
+
+	err := db.QueryRowContext(ctx, `
+		INSERT INTO chat_messages (match_id, sender_id, content, timestamp)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`, message.MatchID, message.SenderID, message.Content, message.Timestamp).Scan(&message.ID)
+	if err != nil {
+		return ChatMessage{}, fmt.Errorf("error storing chat message: %v", err)
+	}
+
+	track.Event(db, userID, track.FirstMessage, nil)
+
+	// The draft was sent; other devices shouldn't offer it again
+	if err := clearDraft(db, matchID, userID); err != nil {
+		log.Printf("Error clearing draft of user %d in chat %d: %v", userID, matchID, err)
+	}
+	return message, nil
+}
+
+// deliverMessage sends a stored message to the conversation's connections but
+// origin, the one it was sent over if any, and to the participants' devices
+func deliverMessage(db *sql.DB, origin *websocket.Conn, messageType int, message ChatMessage) {
+	chatHub.broadcastFrom(message.MatchID, origin, messageType, wsproto.TypeMessage, message)
+	deliverToDevices(db, message)
+}
@@ -0,0 +1,169 @@
+package chat
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/gorilla/websocket"
+
+	"matcherator/backend/handlers/wsproto"
+	"matcherator/backend/services/telemetry"
+)
+
+const (
+	maxMessageLen  = 5000
+	maxClientIDLen = 100
+)
+
+// ReadEvent tells the other side of a conversation the user read it
+type ReadEvent struct {
+	MatchID int `json:"match_id"`
+	UserID  int `json:"user_id"`
+}
+
+// typingData is the data of an inbound typing envelope
+type typingData struct {
+	Typing *bool `json:"typing"`
+}
+
+// chatSession is one user's WebSocket on a conversation
+type chatSession struct {
+	db      *sql.DB
+	ctx     context.Context
+	conn    *websocket.Conn
+	matchID int
+	userID  int
+}
+
+// handle acts on one inbound frame. Envelopes are validated against their
+// type; clients speaking the envelope protocol are told what was wrong.
+func (s *chatSession) handle(messageType int, frame []byte) {
+	envelope, err := wsproto.Decode(frame)
+	if err != nil {
+		s.fail(messageType, err.Error())
+		return
+	}
+	if envelope == nil {
+		s.handleLegacy(messageType, frame)
+		return
+	}
+
+	switch envelope.Type {
+	case wsproto.TypeMessage:
+		var sent SentMessage
+		if err := wsproto.DecodeData(envelope, &sent); err != nil {
+			s.fail(messageType, err.Error())
+			return
+		}
+		if err := sent.validate(); err != nil {
+			s.fail(messageType, err.Error())
+			return
+		}
+		s.sendMessage(messageType, sent)
+	case wsproto.TypeTyping:
+		var data typingData
+		if err := wsproto.DecodeData(envelope, &data); err != nil {
+			s.fail(messageType, err.Error())
+			return
+		}
+		if data.Typing == nil {
+			s.fail(messageType, "typing is required")
+			return
+		}
+		chatHub.typingEvent(s.matchID, messageType, TypingMessage{MatchID: s.matchID, UserID: s.userID, Typing: *data.Typing})
+	case wsproto.TypeRead:
+		var data struct{}
+		if err := wsproto.DecodeData(envelope, &data); err != nil {
+			s.fail(messageType, err.Error())
+			return
+		}
+		s.markRead(messageType)
+	case wsproto.TypeResume:
+		var resume ResumeRequest
+		if err := wsproto.DecodeData(envelope, &resume); err != nil {
+			s.fail(messageType, err.Error())
+			return
+		}
+		if resume.ResumeFrom == nil || *resume.ResumeFrom < 0 {
+			s.fail(messageType, "resume_from must be a message ID")
+			return
+		}
+		replayMessages(s.db, s.conn, messageType, s.matchID, *resume.ResumeFrom)
+	default:
+		s.fail(messageType, fmt.Sprintf("unsupported frame type %q", envelope.Type))
+	}
+}
+
+// handleLegacy acts on a frame of the unframed protocol, told apart by its
+// fields
+func (s *chatSession) handleLegacy(messageType int, frame []byte) {
+	var resume ResumeRequest
+	if err := json.Unmarshal(frame, &resume); err == nil && resume.ResumeFrom != nil {
+		replayMessages(s.db, s.conn, messageType, s.matchID, *resume.ResumeFrom)
+		return
+	}
+
+	if strings.Contains(string(frame), `"typing"`) {
+		var typingMessage TypingMessage
+		if err := json.Unmarshal(frame, &typingMessage); err != nil {
+			return
+		}
+		typingMessage.MatchID = s.matchID
+		typingMessage.UserID = s.userID
+		chatHub.typingEvent(s.matchID, messageType, typingMessage)
+		return
+	}
+
+	var sent SentMessage
+	if err := json.Unmarshal(frame, &sent); err != nil {
+		return
+	}
+	s.sendMessage(messageType, sent)
+}
+
+// sendMessage stores a message and delivers it. The sending connection gets
+// an ack with the stored ID instead of its own message back.
+func (s *chatSession) sendMessage(messageType int, sent SentMessage) {
+	message, err := storeMessage(s.ctx, s.db, s.matchID, s.userID, sent.Content)
+	if err != nil {
+		telemetry.ReportError(s.ctx, err)
+		s.fail(messageType, "message could not be stored")
+		return
+	}
+
+	chatHub.reply(s.matchID, s.conn, messageType, wsproto.TypeAck, MessageAck{
+		Ack:       true,
+		ClientID:  sent.ClientID,
+		ID:        message.ID,
+		MatchID:   s.matchID,
+		Timestamp: message.Timestamp,
+	})
+	deliverMessage(s.db, s.conn, messageType, message)
+}
+
+// markRead marks the other side's messages read, updating the user's devices
+// and telling the other side
+func (s *chatSession) markRead(messageType int) {
+	_, err := s.db.Exec(`
+		UPDATE chat_messages
+		SET read = true
+		WHERE match_id = $1 AND sender_id != $2 AND read = false
+	`, s.matchID, s.userID)
+	if err != nil {
+		log.Printf("Error marking chat %d read for user %d: %v", s.matchID, s.userID, err)
+		s.fail(messageType, "messages could not be marked read")
+		return
+	}
+
+	pushUnread(s.db, s.matchID, s.userID)
+	chatHub.broadcastFrom(s.matchID, s.conn, messageType, wsproto.TypeRead, ReadEvent{MatchID: s.matchID, UserID: s.userID})
+}
+
+// fail tells the connection a frame was not acted on
+func (s *chatSession) fail(messageType int, message string) {
+	chatHub.reply(s.matchID, s.conn, messageType, wsproto.TypeError, wsproto.Error{Message: message})
+}
@@ -0,0 +1,342 @@
+package claims
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	netmail "net/mail"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"matcherator/backend/handlers/auth"
+	"matcherator/backend/handlers/httputil"
+	"matcherator/backend/services/dedup"
+	"matcherator/backend/services/emaildomains"
+	"matcherator/backend/services/mail"
+	"matcherator/backend/services/tokens"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// claimValidity is how long the emailed link of a claim works, to confirm
+	// it and to upload a document
+	claimValidity = 7 * 24 * time.Hour
+	// maxClaimsPerIP caps the claims made from one address per hour
+	maxClaimsPerIP = 5
+	// MaxDocumentSize caps an uploaded EIN document
+	MaxDocumentSize = 10 << 20 // 10 MB
+	maxNameLen      = 255
+	maxFileNameLen  = 255
+)
+
+// documentDir holds EIN documents. They are only served to admins through
+// DownloadDocumentHandler.
+var documentDir = filepath.Join("uploads", "claim_documents")
+
+// allowedExtensions maps the document types claimants may upload to the
+// content type they are served with
+var allowedExtensions = map[string]string{
+	".pdf":  "application/pdf",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+}
+
+// CreateClaimHandler starts a claim on an imported organization and emails
+// the claimant a link to confirm it. Anyone may claim; the claim only takes
+// effect once an admin approves it.
+// Used by: /api/public/providers/{id}/claims
+// Response: 202 Accepted, {"message": string}
+func CreateClaimHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		organizationID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid organization ID", http.StatusBadRequest)
+			return
+		}
+
+		var req ClaimRequest
+		if !httputil.DecodeJSON(w, r, &req) {
+			return
+		}
+		email := strings.TrimSpace(req.Email)
+		address, err := netmail.ParseAddress(email)
+		if err != nil || address.Address != email || len(email) > 255 {
+			http.Error(w, "Invalid email", http.StatusBadRequest)
+			return
+		}
+		name := strings.TrimSpace(req.Name)
+		if name == "" || utf8.RuneCountInString(name) > maxNameLen {
+			http.Error(w, fmt.Sprintf("Name is required and at most %d characters", maxNameLen), http.StatusBadRequest)
+			return
+		}
+		if !mail.Configured() {
+			http.Error(w, "Claims are not available right now", http.StatusServiceUnavailable)
+			return
+		}
+
+		var organizationName, websiteURL string
+		err = db.QueryRow(SelectClaimableQuery, organizationID).Scan(&organizationName, &websiteURL)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Organization not found or already claimed", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error loading organization %d for a claim: %v", organizationID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		ip := auth.ClientIP(r)
+		var fromIP int
+		if err := db.QueryRow(CountClaimsFromIPQuery, ip, time.Now().Add(-time.Hour)).Scan(&fromIP); err != nil {
+			log.Printf("Error counting claims: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if fromIP >= maxClaimsPerIP {
+			w.Header().Set("Retry-After", "3600")
+			http.Error(w, "Too many claims. Please try again later", http.StatusTooManyRequests)
+			return
+		}
+
+		if blocked, err := emaildomains.Blocked(db, email); err != nil {
+			log.Printf("Error checking email domain of a claim: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		} else if blocked {
+			http.Error(w, "Please use your work email", http.StatusBadRequest)
+			return
+		}
+
+		// The claimant signs in with this email once the claim is approved
+		var taken bool
+		if err := db.QueryRow(EmailTakenQuery, email, organizationID).Scan(&taken); err != nil {
+			log.Printf("Error checking claim email: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if taken {
+			http.Error(w, "That email already has an account. Claim with another address", http.StatusConflict)
+			return
+		}
+
+		token, err := tokens.NewSecret()
+		if err != nil {
+			http.Error(w, "Error generating claim link", http.StatusInternalServerError)
+			return
+		}
+
+		var claimID int
+		err = db.QueryRow(InsertClaimQuery, organizationID, email, name, tokens.Hash(token), ip).Scan(&claimID)
+		if err != nil {
+			log.Printf("Error storing claim on organization %d: %v", organizationID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		link := strings.TrimRight(os.Getenv("FRONTEND_URL"), "/") + "/claim#token=" + token
+		body := fmt.Sprintf(`Hi %s,
+
+Someone, hopefully you, asked to claim %s on Grant Matcherator with this address. Use the link below within %d days to confirm the claim:
+%s
+
+If you didn't ask for this, you can ignore this email; the claim is not reviewed without it.
+`, name, organizationName, int(claimValidity.Hours()/24), link)
+
+		if err := mail.Enqueue(db, email, "Confirm your claim of "+organizationName, body); err != nil {
+			log.Printf("Error queueing claim link of claim %d: %v", claimID, err)
+			http.Error(w, "Could not send the claim link", http.StatusServiceUnavailable)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]string{"message": "We emailed you a link to confirm the claim"})
+	}
+}
+
+// VerifyClaimHandler confirms a claim with the token from its emailed link.
+// A claimant whose email domain matches the organization's website goes
+// straight to review; others are asked for an EIN document. Verifying a
+// confirmed claim returns where it stands.
+// Used by: /api/public/claims/verify
+// Response: ClaimStatus
+func VerifyClaimHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		var req TokenRequest
+		if !httputil.DecodeJSON(w, r, &req) {
+			return
+		}
+
+		claim, websiteURL, email, _, ok := claimByToken(w, db, req.Token)
+		if !ok {
+			return
+		}
+
+		if claim.Status == StatusUnverified {
+			status, method := StatusAwaitingDocument, (*string)(nil)
+			if domainMatches(email, websiteURL) {
+				matched := MethodEmailDomain
+				status, method = StatusPendingReview, &matched
+			}
+			if _, err := db.Exec(VerifyClaimQuery, claim.ID, status, method); err != nil {
+				log.Printf("Error verifying claim %d: %v", claim.ID, err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+			claim.Status, claim.Method = status, method
+		}
+
+		json.NewEncoder(w).Encode(claim)
+	}
+}
+
+// UploadDocumentHandler attaches an EIN document to a confirmed claim and
+// puts it up for review, replacing any earlier upload. The form carries the
+// claim link's token and the file.
+// Used by: /api/public/claims/document
+// Response: ClaimStatus
+func UploadDocumentHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := r.ParseMultipartForm(MaxDocumentSize); err != nil {
+			http.Error(w, "File too large. Maximum size is 10MB", http.StatusBadRequest)
+			return
+		}
+
+		claim, _, _, previousPath, ok := claimByToken(w, db, r.FormValue("token"))
+		if !ok {
+			return
+		}
+		if claim.Status == StatusUnverified {
+			http.Error(w, "Confirm the claim before uploading a document", http.StatusConflict)
+			return
+		}
+		if claim.Method != nil && *claim.Method == MethodEmailDomain {
+			http.Error(w, "This claim is already up for review", http.StatusConflict)
+			return
+		}
+
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "No file uploaded", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+
+		fileName := strings.TrimSpace(filepath.Base(header.Filename))
+		ext := strings.ToLower(filepath.Ext(fileName))
+		contentType, allowed := allowedExtensions[ext]
+		if !allowed {
+			http.Error(w, "Invalid file type. Upload a PDF or an image", http.StatusBadRequest)
+			return
+		}
+		if header.Size > MaxDocumentSize {
+			http.Error(w, "File too large. Maximum size is 10MB", http.StatusBadRequest)
+			return
+		}
+		if utf8.RuneCountInString(fileName) > maxFileNameLen {
+			fileName = string([]rune(fileName)[:maxFileNameLen-len(ext)]) + ext
+		}
+
+		// Store under a random name; the original is only kept for downloads
+		storedName, err := tokens.NewSecret()
+		if err != nil {
+			log.Printf("Error generating document name: %v", err)
+			http.Error(w, "Failed to save file", http.StatusInternalServerError)
+			return
+		}
+		uploadPath := filepath.Join(documentDir, strconv.Itoa(claim.ID), storedName[:32]+ext)
+
+		if err := os.MkdirAll(filepath.Dir(uploadPath), 0750); err != nil {
+			http.Error(w, "Failed to create upload directory", http.StatusInternalServerError)
+			return
+		}
+
+		dst, err := os.OpenFile(uploadPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0640)
+		if err != nil {
+			http.Error(w, "Failed to create file", http.StatusInternalServerError)
+			return
+		}
+		_, err = io.Copy(dst, file)
+		dst.Close()
+		if err != nil {
+			os.Remove(uploadPath)
+			http.Error(w, "Failed to save file", http.StatusInternalServerError)
+			return
+		}
+
+		result, err := db.Exec(AttachDocumentQuery, claim.ID, fileName, contentType, uploadPath)
+		if err != nil {
+			// Clean up the uploaded file if the database update fails
+			os.Remove(uploadPath)
+			log.Printf("Error saving document of claim %d: %v", claim.ID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			os.Remove(uploadPath)
+			http.Error(w, "This claim no longer takes documents", http.StatusConflict)
+			return
+		}
+
+		if previousPath != "" && previousPath != uploadPath {
+			if err := os.Remove(previousPath); err != nil && !os.IsNotExist(err) {
+				log.Printf("Error deleting replaced document %s: %v", previousPath, err)
+			}
+		}
+
+		method := MethodEINDocument
+		claim.Status, claim.Method = StatusPendingReview, &method
+		json.NewEncoder(w).Encode(claim)
+	}
+}
+
+// claimByToken loads the open claim a link token belongs to, with the
+// organization's website, the claimant's email and the stored document, writing
+// the error response when there is none
+func claimByToken(w http.ResponseWriter, db *sql.DB, token string) (ClaimStatus, string, string, string, bool) {
+	var claim ClaimStatus
+	var websiteURL, email, documentPath string
+	if token == "" {
+		http.Error(w, "Invalid or expired claim link", http.StatusNotFound)
+		return claim, "", "", "", false
+	}
+
+	err := db.QueryRow(SelectClaimByTokenQuery, tokens.Hash(token), time.Now().Add(-claimValidity)).Scan(
+		&claim.ID, &claim.OrganizationID, &claim.OrganizationName, &websiteURL,
+		&email, &claim.Status, &claim.Method, &documentPath,
+	)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Invalid or expired claim link", http.StatusNotFound)
+		return claim, "", "", "", false
+	} else if err != nil {
+		log.Printf("Error loading claim: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return claim, "", "", "", false
+	}
+	return claim, websiteURL, email, documentPath, true
+}
+
+// domainMatches reports whether an email is at the domain of a website, or a
+// subdomain of it
+func domainMatches(email, websiteURL string) bool {
+	domain := emaildomains.Domain(email)
+	host := dedup.WebsiteHost(websiteURL)
+	if domain == "" || host == "" {
+		return false
+	}
+	return domain == host || strings.HasSuffix(domain, "."+host)
+}
@@ -0,0 +1,67 @@
+package claims
+
+import "time"
+
+// Claim statuses. A claim is unverified until the claimant follows the link
+// emailed to them; it then waits for review, or first for an EIN document
+// when the claimant's email domain doesn't match the organization's website.
+const (
+	StatusUnverified       = "unverified"
+	StatusAwaitingDocument = "awaiting_document"
+	StatusPendingReview    = "pending_review"
+	StatusApproved         = "approved"
+	StatusRejected         = "rejected"
+)
+
+// How a claim is backed
+const (
+	MethodEmailDomain = "email_domain"
+	MethodEINDocument = "ein_document"
+)
+
+// ClaimRequest asks to take over an imported organization. The link that
+// confirms the claim is emailed to Email.
+type ClaimRequest struct {
+	Email string `json:"email"`
+	Name  string `json:"name"`
+}
+
+// TokenRequest carries the token from the emailed claim link
+type TokenRequest struct {
+	Token string `json:"token"`
+}
+
+// ClaimStatus is what the claimant sees of their claim
+type ClaimStatus struct {
+	ID               int     `json:"id"`
+	OrganizationID   int     `json:"organization_id"`
+	OrganizationName string  `json:"organization_name"`
+	Status           string  `json:"status"`
+	Method           *string `json:"method"`
+}
+
+// Claim is a claim as admins review it, with what backs it
+type Claim struct {
+	ID               int        `json:"id"`
+	OrganizationID   int        `json:"organization_id"`
+	OrganizationName string     `json:"organization_name"`
+	ImportedFrom     *string    `json:"imported_from"`
+	WebsiteURL       *string    `json:"website_url"`
+	EIN              *string    `json:"ein"`
+	Email            string     `json:"email"`
+	Name             string     `json:"name"`
+	Status           string     `json:"status"`
+	Method           *string    `json:"method"`
+	DocumentName     *string    `json:"document_name"`
+	ReviewNote       *string    `json:"review_note"`
+	ReviewedBy       *int       `json:"reviewed_by"`
+	CreatedAt        time.Time  `json:"created_at"`
+	VerifiedAt       *time.Time `json:"verified_at"`
+	ReviewedAt       *time.Time `json:"reviewed_at"`
+}
+
+// ReviewRequest approves or rejects a claim awaiting review
+type ReviewRequest struct {
+	Approve bool   `json:"approve"`
+	Note    string `json:"note"`
+}
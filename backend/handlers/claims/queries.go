@@ -0,0 +1,137 @@
+package claims
+
+// claimableFilter selects imported providers no claim has been approved for
+const claimableFilter = `
+		u.role = 'provider'
+			AND u.imported_from IS NOT NULL
+			AND u.claimed_at IS NULL
+			AND u.status = 'active'
+			AND u.deactivated_at IS NULL
+			AND u.deleted_at IS NULL
+`
+
+// claimColumns are the columns read by scanClaim
+const claimColumns = `
+		SELECT oc.id, oc.organization_id, COALESCE(p.organization_name, ''),
+			u.imported_from, p.website_url, p.ein,
+			oc.email, oc.name, oc.status, oc.method, oc.document_name,
+			oc.review_note, oc.reviewed_by, oc.created_at, oc.verified_at, oc.reviewed_at
+		FROM organization_claims oc
+		JOIN users u ON u.id = oc.organization_id
+		LEFT JOIN profiles p ON p.user_id = oc.organization_id
+`
+
+const (
+	// SelectClaimableQuery returns the name and website of an organization
+	// that can be claimed
+	SelectClaimableQuery = `
+		SELECT COALESCE(p.organization_name, ''), COALESCE(p.website_url, '')
+		FROM users u
+		LEFT JOIN profiles p ON p.user_id = u.id
+		WHERE u.id = $1 AND` + claimableFilter
+
+	// CountClaimsFromIPQuery counts the claims made from an address since $2
+	CountClaimsFromIPQuery = `
+		SELECT COUNT(*) FROM organization_claims WHERE ip_address = $1 AND created_at > $2
+	`
+
+	// EmailTakenQuery reports whether an account other than the organization's
+	// already signs in with the email
+	EmailTakenQuery = `
+		SELECT EXISTS(SELECT 1 FROM users WHERE LOWER(email) = LOWER($1) AND id <> $2)
+	`
+
+	// InsertClaimQuery stores a new, unverified claim
+	InsertClaimQuery = `
+		INSERT INTO organization_claims (organization_id, email, name, token_hash, ip_address)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`
+
+	// SelectClaimByTokenQuery returns an open claim by the hash of its token,
+	// with the organization's name and website
+	SelectClaimByTokenQuery = `
+		SELECT oc.id, oc.organization_id, COALESCE(p.organization_name, ''), COALESCE(p.website_url, ''),
+			oc.email, oc.status, oc.method, COALESCE(oc.document_path, '')
+		FROM organization_claims oc
+		JOIN users u ON u.id = oc.organization_id
+		LEFT JOIN profiles p ON p.user_id = oc.organization_id
+		WHERE oc.token_hash = $1
+			AND oc.status IN ('unverified', 'awaiting_document', 'pending_review')
+			AND oc.created_at > $2
+			AND` + claimableFilter
+
+	// VerifyClaimQuery records that the claimant followed the emailed link
+	VerifyClaimQuery = `
+		UPDATE organization_claims
+		SET status = $2, method = $3, verified_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND status = 'unverified'
+	`
+
+	// AttachDocumentQuery stores the EIN document of a verified claim and puts
+	// the claim up for review
+	AttachDocumentQuery = `
+		UPDATE organization_claims
+		SET status = 'pending_review', method = 'ein_document',
+			document_name = $2, document_type = $3, document_path = $4
+		WHERE id = $1 AND status IN ('awaiting_document', 'pending_review')
+	`
+
+	// SelectClaimsQuery lists the claims with a status, oldest first
+	SelectClaimsQuery = claimColumns + `
+		WHERE oc.status = $1
+		ORDER BY oc.created_at
+	`
+
+	// SelectClaimQuery fetches one claim
+	SelectClaimQuery = claimColumns + `
+		WHERE oc.id = $1
+	`
+
+	// SelectClaimDocumentQuery returns a claim's EIN document
+	SelectClaimDocumentQuery = `
+		SELECT document_name, document_type, document_path, verified_at
+		FROM organization_claims
+		WHERE id = $1 AND document_path IS NOT NULL
+	`
+
+	// LockClaimForReviewQuery locks a claim awaiting review and returns what
+	// approving it changes
+	LockClaimForReviewQuery = `
+		SELECT organization_id, email, name
+		FROM organization_claims
+		WHERE id = $1 AND status = 'pending_review'
+		FOR UPDATE
+	`
+
+	// LockClaimableQuery locks an organization that can still be claimed
+	LockClaimableQuery = `
+		SELECT u.id FROM users u WHERE u.id = $1 AND` + claimableFilter + `
+		FOR UPDATE
+	`
+
+	// TransferAccountQuery hands the organization's account to the claimant,
+	// who signs in with their email once they set a password
+	TransferAccountQuery = `
+		UPDATE users
+		SET email = $2, claimed_at = CURRENT_TIMESTAMP, password_reset_required = false
+		WHERE id = $1
+	`
+
+	// ReviewClaimQuery approves or rejects a claim
+	ReviewClaimQuery = `
+		UPDATE organization_claims
+		SET status = $2, review_note = NULLIF($3, ''), reviewed_by = $4, reviewed_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`
+
+	// RejectOtherClaimsQuery closes the organization's other open claims once
+	// one is approved, returning their claimants
+	RejectOtherClaimsQuery = `
+		UPDATE organization_claims
+		SET status = 'rejected', review_note = $3, reviewed_by = $4, reviewed_at = CURRENT_TIMESTAMP
+		WHERE organization_id = $1 AND id <> $2
+			AND status IN ('unverified', 'awaiting_document', 'pending_review')
+		RETURNING email
+	`
+)
@@ -0,0 +1,291 @@
+package claims
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"matcherator/backend/handlers/auth"
+	"matcherator/backend/handlers/httputil"
+	"matcherator/backend/services/fieldcrypt"
+	"matcherator/backend/services/mail"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// resetValidity is how long an approved claimant has to set the password
+	// of the organization's account
+	resetValidity = 7 * 24 * time.Hour
+	maxNoteLen    = 1000
+)
+
+// ListClaimsHandler lists claims with a status, by default those awaiting
+// review, oldest first
+// Used by: /api/admin/claims
+// Response: []Claim
+func ListClaimsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		status := r.URL.Query().Get("status")
+		if status == "" {
+			status = StatusPendingReview
+		}
+
+		rows, err := db.Query(SelectClaimsQuery, status)
+		if err != nil {
+			log.Printf("Error querying claims: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		claims := []Claim{}
+		for rows.Next() {
+			claim, err := scanClaim(rows)
+			if err != nil {
+				log.Printf("Error scanning claim: %v", err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+			claims = append(claims, *claim)
+		}
+
+		if err = rows.Err(); err != nil {
+			log.Printf("Error iterating claims: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(claims)
+	}
+}
+
+// DownloadDocumentHandler serves the EIN document of a claim
+// Used by: /api/admin/claims/{id}/document
+// Response: the file, as an attachment
+func DownloadDocumentHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claimID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid claim ID", http.StatusBadRequest)
+			return
+		}
+
+		var name, contentType, path string
+		var verifiedAt time.Time
+		err = db.QueryRow(SelectClaimDocumentQuery, claimID).Scan(&name, &contentType, &path, &verifiedAt)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Document not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error loading document of claim %d: %v", claimID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			log.Printf("Error opening document %s: %v", path, err)
+			http.Error(w, "Document not found", http.StatusNotFound)
+			return
+		}
+		defer file.Close()
+
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Cache-Control", "private, no-store")
+		http.ServeContent(w, r, "", verifiedAt, file)
+	}
+}
+
+// ReviewClaimHandler approves or rejects a claim awaiting review. Approving
+// hands the organization's account, with its profile and matches, to the
+// claimant: their email becomes its login, existing sessions end, and they
+// are emailed a link to set its password. The organization's other open
+// claims are rejected.
+// Used by: /api/admin/claims/{id}/review
+// Response: Claim
+func ReviewClaimHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		adminID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		claimID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid claim ID", http.StatusBadRequest)
+			return
+		}
+
+		var req ReviewRequest
+		if !httputil.DecodeJSON(w, r, &req) {
+			return
+		}
+		req.Note = strings.TrimSpace(req.Note)
+		if utf8.RuneCountInString(req.Note) > maxNoteLen {
+			http.Error(w, fmt.Sprintf("Note must be at most %d characters", maxNoteLen), http.StatusBadRequest)
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		var organizationID int
+		var email, name string
+		err = tx.QueryRow(LockClaimForReviewQuery, claimID).Scan(&organizationID, &email, &name)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Claim awaiting review not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error loading claim %d: %v", claimID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		status := StatusRejected
+		var reset auth.PasswordResetResponse
+		var others []string
+		if req.Approve {
+			status = StatusApproved
+
+			var locked int
+			err = tx.QueryRow(LockClaimableQuery, organizationID).Scan(&locked)
+			if err == sql.ErrNoRows {
+				http.Error(w, "The organization was already claimed or is no longer active", http.StatusConflict)
+				return
+			} else if err != nil {
+				log.Printf("Error locking organization %d: %v", organizationID, err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+
+			var taken bool
+			if err := tx.QueryRow(EmailTakenQuery, email, organizationID).Scan(&taken); err != nil {
+				log.Printf("Error checking claim email: %v", err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+			if taken {
+				http.Error(w, "The claimant's email has an account of its own since the claim was made", http.StatusConflict)
+				return
+			}
+
+			if _, err := tx.Exec(TransferAccountQuery, organizationID, email); err != nil {
+				log.Printf("Error transferring organization %d: %v", organizationID, err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+			if _, err := tx.Exec(`DELETE FROM tokens WHERE user_id = $1`, organizationID); err != nil {
+				log.Printf("Error revoking tokens: %v", err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+			reset, err = auth.IssuePasswordReset(tx, organizationID, resetValidity)
+			if err != nil {
+				log.Printf("Error storing password reset for organization %d: %v", organizationID, err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+
+			rows, err := tx.Query(RejectOtherClaimsQuery, organizationID, claimID, "Another claim on the organization was approved", adminID)
+			if err != nil {
+				log.Printf("Error closing other claims of organization %d: %v", organizationID, err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+			for rows.Next() {
+				var other string
+				if err := rows.Scan(&other); err == nil {
+					others = append(others, other)
+				}
+			}
+			rows.Close()
+		}
+
+		if _, err := tx.Exec(ReviewClaimQuery, claimID, status, req.Note, adminID); err != nil {
+			log.Printf("Error reviewing claim %d: %v", claimID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		claim, err := scanClaim(db.QueryRow(SelectClaimQuery, claimID))
+		if err != nil {
+			log.Printf("Error loading claim %d: %v", claimID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		if req.Approve {
+			log.Printf("Claim %d approved; organization %d transferred to its claimant", claimID, organizationID)
+			link := strings.TrimRight(os.Getenv("FRONTEND_URL"), "/") + "/reset-password#token=" + reset.ResetToken
+			body := fmt.Sprintf(`Hi %s,
+
+Your claim of %s on Grant Matcherator was approved. The account, with its profile and matches, is now yours and signs in with this address. Set its password within %d days:
+%s
+`, name, claim.OrganizationName, int(resetValidity.Hours()/24), link)
+			sendMail(db, claimID, email, "Your claim of "+claim.OrganizationName+" was approved", body)
+
+			for _, other := range others {
+				sendMail(db, claimID, other, "Your claim of "+claim.OrganizationName+" was not approved",
+					"Another claim of "+claim.OrganizationName+" on Grant Matcherator was approved, so yours was closed. If you think this is a mistake, contact support.\n")
+			}
+		} else {
+			body := fmt.Sprintf("Hi %s,\n\nYour claim of %s on Grant Matcherator was not approved.\n", name, claim.OrganizationName)
+			if req.Note != "" {
+				body += "\n" + req.Note + "\n"
+			}
+			sendMail(db, claimID, email, "Your claim of "+claim.OrganizationName+" was not approved", body)
+		}
+
+		json.NewEncoder(w).Encode(claim)
+	}
+}
+
+// sendMail emails a claimant about the review of a claim
+func sendMail(db *sql.DB, claimID int, to, subject, body string) {
+	if err := mail.Enqueue(db, to, subject, body); err != nil && err != mail.ErrNotConfigured {
+		// Don't return error here as the claim was still reviewed successfully
+		log.Printf("Error queueing review email of claim %d: %v", claimID, err)
+	}
+}
+
+// scanClaim reads a row of claimColumns, decrypting the organization's EIN
+func scanClaim(row interface{ Scan(...interface{}) error }) (*Claim, error) {
+	var c Claim
+	err := row.Scan(
+		&c.ID, &c.OrganizationID, &c.OrganizationName,
+		&c.ImportedFrom, &c.WebsiteURL, &c.EIN,
+		&c.Email, &c.Name, &c.Status, &c.Method, &c.DocumentName,
+		&c.ReviewNote, &c.ReviewedBy, &c.CreatedAt, &c.VerifiedAt, &c.ReviewedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if c.EIN, err = fieldcrypt.DecryptPtr(c.EIN); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
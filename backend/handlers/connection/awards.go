@@ -0,0 +1,102 @@
+package connection
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"matcherator/backend/handlers/auth"
+	"matcherator/backend/handlers/httputil"
+	"matcherator/backend/services/matches"
+)
+
+// AwardRange is the award size range a recipient accepts, or a provider
+// typically awards. Either bound may be null for "no limit".
+type AwardRange struct {
+	AwardMin *float64 `json:"award_min"`
+	AwardMax *float64 `json:"award_max"`
+}
+
+// GetAwardRangeHandler returns the user's award size range
+// Used by: /api/me/award-range
+// Response: AwardRange
+func GetAwardRangeHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var awardRange AwardRange
+		err = db.QueryRow(SelectAwardRangeQuery, userID).Scan(&awardRange.AwardMin, &awardRange.AwardMax)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Provider or recipient data not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error loading award range for user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(awardRange)
+	}
+}
+
+// UpdateAwardRangeHandler sets the user's award size range and updates the
+// stored matches involving them
+// Used by: /api/me/award-range
+// Response: AwardRange
+func UpdateAwardRangeHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req AwardRange
+		if !httputil.DecodeJSON(w, r, &req) {
+			return
+		}
+		if (req.AwardMin != nil && *req.AwardMin < 0) || (req.AwardMax != nil && *req.AwardMax < 0) {
+			http.Error(w, "Award sizes cannot be negative", http.StatusBadRequest)
+			return
+		}
+		if req.AwardMin != nil && req.AwardMax != nil && *req.AwardMin > *req.AwardMax {
+			http.Error(w, "award_min cannot exceed award_max", http.StatusBadRequest)
+			return
+		}
+
+		before, err := matches.LoadMatchProfile(db, int64(userID))
+		if err != nil {
+			log.Printf("Error loading match profile for user %d: %v", userID, err)
+			before = nil
+		}
+
+		var awardRange AwardRange
+		err = db.QueryRow(UpdateAwardRangeQuery, userID, req.AwardMin, req.AwardMax).Scan(&awardRange.AwardMin, &awardRange.AwardMax)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Provider or recipient data not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error updating award range for user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		if before != nil {
+			if _, err := matches.QueueUpdateIfChanged(db, before); err != nil {
+				log.Printf("Error queueing match update for user %d: %v", userID, err)
+				// Don't return error here as the range was still updated successfully
+			}
+		}
+
+		json.NewEncoder(w).Encode(awardRange)
+	}
+}
@@ -0,0 +1,97 @@
+package connection
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"matcherator/backend/handlers/auth"
+	"matcherator/backend/handlers/httputil"
+	"matcherator/backend/services/entitlements"
+	"matcherator/backend/services/matches"
+)
+
+// CompareRequest lists the matches to compare side by side
+type CompareRequest struct {
+	MatchIDs []int64 `json:"match_ids"`
+}
+
+// CompareMatchesHandler compares two to matches.MaxCompared of the user's
+// visible matches: scores per dimension, amounts, deadlines, location and
+// eligibility, one row per attribute.
+// Used by: /api/matches/compare
+// Response: matches.Comparison
+func CompareMatchesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req CompareRequest
+		if !httputil.DecodeJSON(w, r, &req) {
+			return
+		}
+		ids := make([]int64, 0, len(req.MatchIDs))
+		seen := make(map[int64]bool)
+		for _, id := range req.MatchIDs {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+		if len(ids) < 2 || len(ids) > matches.MaxCompared {
+			http.Error(w, fmt.Sprintf("Compare between 2 and %d matches", matches.MaxCompared), http.StatusBadRequest)
+			return
+		}
+
+		stored, err := matches.GetStoredMatches(db, int64(userID), "")
+		if err != nil {
+			log.Printf("Error fetching matches to compare: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		// Only matches the plan shows can be compared
+		plan, err := entitlements.ForUser(db, userID)
+		if err != nil {
+			log.Printf("Error loading entitlements: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if visible := plan.Limit(entitlements.QuotaVisibleMatches); visible != entitlements.Unlimited && len(stored) > visible {
+			stored = stored[:visible]
+		}
+
+		// A dual-role user may hold a match in both roles; the better one is compared
+		compared := make([]matches.Match, 0, len(ids))
+		for _, id := range ids {
+			found := false
+			for _, match := range stored {
+				if match.ID == id {
+					compared = append(compared, match)
+					found = true
+					break
+				}
+			}
+			if !found {
+				http.Error(w, fmt.Sprintf("Match %d not found", id), http.StatusNotFound)
+				return
+			}
+		}
+
+		comparison, err := matches.Compare(db, int64(userID), compared)
+		if err != nil {
+			log.Printf("Error comparing matches for user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(comparison)
+	}
+}
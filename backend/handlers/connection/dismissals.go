@@ -0,0 +1,311 @@
+package connection
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+
+	"matcherator/backend/handlers/auth"
+	"matcherator/backend/handlers/httputil"
+	"matcherator/backend/services/matches"
+)
+
+// Reasons a user can give for dismissing a match
+const (
+	DismissReasonSector     = "wrong_sector"
+	DismissReasonGeography  = "wrong_geography"
+	DismissReasonAwardSize  = "award_size_mismatch"
+	DismissReasonIneligible = "not_eligible"
+	DismissReasonInactive   = "inactive_profile"
+	DismissReasonKnown      = "already_known"
+	DismissReasonOther      = "other"
+)
+
+// DismissReasons lists the accepted dismissal reason codes
+var DismissReasons = []string{
+	DismissReasonSector, DismissReasonGeography, DismissReasonAwardSize,
+	DismissReasonIneligible, DismissReasonInactive, DismissReasonKnown, DismissReasonOther,
+}
+
+const (
+	maxDismissCommentLen = 500
+
+	// dismissalScoreBand is the width of the score bands dismissals are
+	// grouped into
+	dismissalScoreBand = 10
+
+	// defaultDismissalWindow is how far back the analytics look without ?since=
+	defaultDismissalWindow = 90 * 24 * time.Hour
+)
+
+// DismissRequest optionally says why a match was dismissed
+type DismissRequest struct {
+	Reason  string `json:"reason"`
+	Comment string `json:"comment"`
+}
+
+// validate trims the comment and checks the reason code
+func (req *DismissRequest) validate() error {
+	req.Reason = strings.TrimSpace(req.Reason)
+	req.Comment = strings.TrimSpace(req.Comment)
+
+	if req.Reason != "" {
+		known := false
+		for _, reason := range DismissReasons {
+			if req.Reason == reason {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("Reason must be one of: %s", strings.Join(DismissReasons, ", "))
+		}
+	}
+	if utf8.RuneCountInString(req.Comment) > maxDismissCommentLen {
+		return fmt.Errorf("Comment must be at most %d characters", maxDismissCommentLen)
+	}
+	return nil
+}
+
+// DismissalReasonCount is how often a reason was given
+type DismissalReasonCount struct {
+	Reason   string   `json:"reason"`
+	Count    int      `json:"count"`
+	AvgScore *float64 `json:"avg_score"`
+}
+
+// DismissalBreakdown counts dismissals with one reason, for one sector of
+// the dismissed profile, within one score band
+type DismissalBreakdown struct {
+	Reason    string `json:"reason"`
+	Sector    string `json:"sector"`
+	ScoreBand string `json:"score_band"`
+	Count     int    `json:"count"`
+}
+
+// DismissalAnalytics summarizes why users dismiss their matches
+type DismissalAnalytics struct {
+	Since     time.Time              `json:"since"`
+	Role      string                 `json:"role,omitempty"`
+	Total     int                    `json:"total"`
+	ByReason  []DismissalReasonCount `json:"by_reason"`
+	Breakdown []DismissalBreakdown   `json:"breakdown"`
+}
+
+// DismissalAnalyticsHandler summarizes dismissal reasons per sector and score
+// band so the matching weights can be tuned. A dismissed profile with several
+// sectors counts once under each of them in the breakdown.
+// Used by: /api/admin/matching/dismissals?since=YYYY-MM-DD&role=
+// Response: DismissalAnalytics
+func DismissalAnalyticsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		role := r.URL.Query().Get("role")
+		if role != "" && role != "provider" && role != "recipient" {
+			http.Error(w, "role must be provider or recipient", http.StatusBadRequest)
+			return
+		}
+
+		since := time.Now().UTC().Add(-defaultDismissalWindow).Truncate(24 * time.Hour)
+		if value := r.URL.Query().Get("since"); value != "" {
+			parsed, err := time.Parse("2006-01-02", value)
+			if err != nil {
+				http.Error(w, "since must be a date (YYYY-MM-DD)", http.StatusBadRequest)
+				return
+			}
+			since = parsed
+		}
+
+		response := DismissalAnalytics{
+			Since:     since,
+			Role:      role,
+			ByReason:  []DismissalReasonCount{},
+			Breakdown: []DismissalBreakdown{},
+		}
+
+		rows, err := db.Query(SelectDismissalReasonsQuery, since, role)
+		if err != nil {
+			log.Printf("Error querying dismissal reasons: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var count DismissalReasonCount
+			var avg sql.NullFloat64
+			if err := rows.Scan(&count.Reason, &count.Count, &avg); err != nil {
+				log.Printf("Error scanning dismissal reasons: %v", err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+			if avg.Valid {
+				count.AvgScore = &avg.Float64
+			}
+			response.Total += count.Count
+			response.ByReason = append(response.ByReason, count)
+		}
+		if err := rows.Err(); err != nil {
+			log.Printf("Error iterating dismissal reasons: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		rows.Close()
+
+		rows, err = db.Query(SelectDismissalBreakdownQuery, since, role, dismissalScoreBand)
+		if err != nil {
+			log.Printf("Error querying dismissal breakdown: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var item DismissalBreakdown
+			var band sql.NullInt64
+			if err := rows.Scan(&item.Reason, &item.Sector, &band, &item.Count); err != nil {
+				log.Printf("Error scanning dismissal breakdown: %v", err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+			item.ScoreBand = "unknown"
+			if band.Valid {
+				low := int(band.Int64) * dismissalScoreBand
+				item.ScoreBand = fmt.Sprintf("%d-%d", low, low+dismissalScoreBand-1)
+			}
+			response.Breakdown = append(response.Breakdown, item)
+		}
+		if err := rows.Err(); err != nil {
+			log.Printf("Error iterating dismissal breakdown: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// GetDismissedMatchesHandler lists the matches the user dismissed, most
+// recently dismissed first, so they can be reviewed and restored
+// Used by: /api/matches/dismissed?limit=&offset=
+// Response: DismissedMatchesResponse
+func GetDismissedMatchesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		limit, offset, ok := httputil.ParsePage(w, r, defaultListPageSize, maxListPageSize)
+		if !ok {
+			return
+		}
+
+		response := DismissedMatchesResponse{Dismissed: []DismissedMatch{}, Limit: limit, Offset: offset}
+		if err := db.QueryRow(CountDismissedMatchesQuery, userID).Scan(&response.Total); err != nil {
+			log.Printf("Error counting dismissed matches: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		rows, err := db.Query(SelectDismissedMatchesQuery, userID, limit, offset)
+		if err != nil {
+			log.Printf("Error querying dismissed matches: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var match DismissedMatch
+			err := rows.Scan(&match.MatchID, &match.OrganizationName, &match.ProfilePictureURL,
+				&match.Reason, &match.Comment, &match.DismissedAt)
+			if err != nil {
+				log.Printf("Error scanning dismissed match: %v", err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+			response.Dismissed = append(response.Dismissed, match)
+		}
+		if err := rows.Err(); err != nil {
+			log.Printf("Error iterating dismissed matches: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// RestoreMatchHandler undoes a dismissal. The match is suggested again from
+// the next recalculation of the user's matches, which is queued right away
+// unless the user's recalculation cooldown is still running.
+// Used by: /api/matches/dismiss/{id}/restore
+// Response: 202 RecalculateQueuedResponse, or 204 No Content within the cooldown
+func RestoreMatchHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		targetID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid target ID", http.StatusBadRequest)
+			return
+		}
+
+		var role string
+		err = db.QueryRow(DeleteDismissalQuery, userID, targetID).Scan(&role)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Dismissed match not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error removing dismissal: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		// Restores count against the same cooldown as requested recalculations
+		wait, err := matches.ClaimRecalculation(db, int64(userID))
+		if err != nil {
+			log.Printf("Error claiming match recalculation for user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		jobID, err := matches.QueueRecalculation(db, int64(userID), role)
+		if err != nil {
+			log.Printf("Error queueing match recalculation for user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(RecalculateQueuedResponse{
+			Message: "Match restored; matches are being recalculated",
+			JobID:   jobID,
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package connection
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+
+	"matcherator/backend/handlers/auth"
+	"matcherator/backend/services/matches"
+)
+
+func TestDismissRequestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     DismissRequest
+		want    DismissRequest
+		wantErr bool
+	}{
+		{"no reason", DismissRequest{}, DismissRequest{}, false},
+		{"known reason", DismissRequest{Reason: DismissReasonSector}, DismissRequest{Reason: DismissReasonSector}, false},
+		{"trimmed", DismissRequest{Reason: " other ", Comment: " too far \n"}, DismissRequest{Reason: DismissReasonOther, Comment: "too far"}, false},
+		{"unknown reason", DismissRequest{Reason: "boring"}, DismissRequest{}, true},
+		{"comment at the limit", DismissRequest{Comment: strings.Repeat("é", maxDismissCommentLen)}, DismissRequest{Comment: strings.Repeat("é", maxDismissCommentLen)}, false},
+		{"comment too long", DismissRequest{Comment: strings.Repeat("a", maxDismissCommentLen+1)}, DismissRequest{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := tt.req
+			err := req.validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && req != tt.want {
+				t.Errorf("validate() left %+v, want %+v", req, tt.want)
+			}
+		})
+	}
+}
+
+func TestDismissMatchRecordsReasonAndScore(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", "test-secret")
+	token, err := auth.GenerateToken(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS dismissed_matches`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(DeleteStoredMatchQuery)).WithArgs(7, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"match_score"}).AddRow(62.5))
+	mock.ExpectExec(regexp.QuoteMeta(InsertDismissalQuery)).WithArgs(7, 2, DismissReasonSector, "Not our focus", 62.5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	r := httptest.NewRequest(http.MethodDelete, "/api/matches/dismiss/2", strings.NewReader(`{"reason":" wrong_sector ","comment":"Not our focus "}`))
+	r = mux.SetURLVars(r, map[string]string{"id": "2"})
+	r.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	DismissMatchHandler(db)(w, r)
+
+	if w.Code != http.StatusNoContent {
+		t.Errorf("status = %d, want %d: %s", w.Code, http.StatusNoContent, w.Body)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDismissalAnalytics(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	since := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(regexp.QuoteMeta(SelectDismissalReasonsQuery)).WithArgs(since, "recipient").
+		WillReturnRows(sqlmock.NewRows([]string{"reason", "count", "avg"}).
+			AddRow(DismissReasonSector, 3, 41.5).
+			AddRow("unspecified", 1, nil))
+	mock.ExpectQuery(regexp.QuoteMeta(SelectDismissalBreakdownQuery)).WithArgs(since, "recipient", dismissalScoreBand).
+		WillReturnRows(sqlmock.NewRows([]string{"reason", "sector", "band", "count"}).
+			AddRow(DismissReasonSector, "Health", 4, 3).
+			AddRow("unspecified", "unspecified", nil, 1))
+
+	r := httptest.NewRequest(http.MethodGet, "/api/admin/matching/dismissals?since=2024-03-01&role=recipient", nil)
+	w := httptest.NewRecorder()
+	DismissalAnalyticsHandler(db)(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+
+	var got DismissalAnalytics
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Total != 4 || len(got.ByReason) != 2 || got.ByReason[1].AvgScore != nil {
+		t.Errorf("by reason = %+v, total %d; want 4 dismissals, no average without scores", got.ByReason, got.Total)
+	}
+	if len(got.Breakdown) != 2 || got.Breakdown[0].ScoreBand != "40-49" || got.Breakdown[1].ScoreBand != "unknown" {
+		t.Errorf("breakdown = %+v, want score bands 40-49 and unknown", got.Breakdown)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+
+	for _, query := range []string{"role=admin", "since=last-week"} {
+		w := httptest.NewRecorder()
+		DismissalAnalyticsHandler(db)(w, httptest.NewRequest(http.MethodGet, "/api/admin/matching/dismissals?"+query, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want %d", query, w.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestGetDismissedMatches(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", "test-secret")
+	token, err := auth.GenerateToken(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	dismissed := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(regexp.QuoteMeta(CountDismissedMatchesQuery)).WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery(regexp.QuoteMeta(SelectDismissedMatchesQuery)).WithArgs(7, 1, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"match_id", "organization_name", "profile_picture_url", "reason", "comment", "dismissed_at"}).
+			AddRow(4, "Riverside Trust", nil, nil, nil, dismissed))
+
+	r := httptest.NewRequest(http.MethodGet, "/api/matches/dismissed?limit=1&offset=2", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	GetDismissedMatchesHandler(db)(w, r)
+
+	want := `{"dismissed":[{"match_id":4,"organization_name":"Riverside Trust","profile_picture_url":null,"reason":null,"comment":null,"dismissed_at":"2024-05-01T12:00:00Z"}],"total":3,"limit":1,"offset":2}`
+	if got := strings.TrimSpace(w.Body.String()); w.Code != http.StatusOK || got != want {
+		t.Errorf("status %d, body\n%s\nwant\n%s", w.Code, got, want)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRestoreMatch(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", "test-secret")
+	token, err := auth.GenerateToken(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claimQuery := `WITH claimed AS \(\s+UPDATE users SET match_recalc_requested_at`
+
+	tests := []struct {
+		name           string
+		expect         func(mock sqlmock.Sqlmock)
+		wantStatus     int
+		wantRetryAfter string
+		wantBody       string
+	}{
+		{
+			name: "queues a recalculation",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta(DeleteDismissalQuery)).WithArgs(7, 2).
+					WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow("recipient"))
+				mock.ExpectQuery(claimQuery).WithArgs(int64(7), sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows([]string{"claimed", "wait"}).AddRow(true, 0))
+				mock.ExpectQuery(`FROM jobs\s+WHERE kind = ANY\(\$1\) AND status IN`).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectQuery(`INSERT INTO jobs`).WithArgs(matches.RecalculateJob, sqlmock.AnyArg(), sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(21))
+			},
+			wantStatus: http.StatusAccepted,
+			wantBody:   `{"message":"Match restored; matches are being recalculated","job_id":21}`,
+		},
+		{
+			name: "within the recalculation cooldown",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta(DeleteDismissalQuery)).WithArgs(7, 2).
+					WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow("recipient"))
+				mock.ExpectQuery(claimQuery).
+					WillReturnRows(sqlmock.NewRows([]string{"claimed", "wait"}).AddRow(false, 90.2))
+			},
+			wantStatus:     http.StatusNoContent,
+			wantRetryAfter: "91",
+		},
+		{
+			name: "not dismissed",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta(DeleteDismissalQuery)).WithArgs(7, 2).
+					WillReturnRows(sqlmock.NewRows([]string{"role"}))
+			},
+			wantStatus: http.StatusNotFound,
+			wantBody:   "Dismissed match not found",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			tt.expect(mock)
+
+			r := httptest.NewRequest(http.MethodPost, "/api/matches/dismiss/2/restore", nil)
+			r = mux.SetURLVars(r, map[string]string{"id": "2"})
+			r.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			RestoreMatchHandler(db)(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if got := w.Header().Get("Retry-After"); got != tt.wantRetryAfter {
+				t.Errorf("Retry-After = %q, want %q", got, tt.wantRetryAfter)
+			}
+			if got := strings.TrimSpace(w.Body.String()); got != tt.wantBody {
+				t.Errorf("body = %s, want %s", got, tt.wantBody)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package connection
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"matcherator/backend/handlers/auth"
+	"matcherator/backend/handlers/httputil"
+	"matcherator/backend/services/matches"
+)
+
+// EligibilityBands are the recipient sizes and ages a provider funds. Null
+// bounds are open.
+type EligibilityBands struct {
+	BudgetMin   *float64 `json:"budget_min"`
+	BudgetMax   *float64 `json:"budget_max"`
+	StaffMin    *int     `json:"staff_min"`
+	StaffMax    *int     `json:"staff_max"`
+	MinAgeYears *int     `json:"min_age_years"`
+	MaxAgeYears *int     `json:"max_age_years"`
+}
+
+// GetEligibilityHandler returns the provider's eligibility bands
+// Used by: /api/me/eligibility
+// Response: EligibilityBands
+func GetEligibilityHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var bands EligibilityBands
+		err = db.QueryRow(SelectEligibilityQuery, userID).Scan(
+			&bands.BudgetMin, &bands.BudgetMax,
+			&bands.StaffMin, &bands.StaffMax,
+			&bands.MinAgeYears, &bands.MaxAgeYears,
+		)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Only providers have eligibility bands", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error loading eligibility bands for user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(bands)
+	}
+}
+
+// UpdateEligibilityHandler replaces the provider's eligibility bands and updates
+// the stored matches involving them
+// Used by: /api/me/eligibility
+// Response: EligibilityBands
+func UpdateEligibilityHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req EligibilityBands
+		if !httputil.DecodeJSON(w, r, &req) {
+			return
+		}
+		if msg := validateBands(req); msg != "" {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+
+		before, err := matches.LoadMatchProfile(db, int64(userID))
+		if err != nil {
+			log.Printf("Error loading match profile for user %d: %v", userID, err)
+			before = nil
+		}
+
+		var bands EligibilityBands
+		err = db.QueryRow(UpdateEligibilityQuery, userID,
+			req.BudgetMin, req.BudgetMax,
+			req.StaffMin, req.StaffMax,
+			req.MinAgeYears, req.MaxAgeYears,
+		).Scan(
+			&bands.BudgetMin, &bands.BudgetMax,
+			&bands.StaffMin, &bands.StaffMax,
+			&bands.MinAgeYears, &bands.MaxAgeYears,
+		)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Only providers have eligibility bands", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error updating eligibility bands for user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		if before != nil {
+			if _, err := matches.QueueUpdateIfChanged(db, before); err != nil {
+				log.Printf("Error queueing match update for user %d: %v", userID, err)
+				// Don't return error here as the bands were still updated successfully
+			}
+		}
+
+		json.NewEncoder(w).Encode(bands)
+	}
+}
+
+// validateBands returns a message describing the first invalid band, or ""
+func validateBands(b EligibilityBands) string {
+	if (b.BudgetMin != nil && *b.BudgetMin < 0) || (b.BudgetMax != nil && *b.BudgetMax < 0) {
+		return "Budget bounds cannot be negative"
+	}
+	if b.BudgetMin != nil && b.BudgetMax != nil && *b.BudgetMin > *b.BudgetMax {
+		return "budget_min cannot exceed budget_max"
+	}
+	for _, band := range []struct {
+		name     string
+		min, max *int
+	}{
+		{"staff", b.StaffMin, b.StaffMax},
+		{"age", b.MinAgeYears, b.MaxAgeYears},
+	} {
+		if (band.min != nil && *band.min < 0) || (band.max != nil && *band.max < 0) {
+			return "The " + band.name + " bounds cannot be negative"
+		}
+		if band.min != nil && band.max != nil && *band.min > *band.max {
+			return "The " + band.name + " minimum cannot exceed its maximum"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,108 @@
+package connection
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"matcherator/backend/handlers/auth"
+	"matcherator/backend/handlers/plans"
+	"matcherator/backend/services/entitlements"
+)
+
+// exportRow is one connection in an export
+type exportRow struct {
+	userID         int
+	name           string
+	email          string
+	role           string
+	connectionType string
+	createdAt      time.Time
+	fundedAt       *time.Time
+}
+
+// ExportConnectionsHandler downloads the user's connections as CSV. Each
+// export counts against the plan's monthly exports.
+// Used by: /api/me/exports/connections
+// Response: text/csv
+func ExportConnectionsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		rows, err := db.Query(ExportConnectionsQuery, userID)
+		if err != nil {
+			log.Printf("Error querying connections to export for user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		var export []exportRow
+		for rows.Next() {
+			var row exportRow
+			if err := rows.Scan(&row.userID, &row.name, &row.email, &row.role, &row.connectionType, &row.createdAt, &row.fundedAt); err != nil {
+				log.Printf("Error scanning connection to export: %v", err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+			export = append(export, row)
+		}
+		if err := rows.Err(); err != nil {
+			log.Printf("Error iterating connections to export: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		// Only count exports that are actually delivered
+		if err := entitlements.Consume(db, userID, entitlements.QuotaMonthlyExports); err == entitlements.ErrQuotaExceeded {
+			plans.QuotaExceeded(w, "You have used this month's exports")
+			return
+		} else if err != nil {
+			log.Printf("Error recording export for user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "connections-"+time.Now().UTC().Format("2006-01-02")+".csv"))
+		w.Header().Set("Cache-Control", "private, no-store")
+
+		out := csv.NewWriter(w)
+		out.Write([]string{"user_id", "organization_name", "email", "role", "connection_type", "connected_at", "funded_at"})
+		for _, row := range export {
+			fundedAt := ""
+			if row.fundedAt != nil {
+				fundedAt = row.fundedAt.UTC().Format(time.RFC3339)
+			}
+			out.Write([]string{
+				strconv.Itoa(row.userID),
+				csvSafe(row.name),
+				csvSafe(row.email),
+				row.role,
+				row.connectionType,
+				row.createdAt.UTC().Format(time.RFC3339),
+				fundedAt,
+			})
+		}
+		out.Flush()
+		if err := out.Error(); err != nil {
+			log.Printf("Error writing connections export: %v", err)
+		}
+	}
+}
+
+// csvSafe keeps user-entered text from being read as a formula by spreadsheets
+func csvSafe(value string) string {
+	if value != "" && (value[0] == '=' || value[0] == '+' || value[0] == '-' || value[0] == '@') {
+		return "'" + value
+	}
+	return value
+}
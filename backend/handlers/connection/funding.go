@@ -0,0 +1,107 @@
+package connection
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"matcherator/backend/handlers/auth"
+	"matcherator/backend/handlers/notifications"
+
+	"github.com/gorilla/mux"
+)
+
+// NotificationFunded is sent to the recipient when a connection is marked funded
+const NotificationFunded = "connection_funded"
+
+// MarkFundedHandler lets the provider of a connection record that they funded
+// the recipient. Marking an already funded connection keeps the original date.
+// Used by: /api/connections/{id}/funded
+// Response: FundingStatus
+func MarkFundedHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		connectionID, recipientID, fundedAt, ok := providerFunding(w, r, db, userID)
+		if !ok {
+			return
+		}
+
+		if fundedAt == nil {
+			var markedAt time.Time
+			if err := db.QueryRow(MarkFundedQuery, connectionID, userID).Scan(&markedAt); err != nil {
+				log.Printf("Error marking connection %d funded: %v", connectionID, err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+			fundedAt = &markedAt
+			notifications.Notify(db, recipientID, NotificationFunded, "A funder marked your connection as funded. You can now share a success story together.")
+		}
+
+		json.NewEncoder(w).Encode(FundingStatus{ConnectionID: connectionID, Funded: true, FundedAt: fundedAt})
+	}
+}
+
+// UnmarkFundedHandler lets the provider of a connection clear a funded mark
+// set by mistake. Success stories of the connection are no longer shown publicly.
+// Used by: /api/connections/{id}/funded
+// Response: FundingStatus
+func UnmarkFundedHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		connectionID, _, _, ok := providerFunding(w, r, db, userID)
+		if !ok {
+			return
+		}
+
+		if _, err := db.Exec(UnmarkFundedQuery, connectionID); err != nil {
+			log.Printf("Error clearing funded mark of connection %d: %v", connectionID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(FundingStatus{ConnectionID: connectionID})
+	}
+}
+
+// providerFunding loads the funding state of a connection the user is the
+// provider of, writing the error response when there is no such connection
+func providerFunding(w http.ResponseWriter, r *http.Request, db *sql.DB, userID int) (connectionID, recipientID int, fundedAt *time.Time, ok bool) {
+	connectionID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid connection ID", http.StatusBadRequest)
+		return 0, 0, nil, false
+	}
+
+	var providerID int
+	err = db.QueryRow(SelectConnectionFundingQuery, connectionID, userID).Scan(&providerID, &recipientID, &fundedAt)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Connection not found", http.StatusNotFound)
+		return 0, 0, nil, false
+	} else if err != nil {
+		log.Printf("Error loading connection %d: %v", connectionID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return 0, 0, nil, false
+	}
+	if providerID != userID {
+		http.Error(w, "Only the provider can change the funded status", http.StatusForbidden)
+		return 0, 0, nil, false
+	}
+	return connectionID, recipientID, fundedAt, true
+}
@@ -3,18 +3,34 @@ package connection
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"strconv"
 
 	"github.com/gorilla/mux"
 
 	"matcherator/backend/handlers/auth"
+	"matcherator/backend/handlers/httputil"
+	"matcherator/backend/services/crmsync"
+	"matcherator/backend/services/entitlements"
+	"matcherator/backend/services/experiments"
+	"matcherator/backend/services/jobs"
 	"matcherator/backend/services/matches"
+	"matcherator/backend/services/track"
 )
 
-// GetConnectionsHandler returns all connections for the authenticated user
+const (
+	defaultListPageSize = 50
+	maxListPageSize     = 200
+)
+
+// GetConnectionsHandler returns a page of the authenticated user's
+// connections, newest first
+// Used by: /api/connections?limit=&offset=
+// Response: ConnectionsResponse
 func GetConnectionsHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -25,7 +41,19 @@ func GetConnectionsHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		rows, err := db.Query(GetConnectionsQuery, userID)
+		limit, offset, ok := httputil.ParsePage(w, r, defaultListPageSize, maxListPageSize)
+		if !ok {
+			return
+		}
+
+		response := ConnectionsResponse{Connections: []Connection{}, Limit: limit, Offset: offset}
+		if err := db.QueryRow(CountConnectionsQuery, userID).Scan(&response.Total); err != nil {
+			log.Printf("Error counting connections: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		rows, err := db.Query(GetConnectionsQuery, userID, limit, offset)
 		if err != nil {
 			log.Printf("Error querying connections: %v", err)
 			http.Error(w, "Database error", http.StatusInternalServerError)
@@ -33,7 +61,6 @@ func GetConnectionsHandler(db *sql.DB) http.HandlerFunc {
 		}
 		defer rows.Close()
 
-		var connections []Connection
 		for rows.Next() {
 			var conn Connection
 			var otherUserPicture sql.NullString
@@ -46,6 +73,7 @@ func GetConnectionsHandler(db *sql.DB) http.HandlerFunc {
 				&conn.OtherUserName,
 				&otherUserPicture,
 				&conn.ConnectionType,
+				&conn.FundedAt,
 			)
 			if err != nil {
 				log.Printf("Error scanning connection: %v", err)
@@ -58,7 +86,7 @@ func GetConnectionsHandler(db *sql.DB) http.HandlerFunc {
 			} else {
 				conn.ConnectionType = "following"
 			}
-			connections = append(connections, conn)
+			response.Connections = append(response.Connections, conn)
 		}
 
 		if err = rows.Err(); err != nil {
@@ -67,7 +95,7 @@ func GetConnectionsHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		if err := json.NewEncoder(w).Encode(connections); err != nil {
+		if err := json.NewEncoder(w).Encode(response); err != nil {
 			log.Printf("Error encoding response: %v", err)
 			http.Error(w, "Error encoding response", http.StatusInternalServerError)
 			return
@@ -75,7 +103,8 @@ func GetConnectionsHandler(db *sql.DB) http.HandlerFunc {
 	}
 }
 
-// CreateConnectionHandler creates a new connection
+// CreateConnectionHandler creates a connection (201), or returns the existing
+// connection between the two users (200)
 func CreateConnectionHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -87,59 +116,89 @@ func CreateConnectionHandler(db *sql.DB) http.HandlerFunc {
 		}
 
 		var req ConnectionRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			log.Printf("Error decoding request body: %v", err)
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+		if !httputil.DecodeJSON(w, r, &req) {
 			return
 		}
 
-		// Check if connection already exists
-		var exists bool
-		err = db.QueryRow(CheckConnectionExistsQuery, userID, req.TargetID).Scan(&exists)
+		if req.TargetID == userID {
+			http.Error(w, "Cannot connect to yourself", http.StatusBadRequest)
+			return
+		}
+
+		var targetExists bool
+		err = db.QueryRow(CheckUserExistsQuery, req.TargetID).Scan(&targetExists)
 		if err != nil {
-			log.Printf("Error checking if connection exists: %v", err)
+			log.Printf("Error checking connection target: %v", err)
 			http.Error(w, "Database error", http.StatusInternalServerError)
 			return
 		}
-
-		if exists {
-			http.Error(w, "Connection already exists", http.StatusConflict)
+		if !targetExists {
+			http.Error(w, "User not found", http.StatusNotFound)
 			return
 		}
 
-		// Create new connection
+		// Create the connection; the unique index on the user pair makes a
+		// concurrent or repeated request a no-op
 		var conn Connection
 		err = db.QueryRow(CreateConnectionQuery, userID, req.TargetID, "following").Scan(
 			&conn.ID,
 			&conn.CreatedAt,
 			&conn.UpdatedAt,
 		)
-		if err != nil {
+		if err == sql.ErrNoRows {
+			// Already connected, in either direction: return the existing connection
+			err = db.QueryRow(SelectConnectionBetweenQuery, userID, req.TargetID).Scan(
+				&conn.ID,
+				&conn.InitiatorID,
+				&conn.TargetID,
+				&conn.ConnectionType,
+				&conn.CreatedAt,
+				&conn.UpdatedAt,
+			)
+			if err != nil {
+				log.Printf("Error loading existing connection: %v", err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+			if err := json.NewEncoder(w).Encode(conn); err != nil {
+				log.Printf("Error encoding response: %v", err)
+			}
+			return
+		} else if err != nil {
 			log.Printf("Error creating connection: %v", err)
 			http.Error(w, "Failed to create connection", http.StatusInternalServerError)
 			return
 		}
 
-		// Remove the matched user from temp_matches (both directions)
-		_, err = db.Exec("DELETE FROM temp_matches WHERE (user_id = $1 AND match_id = $2) OR (user_id = $2 AND match_id = $1)", userID, req.TargetID)
+		// Remove the pair from the stored matches (both directions)
+		_, err = db.Exec("DELETE FROM matches WHERE (user_id = $1 AND match_id = $2) OR (user_id = $2 AND match_id = $1)", userID, req.TargetID)
 		if err != nil {
-			log.Printf("Error removing match from temp_matches: %v", err)
+			log.Printf("Error removing stored match: %v", err)
 			// Don't return error here as the connection was still created successfully
 		}
 
+		if err := crmsync.SyncConnection(db, userID, req.TargetID, crmsync.StatusConnected); err != nil {
+			log.Printf("Error queueing CRM sync: %v", err)
+			// Don't return error here as the connection was still created successfully
+		}
+
+		track.Event(db, userID, track.FirstConnection, track.Properties{"initiated": true})
+		track.Event(db, req.TargetID, track.FirstConnection, track.Properties{"initiated": false})
+
 		conn.InitiatorID = userID
 		conn.TargetID = req.TargetID
 		conn.ConnectionType = "following"
 
+		w.WriteHeader(http.StatusCreated)
 		if err := json.NewEncoder(w).Encode(conn); err != nil {
 			log.Printf("Error encoding response: %v", err)
-			http.Error(w, "Error encoding response", http.StatusInternalServerError)
-			return
 		}
 	}
 }
 
-// DeleteConnectionHandler handles deleting a connection
+// DeleteConnectionHandler deletes one of the user's connections by connection ID
+// Used by: /api/connections/{id}
+// Response: 204 No Content
 func DeleteConnectionHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -151,49 +210,79 @@ func DeleteConnectionHandler(db *sql.DB) http.HandlerFunc {
 		}
 
 		vars := mux.Vars(r)
-		targetIDStr := vars["id"]
-		targetID, err := strconv.Atoi(targetIDStr)
+		connectionID, err := strconv.Atoi(vars["id"])
 		if err != nil {
-			http.Error(w, "Invalid target ID", http.StatusBadRequest)
+			http.Error(w, "Invalid connection ID", http.StatusBadRequest)
 			return
 		}
 
-		result, err := db.Exec(DeleteConnectionQuery, targetID, userID)
+		deleteConnection(w, db, userID, DeleteConnectionQuery, connectionID, userID)
+	}
+}
+
+// DeleteConnectionWithUserHandler deletes the connection between the user and
+// another user, whichever of them initiated it
+// Used by: /api/connections/with/{userId}
+// Response: 204 No Content
+func DeleteConnectionWithUserHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
 		if err != nil {
-			http.Error(w, "Database error", http.StatusInternalServerError)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
-		rowsAffected, err := result.RowsAffected()
+		vars := mux.Vars(r)
+		otherID, err := strconv.Atoi(vars["userId"])
 		if err != nil {
-			http.Error(w, "Database error", http.StatusInternalServerError)
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
 			return
 		}
 
-		if rowsAffected == 0 {
-			http.Error(w, "Connection not found", http.StatusNotFound)
-			return
-		}
+		deleteConnection(w, db, userID, DeleteConnectionWithUserQuery, userID, otherID)
+	}
+}
 
-		// Get user's role and recalculate matches
-		var role string
-		err = db.QueryRow("SELECT role FROM users WHERE id = $1", userID).Scan(&role)
-		if err != nil {
-			log.Printf("Error getting user role: %v", err)
-			// Don't return error here as the connection was still deleted successfully
-		} else {
-			err = matches.CalculateAndStoreMatches(db, int64(userID), role)
-			if err != nil {
-				log.Printf("Error recalculating matches: %v", err)
-				// Don't return error here as the connection was still deleted successfully
-			}
-		}
+// deleteConnection runs a delete query returning the removed connection's two
+// sides, then syncs the CRM and recalculates the user's matches
+func deleteConnection(w http.ResponseWriter, db *sql.DB, userID int, query string, args ...interface{}) {
+	var initiatorID, connectedID int
+	err := db.QueryRow(query, args...).Scan(&initiatorID, &connectedID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Connection not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error deleting connection: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
 
-		w.WriteHeader(http.StatusNoContent)
+	if err := crmsync.SyncConnection(db, initiatorID, connectedID, crmsync.StatusDisconnected); err != nil {
+		log.Printf("Error queueing CRM sync: %v", err)
+		// Don't return error here as the connection was still deleted successfully
 	}
+
+	// Get user's role and recalculate matches
+	var role string
+	err = db.QueryRow("SELECT role FROM users WHERE id = $1", userID).Scan(&role)
+	if err != nil {
+		log.Printf("Error getting user role: %v", err)
+		// Don't return error here as the connection was still deleted successfully
+	} else if err = matches.EnqueueRecalculation(db, int64(userID), role); err != nil {
+		log.Printf("Error queueing match recalculation: %v", err)
+		// Don't return error here as the connection was still deleted successfully
+	}
+
+	w.WriteHeader(http.StatusNoContent)
 }
 
-// GetPotentialMatchesHandler returns potential matches based on grant criteria
+// GetPotentialMatchesHandler returns a page of potential matches based on grant
+// criteria. ?as=provider or ?as=recipient keeps the list a dual-role user has
+// in that role.
+// Used by: /api/potential-matches?as=&limit=&offset=
+// Response: PotentialMatchesResponse
 func GetPotentialMatchesHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -205,6 +294,17 @@ func GetPotentialMatchesHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		asRole := r.URL.Query().Get("as")
+		if asRole != "" && asRole != "provider" && asRole != "recipient" {
+			http.Error(w, "as must be provider or recipient", http.StatusBadRequest)
+			return
+		}
+
+		limit, offset, ok := httputil.ParsePage(w, r, defaultListPageSize, maxListPageSize)
+		if !ok {
+			return
+		}
+
 		log.Printf("Fetching potential matches for user %d", userID)
 
 		// Get user's role
@@ -216,27 +316,48 @@ func GetPotentialMatchesHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		// Recalculate matches for the current user
-		if err := matches.CalculateAndStoreMatches(db, int64(userID), role); err != nil {
-			log.Printf("Error recalculating matches: %v", err)
-			http.Error(w, "Error recalculating matches", http.StatusInternalServerError)
-			return
+		// Queue a refresh of missing or stale matches and serve what is stored
+		var refreshJobID *int64
+		needsRefresh, err := matches.NeedsRefresh(db, int64(userID))
+		if err != nil {
+			log.Printf("Error checking match freshness: %v", err)
+		}
+		if err != nil || needsRefresh {
+			if jobID, err := matches.QueueRecalculation(db, int64(userID), role); err != nil {
+				log.Printf("Error queueing match refresh for user %d: %v", userID, err)
+			} else {
+				refreshJobID = &jobID
+			}
 		}
 
-		// Get pre-calculated matches
-		potentialMatches, err := matches.GetStoredMatches(db, int64(userID))
+		// Get the page of pre-calculated matches
+		potentialMatches, total, visibleTotal, err := visibleMatchesPage(db, userID, asRole, limit, offset)
 		if err != nil {
 			log.Printf("Error fetching potential matches: %v", err)
 			http.Error(w, fmt.Sprintf("Error fetching potential matches: %v", err), http.StatusInternalServerError)
 			return
 		}
+		w.Header().Set("X-Matches-Total", strconv.Itoa(total))
+
+		response := PotentialMatchesResponse{Total: visibleTotal, Matches: potentialMatches, Limit: limit, Offset: offset, RefreshJobID: refreshJobID}
 
 		log.Printf("Found %d potential matches for user %d", len(potentialMatches), userID)
 		if len(potentialMatches) > 0 {
 			log.Printf("First match: %+v", potentialMatches[0])
+			track.Event(db, userID, track.FirstMatchViewed, nil)
+		}
+
+		// Record which experiment variant produced the matches shown
+		shown := make([]experiments.Exposure, len(potentialMatches))
+		for i, match := range potentialMatches {
+			shown[i] = experiments.Exposure{MatchID: match.ID, Variant: match.Variant}
+		}
+		if err := experiments.RecordExposures(db, userID, shown); err != nil {
+			log.Printf("Error recording experiment exposures for user %d: %v", userID, err)
+			// Don't return error here as the matches were still loaded successfully
 		}
 
-		if err := json.NewEncoder(w).Encode(potentialMatches); err != nil {
+		if err := json.NewEncoder(w).Encode(response); err != nil {
 			log.Printf("Error encoding response: %v", err)
 			http.Error(w, "Error encoding response", http.StatusInternalServerError)
 			return
@@ -244,7 +365,34 @@ func GetPotentialMatchesHandler(db *sql.DB) http.HandlerFunc {
 	}
 }
 
-// RecalculateMatchesHandler triggers a recalculation of matches for the current user
+// visibleMatchesPage returns a page of the user's stored matches, cut off
+// where their plan stops showing matches, with how many are stored in all and
+// how many of those the plan shows. The total lets the client say how many
+// more an upgrade would show.
+func visibleMatchesPage(db *sql.DB, userID int, asRole string, limit, offset int) ([]matches.Match, int, int, error) {
+	plan, err := entitlements.ForUser(db, userID)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("error loading entitlements: %v", err)
+	}
+	visible := plan.Limit(entitlements.QuotaVisibleMatches)
+	if visible != entitlements.Unlimited {
+		limit = max(0, min(limit, visible-offset))
+	}
+
+	page, total, err := matches.GetStoredMatchesPage(db, int64(userID), asRole, limit, offset)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	if visible != entitlements.Unlimited {
+		return page, total, min(total, visible), nil
+	}
+	return page, total, total, nil
+}
+
+// RecalculateMatchesHandler queues a recalculation of matches for the current
+// user, at most once per matches.RecalculationCooldown, and answers with the
+// job to poll with GetRecalculationHandler. Requests within the cooldown get a
+// 429 with Retry-After and the stored matches, flagged as stale.
 func RecalculateMatchesHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -256,7 +404,34 @@ func RecalculateMatchesHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		log.Printf("Recalculating matches for user %d", userID)
+		wait, err := matches.ClaimRecalculation(db, int64(userID))
+		if err != nil {
+			log.Printf("Error checking recalculation cooldown for user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if wait > 0 {
+			// The first page of the listing, within the plan's visible matches
+			stored, total, visibleTotal, err := visibleMatchesPage(db, userID, "", defaultListPageSize, 0)
+			if err != nil {
+				log.Printf("Error loading stored matches for user %d: %v", userID, err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("X-Matches-Total", strconv.Itoa(total))
+
+			retryAfter := int(math.Ceil(wait.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			w.WriteHeader(http.StatusTooManyRequests)
+			json.NewEncoder(w).Encode(RecalculateCooldownResponse{
+				Message:    "Matches were recalculated recently; previously stored matches are shown",
+				Stale:      true,
+				RetryAfter: retryAfter,
+				Matches:    stored,
+				Total:      visibleTotal,
+			})
+			return
+		}
 
 		// Get user's role
 		var role string
@@ -267,17 +442,54 @@ func RecalculateMatchesHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		// Calculate and store matches
-		err = matches.CalculateAndStoreMatches(db, int64(userID), role)
+		// The job workers recalculate; until then the stored matches are served
+		jobID, err := matches.QueueRecalculation(db, int64(userID), role)
 		if err != nil {
-			log.Printf("Error calculating matches: %v", err)
-			http.Error(w, "Error calculating matches", http.StatusInternalServerError)
+			log.Printf("Error queueing match recalculation for user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
 			return
 		}
 
-		log.Printf("Successfully recalculated matches for user %d", userID)
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]string{"message": "Matches recalculated successfully"})
+		log.Printf("Queued match recalculation %d for user %d", jobID, userID)
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(RecalculateQueuedResponse{
+			Message: "Matches are being recalculated",
+			JobID:   jobID,
+		})
+	}
+}
+
+// GetRecalculationHandler reports the progress of a recalculation queued by
+// RecalculateMatchesHandler or GetPotentialMatchesHandler
+// Used by: /api/potential-matches/recalculate/{id}
+// Response: matches.Recalculation
+func GetRecalculationHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		jobID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid job ID", http.StatusBadRequest)
+			return
+		}
+
+		recalculation, err := matches.GetRecalculation(db, int64(userID), jobID)
+		if errors.Is(err, jobs.ErrNotFound) {
+			http.Error(w, "Recalculation not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error loading recalculation %d: %v", jobID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(recalculation)
 	}
 }
 
@@ -300,6 +512,16 @@ func DismissMatchHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		// The reason is optional; it feeds the admin dismissal analytics
+		var req DismissRequest
+		if !httputil.DecodeOptionalJSON(w, r, &req) {
+			return
+		}
+		if err := req.validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
 		// Start transaction
 		tx, err := db.Begin()
 		if err != nil {
@@ -315,6 +537,9 @@ func DismissMatchHandler(db *sql.DB) http.HandlerFunc {
 				user_id BIGINT NOT NULL,
 				match_id BIGINT NOT NULL,
 				dismissed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+				reason VARCHAR(30),
+				comment TEXT,
+				match_score FLOAT,
 				PRIMARY KEY (user_id, match_id)
 			)
 		`)
@@ -324,34 +549,26 @@ func DismissMatchHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		// Add the match to dismissed_matches
-		_, err = tx.Exec("INSERT INTO dismissed_matches (user_id, match_id) VALUES ($1, $2)", userID, targetID)
-		if err != nil {
-			log.Printf("Error adding to dismissed_matches: %v", err)
-			http.Error(w, "Database error", http.StatusInternalServerError)
+		// Remove the stored match, keeping its score for analytics
+		var score float64
+		err = tx.QueryRow(DeleteStoredMatchQuery, userID, targetID).Scan(&score)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Match not found", http.StatusNotFound)
 			return
-		}
-
-		// Remove the match from temp_matches
-		result, err := tx.Exec("DELETE FROM temp_matches WHERE user_id = $1 AND match_id = $2", userID, targetID)
-		if err != nil {
-			log.Printf("Error removing match from temp_matches: %v", err)
+		} else if err != nil {
+			log.Printf("Error removing stored match: %v", err)
 			http.Error(w, "Database error", http.StatusInternalServerError)
 			return
 		}
 
-		rowsAffected, err := result.RowsAffected()
+		// Add the match to dismissed_matches
+		_, err = tx.Exec(InsertDismissalQuery, userID, targetID, req.Reason, req.Comment, score)
 		if err != nil {
-			log.Printf("Error getting rows affected: %v", err)
+			log.Printf("Error adding to dismissed_matches: %v", err)
 			http.Error(w, "Database error", http.StatusInternalServerError)
 			return
 		}
 
-		if rowsAffected == 0 {
-			http.Error(w, "Match not found", http.StatusNotFound)
-			return
-		}
-
 		// Commit transaction
 		if err = tx.Commit(); err != nil {
 			log.Printf("Error committing transaction: %v", err)
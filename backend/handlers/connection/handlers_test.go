@@ -0,0 +1,122 @@
+package connection
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+
+	"matcherator/backend/handlers/auth"
+	"matcherator/backend/services/matches"
+)
+
+var jobColumns = []string{"id", "kind", "status", "attempts", "max_attempts", "run_at", "last_error", "created_at", "completed_at", "progress"}
+
+func TestRecalculateMatchesQueuesJob(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", "test-secret")
+	token, err := auth.GenerateToken(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(`WITH claimed AS`).WithArgs(int64(7), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"claimed", "wait"}).AddRow(true, 0))
+	mock.ExpectQuery(`SELECT role FROM users WHERE id = \$1`).WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow("provider"))
+	mock.ExpectQuery(`FROM jobs\s+WHERE kind = ANY\(\$1\) AND status IN \('pending', 'running'\)`).
+		WillReturnRows(sqlmock.NewRows(jobColumns))
+	mock.ExpectQuery(`INSERT INTO jobs`).WithArgs(matches.RecalculateJob, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(21))
+
+	r := httptest.NewRequest(http.MethodPost, "/api/potential-matches/recalculate", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	RecalculateMatchesHandler(db)(w, r)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusAccepted, w.Body)
+	}
+	var response RecalculateQueuedResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil || response.JobID != 21 {
+		t.Errorf("response = %+v, %v; want job 21", response, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetRecalculation(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", "test-secret")
+	token, err := auth.GenerateToken(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	completed := created.Add(time.Minute)
+	jobQuery := `FROM jobs\s+WHERE id = \$1 AND kind = ANY\(\$2\) AND payload @> \$3`
+
+	tests := []struct {
+		name       string
+		id         string
+		job        *sqlmock.Rows // nil when the job must not be looked up
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "finished recalculation",
+			id:         "21",
+			job:        sqlmock.NewRows(jobColumns).AddRow(21, matches.RecalculateJob, "succeeded", 1, 5, created, nil, created, completed, nil),
+			wantStatus: http.StatusOK,
+			wantBody:   `{"job_id":21,"status":"succeeded","created_at":"2024-05-01T12:00:00Z","completed_at":"2024-05-01T12:01:00Z"}`,
+		},
+		{
+			// The lookup is limited to jobs whose payload is for the user
+			name:       "another user's job",
+			id:         "22",
+			job:        sqlmock.NewRows(jobColumns),
+			wantStatus: http.StatusNotFound,
+			wantBody:   "Recalculation not found",
+		},
+		{
+			name:       "invalid job id",
+			id:         "abc",
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "Invalid job ID",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			if tt.job != nil {
+				mock.ExpectQuery(jobQuery).WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), []byte(`{"user_id":7}`)).WillReturnRows(tt.job)
+			}
+
+			r := httptest.NewRequest(http.MethodGet, "/api/potential-matches/recalculate/"+tt.id, nil)
+			r = mux.SetURLVars(r, map[string]string{"id": tt.id})
+			r.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			GetRecalculationHandler(db)(w, r)
+
+			if got := strings.TrimSpace(w.Body.String()); w.Code != tt.wantStatus || got != tt.wantBody {
+				t.Errorf("status %d, body %s; want %d, %s", w.Code, got, tt.wantStatus, tt.wantBody)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
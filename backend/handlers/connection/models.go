@@ -1,20 +1,85 @@
 package connection
 
-import "time"
+import (
+	"time"
+
+	"matcherator/backend/services/matches"
+)
 
 // Connection represents a connection between two users
 type Connection struct {
-	ID               int       `json:"id"`
-	InitiatorID      int       `json:"initiator_id"` // The user who created the connection
-	TargetID         int       `json:"target_id"`    // The user being followed/connected to
-	CreatedAt        time.Time `json:"created_at"`
-	UpdatedAt        time.Time `json:"updated_at"`
-	OtherUserName    string    `json:"other_user_name"`
-	OtherUserPicture string    `json:"other_user_picture"`
-	ConnectionType   string    `json:"connection_type"` // "following" or "follower"
+	ID               int        `json:"id"`
+	InitiatorID      int        `json:"initiator_id"` // The user who created the connection
+	TargetID         int        `json:"target_id"`    // The user being followed/connected to
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+	OtherUserName    string     `json:"other_user_name"`
+	OtherUserPicture string     `json:"other_user_picture"`
+	ConnectionType   string     `json:"connection_type"` // "following" or "follower"
+	FundedAt         *time.Time `json:"funded_at"`       // When the provider marked the connection funded
 }
 
 // ConnectionRequest represents the request body for creating a connection
 type ConnectionRequest struct {
 	TargetID int `json:"target_id"`
 }
+
+// FundingStatus reports whether a connection was marked as funded
+type FundingStatus struct {
+	ConnectionID int        `json:"connection_id"`
+	Funded       bool       `json:"funded"`
+	FundedAt     *time.Time `json:"funded_at"`
+}
+
+// ConnectionsResponse is one page of a user's connections
+type ConnectionsResponse struct {
+	Connections []Connection `json:"connections"`
+	Total       int          `json:"total"`
+	Limit       int          `json:"limit"`
+	Offset      int          `json:"offset"`
+}
+
+// DismissedMatch is a match the user dismissed, with the reason they gave
+type DismissedMatch struct {
+	MatchID           int       `json:"match_id"`
+	OrganizationName  string    `json:"organization_name"`
+	ProfilePictureURL *string   `json:"profile_picture_url"`
+	Reason            *string   `json:"reason"`
+	Comment           *string   `json:"comment"`
+	DismissedAt       time.Time `json:"dismissed_at"`
+}
+
+// DismissedMatchesResponse is one page of a user's dismissed matches
+type DismissedMatchesResponse struct {
+	Dismissed []DismissedMatch `json:"dismissed"`
+	Total     int              `json:"total"`
+	Limit     int              `json:"limit"`
+	Offset    int              `json:"offset"`
+}
+
+// PotentialMatchesResponse is one page of a user's potential matches, best first
+type PotentialMatchesResponse struct {
+	Matches []matches.Match `json:"matches"`
+	Total   int             `json:"total"` // matches the user's plan shows
+	Limit   int             `json:"limit"`
+	Offset  int             `json:"offset"`
+
+	// Set when the matches were missing or stale and a refresh was queued
+	RefreshJobID *int64 `json:"refresh_job_id,omitempty"`
+}
+
+// RecalculateQueuedResponse answers a queued recalculation
+type RecalculateQueuedResponse struct {
+	Message string `json:"message"`
+	JobID   int64  `json:"job_id"`
+}
+
+// RecalculateCooldownResponse answers a recalculation requested within the
+// cooldown with the stored matches
+type RecalculateCooldownResponse struct {
+	Message    string          `json:"message"`
+	Stale      bool            `json:"stale"`
+	RetryAfter int             `json:"retry_after"` // seconds until the next recalculation is allowed
+	Matches    []matches.Match `json:"matches"`
+	Total      int             `json:"total"` // matches the user's plan shows
+}
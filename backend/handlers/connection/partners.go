@@ -0,0 +1,84 @@
+package connection
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"matcherator/backend/handlers/auth"
+	"matcherator/backend/services/matches"
+)
+
+// GetPotentialPartnersHandler returns other providers the user could co-fund
+// with, best first. Both must have turned on open_to_cofunding in their match
+// preferences.
+// Used by: /api/potential-partners
+// Response: []matches.Partner
+func GetPotentialPartnersHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		partners, err := matches.FindPartners(db, int64(userID))
+		switch {
+		case errors.Is(err, matches.ErrUserNotFound):
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		case errors.Is(err, matches.ErrNotProvider):
+			http.Error(w, "Only providers can look for co-funding partners", http.StatusForbidden)
+			return
+		case errors.Is(err, matches.ErrCofundingDisabled):
+			http.Error(w, "Turn on open_to_cofunding in your match preferences to find co-funding partners", http.StatusForbidden)
+			return
+		case err != nil:
+			log.Printf("Error finding co-funding partners for user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(partners)
+	}
+}
+
+// GetPotentialPeersHandler returns other recipients in the same field or region
+// to share knowledge with, best first. Both must have turned on open_to_peers
+// in their match preferences.
+// Used by: /api/potential-peers
+// Response: []matches.Peer
+func GetPotentialPeersHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		peers, err := matches.FindPeers(db, int64(userID))
+		switch {
+		case errors.Is(err, matches.ErrUserNotFound):
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		case errors.Is(err, matches.ErrNotRecipient):
+			http.Error(w, "Only recipients can look for peers", http.StatusForbidden)
+			return
+		case errors.Is(err, matches.ErrPeersDisabled):
+			http.Error(w, "Turn on open_to_peers in your match preferences to find peers", http.StatusForbidden)
+			return
+		case err != nil:
+			log.Printf("Error finding peers for user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(peers)
+	}
+}
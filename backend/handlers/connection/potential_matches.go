@@ -25,7 +25,7 @@ func PotentialMatchesHandler(db *sql.DB) http.HandlerFunc {
 		log.Printf("Fetching potential matches for user %d", userID)
 
 		// Get pre-calculated matches
-		potentialMatches, err := matches.GetStoredMatches(db, int64(userID))
+		potentialMatches, err := matches.GetStoredMatches(db, int64(userID), "")
 		if err != nil {
 			log.Printf("Error fetching potential matches: %v", err)
 			http.Error(w, "Error fetching potential matches", http.StatusInternalServerError)
@@ -0,0 +1,76 @@
+package connection
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"matcherator/backend/handlers/auth"
+	"matcherator/backend/handlers/httputil"
+	"matcherator/backend/services/matches"
+)
+
+// GetMatchPreferencesHandler returns the sectors, states, applicant types and
+// funding types the user excluded from their matches
+// Used by: /api/me/match-preferences
+// Response: matches.Preferences
+func GetMatchPreferencesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		prefs, err := matches.LoadPreferences(db, int64(userID))
+		if err != nil {
+			log.Printf("Error loading match preferences for user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(prefs)
+	}
+}
+
+// UpdateMatchPreferencesHandler replaces the user's exclusions and updates the
+// stored matches involving them in both directions
+// Used by: /api/me/match-preferences
+// Response: matches.Preferences
+func UpdateMatchPreferencesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req matches.Preferences
+		if !httputil.DecodeJSON(w, r, &req) {
+			return
+		}
+		if err := req.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		prefs, err := matches.SavePreferences(db, int64(userID), req)
+		if err != nil {
+			log.Printf("Error saving match preferences for user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		if _, err := matches.QueueUpdate(db, int64(userID)); err != nil {
+			log.Printf("Error queueing match update for user %d: %v", userID, err)
+			// Don't return error here as the preferences were still saved successfully
+		}
+
+		json.NewEncoder(w).Encode(prefs)
+	}
+}
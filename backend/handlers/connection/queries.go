@@ -1,8 +1,10 @@
 package connection
 
+import "matcherator/backend/services/matches"
+
 // Connection queries
 const (
-	// GetConnectionsQuery retrieves all connections for a user
+	// GetConnectionsQuery retrieves one page of a user's connections, newest first
 	GetConnectionsQuery = `
         SELECT 
             c.id,
@@ -21,168 +23,236 @@ const (
             CASE 
                 WHEN c.initiator_id = $1 THEN 'following' 
                 ELSE 'follower' 
-            END as connection_type
+            END as connection_type,
+            c.funded_at
         FROM connections c
         LEFT JOIN profiles p ON 
             (c.initiator_id = $1 AND c.target_id = p.user_id) OR
             (c.target_id = $1 AND c.initiator_id = p.user_id)
         WHERE c.initiator_id = $1 OR c.target_id = $1
-        ORDER BY c.created_at DESC
+        ORDER BY c.created_at DESC, c.id DESC
+        LIMIT $2 OFFSET $3
     `
 
-	// GetPotentialMatchesQuery finds potential matches based on grant criteria
-	GetPotentialMatchesQuery = `
-        WITH provider_data AS (
-            SELECT 
-                u.id as provider_id,
-                p.organization_name,
-                p.sectors,
-                p.target_groups,
-                p.profile_picture_url,
-                p.state,
-                p.city,
-                pd.funding_type,
-                pd.amount_offered,
-                pd.region_scope,
-                pd.location_notes,
-                pd.eligibility_notes,
-                pd.deadline,
-                pd.application_link
-            FROM users u
-            JOIN profiles p ON u.id = p.user_id
-            JOIN provider_data pd ON u.id = pd.user_id
-            WHERE u.role = 'provider' AND u.status = 'active'
-        ),
-        recipient_data AS (
-            SELECT 
-                u.id as recipient_id,
-                p.organization_name,
-                p.sectors,
-                p.target_groups,
-                p.project_stage,
-                p.profile_picture_url,
-                p.state,
-                p.city,
-                rd.needs,
-                rd.budget_requested,
-                rd.team_size,
-                rd.timeline,
-                rd.prior_funding
-            FROM users u
-            JOIN profiles p ON u.id = p.user_id
-            JOIN recipient_data rd ON u.id = rd.user_id
-            WHERE u.role = 'recipient' AND u.status = 'active'
-        ),
-        match_calculations AS (
-            SELECT 
-                p.provider_id,
-                p.organization_name as provider_name,
-                COALESCE(p.profile_picture_url, '') as provider_picture,
-                r.recipient_id,
-                r.organization_name as recipient_name,
-                COALESCE(r.profile_picture_url, '') as recipient_picture,
-                CASE 
-                    WHEN p.sectors && r.sectors THEN 
-                        (CARDINALITY(ARRAY(SELECT UNNEST(p.sectors) INTERSECT SELECT UNNEST(r.sectors)))::float / 
-                        GREATEST(CARDINALITY(p.sectors), CARDINALITY(r.sectors))::float * 100)
-                    ELSE 0 
-                END as sector_score,
-                CASE 
-                    WHEN p.target_groups && r.target_groups THEN 
-                        (CARDINALITY(ARRAY(SELECT UNNEST(p.target_groups) INTERSECT SELECT UNNEST(r.target_groups)))::float / 
-                        GREATEST(CARDINALITY(p.target_groups), CARDINALITY(r.target_groups))::float * 100)
-                    ELSE 0 
-                END as target_group_score,
-                CASE 
-                    WHEN COALESCE(p.amount_offered, 0) >= COALESCE(r.budget_requested, 0) THEN 100
-                    ELSE (COALESCE(p.amount_offered, 0)::float / NULLIF(COALESCE(r.budget_requested, 0), 0)::float * 100)
-                END as budget_score,
-                CASE 
-                    WHEN COALESCE(p.deadline, CURRENT_TIMESTAMP + INTERVAL '1 year') >= 
-                        CURRENT_TIMESTAMP + (
-                            CASE 
-                                WHEN r.timeline = '1-3 months' THEN INTERVAL '3 months'
-                                WHEN r.timeline = '3-6 months' THEN INTERVAL '6 months'
-                                WHEN r.timeline = '6-12 months' THEN INTERVAL '12 months'
-                                ELSE INTERVAL '0 months'
-                            END
-                        ) THEN 100
-                    ELSE 0 
-                END as timeline_score,
-                CASE 
-                    WHEN r.project_stage = 'Early Stage' AND p.funding_type = 'seed' THEN 100
-                    WHEN r.project_stage = 'Growth Stage' AND p.funding_type = 'series a' THEN 100
-                    WHEN r.project_stage = 'Mature Stage' AND p.funding_type = 'series b' THEN 100
-                    WHEN r.project_stage = 'Early Stage' AND p.funding_type = 'pitch comp' THEN 80
-                    WHEN r.project_stage = 'Growth Stage' AND p.funding_type = 'pitch comp' THEN 60
-                    WHEN r.project_stage = 'Mature Stage' AND p.funding_type = 'pitch comp' THEN 40
-                    ELSE 20
-                END as stage_score,
-                CASE 
-                    WHEN p.state = r.state AND p.city = r.city THEN 100
-                    WHEN p.state = r.state THEN 50
-                    ELSE 0
-                END as location_score
-            FROM provider_data p
-            INNER JOIN recipient_data r ON true
-        )
-        SELECT 
-            provider_id,
-            provider_name,
-            provider_picture,
-            recipient_id,
-            recipient_name,
-            recipient_picture,
-            sector_score,
-            target_group_score,
-            budget_score,
-            timeline_score,
-            stage_score,
-            location_score,
-            (sector_score * 0.3 + target_group_score * 0.3 + budget_score * 0.2 + timeline_score * 0.1 + stage_score * 0.1) as match_score
-        FROM match_calculations
-        WHERE 
-            -- Require minimum match score
-            (sector_score * 0.3 + target_group_score * 0.3 + budget_score * 0.2 + timeline_score * 0.1 + stage_score * 0.1) >= 30
-            -- Require at least one sector or target group match
-            AND (sector_score > 0 OR target_group_score > 0)
-            -- Require location match if both have location data
-            AND (
-                (provider_id IN (SELECT provider_id FROM provider_data WHERE state IS NOT NULL AND city IS NOT NULL)
-                AND recipient_id IN (SELECT recipient_id FROM recipient_data WHERE state IS NOT NULL AND city IS NOT NULL)
-                AND location_score > 0)
-                OR
-                (provider_id NOT IN (SELECT provider_id FROM provider_data WHERE state IS NOT NULL AND city IS NOT NULL)
-                OR recipient_id NOT IN (SELECT recipient_id FROM recipient_data WHERE state IS NOT NULL AND city IS NOT NULL))
-            )
-            -- Exclude users that are already connected
-            AND NOT EXISTS (
-                SELECT 1 FROM connections c
-                WHERE (c.initiator_id = provider_id AND c.target_id = recipient_id)
-                   OR (c.initiator_id = recipient_id AND c.target_id = provider_id)
-            )
-        ORDER BY match_score DESC
-    `
-
-	// CreateConnectionQuery creates a new connection
+	// CountConnectionsQuery counts a user's connections
+	CountConnectionsQuery = `
+        SELECT COUNT(*) FROM connections
+        WHERE initiator_id = $1 OR target_id = $1
+    `
+
+	// CreateConnectionQuery creates a connection unless the pair is already
+	// connected in either direction, in which case no row is returned
 	CreateConnectionQuery = `
         INSERT INTO connections (initiator_id, target_id, connection_type, created_at, updated_at)
         VALUES ($1, $2, $3, NOW(), NOW())
+        ON CONFLICT ((LEAST(initiator_id, target_id)), (GREATEST(initiator_id, target_id))) DO NOTHING
         RETURNING id, created_at, updated_at
     `
 
-	// DeleteConnectionQuery removes a connection
+	// DeleteConnectionQuery removes connection $1 if user $2 is one of its
+	// sides and returns both sides
 	DeleteConnectionQuery = `
         DELETE FROM connections 
         WHERE id = $1 AND (initiator_id = $2 OR target_id = $2)
+        RETURNING initiator_id, target_id
+    `
+
+	// DeleteConnectionWithUserQuery removes the connection between users $1 and
+	// $2, in either direction, and returns both sides
+	DeleteConnectionWithUserQuery = `
+        DELETE FROM connections
+        WHERE LEAST(initiator_id, target_id) = LEAST($1::int, $2::int)
+          AND GREATEST(initiator_id, target_id) = GREATEST($1::int, $2::int)
+        RETURNING initiator_id, target_id
+    `
+
+	// SelectConnectionBetweenQuery returns the connection between two users,
+	// whichever of them initiated it
+	SelectConnectionBetweenQuery = `
+        SELECT id, initiator_id, target_id, connection_type, created_at, updated_at
+        FROM connections
+        WHERE LEAST(initiator_id, target_id) = LEAST($1::int, $2::int)
+          AND GREATEST(initiator_id, target_id) = GREATEST($1::int, $2::int)
     `
 
-	// CheckConnectionExistsQuery checks if a connection already exists
-	CheckConnectionExistsQuery = `
-        SELECT EXISTS (
-            SELECT 1 FROM connections 
-            WHERE (initiator_id = $1 AND target_id = $2) OR
-                  (initiator_id = $2 AND target_id = $1)
+	// SelectConnectionFundingQuery returns the provider and recipient of a
+	// connection the user is part of, and when it was marked funded
+	SelectConnectionFundingQuery = `
+        SELECT pu.id, ru.id, c.funded_at
+        FROM connections c` + matches.ConnectionPartiesSQL + `
+        WHERE c.id = $1 AND $2 IN (c.initiator_id, c.target_id)
+    `
+
+	// MarkFundedQuery marks a connection funded, keeping the date it was
+	// first marked
+	MarkFundedQuery = `
+        UPDATE connections
+        SET funded_at = COALESCE(funded_at, CURRENT_TIMESTAMP), funded_by = COALESCE(funded_by, $2)
+        WHERE id = $1
+        RETURNING funded_at
+    `
+
+	// UnmarkFundedQuery clears a connection's funded mark
+	UnmarkFundedQuery = `
+        UPDATE connections SET funded_at = NULL, funded_by = NULL WHERE id = $1
+    `
+
+	// CheckUserExistsQuery checks that a connection target exists
+	CheckUserExistsQuery = `
+        SELECT EXISTS (SELECT 1 FROM users WHERE id = $1 AND deactivated_at IS NULL)
+    `
+
+	// SelectAwardRangeQuery returns the award range from the user's role data
+	SelectAwardRangeQuery = `
+        SELECT pd.award_min, pd.award_max
+        FROM users u JOIN provider_data pd ON pd.user_id = u.id
+        WHERE u.id = $1 AND u.role = 'provider'
+        UNION ALL
+        SELECT rd.award_min, rd.award_max
+        FROM users u JOIN recipient_data rd ON rd.user_id = u.id
+        WHERE u.id = $1 AND u.role = 'recipient'
+    `
+
+	// UpdateAwardRangeQuery sets the award range in the user's role data
+	UpdateAwardRangeQuery = `
+        WITH provider AS (
+            UPDATE provider_data pd
+            SET award_min = $2, award_max = $3, updated_at = CURRENT_TIMESTAMP
+            FROM users u
+            WHERE pd.user_id = u.id AND u.id = $1 AND u.role = 'provider'
+            RETURNING pd.award_min, pd.award_max
+        ), recipient AS (
+            UPDATE recipient_data rd
+            SET award_min = $2, award_max = $3, updated_at = CURRENT_TIMESTAMP
+            FROM users u
+            WHERE rd.user_id = u.id AND u.id = $1 AND u.role = 'recipient'
+            RETURNING rd.award_min, rd.award_max
         )
+        SELECT award_min, award_max FROM provider
+        UNION ALL
+        SELECT award_min, award_max FROM recipient
+    `
+
+	// SelectEligibilityQuery returns a provider's eligibility bands
+	SelectEligibilityQuery = `
+        SELECT pd.eligible_budget_min, pd.eligible_budget_max,
+            pd.eligible_staff_min, pd.eligible_staff_max,
+            pd.eligible_min_age_years, pd.eligible_max_age_years
+        FROM provider_data pd
+        JOIN users u ON u.id = pd.user_id
+        WHERE u.id = $1 AND u.role = 'provider'
+    `
+
+	// UpdateEligibilityQuery replaces a provider's eligibility bands
+	UpdateEligibilityQuery = `
+        UPDATE provider_data pd
+        SET eligible_budget_min = $2,
+            eligible_budget_max = $3,
+            eligible_staff_min = $4,
+            eligible_staff_max = $5,
+            eligible_min_age_years = $6,
+            eligible_max_age_years = $7,
+            updated_at = CURRENT_TIMESTAMP
+        FROM users u
+        WHERE pd.user_id = u.id AND u.id = $1 AND u.role = 'provider'
+        RETURNING pd.eligible_budget_min, pd.eligible_budget_max,
+            pd.eligible_staff_min, pd.eligible_staff_max,
+            pd.eligible_min_age_years, pd.eligible_max_age_years
+    `
+
+	// DeleteStoredMatchQuery removes a match from the user's stored matches and
+	// returns the score it had
+	DeleteStoredMatchQuery = `
+        DELETE FROM matches
+        WHERE user_id = $1 AND match_id = $2
+        RETURNING match_score
+    `
+
+	// InsertDismissalQuery records a dismissed match with its optional reason
+	InsertDismissalQuery = `
+        INSERT INTO dismissed_matches (user_id, match_id, reason, comment, match_score)
+        VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), $5)
+        ON CONFLICT (user_id, match_id) DO NOTHING
+    `
+
+	// SelectDismissedMatchesQuery retrieves one page of a user's dismissed
+	// matches with accounts that still exist, most recently dismissed first
+	SelectDismissedMatchesQuery = `
+        SELECT
+            dm.match_id,
+            COALESCE(p.organization_name, ''),
+            p.profile_picture_url,
+            dm.reason,
+            dm.comment,
+            dm.dismissed_at
+        FROM dismissed_matches dm
+        JOIN users u ON u.id = dm.match_id
+        LEFT JOIN profiles p ON p.user_id = dm.match_id
+        WHERE dm.user_id = $1 AND u.deleted_at IS NULL
+        ORDER BY dm.dismissed_at DESC, dm.match_id
+        LIMIT $2 OFFSET $3
+    `
+
+	// CountDismissedMatchesQuery counts the dismissed matches
+	// SelectDismissedMatchesQuery pages through
+	CountDismissedMatchesQuery = `
+        SELECT COUNT(*)
+        FROM dismissed_matches dm
+        JOIN users u ON u.id = dm.match_id
+        WHERE dm.user_id = $1 AND u.deleted_at IS NULL
+    `
+
+	// DeleteDismissalQuery removes a dismissal so the match can be suggested
+	// again, returning the user's role
+	DeleteDismissalQuery = `
+        DELETE FROM dismissed_matches dm
+        USING users u
+        WHERE dm.user_id = $1 AND dm.match_id = $2 AND u.id = dm.user_id
+        RETURNING u.role
+    `
+
+	// SelectDismissalReasonsQuery counts dismissals per reason since $1,
+	// optionally for users of one role
+	SelectDismissalReasonsQuery = `
+        SELECT COALESCE(dm.reason, 'unspecified'), COUNT(*), AVG(dm.match_score)
+        FROM dismissed_matches dm
+        JOIN users u ON u.id = dm.user_id
+        WHERE dm.dismissed_at >= $1 AND ($2 = '' OR u.role = $2)
+        GROUP BY 1
+        ORDER BY 2 DESC, 1
+    `
+
+	// SelectDismissalBreakdownQuery counts dismissals since $1 per reason,
+	// sector of the dismissed profile and score band of width $3
+	SelectDismissalBreakdownQuery = `
+        SELECT COALESCE(dm.reason, 'unspecified'),
+            COALESCE(s.sector, 'unspecified'),
+            FLOOR(dm.match_score / $3)::int,
+            COUNT(*)
+        FROM dismissed_matches dm
+        JOIN users u ON u.id = dm.user_id
+        LEFT JOIN profiles p ON p.user_id = dm.match_id
+        LEFT JOIN LATERAL unnest(p.sectors) AS s(sector) ON true
+        WHERE dm.dismissed_at >= $1 AND ($2 = '' OR u.role = $2)
+        GROUP BY 1, 2, 3
+        ORDER BY 4 DESC, 1, 2, 3
+    `
+
+	// ExportConnectionsQuery lists the user's connections with the other
+	// side's contact details for export
+	ExportConnectionsQuery = `
+        SELECT
+            o.id,
+            COALESCE(p.organization_name, ''),
+            o.email,
+            o.role,
+            CASE WHEN c.initiator_id = $1 THEN 'following' ELSE 'follower' END,
+            c.created_at,
+            c.funded_at
+        FROM connections c
+        JOIN users o ON o.id = CASE WHEN c.initiator_id = $1 THEN c.target_id ELSE c.initiator_id END
+        LEFT JOIN profiles p ON p.user_id = o.id
+        WHERE c.initiator_id = $1 OR c.target_id = $1
+        ORDER BY c.created_at DESC
     `
 )
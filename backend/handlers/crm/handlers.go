@@ -0,0 +1,199 @@
+package crm
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"matcherator/backend/handlers/auth"
+	"matcherator/backend/handlers/httputil"
+	"matcherator/backend/services/crmsync"
+)
+
+const (
+	defaultLogsLimit = 50
+	maxLogsLimit     = 200
+)
+
+// GetConnectionHandler returns the organization's CRM sync configuration
+// Used by: /api/me/crm
+// Response: crmsync.Connection
+func GetConnectionHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		connection, err := crmsync.Load(db, userID)
+		if err == crmsync.ErrNotFound {
+			http.Error(w, "No CRM connection configured", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error loading CRM connection for user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(connection)
+	}
+}
+
+// SaveConnectionHandler creates or updates the organization's CRM sync
+// configuration; field and status mappings default to the provider's
+// Used by: /api/me/crm
+// Response: crmsync.Connection
+func SaveConnectionHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req ConnectionRequest
+		if !httputil.DecodeJSON(w, r, &req) {
+			return
+		}
+
+		if err := req.Config.Normalize(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.Credentials != nil {
+			if err := req.Credentials.Validate(req.Provider); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		enabled := req.Enabled == nil || *req.Enabled
+		err = crmsync.Save(db, userID, req.Config, req.Credentials, enabled)
+		if err == crmsync.ErrCredentialsRequired {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		} else if err != nil {
+			log.Printf("Error saving CRM connection for user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		connection, err := crmsync.Load(db, userID)
+		if err != nil {
+			log.Printf("Error loading CRM connection for user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(connection)
+	}
+}
+
+// DeleteConnectionHandler removes the organization's CRM sync configuration and
+// credentials
+// Used by: /api/me/crm
+// Response: 204 No Content
+func DeleteConnectionHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		err = crmsync.Delete(db, userID)
+		if err == crmsync.ErrNotFound {
+			http.Error(w, "No CRM connection configured", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error deleting CRM connection for user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// ListSyncLogsHandler lists the organization's most recent CRM syncs
+// Used by: /api/me/crm/sync-logs?status=&limit=
+// Response: SyncLogsResponse
+func ListSyncLogsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		query := r.URL.Query()
+		status := query.Get("status")
+		switch status {
+		case "", crmsync.LogPending, crmsync.LogSucceeded, crmsync.LogFailed:
+		default:
+			http.Error(w, "status must be pending, succeeded or failed", http.StatusBadRequest)
+			return
+		}
+
+		limit := defaultLogsLimit
+		if value := query.Get("limit"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+				return
+			}
+			limit = min(n, maxLogsLimit)
+		}
+
+		logs, err := crmsync.Logs(db, userID, status, limit)
+		if err != nil {
+			log.Printf("Error listing CRM sync logs for user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(SyncLogsResponse{Logs: logs})
+	}
+}
+
+// RetrySyncHandler queues a failed CRM sync again
+// Used by: /api/me/crm/sync-logs/{id}/retry
+// Response: 202 Accepted
+func RetrySyncHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		logID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid sync log ID", http.StatusBadRequest)
+			return
+		}
+
+		err = crmsync.Retry(db, userID, logID)
+		if err == crmsync.ErrNotFound {
+			http.Error(w, "Failed sync not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error retrying CRM sync %d: %v", logID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
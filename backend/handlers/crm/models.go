@@ -0,0 +1,16 @@
+package crm
+
+import "matcherator/backend/services/crmsync"
+
+// ConnectionRequest configures the organization's CRM sync. Credentials may be
+// omitted to keep the stored ones.
+type ConnectionRequest struct {
+	crmsync.Config
+	Credentials *crmsync.Credentials `json:"credentials"`
+	Enabled     *bool                `json:"enabled"`
+}
+
+// SyncLogsResponse lists the organization's recent CRM syncs
+type SyncLogsResponse struct {
+	Logs []crmsync.SyncLog `json:"logs"`
+}
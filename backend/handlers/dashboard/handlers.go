@@ -0,0 +1,254 @@
+package dashboard
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"matcherator/backend/handlers/auth"
+)
+
+// ranges maps the accepted ?range= values to their length; "all" has no bound
+var ranges = map[string]time.Duration{
+	"7d":   7 * 24 * time.Hour,
+	"30d":  30 * 24 * time.Hour,
+	"90d":  90 * 24 * time.Hour,
+	"365d": 365 * 24 * time.Hour,
+	"all":  0,
+}
+
+// GetProviderDashboardHandler summarizes how many recipients matched, viewed,
+// connected with and chatted with the provider, overall and per grant
+// Used by: /api/me/provider-dashboard?range=7d|30d|90d|365d|all
+// Response: ProviderDashboard
+func GetProviderDashboardHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var role string
+		var dualRole bool
+		err = db.QueryRow("SELECT role, dual_role FROM users WHERE id = $1", userID).Scan(&role, &dualRole)
+		if err != nil {
+			log.Printf("Error getting user role: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if role != "provider" && !dualRole {
+			http.Error(w, "Only providers have a dashboard", http.StatusForbidden)
+			return
+		}
+
+		dashboard := ProviderDashboard{Range: r.URL.Query().Get("range"), Grants: []GrantFunnel{}}
+		if dashboard.Range == "" {
+			dashboard.Range = "30d"
+		}
+		length, ok := ranges[dashboard.Range]
+		if !ok {
+			http.Error(w, "Invalid range. Must be one of 7d, 30d, 90d, 365d, all", http.StatusBadRequest)
+			return
+		}
+		if length > 0 {
+			since := time.Now().Add(-length)
+			dashboard.Since = &since
+		}
+
+		dashboard.Overall, err = loadFunnel(db, userID, dashboard.Since, nil)
+		if err != nil {
+			log.Printf("Error loading provider funnel: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		rows, err := db.Query(SelectProviderGrantsQuery, userID)
+		if err != nil {
+			log.Printf("Error querying provider grants: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var grant GrantFunnel
+			if err := rows.Scan(&grant.GrantID, &grant.Title); err != nil {
+				log.Printf("Error scanning grant: %v", err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+			dashboard.Grants = append(dashboard.Grants, grant)
+		}
+
+		if err = rows.Err(); err != nil {
+			log.Printf("Error iterating grants: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		rows.Close()
+
+		for i := range dashboard.Grants {
+			grantID := dashboard.Grants[i].GrantID
+			dashboard.Grants[i].Funnel, err = loadFunnel(db, userID, dashboard.Since, &grantID)
+			if err != nil {
+				log.Printf("Error loading funnel for grant %d: %v", grantID, err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		json.NewEncoder(w).Encode(dashboard)
+	}
+}
+
+// loadFunnel counts the funnel stages for a provider, optionally for a single grant
+func loadFunnel(db *sql.DB, providerID int, since *time.Time, grantID *int) (Funnel, error) {
+	var funnel Funnel
+	err := db.QueryRow(SelectFunnelQuery, providerID, since, grantID).Scan(
+		&funnel.Matched,
+		&funnel.Viewed,
+		&funnel.Connected,
+		&funnel.Chatted,
+	)
+	return funnel, err
+}
+
+// completenessFields names the fields checked by SelectCompletenessQuery, in order
+var completenessFields = []string{
+	"organization_name",
+	"mission_statement",
+	"profile_picture_url",
+	"state",
+	"city",
+	"zip_code",
+	"ein",
+	"applicant_type",
+	"sectors",
+	"target_groups",
+	"project_stage",
+	"website_url",
+	"needs",
+	"budget_requested",
+	"team_size",
+	"timeline",
+}
+
+// GetRecipientDashboardHandler aggregates the recipient home screen: upcoming
+// deadlines of connected providers, chats needing a reply, new matches this week
+// and profile completeness
+// Used by: /api/me/recipient-dashboard
+// Response: RecipientDashboard
+func GetRecipientDashboardHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var role string
+		var dualRole bool
+		err = db.QueryRow("SELECT role, dual_role FROM users WHERE id = $1", userID).Scan(&role, &dualRole)
+		if err != nil {
+			log.Printf("Error getting user role: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if role != "recipient" && !dualRole {
+			http.Error(w, "Only recipients have a recipient dashboard", http.StatusForbidden)
+			return
+		}
+
+		var dashboard RecipientDashboard
+		if dashboard.UpcomingDeadlines, err = loadUpcomingDeadlines(db, userID); err != nil {
+			log.Printf("Error loading upcoming deadlines: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if dashboard.NeedsReply, err = loadNeedsReply(db, userID); err != nil {
+			log.Printf("Error loading conversations: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if err = db.QueryRow(CountNewMatchesQuery, userID).Scan(&dashboard.NewMatchesThisWeek); err != nil {
+			log.Printf("Error counting new matches: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if dashboard.ProfileCompleteness, err = loadCompleteness(db, userID); err != nil {
+			log.Printf("Error loading profile completeness: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(dashboard)
+	}
+}
+
+// loadUpcomingDeadlines lists deadlines of providers connected with the user
+func loadUpcomingDeadlines(db *sql.DB, userID int) ([]Deadline, error) {
+	rows, err := db.Query(SelectUpcomingDeadlinesQuery, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deadlines := []Deadline{}
+	for rows.Next() {
+		var d Deadline
+		if err := rows.Scan(&d.ProviderID, &d.OrganizationName, &d.GrantID, &d.Title, &d.Deadline); err != nil {
+			return nil, err
+		}
+		deadlines = append(deadlines, d)
+	}
+	return deadlines, rows.Err()
+}
+
+// loadNeedsReply lists chats whose latest message came from the other party
+func loadNeedsReply(db *sql.DB, userID int) ([]PendingConversation, error) {
+	rows, err := db.Query(SelectNeedsReplyQuery, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	conversations := []PendingConversation{}
+	for rows.Next() {
+		var c PendingConversation
+		if err := rows.Scan(&c.ConnectionID, &c.UserID, &c.OrganizationName, &c.LastMessage, &c.LastMessageAt); err != nil {
+			return nil, err
+		}
+		conversations = append(conversations, c)
+	}
+	return conversations, rows.Err()
+}
+
+// loadCompleteness computes the share of completenessFields the user has filled in
+func loadCompleteness(db *sql.DB, userID int) (Completeness, error) {
+	filled := make([]bool, len(completenessFields))
+	dest := make([]interface{}, len(filled))
+	for i := range filled {
+		dest[i] = &filled[i]
+	}
+
+	completeness := Completeness{Missing: []string{}}
+	if err := db.QueryRow(SelectCompletenessQuery, userID).Scan(dest...); err != nil {
+		return completeness, err
+	}
+
+	for i, ok := range filled {
+		if !ok {
+			completeness.Missing = append(completeness.Missing, completenessFields[i])
+		}
+	}
+	completeness.Percent = 100 * (len(filled) - len(completeness.Missing)) / len(filled)
+
+	return completeness, nil
+}
@@ -0,0 +1,60 @@
+package dashboard
+
+import "time"
+
+// Funnel counts distinct recipients at each stage of a provider's reach
+type Funnel struct {
+	Matched   int  `json:"matched"`   // current match list, regardless of range
+	Viewed    int  `json:"viewed"`    // viewed the provider's profile
+	Connected int  `json:"connected"` // connected with the provider
+	Chatted   int  `json:"chatted"`   // exchanged chat messages with the provider
+	Applied   *int `json:"applied"`   // null until grant applications exist
+}
+
+// GrantFunnel is the funnel restricted to recipients whose sectors or target
+// groups overlap a grant's
+type GrantFunnel struct {
+	GrantID int    `json:"grant_id"`
+	Title   string `json:"title"`
+	Funnel
+}
+
+// ProviderDashboard is the response of /api/me/provider-dashboard
+type ProviderDashboard struct {
+	Range   string        `json:"range"`
+	Since   *time.Time    `json:"since"`
+	Overall Funnel        `json:"overall"`
+	Grants  []GrantFunnel `json:"grants"`
+}
+
+// Deadline is an upcoming deadline of a provider the recipient is connected with
+type Deadline struct {
+	ProviderID       int       `json:"provider_id"`
+	OrganizationName string    `json:"organization_name"`
+	GrantID          *int      `json:"grant_id"` // null for the provider's own deadline
+	Title            string    `json:"title"`
+	Deadline         time.Time `json:"deadline"`
+}
+
+// PendingConversation is a chat whose latest message came from the other party
+type PendingConversation struct {
+	ConnectionID     int       `json:"connection_id"`
+	UserID           int       `json:"user_id"`
+	OrganizationName string    `json:"organization_name"`
+	LastMessage      string    `json:"last_message"`
+	LastMessageAt    time.Time `json:"last_message_at"`
+}
+
+// Completeness reports how much of the recipient's profile is filled in
+type Completeness struct {
+	Percent int      `json:"percent"`
+	Missing []string `json:"missing"`
+}
+
+// RecipientDashboard is the response of /api/me/recipient-dashboard
+type RecipientDashboard struct {
+	UpcomingDeadlines   []Deadline            `json:"upcoming_deadlines"`
+	NeedsReply          []PendingConversation `json:"needs_reply"`
+	NewMatchesThisWeek  int                   `json:"new_matches_this_week"`
+	ProfileCompleteness Completeness          `json:"profile_completeness"`
+}
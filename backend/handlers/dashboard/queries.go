@@ -0,0 +1,146 @@
+package dashboard
+
+const (
+	// SelectFunnelQuery counts recipients at each funnel stage for provider $1,
+	// with activity since $2 (NULL for all time), optionally restricted to grant $3
+	SelectFunnelQuery = `
+		WITH relevant AS (
+			SELECT u.id
+			FROM users u
+			LEFT JOIN matching_profiles mp ON mp.user_id = u.id
+			LEFT JOIN grants g ON g.id = $3
+			WHERE (u.role = 'recipient' OR u.dual_role)
+			AND (
+				$3::int IS NULL
+				OR canonical_taxonomy_terms(g.sectors) && mp.sectors
+				OR canonical_taxonomy_terms(g.target_groups) && mp.target_groups
+			)
+		)
+		SELECT
+			(
+				SELECT COUNT(DISTINCT r.id)
+				FROM relevant r
+				JOIN matches tm
+					ON (tm.user_id = $1 AND tm.match_id = r.id)
+					OR (tm.user_id = r.id AND tm.match_id = $1)
+			),
+			(
+				SELECT COUNT(DISTINCT pv.viewer_id)
+				FROM profile_views pv
+				JOIN relevant r ON r.id = pv.viewer_id
+				WHERE pv.viewed_id = $1
+				AND ($2::timestamptz IS NULL OR pv.viewed_at >= $2)
+			),
+			(
+				SELECT COUNT(DISTINCT r.id)
+				FROM relevant r
+				JOIN connections c
+					ON (c.initiator_id = $1 AND c.target_id = r.id)
+					OR (c.initiator_id = r.id AND c.target_id = $1)
+				WHERE $2::timestamptz IS NULL OR c.created_at >= $2
+			),
+			(
+				SELECT COUNT(DISTINCT r.id)
+				FROM relevant r
+				JOIN connections c
+					ON (c.initiator_id = $1 AND c.target_id = r.id)
+					OR (c.initiator_id = r.id AND c.target_id = $1)
+				JOIN chat_messages cm ON cm.match_id = c.id
+				WHERE $2::timestamptz IS NULL OR cm.timestamp >= $2
+			)
+	`
+
+	// SelectProviderGrantsQuery lists a provider's grants
+	SelectProviderGrantsQuery = `
+		SELECT id, title
+		FROM grants
+		WHERE provider_id = $1
+		ORDER BY created_at DESC
+	`
+
+	// SelectUpcomingDeadlinesQuery lists future grant and provider deadlines of
+	// providers connected with user $1
+	SelectUpcomingDeadlinesQuery = `
+		WITH followed AS (
+			SELECT CASE WHEN c.initiator_id = $1 THEN c.target_id ELSE c.initiator_id END AS provider_id
+			FROM connections c
+			WHERE c.initiator_id = $1 OR c.target_id = $1
+		)
+		SELECT provider_id, organization_name, grant_id, title, deadline
+		FROM (
+			SELECT f.provider_id, COALESCE(p.organization_name, '') AS organization_name,
+				g.id AS grant_id, g.title, g.deadline
+			FROM followed f
+			JOIN grants g ON g.provider_id = f.provider_id
+			LEFT JOIN profiles p ON p.user_id = f.provider_id
+			WHERE g.deadline >= CURRENT_TIMESTAMP
+			AND COALESCE(g.status, '') <> 'closed'
+			UNION ALL
+			SELECT f.provider_id, COALESCE(p.organization_name, ''),
+				NULL, COALESCE(pd.funding_type, 'Funding deadline'), pd.deadline
+			FROM followed f
+			JOIN provider_data pd ON pd.user_id = f.provider_id
+			LEFT JOIN profiles p ON p.user_id = f.provider_id
+			WHERE pd.deadline >= CURRENT_TIMESTAMP
+		) deadlines
+		ORDER BY deadline
+		LIMIT 10
+	`
+
+	// SelectNeedsReplyQuery lists user $1's chats whose latest message was sent by
+	// the other party, skipping deleted accounts that can no longer be answered
+	SelectNeedsReplyQuery = `
+		SELECT connection_id, other_id, COALESCE(p.organization_name, ''), content, timestamp
+		FROM (
+			SELECT DISTINCT ON (cm.match_id)
+				cm.match_id AS connection_id,
+				CASE WHEN c.initiator_id = $1 THEN c.target_id ELSE c.initiator_id END AS other_id,
+				cm.sender_id,
+				cm.content,
+				cm.timestamp
+			FROM chat_messages cm
+			JOIN connections c ON c.id = cm.match_id
+			WHERE c.initiator_id = $1 OR c.target_id = $1
+			ORDER BY cm.match_id, cm.timestamp DESC
+		) latest
+		JOIN users ou ON ou.id = latest.other_id
+		LEFT JOIN profiles p ON p.user_id = latest.other_id
+		WHERE latest.sender_id <> $1
+			AND ou.deleted_at IS NULL
+		ORDER BY latest.timestamp DESC
+	`
+
+	// CountNewMatchesQuery counts user $1's stored matches first seen in the last week
+	CountNewMatchesQuery = `
+		SELECT COUNT(*)
+		FROM matches
+		WHERE user_id = $1
+		AND created_at >= CURRENT_TIMESTAMP - INTERVAL '7 days'
+	`
+
+	// SelectCompletenessQuery reports which profile and recipient fields are filled in,
+	// in the order of completenessFields
+	SelectCompletenessQuery = `
+		SELECT
+			COALESCE(p.organization_name, '') <> '',
+			COALESCE(p.mission_statement, '') <> '',
+			COALESCE(p.profile_picture_url, '') <> '',
+			COALESCE(p.state, '') <> '',
+			COALESCE(p.city, '') <> '',
+			COALESCE(p.zip_code, '') <> '',
+			COALESCE(p.ein, '') <> '',
+			COALESCE(p.applicant_type, '') <> '',
+			COALESCE(cardinality(p.sectors), 0) > 0,
+			COALESCE(cardinality(p.target_groups), 0) > 0,
+			COALESCE(p.project_stage, '') <> '',
+			COALESCE(p.website_url, '') <> '',
+			COALESCE(cardinality(rd.needs), 0) > 0,
+			rd.budget_requested IS NOT NULL,
+			rd.team_size IS NOT NULL,
+			COALESCE(rd.timeline, '') <> ''
+		FROM users u
+		LEFT JOIN profiles p ON p.user_id = u.id
+		LEFT JOIN recipient_data rd ON rd.user_id = u.id
+		WHERE u.id = $1
+	`
+)
@@ -0,0 +1,157 @@
+package directory
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// DefaultBrowseInterval is used when BROWSE_REFRESH_INTERVAL is unset or invalid
+	DefaultBrowseInterval = 15 * time.Minute
+
+	// BrowseRateLimit is how many browse requests a visitor can make a minute
+	BrowseRateLimit = 60
+
+	defaultBrowsePageSize = 50
+	maxBrowsePageSize     = 100
+)
+
+var (
+	browseProviders []BrowseProvider
+	browseLock      sync.RWMutex
+)
+
+// BrowseEnabled reports whether visitors without an account can browse
+// providers, which is soft-launched behind BROWSE_WITHOUT_ACCOUNT=true
+func BrowseEnabled() bool {
+	return os.Getenv("BROWSE_WITHOUT_ACCOUNT") == "true"
+}
+
+// StartBrowseRefresher loads the browsable providers now and then every
+// BROWSE_REFRESH_INTERVAL (Go duration, default 15m) until ctx is done, so
+// anonymous browsing never queries the database. Nothing is loaded unless
+// browsing is enabled.
+func StartBrowseRefresher(ctx context.Context, db *sql.DB) {
+	if !BrowseEnabled() {
+		return
+	}
+
+	interval := DefaultBrowseInterval
+	if value := os.Getenv("BROWSE_REFRESH_INTERVAL"); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d > 0 {
+			interval = d
+		} else {
+			log.Printf("Invalid BROWSE_REFRESH_INTERVAL %q, using %s", value, DefaultBrowseInterval)
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if err := refreshBrowse(db); err != nil {
+				log.Printf("Error loading browsable providers: %v", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// BrowseProvidersHandler returns a page of active providers with just their
+// name, sectors and funding type, optionally those in a sector, for visitors
+// without an account. It serves the list last loaded by StartBrowseRefresher.
+// Used by: /api/public/browse/providers?sector=&page=&page_size=
+// Response: BrowseResponse
+func BrowseProvidersHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if !BrowseEnabled() {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+
+		page, err := positiveIntParam(r, "page", 1)
+		if err != nil {
+			http.Error(w, "page must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		pageSize, err := positiveIntParam(r, "page_size", defaultBrowsePageSize)
+		if err != nil {
+			http.Error(w, "page_size must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		pageSize = min(pageSize, maxBrowsePageSize)
+		sector := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("sector")))
+
+		browseLock.RLock()
+		all := browseProviders
+		browseLock.RUnlock()
+		if all == nil {
+			http.Error(w, "Provider list is not available yet", http.StatusServiceUnavailable)
+			return
+		}
+
+		matching := all
+		if sector != "" {
+			matching = []BrowseProvider{}
+			for _, p := range all {
+				for _, s := range p.Sectors {
+					if strings.ToLower(s) == sector {
+						matching = append(matching, p)
+						break
+					}
+				}
+			}
+		}
+
+		response := BrowseResponse{Providers: []BrowseProvider{}, Page: page, PageSize: pageSize, Total: len(matching)}
+		if start := (page - 1) * pageSize; start < len(matching) {
+			response.Providers = matching[start:min(start+pageSize, len(matching))]
+		}
+
+		w.Header().Set("Cache-Control", "public, max-age=900, stale-while-revalidate=3600")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// refreshBrowse reloads the browsable providers
+func refreshBrowse(db *sql.DB) error {
+	rows, err := db.Query(SelectBrowseProvidersQuery)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	providers := []BrowseProvider{}
+	for rows.Next() {
+		var p BrowseProvider
+		if err := rows.Scan(&p.ID, &p.OrganizationName, pq.Array(&p.Sectors), &p.FundingType, &p.Listed); err != nil {
+			return err
+		}
+		providers = append(providers, p)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	browseLock.Lock()
+	browseProviders = providers
+	browseLock.Unlock()
+	return nil
+}
@@ -0,0 +1,147 @@
+package directory
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"matcherator/backend/handlers/faq"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+const (
+	defaultPageSize = 24
+	maxPageSize     = 100
+)
+
+// ListProvidersHandler returns a page of providers that opted in to the public
+// directory. No authentication is required.
+// Used by: /api/public/providers?page=&page_size=
+// Response: DirectoryResponse
+func ListProvidersHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		page, err := positiveIntParam(r, "page", 1)
+		if err != nil {
+			http.Error(w, "page must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		pageSize, err := positiveIntParam(r, "page_size", defaultPageSize)
+		if err != nil {
+			http.Error(w, "page_size must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		pageSize = min(pageSize, maxPageSize)
+
+		response := DirectoryResponse{Providers: []PublicProvider{}, Page: page, PageSize: pageSize}
+		if err := db.QueryRow(CountListedProvidersQuery).Scan(&response.Total); err != nil {
+			log.Printf("Error counting directory providers: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		rows, err := db.Query(SelectListedProvidersQuery, pageSize, (page-1)*pageSize)
+		if err != nil {
+			log.Printf("Error querying directory providers: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			provider, err := scanPublicProvider(rows)
+			if err != nil {
+				log.Printf("Error scanning directory provider: %v", err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+			response.Providers = append(response.Providers, *provider)
+		}
+		if err := rows.Err(); err != nil {
+			log.Printf("Error iterating directory providers: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// GetProviderHandler returns one provider from the public directory, with
+// their FAQ and publicly answered questions
+// Used by: /api/public/providers/{id}
+// Response: PublicProvider
+func GetProviderHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid provider ID", http.StatusBadRequest)
+			return
+		}
+
+		provider, err := scanPublicProvider(db.QueryRow(SelectListedProviderQuery, id))
+		if err == sql.ErrNoRows {
+			http.Error(w, "Provider not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error fetching directory provider %d: %v", id, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		provider.FAQs, err = faq.LoadProviderFAQs(db, id)
+		if err != nil {
+			log.Printf("Error fetching FAQs for directory provider %d: %v", id, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		json.NewEncoder(w).Encode(provider)
+	}
+}
+
+// scanPublicProvider reads a row selected with publicProviderColumns
+func scanPublicProvider(row interface{ Scan(...interface{}) error }) (*PublicProvider, error) {
+	var p PublicProvider
+	err := row.Scan(
+		&p.ID,
+		&p.OrganizationName,
+		&p.ProfilePictureURL,
+		&p.ProfilePictureAlt,
+		&p.MissionStatement,
+		&p.Location,
+		&p.State,
+		&p.City,
+		pq.Array(&p.Sectors),
+		pq.Array(&p.TargetGroups),
+		&p.WebsiteURL,
+		&p.UpdatedAt,
+		&p.Claimable,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// positiveIntParam reads a positive integer query parameter, or fallback when absent
+func positiveIntParam(r *http.Request, name string, fallback int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return 0, strconv.ErrSyntax
+	}
+	return n, nil
+}
@@ -0,0 +1,73 @@
+package directory
+
+import (
+	"encoding/xml"
+	"time"
+
+	"matcherator/backend/handlers/faq"
+)
+
+// PublicProvider is the part of a provider profile shown to anonymous visitors
+type PublicProvider struct {
+	ID                int       `json:"id"`
+	OrganizationName  string    `json:"organization_name"`
+	ProfilePictureURL *string   `json:"profile_picture_url"`
+	ProfilePictureAlt *string   `json:"profile_picture_alt"`
+	MissionStatement  string    `json:"mission_statement"`
+	Location          string    `json:"location"`
+	State             string    `json:"state"`
+	City              string    `json:"city"`
+	Sectors           []string  `json:"sectors"`
+	TargetGroups      []string  `json:"target_groups"`
+	WebsiteURL        string    `json:"website_url"`
+	UpdatedAt         time.Time `json:"updated_at"`
+
+	// Claimable is set for imported organizations nobody has claimed yet;
+	// their staff can claim them through /api/public/providers/{id}/claims
+	Claimable bool `json:"claimable"`
+
+	// FAQs is only included when a single provider is fetched
+	FAQs *faq.ProviderFAQs `json:"faqs,omitempty"`
+}
+
+// DirectoryResponse is one page of the public provider directory
+type DirectoryResponse struct {
+	Providers []PublicProvider `json:"providers"`
+	Page      int              `json:"page"`
+	PageSize  int              `json:"page_size"`
+	Total     int              `json:"total"`
+}
+
+// BrowseProvider is what visitors without an account see of a provider: no
+// contact details or description
+type BrowseProvider struct {
+	ID               int      `json:"id"`
+	OrganizationName string   `json:"organization_name"`
+	Sectors          []string `json:"sectors"`
+	FundingType      string   `json:"funding_type"`
+
+	// Listed is set for providers in the public directory, whose full page
+	// can be fetched from /api/public/providers/{id}
+	Listed bool `json:"listed"`
+}
+
+// BrowseResponse is one page of providers browsed without an account
+type BrowseResponse struct {
+	Providers []BrowseProvider `json:"providers"`
+	Page      int              `json:"page"`
+	PageSize  int              `json:"page_size"`
+	Total     int              `json:"total"`
+}
+
+// sitemapURLSet is the root element of a sitemaps.org sitemap
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+// sitemapURL is one page listed in the sitemap
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
@@ -0,0 +1,72 @@
+package directory
+
+// listedProvidersFilter selects active providers that opted in to the directory
+const listedProvidersFilter = `
+		FROM profiles p
+		JOIN users u ON u.id = p.user_id
+		WHERE p.public_listing
+			AND (u.role = 'provider' OR u.dual_role)
+			AND u.status = 'active'
+			AND u.deactivated_at IS NULL
+`
+
+const (
+	// publicProviderColumns are the columns read by scanPublicProvider
+	publicProviderColumns = `
+		SELECT
+			p.user_id,
+			p.organization_name,
+			p.profile_picture_url,
+			p.profile_picture_alt,
+			COALESCE(p.mission_statement, ''),
+			COALESCE(p.location, ''),
+			COALESCE(p.state, ''),
+			COALESCE(p.city, ''),
+			COALESCE(p.sectors, '{}'),
+			COALESCE(p.target_groups, '{}'),
+			COALESCE(p.website_url, ''),
+			COALESCE(p.updated_at, p.created_at),
+			u.imported_from IS NOT NULL AND u.claimed_at IS NULL
+	`
+
+	// CountListedProvidersQuery counts the providers in the directory
+	CountListedProvidersQuery = `SELECT COUNT(*)` + listedProvidersFilter
+
+	// SelectListedProvidersQuery pages through the directory alphabetically
+	SelectListedProvidersQuery = publicProviderColumns + listedProvidersFilter + `
+		ORDER BY p.organization_name, p.user_id
+		LIMIT $1 OFFSET $2
+	`
+
+	// SelectListedProviderQuery fetches one provider from the directory
+	SelectListedProviderQuery = publicProviderColumns + listedProvidersFilter + `
+			AND p.user_id = $1
+	`
+
+	// SelectSitemapEntriesQuery lists every directory page with its last change
+	SelectSitemapEntriesQuery = `
+		SELECT p.user_id, COALESCE(p.updated_at, p.created_at)` + listedProvidersFilter + `
+		ORDER BY p.user_id
+		LIMIT $1
+	`
+
+	// SelectBrowseProvidersQuery lists every active provider for browsing
+	// without an account, alphabetically
+	SelectBrowseProvidersQuery = `
+		SELECT
+			u.id,
+			p.organization_name,
+			COALESCE(p.sectors, '{}'),
+			COALESCE(pd.funding_type, ''),
+			p.public_listing AND (u.role = 'provider' OR u.dual_role)
+		FROM users u
+		JOIN profiles p ON p.user_id = u.id
+		LEFT JOIN provider_data pd ON pd.user_id = u.id
+		WHERE (u.role = 'provider' OR u.dual_role)
+			AND u.status = 'active'
+			AND u.deactivated_at IS NULL
+			AND u.deleted_at IS NULL
+			AND u.merged_into IS NULL
+		ORDER BY p.organization_name, u.id
+	`
+)
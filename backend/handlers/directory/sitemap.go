@@ -0,0 +1,123 @@
+package directory
+
+import (
+	"context"
+	"database/sql"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultSitemapInterval is used when SITEMAP_REFRESH_INTERVAL is unset or invalid
+	DefaultSitemapInterval = time.Hour
+
+	// maxSitemapURLs is the sitemaps.org limit for a single file
+	maxSitemapURLs = 50000
+)
+
+var (
+	sitemapXML  []byte
+	sitemapLock sync.RWMutex
+)
+
+// StartSitemapRefresher generates the sitemap now and then every
+// SITEMAP_REFRESH_INTERVAL (Go duration, default 1h) until ctx is done
+func StartSitemapRefresher(ctx context.Context, db *sql.DB) {
+	interval := DefaultSitemapInterval
+	if value := os.Getenv("SITEMAP_REFRESH_INTERVAL"); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d > 0 {
+			interval = d
+		} else {
+			log.Printf("Invalid SITEMAP_REFRESH_INTERVAL %q, using %s", value, DefaultSitemapInterval)
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if err := refreshSitemap(db); err != nil {
+				log.Printf("Error generating sitemap: %v", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// SitemapHandler serves the most recently generated sitemap
+// Used by: /sitemap.xml
+// Response: sitemaps.org XML
+func SitemapHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sitemapLock.RLock()
+		body := sitemapXML
+		sitemapLock.RUnlock()
+
+		if body == nil {
+			http.Error(w, "Sitemap is not available", http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		w.Write(body)
+	}
+}
+
+// refreshSitemap rebuilds the cached sitemap from the directory. Page URLs are
+// built from FRONTEND_URL, without which no sitemap is served.
+func refreshSitemap(db *sql.DB) error {
+	baseURL := strings.TrimRight(os.Getenv("FRONTEND_URL"), "/")
+	if baseURL == "" {
+		return fmt.Errorf("FRONTEND_URL is not set")
+	}
+
+	rows, err := db.Query(SelectSitemapEntriesQuery, maxSitemapURLs-1)
+	if err != nil {
+		return fmt.Errorf("error querying sitemap entries: %v", err)
+	}
+	defer rows.Close()
+
+	urlSet := sitemapURLSet{
+		XMLNS: "http://www.sitemaps.org/schemas/sitemap/0.9",
+		URLs:  []sitemapURL{{Loc: baseURL + "/directory"}},
+	}
+	for rows.Next() {
+		var id int
+		var updatedAt time.Time
+		if err := rows.Scan(&id, &updatedAt); err != nil {
+			return fmt.Errorf("error scanning sitemap entry: %v", err)
+		}
+		urlSet.URLs = append(urlSet.URLs, sitemapURL{
+			Loc:     baseURL + "/directory/" + strconv.Itoa(id),
+			LastMod: updatedAt.UTC().Format("2006-01-02"),
+		})
+	}
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("error iterating sitemap entries: %v", err)
+	}
+
+	body, err := xml.MarshalIndent(urlSet, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding sitemap: %v", err)
+	}
+	body = append([]byte(xml.Header), body...)
+
+	sitemapLock.Lock()
+	sitemapXML = body
+	sitemapLock.Unlock()
+	return nil
+}
@@ -0,0 +1,498 @@
+package events
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"matcherator/backend/handlers/auth"
+	"matcherator/backend/handlers/httputil"
+	"matcherator/backend/handlers/notifications"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// maxUpcomingEvents caps the upcoming events a single provider hosts
+	maxUpcomingEvents = 50
+	maxTitleLen       = 200
+	maxDescriptionLen = 5000
+	maxLinkLen        = 500
+	maxCapacity       = 100000
+)
+
+// Notification types sent about events
+const (
+	NotificationPosted    = "event_posted"
+	NotificationCancelled = "event_cancelled"
+	NotificationRSVP      = "event_rsvp"
+	NotificationReminder  = "event_reminder"
+)
+
+// GetEventsHandler lists upcoming events from providers the user is matched
+// or connected with, soonest first. Pass ?hosted=true to list the events the
+// user hosts instead.
+// Used by: /api/me/events
+// Response: []Event
+func GetEventsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		query := SelectUpcomingEventsQuery
+		if hosted := r.URL.Query().Get("hosted"); hosted != "" {
+			h, err := strconv.ParseBool(hosted)
+			if err != nil {
+				http.Error(w, "Hosted must be true or false", http.StatusBadRequest)
+				return
+			}
+			if h {
+				query = SelectHostedEventsQuery
+			}
+		}
+
+		rows, err := db.Query(query, userID)
+		if err != nil {
+			log.Printf("Error querying events for user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		events := []Event{}
+		for rows.Next() {
+			event, err := scanEvent(rows)
+			if err != nil {
+				log.Printf("Error scanning event: %v", err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+			events = append(events, event)
+		}
+
+		if err = rows.Err(); err != nil {
+			log.Printf("Error iterating events: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(events)
+	}
+}
+
+// CreateEventHandler lets a provider post an info session or webinar and
+// announces it to the recipients they are matched or connected with
+// Used by: /api/me/events
+// Response: Event
+func CreateEventHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req CreateEventRequest
+		if !httputil.DecodeJSON(w, r, &req) {
+			return
+		}
+
+		// Titles are single-line; they also make up reminder email subjects
+		req.Title = strings.Join(strings.Fields(req.Title), " ")
+		req.Description = strings.TrimSpace(req.Description)
+		req.Link = strings.TrimSpace(req.Link)
+		if req.Title == "" {
+			http.Error(w, "Title is required", http.StatusBadRequest)
+			return
+		}
+		if utf8.RuneCountInString(req.Title) > maxTitleLen {
+			http.Error(w, fmt.Sprintf("Title must be at most %d characters", maxTitleLen), http.StatusBadRequest)
+			return
+		}
+		if utf8.RuneCountInString(req.Description) > maxDescriptionLen {
+			http.Error(w, fmt.Sprintf("Description must be at most %d characters", maxDescriptionLen), http.StatusBadRequest)
+			return
+		}
+		if req.StartsAt.IsZero() {
+			http.Error(w, "Start time is required", http.StatusBadRequest)
+			return
+		}
+		if !req.StartsAt.After(time.Now()) {
+			http.Error(w, "Start time must be in the future", http.StatusBadRequest)
+			return
+		}
+		if !validLink(req.Link) {
+			http.Error(w, fmt.Sprintf("Link must be an http(s) URL of at most %d characters", maxLinkLen), http.StatusBadRequest)
+			return
+		}
+		if req.Capacity != nil && (*req.Capacity < 1 || *req.Capacity > maxCapacity) {
+			http.Error(w, fmt.Sprintf("Capacity must be between 1 and %d, or left empty for unlimited", maxCapacity), http.StatusBadRequest)
+			return
+		}
+
+		var canHost bool
+		err = db.QueryRow(SelectUserRoleQuery, userID).Scan(&canHost)
+		if err == sql.ErrNoRows {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error loading role for user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if !canHost {
+			http.Error(w, "Only providers can post events", http.StatusForbidden)
+			return
+		}
+
+		var upcoming int
+		if err := db.QueryRow(CountUpcomingHostedQuery, userID).Scan(&upcoming); err != nil {
+			log.Printf("Error counting events for user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if upcoming >= maxUpcomingEvents {
+			http.Error(w, fmt.Sprintf("You can host at most %d upcoming events", maxUpcomingEvents), http.StatusConflict)
+			return
+		}
+
+		var eventID int
+		err = db.QueryRow(InsertEventQuery, userID, req.Title, req.Description, req.StartsAt, req.Link, req.Capacity).Scan(&eventID)
+		if err != nil {
+			log.Printf("Error creating event for user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		event, err := scanEvent(db.QueryRow(SelectEventQuery, userID, eventID))
+		if err != nil {
+			log.Printf("Error loading event %d: %v", eventID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		announce(db, event)
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(event)
+	}
+}
+
+// CancelEventHandler lets the host of an event cancel it; everyone who RSVPed
+// to an upcoming event is notified
+// Used by: /api/me/events/{id}
+// Response: 204 No Content
+func CancelEventHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		eventID, ok := eventVar(w, r)
+		if !ok {
+			return
+		}
+
+		rows, err := db.Query(DeleteEventQuery, eventID, userID)
+		if err != nil {
+			log.Printf("Error cancelling event %d: %v", eventID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		var title string
+		var startsAt time.Time
+		var attendees []int
+		found := false
+		for rows.Next() {
+			var attendee sql.NullInt64
+			if err := rows.Scan(&title, &startsAt, &attendee); err != nil {
+				log.Printf("Error scanning cancelled event: %v", err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+			found = true
+			if attendee.Valid {
+				attendees = append(attendees, int(attendee.Int64))
+			}
+		}
+		if err = rows.Err(); err != nil {
+			log.Printf("Error iterating cancelled event: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		rows.Close()
+
+		if !found {
+			http.Error(w, "Event not found", http.StatusNotFound)
+			return
+		}
+
+		if startsAt.After(time.Now()) {
+			content := fmt.Sprintf("Event cancelled: \"%s\" on %s", title, startsAt.UTC().Format("Jan 2, 2006 15:04 MST"))
+			for _, attendee := range attendees {
+				notifications.Notify(db, attendee, NotificationCancelled, content)
+			}
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// GetAttendeesHandler lists who RSVPed to an event the user hosts
+// Used by: /api/me/events/{id}/attendees
+// Response: []Attendee
+func GetAttendeesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		eventID, ok := eventVar(w, r)
+		if !ok {
+			return
+		}
+
+		var hostID int
+		err = db.QueryRow(SelectEventHostQuery, eventID).Scan(&hostID)
+		if err == sql.ErrNoRows || (err == nil && hostID != userID) {
+			http.Error(w, "Event not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error loading event %d: %v", eventID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		rows, err := db.Query(SelectAttendeesQuery, eventID, userID)
+		if err != nil {
+			log.Printf("Error querying attendees for event %d: %v", eventID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		attendees := []Attendee{}
+		for rows.Next() {
+			var a Attendee
+			if err := rows.Scan(&a.UserID, &a.OrganizationName, &a.Email, &a.RSVPedAt); err != nil {
+				log.Printf("Error scanning attendee: %v", err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+			attendees = append(attendees, a)
+		}
+
+		if err = rows.Err(); err != nil {
+			log.Printf("Error iterating attendees: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(attendees)
+	}
+}
+
+// RSVPHandler signs the user up for an upcoming event they can see, as long as
+// it has spots left. RSVPing twice is a no-op.
+// Used by: /api/events/{id}/rsvp
+// Response: Event
+func RSVPHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		eventID, ok := eventVar(w, r)
+		if !ok {
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		// Lock the event so concurrent RSVPs can't overfill it
+		event, err := scanEvent(tx.QueryRow(SelectVisibleEventQuery, userID, eventID))
+		if err == sql.ErrNoRows {
+			http.Error(w, "Event not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error loading event %d: %v", eventID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if event.RSVPed {
+			json.NewEncoder(w).Encode(event)
+			return
+		}
+		if !event.StartsAt.After(time.Now()) {
+			http.Error(w, "Event has already started", http.StatusConflict)
+			return
+		}
+		if event.SpotsLeft != nil && *event.SpotsLeft == 0 {
+			http.Error(w, "Event is full", http.StatusConflict)
+			return
+		}
+
+		if _, err := tx.Exec(InsertRSVPQuery, eventID, userID); err != nil {
+			log.Printf("Error saving RSVP to event %d: %v", eventID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		event.RSVPed = true
+		event.RSVPCount++
+		if event.SpotsLeft != nil {
+			*event.SpotsLeft--
+		}
+
+		notifications.Notify(db, event.ProviderID, NotificationRSVP, fmt.Sprintf("New RSVP for \"%s\"", event.Title))
+
+		json.NewEncoder(w).Encode(event)
+	}
+}
+
+// CancelRSVPHandler withdraws the user's RSVP to an upcoming event
+// Used by: /api/events/{id}/rsvp
+// Response: 204 No Content
+func CancelRSVPHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		eventID, ok := eventVar(w, r)
+		if !ok {
+			return
+		}
+
+		result, err := db.Exec(DeleteRSVPQuery, eventID, userID)
+		if err != nil {
+			log.Printf("Error withdrawing RSVP to event %d: %v", eventID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			http.Error(w, "RSVP not found", http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// announce notifies the recipients matched or connected with the host of a
+// newly posted event
+func announce(db *sql.DB, event Event) {
+	rows, err := db.Query(SelectAudienceQuery, event.ProviderID)
+	if err != nil {
+		// Don't fail the request as the event was still saved successfully
+		log.Printf("Error querying audience for event %d: %v", event.ID, err)
+		return
+	}
+	defer rows.Close()
+
+	var audience []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			log.Printf("Error scanning audience for event %d: %v", event.ID, err)
+			return
+		}
+		audience = append(audience, id)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating audience for event %d: %v", event.ID, err)
+		return
+	}
+	rows.Close()
+
+	host := event.ProviderName
+	if host == "" {
+		host = "A funder"
+	}
+	content := fmt.Sprintf("%s posted \"%s\" on %s", host, event.Title, event.StartsAt.UTC().Format("Jan 2, 2006 15:04 MST"))
+	for _, id := range audience {
+		notifications.Notify(db, id, NotificationPosted, content)
+	}
+}
+
+// validLink reports whether link is an absolute http(s) URL short enough to store
+func validLink(link string) bool {
+	if link == "" || len(link) > maxLinkLen {
+		return false
+	}
+	u, err := url.Parse(link)
+	return err == nil && (u.Scheme == "https" || u.Scheme == "http") && u.Host != ""
+}
+
+// eventVar parses the event ID from the route
+func eventVar(w http.ResponseWriter, r *http.Request) (int, bool) {
+	eventID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid event ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return eventID, true
+}
+
+// scanEvent reads a row selected with eventColumns
+func scanEvent(row interface{ Scan(...interface{}) error }) (Event, error) {
+	var event Event
+	var capacity sql.NullInt64
+	err := row.Scan(&event.ID, &event.ProviderID, &event.ProviderName, &event.Title, &event.Description,
+		&event.StartsAt, &event.Link, &capacity, &event.RSVPCount, &event.RSVPed, &event.CreatedAt)
+	if err != nil {
+		return event, err
+	}
+	if capacity.Valid {
+		c := int(capacity.Int64)
+		left := c - event.RSVPCount
+		if left < 0 {
+			left = 0
+		}
+		event.Capacity = &c
+		event.SpotsLeft = &left
+	}
+	return event, nil
+}
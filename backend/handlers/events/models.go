@@ -0,0 +1,36 @@
+package events
+
+import "time"
+
+// Event is an info session or webinar a provider hosts
+type Event struct {
+	ID           int       `json:"id"`
+	ProviderID   int       `json:"provider_id"`
+	ProviderName string    `json:"provider_name"`
+	Title        string    `json:"title"`
+	Description  string    `json:"description"`
+	StartsAt     time.Time `json:"starts_at"`
+	Link         string    `json:"link"`
+	Capacity     *int      `json:"capacity"`   // null for unlimited
+	RSVPCount    int       `json:"rsvp_count"` // attendees who said they're coming
+	SpotsLeft    *int      `json:"spots_left"` // null for unlimited
+	RSVPed       bool      `json:"rsvped"`     // whether the requesting user is coming
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// CreateEventRequest posts an event; capacity is optional
+type CreateEventRequest struct {
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	StartsAt    time.Time `json:"starts_at"`
+	Link        string    `json:"link"`
+	Capacity    *int      `json:"capacity"`
+}
+
+// Attendee is someone who RSVPed to an event, as its host sees them
+type Attendee struct {
+	UserID           int       `json:"user_id"`
+	OrganizationName string    `json:"organization_name"`
+	Email            string    `json:"email"`
+	RSVPedAt         time.Time `json:"rsvped_at"`
+}
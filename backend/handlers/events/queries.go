@@ -0,0 +1,170 @@
+package events
+
+// eventColumns selects an Event for the user $1; callers join users h (the host)
+// and profiles hp
+const eventColumns = `
+	e.id, e.provider_id, COALESCE(hp.organization_name, ''), e.title, COALESCE(e.description, ''),
+	e.starts_at, e.link, e.capacity,
+	(SELECT COUNT(*) FROM event_rsvps r WHERE r.event_id = e.id),
+	EXISTS (SELECT 1 FROM event_rsvps r WHERE r.event_id = e.id AND r.user_id = $1),
+	e.created_at`
+
+// audienceFilter is true when the user $1 may see event e: they are matched
+// with its host or connected to them either way, or have already RSVPed
+const audienceFilter = `(
+		EXISTS (SELECT 1 FROM matches tm WHERE tm.user_id = $1 AND tm.match_id = e.provider_id)
+		OR EXISTS (
+			SELECT 1 FROM connections c
+			WHERE (c.initiator_id = $1 AND c.target_id = e.provider_id)
+			   OR (c.initiator_id = e.provider_id AND c.target_id = $1)
+		)
+		OR EXISTS (SELECT 1 FROM event_rsvps r WHERE r.event_id = e.id AND r.user_id = $1)
+	)`
+
+const (
+	// SelectUpcomingEventsQuery lists the upcoming events the user $1 may
+	// attend, soonest first
+	SelectUpcomingEventsQuery = `
+		SELECT ` + eventColumns + `
+		FROM provider_events e
+		JOIN users h ON h.id = e.provider_id
+		LEFT JOIN profiles hp ON hp.user_id = e.provider_id
+		WHERE e.starts_at > CURRENT_TIMESTAMP
+			AND e.provider_id <> $1
+			AND h.deleted_at IS NULL
+			AND ` + audienceFilter + `
+		ORDER BY e.starts_at, e.id
+	`
+
+	// SelectHostedEventsQuery lists the upcoming events the user $1 hosts,
+	// soonest first
+	SelectHostedEventsQuery = `
+		SELECT ` + eventColumns + `
+		FROM provider_events e
+		JOIN users h ON h.id = e.provider_id
+		LEFT JOIN profiles hp ON hp.user_id = e.provider_id
+		WHERE e.provider_id = $1 AND e.starts_at > CURRENT_TIMESTAMP
+		ORDER BY e.starts_at, e.id
+	`
+
+	// SelectVisibleEventQuery returns an event the user $1 may attend, locking
+	// it so RSVPs can't exceed its capacity
+	SelectVisibleEventQuery = `
+		SELECT ` + eventColumns + `
+		FROM provider_events e
+		JOIN users h ON h.id = e.provider_id
+		LEFT JOIN profiles hp ON hp.user_id = e.provider_id
+		WHERE e.id = $2 AND e.provider_id <> $1 AND ` + audienceFilter + `
+		FOR UPDATE OF e
+	`
+
+	// SelectUserRoleQuery returns whether the user can host events
+	SelectUserRoleQuery = `
+		SELECT role = 'provider' OR dual_role FROM users WHERE id = $1
+	`
+
+	// CountUpcomingHostedQuery counts the upcoming events a provider hosts
+	CountUpcomingHostedQuery = `
+		SELECT COUNT(*) FROM provider_events
+		WHERE provider_id = $1 AND starts_at > CURRENT_TIMESTAMP
+	`
+
+	// InsertEventQuery creates an event
+	InsertEventQuery = `
+		INSERT INTO provider_events (provider_id, title, description, starts_at, link, capacity)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6)
+		RETURNING id
+	`
+
+	// SelectEventQuery returns one event for the user $1
+	SelectEventQuery = `
+		SELECT ` + eventColumns + `
+		FROM provider_events e
+		JOIN users h ON h.id = e.provider_id
+		LEFT JOIN profiles hp ON hp.user_id = e.provider_id
+		WHERE e.id = $2
+	`
+
+	// SelectAudienceQuery returns the active recipients an event is announced
+	// to: those matched with the host or connected to them either way
+	SelectAudienceQuery = `
+		SELECT u.id
+		FROM users u
+		WHERE u.id <> $1
+			AND (u.role = 'recipient' OR u.dual_role)
+			AND u.deactivated_at IS NULL
+			AND u.deleted_at IS NULL
+			AND (
+				EXISTS (SELECT 1 FROM matches tm WHERE tm.user_id = u.id AND tm.match_id = $1)
+				OR EXISTS (
+					SELECT 1 FROM connections c
+					WHERE (c.initiator_id = u.id AND c.target_id = $1)
+					   OR (c.initiator_id = $1 AND c.target_id = u.id)
+				)
+			)
+	`
+
+	// DeleteEventQuery cancels an event its host no longer holds and returns
+	// its title and who had RSVPed
+	DeleteEventQuery = `
+		WITH deleted AS (
+			DELETE FROM provider_events
+			WHERE id = $1 AND provider_id = $2
+			RETURNING id, title, starts_at
+		)
+		SELECT d.title, d.starts_at, r.user_id
+		FROM deleted d
+		LEFT JOIN event_rsvps r ON r.event_id = d.id
+	`
+
+	// InsertRSVPQuery records that the user is coming
+	InsertRSVPQuery = `
+		INSERT INTO event_rsvps (event_id, user_id)
+		VALUES ($1, $2)
+		ON CONFLICT (event_id, user_id) DO NOTHING
+	`
+
+	// DeleteRSVPQuery withdraws the user's RSVP to an upcoming event
+	DeleteRSVPQuery = `
+		DELETE FROM event_rsvps r
+		USING provider_events e
+		WHERE r.event_id = $1 AND r.user_id = $2
+			AND e.id = r.event_id AND e.starts_at > CURRENT_TIMESTAMP
+	`
+
+	// SelectAttendeesQuery lists who RSVPed to an event the user $2 hosts
+	SelectAttendeesQuery = `
+		SELECT u.id, COALESCE(p.organization_name, ''), u.email, r.created_at
+		FROM event_rsvps r
+		JOIN provider_events e ON e.id = r.event_id
+		JOIN users u ON u.id = r.user_id
+		LEFT JOIN profiles p ON p.user_id = u.id
+		WHERE r.event_id = $1 AND e.provider_id = $2
+		ORDER BY r.created_at, u.id
+	`
+
+	// SelectEventHostQuery returns the host of an event
+	SelectEventHostQuery = `
+		SELECT provider_id FROM provider_events WHERE id = $1
+	`
+
+	// ClaimDueRemindersQuery marks the RSVPs of events starting within the lead
+	// time as reminded and returns who to remind. Claiming in one statement
+	// keeps several backend instances from reminding twice.
+	ClaimDueRemindersQuery = `
+		WITH due AS (
+			UPDATE event_rsvps r
+			SET reminded_at = CURRENT_TIMESTAMP
+			FROM provider_events e
+			WHERE e.id = r.event_id
+				AND r.reminded_at IS NULL
+				AND e.starts_at > CURRENT_TIMESTAMP
+				AND e.starts_at <= CURRENT_TIMESTAMP + $1 * INTERVAL '1 second'
+			RETURNING r.event_id, r.user_id, e.title, e.starts_at, e.link
+		)
+		SELECT d.event_id, d.title, d.starts_at, d.link, u.id, u.email
+		FROM due d
+		JOIN users u ON u.id = d.user_id
+		WHERE u.deactivated_at IS NULL
+	`
+)
@@ -0,0 +1,58 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"matcherator/backend/handlers/notifications"
+)
+
+const (
+	// DefaultReminderInterval is how often upcoming events are checked for
+	DefaultReminderInterval = 15 * time.Minute
+	// DefaultReminderLead is how long before an event starts its reminder goes out
+	DefaultReminderLead = 24 * time.Hour
+)
+
+// StartReminders reminds everyone who RSVPed to an event once it starts within
+// EVENT_REMINDER_LEAD (Go duration, default 24h), checking every
+// EVENT_REMINDER_INTERVAL (default 15m) until ctx is done. RSVPs made inside
+// the lead time are reminded on the next check.
+func StartReminders(ctx context.Context, db *sql.DB) {
+	lead := notifications.DurationFromEnv("EVENT_REMINDER_LEAD", DefaultReminderLead)
+	notifications.Reminders{
+		Name:     "event",
+		Interval: notifications.DurationFromEnv("EVENT_REMINDER_INTERVAL", DefaultReminderInterval),
+		Claim: func(db *sql.DB) (*sql.Rows, error) {
+			return db.Query(ClaimDueRemindersQuery, int64(lead/time.Second))
+		},
+		Message: reminderMessage,
+	}.Start(ctx, db)
+}
+
+// reminderMessage reminds an attendee of a claimed RSVP that the event starts soon
+func reminderMessage(rows *sql.Rows) (notifications.Reminder, error) {
+	var eventID, userID int
+	var title, link, email string
+	var startsAt time.Time
+	if err := rows.Scan(&eventID, &title, &startsAt, &link, &userID, &email); err != nil {
+		return notifications.Reminder{}, err
+	}
+
+	when := startsAt.UTC().Format("Mon Jan 2, 2006 15:04 MST")
+	return notifications.Reminder{
+		UserID:  userID,
+		Email:   email,
+		Type:    NotificationReminder,
+		Content: fmt.Sprintf("Reminder: \"%s\" starts %s", title, when),
+		Subject: "Reminder: " + title,
+		Body: fmt.Sprintf(`This is a reminder that "%s", which you RSVPed to, starts %s.
+
+Join here:
+%s
+`, title, when, link),
+		About: fmt.Sprintf("event %d", eventID),
+	}, nil
+}
@@ -0,0 +1,348 @@
+package faq
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"matcherator/backend/handlers/auth"
+	"matcherator/backend/handlers/httputil"
+	"matcherator/backend/services/moderation"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// maxFAQs caps the FAQ entries on a provider profile
+	maxFAQs = 50
+	// maxPublicAnswers caps the publicly answered questions shown on a profile
+	maxPublicAnswers = 50
+
+	maxQuestionLen = 500
+	maxAnswerLen   = 4000
+)
+
+// GetMyFAQsHandler lists the provider's own FAQ entries
+// Used by: /api/me/faqs
+// Response: []FAQ
+func GetMyFAQsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		faqs, err := loadFAQs(db, userID)
+		if err != nil {
+			log.Printf("Error loading FAQs for user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(faqs)
+	}
+}
+
+// CreateFAQHandler adds an entry to the provider's FAQ
+// Used by: /api/me/faqs
+// Response: FAQ
+func CreateFAQHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		req, ok := decodeFAQ(w, r)
+		if !ok || !requireRole(w, db, userID, "provider") {
+			return
+		}
+
+		faq, err := scanFAQ(db.QueryRow(InsertFAQQuery, userID, req.Question, req.Answer, req.Position, maxFAQs))
+		if err == sql.ErrNoRows {
+			http.Error(w, fmt.Sprintf("A profile can have at most %d FAQ entries", maxFAQs), http.StatusConflict)
+			return
+		} else if err != nil {
+			log.Printf("Error creating FAQ for user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		recordFlags(db, userID, faq.ID, req)
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(faq)
+	}
+}
+
+// UpdateFAQHandler replaces one of the provider's FAQ entries
+// Used by: /api/me/faqs/{id}
+// Response: FAQ
+func UpdateFAQHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid FAQ ID", http.StatusBadRequest)
+			return
+		}
+
+		req, ok := decodeFAQ(w, r)
+		if !ok {
+			return
+		}
+
+		faq, err := scanFAQ(db.QueryRow(UpdateFAQQuery, id, userID, req.Question, req.Answer, req.Position))
+		if err == sql.ErrNoRows {
+			http.Error(w, "FAQ not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error updating FAQ %d: %v", id, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		recordFlags(db, userID, faq.ID, req)
+
+		json.NewEncoder(w).Encode(faq)
+	}
+}
+
+// DeleteFAQHandler removes one of the provider's FAQ entries
+// Used by: /api/me/faqs/{id}
+// Response: 204 No Content
+func DeleteFAQHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid FAQ ID", http.StatusBadRequest)
+			return
+		}
+
+		result, err := db.Exec(DeleteFAQQuery, id, userID)
+		if err != nil {
+			log.Printf("Error deleting FAQ %d: %v", id, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			http.Error(w, "FAQ not found", http.StatusNotFound)
+			return
+		}
+
+		if err := moderation.Clear(db, moderation.ContentFAQ, id); err != nil {
+			// Don't return error here as the FAQ was still deleted successfully
+			log.Printf("Error clearing moderation flags of FAQ %d: %v", id, err)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// GetProfileFAQsHandler returns a provider's FAQ and public answers, with the
+// questions the signed-in user asked them and whether they may ask more
+// Used by: /api/users/{id}/faqs
+// Response: ProfileFAQsResponse
+func GetProfileFAQsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		providerID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		var providerRole string
+		var dualRole bool
+		err = db.QueryRow(SelectUserRoleQuery, providerID).Scan(&providerRole, &dualRole)
+		if err == sql.ErrNoRows || (err == nil && providerRole != "provider" && !dualRole) {
+			http.Error(w, "Provider not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error loading user %d: %v", providerID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		public, err := LoadProviderFAQs(db, providerID)
+		if err != nil {
+			log.Printf("Error loading FAQs for provider %d: %v", providerID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		response := ProfileFAQsResponse{ProviderFAQs: *public, MyQuestions: []Question{}}
+		if userID != providerID {
+			response.MyQuestions, err = loadQuestions(db, SelectAskedQuestionsQuery, providerID, userID)
+			if err == nil {
+				response.CanAsk, err = canAsk(db, userID, providerID)
+			}
+			if err != nil {
+				log.Printf("Error loading questions of user %d to provider %d: %v", userID, providerID, err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// LoadProviderFAQs returns the publicly visible Q&A section of a provider profile
+func LoadProviderFAQs(db *sql.DB, providerID int) (*ProviderFAQs, error) {
+	faqs, err := loadFAQs(db, providerID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(SelectPublicAnswersQuery, providerID, maxPublicAnswers)
+	if err != nil {
+		return nil, fmt.Errorf("error querying public answers: %v", err)
+	}
+	defer rows.Close()
+
+	answers := []PublicAnswer{}
+	for rows.Next() {
+		var answer PublicAnswer
+		if err := rows.Scan(&answer.ID, &answer.Question, &answer.Answer, &answer.AnsweredAt); err != nil {
+			return nil, fmt.Errorf("error scanning public answer: %v", err)
+		}
+		answers = append(answers, answer)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating public answers: %v", err)
+	}
+
+	return &ProviderFAQs{ProviderID: providerID, FAQs: faqs, PublicAnswers: answers}, nil
+}
+
+// loadFAQs lists a provider's FAQ entries
+func loadFAQs(db *sql.DB, providerID int) ([]FAQ, error) {
+	rows, err := db.Query(SelectFAQsQuery, providerID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying FAQs: %v", err)
+	}
+	defer rows.Close()
+
+	faqs := []FAQ{}
+	for rows.Next() {
+		faq, err := scanFAQ(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning FAQ: %v", err)
+		}
+		faqs = append(faqs, *faq)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating FAQs: %v", err)
+	}
+	return faqs, nil
+}
+
+// scanFAQ reads a row selected with faqColumns
+func scanFAQ(row interface{ Scan(...interface{}) error }) (*FAQ, error) {
+	var faq FAQ
+	if err := row.Scan(&faq.ID, &faq.Question, &faq.Answer, &faq.Position, &faq.CreatedAt, &faq.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &faq, nil
+}
+
+// decodeFAQ decodes and validates an FAQ entry, writing the error response
+// when it is rejected
+func decodeFAQ(w http.ResponseWriter, r *http.Request) (*FAQRequest, bool) {
+	var req FAQRequest
+	if !httputil.DecodeJSON(w, r, &req) {
+		return nil, false
+	}
+
+	req.Question = strings.TrimSpace(req.Question)
+	req.Answer = strings.TrimSpace(req.Answer)
+	if req.Question == "" || req.Answer == "" {
+		http.Error(w, "Question and answer are required", http.StatusBadRequest)
+		return nil, false
+	}
+	if utf8.RuneCountInString(req.Question) > maxQuestionLen {
+		http.Error(w, fmt.Sprintf("Question must be at most %d characters", maxQuestionLen), http.StatusBadRequest)
+		return nil, false
+	}
+	if utf8.RuneCountInString(req.Answer) > maxAnswerLen {
+		http.Error(w, fmt.Sprintf("Answer must be at most %d characters", maxAnswerLen), http.StatusBadRequest)
+		return nil, false
+	}
+	if req.Position != nil && *req.Position < 0 {
+		http.Error(w, "Position must not be negative", http.StatusBadRequest)
+		return nil, false
+	}
+	if blocked := moderation.Review(faqFields(&req)...).Blocked(); blocked != nil {
+		http.Error(w, blocked.Message(), http.StatusBadRequest)
+		return nil, false
+	}
+	return &req, true
+}
+
+// faqFields returns the text of an FAQ entry checked by moderation
+func faqFields(req *FAQRequest) []moderation.Field {
+	return []moderation.Field{
+		{Name: "question", Text: req.Question},
+		{Name: "answer", Text: req.Answer},
+	}
+}
+
+// recordFlags queues a saved FAQ entry for admin review when moderation
+// flagged it, and clears earlier flags when it no longer is
+func recordFlags(db *sql.DB, userID, faqID int, req *FAQRequest) {
+	fields := faqFields(req)
+	if err := moderation.Record(db, userID, moderation.ContentFAQ, faqID, fields, moderation.Review(fields...)); err != nil {
+		// Don't return error here as the FAQ was still saved successfully
+		log.Printf("Error recording moderation flags of FAQ %d: %v", faqID, err)
+	}
+}
+
+// requireRole checks that the user has role, writing the error response when not
+func requireRole(w http.ResponseWriter, db *sql.DB, userID int, role string) bool {
+	var userRole string
+	var dualRole bool
+	if err := db.QueryRow(SelectUserRoleQuery, userID).Scan(&userRole, &dualRole); err != nil {
+		log.Printf("Error loading role of user %d: %v", userID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return false
+	}
+	if userRole != role && !dualRole {
+		http.Error(w, fmt.Sprintf("Only %ss can do this", role), http.StatusForbidden)
+		return false
+	}
+	return true
+}
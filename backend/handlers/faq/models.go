@@ -0,0 +1,81 @@
+package faq
+
+import "time"
+
+// Answer visibilities. Public answers are shown with the provider's FAQs
+// without the asker's identity; private ones only to the asker.
+const (
+	VisibilityPrivate = "private"
+	VisibilityPublic  = "public"
+)
+
+// FAQ is a question and answer the provider published on their profile
+type FAQ struct {
+	ID        int       `json:"id"`
+	Question  string    `json:"question"`
+	Answer    string    `json:"answer"`
+	Position  int       `json:"position"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// FAQRequest creates or replaces an FAQ entry. Entries without a position are
+// added at the end.
+type FAQRequest struct {
+	Question string `json:"question"`
+	Answer   string `json:"answer"`
+	Position *int   `json:"position"`
+}
+
+// Question is a question a matched recipient asked a provider
+type Question struct {
+	ID            int        `json:"id"`
+	ProviderID    int        `json:"provider_id"`
+	RecipientID   int        `json:"recipient_id"`
+	RecipientName string     `json:"recipient_name"`
+	ProviderName  string     `json:"provider_name"`
+	Question      string     `json:"question"`
+	Answer        *string    `json:"answer"`
+	Visibility    *string    `json:"visibility"`
+	AnsweredAt    *time.Time `json:"answered_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// AskRequest submits a question to a provider
+type AskRequest struct {
+	Question string `json:"question"`
+}
+
+// AnswerRequest answers a question, publicly or only to the asker
+type AnswerRequest struct {
+	Answer string `json:"answer"`
+	Public bool   `json:"public"`
+}
+
+// PublicAnswer is a recipient question the provider answered publicly
+type PublicAnswer struct {
+	ID         int       `json:"id"`
+	Question   string    `json:"question"`
+	Answer     string    `json:"answer"`
+	AnsweredAt time.Time `json:"answered_at"`
+}
+
+// ProviderFAQs is the Q&A section of a provider profile
+type ProviderFAQs struct {
+	ProviderID    int            `json:"provider_id"`
+	FAQs          []FAQ          `json:"faqs"`
+	PublicAnswers []PublicAnswer `json:"public_answers"`
+}
+
+// ProfileFAQsResponse is the Q&A section as seen by a signed-in user, with the
+// questions they asked the provider
+type ProfileFAQsResponse struct {
+	ProviderFAQs
+	MyQuestions []Question `json:"my_questions"`
+	CanAsk      bool       `json:"can_ask"`
+}
+
+// QuestionsResponse lists questions received (providers) or asked (recipients)
+type QuestionsResponse struct {
+	Questions []Question `json:"questions"`
+}
@@ -0,0 +1,122 @@
+package faq
+
+const faqColumns = `id, question, answer, position, created_at, updated_at`
+
+const questionColumns = `
+		q.id, q.provider_id, q.recipient_id,
+		COALESCE(rp.organization_name, ''), COALESCE(pp.organization_name, ''),
+		q.question, q.answer, q.visibility, q.answered_at, q.created_at
+	`
+
+const questionJoins = `
+		FROM provider_questions q
+		LEFT JOIN profiles rp ON rp.user_id = q.recipient_id
+		LEFT JOIN profiles pp ON pp.user_id = q.provider_id
+	`
+
+const (
+	// SelectUserRoleQuery returns a user's role and whether they hold both roles
+	SelectUserRoleQuery = `
+		SELECT role, dual_role FROM users WHERE id = $1 AND deactivated_at IS NULL
+	`
+
+	// SelectFAQsQuery lists a provider's FAQ entries in order
+	SelectFAQsQuery = `
+		SELECT ` + faqColumns + `
+		FROM provider_faqs
+		WHERE provider_id = $1
+		ORDER BY position, id
+	`
+
+	// InsertFAQQuery adds an FAQ entry, at the end when $4 is null, refusing
+	// once the provider has $5 entries
+	InsertFAQQuery = `
+		INSERT INTO provider_faqs (provider_id, question, answer, position)
+		SELECT $1, $2, $3, COALESCE($4, COALESCE(MAX(position), 0) + 1)
+		FROM provider_faqs
+		WHERE provider_id = $1
+		HAVING COUNT(*) < $5
+		RETURNING ` + faqColumns + `
+	`
+
+	// UpdateFAQQuery replaces one of the provider's FAQ entries, keeping its
+	// position when $5 is null
+	UpdateFAQQuery = `
+		UPDATE provider_faqs
+		SET question = $3, answer = $4, position = COALESCE($5, position), updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND provider_id = $2
+		RETURNING ` + faqColumns + `
+	`
+
+	// DeleteFAQQuery removes one of the provider's FAQ entries
+	DeleteFAQQuery = `
+		DELETE FROM provider_faqs WHERE id = $1 AND provider_id = $2
+	`
+
+	// SelectPublicAnswersQuery lists the questions a provider answered publicly
+	SelectPublicAnswersQuery = `
+		SELECT id, question, answer, answered_at
+		FROM provider_questions
+		WHERE provider_id = $1 AND visibility = 'public' AND answer IS NOT NULL
+		ORDER BY answered_at DESC, id DESC
+		LIMIT $2
+	`
+
+	// CheckMatchedQuery checks that a recipient and provider are matched,
+	// in either direction, or connected
+	CheckMatchedQuery = `
+		SELECT EXISTS (
+			SELECT 1 FROM matches
+			WHERE (user_id = $1 AND match_id = $2) OR (user_id = $2 AND match_id = $1)
+		) OR EXISTS (
+			SELECT 1 FROM connections
+			WHERE LEAST(initiator_id, target_id) = LEAST($1::int, $2::int)
+			  AND GREATEST(initiator_id, target_id) = GREATEST($1::int, $2::int)
+		)
+	`
+
+	// CountOpenQuestionsQuery counts a recipient's unanswered questions to a provider
+	CountOpenQuestionsQuery = `
+		SELECT COUNT(*) FROM provider_questions
+		WHERE provider_id = $1 AND recipient_id = $2 AND answer IS NULL
+	`
+
+	// InsertQuestionQuery records a recipient's question
+	InsertQuestionQuery = `
+		INSERT INTO provider_questions (provider_id, recipient_id, question)
+		VALUES ($1, $2, $3)
+		RETURNING id
+	`
+
+	// SelectQuestionQuery returns one question
+	SelectQuestionQuery = `
+		SELECT ` + questionColumns + questionJoins + `
+		WHERE q.id = $1
+	`
+
+	// SelectAskedQuestionsQuery lists the questions a recipient asked one provider
+	SelectAskedQuestionsQuery = `
+		SELECT ` + questionColumns + questionJoins + `
+		WHERE q.provider_id = $1 AND q.recipient_id = $2
+		ORDER BY q.created_at DESC, q.id DESC
+	`
+
+	// SelectMyQuestionsQuery lists the questions a provider received or a
+	// recipient asked, optionally only unanswered ($2 = 'unanswered') or
+	// answered ($2 = 'answered') ones
+	SelectMyQuestionsQuery = `
+		SELECT ` + questionColumns + questionJoins + `
+		WHERE (q.provider_id = $1 OR q.recipient_id = $1)
+			AND ($2 = '' OR ($2 = 'answered') = (q.answer IS NOT NULL))
+		ORDER BY q.created_at DESC, q.id DESC
+		LIMIT $3
+	`
+
+	// AnswerQuestionQuery answers, or re-answers, a question the provider received
+	AnswerQuestionQuery = `
+		UPDATE provider_questions
+		SET answer = $3, visibility = $4, answered_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND provider_id = $2
+		RETURNING recipient_id
+	`
+)
@@ -0,0 +1,266 @@
+package faq
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"matcherator/backend/handlers/auth"
+	"matcherator/backend/handlers/httputil"
+	"matcherator/backend/handlers/notifications"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// maxOpenQuestions caps a recipient's unanswered questions to one provider
+	maxOpenQuestions = 5
+	// maxListedQuestions caps the questions listed under /me/questions
+	maxListedQuestions = 200
+)
+
+// Notification types sent about questions
+const (
+	NotificationQuestionAsked    = "question_asked"
+	NotificationQuestionAnswered = "question_answered"
+)
+
+// AskQuestionHandler lets a recipient matched or connected with a provider ask
+// them a question
+// Used by: /api/users/{id}/questions
+// Response: Question
+func AskQuestionHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		providerID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		var req AskRequest
+		if !httputil.DecodeJSON(w, r, &req) {
+			return
+		}
+		req.Question = strings.TrimSpace(req.Question)
+		if req.Question == "" {
+			http.Error(w, "Question is required", http.StatusBadRequest)
+			return
+		}
+		if utf8.RuneCountInString(req.Question) > maxQuestionLen {
+			http.Error(w, fmt.Sprintf("Question must be at most %d characters", maxQuestionLen), http.StatusBadRequest)
+			return
+		}
+
+		if !requireRole(w, db, userID, "recipient") {
+			return
+		}
+
+		var providerRole string
+		var dualRole bool
+		err = db.QueryRow(SelectUserRoleQuery, providerID).Scan(&providerRole, &dualRole)
+		if err == sql.ErrNoRows || (err == nil && providerRole != "provider" && !dualRole) {
+			http.Error(w, "Provider not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error loading user %d: %v", providerID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		allowed, err := canAsk(db, userID, providerID)
+		if err != nil {
+			log.Printf("Error checking whether user %d may ask provider %d: %v", userID, providerID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if !allowed {
+			http.Error(w, fmt.Sprintf("You can ask providers you are matched or connected with, with up to %d unanswered questions each", maxOpenQuestions), http.StatusForbidden)
+			return
+		}
+
+		var questionID int
+		if err := db.QueryRow(InsertQuestionQuery, providerID, userID, req.Question).Scan(&questionID); err != nil {
+			log.Printf("Error saving question from user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		question, err := scanQuestion(db.QueryRow(SelectQuestionQuery, questionID))
+		if err != nil {
+			log.Printf("Error loading question %d: %v", questionID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		notifications.Notify(db, providerID, NotificationQuestionAsked, fmt.Sprintf("%s asked a question about your funding", displayName(question.RecipientName)))
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(question)
+	}
+}
+
+// GetMyQuestionsHandler lists the questions a provider received or a recipient
+// asked. Pass ?status=unanswered or ?status=answered to filter.
+// Used by: /api/me/questions
+// Response: QuestionsResponse
+func GetMyQuestionsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		status := r.URL.Query().Get("status")
+		if status != "" && status != "unanswered" && status != "answered" {
+			http.Error(w, "Status must be unanswered or answered", http.StatusBadRequest)
+			return
+		}
+
+		questions, err := loadQuestions(db, SelectMyQuestionsQuery, userID, status, maxListedQuestions)
+		if err != nil {
+			log.Printf("Error loading questions for user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(QuestionsResponse{Questions: questions})
+	}
+}
+
+// AnswerQuestionHandler lets a provider answer a question publicly, alongside
+// their FAQ, or privately to the asker. Answering again replaces the answer.
+// Used by: /api/me/questions/{id}/answer
+// Response: Question
+func AnswerQuestionHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid question ID", http.StatusBadRequest)
+			return
+		}
+
+		var req AnswerRequest
+		if !httputil.DecodeJSON(w, r, &req) {
+			return
+		}
+		req.Answer = strings.TrimSpace(req.Answer)
+		if req.Answer == "" {
+			http.Error(w, "Answer is required", http.StatusBadRequest)
+			return
+		}
+		if utf8.RuneCountInString(req.Answer) > maxAnswerLen {
+			http.Error(w, fmt.Sprintf("Answer must be at most %d characters", maxAnswerLen), http.StatusBadRequest)
+			return
+		}
+
+		visibility := VisibilityPrivate
+		if req.Public {
+			visibility = VisibilityPublic
+		}
+
+		var recipientID int
+		err = db.QueryRow(AnswerQuestionQuery, id, userID, req.Answer, visibility).Scan(&recipientID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Question not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error answering question %d: %v", id, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		question, err := scanQuestion(db.QueryRow(SelectQuestionQuery, id))
+		if err != nil {
+			log.Printf("Error loading question %d: %v", id, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		notifications.Notify(db, recipientID, NotificationQuestionAnswered, fmt.Sprintf("%s answered your question", displayName(question.ProviderName)))
+
+		json.NewEncoder(w).Encode(question)
+	}
+}
+
+// canAsk reports whether a recipient is matched or connected with a provider
+// and has room for another unanswered question
+func canAsk(db *sql.DB, recipientID, providerID int) (bool, error) {
+	var matched bool
+	if err := db.QueryRow(CheckMatchedQuery, recipientID, providerID).Scan(&matched); err != nil {
+		return false, fmt.Errorf("error checking match: %v", err)
+	}
+	if !matched {
+		return false, nil
+	}
+
+	var open int
+	if err := db.QueryRow(CountOpenQuestionsQuery, providerID, recipientID).Scan(&open); err != nil {
+		return false, fmt.Errorf("error counting open questions: %v", err)
+	}
+	return open < maxOpenQuestions, nil
+}
+
+// loadQuestions lists the questions selected by a query using questionColumns
+func loadQuestions(db *sql.DB, query string, args ...interface{}) ([]Question, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying questions: %v", err)
+	}
+	defer rows.Close()
+
+	questions := []Question{}
+	for rows.Next() {
+		question, err := scanQuestion(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning question: %v", err)
+		}
+		questions = append(questions, *question)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating questions: %v", err)
+	}
+	return questions, nil
+}
+
+// scanQuestion reads a row selected with questionColumns
+func scanQuestion(row interface{ Scan(...interface{}) error }) (*Question, error) {
+	var q Question
+	err := row.Scan(&q.ID, &q.ProviderID, &q.RecipientID, &q.RecipientName, &q.ProviderName,
+		&q.Question, &q.Answer, &q.Visibility, &q.AnsweredAt, &q.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &q, nil
+}
+
+// displayName falls back to a generic name for organizations without one
+func displayName(name string) string {
+	if name == "" {
+		return "An organization"
+	}
+	return name
+}
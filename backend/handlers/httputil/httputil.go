@@ -0,0 +1,124 @@
+package httputil
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// DefaultMaxBodyBytes caps request bodies of routes without their own limit
+const DefaultMaxBodyBytes = 1 << 20 // 1 MB
+
+// RequestError describes why a request body was rejected
+type RequestError struct {
+	Status  int
+	Message string
+}
+
+func (e *RequestError) Error() string {
+	return e.Message
+}
+
+// BodyLimitMiddleware caps request bodies at the limit configured for the matched
+// route's path template in routeLimits, or defaultLimit
+func BodyLimitMiddleware(defaultLimit int64, routeLimits map[string]int64) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limit := defaultLimit
+			if route := mux.CurrentRoute(r); route != nil {
+				if template, err := route.GetPathTemplate(); err == nil {
+					if routeLimit, ok := routeLimits[template]; ok {
+						limit = routeLimit
+					}
+				}
+			}
+
+			if r.ContentLength > limit {
+				http.Error(w, fmt.Sprintf("Request body must not be larger than %d bytes", limit), http.StatusRequestEntityTooLarge)
+				return
+			}
+
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ReadJSON strictly decodes a single JSON object from the request body into dst,
+// rejecting unknown fields, wrongly typed values, trailing data and empty bodies
+func ReadJSON(r *http.Request, dst interface{}) *RequestError {
+	return readJSON(r, dst, false)
+}
+
+// DecodeJSON is ReadJSON for handlers that report errors with http.Error. It
+// writes the error response and returns false when the body is rejected.
+func DecodeJSON(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	if reqErr := readJSON(r, dst, false); reqErr != nil {
+		http.Error(w, reqErr.Message, reqErr.Status)
+		return false
+	}
+	return true
+}
+
+// DecodeOptionalJSON is DecodeJSON for endpoints whose body may be omitted
+func DecodeOptionalJSON(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	if reqErr := readJSON(r, dst, true); reqErr != nil {
+		http.Error(w, reqErr.Message, reqErr.Status)
+		return false
+	}
+	return true
+}
+
+func readJSON(r *http.Request, dst interface{}, optional bool) *RequestError {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(dst); err != nil {
+		if errors.Is(err, io.EOF) && optional {
+			return nil
+		}
+		return describeDecodeError(err)
+	}
+
+	if err := dec.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return describeDecodeError(err)
+		}
+		return &RequestError{http.StatusBadRequest, "Request body must only contain a single JSON object"}
+	}
+
+	return nil
+}
+
+// describeDecodeError turns a json.Decoder error into a client-facing message
+func describeDecodeError(err error) *RequestError {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var maxBytesErr *http.MaxBytesError
+
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return &RequestError{http.StatusRequestEntityTooLarge, fmt.Sprintf("Request body must not be larger than %d bytes", maxBytesErr.Limit)}
+	case errors.As(err, &syntaxErr):
+		return &RequestError{http.StatusBadRequest, fmt.Sprintf("Request body contains malformed JSON (at position %d)", syntaxErr.Offset)}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return &RequestError{http.StatusBadRequest, "Request body contains malformed JSON"}
+	case errors.As(err, &typeErr):
+		if typeErr.Field == "" {
+			return &RequestError{http.StatusBadRequest, "Request body must be a JSON object"}
+		}
+		return &RequestError{http.StatusBadRequest, fmt.Sprintf("Request body field %q must be of type %s", typeErr.Field, typeErr.Type)}
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		return &RequestError{http.StatusBadRequest, "Request body contains unknown field " + strings.TrimPrefix(err.Error(), "json: unknown field ")}
+	case errors.Is(err, io.EOF):
+		return &RequestError{http.StatusBadRequest, "Request body must not be empty"}
+	default:
+		return &RequestError{http.StatusBadRequest, "Invalid request body"}
+	}
+}
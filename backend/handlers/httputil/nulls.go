@@ -0,0 +1,44 @@
+package httputil
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Response DTOs never carry sql.Null* values, which encode as
+// {"String": ..., "Valid": ...}. Handlers scan nullable columns into a row
+// struct and map them with these helpers: to nil where the response
+// distinguishes a missing value, to the zero value where it does not.
+
+// StringPtr returns a nullable text column as a pointer, nil when NULL
+func StringPtr(v sql.NullString) *string {
+	if !v.Valid {
+		return nil
+	}
+	return &v.String
+}
+
+// Float64Ptr returns a nullable numeric column as a pointer, nil when NULL
+func Float64Ptr(v sql.NullFloat64) *float64 {
+	if !v.Valid {
+		return nil
+	}
+	return &v.Float64
+}
+
+// IntPtr returns a nullable integer column as a pointer, nil when NULL
+func IntPtr(v sql.NullInt64) *int {
+	if !v.Valid {
+		return nil
+	}
+	n := int(v.Int64)
+	return &n
+}
+
+// TimePtr returns a nullable timestamp column as a pointer, nil when NULL
+func TimePtr(v sql.NullTime) *time.Time {
+	if !v.Valid {
+		return nil
+	}
+	return &v.Time
+}
@@ -0,0 +1,34 @@
+package httputil
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// ParsePage reads the limit and offset query parameters of a paginated
+// listing. A missing limit is defaultLimit and one above maxLimit is capped.
+// It writes the error response and returns false when either is invalid.
+func ParsePage(w http.ResponseWriter, r *http.Request, defaultLimit, maxLimit int) (limit, offset int, ok bool) {
+	query := r.URL.Query()
+
+	limit = defaultLimit
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return 0, 0, false
+		}
+		limit = min(n, maxLimit)
+	}
+
+	if value := query.Get("offset"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			http.Error(w, "offset must be a non-negative integer", http.StatusBadRequest)
+			return 0, 0, false
+		}
+		offset = n
+	}
+
+	return limit, offset, true
+}
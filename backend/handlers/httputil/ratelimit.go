@@ -0,0 +1,59 @@
+package httputil
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// maxRateLimitKeys bounds the clients a rate limiter tracks; past it, clients
+// whose window has ended are forgotten
+const maxRateLimitKeys = 100000
+
+// rateWindow counts one client's requests since start
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+// RateLimitMiddleware allows each client, as told apart by key (usually the
+// client IP), at most limit requests per window and answers the rest with 429.
+// Counts are kept in memory, so each server instance limits on its own.
+func RateLimitMiddleware(limit int, window time.Duration, key func(*http.Request) string) mux.MiddlewareFunc {
+	var lock sync.Mutex
+	windows := map[string]*rateWindow{}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			now := time.Now()
+			client := key(r)
+
+			lock.Lock()
+			if len(windows) >= maxRateLimitKeys {
+				for k, win := range windows {
+					if now.Sub(win.start) >= window {
+						delete(windows, k)
+					}
+				}
+			}
+			win := windows[client]
+			if win == nil || now.Sub(win.start) >= window {
+				win = &rateWindow{start: now}
+				windows[client] = win
+			}
+			win.count++
+			allowed, retryAfter := win.count <= limit, win.start.Add(window).Sub(now)
+			lock.Unlock()
+
+			if !allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+				http.Error(w, "Too many requests. Please try again later", http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package httputil
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+
+	"github.com/gorilla/mux"
+)
+
+// RequestIDHeader carries the request ID on requests and responses
+const RequestIDHeader = "X-Request-Id"
+
+// PanicCounts counts recovered panics per route template. It is published with
+// the other expvar metrics.
+var PanicCounts = expvar.NewMap("http_panics_total")
+
+// validRequestID restricts client-supplied request IDs to safe log values
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+type requestIDKey struct{}
+
+// RequestIDMiddleware assigns each request an ID, reusing a well-formed
+// X-Request-Id from the client, and returns it in the X-Request-Id header
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(requestID) {
+			requestID = newRequestID()
+		}
+
+		w.Header().Set(RequestIDHeader, requestID)
+		ctx := context.WithValue(r.Context(), requestIDKey{}, requestID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequestID returns the ID assigned by RequestIDMiddleware, or ""
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// RecoveryMiddleware turns a panic in a handler into a logged stack trace and a
+// JSON 500. When the response has already started the connection is aborted
+// instead, and a hijacked WebSocket connection is closed.
+func RecoveryMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := &recoveryWriter{ResponseWriter: w}
+
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+
+			route := r.URL.Path
+			if current := mux.CurrentRoute(r); current != nil {
+				if template, err := current.GetPathTemplate(); err == nil {
+					route = template
+				}
+			}
+			PanicCounts.Add(route, 1)
+
+			requestID := RequestID(r.Context())
+			log.Printf("Panic serving %s %s (request %s): %v\n%s", r.Method, route, requestID, recovered, debug.Stack())
+
+			switch {
+			case rw.conn != nil:
+				rw.conn.Close()
+			case rw.wroteHeader:
+				panic(http.ErrAbortHandler)
+			default:
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(map[string]string{
+					"error":      "Internal server error",
+					"request_id": requestID,
+				})
+			}
+		}()
+
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// newRequestID returns a random 16-byte hex ID
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// recoveryWriter records whether the response has started and keeps hijacked
+// connections so they can be closed after a panic
+type recoveryWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+	conn        net.Conn
+}
+
+func (w *recoveryWriter) WriteHeader(status int) {
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recoveryWriter) Write(p []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *recoveryWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.wroteHeader = true
+		flusher.Flush()
+	}
+}
+
+func (w *recoveryWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err == nil {
+		w.conn = conn
+	}
+	return conn, rw, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *recoveryWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
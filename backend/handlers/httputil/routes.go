@@ -0,0 +1,133 @@
+package httputil
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// routeMethods are the methods routes are registered with. HEAD and OPTIONS
+// are answered by MethodsHandler for every route.
+var routeMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// RouteInfo describes a registered route
+type RouteInfo struct {
+	Path    string   `json:"path"`
+	Methods []string `json:"methods"` // ["*"] for routes that accept any method
+	Auth    string   `json:"auth"`
+}
+
+// MethodsHandler serves router, answering HEAD for every GET route and plain
+// OPTIONS requests (CORS preflights never get this far) with the methods the
+// path allows. Requests with a method the path doesn't allow get a 405 listing
+// the allowed ones in Allow.
+func MethodsHandler(router *mux.Router) http.Handler {
+	// mux reports a method mismatch within a subrouter as not found when a
+	// later route fails on its path, so both cases look at the allowed methods
+	notAllowed := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allowed := AllowedMethods(router, r)
+		if len(allowed) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	})
+	router.MethodNotAllowedHandler = notAllowed
+	router.NotFoundHandler = notAllowed
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodHead:
+			// Handlers run as for GET; the server drops the body of HEAD responses
+			get := r.Clone(r.Context())
+			get.Method = http.MethodGet
+			if matches(router, get) {
+				router.ServeHTTP(w, get)
+				return
+			}
+		case http.MethodOptions:
+			if allowed := AllowedMethods(router, r); len(allowed) > 0 {
+				w.Header().Set("Allow", strings.Join(allowed, ", "))
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		router.ServeHTTP(w, r)
+	})
+}
+
+// AllowedMethods lists the methods router serves at the request's path,
+// including HEAD and OPTIONS, or none when no route matches the path
+func AllowedMethods(router *mux.Router, r *http.Request) []string {
+	var allowed []string
+	for _, method := range routeMethods {
+		probe := r.Clone(r.Context())
+		probe.Method = method
+		if matches(router, probe) {
+			allowed = append(allowed, method)
+			if method == http.MethodGet {
+				allowed = append(allowed, http.MethodHead)
+			}
+		}
+	}
+	if len(allowed) > 0 {
+		allowed = append(allowed, http.MethodOptions)
+	}
+	return allowed
+}
+
+// ListRoutes describes the routes of router, sorted by path. auth names what
+// the middleware of each subrouter requires; routes of other routers are
+// listed as "none". OPTIONS is left out of the methods, since every route
+// answers it, and HEAD is listed with GET.
+func ListRoutes(router *mux.Router, auth map[*mux.Router]string) ([]RouteInfo, error) {
+	routes := []RouteInfo{}
+	err := router.Walk(func(route *mux.Route, owner *mux.Router, _ []*mux.Route) error {
+		// Skip the prefixes subrouters hang off
+		if route.GetHandler() == nil {
+			return nil
+		}
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+
+		info := RouteInfo{Path: path, Methods: []string{}, Auth: auth[owner]}
+		if info.Auth == "" {
+			info.Auth = "none"
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			// The route has no method matcher
+			info.Methods = []string{"*"}
+		}
+		for _, method := range methods {
+			switch method {
+			case http.MethodOptions:
+			case http.MethodGet:
+				info.Methods = append(info.Methods, http.MethodGet, http.MethodHead)
+			default:
+				info.Methods = append(info.Methods, method)
+			}
+		}
+		routes = append(routes, info)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(routes, func(i, j int) bool {
+		return routes[i].Path < routes[j].Path
+	})
+	return routes, nil
+}
+
+// matches reports whether a route of router serves the request as it is
+func matches(router *mux.Router, r *http.Request) bool {
+	var match mux.RouteMatch
+	return router.Match(r, &match) && match.MatchErr == nil
+}
@@ -5,15 +5,20 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"matcherator/backend/handlers/auth"
+	"matcherator/backend/handlers/httputil"
+	"matcherator/backend/services/jobs"
 )
 
 const (
-	maxFileSize = 10 << 20 // 10 MB
+	maxFileSize   = 10 << 20 // 10 MB
+	maxAltTextLen = 250
 )
 
 var allowedTypes = map[string]bool{
@@ -24,9 +29,20 @@ var allowedTypes = map[string]bool{
 
 // UploadResponse represents the response for a successful upload
 type UploadResponse struct {
-	URL string `json:"url"`
+	URL     string `json:"url"`
+	AltText string `json:"alt_text"`
+	Warning string `json:"warning,omitempty"`
 }
 
+// AltTextRequest represents a request to update the profile picture's alt text
+type AltTextRequest struct {
+	AltText string `json:"alt_text"`
+}
+
+// missingAltTextWarning encourages providers, whose pictures appear on every
+// recipient's match cards, to describe their images
+const missingAltTextWarning = "Please add alt text describing your image so screen-reader users can understand it"
+
 // ErrorResponse represents an error response
 type ErrorResponse struct {
 	Error string `json:"error"`
@@ -63,6 +79,12 @@ func UploadProfilePictureHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		altText, err := validateAltText(r.FormValue("alt_text"))
+		if err != nil {
+			json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+			return
+		}
+
 		// Generate unique filename
 		filename := fmt.Sprintf("%d_%s", userID, handler.Filename)
 		uploadPath := filepath.Join("uploads", "profile_pictures", filename)
@@ -92,9 +114,10 @@ func UploadProfilePictureHandler(db *sql.DB) http.HandlerFunc {
 		_, err = db.Exec(`
 			UPDATE profiles 
 			SET profile_picture_url = $1,
+				profile_picture_alt = NULLIF($2, ''),
 				updated_at = CURRENT_TIMESTAMP
-			WHERE user_id = $2
-		`, fileURL, userID)
+			WHERE user_id = $3
+		`, fileURL, altText, userID)
 
 		if err != nil {
 			// Clean up the uploaded file if database update fails
@@ -103,7 +126,16 @@ func UploadProfilePictureHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		json.NewEncoder(w).Encode(UploadResponse{URL: fileURL})
+		// Strip EXIF metadata in the background
+		if _, err := jobs.Enqueue(db, ProcessImageJob, ProcessImagePayload{Path: uploadPath}); err != nil {
+			log.Printf("Error queueing image processing for user %d: %v", userID, err)
+		}
+
+		response := UploadResponse{URL: fileURL, AltText: altText}
+		if altText == "" && isProvider(db, userID) {
+			response.Warning = missingAltTextWarning
+		}
+		json.NewEncoder(w).Encode(response)
 	}
 }
 
@@ -144,13 +176,14 @@ func DeleteProfilePictureHandler(db *sql.DB) http.HandlerFunc {
 		// Delete the file
 		if err := os.Remove(uploadPath); err != nil {
 			// Log the error but continue with database update
-			fmt.Printf("Error deleting file: %v\n", err)
+			log.Printf("Error deleting file: %v", err)
 		}
 
 		// Update database to remove profile picture URL
 		_, err = db.Exec(`
 			UPDATE profiles 
 			SET profile_picture_url = NULL,
+				profile_picture_alt = NULL,
 				updated_at = CURRENT_TIMESTAMP
 			WHERE user_id = $1
 		`, userID)
@@ -163,3 +196,70 @@ func DeleteProfilePictureHandler(db *sql.DB) http.HandlerFunc {
 		w.WriteHeader(http.StatusNoContent)
 	}
 }
+
+// UpdateProfilePictureAltHandler updates the alt text of the current profile picture
+func UpdateProfilePictureAltHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req AltTextRequest
+		if !httputil.DecodeJSON(w, r, &req) {
+			return
+		}
+
+		altText, err := validateAltText(req.AltText)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var fileURL string
+		err = db.QueryRow(`
+			UPDATE profiles
+			SET profile_picture_alt = NULLIF($1, ''),
+				updated_at = CURRENT_TIMESTAMP
+			WHERE user_id = $2 AND profile_picture_url IS NOT NULL
+			RETURNING profile_picture_url
+		`, altText, userID).Scan(&fileURL)
+
+		if err == sql.ErrNoRows {
+			http.Error(w, "No profile picture to describe", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to update profile", http.StatusInternalServerError)
+			return
+		}
+
+		response := UploadResponse{URL: fileURL, AltText: altText}
+		if altText == "" && isProvider(db, userID) {
+			response.Warning = missingAltTextWarning
+		}
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// validateAltText trims alt text and checks its length
+func validateAltText(altText string) (string, error) {
+	altText = strings.TrimSpace(altText)
+	if len(altText) > maxAltTextLen {
+		return "", fmt.Errorf("Alt text must be at most %d characters", maxAltTextLen)
+	}
+	return altText, nil
+}
+
+// isProvider reports whether the user is a grant provider, primarily or as
+// a dual-role user
+func isProvider(db *sql.DB, userID int) bool {
+	var role string
+	var dualRole bool
+	if err := db.QueryRow("SELECT role, dual_role FROM users WHERE id = $1", userID).Scan(&role, &dualRole); err != nil {
+		return false
+	}
+	return role == "provider" || dualRole
+}
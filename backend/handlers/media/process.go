@@ -0,0 +1,103 @@
+package media
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	_ "image/gif" // recognize GIFs so they are skipped rather than rejected
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"matcherator/backend/services/jobs"
+)
+
+// ProcessImageJob is the job kind that strips metadata from an uploaded picture
+const ProcessImageJob = "media.process_image"
+
+// maxImagePixels rejects images whose decoded size would exhaust memory
+const maxImagePixels = 40_000_000
+
+// ProcessImagePayload is the payload of a ProcessImageJob
+type ProcessImagePayload struct {
+	Path string `json:"path"`
+}
+
+// ProcessImageJobHandler re-encodes uploaded JPEG and PNG pictures, dropping EXIF
+// data such as GPS coordinates before the image is widely served. GIFs are left
+// as uploaded to keep animations.
+func ProcessImageJobHandler() jobs.Handler {
+	return func(ctx context.Context, payload json.RawMessage) error {
+		var p ProcessImagePayload
+		if err := json.Unmarshal(payload, &p); err != nil {
+			return jobs.Permanent(fmt.Errorf("error decoding image job: %v", err))
+		}
+
+		uploadDir := filepath.Join("uploads", "profile_pictures")
+		if filepath.Dir(filepath.Clean(p.Path)) != uploadDir {
+			return jobs.Permanent(fmt.Errorf("refusing to process %q outside %s", p.Path, uploadDir))
+		}
+
+		err := stripMetadata(p.Path)
+		if os.IsNotExist(err) {
+			// Replaced or deleted since the upload
+			return nil
+		}
+		return err
+	}
+}
+
+// stripMetadata decodes and re-encodes the image at path in place
+func stripMetadata(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	config, format, err := image.DecodeConfig(file)
+	if err != nil {
+		return jobs.Permanent(fmt.Errorf("error reading image %s: %v", path, err))
+	}
+	if format != "jpeg" && format != "png" {
+		return nil
+	}
+	if config.Width*config.Height > maxImagePixels {
+		return jobs.Permanent(fmt.Errorf("image %s is too large to process (%dx%d)", path, config.Width, config.Height))
+	}
+
+	if _, err := file.Seek(0, 0); err != nil {
+		return err
+	}
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return jobs.Permanent(fmt.Errorf("error decoding image %s: %v", path, err))
+	}
+
+	// Write next to the original and rename so the file is never served half-written
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))+"-*")
+	if err != nil {
+		return fmt.Errorf("error creating temporary image: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if format == "jpeg" {
+		err = jpeg.Encode(tmp, img, &jpeg.Options{Quality: 90})
+	} else {
+		err = png.Encode(tmp, img)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("error encoding image %s: %v", path, err)
+	}
+
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("error setting image permissions: %v", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
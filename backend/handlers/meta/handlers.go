@@ -0,0 +1,319 @@
+package meta
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"matcherator/backend/handlers/auth"
+	"matcherator/backend/handlers/httputil"
+
+	"github.com/gorilla/mux"
+)
+
+const maxTermLength = 100
+
+// GetTaxonomyHandler returns the canonical sectors and target groups
+// Used by: /api/meta/taxonomy
+// Response: Taxonomy
+func GetTaxonomyHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		rows, err := db.Query(SelectTaxonomyQuery)
+		if err != nil {
+			log.Printf("Error querying taxonomy: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		taxonomy := Taxonomy{Sectors: []string{}, TargetGroups: []string{}}
+		for rows.Next() {
+			var kind, name string
+			if err := rows.Scan(&kind, &name); err != nil {
+				log.Printf("Error scanning taxonomy term: %v", err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+			if kind == "sector" {
+				taxonomy.Sectors = append(taxonomy.Sectors, name)
+			} else {
+				taxonomy.TargetGroups = append(taxonomy.TargetGroups, name)
+			}
+		}
+
+		if err = rows.Err(); err != nil {
+			log.Printf("Error iterating taxonomy: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(taxonomy)
+	}
+}
+
+// CreateSuggestionHandler queues a new sector or target group for admin approval
+// Used by: /api/meta/suggestions
+// Response: Suggestion
+func CreateSuggestionHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req SuggestionRequest
+		if !httputil.DecodeJSON(w, r, &req) {
+			return
+		}
+
+		req.Value = strings.TrimSpace(req.Value)
+		if req.Kind != "sector" && req.Kind != "target_group" {
+			http.Error(w, "Invalid kind. Must be 'sector' or 'target_group'", http.StatusBadRequest)
+			return
+		}
+		if req.Value == "" || len(req.Value) > maxTermLength {
+			http.Error(w, "Value must be between 1 and 100 characters", http.StatusBadRequest)
+			return
+		}
+
+		// Skip terms that already exist in the canonical taxonomy
+		var exists bool
+		err = db.QueryRow(`
+			SELECT EXISTS (
+				SELECT 1 FROM taxonomy_terms
+				WHERE kind = $1 AND normalize_taxonomy_term(name) = normalize_taxonomy_term($2)
+			)
+		`, req.Kind, req.Value).Scan(&exists)
+		if err != nil {
+			log.Printf("Error checking taxonomy term: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if exists {
+			http.Error(w, "Term already exists", http.StatusConflict)
+			return
+		}
+
+		suggestion := Suggestion{UserID: userID, Kind: req.Kind, Value: req.Value}
+		err = db.QueryRow(InsertSuggestionQuery, userID, req.Kind, req.Value).Scan(
+			&suggestion.ID,
+			&suggestion.Status,
+			&suggestion.CreatedAt,
+		)
+		if err != nil {
+			log.Printf("Error creating taxonomy suggestion: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(suggestion)
+	}
+}
+
+// ListSuggestionsHandler lists taxonomy suggestions, pending ones by default
+// Used by: /api/admin/taxonomy/suggestions?status=
+// Response: []Suggestion
+func ListSuggestionsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		status := r.URL.Query().Get("status")
+		if status == "" {
+			status = "pending"
+		}
+
+		rows, err := db.Query(SelectSuggestionsQuery, status)
+		if err != nil {
+			log.Printf("Error querying taxonomy suggestions: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		suggestions := []Suggestion{}
+		for rows.Next() {
+			var s Suggestion
+			err := rows.Scan(&s.ID, &s.UserID, &s.Kind, &s.Value, &s.Status, &s.CanonicalName, &s.ReviewedAt, &s.CreatedAt)
+			if err != nil {
+				log.Printf("Error scanning taxonomy suggestion: %v", err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+			suggestions = append(suggestions, s)
+		}
+
+		if err = rows.Err(); err != nil {
+			log.Printf("Error iterating taxonomy suggestions: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(suggestions)
+	}
+}
+
+// ApproveSuggestionHandler adds a suggestion to the canonical taxonomy, or maps it
+// onto an existing term and re-tags every profile that used the free-text value
+// Used by: /api/admin/taxonomy/suggestions/{id}/approve
+func ApproveSuggestionHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		adminID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		suggestionID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid suggestion ID", http.StatusBadRequest)
+			return
+		}
+
+		var req ApproveRequest
+		if !httputil.DecodeOptionalJSON(w, r, &req) {
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			log.Printf("Error starting transaction: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		var kind, value, status string
+		err = tx.QueryRow(`
+			SELECT kind, value, status
+			FROM taxonomy_suggestions
+			WHERE id = $1
+			FOR UPDATE
+		`, suggestionID).Scan(&kind, &value, &status)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Suggestion not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error fetching taxonomy suggestion: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if status != "pending" {
+			http.Error(w, "Suggestion has already been reviewed", http.StatusConflict)
+			return
+		}
+
+		canonical := strings.TrimSpace(req.CanonicalName)
+		if canonical == "" {
+			canonical = value
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO taxonomy_terms (kind, name)
+			VALUES ($1, $2)
+			ON CONFLICT (kind, name) DO NOTHING
+		`, kind, canonical)
+		if err != nil {
+			log.Printf("Error adding taxonomy term: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		var retagged int64
+		if canonical != value {
+			retagQuery := RetagSectorsQuery
+			if kind == "target_group" {
+				retagQuery = RetagTargetGroupsQuery
+			}
+			result, err := tx.Exec(retagQuery, value, canonical)
+			if err != nil {
+				log.Printf("Error re-tagging profiles: %v", err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+			retagged, _ = result.RowsAffected()
+
+			if _, err := tx.Exec(UpsertSynonymQuery, value, canonical); err != nil {
+				log.Printf("Error recording taxonomy synonym: %v", err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		// Resolve every pending suggestion for the same term at once
+		_, err = tx.Exec(`
+			UPDATE taxonomy_suggestions
+			SET status = 'approved', canonical_name = $1, reviewed_by = $2, reviewed_at = CURRENT_TIMESTAMP
+			WHERE kind = $3 AND value = $4 AND status = 'pending'
+		`, canonical, adminID, kind, value)
+		if err != nil {
+			log.Printf("Error approving taxonomy suggestion: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		if err = tx.Commit(); err != nil {
+			log.Printf("Error committing taxonomy approval: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"kind":              kind,
+			"value":             value,
+			"canonical_name":    canonical,
+			"profiles_retagged": retagged,
+		})
+	}
+}
+
+// RejectSuggestionHandler marks a pending suggestion as rejected
+// Used by: /api/admin/taxonomy/suggestions/{id}/reject
+func RejectSuggestionHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		adminID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		suggestionID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid suggestion ID", http.StatusBadRequest)
+			return
+		}
+
+		result, err := db.Exec(`
+			UPDATE taxonomy_suggestions
+			SET status = 'rejected', reviewed_by = $1, reviewed_at = CURRENT_TIMESTAMP
+			WHERE id = $2 AND status = 'pending'
+		`, adminID, suggestionID)
+		if err != nil {
+			log.Printf("Error rejecting taxonomy suggestion: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if rowsAffected == 0 {
+			http.Error(w, "Pending suggestion not found", http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
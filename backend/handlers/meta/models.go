@@ -0,0 +1,32 @@
+package meta
+
+import "time"
+
+// Taxonomy lists the canonical sectors and target groups
+type Taxonomy struct {
+	Sectors      []string `json:"sectors"`
+	TargetGroups []string `json:"target_groups"`
+}
+
+// Suggestion represents a user-proposed taxonomy term
+type Suggestion struct {
+	ID            int        `json:"id"`
+	UserID        int        `json:"user_id"`
+	Kind          string     `json:"kind"` // "sector" or "target_group"
+	Value         string     `json:"value"`
+	Status        string     `json:"status"` // "pending", "approved" or "rejected"
+	CanonicalName *string    `json:"canonical_name,omitempty"`
+	ReviewedAt    *time.Time `json:"reviewed_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// SuggestionRequest represents the request body for proposing a term
+type SuggestionRequest struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+// ApproveRequest optionally maps a suggestion onto an existing canonical term
+type ApproveRequest struct {
+	CanonicalName string `json:"canonical_name"`
+}
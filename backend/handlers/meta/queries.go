@@ -0,0 +1,47 @@
+package meta
+
+const (
+	// SelectTaxonomyQuery retrieves all canonical taxonomy terms
+	SelectTaxonomyQuery = `
+		SELECT kind, name
+		FROM taxonomy_terms
+		ORDER BY kind, name
+	`
+
+	// InsertSuggestionQuery queues a proposed term for review
+	InsertSuggestionQuery = `
+		INSERT INTO taxonomy_suggestions (user_id, kind, value)
+		VALUES ($1, $2, $3)
+		RETURNING id, status, created_at
+	`
+
+	// SelectSuggestionsQuery lists suggestions with a given status
+	SelectSuggestionsQuery = `
+		SELECT id, user_id, kind, value, status, canonical_name, reviewed_at, created_at
+		FROM taxonomy_suggestions
+		WHERE status = $1
+		ORDER BY created_at
+	`
+
+	// RetagSectorsQuery replaces a free-text sector with its canonical term
+	RetagSectorsQuery = `
+		UPDATE profiles
+		SET sectors = array_replace(sectors, $1, $2)
+		WHERE $1 = ANY(sectors)
+	`
+
+	// RetagTargetGroupsQuery replaces a free-text target group with its canonical term
+	RetagTargetGroupsQuery = `
+		UPDATE profiles
+		SET target_groups = array_replace(target_groups, $1, $2)
+		WHERE $1 = ANY(target_groups)
+	`
+
+	// UpsertSynonymQuery records the suggestion as an alias of the canonical term
+	UpsertSynonymQuery = `
+		INSERT INTO taxonomy_synonyms (alias, canonical)
+		SELECT normalize_taxonomy_term($1), normalize_taxonomy_term($2)
+		WHERE normalize_taxonomy_term($1) <> normalize_taxonomy_term($2)
+		ON CONFLICT (alias) DO UPDATE SET canonical = EXCLUDED.canonical
+	`
+)
@@ -3,13 +3,19 @@ package notifications
 import (
 	"database/sql"
 	"encoding/json"
+	"fmt"
+	"log"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
 	"matcherator/backend/handlers/auth"
+	"matcherator/backend/handlers/wsproto"
+	"matcherator/backend/services/matches"
 
 	"github.com/gorilla/websocket"
+	"github.com/lib/pq"
 )
 
 type NotificationResponse struct {
@@ -17,7 +23,9 @@ type NotificationResponse struct {
 	NewConnections int `json:"newConnections"`
 }
 
-var notificationConnections = make(map[int]*websocket.Conn)
+// notificationConnections holds every open notification socket per user, one
+// per device, with the protocol version each speaks
+var notificationConnections = make(map[int]map[*websocket.Conn]int)
 var notifLock sync.Mutex
 
 func GetNotificationsHandler(db *sql.DB) http.HandlerFunc {
@@ -97,23 +105,23 @@ func MarkNotificationsAsReadHandler(db *sql.DB) http.HandlerFunc {
 	}
 }
 
-func HandleNotificationWebSocket() http.HandlerFunc {
+func HandleNotificationWebSocket(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		token := r.URL.Query().Get("token")
+		token := strings.TrimPrefix(r.URL.Query().Get("token"), "Bearer ")
 		if token == "" {
 			http.Error(w, "No token provided", http.StatusUnauthorized)
 			return
 		}
 
-		mockReq := &http.Request{
-			Header: http.Header{
-				"Authorization": []string{"Bearer " + token},
-			},
+		userID, err := auth.ValidateToken(db, token)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
 		}
 
-		userID, err := auth.GetUserIDFromToken(mockReq)
+		version, err := wsproto.ClientVersion(r)
 		if err != nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
@@ -130,49 +138,179 @@ func HandleNotificationWebSocket() http.HandlerFunc {
 
 		defer func() {
 			notifLock.Lock()
-			delete(notificationConnections, userID)
+			removeConnection(userID, conn)
 			notifLock.Unlock()
 			conn.Close()
 		}()
 
+		// Register and greet under the lock, so no event is written to the
+		// socket at the same time
+		data, _ := frame(version, "connected", nil)
 		notifLock.Lock()
-		notificationConnections[userID] = conn
-		notifLock.Unlock()
-
-		data, _ := json.Marshal(map[string]string{"type": "connected"})
+		if notificationConnections[userID] == nil {
+			notificationConnections[userID] = make(map[*websocket.Conn]int)
+		}
+		notificationConnections[userID][conn] = version
 		err = conn.WriteMessage(websocket.TextMessage, data)
+		notifLock.Unlock()
 		if err != nil {
 			return
 		}
+		auth.TouchActivity(db, userID)
 
 		for {
-			messageType, _, err := conn.ReadMessage()
+			messageType, p, err := conn.ReadMessage()
 			if err != nil {
 				if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 					// Log error if needed
 				}
 				break
 			}
+			auth.TouchActivity(db, userID)
 
 			if messageType == websocket.PingMessage {
-				if err := conn.WriteMessage(websocket.PongMessage, nil); err != nil {
+				notifLock.Lock()
+				err := conn.WriteMessage(websocket.PongMessage, nil)
+				notifLock.Unlock()
+				if err != nil {
 					break
 				}
+				continue
+			}
+
+			if message := handleFrame(db, userID, p); message != "" && version > 0 {
+				data, _ := frame(version, wsproto.TypeError, wsproto.Error{Message: message})
+				notifLock.Lock()
+				conn.WriteMessage(websocket.TextMessage, data)
+				notifLock.Unlock()
 			}
 		}
 	}
 }
 
+// handleFrame acts on an envelope sent over the notification socket,
+// returning why it could not. Unframed frames are ignored.
+func handleFrame(db *sql.DB, userID int, p []byte) string {
+	envelope, err := wsproto.Decode(p)
+	if err != nil {
+		return err.Error()
+	}
+	if envelope == nil {
+		return ""
+	}
+
+	switch envelope.Type {
+	case wsproto.TypeRead:
+		var data struct{}
+		if err := wsproto.DecodeData(envelope, &data); err != nil {
+			return err.Error()
+		}
+		if _, err := db.Exec(`
+			UPDATE notifications SET read_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND read_at IS NULL
+		`, userID); err != nil {
+			log.Printf("Error marking notifications read for user %d: %v", userID, err)
+			return "notifications could not be marked read"
+		}
+		return ""
+	default:
+		return fmt.Sprintf("unsupported frame type %q", envelope.Type)
+	}
+}
+
 // SendNotification broadcasts a notification to a specific user
 func SendNotification(userID int, messageType string) {
+	SendToUser(userID, messageType, nil)
+}
+
+// SendToUser writes an event to every notification socket the user has open,
+// one per device, framed for the protocol version each speaks
+func SendToUser(userID int, eventType string, payload interface{}) {
 	notifLock.Lock()
-	conn, exists := notificationConnections[userID]
-	notifLock.Unlock()
-
-	if exists {
-		data, _ := json.Marshal(map[string]string{
-			"type": messageType,
-		})
-		conn.WriteMessage(websocket.TextMessage, data)
+	defer notifLock.Unlock()
+
+	frames := make(map[int][]byte)
+	for conn, version := range notificationConnections[userID] {
+		data, ok := frames[version]
+		if !ok {
+			var err error
+			if data, err = frame(version, eventType, payload); err != nil {
+				log.Printf("Error encoding %s event: %v", eventType, err)
+				return
+			}
+			frames[version] = data
+		}
+
+		if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+			conn.Close()
+			removeConnection(userID, conn)
+		}
+	}
+}
+
+// removeConnection forgets one of the user's sockets, and the user once none
+// is left, leaving their other devices connected. The caller holds notifLock.
+func removeConnection(userID int, conn *websocket.Conn) {
+	delete(notificationConnections[userID], conn)
+	if len(notificationConnections[userID]) == 0 {
+		delete(notificationConnections, userID)
+	}
+}
+
+// ListenForMatchUpdates consumes match recalculation NOTIFY events and pushes a
+// "new_matches" event to the affected user's notification sockets
+func ListenForMatchUpdates(databaseURL string) {
+	listener := pq.NewListener(databaseURL, 10*time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("Match updates listener error: %v", err)
+		}
+	})
+	defer listener.Close()
+
+	if err := listener.Listen(matches.MatchUpdatesChannel); err != nil {
+		log.Printf("Error listening on %s: %v", matches.MatchUpdatesChannel, err)
+		return
+	}
+
+	for {
+		select {
+		case n := <-listener.Notify:
+			// A nil notification means the connection was re-established
+			if n == nil {
+				continue
+			}
+
+			var update matches.MatchUpdate
+			if err := json.Unmarshal([]byte(n.Extra), &update); err != nil {
+				log.Printf("Error decoding match update: %v", err)
+				continue
+			}
+
+			SendToUser(int(update.UserID), "new_matches", map[string]interface{}{
+				"count": update.Count,
+			})
+		case <-time.After(90 * time.Second):
+			go listener.Ping()
+		}
+	}
+}
+
+// frame encodes an event for a socket speaking version. The unframed protocol
+// sends the payload's fields and the type in one object.
+func frame(version int, eventType string, payload interface{}) ([]byte, error) {
+	if version > 0 {
+		return wsproto.Encode(eventType, payload)
+	}
+
+	fields := make(map[string]json.RawMessage)
+	if payload != nil {
+		encoded, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(encoded, &fields); err != nil {
+			return nil, err
+		}
 	}
+	fields["type"], _ = json.Marshal(eventType)
+	return json.Marshal(fields)
 }
@@ -0,0 +1,23 @@
+package notifications
+
+import (
+	"database/sql"
+	"log"
+)
+
+// InsertNotificationQuery records an in-app notification
+const InsertNotificationQuery = `
+	INSERT INTO notifications (user_id, type, content)
+	VALUES ($1, $2, $3)
+`
+
+// Notify records an in-app notification and pushes it to the user's sockets.
+// Errors are only logged, as the change the notification is about is already
+// saved.
+func Notify(db *sql.DB, userID int, notificationType, content string) {
+	if _, err := db.Exec(InsertNotificationQuery, userID, notificationType, content); err != nil {
+		log.Printf("Error creating %s notification for user %d: %v", notificationType, userID, err)
+		return
+	}
+	SendNotification(userID, notificationType)
+}
@@ -0,0 +1,97 @@
+package notifications
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"matcherator/backend/services/mail"
+)
+
+// Reminder is a reminder to send: an in-app notification and an email
+type Reminder struct {
+	UserID  int
+	Email   string
+	Type    string // notification type
+	Content string // in-app notification text
+	Subject string
+	Body    string
+	About   string // what the reminder is about, such as "task 12", for logs
+}
+
+// Reminders sends a feature's reminders periodically. Claim runs the query
+// that claims the reminders now due, so each is sent once, and Message turns
+// a claimed row into its reminder.
+type Reminders struct {
+	Name     string // what is reminded about, such as "task", for logs
+	Interval time.Duration
+	Claim    func(db *sql.DB) (*sql.Rows, error)
+	Message  func(rows *sql.Rows) (Reminder, error)
+}
+
+// Start sends the reminders due now and then every Interval until ctx is done
+func (r Reminders) Start(ctx context.Context, db *sql.DB) {
+	go func() {
+		ticker := time.NewTicker(r.Interval)
+		defer ticker.Stop()
+
+		for {
+			if err := r.send(db); err != nil {
+				log.Printf("Error sending %s reminders: %v", r.Name, err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// send claims the due reminders and sends them
+func (r Reminders) send(db *sql.DB) error {
+	rows, err := r.Claim(db)
+	if err != nil {
+		return fmt.Errorf("error claiming %s reminders: %v", r.Name, err)
+	}
+	defer rows.Close()
+
+	// Collect first so the notifications don't hold the claiming statement open
+	var reminders []Reminder
+	for rows.Next() {
+		reminder, err := r.Message(rows)
+		if err != nil {
+			return fmt.Errorf("error scanning %s reminder: %v", r.Name, err)
+		}
+		reminders = append(reminders, reminder)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating %s reminders: %v", r.Name, err)
+	}
+	rows.Close()
+
+	for _, reminder := range reminders {
+		Notify(db, reminder.UserID, reminder.Type, reminder.Content)
+		if err := mail.Enqueue(db, reminder.Email, reminder.Subject, reminder.Body); err != nil && err != mail.ErrNotConfigured {
+			log.Printf("Error queueing reminder email for %s: %v", reminder.About, err)
+		}
+	}
+	return nil
+}
+
+// DurationFromEnv parses a positive Go duration from the environment
+func DurationFromEnv(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	if d, err := time.ParseDuration(value); err == nil && d > 0 {
+		return d
+	}
+	log.Printf("Invalid %s %q, using %s", name, value, fallback)
+	return fallback
+}
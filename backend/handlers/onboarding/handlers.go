@@ -0,0 +1,193 @@
+package onboarding
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"matcherator/backend/handlers/auth"
+	"matcherator/backend/handlers/httputil"
+)
+
+// GetOnboardingHandler returns the current user's onboarding progress
+// Used by: /api/me/onboarding
+// Response: Onboarding
+func GetOnboardingHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		onboarding, err := loadOnboarding(db, userID)
+		if err != nil {
+			log.Printf("Error loading onboarding for user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(onboarding)
+	}
+}
+
+// UpdateOnboardingHandler completes, skips or reopens one onboarding step. A
+// step can only be completed or skipped after every earlier step.
+// Used by: /api/me/onboarding
+// Response: Onboarding
+func UpdateOnboardingHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req UpdateRequest
+		if !httputil.DecodeJSON(w, r, &req) {
+			return
+		}
+
+		position := stepPosition(req.Step)
+		if position < 0 {
+			http.Error(w, "step must be one of "+strings.Join(Steps, ", "), http.StatusBadRequest)
+			return
+		}
+		switch req.Status {
+		case StatusPending, StatusCompleted, StatusSkipped:
+		default:
+			http.Error(w, "status must be pending, completed or skipped", http.StatusBadRequest)
+			return
+		}
+
+		onboarding, err := loadOnboarding(db, userID)
+		if err != nil {
+			log.Printf("Error loading onboarding for user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		if req.Status != StatusPending {
+			for _, earlier := range onboarding.Steps[:position] {
+				if earlier.Status == StatusPending {
+					http.Error(w, fmt.Sprintf("Step %s must be completed or skipped first", earlier.Step), http.StatusConflict)
+					return
+				}
+			}
+		}
+
+		if _, err := db.Exec(UpsertStepQuery, userID, req.Step, req.Status); err != nil {
+			log.Printf("Error updating onboarding for user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		if onboarding, err = loadOnboarding(db, userID); err != nil {
+			log.Printf("Error loading onboarding for user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(onboarding)
+	}
+}
+
+// FunnelHandler reports how many users reach, complete, skip and drop off at
+// each onboarding step
+// Used by: /api/admin/onboarding/funnel?role=provider|recipient
+// Response: FunnelResponse
+func FunnelHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		role := r.URL.Query().Get("role")
+		if role != "" && role != "provider" && role != "recipient" {
+			http.Error(w, "role must be provider or recipient", http.StatusBadRequest)
+			return
+		}
+
+		rows, err := db.Query(SelectFunnelQuery, pq.Array(Steps), role)
+		if err != nil {
+			log.Printf("Error querying onboarding funnel: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		response := FunnelResponse{Role: role, Steps: []StepFunnel{}}
+		for rows.Next() {
+			var step StepFunnel
+			if err := rows.Scan(&step.Step, &step.Reached, &step.Completed, &step.Skipped, &response.Users); err != nil {
+				log.Printf("Error scanning onboarding funnel: %v", err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+			step.DroppedOff = step.Reached - step.Completed - step.Skipped
+			response.Steps = append(response.Steps, step)
+		}
+		if err := rows.Err(); err != nil {
+			log.Printf("Error iterating onboarding funnel: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// loadOnboarding returns the user's progress, with unrecorded steps pending
+func loadOnboarding(db *sql.DB, userID int) (*Onboarding, error) {
+	rows, err := db.Query(SelectStepsQuery, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying onboarding steps: %v", err)
+	}
+	defer rows.Close()
+
+	recorded := make(map[string]StepState)
+	for rows.Next() {
+		var state StepState
+		var updatedAt time.Time
+		if err := rows.Scan(&state.Step, &state.Status, &updatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning onboarding step: %v", err)
+		}
+		state.UpdatedAt = &updatedAt
+		recorded[state.Step] = state
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating onboarding steps: %v", err)
+	}
+
+	onboarding := &Onboarding{Steps: make([]StepState, 0, len(Steps))}
+	for _, step := range Steps {
+		state, ok := recorded[step]
+		if !ok {
+			state = StepState{Step: step, Status: StatusPending}
+		}
+		if state.Status == StatusPending && onboarding.CurrentStep == nil {
+			onboarding.CurrentStep = &state.Step
+		}
+		onboarding.Steps = append(onboarding.Steps, state)
+	}
+	onboarding.Finished = onboarding.CurrentStep == nil
+	return onboarding, nil
+}
+
+// stepPosition returns the index of step in Steps, or -1
+func stepPosition(step string) int {
+	for i, s := range Steps {
+		if s == step {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,60 @@
+package onboarding
+
+import "time"
+
+// Onboarding steps, in the order the flow walks through them
+const (
+	StepProfileBasics    = "profile_basics"
+	StepFundingDetails   = "funding_details"
+	StepPreferences      = "preferences"
+	StepFirstMatchReview = "first_match_review"
+)
+
+// Steps lists the onboarding steps in order
+var Steps = []string{StepProfileBasics, StepFundingDetails, StepPreferences, StepFirstMatchReview}
+
+// Step statuses. A step can be completed or skipped once every earlier step is
+// completed or skipped, and reopened (set back to pending) at any time.
+const (
+	StatusPending   = "pending"
+	StatusCompleted = "completed"
+	StatusSkipped   = "skipped"
+)
+
+// StepState is the progress of one step
+type StepState struct {
+	Step      string     `json:"step"`
+	Status    string     `json:"status"`
+	UpdatedAt *time.Time `json:"updated_at"`
+}
+
+// Onboarding is the user's progress through the onboarding flow
+type Onboarding struct {
+	Steps []StepState `json:"steps"`
+
+	// CurrentStep is the first pending step, or null once onboarding is finished
+	CurrentStep *string `json:"current_step"`
+	Finished    bool    `json:"finished"`
+}
+
+// UpdateRequest moves one step to a new status
+type UpdateRequest struct {
+	Step   string `json:"step"`
+	Status string `json:"status"`
+}
+
+// StepFunnel counts users at one step of the flow
+type StepFunnel struct {
+	Step       string `json:"step"`
+	Reached    int    `json:"reached"`     // every earlier step is done
+	Completed  int    `json:"completed"`   // completed this step
+	Skipped    int    `json:"skipped"`     // skipped this step
+	DroppedOff int    `json:"dropped_off"` // reached the step but neither completed nor skipped it
+}
+
+// FunnelResponse is the onboarding drop-off report
+type FunnelResponse struct {
+	Role  string       `json:"role"`
+	Users int          `json:"users"`
+	Steps []StepFunnel `json:"steps"`
+}
@@ -0,0 +1,57 @@
+package onboarding
+
+const (
+	// SelectStepsQuery returns the user's recorded step statuses
+	SelectStepsQuery = `
+		SELECT step, status, updated_at
+		FROM onboarding_steps
+		WHERE user_id = $1
+	`
+
+	// UpsertStepQuery records a step's status
+	UpsertStepQuery = `
+		INSERT INTO onboarding_steps (user_id, step, status)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, step) DO UPDATE
+		SET status = EXCLUDED.status, updated_at = CURRENT_TIMESTAMP
+	`
+
+	// SelectFunnelQuery counts, per step, the active users (optionally of one
+	// role) that reached, completed and skipped it. A user reached step n when
+	// steps 1..n-1 are all completed or skipped; $1 is the ordered step list.
+	SelectFunnelQuery = `
+		WITH steps AS (
+			SELECT step, position FROM unnest($1::text[]) WITH ORDINALITY AS s(step, position)
+		),
+		eligible AS (
+			SELECT id FROM users
+			WHERE status = 'active' AND deactivated_at IS NULL AND ($2 = '' OR role = $2)
+		),
+		progress AS (
+			SELECT e.id AS user_id, s.step, s.position, COALESCE(o.status, 'pending') AS status
+			FROM eligible e
+			CROSS JOIN steps s
+			LEFT JOIN onboarding_steps o ON o.user_id = e.id AND o.step = s.step
+		),
+		reached AS (
+			SELECT p.user_id, p.step, p.status
+			FROM progress p
+			WHERE NOT EXISTS (
+				SELECT 1 FROM progress earlier
+				WHERE earlier.user_id = p.user_id
+					AND earlier.position < p.position
+					AND earlier.status = 'pending'
+			)
+		)
+		SELECT
+			s.step,
+			COUNT(r.user_id),
+			COUNT(r.user_id) FILTER (WHERE r.status = 'completed'),
+			COUNT(r.user_id) FILTER (WHERE r.status = 'skipped'),
+			(SELECT COUNT(*) FROM eligible)
+		FROM steps s
+		LEFT JOIN reached r ON r.step = s.step
+		GROUP BY s.step, s.position
+		ORDER BY s.position
+	`
+)
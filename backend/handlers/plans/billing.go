@@ -0,0 +1,317 @@
+package plans
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"matcherator/backend/handlers/auth"
+	"matcherator/backend/handlers/httputil"
+	"matcherator/backend/handlers/notifications"
+	"matcherator/backend/services/billing"
+	"matcherator/backend/services/entitlements"
+	"matcherator/backend/services/mail"
+)
+
+// Notification types sent when billing changes the user's plan
+const (
+	NotificationPlanActivated     = "plan_activated"
+	NotificationPlanPaymentFailed = "plan_payment_failed"
+	NotificationPlanCanceled      = "plan_canceled"
+)
+
+// maxWebhookBytes caps a Stripe webhook payload
+const maxWebhookBytes = 1 << 20
+
+// CheckoutRequest picks the plan to buy
+type CheckoutRequest struct {
+	Plan string `json:"plan"`
+}
+
+// SessionResponse is a Stripe page to send the user to
+type SessionResponse struct {
+	URL string `json:"url"`
+}
+
+// CheckoutHandler starts a Stripe checkout for a paid plan
+// Used by: /api/me/billing/checkout
+// Response: SessionResponse
+func CheckoutHandler(db *sql.DB, stripe *billing.Stripe) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if stripe == nil {
+			http.Error(w, "Billing is not available", http.StatusServiceUnavailable)
+			return
+		}
+
+		var req CheckoutRequest
+		if !httputil.DecodeJSON(w, r, &req) {
+			return
+		}
+		price, ok := stripe.PriceFor(req.Plan)
+		if !ok {
+			http.Error(w, fmt.Sprintf("Plan %q cannot be purchased", req.Plan), http.StatusBadRequest)
+			return
+		}
+
+		subscription, err := entitlements.LoadSubscription(db, userID)
+		if err != nil {
+			log.Printf("Error loading subscription of user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if subscription != nil && subscription.Provider == billing.ProviderStripe && subscription.Status != entitlements.StatusCanceled {
+			http.Error(w, "You already have a subscription. Change or cancel it in the billing portal", http.StatusConflict)
+			return
+		}
+
+		customerID, ok := customerFor(w, db, stripe, userID, true)
+		if !ok {
+			return
+		}
+
+		base := strings.TrimRight(os.Getenv("FRONTEND_URL"), "/") + "/billing"
+		url, err := stripe.CreateCheckoutSession(userID, customerID, price, base+"?checkout=success", base+"?checkout=canceled")
+		if err != nil {
+			log.Printf("Error starting checkout for user %d: %v", userID, err)
+			http.Error(w, "Could not start checkout", http.StatusBadGateway)
+			return
+		}
+
+		json.NewEncoder(w).Encode(SessionResponse{URL: url})
+	}
+}
+
+// PortalHandler opens Stripe's billing portal, where the user updates payment
+// details or cancels their subscription
+// Used by: /api/me/billing/portal
+// Response: SessionResponse
+func PortalHandler(db *sql.DB, stripe *billing.Stripe) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if stripe == nil {
+			http.Error(w, "Billing is not available", http.StatusServiceUnavailable)
+			return
+		}
+
+		customerID, ok := customerFor(w, db, stripe, userID, false)
+		if !ok {
+			return
+		}
+
+		url, err := stripe.CreatePortalSession(customerID, strings.TrimRight(os.Getenv("FRONTEND_URL"), "/")+"/billing")
+		if err != nil {
+			log.Printf("Error opening billing portal for user %d: %v", userID, err)
+			http.Error(w, "Could not open the billing portal", http.StatusBadGateway)
+			return
+		}
+
+		json.NewEncoder(w).Encode(SessionResponse{URL: url})
+	}
+}
+
+// StripeWebhookHandler receives Stripe events and syncs the subscriptions they
+// concern to the entitlements service. Errors make Stripe retry the event.
+// Used by: /api/billing/stripe/webhook
+func StripeWebhookHandler(db *sql.DB, stripe *billing.Stripe) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if stripe == nil {
+			http.Error(w, "Billing is not available", http.StatusServiceUnavailable)
+			return
+		}
+
+		payload, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBytes))
+		if err != nil {
+			http.Error(w, "Error reading request", http.StatusBadRequest)
+			return
+		}
+
+		event, err := stripe.ParseEvent(payload, r.Header.Get("Stripe-Signature"), time.Now())
+		if err == billing.ErrInvalidSignature {
+			http.Error(w, "Invalid signature", http.StatusBadRequest)
+			return
+		} else if err != nil {
+			http.Error(w, "Invalid event", http.StatusBadRequest)
+			return
+		}
+
+		subscriptionID, err := eventSubscription(event)
+		if err != nil {
+			log.Printf("Error decoding Stripe event %s: %v", event.ID, err)
+			http.Error(w, "Invalid event", http.StatusBadRequest)
+			return
+		}
+		if subscriptionID == "" {
+			// Not about a subscription
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		isNew, err := billing.ClaimEvent(db, event)
+		if err != nil {
+			log.Printf("Error claiming Stripe event %s: %v", event.ID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if !isNew {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		change, err := stripe.SyncSubscription(db, subscriptionID)
+		if err != nil {
+			log.Printf("Error syncing subscription %s for Stripe event %s: %v", subscriptionID, event.ID, err)
+			if err := billing.ReleaseEvent(db, event); err != nil {
+				log.Printf("Error releasing Stripe event %s: %v", event.ID, err)
+			}
+			http.Error(w, "Error syncing subscription", http.StatusInternalServerError)
+			return
+		}
+		if change != nil {
+			notifyChange(db, change)
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// eventSubscription returns the subscription a Stripe event is about, or ""
+func eventSubscription(event *billing.Event) (string, error) {
+	switch event.Type {
+	case "customer.subscription.created", "customer.subscription.updated", "customer.subscription.deleted":
+		var subscription struct {
+			ID string `json:"id"`
+		}
+		err := json.Unmarshal(event.Data.Object, &subscription)
+		return subscription.ID, err
+	case "checkout.session.completed", "invoice.paid", "invoice.payment_failed":
+		var object struct {
+			Subscription *string `json:"subscription"`
+			Parent       *struct {
+				SubscriptionDetails *struct {
+					Subscription string `json:"subscription"`
+				} `json:"subscription_details"`
+			} `json:"parent"`
+		}
+		if err := json.Unmarshal(event.Data.Object, &object); err != nil {
+			return "", err
+		}
+		if object.Subscription != nil {
+			return *object.Subscription, nil
+		}
+		if object.Parent != nil && object.Parent.SubscriptionDetails != nil {
+			return object.Parent.SubscriptionDetails.Subscription, nil
+		}
+		return "", nil
+	default:
+		return "", nil
+	}
+}
+
+// customerFor returns the user's Stripe customer, creating it when create is
+// set, and writes the error response when there is none
+func customerFor(w http.ResponseWriter, db *sql.DB, stripe *billing.Stripe, userID int, create bool) (string, bool) {
+	customerID, err := billing.CustomerFor(db, userID)
+	if err != nil {
+		log.Printf("Error loading billing customer of user %d: %v", userID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return "", false
+	}
+	if customerID != "" {
+		return customerID, true
+	}
+	if !create {
+		http.Error(w, "No billing account yet. Subscribe to a plan first", http.StatusNotFound)
+		return "", false
+	}
+
+	var email, name string
+	err = db.QueryRow(`
+		SELECT COALESCE(u.billing_email, u.email), COALESCE(p.organization_name, '')
+		FROM users u
+		LEFT JOIN profiles p ON p.user_id = u.id
+		WHERE u.id = $1
+	`, userID).Scan(&email, &name)
+	if err != nil {
+		log.Printf("Error loading user %d: %v", userID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return "", false
+	}
+
+	customerID, err = stripe.CreateCustomer(userID, email, name)
+	if err != nil {
+		log.Printf("Error creating billing customer for user %d: %v", userID, err)
+		http.Error(w, "Could not start checkout", http.StatusBadGateway)
+		return "", false
+	}
+	if err := billing.SaveCustomer(db, userID, customerID); err != nil {
+		log.Printf("Error saving billing customer of user %d: %v", userID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return "", false
+	}
+	return customerID, true
+}
+
+// notifyChange tells the user when billing started, suspended or ended their
+// paid plan
+func notifyChange(db *sql.DB, change *billing.Change) {
+	previousStatus := ""
+	if change.Previous != nil {
+		previousStatus = change.Previous.Status
+	}
+	current := change.Current
+	if current.Status == previousStatus {
+		return
+	}
+
+	switch current.Status {
+	case entitlements.StatusActive:
+		notifications.Notify(db, change.UserID, NotificationPlanActivated, fmt.Sprintf("Your %s plan is active.", current.Plan))
+	case entitlements.StatusPastDue:
+		until := "soon"
+		if current.GraceUntil != nil {
+			until = current.GraceUntil.UTC().Format("Mon Jan 2, 2006")
+		}
+		message := fmt.Sprintf("Your payment for the %s plan failed. You keep the plan until %s; update your payment details to keep it after that.", current.Plan, until)
+		notifications.Notify(db, change.UserID, NotificationPlanPaymentFailed, message)
+		emailUser(db, change.UserID, "Your payment failed", message)
+	case entitlements.StatusCanceled:
+		if previousStatus != "" {
+			notifications.Notify(db, change.UserID, NotificationPlanCanceled, fmt.Sprintf("Your %s plan has ended. You are now on the free plan.", current.Plan))
+		}
+	}
+}
+
+// emailUser queues an email about billing to the user's billing email
+func emailUser(db *sql.DB, userID int, subject, message string) {
+	email, err := billing.BillingEmail(db, userID)
+	if err != nil {
+		log.Printf("Error loading billing email of user %d: %v", userID, err)
+		return
+	}
+
+	body := message + "\n\nManage your subscription here:\n" + strings.TrimRight(os.Getenv("FRONTEND_URL"), "/") + "/billing\n"
+	if err := mail.Enqueue(db, email, subject, body); err != nil && err != mail.ErrNotConfigured {
+		log.Printf("Error queueing billing email for user %d: %v", userID, err)
+	}
+}
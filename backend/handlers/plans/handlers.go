@@ -0,0 +1,129 @@
+package plans
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"matcherator/backend/handlers/auth"
+	"matcherator/backend/handlers/httputil"
+	"matcherator/backend/services/entitlements"
+
+	"github.com/gorilla/mux"
+)
+
+// SubscriptionRequest assigns a plan by hand, e.g. for partners or while
+// billing is settled offline
+type SubscriptionRequest struct {
+	Plan             string     `json:"plan"`
+	CurrentPeriodEnd *time.Time `json:"current_period_end"` // Open-ended when null
+}
+
+// ListPlansHandler lists the plans with their limits
+// Used by: /api/plans
+// Response: []entitlements.Plan
+func ListPlansHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		plans := make([]entitlements.Plan, 0, len(entitlements.Plans))
+		for _, plan := range entitlements.Plans {
+			plans = append(plans, plan)
+		}
+		sort.Slice(plans, func(i, j int) bool {
+			return plans[i].Name < plans[j].Name
+		})
+
+		json.NewEncoder(w).Encode(plans)
+	}
+}
+
+// GetMyPlanHandler reports the user's plan and their usage against its limits
+// Used by: /api/me/plan
+// Response: entitlements.UsageReport
+func GetMyPlanHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		report, err := entitlements.Usage(db, userID)
+		if err != nil {
+			log.Printf("Error loading usage for user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+// SetUserPlanHandler lets an admin assign a user's plan by hand
+// Used by: /api/admin/users/{id}/plan
+// Response: entitlements.UsageReport
+func SetUserPlanHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		var req SubscriptionRequest
+		if !httputil.DecodeJSON(w, r, &req) {
+			return
+		}
+		if _, ok := entitlements.Plans[req.Plan]; !ok {
+			http.Error(w, fmt.Sprintf("Unknown plan %q", req.Plan), http.StatusBadRequest)
+			return
+		}
+
+		var exists bool
+		if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)", userID).Scan(&exists); err != nil {
+			log.Printf("Error checking user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if !exists {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+
+		err = entitlements.SetSubscription(db, userID, entitlements.Subscription{
+			Plan:             req.Plan,
+			Status:           entitlements.StatusActive,
+			Provider:         "manual",
+			CurrentPeriodEnd: req.CurrentPeriodEnd,
+		})
+		if err != nil {
+			log.Printf("Error setting plan of user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		report, err := entitlements.Usage(db, userID)
+		if err != nil {
+			log.Printf("Error loading usage for user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+// QuotaExceeded writes the response for a request over the plan's limits
+func QuotaExceeded(w http.ResponseWriter, message string) {
+	http.Error(w, message+". Upgrade your plan to raise the limit", http.StatusPaymentRequired)
+}
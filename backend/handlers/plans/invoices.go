@@ -0,0 +1,235 @@
+package plans
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"matcherator/backend/handlers/auth"
+	"matcherator/backend/handlers/httputil"
+	"matcherator/backend/services/billing"
+	"matcherator/backend/services/emaildomains"
+)
+
+const (
+	defaultInvoicePageSize = 20
+	maxInvoicePageSize     = 100
+	maxEmailLen            = 255
+)
+
+// Invoice is an invoice from the billing provider. Amounts are in the
+// currency's smallest unit (e.g. cents).
+type Invoice struct {
+	ID          string     `json:"id"`
+	Number      string     `json:"number"`
+	Status      string     `json:"status"` // draft, open, paid, uncollectible or void
+	Currency    string     `json:"currency"`
+	AmountDue   int64      `json:"amount_due"`
+	AmountPaid  int64      `json:"amount_paid"`
+	CreatedAt   time.Time  `json:"created_at"`
+	PeriodStart *time.Time `json:"period_start"`
+	PeriodEnd   *time.Time `json:"period_end"`
+	HostedURL   string     `json:"hosted_url"` // Page to view or pay the invoice, with the receipt once paid
+	PDFURL      string     `json:"pdf_url"`
+}
+
+// InvoicesResponse is a page of invoices, newest first
+type InvoicesResponse struct {
+	Invoices []Invoice `json:"invoices"`
+	HasMore  bool      `json:"has_more"` // Pass the last ID as starting_after for the next page
+}
+
+// BillingSettings says where invoices and billing mail go
+type BillingSettings struct {
+	BillingEmail *string `json:"billing_email"` // Null to use the login email
+	LoginEmail   string  `json:"login_email"`
+}
+
+// BillingSettingsRequest sets or, with null or "", clears the billing email
+type BillingSettingsRequest struct {
+	BillingEmail *string `json:"billing_email"`
+}
+
+// GetInvoicesHandler lists the user's invoices from the billing provider
+// Used by: /api/me/billing/invoices?limit=&starting_after=
+// Response: InvoicesResponse
+func GetInvoicesHandler(db *sql.DB, stripe *billing.Stripe) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		limit := defaultInvoicePageSize
+		if value := r.URL.Query().Get("limit"); value != "" {
+			limit, err = strconv.Atoi(value)
+			if err != nil || limit < 1 || limit > maxInvoicePageSize {
+				http.Error(w, "limit must be between 1 and 100", http.StatusBadRequest)
+				return
+			}
+		}
+
+		customerID, err := billing.CustomerFor(db, userID)
+		if err != nil {
+			log.Printf("Error loading billing customer of user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if customerID == "" || stripe == nil {
+			// Never billed
+			json.NewEncoder(w).Encode(InvoicesResponse{Invoices: []Invoice{}})
+			return
+		}
+
+		page, hasMore, err := stripe.ListInvoices(customerID, limit, r.URL.Query().Get("starting_after"))
+		if err != nil {
+			log.Printf("Error listing invoices of user %d: %v", userID, err)
+			http.Error(w, "Could not load invoices", http.StatusBadGateway)
+			return
+		}
+
+		response := InvoicesResponse{Invoices: []Invoice{}, HasMore: hasMore}
+		for _, invoice := range page {
+			response.Invoices = append(response.Invoices, Invoice{
+				ID:          invoice.ID,
+				Number:      invoice.Number,
+				Status:      invoice.Status,
+				Currency:    invoice.Currency,
+				AmountDue:   invoice.AmountDue,
+				AmountPaid:  invoice.AmountPaid,
+				CreatedAt:   time.Unix(invoice.Created, 0).UTC(),
+				PeriodStart: unixTime(invoice.PeriodStart),
+				PeriodEnd:   unixTime(invoice.PeriodEnd),
+				HostedURL:   invoice.HostedInvoiceURL,
+				PDFURL:      invoice.InvoicePDF,
+			})
+		}
+
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// GetBillingSettingsHandler returns where the user's billing mail goes
+// Used by: /api/me/billing/settings
+// Response: BillingSettings
+func GetBillingSettingsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		settings, err := loadBillingSettings(db, userID)
+		if err != nil {
+			log.Printf("Error loading billing settings of user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(settings)
+	}
+}
+
+// UpdateBillingSettingsHandler sets the email invoices and billing mail go
+// to, also on the billing provider's customer
+// Used by: /api/me/billing/settings
+// Response: BillingSettings
+func UpdateBillingSettingsHandler(db *sql.DB, stripe *billing.Stripe) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req BillingSettingsRequest
+		if !httputil.DecodeJSON(w, r, &req) {
+			return
+		}
+
+		var billingEmail *string
+		if req.BillingEmail != nil {
+			if email := strings.TrimSpace(*req.BillingEmail); email != "" {
+				address, err := mail.ParseAddress(email)
+				if err != nil || address.Address != email || len(email) > maxEmailLen {
+					http.Error(w, "Invalid billing email", http.StatusBadRequest)
+					return
+				}
+				if blocked, err := emaildomains.Blocked(db, email); err != nil {
+					log.Printf("Error checking billing email domain of user %d: %v", userID, err)
+					http.Error(w, "Database error", http.StatusInternalServerError)
+					return
+				} else if blocked {
+					http.Error(w, "Please use a permanent billing email. Disposable email providers are not accepted", http.StatusBadRequest)
+					return
+				}
+				billingEmail = &email
+			}
+		}
+
+		if _, err := db.Exec("UPDATE users SET billing_email = $2 WHERE id = $1", userID, billingEmail); err != nil {
+			log.Printf("Error saving billing email of user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		settings, err := loadBillingSettings(db, userID)
+		if err != nil {
+			log.Printf("Error loading billing settings of user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		if stripe != nil {
+			customerID, err := billing.CustomerFor(db, userID)
+			if err != nil {
+				log.Printf("Error loading billing customer of user %d: %v", userID, err)
+			} else if customerID != "" {
+				email := settings.LoginEmail
+				if settings.BillingEmail != nil {
+					email = *settings.BillingEmail
+				}
+				if err := stripe.UpdateCustomerEmail(customerID, email); err != nil {
+					// Don't return error here as the setting was still saved successfully
+					log.Printf("Error updating billing email of user %d: %v", userID, err)
+				}
+			}
+		}
+
+		json.NewEncoder(w).Encode(settings)
+	}
+}
+
+// loadBillingSettings returns the user's billing and login emails
+func loadBillingSettings(db *sql.DB, userID int) (*BillingSettings, error) {
+	var settings BillingSettings
+	err := db.QueryRow("SELECT billing_email, email FROM users WHERE id = $1", userID).Scan(
+		&settings.BillingEmail, &settings.LoginEmail,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// unixTime converts a Unix timestamp, with 0 meaning unset
+func unixTime(seconds int64) *time.Time {
+	if seconds == 0 {
+		return nil
+	}
+	t := time.Unix(seconds, 0).UTC()
+	return &t
+}
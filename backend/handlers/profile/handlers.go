@@ -7,14 +7,25 @@ import (
 	"log"
 	"net/http"
 	"strconv"
+	"time"
 
 	"matcherator/backend/handlers/auth"
+	"matcherator/backend/handlers/httputil"
+	"matcherator/backend/handlers/referrals"
 	"matcherator/backend/handlers/user_status"
+	"matcherator/backend/services/fieldcrypt"
+	"matcherator/backend/services/matches"
+	"matcherator/backend/services/moderation"
+	"matcherator/backend/services/track"
+	"matcherator/backend/services/translate"
 
 	"github.com/gorilla/mux"
 	"github.com/lib/pq"
 )
 
+// minFoundedYear is the earliest founding year accepted on a profile
+const minFoundedYear = 1600
+
 type Handler struct {
 	db *sql.DB
 }
@@ -32,6 +43,7 @@ func GetUserProfileHandler(db *sql.DB) http.HandlerFunc {
 		vars := mux.Vars(r)
 		if id := vars["id"]; id != "" {
 			userID = id
+			recordProfileView(db, r, id)
 		} else {
 			// If no ID in URL, get from token (for /api/me/profile)
 			tokenUserID, err := auth.GetUserIDFromToken(r)
@@ -45,29 +57,7 @@ func GetUserProfileHandler(db *sql.DB) http.HandlerFunc {
 
 		log.Printf("Fetching profile for user ID: %s", userID)
 
-		var response ProfileResponse
-		var sectorsJSON, targetGroupsJSON string
-		err := db.QueryRow(SelectProfileQuery, userID).Scan(
-			&response.ID,
-			&response.OrganizationName,
-			&response.ProfilePictureURL,
-			&response.MissionStatement,
-			&response.State,
-			&response.City,
-			&response.ZipCode,
-			&response.EIN,
-			&response.Language,
-			&response.ApplicantType,
-			&sectorsJSON,
-			&targetGroupsJSON,
-			&response.ProjectStage,
-			&response.WebsiteURL,
-			&response.ContactEmail,
-			&response.ChatOptIn,
-			&response.Location,
-			&response.Role,
-			&response.Status,
-		)
+		row, err := loadProfile(db, userID)
 
 		if err == sql.ErrNoRows {
 			log.Printf("Profile not found for user ID: %s", userID)
@@ -78,22 +68,49 @@ func GetUserProfileHandler(db *sql.DB) http.HandlerFunc {
 			http.Error(w, "Database error", http.StatusInternalServerError)
 			return
 		}
+		response := row.response()
+
+		if err := decryptSensitiveFields(&response); err != nil {
+			log.Printf("Error decrypting profile for user ID %s: %v", userID, err)
+			http.Error(w, "Error reading profile", http.StatusInternalServerError)
+			return
+		}
 
-		log.Printf("Raw sectors JSON: %s", sectorsJSON)
-		log.Printf("Raw target groups JSON: %s", targetGroupsJSON)
+		log.Printf("Raw sectors JSON: %s", row.SectorsJSON)
+		log.Printf("Raw target groups JSON: %s", row.TargetGroupsJSON)
 
 		// Parse JSON arrays into string slices
-		if err := json.Unmarshal([]byte(sectorsJSON), &response.Sectors); err != nil {
+		if err := json.Unmarshal([]byte(row.SectorsJSON), &response.Sectors); err != nil {
 			log.Printf("Error parsing sectors JSON: %v", err)
 			http.Error(w, "Error parsing sectors", http.StatusInternalServerError)
 			return
 		}
-		if err := json.Unmarshal([]byte(targetGroupsJSON), &response.TargetGroups); err != nil {
+		if err := json.Unmarshal([]byte(row.TargetGroupsJSON), &response.TargetGroups); err != nil {
 			log.Printf("Error parsing target groups JSON: %v", err)
 			http.Error(w, "Error parsing target groups", http.StatusInternalServerError)
 			return
 		}
 
+		// Translate the mission statement into the viewer's language and tell
+		// them whether they bookmarked the profile
+		if vars["id"] != "" {
+			if viewerID, err := auth.GetUserIDFromToken(r); err == nil && viewerID != response.ID {
+				viewerLanguage := translate.UserLanguage(db, viewerID)
+				if translated, ok := translate.Translate(db, response.MissionStatement, response.Language, viewerLanguage); ok {
+					response.MissionStatementTranslated = &translated
+					response.TranslatedTo = viewerLanguage
+				}
+
+				var bookmarked bool
+				if err := db.QueryRow(SelectBookmarkedQuery, viewerID, response.ID).Scan(&bookmarked); err != nil {
+					log.Printf("Error checking bookmark of user %d for user %d: %v", response.ID, viewerID, err)
+					http.Error(w, "Database error", http.StatusInternalServerError)
+					return
+				}
+				response.Bookmarked = &bookmarked
+			}
+		}
+
 		// Send response
 		w.WriteHeader(http.StatusOK)
 		if err := json.NewEncoder(w).Encode(response); err != nil {
@@ -104,6 +121,67 @@ func GetUserProfileHandler(db *sql.DB) http.HandlerFunc {
 	}
 }
 
+// decryptSensitiveFields decrypts the EIN and contact email read from the database
+func decryptSensitiveFields(profile *ProfileResponse) error {
+	var err error
+	if profile.EIN, err = fieldcrypt.Decrypt(profile.EIN); err != nil {
+		return err
+	}
+	profile.ContactEmail, err = fieldcrypt.Decrypt(profile.ContactEmail)
+	return err
+}
+
+// loadProfile returns a user's SelectProfileQuery row, sql.ErrNoRows when
+// they have no profile
+func loadProfile(db *sql.DB, userID string) (profileRow, error) {
+	var row profileRow
+	err := db.QueryRow(SelectProfileQuery, userID).Scan(
+		&row.ID,
+		&row.OrganizationName,
+		&row.ProfilePictureURL,
+		&row.ProfilePictureAlt,
+		&row.MissionStatement,
+		&row.State,
+		&row.City,
+		&row.ZipCode,
+		&row.EIN,
+		&row.Language,
+		&row.ApplicantType,
+		&row.SectorsJSON,
+		&row.TargetGroupsJSON,
+		&row.ProjectStage,
+		&row.WebsiteURL,
+		&row.ContactEmail,
+		&row.ChatOptIn,
+		&row.PublicListing,
+		&row.AnnualBudget,
+		&row.StaffSize,
+		&row.FoundedYear,
+		&row.Location,
+		&row.Role,
+		&row.DualRole,
+		&row.Status,
+	)
+	return row, err
+}
+
+// recordProfileView stores that the requesting user viewed another user's profile,
+// feeding the provider dashboard funnel
+func recordProfileView(db *sql.DB, r *http.Request, viewedID string) {
+	viewerID, err := auth.GetUserIDFromToken(r)
+	if err != nil || strconv.Itoa(viewerID) == viewedID {
+		return
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO profile_views (viewer_id, viewed_id)
+		VALUES ($1, $2)
+	`, viewerID, viewedID)
+	if err != nil {
+		log.Printf("Error recording profile view: %v", err)
+	}
+}
+
 // GetUserBioHandler returns a user's biographical information
 func GetUserBioHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -172,43 +250,27 @@ func (h *Handler) UpdateProfileHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// First, get the existing profile
-	var existingProfile ProfileResponse
-	var sectorsJSON, targetGroupsJSON string
-	err = h.db.QueryRow(SelectProfileQuery, userID).Scan(
-		&existingProfile.ID,
-		&existingProfile.OrganizationName,
-		&existingProfile.ProfilePictureURL,
-		&existingProfile.MissionStatement,
-		&existingProfile.State,
-		&existingProfile.City,
-		&existingProfile.ZipCode,
-		&existingProfile.EIN,
-		&existingProfile.Language,
-		&existingProfile.ApplicantType,
-		&sectorsJSON,
-		&targetGroupsJSON,
-		&existingProfile.ProjectStage,
-		&existingProfile.WebsiteURL,
-		&existingProfile.ContactEmail,
-		&existingProfile.ChatOptIn,
-		&existingProfile.Location,
-		&existingProfile.Role,
-		&existingProfile.Status,
-	)
+	row, err := loadProfile(h.db, strconv.Itoa(userID))
 
 	if err != nil {
 		log.Printf("Error fetching existing profile: %v", err)
 		http.Error(w, "Error fetching existing profile", http.StatusInternalServerError)
 		return
 	}
+	existingProfile := row.response()
+	if err := decryptSensitiveFields(&existingProfile); err != nil {
+		log.Printf("Error decrypting existing profile: %v", err)
+		http.Error(w, "Error fetching existing profile", http.StatusInternalServerError)
+		return
+	}
 
 	// Parse JSON arrays into string slices
-	if err := json.Unmarshal([]byte(sectorsJSON), &existingProfile.Sectors); err != nil {
+	if err := json.Unmarshal([]byte(row.SectorsJSON), &existingProfile.Sectors); err != nil {
 		log.Printf("Error parsing existing sectors: %v", err)
 		http.Error(w, "Error parsing sectors", http.StatusInternalServerError)
 		return
 	}
-	if err := json.Unmarshal([]byte(targetGroupsJSON), &existingProfile.TargetGroups); err != nil {
+	if err := json.Unmarshal([]byte(row.TargetGroupsJSON), &existingProfile.TargetGroups); err != nil {
 		log.Printf("Error parsing existing target groups: %v", err)
 		http.Error(w, "Error parsing target groups", http.StatusInternalServerError)
 		return
@@ -231,11 +293,14 @@ func (h *Handler) UpdateProfileHandler(w http.ResponseWriter, r *http.Request) {
 		WebsiteURL        *string  `json:"website_url,omitempty"`
 		ContactEmail      *string  `json:"contact_email,omitempty"`
 		ChatOptIn         *bool    `json:"chat_opt_in,omitempty"`
+		PublicListing     *bool    `json:"public_listing,omitempty"`
+		AnnualBudget      *float64 `json:"annual_budget,omitempty"`
+		StaffSize         *int     `json:"staff_size,omitempty"`
+		FoundedYear       *int     `json:"founded_year,omitempty"`
 		Location          *string  `json:"location,omitempty"`
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&updateRequest); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if !httputil.DecodeJSON(w, r, &updateRequest) {
 		return
 	}
 
@@ -288,6 +353,65 @@ func (h *Handler) UpdateProfileHandler(w http.ResponseWriter, r *http.Request) {
 	if updateRequest.Location != nil {
 		existingProfile.Location = *updateRequest.Location
 	}
+	if updateRequest.PublicListing != nil {
+		if *updateRequest.PublicListing && existingProfile.Role != "provider" && !existingProfile.DualRole {
+			http.Error(w, "Only providers can be listed in the public directory", http.StatusBadRequest)
+			return
+		}
+		existingProfile.PublicListing = *updateRequest.PublicListing
+	}
+	if updateRequest.AnnualBudget != nil {
+		if *updateRequest.AnnualBudget < 0 {
+			http.Error(w, "Annual budget cannot be negative", http.StatusBadRequest)
+			return
+		}
+		existingProfile.AnnualBudget = updateRequest.AnnualBudget
+	}
+	if updateRequest.StaffSize != nil {
+		if *updateRequest.StaffSize < 0 {
+			http.Error(w, "Staff size cannot be negative", http.StatusBadRequest)
+			return
+		}
+		existingProfile.StaffSize = updateRequest.StaffSize
+	}
+	if updateRequest.FoundedYear != nil {
+		if *updateRequest.FoundedYear < minFoundedYear || *updateRequest.FoundedYear > time.Now().Year() {
+			http.Error(w, fmt.Sprintf("Founding year must be between %d and this year", minFoundedYear), http.StatusBadRequest)
+			return
+		}
+		existingProfile.FoundedYear = updateRequest.FoundedYear
+	}
+
+	// Screen the public text before saving it
+	moderated := []moderation.Field{
+		{Name: "organization_name", Text: existingProfile.OrganizationName},
+		{Name: "mission_statement", Text: existingProfile.MissionStatement},
+	}
+	review := moderation.Review(moderated...)
+	if blocked := review.Blocked(); blocked != nil {
+		http.Error(w, blocked.Message(), http.StatusBadRequest)
+		return
+	}
+
+	// Encrypt sensitive fields at rest
+	encryptedEIN, err := fieldcrypt.Encrypt(existingProfile.EIN)
+	if err != nil {
+		log.Printf("Error encrypting EIN: %v", err)
+		http.Error(w, "Failed to update profile", http.StatusInternalServerError)
+		return
+	}
+	encryptedContactEmail, err := fieldcrypt.Encrypt(existingProfile.ContactEmail)
+	if err != nil {
+		log.Printf("Error encrypting contact email: %v", err)
+		http.Error(w, "Failed to update profile", http.StatusInternalServerError)
+		return
+	}
+
+	// Snapshot matching inputs so only relevant edits trigger a match update
+	before, err := matches.LoadMatchProfile(h.db, int64(userID))
+	if err != nil {
+		log.Printf("Error loading match profile: %v", err)
+	}
 
 	// Start transaction
 	tx, err := h.db.Begin()
@@ -316,24 +440,32 @@ func (h *Handler) UpdateProfileHandler(w http.ResponseWriter, r *http.Request) {
 			website_url = $13,
 			contact_email = $14,
 			chat_opt_in = $15,
-			location = $16
-		WHERE user_id = $17
+			location = $16,
+			public_listing = $17,
+			annual_budget = $18,
+			staff_size = $19,
+			founded_year = $20
+		WHERE user_id = $21
 	`, existingProfile.OrganizationName,
 		existingProfile.ProfilePictureURL,
 		existingProfile.MissionStatement,
 		existingProfile.State,
 		existingProfile.City,
 		existingProfile.ZipCode,
-		existingProfile.EIN,
+		encryptedEIN,
 		existingProfile.Language,
 		existingProfile.ApplicantType,
 		pq.Array(existingProfile.Sectors),
 		pq.Array(existingProfile.TargetGroups),
 		existingProfile.ProjectStage,
 		existingProfile.WebsiteURL,
-		existingProfile.ContactEmail,
+		encryptedContactEmail,
 		existingProfile.ChatOptIn,
 		existingProfile.Location,
+		existingProfile.PublicListing,
+		existingProfile.AnnualBudget,
+		existingProfile.StaffSize,
+		existingProfile.FoundedYear,
 		userID)
 
 	if err != nil {
@@ -349,6 +481,13 @@ func (h *Handler) UpdateProfileHandler(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Rows affected by update: %d", rowsAffected)
 	}
 
+	// Queue flagged text for admin review
+	if err := moderation.Record(tx, userID, moderation.ContentProfile, userID, moderated, review); err != nil {
+		log.Printf("Error recording moderation flags for user %d: %v", userID, err)
+		http.Error(w, "Failed to update profile", http.StatusInternalServerError)
+		return
+	}
+
 	// Update user status
 	if err := user_status.UpdateUserStatus(tx, strconv.Itoa(userID)); err != nil {
 		http.Error(w, "Failed to update user status", http.StatusInternalServerError)
@@ -360,9 +499,30 @@ func (h *Handler) UpdateProfileHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Reward whoever referred the user once the profile is complete
+	referrals.RewardReferral(h.db, userID)
+	if profileComplete(&existingProfile) {
+		track.Event(h.db, userID, track.ProfileCompleted, track.Properties{"role": existingProfile.Role})
+	}
+
+	// Queue an update of the stored matches involving this user when scoring inputs changed
+	if before != nil {
+		if _, err := matches.QueueUpdateIfChanged(h.db, before); err != nil {
+			log.Printf("Error queueing match update for user %d: %v", userID, err)
+			// Don't return error here as the profile was still updated successfully
+		}
+	}
+
 	json.NewEncoder(w).Encode(existingProfile)
 }
 
+// profileComplete reports whether a profile has what referrals count as
+// complete: a name, mission statement, sector and state
+func profileComplete(profile *ProfileResponse) bool {
+	return profile.OrganizationName != "" && profile.MissionStatement != "" &&
+		len(profile.Sectors) > 0 && profile.State != ""
+}
+
 // UpdateProfileHandler handles updating a user's profile information
 func UpdateProfileHandler(db *sql.DB) http.HandlerFunc {
 	h := NewHandler(db)
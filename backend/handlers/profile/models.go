@@ -1,5 +1,11 @@
 package profile
 
+import (
+	"database/sql"
+
+	"matcherator/backend/handlers/httputil"
+)
+
 // [AI_MODELS_START]
 // MODELS:
 // {
@@ -21,6 +27,7 @@ type ProfileResponse struct {
 	ID                int      `json:"id"`
 	OrganizationName  string   `json:"organization_name"`
 	ProfilePictureURL *string  `json:"profile_picture_url"`
+	ProfilePictureAlt *string  `json:"profile_picture_alt"`
 	MissionStatement  string   `json:"mission_statement"`
 	State             string   `json:"state"`
 	City              string   `json:"city"`
@@ -34,9 +41,21 @@ type ProfileResponse struct {
 	WebsiteURL        string   `json:"website_url"`
 	ContactEmail      string   `json:"contact_email"`
 	ChatOptIn         bool     `json:"chat_opt_in"`
+	PublicListing     bool     `json:"public_listing"`
+	AnnualBudget      *float64 `json:"annual_budget"`
+	StaffSize         *int     `json:"staff_size"`
+	FoundedYear       *int     `json:"founded_year"`
 	Location          string   `json:"location"`
 	Role              string   `json:"role"`
+	DualRole          bool     `json:"dual_role"`
 	Status            string   `json:"status"`
+
+	// Set when the viewer's language differs from the profile's and a translation is available
+	MissionStatementTranslated *string `json:"mission_statement_translated,omitempty"`
+	TranslatedTo               string  `json:"translated_to,omitempty"`
+
+	// Set when another signed-in user views the profile
+	Bookmarked *bool `json:"bookmarked,omitempty"`
 }
 
 // BioResponse represents the user's biographical data
@@ -45,3 +64,66 @@ type BioResponse struct {
 	Location   string `json:"location"`
 	WebsiteURL string `json:"website_url"`
 }
+
+// profileRow is SelectProfileQuery as scanned, before it becomes a
+// ProfileResponse. Profiles are created with only an organization name, so
+// every other profile column may be NULL; sectors and target groups arrive as
+// JSON arrays.
+type profileRow struct {
+	ID                int
+	OrganizationName  string
+	ProfilePictureURL sql.NullString
+	ProfilePictureAlt sql.NullString
+	MissionStatement  sql.NullString
+	State             sql.NullString
+	City              sql.NullString
+	ZipCode           sql.NullString
+	EIN               sql.NullString
+	Language          sql.NullString
+	ApplicantType     sql.NullString
+	SectorsJSON       string
+	TargetGroupsJSON  string
+	ProjectStage      sql.NullString
+	WebsiteURL        sql.NullString
+	ContactEmail      sql.NullString
+	ChatOptIn         sql.NullBool
+	PublicListing     bool
+	AnnualBudget      sql.NullFloat64
+	StaffSize         sql.NullInt64
+	FoundedYear       sql.NullInt64
+	Location          sql.NullString
+	Role              string
+	DualRole          bool
+	Status            string
+}
+
+// response maps the row to a ProfileResponse without its sectors and target
+// groups, which the caller parses from the JSON columns. Text columns the
+// response doesn't make nullable come out empty.
+func (row profileRow) response() ProfileResponse {
+	return ProfileResponse{
+		ID:                row.ID,
+		OrganizationName:  row.OrganizationName,
+		ProfilePictureURL: httputil.StringPtr(row.ProfilePictureURL),
+		ProfilePictureAlt: httputil.StringPtr(row.ProfilePictureAlt),
+		MissionStatement:  row.MissionStatement.String,
+		State:             row.State.String,
+		City:              row.City.String,
+		ZipCode:           row.ZipCode.String,
+		EIN:               row.EIN.String,
+		Language:          row.Language.String,
+		ApplicantType:     row.ApplicantType.String,
+		ProjectStage:      row.ProjectStage.String,
+		WebsiteURL:        row.WebsiteURL.String,
+		ContactEmail:      row.ContactEmail.String,
+		ChatOptIn:         row.ChatOptIn.Bool,
+		PublicListing:     row.PublicListing,
+		AnnualBudget:      httputil.Float64Ptr(row.AnnualBudget),
+		StaffSize:         httputil.IntPtr(row.StaffSize),
+		FoundedYear:       httputil.IntPtr(row.FoundedYear),
+		Location:          row.Location.String,
+		Role:              row.Role,
+		DualRole:          row.DualRole,
+		Status:            row.Status,
+	}
+}
@@ -0,0 +1,80 @@
+package profile
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestProfileRowNulls(t *testing.T) {
+	tests := []struct {
+		name string
+		row  profileRow
+		want map[string]interface{}
+	}{
+		{
+			name: "profile with only an organization name",
+			row:  profileRow{ID: 1, OrganizationName: "Org", Role: "recipient", Status: "active"},
+			want: map[string]interface{}{
+				"organization_name":   "Org",
+				"profile_picture_url": nil,
+				"profile_picture_alt": nil,
+				"mission_statement":   "",
+				"ein":                 "",
+				"contact_email":       "",
+				"chat_opt_in":         false,
+				"annual_budget":       nil,
+				"staff_size":          nil,
+				"founded_year":        nil,
+				"location":            "",
+			},
+		},
+		{
+			name: "filled in profile",
+			row: profileRow{
+				ID:                2,
+				OrganizationName:  "Fund",
+				ProfilePictureURL: sql.NullString{String: "/uploads/2.png", Valid: true},
+				MissionStatement:  sql.NullString{String: "Grants", Valid: true},
+				ChatOptIn:         sql.NullBool{Bool: true, Valid: true},
+				AnnualBudget:      sql.NullFloat64{Float64: 0, Valid: true},
+				FoundedYear:       sql.NullInt64{Int64: 1999, Valid: true},
+				Role:              "provider",
+				Status:            "active",
+			},
+			want: map[string]interface{}{
+				"profile_picture_url": "/uploads/2.png",
+				"profile_picture_alt": nil,
+				"mission_statement":   "Grants",
+				"chat_opt_in":         true,
+				"annual_budget":       float64(0),
+				"staff_size":          nil,
+				"founded_year":        float64(1999),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.row.response())
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			if strings.Contains(string(data), `"Valid"`) {
+				t.Errorf("JSON leaks a sql.Null value: %s", data)
+			}
+			var got map[string]interface{}
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			for key, want := range tt.want {
+				value, ok := got[key]
+				if !ok {
+					t.Errorf("%s missing from %s", key, data)
+				} else if value != want {
+					t.Errorf("%s = %#v, want %#v", key, value, want)
+				}
+			}
+		})
+	}
+}
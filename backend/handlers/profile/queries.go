@@ -17,6 +17,7 @@ const (
 			p.user_id,
 			p.organization_name,
 			p.profile_picture_url,
+			p.profile_picture_alt,
 			p.mission_statement,
 			p.state,
 			p.city,
@@ -30,8 +31,13 @@ const (
 			p.website_url,
 			p.contact_email,
 			p.chat_opt_in,
+			p.public_listing,
+			p.annual_budget,
+			p.staff_size,
+			p.founded_year,
 			p.location,
 			u.role,
+			u.dual_role,
 			u.status
 		FROM profiles p
 		JOIN users u ON u.id = p.user_id
@@ -40,8 +46,13 @@ const (
 
 	// SelectBioQuery retrieves a user's biographical information
 	SelectBioQuery = `
-		SELECT p.user_id, p.location, p.website_url
+		SELECT p.user_id, COALESCE(p.location, ''), COALESCE(p.website_url, '')
 		FROM profiles p
 		WHERE p.user_id = $1
 	`
+
+	// SelectBookmarkedQuery reports whether the viewer bookmarked a user
+	SelectBookmarkedQuery = `
+		SELECT EXISTS (SELECT 1 FROM bookmarks WHERE user_id = $1 AND bookmarked_id = $2)
+	`
 )
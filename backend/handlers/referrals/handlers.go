@@ -0,0 +1,95 @@
+package referrals
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"matcherator/backend/handlers/auth"
+	"matcherator/backend/handlers/notifications"
+	"matcherator/backend/services/referrals"
+)
+
+// NotificationRewarded is sent to the referrer when a referred organization
+// completes its profile
+const NotificationRewarded = "referral_rewarded"
+
+// GetReferralsHandler returns the user's referral code and signup link with
+// the organizations that signed up through it
+// Used by: /api/me/referrals
+// Response: ReferralsResponse
+func GetReferralsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		code, err := referrals.CodeFor(db, userID)
+		if err != nil {
+			log.Printf("Error loading referral code of user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		rows, err := db.Query(SelectReferralsQuery, userID)
+		if err != nil {
+			log.Printf("Error querying referrals of user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		response := ReferralsResponse{
+			Code:      code,
+			Link:      strings.TrimRight(os.Getenv("FRONTEND_URL"), "/") + "/signup?ref=" + url.QueryEscape(code),
+			Referrals: []Referral{},
+		}
+		for rows.Next() {
+			var referral Referral
+			if err := rows.Scan(&referral.OrganizationName, &referral.Role, &referral.SignedUpAt, &referral.CompletedAt, &referral.Reward); err != nil {
+				log.Printf("Error scanning referral: %v", err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+			if referral.CompletedAt != nil {
+				response.Completed++
+			}
+			response.Referrals = append(response.Referrals, referral)
+		}
+		if err := rows.Err(); err != nil {
+			log.Printf("Error iterating referrals: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// RewardReferral grants the referrer's rewards once the user, if referred,
+// has completed their profile, and tells the referrer. Call it after
+// profile updates.
+func RewardReferral(db *sql.DB, userID int) {
+	rewarded, err := referrals.RewardIfComplete(db, userID)
+	if err != nil {
+		log.Printf("Error rewarding referral of user %d: %v", userID, err)
+		return
+	}
+	if rewarded == nil {
+		return
+	}
+
+	content := "An organization you referred completed its profile."
+	if rewarded.Reward != "" {
+		content += " You received " + rewarded.Reward + "."
+	}
+	notifications.Notify(db, rewarded.ReferrerID, NotificationRewarded, content)
+}
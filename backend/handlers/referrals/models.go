@@ -0,0 +1,21 @@
+package referrals
+
+import "time"
+
+// Referral is an organization that signed up with the user's referral code
+type Referral struct {
+	OrganizationName string     `json:"organization_name"`
+	Role             string     `json:"role"`
+	SignedUpAt       time.Time  `json:"signed_up_at"`
+	CompletedAt      *time.Time `json:"completed_at"` // When it completed its profile
+	Reward           *string    `json:"reward"`       // What the user received for it
+}
+
+// ReferralsResponse is the user's referral code with the organizations it
+// brought in
+type ReferralsResponse struct {
+	Code      string     `json:"code"`
+	Link      string     `json:"link"`
+	Referrals []Referral `json:"referrals"`
+	Completed int        `json:"completed"`
+}
@@ -0,0 +1,14 @@
+package referrals
+
+const (
+	// SelectReferralsQuery lists the organizations the user referred, newest
+	// first
+	SelectReferralsQuery = `
+		SELECT COALESCE(p.organization_name, ''), u.role, r.created_at, r.completed_at, r.reward
+		FROM referrals r
+		JOIN users u ON u.id = r.referred_id
+		LEFT JOIN profiles p ON p.user_id = r.referred_id
+		WHERE r.referrer_id = $1
+		ORDER BY r.created_at DESC
+	`
+)
@@ -0,0 +1,285 @@
+package reports
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"matcherator/backend/handlers/auth"
+	"matcherator/backend/handlers/requirements"
+	"matcherator/backend/services/virusscan"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// MaxAttachmentSize caps a single report attachment
+	MaxAttachmentSize = 10 << 20 // 10 MB
+	// maxAttachments caps the files attached to one report
+	maxAttachments = 10
+	maxFileNameLen = 255
+)
+
+// attachmentDir holds report attachments, only ever served through
+// DownloadAttachmentHandler, which checks access
+var attachmentDir = filepath.Join("uploads", "impact_reports")
+
+// UploadAttachmentHandler lets the recipient attach a file to a report, sent
+// as the multipart field "file"
+// Used by: /api/connections/{id}/reports/{reportId}/attachments
+// Response: Attachment
+func UploadAttachmentHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		reportID, err := strconv.Atoi(mux.Vars(r)["reportId"])
+		if err != nil {
+			http.Error(w, "Invalid report ID", http.StatusBadRequest)
+			return
+		}
+
+		parties, ok := connectionParties(w, r, db, userID)
+		if !ok {
+			return
+		}
+		if userID != parties.recipientID {
+			http.Error(w, "Only the recipient can attach files", http.StatusForbidden)
+			return
+		}
+
+		if _, err := scanReport(db.QueryRow(SelectReportQuery, reportID, parties.connectionID), time.Now()); err == sql.ErrNoRows {
+			http.Error(w, "Report not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error loading report %d: %v", reportID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		if err := r.ParseMultipartForm(MaxAttachmentSize); err != nil {
+			http.Error(w, "File too large. Maximum size is 10MB", http.StatusBadRequest)
+			return
+		}
+
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "No file uploaded", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+
+		fileName := strings.TrimSpace(filepath.Base(header.Filename))
+		ext := strings.ToLower(filepath.Ext(fileName))
+		contentType, allowed := requirements.DocumentContentType(ext)
+		if !allowed {
+			http.Error(w, "Invalid file type. Upload a PDF, Word, Excel, CSV, text or image file", http.StatusBadRequest)
+			return
+		}
+		if header.Size > MaxAttachmentSize {
+			http.Error(w, "File too large. Maximum size is 10MB", http.StatusBadRequest)
+			return
+		}
+		if utf8.RuneCountInString(fileName) > maxFileNameLen {
+			fileName = string([]rune(fileName)[:maxFileNameLen-len(ext)]) + ext
+		}
+
+		// Store under a random name; the original is only kept for downloads
+		storedName, err := randomName()
+		if err != nil {
+			log.Printf("Error generating attachment name: %v", err)
+			http.Error(w, "Failed to save file", http.StatusInternalServerError)
+			return
+		}
+		uploadPath := filepath.Join(attachmentDir, strconv.Itoa(parties.connectionID), storedName+ext)
+
+		if err := os.MkdirAll(filepath.Dir(uploadPath), 0750); err != nil {
+			http.Error(w, "Failed to create upload directory", http.StatusInternalServerError)
+			return
+		}
+
+		dst, err := os.OpenFile(uploadPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0640)
+		if err != nil {
+			http.Error(w, "Failed to create file", http.StatusInternalServerError)
+			return
+		}
+		size, err := io.Copy(dst, file)
+		dst.Close()
+		if err != nil {
+			os.Remove(uploadPath)
+			http.Error(w, "Failed to save file", http.StatusInternalServerError)
+			return
+		}
+
+		verdict := virusscan.ScanFile(r.Context(), uploadPath)
+
+		attachment := Attachment{
+			FileName:    fileName,
+			ContentType: contentType,
+			SizeBytes:   size,
+			UploadedBy:  userID,
+			ScanStatus:  verdict.Status,
+		}
+		err = db.QueryRow(InsertAttachmentQuery, reportID, userID, fileName, contentType, size, uploadPath, maxAttachments, verdict.Status, verdict.Reason).Scan(
+			&attachment.ID, &attachment.UploadedAt,
+		)
+		if err != nil {
+			// Clean up the uploaded file if the database update fails
+			os.Remove(uploadPath)
+			if err == sql.ErrNoRows {
+				http.Error(w, fmt.Sprintf("A report can have at most %d attachments", maxAttachments), http.StatusConflict)
+				return
+			}
+			log.Printf("Error saving attachment for report %d: %v", reportID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(attachment)
+	}
+}
+
+// DownloadAttachmentHandler serves a report attachment to either side of the
+// connection
+// Used by: /api/connections/{id}/reports/{reportId}/attachments/{attachmentId}
+func DownloadAttachmentHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		reportID, attachmentID, ok := attachmentVars(w, r)
+		if !ok {
+			return
+		}
+
+		parties, ok := connectionParties(w, r, db, userID)
+		if !ok {
+			return
+		}
+
+		var attachment Attachment
+		var path string
+		err = db.QueryRow(SelectAttachmentQuery, attachmentID, reportID, parties.connectionID).Scan(
+			&attachment.ID, &attachment.FileName, &attachment.ContentType, &attachment.SizeBytes,
+			&attachment.UploadedBy, &attachment.UploadedAt, &attachment.ScanStatus, &path,
+		)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Attachment not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error loading attachment %d: %v", attachmentID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if attachment.ScanStatus == virusscan.StatusQuarantined {
+			http.Error(w, "Attachment is quarantined after failing its virus scan", http.StatusForbidden)
+			return
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			log.Printf("Error opening attachment %s: %v", path, err)
+			http.Error(w, "Attachment not found", http.StatusNotFound)
+			return
+		}
+		defer file.Close()
+
+		w.Header().Set("Content-Type", attachment.ContentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", attachment.FileName))
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Cache-Control", "private, no-store")
+		http.ServeContent(w, r, "", attachment.UploadedAt, file)
+	}
+}
+
+// DeleteAttachmentHandler lets the recipient remove a report attachment
+// Used by: /api/connections/{id}/reports/{reportId}/attachments/{attachmentId}
+// Response: 204 No Content
+func DeleteAttachmentHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		reportID, attachmentID, ok := attachmentVars(w, r)
+		if !ok {
+			return
+		}
+
+		parties, ok := connectionParties(w, r, db, userID)
+		if !ok {
+			return
+		}
+		if userID != parties.recipientID {
+			http.Error(w, "Only the recipient can remove attachments", http.StatusForbidden)
+			return
+		}
+
+		var path string
+		err = db.QueryRow(DeleteAttachmentQuery, attachmentID, reportID, parties.connectionID).Scan(&path)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Attachment not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error deleting attachment %d: %v", attachmentID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			// Don't return error here as the attachment was still removed successfully
+			log.Printf("Error deleting attachment %s: %v", path, err)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// attachmentVars parses the report and attachment IDs from the route
+func attachmentVars(w http.ResponseWriter, r *http.Request) (reportID, attachmentID int, ok bool) {
+	vars := mux.Vars(r)
+	reportID, err := strconv.Atoi(vars["reportId"])
+	if err != nil {
+		http.Error(w, "Invalid report ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	attachmentID, err = strconv.Atoi(vars["attachmentId"])
+	if err != nil {
+		http.Error(w, "Invalid attachment ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	return reportID, attachmentID, true
+}
+
+// randomName returns a random file name for a stored attachment
+func randomName() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
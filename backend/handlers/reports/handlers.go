@@ -0,0 +1,489 @@
+package reports
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"matcherator/backend/handlers/auth"
+	"matcherator/backend/handlers/httputil"
+	"matcherator/backend/handlers/notifications"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+const (
+	// maxPendingReports caps the reports awaiting submission on a connection
+	maxPendingReports  = 20
+	maxMetrics         = 20
+	maxTitleLen        = 200
+	maxInstructionsLen = 2000
+	maxMetricNameLen   = 100
+	maxNarrativeLen    = 10000
+)
+
+// Notification types sent about reports
+const (
+	NotificationRequested = "report_requested"
+	NotificationSubmitted = "report_submitted"
+	NotificationOverdue   = "report_overdue"
+)
+
+// GetReportsHandler lists a connection's progress reports for either side
+// Used by: /api/connections/{id}/reports
+// Response: ReportsResponse
+func GetReportsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		parties, ok := connectionParties(w, r, db, userID)
+		if !ok {
+			return
+		}
+
+		reports, err := loadReports(db, parties.connectionID)
+		if err != nil {
+			log.Printf("Error loading reports for connection %d: %v", parties.connectionID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		response := ReportsResponse{ConnectionID: parties.connectionID, Reports: reports}
+		for _, report := range reports {
+			if report.SubmittedAt == nil {
+				response.Pending++
+			}
+			if report.Overdue {
+				response.Overdue++
+			}
+		}
+
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// CreateReportHandler lets the provider of a funded connection request a
+// progress report from the recipient, who is notified
+// Used by: /api/connections/{id}/reports
+// Response: Report
+func CreateReportHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req ReportRequest
+		if !httputil.DecodeJSON(w, r, &req) {
+			return
+		}
+		if err := req.validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		parties, ok := connectionParties(w, r, db, userID)
+		if !ok {
+			return
+		}
+		if userID != parties.providerID {
+			http.Error(w, "Only the provider can request reports", http.StatusForbidden)
+			return
+		}
+		if !parties.funded {
+			http.Error(w, "Reports can only be requested on funded connections", http.StatusConflict)
+			return
+		}
+
+		var pending int
+		if err := db.QueryRow(CountPendingReportsQuery, parties.connectionID).Scan(&pending); err != nil {
+			log.Printf("Error counting reports for connection %d: %v", parties.connectionID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if pending >= maxPendingReports {
+			http.Error(w, fmt.Sprintf("A connection can have at most %d pending reports", maxPendingReports), http.StatusConflict)
+			return
+		}
+
+		report, err := scanReport(db.QueryRow(InsertReportQuery, parties.connectionID, userID, req.Title,
+			req.Instructions, pq.Array(req.Metrics), req.DueAt), time.Now())
+		if err != nil {
+			log.Printf("Error creating report for connection %d: %v", parties.connectionID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		notifications.Notify(db, parties.recipientID, NotificationRequested,
+			fmt.Sprintf("Progress report requested: \"%s\", due %s", report.Title, report.DueAt.UTC().Format("Jan 2, 2006")))
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+// SubmitReportHandler records the recipient's report, with a value for every
+// requested metric, and notifies the provider. Submitting again replaces it.
+// Used by: /api/connections/{id}/reports/{reportId}/submission
+// Response: Report
+func SubmitReportHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		reportID, err := strconv.Atoi(mux.Vars(r)["reportId"])
+		if err != nil {
+			http.Error(w, "Invalid report ID", http.StatusBadRequest)
+			return
+		}
+
+		var req SubmissionRequest
+		if !httputil.DecodeJSON(w, r, &req) {
+			return
+		}
+		req.Narrative = strings.TrimSpace(req.Narrative)
+		if req.Narrative == "" {
+			http.Error(w, "Narrative is required", http.StatusBadRequest)
+			return
+		}
+		if utf8.RuneCountInString(req.Narrative) > maxNarrativeLen {
+			http.Error(w, fmt.Sprintf("Narrative must be at most %d characters", maxNarrativeLen), http.StatusBadRequest)
+			return
+		}
+
+		parties, ok := connectionParties(w, r, db, userID)
+		if !ok {
+			return
+		}
+		if userID != parties.recipientID {
+			http.Error(w, "Only the recipient can submit reports", http.StatusForbidden)
+			return
+		}
+
+		now := time.Now()
+		report, err := scanReport(db.QueryRow(SelectReportQuery, reportID, parties.connectionID), now)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Report not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error loading report %d: %v", reportID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		if err := checkMetrics(report.Metrics, req.Metrics); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.Metrics == nil {
+			req.Metrics = map[string]float64{}
+		}
+		values, err := json.Marshal(req.Metrics)
+		if err != nil {
+			http.Error(w, "Invalid metrics", http.StatusBadRequest)
+			return
+		}
+
+		report, err = scanReport(db.QueryRow(SubmitReportQuery, reportID, parties.connectionID, req.Narrative, string(values), userID), now)
+		if err != nil {
+			log.Printf("Error submitting report %d: %v", reportID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		report.Attachments, err = loadAttachments(db, parties.connectionID, report.ID)
+		if err != nil {
+			log.Printf("Error loading attachments of report %d: %v", reportID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		notifications.Notify(db, parties.providerID, NotificationSubmitted, fmt.Sprintf("Progress report submitted: \"%s\"", report.Title))
+
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+// DeleteReportHandler lets the provider withdraw a report request, removing
+// any submission and attachments with it
+// Used by: /api/connections/{id}/reports/{reportId}
+// Response: 204 No Content
+func DeleteReportHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		reportID, err := strconv.Atoi(mux.Vars(r)["reportId"])
+		if err != nil {
+			http.Error(w, "Invalid report ID", http.StatusBadRequest)
+			return
+		}
+
+		parties, ok := connectionParties(w, r, db, userID)
+		if !ok {
+			return
+		}
+		if userID != parties.providerID {
+			http.Error(w, "Only the provider can remove reports", http.StatusForbidden)
+			return
+		}
+
+		paths, err := attachmentPaths(db, reportID)
+		if err != nil {
+			log.Printf("Error loading attachments of report %d: %v", reportID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		result, err := db.Exec(DeleteReportQuery, reportID, parties.connectionID)
+		if err != nil {
+			log.Printf("Error deleting report %d: %v", reportID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			http.Error(w, "Report not found", http.StatusNotFound)
+			return
+		}
+
+		for _, path := range paths {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				// Don't return error here as the report was still removed successfully
+				log.Printf("Error deleting report attachment %s: %v", path, err)
+			}
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// validate normalizes a report request and checks its fields
+func (req *ReportRequest) validate() error {
+	req.Title = strings.Join(strings.Fields(req.Title), " ")
+	req.Instructions = strings.TrimSpace(req.Instructions)
+	if req.Title == "" {
+		return fmt.Errorf("Title is required")
+	}
+	if utf8.RuneCountInString(req.Title) > maxTitleLen {
+		return fmt.Errorf("Title must be at most %d characters", maxTitleLen)
+	}
+	if utf8.RuneCountInString(req.Instructions) > maxInstructionsLen {
+		return fmt.Errorf("Instructions must be at most %d characters", maxInstructionsLen)
+	}
+	if req.DueAt.IsZero() {
+		return fmt.Errorf("Due date is required")
+	}
+	if !req.DueAt.After(time.Now()) {
+		return fmt.Errorf("Due date must be in the future")
+	}
+
+	metrics := []string{}
+	seen := map[string]bool{}
+	for _, metric := range req.Metrics {
+		metric = strings.Join(strings.Fields(metric), " ")
+		if metric == "" || seen[strings.ToLower(metric)] {
+			continue
+		}
+		if utf8.RuneCountInString(metric) > maxMetricNameLen {
+			return fmt.Errorf("Metric names must be at most %d characters", maxMetricNameLen)
+		}
+		seen[strings.ToLower(metric)] = true
+		metrics = append(metrics, metric)
+	}
+	if len(metrics) > maxMetrics {
+		return fmt.Errorf("A report can ask for at most %d metrics", maxMetrics)
+	}
+	req.Metrics = metrics
+	return nil
+}
+
+// checkMetrics requires a finite value for every requested metric, and none
+// for metrics that were not requested
+func checkMetrics(requested []string, values map[string]float64) error {
+	known := map[string]bool{}
+	for _, metric := range requested {
+		if _, ok := values[metric]; !ok {
+			return fmt.Errorf("Missing value for metric %q", metric)
+		}
+		known[metric] = true
+	}
+	for name, value := range values {
+		if !known[name] {
+			return fmt.Errorf("Unknown metric %q", name)
+		}
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return fmt.Errorf("Invalid value for metric %q", name)
+		}
+	}
+	return nil
+}
+
+// parties are the two sides of a connection
+type parties struct {
+	connectionID int
+	providerID   int
+	recipientID  int
+	funded       bool
+}
+
+// connectionParties loads the sides of a connection the user is part of,
+// writing the error response when there is no such connection
+func connectionParties(w http.ResponseWriter, r *http.Request, db *sql.DB, userID int) (parties, bool) {
+	p := parties{}
+	connectionID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid connection ID", http.StatusBadRequest)
+		return p, false
+	}
+	p.connectionID = connectionID
+
+	var fundedAt *time.Time
+	err = db.QueryRow(SelectConnectionQuery, connectionID, userID).Scan(&p.providerID, &p.recipientID, &fundedAt)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Connection not found", http.StatusNotFound)
+		return p, false
+	} else if err != nil {
+		log.Printf("Error loading connection %d: %v", connectionID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return p, false
+	}
+	p.funded = fundedAt != nil
+	return p, true
+}
+
+// loadReports lists a connection's reports with their attachments
+func loadReports(db *sql.DB, connectionID int) ([]Report, error) {
+	rows, err := db.Query(SelectReportsQuery, connectionID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying reports: %v", err)
+	}
+	defer rows.Close()
+
+	reports := []Report{}
+	now := time.Now()
+	for rows.Next() {
+		report, err := scanReport(rows, now)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning report: %v", err)
+		}
+		reports = append(reports, *report)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating reports: %v", err)
+	}
+	rows.Close()
+
+	attachments, err := connectionAttachments(db, connectionID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range reports {
+		if list, ok := attachments[reports[i].ID]; ok {
+			reports[i].Attachments = list
+		}
+	}
+	return reports, nil
+}
+
+// loadAttachments lists the attachments of one report
+func loadAttachments(db *sql.DB, connectionID, reportID int) ([]Attachment, error) {
+	attachments, err := connectionAttachments(db, connectionID)
+	if err != nil {
+		return nil, err
+	}
+	if list, ok := attachments[reportID]; ok {
+		return list, nil
+	}
+	return []Attachment{}, nil
+}
+
+// connectionAttachments lists the attachments of a connection's reports by report
+func connectionAttachments(db *sql.DB, connectionID int) (map[int][]Attachment, error) {
+	rows, err := db.Query(SelectAttachmentsQuery, connectionID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying report attachments: %v", err)
+	}
+	defer rows.Close()
+
+	attachments := map[int][]Attachment{}
+	for rows.Next() {
+		var reportID int
+		var a Attachment
+		if err := rows.Scan(&reportID, &a.ID, &a.FileName, &a.ContentType, &a.SizeBytes, &a.UploadedBy, &a.UploadedAt, &a.ScanStatus); err != nil {
+			return nil, fmt.Errorf("error scanning report attachment: %v", err)
+		}
+		attachments[reportID] = append(attachments[reportID], a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating report attachments: %v", err)
+	}
+	return attachments, nil
+}
+
+// attachmentPaths lists the stored files of a report
+func attachmentPaths(db *sql.DB, reportID int) ([]string, error) {
+	rows, err := db.Query(SelectAttachmentPathsQuery, reportID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var paths []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, rows.Err()
+}
+
+// scanReport reads a row selected with reportColumns
+func scanReport(row interface{ Scan(...interface{}) error }, now time.Time) (*Report, error) {
+	var report Report
+	var values []byte
+	err := row.Scan(&report.ID, &report.ConnectionID, &report.RequestedBy, &report.Title, &report.Instructions,
+		pq.Array(&report.Metrics), &report.DueAt, &report.Narrative, &values, &report.SubmittedAt, &report.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if report.Metrics == nil {
+		report.Metrics = []string{}
+	}
+	if values != nil {
+		if err := json.Unmarshal(values, &report.MetricValues); err != nil {
+			return nil, fmt.Errorf("error decoding metric values: %v", err)
+		}
+	}
+	report.Attachments = []Attachment{}
+	report.Overdue = report.SubmittedAt == nil && report.DueAt.Before(now)
+	return &report, nil
+}
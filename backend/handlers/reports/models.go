@@ -0,0 +1,57 @@
+package reports
+
+import "time"
+
+// Report is a progress report the provider of a funded connection requested
+// from the recipient, with the recipient's submission once made
+type Report struct {
+	ID           int                `json:"id"`
+	ConnectionID int                `json:"connection_id"`
+	RequestedBy  int                `json:"requested_by"`
+	Title        string             `json:"title"`
+	Instructions string             `json:"instructions"`
+	Metrics      []string           `json:"metrics"` // Metric names the recipient must report
+	DueAt        time.Time          `json:"due_at"`
+	Narrative    *string            `json:"narrative"`
+	MetricValues map[string]float64 `json:"metric_values"`
+	SubmittedAt  *time.Time         `json:"submitted_at"`
+	Overdue      bool               `json:"overdue"`
+	Attachments  []Attachment       `json:"attachments"`
+	CreatedAt    time.Time          `json:"created_at"`
+}
+
+// Attachment is a file the recipient attached to a report
+type Attachment struct {
+	ID          int       `json:"id"`
+	FileName    string    `json:"file_name"`
+	ContentType string    `json:"content_type"`
+	SizeBytes   int64     `json:"size_bytes"`
+	UploadedBy  int       `json:"uploaded_by"`
+	UploadedAt  time.Time `json:"uploaded_at"`
+	// ScanStatus is "quarantined" while a file that failed its virus scan
+	// awaits admin review, and can't be downloaded
+	ScanStatus string `json:"scan_status"`
+}
+
+// ReportRequest asks the recipient for a report
+type ReportRequest struct {
+	Title        string    `json:"title"`
+	Instructions string    `json:"instructions"`
+	Metrics      []string  `json:"metrics"`
+	DueAt        time.Time `json:"due_at"`
+}
+
+// SubmissionRequest is the recipient's report: a narrative and a value for
+// every requested metric
+type SubmissionRequest struct {
+	Narrative string             `json:"narrative"`
+	Metrics   map[string]float64 `json:"metrics"`
+}
+
+// ReportsResponse lists a connection's reports
+type ReportsResponse struct {
+	ConnectionID int      `json:"connection_id"`
+	Reports      []Report `json:"reports"`
+	Pending      int      `json:"pending"`
+	Overdue      int      `json:"overdue"`
+}
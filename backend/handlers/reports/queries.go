@@ -0,0 +1,123 @@
+package reports
+
+import "matcherator/backend/services/matches"
+
+// reportColumns are the columns read by scanReport
+const reportColumns = `id, connection_id, requested_by, title, COALESCE(instructions, ''), metrics,
+		due_at, narrative, metric_values, submitted_at, created_at`
+
+const (
+	// SelectConnectionQuery returns the provider and recipient of a connection
+	// the user is part of, and when it was marked funded
+	SelectConnectionQuery = `
+		SELECT pu.id, ru.id, c.funded_at
+		FROM connections c` + matches.ConnectionPartiesSQL + `
+		WHERE c.id = $1 AND $2 IN (c.initiator_id, c.target_id)
+	`
+
+	// SelectReportsQuery lists a connection's reports, pending ones first by
+	// due date
+	SelectReportsQuery = `
+		SELECT ` + reportColumns + `
+		FROM impact_reports
+		WHERE connection_id = $1
+		ORDER BY submitted_at IS NOT NULL, due_at, id
+	`
+
+	// SelectReportQuery returns one report of a connection
+	SelectReportQuery = `
+		SELECT ` + reportColumns + `
+		FROM impact_reports
+		WHERE id = $1 AND connection_id = $2
+	`
+
+	// CountPendingReportsQuery counts a connection's reports not yet submitted
+	CountPendingReportsQuery = `
+		SELECT COUNT(*) FROM impact_reports
+		WHERE connection_id = $1 AND submitted_at IS NULL
+	`
+
+	// InsertReportQuery requests a report
+	InsertReportQuery = `
+		INSERT INTO impact_reports (connection_id, requested_by, title, instructions, metrics, due_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6)
+		RETURNING ` + reportColumns + `
+	`
+
+	// SubmitReportQuery records, or replaces, the recipient's report
+	SubmitReportQuery = `
+		UPDATE impact_reports
+		SET narrative = $3, metric_values = $4, submitted_by = $5,
+			submitted_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND connection_id = $2
+		RETURNING ` + reportColumns + `
+	`
+
+	// DeleteReportQuery removes a report, with its attachments
+	DeleteReportQuery = `
+		DELETE FROM impact_reports WHERE id = $1 AND connection_id = $2
+	`
+
+	// SelectAttachmentsQuery lists the attachments of a connection's reports
+	SelectAttachmentsQuery = `
+		SELECT a.report_id, a.id, a.file_name, a.content_type, a.size_bytes, a.uploaded_by, a.uploaded_at, a.scan_status
+		FROM impact_report_attachments a
+		JOIN impact_reports r ON r.id = a.report_id
+		WHERE r.connection_id = $1
+		ORDER BY a.uploaded_at, a.id
+	`
+
+	// SelectAttachmentPathsQuery lists the stored files of a report
+	SelectAttachmentPathsQuery = `
+		SELECT file_path FROM impact_report_attachments WHERE report_id = $1
+	`
+
+	// InsertAttachmentQuery attaches a file to a report unless it already has
+	// $7 attachments
+	InsertAttachmentQuery = `
+		INSERT INTO impact_report_attachments (report_id, uploaded_by, file_name, content_type, size_bytes, file_path, scan_status, scan_verdict)
+		SELECT $1, $2, $3, $4, $5, $6, $8, $9
+		FROM impact_report_attachments
+		WHERE report_id = $1
+		HAVING COUNT(*) < $7
+		RETURNING id, uploaded_at
+	`
+
+	// SelectAttachmentQuery returns an attachment of a connection's report
+	// with its stored path
+	SelectAttachmentQuery = `
+		SELECT a.id, a.file_name, a.content_type, a.size_bytes, a.uploaded_by, a.uploaded_at, a.scan_status, a.file_path
+		FROM impact_report_attachments a
+		JOIN impact_reports r ON r.id = a.report_id
+		WHERE a.id = $1 AND a.report_id = $2 AND r.connection_id = $3
+	`
+
+	// DeleteAttachmentQuery removes an attachment of a connection's report and
+	// returns its stored path
+	DeleteAttachmentQuery = `
+		DELETE FROM impact_report_attachments a
+		USING impact_reports r
+		WHERE a.id = $1 AND a.report_id = $2 AND r.id = a.report_id AND r.connection_id = $3
+		RETURNING a.file_path
+	`
+
+	// ClaimOverdueRemindersQuery marks overdue reports as reminded, at most
+	// once every $1 seconds each, and returns the recipients to remind.
+	// Claiming in one statement keeps several backend instances from
+	// reminding twice.
+	ClaimOverdueRemindersQuery = `
+		WITH overdue AS (
+			UPDATE impact_reports
+			SET reminded_at = CURRENT_TIMESTAMP
+			WHERE submitted_at IS NULL
+				AND due_at <= CURRENT_TIMESTAMP
+				AND (reminded_at IS NULL OR reminded_at <= CURRENT_TIMESTAMP - $1 * INTERVAL '1 second')
+			RETURNING id, connection_id, title, due_at
+		)
+		SELECT o.id, o.title, o.due_at, COALESCE(pp.organization_name, ''), ru.id, ru.email
+		FROM overdue o
+		JOIN connections c ON c.id = o.connection_id` + matches.ConnectionPartiesSQL + `
+		LEFT JOIN profiles pp ON pp.user_id = pu.id
+		WHERE ru.deactivated_at IS NULL
+	`
+)
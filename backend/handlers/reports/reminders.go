@@ -0,0 +1,66 @@
+package reports
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"matcherator/backend/handlers/notifications"
+)
+
+const (
+	// DefaultReminderInterval is how often overdue reports are checked for
+	DefaultReminderInterval = time.Hour
+	// DefaultReminderRepeat is how long to wait before reminding again about
+	// a report that is still overdue
+	DefaultReminderRepeat = 7 * 24 * time.Hour
+)
+
+// StartReminders reminds recipients of reports past their due date, again
+// every REPORT_REMINDER_REPEAT (Go duration, default 168h) until they are
+// submitted, checking every REPORT_REMINDER_INTERVAL (default 1h) until ctx
+// is done.
+func StartReminders(ctx context.Context, db *sql.DB) {
+	repeat := notifications.DurationFromEnv("REPORT_REMINDER_REPEAT", DefaultReminderRepeat)
+	notifications.Reminders{
+		Name:     "report",
+		Interval: notifications.DurationFromEnv("REPORT_REMINDER_INTERVAL", DefaultReminderInterval),
+		Claim: func(db *sql.DB) (*sql.Rows, error) {
+			return db.Query(ClaimOverdueRemindersQuery, int64(repeat/time.Second))
+		},
+		Message: reminderMessage,
+	}.Start(ctx, db)
+}
+
+// reminderMessage tells the recipient of a claimed report that it is overdue
+func reminderMessage(rows *sql.Rows) (notifications.Reminder, error) {
+	var reportID, userID int
+	var title, providerName, email string
+	var dueAt time.Time
+	if err := rows.Scan(&reportID, &title, &dueAt, &providerName, &userID, &email); err != nil {
+		return notifications.Reminder{}, err
+	}
+
+	funder := providerName
+	if funder == "" {
+		funder = "your funder"
+	}
+	due := dueAt.UTC().Format("Mon Jan 2, 2006")
+	link := strings.TrimRight(os.Getenv("FRONTEND_URL"), "/") + "/chats"
+	return notifications.Reminder{
+		UserID:  userID,
+		Email:   email,
+		Type:    NotificationOverdue,
+		Content: fmt.Sprintf("Overdue: progress report \"%s\" for %s was due %s", title, funder, due),
+		Subject: "Overdue report: " + title,
+		Body: fmt.Sprintf(`The progress report "%s" requested by %s was due %s and has not been submitted yet.
+
+You can submit it here:
+%s
+`, title, funder, due, link),
+		About: fmt.Sprintf("report %d", reportID),
+	}, nil
+}
@@ -0,0 +1,670 @@
+package requirements
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"matcherator/backend/handlers/auth"
+	"matcherator/backend/handlers/httputil"
+	"matcherator/backend/handlers/notifications"
+	"matcherator/backend/services/virusscan"
+
+	"github.com/gorilla/mux"
+)
+
+// NotificationUploaded tells a provider a document was uploaded against one of
+// their requirements
+const NotificationUploaded = "requirement_uploaded"
+
+const (
+	// MaxDocumentSize caps a single uploaded document
+	MaxDocumentSize = 10 << 20 // 10 MB
+	// maxRequirements caps the checklist of a single grant
+	maxRequirements   = 30
+	maxNameLen        = 200
+	maxDescriptionLen = 1000
+	maxFileNameLen    = 255
+)
+
+// documentDir holds uploaded documents. Unlike profile pictures these are
+// only ever served through DownloadDocumentHandler, which checks access.
+var documentDir = filepath.Join("uploads", "requirement_documents")
+
+// allowedExtensions maps the document types recipients may upload to the
+// content type they are served with
+var allowedExtensions = map[string]string{
+	".pdf":  "application/pdf",
+	".doc":  "application/msword",
+	".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".xls":  "application/vnd.ms-excel",
+	".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	".csv":  "text/csv",
+	".txt":  "text/plain",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+}
+
+// DocumentContentType returns the content type a document with extension ext
+// is served with, and whether documents of that type may be uploaded at all
+func DocumentContentType(ext string) (string, bool) {
+	contentType, ok := allowedExtensions[strings.ToLower(ext)]
+	return contentType, ok
+}
+
+// GetRequirementsHandler returns a grant's checklist of required documents
+// Used by: /api/grants/{id}/requirements
+// Response: RequirementsResponse
+func GetRequirementsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if _, err := auth.GetUserIDFromToken(r); err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		grantID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid grant ID", http.StatusBadRequest)
+			return
+		}
+
+		var providerID int
+		err = db.QueryRow(SelectGrantProviderQuery, grantID).Scan(&providerID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Grant not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error loading grant %d: %v", grantID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		requirements, err := loadRequirements(db, grantID)
+		if err != nil {
+			log.Printf("Error loading requirements for grant %d: %v", grantID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(RequirementsResponse{GrantID: grantID, Requirements: requirements})
+	}
+}
+
+// CreateRequirementHandler adds a required document to one of the provider's grants
+// Used by: /api/grants/{id}/requirements
+// Response: Requirement
+func CreateRequirementHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		grantID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid grant ID", http.StatusBadRequest)
+			return
+		}
+
+		var req RequirementRequest
+		if !httputil.DecodeJSON(w, r, &req) {
+			return
+		}
+
+		req.Name = strings.TrimSpace(req.Name)
+		req.Description = strings.TrimSpace(req.Description)
+		if req.Name == "" {
+			http.Error(w, "Name is required", http.StatusBadRequest)
+			return
+		}
+		if utf8.RuneCountInString(req.Name) > maxNameLen {
+			http.Error(w, fmt.Sprintf("Name must be at most %d characters", maxNameLen), http.StatusBadRequest)
+			return
+		}
+		if utf8.RuneCountInString(req.Description) > maxDescriptionLen {
+			http.Error(w, fmt.Sprintf("Description must be at most %d characters", maxDescriptionLen), http.StatusBadRequest)
+			return
+		}
+
+		if !ownsGrant(w, db, grantID, userID) {
+			return
+		}
+
+		var requirement Requirement
+		err = db.QueryRow(InsertRequirementQuery, grantID, req.Name, req.Description, maxRequirements).Scan(
+			&requirement.ID, &requirement.GrantID, &requirement.Name, &requirement.Description,
+			&requirement.Position, &requirement.CreatedAt,
+		)
+		if err == sql.ErrNoRows {
+			http.Error(w, fmt.Sprintf("A grant can have at most %d requirements", maxRequirements), http.StatusConflict)
+			return
+		} else if err != nil {
+			log.Printf("Error creating requirement for grant %d: %v", grantID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(requirement)
+	}
+}
+
+// DeleteRequirementHandler removes a requirement, and every document uploaded
+// against it, from one of the provider's grants
+// Used by: /api/grants/{id}/requirements/{requirementId}
+// Response: 204 No Content
+func DeleteRequirementHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		vars := mux.Vars(r)
+		grantID, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			http.Error(w, "Invalid grant ID", http.StatusBadRequest)
+			return
+		}
+		requirementID, err := strconv.Atoi(vars["requirementId"])
+		if err != nil {
+			http.Error(w, "Invalid requirement ID", http.StatusBadRequest)
+			return
+		}
+
+		if !ownsGrant(w, db, grantID, userID) {
+			return
+		}
+
+		paths, err := requirementFiles(db, requirementID)
+		if err != nil {
+			log.Printf("Error listing documents for requirement %d: %v", requirementID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		result, err := db.Exec(DeleteRequirementQuery, requirementID, grantID, userID)
+		if err != nil {
+			log.Printf("Error deleting requirement %d: %v", requirementID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			http.Error(w, "Requirement not found", http.StatusNotFound)
+			return
+		}
+
+		for _, path := range paths {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				// Don't return error here as the requirement was still deleted successfully
+				log.Printf("Error deleting document %s: %v", path, err)
+			}
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// GetConnectionChecklistsHandler returns the provider's grant checklists with
+// what the recipient has uploaded so far. Both sides of the connection see
+// the same completion status. Pass ?grant_id= to limit it to one grant.
+// Used by: /api/connections/{id}/requirements
+// Response: ChecklistsResponse
+func GetConnectionChecklistsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		connectionID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid connection ID", http.StatusBadRequest)
+			return
+		}
+
+		grantID := 0
+		if raw := r.URL.Query().Get("grant_id"); raw != "" {
+			grantID, err = strconv.Atoi(raw)
+			if err != nil || grantID <= 0 {
+				http.Error(w, "Invalid grant ID", http.StatusBadRequest)
+				return
+			}
+		}
+
+		providerID, recipientID, ok := connectionParties(w, db, connectionID, userID)
+		if !ok {
+			return
+		}
+
+		checklists, err := loadChecklists(db, providerID, connectionID, grantID)
+		if err != nil {
+			log.Printf("Error loading checklists for connection %d: %v", connectionID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(ChecklistsResponse{
+			ConnectionID: connectionID,
+			ProviderID:   providerID,
+			RecipientID:  recipientID,
+			Checklists:   checklists,
+		})
+	}
+}
+
+// UploadDocumentHandler lets the recipient of a connection upload a document
+// against one of the provider's requirements, replacing any earlier upload
+// Used by: /api/connections/{id}/requirements/{requirementId}/document
+// Response: Document
+func UploadDocumentHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		connectionID, requirementID, ok := documentVars(w, r)
+		if !ok {
+			return
+		}
+
+		providerID, recipientID, ok := connectionParties(w, db, connectionID, userID)
+		if !ok {
+			return
+		}
+		if userID != recipientID {
+			http.Error(w, "Only the recipient can upload documents", http.StatusForbidden)
+			return
+		}
+
+		var requirementName, grantTitle string
+		err = db.QueryRow(SelectProviderRequirementQuery, requirementID, providerID).Scan(&requirementName, &grantTitle)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Requirement not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error loading requirement %d: %v", requirementID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		if err := r.ParseMultipartForm(MaxDocumentSize); err != nil {
+			http.Error(w, "File too large. Maximum size is 10MB", http.StatusBadRequest)
+			return
+		}
+
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "No file uploaded", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+
+		fileName := strings.TrimSpace(filepath.Base(header.Filename))
+		ext := strings.ToLower(filepath.Ext(fileName))
+		contentType, allowed := allowedExtensions[ext]
+		if !allowed {
+			http.Error(w, "Invalid file type. Upload a PDF, Word, Excel, CSV, text or image file", http.StatusBadRequest)
+			return
+		}
+		if header.Size > MaxDocumentSize {
+			http.Error(w, "File too large. Maximum size is 10MB", http.StatusBadRequest)
+			return
+		}
+		if utf8.RuneCountInString(fileName) > maxFileNameLen {
+			fileName = string([]rune(fileName)[:maxFileNameLen-len(ext)]) + ext
+		}
+
+		// Store under a random name; the original is only kept for downloads
+		storedName, err := randomName()
+		if err != nil {
+			log.Printf("Error generating document name: %v", err)
+			http.Error(w, "Failed to save file", http.StatusInternalServerError)
+			return
+		}
+		uploadPath := filepath.Join(documentDir, strconv.Itoa(connectionID), storedName+ext)
+
+		if err := os.MkdirAll(filepath.Dir(uploadPath), 0750); err != nil {
+			http.Error(w, "Failed to create upload directory", http.StatusInternalServerError)
+			return
+		}
+
+		dst, err := os.OpenFile(uploadPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0640)
+		if err != nil {
+			http.Error(w, "Failed to create file", http.StatusInternalServerError)
+			return
+		}
+		size, err := io.Copy(dst, file)
+		dst.Close()
+		if err != nil {
+			os.Remove(uploadPath)
+			http.Error(w, "Failed to save file", http.StatusInternalServerError)
+			return
+		}
+
+		verdict := virusscan.ScanFile(r.Context(), uploadPath)
+
+		var previousPath string
+		err = db.QueryRow(SelectDocumentPathQuery, requirementID, connectionID).Scan(&previousPath)
+		if err != nil && err != sql.ErrNoRows {
+			os.Remove(uploadPath)
+			log.Printf("Error loading previous document for requirement %d: %v", requirementID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		document := Document{
+			FileName:    fileName,
+			ContentType: contentType,
+			SizeBytes:   size,
+			UploadedBy:  userID,
+			ScanStatus:  verdict.Status,
+		}
+		err = db.QueryRow(UpsertDocumentQuery, requirementID, connectionID, userID, fileName, contentType, size, uploadPath, verdict.Status, verdict.Reason).Scan(
+			&document.ID, &document.UploadedAt,
+		)
+		if err != nil {
+			// Clean up the uploaded file if the database update fails
+			os.Remove(uploadPath)
+			log.Printf("Error saving document for requirement %d: %v", requirementID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		if previousPath != "" && previousPath != uploadPath {
+			if err := os.Remove(previousPath); err != nil && !os.IsNotExist(err) {
+				log.Printf("Error deleting replaced document %s: %v", previousPath, err)
+			}
+		}
+
+		// A quarantined document is announced once an admin releases it
+		if verdict.Status == virusscan.StatusClean {
+			content := fmt.Sprintf("A document was uploaded for \"%s\" on %s", requirementName, grantTitle)
+			notifications.Notify(db, providerID, NotificationUploaded, content)
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(document)
+	}
+}
+
+// DownloadDocumentHandler serves a document uploaded within a connection to
+// either side of it
+// Used by: /api/connections/{id}/requirements/{requirementId}/document
+// Response: the file, as an attachment
+func DownloadDocumentHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		connectionID, requirementID, ok := documentVars(w, r)
+		if !ok {
+			return
+		}
+
+		if _, _, ok := connectionParties(w, db, connectionID, userID); !ok {
+			return
+		}
+
+		var document Document
+		var path string
+		err = db.QueryRow(SelectDocumentQuery, requirementID, connectionID).Scan(
+			&document.ID, &document.FileName, &document.ContentType, &document.SizeBytes,
+			&document.UploadedBy, &document.UploadedAt, &document.ScanStatus, &path,
+		)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Document not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error loading document for requirement %d: %v", requirementID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if document.ScanStatus == virusscan.StatusQuarantined {
+			http.Error(w, "Document is quarantined after failing its virus scan", http.StatusForbidden)
+			return
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			log.Printf("Error opening document %s: %v", path, err)
+			http.Error(w, "Document not found", http.StatusNotFound)
+			return
+		}
+		defer file.Close()
+
+		w.Header().Set("Content-Type", document.ContentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", document.FileName))
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Cache-Control", "private, no-store")
+		http.ServeContent(w, r, "", document.UploadedAt, file)
+	}
+}
+
+// DeleteDocumentHandler lets the recipient of a connection remove an upload
+// Used by: /api/connections/{id}/requirements/{requirementId}/document
+// Response: 204 No Content
+func DeleteDocumentHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		connectionID, requirementID, ok := documentVars(w, r)
+		if !ok {
+			return
+		}
+
+		_, recipientID, ok := connectionParties(w, db, connectionID, userID)
+		if !ok {
+			return
+		}
+		if userID != recipientID {
+			http.Error(w, "Only the recipient can remove documents", http.StatusForbidden)
+			return
+		}
+
+		var path string
+		err = db.QueryRow(DeleteDocumentQuery, requirementID, connectionID).Scan(&path)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Document not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error deleting document for requirement %d: %v", requirementID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			// Don't return error here as the document was still removed successfully
+			log.Printf("Error deleting document %s: %v", path, err)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// ownsGrant checks that the grant exists and belongs to the user, writing the
+// error response when it doesn't
+func ownsGrant(w http.ResponseWriter, db *sql.DB, grantID, userID int) bool {
+	var providerID int
+	err := db.QueryRow(SelectGrantProviderQuery, grantID).Scan(&providerID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Grant not found", http.StatusNotFound)
+		return false
+	} else if err != nil {
+		log.Printf("Error loading grant %d: %v", grantID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return false
+	}
+	if providerID != userID {
+		http.Error(w, "Only the grant's provider can change its requirements", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// connectionParties resolves the provider and recipient of a connection the
+// user is part of, writing the error response when there is none
+func connectionParties(w http.ResponseWriter, db *sql.DB, connectionID, userID int) (providerID, recipientID int, ok bool) {
+	err := db.QueryRow(SelectConnectionPartiesQuery, connectionID, userID).Scan(&providerID, &recipientID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Connection not found", http.StatusNotFound)
+		return 0, 0, false
+	} else if err != nil {
+		log.Printf("Error loading connection %d: %v", connectionID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return 0, 0, false
+	}
+	return providerID, recipientID, true
+}
+
+// documentVars parses the connection and requirement IDs from the route
+func documentVars(w http.ResponseWriter, r *http.Request) (connectionID, requirementID int, ok bool) {
+	vars := mux.Vars(r)
+	connectionID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid connection ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	requirementID, err = strconv.Atoi(vars["requirementId"])
+	if err != nil {
+		http.Error(w, "Invalid requirement ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	return connectionID, requirementID, true
+}
+
+// loadRequirements lists a grant's checklist
+func loadRequirements(db *sql.DB, grantID int) ([]Requirement, error) {
+	rows, err := db.Query(SelectRequirementsQuery, grantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requirements := []Requirement{}
+	for rows.Next() {
+		var req Requirement
+		if err := rows.Scan(&req.ID, &req.GrantID, &req.Name, &req.Description, &req.Position, &req.CreatedAt); err != nil {
+			return nil, err
+		}
+		requirements = append(requirements, req)
+	}
+	return requirements, rows.Err()
+}
+
+// loadChecklists groups the provider's requirements by grant with the
+// documents uploaded within the connection
+func loadChecklists(db *sql.DB, providerID, connectionID, grantID int) ([]Checklist, error) {
+	rows, err := db.Query(SelectChecklistsQuery, providerID, connectionID, grantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	checklists := []Checklist{}
+	for rows.Next() {
+		var (
+			title       string
+			item        ChecklistItem
+			documentID  sql.NullInt64
+			fileName    sql.NullString
+			contentType sql.NullString
+			sizeBytes   sql.NullInt64
+			uploadedBy  sql.NullInt64
+			uploadedAt  sql.NullTime
+			scanStatus  sql.NullString
+		)
+		if err := rows.Scan(
+			&item.GrantID, &title, &item.ID, &item.Name, &item.Description, &item.Position, &item.CreatedAt,
+			&documentID, &fileName, &contentType, &sizeBytes, &uploadedBy, &uploadedAt, &scanStatus,
+		); err != nil {
+			return nil, err
+		}
+
+		if documentID.Valid {
+			item.Document = &Document{
+				ID:          int(documentID.Int64),
+				FileName:    fileName.String,
+				ContentType: contentType.String,
+				SizeBytes:   sizeBytes.Int64,
+				UploadedBy:  int(uploadedBy.Int64),
+				UploadedAt:  uploadedAt.Time,
+				ScanStatus:  scanStatus.String,
+			}
+		}
+
+		if n := len(checklists); n == 0 || checklists[n-1].GrantID != item.GrantID {
+			checklists = append(checklists, Checklist{GrantID: item.GrantID, GrantTitle: title, Items: []ChecklistItem{}})
+		}
+		checklist := &checklists[len(checklists)-1]
+		checklist.Items = append(checklist.Items, item)
+		checklist.Total++
+		if item.Document != nil && item.Document.ScanStatus != virusscan.StatusQuarantined {
+			checklist.Completed++
+		}
+	}
+	return checklists, rows.Err()
+}
+
+// requirementFiles lists the stored files uploaded against a requirement
+func requirementFiles(db *sql.DB, requirementID int) ([]string, error) {
+	rows, err := db.Query(SelectRequirementFilesQuery, requirementID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var paths []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, rows.Err()
+}
+
+// randomName returns a hard-to-guess name for a stored document
+func randomName() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
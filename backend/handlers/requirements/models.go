@@ -0,0 +1,61 @@
+package requirements
+
+import "time"
+
+// Requirement is a document a provider asks applicants to supply for a grant
+type Requirement struct {
+	ID          int       `json:"id"`
+	GrantID     int       `json:"grant_id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Position    int       `json:"position"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// RequirementRequest adds a requirement to a grant's checklist
+type RequirementRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// RequirementsResponse lists a grant's checklist
+type RequirementsResponse struct {
+	GrantID      int           `json:"grant_id"`
+	Requirements []Requirement `json:"requirements"`
+}
+
+// Document is a file a recipient uploaded against a requirement
+type Document struct {
+	ID          int       `json:"id"`
+	FileName    string    `json:"file_name"`
+	ContentType string    `json:"content_type"`
+	SizeBytes   int64     `json:"size_bytes"`
+	UploadedBy  int       `json:"uploaded_by"`
+	UploadedAt  time.Time `json:"uploaded_at"`
+	// ScanStatus is "quarantined" while a file that failed its virus scan
+	// awaits admin review, and can't be downloaded
+	ScanStatus string `json:"scan_status"`
+}
+
+// ChecklistItem is a requirement and, once uploaded, its document
+type ChecklistItem struct {
+	Requirement
+	Document *Document `json:"document"`
+}
+
+// Checklist is one grant's requirements as completed within a connection
+type Checklist struct {
+	GrantID    int             `json:"grant_id"`
+	GrantTitle string          `json:"grant_title"`
+	Items      []ChecklistItem `json:"items"`
+	Completed  int             `json:"completed"`
+	Total      int             `json:"total"`
+}
+
+// ChecklistsResponse lists the provider's checklists for a connection
+type ChecklistsResponse struct {
+	ConnectionID int         `json:"connection_id"`
+	ProviderID   int         `json:"provider_id"`
+	RecipientID  int         `json:"recipient_id"`
+	Checklists   []Checklist `json:"checklists"`
+}
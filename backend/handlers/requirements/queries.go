@@ -0,0 +1,111 @@
+package requirements
+
+import "matcherator/backend/services/matches"
+
+const (
+	// SelectGrantProviderQuery returns the provider who owns a grant
+	SelectGrantProviderQuery = `
+		SELECT provider_id FROM grants WHERE id = $1
+	`
+
+	// SelectRequirementsQuery lists a grant's checklist in order
+	SelectRequirementsQuery = `
+		SELECT id, grant_id, name, COALESCE(description, ''), position, created_at
+		FROM grant_requirements
+		WHERE grant_id = $1
+		ORDER BY position, id
+	`
+
+	// InsertRequirementQuery appends a requirement to a grant's checklist,
+	// refusing once the checklist is full
+	InsertRequirementQuery = `
+		INSERT INTO grant_requirements (grant_id, name, description, position)
+		SELECT $1, $2, NULLIF($3, ''), COALESCE(MAX(position), 0) + 1
+		FROM grant_requirements
+		WHERE grant_id = $1
+		HAVING COUNT(*) < $4
+		RETURNING id, grant_id, name, COALESCE(description, ''), position, created_at
+	`
+
+	// SelectRequirementFilesQuery lists the stored files uploaded against a requirement
+	SelectRequirementFilesQuery = `
+		SELECT file_path FROM requirement_documents WHERE requirement_id = $1
+	`
+
+	// DeleteRequirementQuery removes a requirement from a grant the user owns
+	DeleteRequirementQuery = `
+		DELETE FROM grant_requirements gr
+		USING grants g
+		WHERE gr.id = $1 AND gr.grant_id = $2 AND g.id = gr.grant_id AND g.provider_id = $3
+	`
+
+	// SelectConnectionPartiesQuery returns the provider and recipient of a
+	// connection the user is part of
+	SelectConnectionPartiesQuery = `
+		SELECT pu.id, ru.id
+		FROM connections c` + matches.ConnectionPartiesSQL + `
+		WHERE c.id = $1 AND $2 IN (c.initiator_id, c.target_id)
+	`
+
+	// SelectChecklistsQuery lists the provider's grant requirements with any
+	// document uploaded for them within the connection, optionally for one grant
+	SelectChecklistsQuery = `
+		SELECT g.id, g.title, gr.id, gr.name, COALESCE(gr.description, ''), gr.position, gr.created_at,
+			d.id, d.file_name, d.content_type, d.size_bytes, d.uploaded_by, d.uploaded_at, d.scan_status
+		FROM grants g
+		JOIN grant_requirements gr ON gr.grant_id = g.id
+		LEFT JOIN requirement_documents d ON d.requirement_id = gr.id AND d.connection_id = $2
+		WHERE g.provider_id = $1 AND ($3::int = 0 OR g.id = $3::int)
+		ORDER BY g.deadline NULLS LAST, g.id, gr.position, gr.id
+	`
+
+	// SelectProviderRequirementQuery returns a requirement's name and grant
+	// title when it belongs to one of the provider's grants
+	SelectProviderRequirementQuery = `
+		SELECT gr.name, g.title
+		FROM grant_requirements gr
+		JOIN grants g ON g.id = gr.grant_id
+		WHERE gr.id = $1 AND g.provider_id = $2
+	`
+
+	// SelectDocumentQuery returns the document uploaded against a requirement
+	// within a connection
+	SelectDocumentQuery = `
+		SELECT id, file_name, content_type, size_bytes, uploaded_by, uploaded_at, scan_status, file_path
+		FROM requirement_documents
+		WHERE requirement_id = $1 AND connection_id = $2
+	`
+
+	// SelectDocumentPathQuery returns where the document uploaded against a
+	// requirement within a connection is stored
+	SelectDocumentPathQuery = `
+		SELECT file_path
+		FROM requirement_documents
+		WHERE requirement_id = $1 AND connection_id = $2
+	`
+
+	// UpsertDocumentQuery records an upload, replacing any earlier document for
+	// the same requirement and connection
+	UpsertDocumentQuery = `
+		INSERT INTO requirement_documents (requirement_id, connection_id, uploaded_by, file_name, content_type, size_bytes, file_path, scan_status, scan_verdict)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (requirement_id, connection_id) DO UPDATE SET
+			uploaded_by = EXCLUDED.uploaded_by,
+			file_name = EXCLUDED.file_name,
+			content_type = EXCLUDED.content_type,
+			size_bytes = EXCLUDED.size_bytes,
+			file_path = EXCLUDED.file_path,
+			scan_status = EXCLUDED.scan_status,
+			scan_verdict = EXCLUDED.scan_verdict,
+			uploaded_at = CURRENT_TIMESTAMP
+		RETURNING id, uploaded_at
+	`
+
+	// DeleteDocumentQuery removes the document uploaded against a requirement
+	// within a connection
+	DeleteDocumentQuery = `
+		DELETE FROM requirement_documents
+		WHERE requirement_id = $1 AND connection_id = $2
+		RETURNING file_path
+	`
+)
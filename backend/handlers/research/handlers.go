@@ -0,0 +1,218 @@
+package research
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"matcherator/backend/handlers/admin"
+)
+
+// MinCellSize is the smallest count the research API reports. Smaller counts
+// could single out organizations, so they are null, and sectors or terms with
+// fewer organizations are left out.
+const MinCellSize = 5
+
+// SectorsHandler reports recipient demand and provider supply per census
+// region and sector, with the needs and funding types listed, to find where
+// funding falls short. A sector is under-served where it has recipients but
+// no provider, or more than ratio recipients per provider.
+// Used by: /api/research/sectors?ratio=
+// Response: SectorReport
+func SectorsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if !requireScope(w, r, ScopeSectors) {
+			return
+		}
+
+		ratio := admin.DefaultGapRatio
+		if value := r.URL.Query().Get("ratio"); value != "" {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil || parsed <= 0 {
+				http.Error(w, "ratio must be a positive number", http.StatusBadRequest)
+				return
+			}
+			ratio = parsed
+		}
+
+		gaps, err := admin.LoadSectorGaps(db, ratio)
+		if err != nil {
+			log.Printf("Error loading sector gaps for research: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		report := SectorReport{GeneratedAt: gaps.GeneratedAt, MinCellSize: MinCellSize, Ratio: gaps.Ratio, Regions: []RegionSectors{}}
+		for _, region := range gaps.Regions {
+			sectors := RegionSectors{
+				Region:       region.Region,
+				Sectors:      []SectorSupply{},
+				Needs:        reportableTerms(region.Needs),
+				FundingTypes: reportableTerms(region.FundingTypes),
+			}
+			for _, supply := range region.Sectors {
+				if supply.Recipients+supply.Providers+supply.NationwideProviders < MinCellSize {
+					sectors.Suppressed++
+					continue
+				}
+				s := SectorSupply{
+					Sector:              supply.Sector,
+					Recipients:          cell(supply.Recipients),
+					Providers:           cell(supply.Providers),
+					NationwideProviders: cell(supply.NationwideProviders),
+					UnderServed:         supply.UnderServed,
+				}
+				if s.Recipients != nil && s.Providers != nil && s.NationwideProviders != nil {
+					s.RecipientsPerProvider = supply.RecipientsPerProvider
+				}
+				sectors.Sectors = append(sectors.Sectors, s)
+			}
+			report.Regions = append(report.Regions, sectors)
+		}
+
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+// GeoHandler reports active organizations, matches and connections per state
+// and census region
+// Used by: /api/research/geo
+// Response: GeoReport
+func GeoHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if !requireScope(w, r, ScopeGeo) {
+			return
+		}
+
+		stats, err := admin.LoadGeoStats(db)
+		if err != nil {
+			log.Printf("Error loading geo stats for research: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		report := GeoReport{
+			GeneratedAt:         stats.GeneratedAt,
+			MinCellSize:         MinCellSize,
+			NationwideProviders: cell(stats.NationwideProviders),
+			States:              []StateCounts{},
+			Regions:             []RegionCounts{},
+		}
+		for _, state := range stats.States {
+			report.States = append(report.States, StateCounts{
+				State:       state.State,
+				Region:      state.Region,
+				GeoCounts:   geoCells(state.GeoCounts),
+				CoverageGap: state.CoverageGap,
+			})
+		}
+		for _, region := range stats.Regions {
+			report.Regions = append(report.Regions, RegionCounts{
+				Region:       region.Region,
+				GeoCounts:    geoCells(region.GeoCounts),
+				CoverageGaps: region.CoverageGaps,
+			})
+		}
+
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+// MatchesHandler reports per recipient sector how many recipients are matched,
+// their average match score, and how many connections and fundings followed
+// Used by: /api/research/matches
+// Response: MatchReport
+func MatchesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if !requireScope(w, r, ScopeMatches) {
+			return
+		}
+
+		rows, err := db.Query(SelectSectorMatchesQuery)
+		if err != nil {
+			log.Printf("Error querying sector matches for research: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		report := MatchReport{GeneratedAt: time.Now().UTC(), MinCellSize: MinCellSize, Sectors: []SectorMatches{}}
+		for rows.Next() {
+			var sector string
+			var recipients, matched, matches, connections, funded int
+			var score sql.NullFloat64
+			if err := rows.Scan(&sector, &recipients, &matched, &matches, &score, &connections, &funded); err != nil {
+				log.Printf("Error scanning sector matches: %v", err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+			if recipients < MinCellSize {
+				report.Suppressed++
+				continue
+			}
+
+			s := SectorMatches{
+				Sector:            sector,
+				Recipients:        recipients,
+				RecipientsMatched: cell(matched),
+				Matches:           cell(matches),
+				Connections:       cell(connections),
+				Funded:            cell(funded),
+			}
+			// An average over a handful of recipients says too much about each
+			if score.Valid && matched >= MinCellSize {
+				s.AverageScore = &score.Float64
+			}
+			report.Sectors = append(report.Sectors, s)
+		}
+		if err := rows.Err(); err != nil {
+			log.Printf("Error iterating sector matches: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+// cell reports a count, or null when it is small enough to single out
+// organizations. Zero is always reported.
+func cell(n int) *int {
+	if n > 0 && n < MinCellSize {
+		return nil
+	}
+	return &n
+}
+
+// geoCells reports the geo counts that are large enough
+func geoCells(counts admin.GeoCounts) GeoCounts {
+	return GeoCounts{
+		Providers:         cell(counts.Providers),
+		ProvidersServing:  cell(counts.ProvidersServing),
+		Recipients:        cell(counts.Recipients),
+		RecipientsMatched: cell(counts.RecipientsMatched),
+		Matches:           cell(counts.Matches),
+		Connections:       cell(counts.Connections),
+	}
+}
+
+// reportableTerms leaves out terms too few organizations listed, as free-text
+// terms could name them
+func reportableTerms(counts []admin.TermCount) []TermCount {
+	terms := []TermCount{}
+	for _, term := range counts {
+		if term.Count >= MinCellSize {
+			terms = append(terms, TermCount{Name: term.Name, Count: term.Count})
+		}
+	}
+	return terms
+}
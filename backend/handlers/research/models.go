@@ -0,0 +1,118 @@
+package research
+
+import "time"
+
+// Token is a research API token as admins see it; the secret itself is only
+// returned when it is created
+type Token struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedBy  *int       `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+// CreateTokenRequest issues a token to a research partner. Without expires_at
+// the token is valid until revoked.
+type CreateTokenRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// CreateTokenResponse returns a newly issued token, shown only once
+type CreateTokenResponse struct {
+	Token
+	Secret string `json:"token"`
+}
+
+// SectorSupply compares recipient demand with provider supply for a sector.
+// Counts too small to report are null.
+type SectorSupply struct {
+	Sector                string   `json:"sector"`
+	Recipients            *int     `json:"recipients"`
+	Providers             *int     `json:"providers"`
+	NationwideProviders   *int     `json:"nationwide_providers"`
+	RecipientsPerProvider *float64 `json:"recipients_per_provider"`
+	UnderServed           bool     `json:"under_served"`
+}
+
+// TermCount is how many active organizations listed a need or funding type
+type TermCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// RegionSectors is the sector supply and demand of one census region
+type RegionSectors struct {
+	Region       string         `json:"region"`
+	Sectors      []SectorSupply `json:"sectors"`
+	Suppressed   int            `json:"suppressed"` // Sectors left out for having too few organizations
+	Needs        []TermCount    `json:"needs"`
+	FundingTypes []TermCount    `json:"funding_types"`
+}
+
+// SectorReport is the funding gap analysis by region and sector
+type SectorReport struct {
+	GeneratedAt time.Time       `json:"generated_at"`
+	MinCellSize int             `json:"min_cell_size"`
+	Ratio       float64         `json:"ratio"`
+	Regions     []RegionSectors `json:"regions"`
+}
+
+// GeoCounts are the active organizations and activity of a state or region.
+// Counts too small to report are null.
+type GeoCounts struct {
+	Providers         *int `json:"providers"`
+	ProvidersServing  *int `json:"providers_serving"`
+	Recipients        *int `json:"recipients"`
+	RecipientsMatched *int `json:"recipients_matched"`
+	Matches           *int `json:"matches"`
+	Connections       *int `json:"connections"`
+}
+
+// StateCounts are the counts of one state
+type StateCounts struct {
+	State  string `json:"state"`
+	Region string `json:"region"`
+	GeoCounts
+	CoverageGap bool `json:"coverage_gap"`
+}
+
+// RegionCounts are the counts of one census region
+type RegionCounts struct {
+	Region string `json:"region"`
+	GeoCounts
+	CoverageGaps int `json:"coverage_gaps"`
+}
+
+// GeoReport is the platform's coverage by state and region
+type GeoReport struct {
+	GeneratedAt         time.Time      `json:"generated_at"`
+	MinCellSize         int            `json:"min_cell_size"`
+	NationwideProviders *int           `json:"nationwide_providers"`
+	States              []StateCounts  `json:"states"`
+	Regions             []RegionCounts `json:"regions"`
+}
+
+// SectorMatches are the matches and connections of recipients in a sector
+type SectorMatches struct {
+	Sector            string   `json:"sector"`
+	Recipients        int      `json:"recipients"`
+	RecipientsMatched *int     `json:"recipients_matched"`
+	Matches           *int     `json:"matches"`
+	AverageScore      *float64 `json:"average_score"`
+	Connections       *int     `json:"connections"`
+	Funded            *int     `json:"funded"`
+}
+
+// MatchReport is how matching and funding play out per recipient sector
+type MatchReport struct {
+	GeneratedAt time.Time       `json:"generated_at"`
+	MinCellSize int             `json:"min_cell_size"`
+	Sectors     []SectorMatches `json:"sectors"`
+	Suppressed  int             `json:"suppressed"` // Sectors left out for having too few recipients
+}
@@ -0,0 +1,81 @@
+package research
+
+const (
+	// SelectTokenByHashQuery authenticates a research token that is neither
+	// revoked nor expired, recording that it was used
+	SelectTokenByHashQuery = `
+		UPDATE research_tokens
+		SET last_used_at = CURRENT_TIMESTAMP
+		WHERE token_hash = $1
+			AND revoked_at IS NULL
+			AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)
+		RETURNING id, scopes
+	`
+
+	// SelectTokensQuery lists research tokens, newest first
+	SelectTokensQuery = `
+		SELECT id, name, scopes, created_by, created_at, expires_at, revoked_at, last_used_at
+		FROM research_tokens
+		ORDER BY created_at DESC, id DESC
+	`
+
+	// InsertTokenQuery stores a new research token
+	InsertTokenQuery = `
+		INSERT INTO research_tokens (name, token_hash, scopes, created_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, name, scopes, created_by, created_at, expires_at, revoked_at, last_used_at
+	`
+
+	// RevokeTokenQuery revokes a research token; revoking twice keeps the
+	// first revocation time
+	RevokeTokenQuery = `
+		UPDATE research_tokens
+		SET revoked_at = COALESCE(revoked_at, CURRENT_TIMESTAMP)
+		WHERE id = $1
+	`
+
+	// SelectSectorMatchesQuery counts, per sector of active recipients, the
+	// recipients, their matches with active providers and their connections
+	SelectSectorMatchesQuery = `
+		WITH active AS (
+			SELECT u.id, u.role, u.dual_role
+			FROM users u
+			WHERE u.role IN ('provider', 'recipient')
+				AND u.deactivated_at IS NULL AND u.deleted_at IS NULL
+		),
+		recipients AS (
+			SELECT a.id, TRIM(s.sector) AS sector
+			FROM active a
+			JOIN profiles p ON p.user_id = a.id
+			CROSS JOIN LATERAL unnest(p.sectors) AS s(sector)
+			WHERE (a.role = 'recipient' OR a.dual_role) AND TRIM(s.sector) <> ''
+			GROUP BY 1, 2
+		),
+		matched AS (
+			SELECT r.sector, COUNT(DISTINCT m.user_id) AS recipients, COUNT(*) AS matches, AVG(m.match_score) AS score
+			FROM recipients r
+			JOIN matches m ON m.user_id = r.id
+			JOIN active a ON a.id = m.user_id
+			JOIN active provider ON provider.id = m.match_id
+			WHERE COALESCE(m.as_role, a.role) = 'recipient'
+			GROUP BY r.sector
+		),
+		connected AS (
+			SELECT r.sector, COUNT(*) AS connections, COUNT(*) FILTER (WHERE c.funded_at IS NOT NULL) AS funded
+			FROM recipients r
+			JOIN connections c ON r.id IN (c.initiator_id, c.target_id)
+			JOIN active provider ON provider.id IN (c.initiator_id, c.target_id)
+				AND provider.id <> r.id
+				AND (provider.role = 'provider' OR provider.dual_role)
+			GROUP BY r.sector
+		)
+		SELECT r.sector, COUNT(*),
+			COALESCE(MAX(m.recipients), 0), COALESCE(MAX(m.matches), 0), MAX(m.score),
+			COALESCE(MAX(c.connections), 0), COALESCE(MAX(c.funded), 0)
+		FROM recipients r
+		LEFT JOIN matched m ON m.sector = r.sector
+		LEFT JOIN connected c ON c.sector = r.sector
+		GROUP BY r.sector
+		ORDER BY COUNT(*) DESC, r.sector
+	`
+)
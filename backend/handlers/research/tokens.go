@@ -0,0 +1,242 @@
+package research
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"matcherator/backend/handlers/auth"
+	"matcherator/backend/handlers/httputil"
+	"matcherator/backend/services/tokens"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// Scopes a research token can be granted, one per endpoint
+const (
+	ScopeSectors = "sectors"
+	ScopeGeo     = "geo"
+	ScopeMatches = "matches"
+)
+
+// knownScopes lists every scope in the order they are reported
+var knownScopes = []string{ScopeSectors, ScopeGeo, ScopeMatches}
+
+const maxTokenNameLen = 200
+
+// tokenScopesKey is the context key of the scopes granted to the token
+// authenticated by TokenMiddleware
+type tokenScopesKey struct{}
+
+// TokenMiddleware authenticates research partners by their bearer token. The
+// research API only reads aggregates, so anything but GET is refused.
+func TokenMiddleware(db *sql.DB) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				http.Error(w, "The research API is read-only", http.StatusMethodNotAllowed)
+				return
+			}
+
+			token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if token == "" {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			var tokenID int
+			var scopes []string
+			err := db.QueryRow(SelectTokenByHashQuery, tokens.Hash(token)).Scan(&tokenID, pq.Array(&scopes))
+			if err == sql.ErrNoRows {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			} else if err != nil {
+				log.Printf("Error authenticating research token: %v", err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), tokenScopesKey{}, scopes)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// requireScope writes a 403 and returns false unless the request's token was
+// granted scope
+func requireScope(w http.ResponseWriter, r *http.Request, scope string) bool {
+	scopes, _ := r.Context().Value(tokenScopesKey{}).([]string)
+	for _, granted := range scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	http.Error(w, fmt.Sprintf("This token does not have the %s scope", scope), http.StatusForbidden)
+	return false
+}
+
+// ListTokensHandler lists the research tokens issued, newest first
+// Used by: /api/admin/research-tokens
+// Response: []Token
+func ListTokensHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		rows, err := db.Query(SelectTokensQuery)
+		if err != nil {
+			log.Printf("Error querying research tokens: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		tokens := []Token{}
+		for rows.Next() {
+			token, err := scanToken(rows)
+			if err != nil {
+				log.Printf("Error scanning research token: %v", err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+			tokens = append(tokens, token)
+		}
+		if err := rows.Err(); err != nil {
+			log.Printf("Error iterating research tokens: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(tokens)
+	}
+}
+
+// CreateTokenHandler issues a read-only research token with the given scopes
+// Used by: /api/admin/research-tokens
+// Response: CreateTokenResponse
+func CreateTokenHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		adminID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req CreateTokenRequest
+		if !httputil.DecodeJSON(w, r, &req) {
+			return
+		}
+
+		req.Name = strings.Join(strings.Fields(req.Name), " ")
+		if req.Name == "" {
+			http.Error(w, "Name is required", http.StatusBadRequest)
+			return
+		}
+		if utf8.RuneCountInString(req.Name) > maxTokenNameLen {
+			http.Error(w, fmt.Sprintf("Name must be at most %d characters", maxTokenNameLen), http.StatusBadRequest)
+			return
+		}
+
+		// Store the scopes deduplicated and in a stable order
+		requested := map[string]bool{}
+		for _, scope := range req.Scopes {
+			requested[scope] = true
+		}
+		scopes := []string{}
+		for _, scope := range knownScopes {
+			if requested[scope] {
+				scopes = append(scopes, scope)
+				delete(requested, scope)
+			}
+		}
+		if len(scopes) == 0 || len(requested) > 0 {
+			http.Error(w, "scopes must list one or more of "+strings.Join(knownScopes, ", "), http.StatusBadRequest)
+			return
+		}
+		if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+			http.Error(w, "expires_at must be in the future", http.StatusBadRequest)
+			return
+		}
+
+		secret, err := tokens.NewSecret()
+		if err != nil {
+			log.Printf("Error generating research token: %v", err)
+			http.Error(w, "Error generating token", http.StatusInternalServerError)
+			return
+		}
+		response := CreateTokenResponse{Secret: secret}
+
+		response.Token, err = scanToken(db.QueryRow(InsertTokenQuery, req.Name, tokens.Hash(response.Secret), pq.Array(scopes), adminID, req.ExpiresAt))
+		if err != nil {
+			log.Printf("Error storing research token: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// RevokeTokenHandler revokes a research token; it stops working immediately
+// Used by: /api/admin/research-tokens/{id}
+// Response: 204 No Content
+func RevokeTokenHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		tokenID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid token ID", http.StatusBadRequest)
+			return
+		}
+
+		result, err := db.Exec(RevokeTokenQuery, tokenID)
+		if err != nil {
+			log.Printf("Error revoking research token %d: %v", tokenID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			http.Error(w, "Token not found", http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// scanToken reads a row of the research_tokens columns admins see
+func scanToken(row interface{ Scan(...interface{}) error }) (Token, error) {
+	var token Token
+	var createdBy sql.NullInt64
+	var expiresAt, revokedAt, lastUsedAt sql.NullTime
+	err := row.Scan(&token.ID, &token.Name, pq.Array(&token.Scopes), &createdBy, &token.CreatedAt,
+		&expiresAt, &revokedAt, &lastUsedAt)
+	if err != nil {
+		return token, err
+	}
+	if createdBy.Valid {
+		id := int(createdBy.Int64)
+		token.CreatedBy = &id
+	}
+	if expiresAt.Valid {
+		token.ExpiresAt = &expiresAt.Time
+	}
+	if revokedAt.Valid {
+		token.RevokedAt = &revokedAt.Time
+	}
+	if lastUsedAt.Valid {
+		token.LastUsedAt = &lastUsedAt.Time
+	}
+	return token, nil
+}
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"matcherator/backend/handlers/bookmarks"
+	"matcherator/backend/handlers/claims"
+	"matcherator/backend/handlers/connection"
+	"matcherator/backend/handlers/dashboard"
+	"matcherator/backend/handlers/directory"
+	"matcherator/backend/handlers/events"
+	"matcherator/backend/handlers/faq"
+	"matcherator/backend/handlers/meta"
+	"matcherator/backend/handlers/notifications"
+	"matcherator/backend/handlers/onboarding"
+	"matcherator/backend/handlers/profile"
+	"matcherator/backend/handlers/referrals"
+	"matcherator/backend/handlers/reports"
+	"matcherator/backend/handlers/requirements"
+	"matcherator/backend/handlers/research"
+	"matcherator/backend/handlers/search"
+	"matcherator/backend/handlers/sso"
+	"matcherator/backend/handlers/stories"
+	"matcherator/backend/handlers/tasks"
+	"matcherator/backend/handlers/templates"
+	"matcherator/backend/handlers/user"
+	"matcherator/backend/handlers/widget"
+	"matcherator/backend/services/schemacheck"
+)
+
+// SchemaStatements are the handler queries the startup schema check prepares
+var SchemaStatements = []schemacheck.Statement{
+	{Name: "bookmarks.SelectBookmarksQuery", Query: bookmarks.SelectBookmarksQuery},
+	{Name: "bookmarks.CountBookmarksQuery", Query: bookmarks.CountBookmarksQuery},
+	{Name: "bookmarks.SelectBookmarkQuery", Query: bookmarks.SelectBookmarkQuery},
+	{Name: "bookmarks.SelectBookmarkableQuery", Query: bookmarks.SelectBookmarkableQuery},
+	{Name: "bookmarks.InsertBookmarkQuery", Query: bookmarks.InsertBookmarkQuery},
+	{Name: "bookmarks.DeleteBookmarkQuery", Query: bookmarks.DeleteBookmarkQuery},
+	{Name: "claims.SelectClaimableQuery", Query: claims.SelectClaimableQuery},
+	{Name: "claims.CountClaimsFromIPQuery", Query: claims.CountClaimsFromIPQuery},
+	{Name: "claims.EmailTakenQuery", Query: claims.EmailTakenQuery},
+	{Name: "claims.InsertClaimQuery", Query: claims.InsertClaimQuery},
+	{Name: "claims.SelectClaimByTokenQuery", Query: claims.SelectClaimByTokenQuery},
+	{Name: "claims.VerifyClaimQuery", Query: claims.VerifyClaimQuery},
+	{Name: "claims.AttachDocumentQuery", Query: claims.AttachDocumentQuery},
+	{Name: "claims.SelectClaimsQuery", Query: claims.SelectClaimsQuery},
+	{Name: "claims.SelectClaimQuery", Query: claims.SelectClaimQuery},
+	{Name: "claims.SelectClaimDocumentQuery", Query: claims.SelectClaimDocumentQuery},
+	{Name: "claims.LockClaimForReviewQuery", Query: claims.LockClaimForReviewQuery},
+	{Name: "claims.LockClaimableQuery", Query: claims.LockClaimableQuery},
+	{Name: "claims.TransferAccountQuery", Query: claims.TransferAccountQuery},
+	{Name: "claims.ReviewClaimQuery", Query: claims.ReviewClaimQuery},
+	{Name: "claims.RejectOtherClaimsQuery", Query: claims.RejectOtherClaimsQuery},
+	{Name: "connection.GetConnectionsQuery", Query: connection.GetConnectionsQuery},
+	{Name: "connection.CountConnectionsQuery", Query: connection.CountConnectionsQuery},
+	{Name: "connection.CreateConnectionQuery", Query: connection.CreateConnectionQuery},
+	{Name: "connection.DeleteConnectionQuery", Query: connection.DeleteConnectionQuery},
+	{Name: "connection.DeleteConnectionWithUserQuery", Query: connection.DeleteConnectionWithUserQuery},
+	{Name: "connection.SelectConnectionBetweenQuery", Query: connection.SelectConnectionBetweenQuery},
+	{Name: "connection.SelectConnectionFundingQuery", Query: connection.SelectConnectionFundingQuery},
+	{Name: "connection.MarkFundedQuery", Query: connection.MarkFundedQuery},
+	{Name: "connection.UnmarkFundedQuery", Query: connection.UnmarkFundedQuery},
+	{Name: "connection.CheckUserExistsQuery", Query: connection.CheckUserExistsQuery},
+	{Name: "connection.SelectAwardRangeQuery", Query: connection.SelectAwardRangeQuery},
+	{Name: "connection.UpdateAwardRangeQuery", Query: connection.UpdateAwardRangeQuery},
+	{Name: "connection.SelectEligibilityQuery", Query: connection.SelectEligibilityQuery},
+	{Name: "connection.UpdateEligibilityQuery", Query: connection.UpdateEligibilityQuery},
+	{Name: "connection.DeleteStoredMatchQuery", Query: connection.DeleteStoredMatchQuery},
+	{Name: "connection.InsertDismissalQuery", Query: connection.InsertDismissalQuery},
+	{Name: "connection.SelectDismissedMatchesQuery", Query: connection.SelectDismissedMatchesQuery},
+	{Name: "connection.CountDismissedMatchesQuery", Query: connection.CountDismissedMatchesQuery},
+	{Name: "connection.DeleteDismissalQuery", Query: connection.DeleteDismissalQuery},
+	{Name: "connection.SelectDismissalReasonsQuery", Query: connection.SelectDismissalReasonsQuery},
+	{Name: "connection.SelectDismissalBreakdownQuery", Query: connection.SelectDismissalBreakdownQuery},
+	{Name: "connection.ExportConnectionsQuery", Query: connection.ExportConnectionsQuery},
+	{Name: "dashboard.SelectFunnelQuery", Query: dashboard.SelectFunnelQuery},
+	{Name: "dashboard.SelectProviderGrantsQuery", Query: dashboard.SelectProviderGrantsQuery},
+	{Name: "dashboard.SelectUpcomingDeadlinesQuery", Query: dashboard.SelectUpcomingDeadlinesQuery},
+	{Name: "dashboard.SelectNeedsReplyQuery", Query: dashboard.SelectNeedsReplyQuery},
+	{Name: "dashboard.CountNewMatchesQuery", Query: dashboard.CountNewMatchesQuery},
+	{Name: "dashboard.SelectCompletenessQuery", Query: dashboard.SelectCompletenessQuery},
+	{Name: "directory.CountListedProvidersQuery", Query: directory.CountListedProvidersQuery},
+	{Name: "directory.SelectListedProvidersQuery", Query: directory.SelectListedProvidersQuery},
+	{Name: "directory.SelectListedProviderQuery", Query: directory.SelectListedProviderQuery},
+	{Name: "directory.SelectSitemapEntriesQuery", Query: directory.SelectSitemapEntriesQuery},
+	{Name: "directory.SelectBrowseProvidersQuery", Query: directory.SelectBrowseProvidersQuery},
+	{Name: "events.SelectUpcomingEventsQuery", Query: events.SelectUpcomingEventsQuery},
+	{Name: "events.SelectHostedEventsQuery", Query: events.SelectHostedEventsQuery},
+	{Name: "events.SelectVisibleEventQuery", Query: events.SelectVisibleEventQuery},
+	{Name: "events.SelectUserRoleQuery", Query: events.SelectUserRoleQuery},
+	{Name: "events.CountUpcomingHostedQuery", Query: events.CountUpcomingHostedQuery},
+	{Name: "events.InsertEventQuery", Query: events.InsertEventQuery},
+	{Name: "events.SelectEventQuery", Query: events.SelectEventQuery},
+	{Name: "events.SelectAudienceQuery", Query: events.SelectAudienceQuery},
+	{Name: "events.DeleteEventQuery", Query: events.DeleteEventQuery},
+	{Name: "events.InsertRSVPQuery", Query: events.InsertRSVPQuery},
+	{Name: "events.DeleteRSVPQuery", Query: events.DeleteRSVPQuery},
+	{Name: "events.SelectAttendeesQuery", Query: events.SelectAttendeesQuery},
+	{Name: "events.SelectEventHostQuery", Query: events.SelectEventHostQuery},
+	{Name: "events.ClaimDueRemindersQuery", Query: events.ClaimDueRemindersQuery},
+	{Name: "faq.SelectUserRoleQuery", Query: faq.SelectUserRoleQuery},
+	{Name: "faq.SelectFAQsQuery", Query: faq.SelectFAQsQuery},
+	{Name: "faq.InsertFAQQuery", Query: faq.InsertFAQQuery},
+	{Name: "faq.UpdateFAQQuery", Query: faq.UpdateFAQQuery},
+	{Name: "faq.DeleteFAQQuery", Query: faq.DeleteFAQQuery},
+	{Name: "faq.SelectPublicAnswersQuery", Query: faq.SelectPublicAnswersQuery},
+	{Name: "faq.CheckMatchedQuery", Query: faq.CheckMatchedQuery},
+	{Name: "faq.CountOpenQuestionsQuery", Query: faq.CountOpenQuestionsQuery},
+	{Name: "faq.InsertQuestionQuery", Query: faq.InsertQuestionQuery},
+	{Name: "faq.SelectQuestionQuery", Query: faq.SelectQuestionQuery},
+	{Name: "faq.SelectAskedQuestionsQuery", Query: faq.SelectAskedQuestionsQuery},
+	{Name: "faq.SelectMyQuestionsQuery", Query: faq.SelectMyQuestionsQuery},
+	{Name: "faq.AnswerQuestionQuery", Query: faq.AnswerQuestionQuery},
+	{Name: "meta.SelectTaxonomyQuery", Query: meta.SelectTaxonomyQuery},
+	{Name: "meta.InsertSuggestionQuery", Query: meta.InsertSuggestionQuery},
+	{Name: "meta.SelectSuggestionsQuery", Query: meta.SelectSuggestionsQuery},
+	{Name: "meta.RetagSectorsQuery", Query: meta.RetagSectorsQuery},
+	{Name: "meta.RetagTargetGroupsQuery", Query: meta.RetagTargetGroupsQuery},
+	{Name: "meta.UpsertSynonymQuery", Query: meta.UpsertSynonymQuery},
+	{Name: "notifications.InsertNotificationQuery", Query: notifications.InsertNotificationQuery},
+	{Name: "onboarding.SelectStepsQuery", Query: onboarding.SelectStepsQuery},
+	{Name: "onboarding.UpsertStepQuery", Query: onboarding.UpsertStepQuery},
+	{Name: "onboarding.SelectFunnelQuery", Query: onboarding.SelectFunnelQuery},
+	{Name: "profile.SelectProfileQuery", Query: profile.SelectProfileQuery},
+	{Name: "profile.SelectBioQuery", Query: profile.SelectBioQuery},
+	{Name: "profile.SelectBookmarkedQuery", Query: profile.SelectBookmarkedQuery},
+	{Name: "referrals.SelectReferralsQuery", Query: referrals.SelectReferralsQuery},
+	{Name: "reports.SelectConnectionQuery", Query: reports.SelectConnectionQuery},
+	{Name: "reports.SelectReportsQuery", Query: reports.SelectReportsQuery},
+	{Name: "reports.SelectReportQuery", Query: reports.SelectReportQuery},
+	{Name: "reports.CountPendingReportsQuery", Query: reports.CountPendingReportsQuery},
+	{Name: "reports.InsertReportQuery", Query: reports.InsertReportQuery},
+	{Name: "reports.SubmitReportQuery", Query: reports.SubmitReportQuery},
+	{Name: "reports.DeleteReportQuery", Query: reports.DeleteReportQuery},
+	{Name: "reports.SelectAttachmentsQuery", Query: reports.SelectAttachmentsQuery},
+	{Name: "reports.SelectAttachmentPathsQuery", Query: reports.SelectAttachmentPathsQuery},
+	{Name: "reports.InsertAttachmentQuery", Query: reports.InsertAttachmentQuery},
+	{Name: "reports.SelectAttachmentQuery", Query: reports.SelectAttachmentQuery},
+	{Name: "reports.DeleteAttachmentQuery", Query: reports.DeleteAttachmentQuery},
+	{Name: "reports.ClaimOverdueRemindersQuery", Query: reports.ClaimOverdueRemindersQuery},
+	{Name: "requirements.SelectGrantProviderQuery", Query: requirements.SelectGrantProviderQuery},
+	{Name: "requirements.SelectRequirementsQuery", Query: requirements.SelectRequirementsQuery},
+	{Name: "requirements.InsertRequirementQuery", Query: requirements.InsertRequirementQuery},
+	{Name: "requirements.SelectRequirementFilesQuery", Query: requirements.SelectRequirementFilesQuery},
+	{Name: "requirements.DeleteRequirementQuery", Query: requirements.DeleteRequirementQuery},
+	{Name: "requirements.SelectConnectionPartiesQuery", Query: requirements.SelectConnectionPartiesQuery},
+	{Name: "requirements.SelectChecklistsQuery", Query: requirements.SelectChecklistsQuery},
+	{Name: "requirements.SelectProviderRequirementQuery", Query: requirements.SelectProviderRequirementQuery},
+	{Name: "requirements.SelectDocumentQuery", Query: requirements.SelectDocumentQuery},
+	{Name: "requirements.SelectDocumentPathQuery", Query: requirements.SelectDocumentPathQuery},
+	{Name: "requirements.UpsertDocumentQuery", Query: requirements.UpsertDocumentQuery},
+	{Name: "requirements.DeleteDocumentQuery", Query: requirements.DeleteDocumentQuery},
+	{Name: "research.SelectTokenByHashQuery", Query: research.SelectTokenByHashQuery},
+	{Name: "research.SelectTokensQuery", Query: research.SelectTokensQuery},
+	{Name: "research.InsertTokenQuery", Query: research.InsertTokenQuery},
+	{Name: "research.RevokeTokenQuery", Query: research.RevokeTokenQuery},
+	{Name: "research.SelectSectorMatchesQuery", Query: research.SelectSectorMatchesQuery},
+	{Name: "search.SelectProfilesQuery", Query: search.SelectProfilesQuery},
+	{Name: "search.CountProfilesQuery", Query: search.CountProfilesQuery},
+	{Name: "sso.SelectProviderBySlugQuery", Query: sso.SelectProviderBySlugQuery},
+	{Name: "sso.SelectProvidersQuery", Query: sso.SelectProvidersQuery},
+	{Name: "sso.UpsertProviderQuery", Query: sso.UpsertProviderQuery},
+	{Name: "sso.InsertRequestQuery", Query: sso.InsertRequestQuery},
+	{Name: "sso.ConsumeRequestQuery", Query: sso.ConsumeRequestQuery},
+	{Name: "sso.SelectUserByEmailQuery", Query: sso.SelectUserByEmailQuery},
+	{Name: "sso.InsertUserQuery", Query: sso.InsertUserQuery},
+	{Name: "sso.InsertProfileQuery", Query: sso.InsertProfileQuery},
+	{Name: "sso.InsertRecipientDataQuery", Query: sso.InsertRecipientDataQuery},
+	{Name: "sso.InsertProviderDataQuery", Query: sso.InsertProviderDataQuery},
+	{Name: "sso.SelectProviderByTokenQuery", Query: sso.SelectProviderByTokenQuery},
+	{Name: "sso.UpdateSCIMTokenQuery", Query: sso.UpdateSCIMTokenQuery},
+	{Name: "sso.SelectSCIMUsersQuery", Query: sso.SelectSCIMUsersQuery},
+	{Name: "sso.SelectSCIMUserQuery", Query: sso.SelectSCIMUserQuery},
+	{Name: "sso.UpdateSCIMUserQuery", Query: sso.UpdateSCIMUserQuery},
+	{Name: "sso.DeleteTokensQuery", Query: sso.DeleteTokensQuery},
+	{Name: "sso.SCIMUserExistsQuery", Query: sso.SCIMUserExistsQuery},
+	{Name: "stories.SelectConnectionQuery", Query: stories.SelectConnectionQuery},
+	{Name: "stories.SelectStoryQuery", Query: stories.SelectStoryQuery},
+	{Name: "stories.SelectStoryByIDQuery", Query: stories.SelectStoryByIDQuery},
+	{Name: "stories.SelectStoriesQuery", Query: stories.SelectStoriesQuery},
+	{Name: "stories.UpsertStoryQuery", Query: stories.UpsertStoryQuery},
+	{Name: "stories.ApproveStoryQuery", Query: stories.ApproveStoryQuery},
+	{Name: "stories.DeleteStoryQuery", Query: stories.DeleteStoryQuery},
+	{Name: "stories.ReviewStoryQuery", Query: stories.ReviewStoryQuery},
+	{Name: "stories.CountPublishedStoriesQuery", Query: stories.CountPublishedStoriesQuery},
+	{Name: "stories.SelectPublishedStoriesQuery", Query: stories.SelectPublishedStoriesQuery},
+	{Name: "stories.SelectPublishedStoryQuery", Query: stories.SelectPublishedStoryQuery},
+	{Name: "tasks.SelectConnectionSidesQuery", Query: tasks.SelectConnectionSidesQuery},
+	{Name: "tasks.SelectTasksQuery", Query: tasks.SelectTasksQuery},
+	{Name: "tasks.CountOpenTasksQuery", Query: tasks.CountOpenTasksQuery},
+	{Name: "tasks.InsertTaskQuery", Query: tasks.InsertTaskQuery},
+	{Name: "tasks.CompleteTaskQuery", Query: tasks.CompleteTaskQuery},
+	{Name: "tasks.SelectTaskQuery", Query: tasks.SelectTaskQuery},
+	{Name: "tasks.DeleteTaskQuery", Query: tasks.DeleteTaskQuery},
+	{Name: "tasks.ClaimDueRemindersQuery", Query: tasks.ClaimDueRemindersQuery},
+	{Name: "templates.SelectTemplatesQuery", Query: templates.SelectTemplatesQuery},
+	{Name: "templates.InsertTemplateQuery", Query: templates.InsertTemplateQuery},
+	{Name: "templates.UpdateTemplateQuery", Query: templates.UpdateTemplateQuery},
+	{Name: "templates.DeleteTemplateQuery", Query: templates.DeleteTemplateQuery},
+	{Name: "user.SelectBasicUserQuery", Query: user.SelectBasicUserQuery},
+	{Name: "user.SelectUserQuery", Query: user.SelectUserQuery},
+	{Name: "user.SelectUserAuthorizedQuery", Query: user.SelectUserAuthorizedQuery},
+	{Name: "user.SelectRecipientQuery", Query: user.SelectRecipientQuery},
+	{Name: "user.SelectProviderQuery", Query: user.SelectProviderQuery},
+	{Name: "user.SelectUsersPageQuery", Query: user.SelectUsersPageQuery},
+	{Name: "user.CountUsersQuery", Query: user.CountUsersQuery},
+	{Name: "widget.SelectWidgetProviderQuery", Query: widget.SelectWidgetProviderQuery},
+	{Name: "widget.SelectOpenOpportunitiesQuery", Query: widget.SelectOpenOpportunitiesQuery},
+	{Name: "widget.UpsertWidgetTokenQuery", Query: widget.UpsertWidgetTokenQuery},
+	{Name: "widget.DeleteWidgetTokenQuery", Query: widget.DeleteWidgetTokenQuery},
+}
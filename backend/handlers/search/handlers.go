@@ -0,0 +1,128 @@
+package search
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"matcherator/backend/handlers/auth"
+	"matcherator/backend/handlers/httputil"
+
+	"github.com/lib/pq"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+
+	// maxQueryLength caps the free-text query, in characters
+	maxQueryLength = 200
+
+	// maxFilterValues caps the sectors or target groups a search filters by
+	maxFilterValues = 20
+)
+
+// SearchProfilesHandler searches organizations by free text over their name
+// and mission statement, optionally filtered by sectors and target groups
+// (matching any of those given), state and role. Results are ranked by how
+// well they match the text, names counting more than missions.
+// Used by: /api/search/profiles?q=&sectors=&target_groups=&state=&role=&limit=&offset=
+// Response: ProfilesResponse
+func SearchProfilesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		query := r.URL.Query()
+		q := strings.TrimSpace(query.Get("q"))
+		if utf8.RuneCountInString(q) > maxQueryLength {
+			http.Error(w, fmt.Sprintf("q must be at most %d characters", maxQueryLength), http.StatusBadRequest)
+			return
+		}
+		sectors := listParam(r, "sectors")
+		targetGroups := listParam(r, "target_groups")
+		if len(sectors) > maxFilterValues || len(targetGroups) > maxFilterValues {
+			http.Error(w, fmt.Sprintf("At most %d sectors and %d target groups can be searched for", maxFilterValues, maxFilterValues), http.StatusBadRequest)
+			return
+		}
+		state := strings.TrimSpace(query.Get("state"))
+		role := query.Get("role")
+		if role != "" && role != "provider" && role != "recipient" {
+			http.Error(w, "role must be provider or recipient", http.StatusBadRequest)
+			return
+		}
+		limit, offset, ok := httputil.ParsePage(w, r, defaultPageSize, maxPageSize)
+		if !ok {
+			return
+		}
+
+		args := []interface{}{userID, q, pq.Array(sectors), pq.Array(targetGroups), state, role}
+		response := ProfilesResponse{Profiles: []ProfileResult{}, Limit: limit, Offset: offset}
+		if err := db.QueryRow(CountProfilesQuery, args...).Scan(&response.Total); err != nil {
+			log.Printf("Error counting profile search results: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		rows, err := db.Query(SelectProfilesQuery, append(args, limit, offset)...)
+		if err != nil {
+			log.Printf("Error searching profiles: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var p ProfileResult
+			err := rows.Scan(
+				&p.ID,
+				&p.OrganizationName,
+				&p.ProfilePictureURL,
+				&p.MissionStatement,
+				&p.Role,
+				&p.DualRole,
+				&p.State,
+				&p.City,
+				pq.Array(&p.Sectors),
+				pq.Array(&p.TargetGroups),
+				&p.Rank,
+			)
+			if err != nil {
+				log.Printf("Error scanning profile search result: %v", err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+			response.Profiles = append(response.Profiles, p)
+		}
+		if err := rows.Err(); err != nil {
+			log.Printf("Error iterating profile search results: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// listParam reads a list query parameter, given comma-separated, repeated or
+// both, without blank entries
+func listParam(r *http.Request, name string) []string {
+	values := []string{}
+	for _, value := range r.URL.Query()[name] {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				values = append(values, item)
+			}
+		}
+	}
+	return values
+}
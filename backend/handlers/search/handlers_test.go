@@ -0,0 +1,103 @@
+package search
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"matcherator/backend/handlers/auth"
+)
+
+// search runs SearchProfilesHandler for user 7 with the query string
+func search(t *testing.T, db *sql.DB, query string) *httptest.ResponseRecorder {
+	t.Helper()
+	t.Setenv("JWT_SECRET_KEY", "test-secret")
+	token, err := auth.GenerateToken(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/search/profiles?"+query, nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	SearchProfilesHandler(db)(w, r)
+	return w
+}
+
+func TestSearchProfiles(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// Filters reach both queries; the page only the select
+	filters := []driver.Value{7, "youth", `{"Health","Education"}`, `{}`, "", "provider"}
+	mock.ExpectQuery(regexp.QuoteMeta(CountProfilesQuery)).WithArgs(filters...).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(41))
+	mock.ExpectQuery(regexp.QuoteMeta(SelectProfilesQuery)).WithArgs(append(filters, 2, 40)...).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "organization_name", "profile_picture_url", "mission_statement", "role", "dual_role", "state", "city", "sectors", "target_groups", "rank"}).
+			AddRow(12, "Youth Health Fund", nil, "Funding youth health", "provider", false, "OR", "Portland", "{Health}", "{Youth}", 0.6))
+
+	w := search(t, db, "q=+youth+&sectors=Health,Education&role=provider&limit=2&offset=40")
+
+	want := `{"profiles":[{"id":12,"organization_name":"Youth Health Fund","profile_picture_url":null,"mission_statement":"Funding youth health","role":"provider","dual_role":false,"state":"OR","city":"Portland","sectors":["Health"],"target_groups":["Youth"],"rank":0.6}],"total":41,"limit":2,"offset":40}`
+	if got := strings.TrimSpace(w.Body.String()); w.Code != http.StatusOK || got != want {
+		t.Errorf("status %d, body\n%s\nwant\n%s", w.Code, got, want)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSearchProfilesLimits(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	tooMany := strings.TrimSuffix(strings.Repeat("s,", maxFilterValues+1), ",")
+	rejected := map[string]string{
+		"q=" + strings.Repeat("a", maxQueryLength+1): fmt.Sprintf("q must be at most %d characters", maxQueryLength),
+		"sectors=" + tooMany:                         fmt.Sprintf("At most %d sectors and %d target groups can be searched for", maxFilterValues, maxFilterValues),
+		"target_groups=" + tooMany:                   fmt.Sprintf("At most %d sectors and %d target groups can be searched for", maxFilterValues, maxFilterValues),
+		"role=admin":                                 "role must be provider or recipient",
+	}
+	for query, message := range rejected {
+		w := search(t, db, query)
+		if got := strings.TrimSpace(w.Body.String()); w.Code != http.StatusBadRequest || got != message {
+			t.Errorf("%.30s: status %d, %q; want 400, %q", query, w.Code, got, message)
+		}
+	}
+
+	// A query of exactly the maximum length, counted in characters, is searched
+	mock.ExpectQuery(regexp.QuoteMeta(CountProfilesQuery)).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(regexp.QuoteMeta(SelectProfilesQuery)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "organization_name", "profile_picture_url", "mission_statement", "role", "dual_role", "state", "city", "sectors", "target_groups", "rank"}))
+	if w := search(t, db, "q="+strings.Repeat("é", maxQueryLength)); w.Code != http.StatusOK {
+		t.Errorf("query at the limit: status %d: %s", w.Code, w.Body)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestListParam(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/api/search/profiles?sectors=Health,+Education&sectors=Arts,,&target_groups=", nil)
+
+	if got, want := listParam(r, "sectors"), []string{"Health", "Education", "Arts"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sectors = %q, want %q", got, want)
+	}
+	if got := listParam(r, "target_groups"); got == nil || len(got) != 0 {
+		t.Errorf("target_groups = %#v, want an empty list", got)
+	}
+}
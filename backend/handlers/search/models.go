@@ -0,0 +1,24 @@
+package search
+
+// ProfileResult is an organization found by a profile search
+type ProfileResult struct {
+	ID                int64    `json:"id"`
+	OrganizationName  string   `json:"organization_name"`
+	ProfilePictureURL *string  `json:"profile_picture_url"`
+	MissionStatement  string   `json:"mission_statement"`
+	Role              string   `json:"role"`
+	DualRole          bool     `json:"dual_role"`
+	State             string   `json:"state"`
+	City              string   `json:"city"`
+	Sectors           []string `json:"sectors"`
+	TargetGroups      []string `json:"target_groups"`
+	Rank              float64  `json:"rank"` // how well the text query matched; 0 without one
+}
+
+// ProfilesResponse is one page of profile search results
+type ProfilesResponse struct {
+	Profiles []ProfileResult `json:"profiles"`
+	Total    int             `json:"total"`
+	Limit    int             `json:"limit"`
+	Offset   int             `json:"offset"`
+}
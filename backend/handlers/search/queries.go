@@ -0,0 +1,47 @@
+package search
+
+// profileFilter selects the active organizations other than the searcher ($1)
+// matching the text query ($2, web search syntax, ignored when empty) and the
+// sector ($3) and target group ($4) overlaps, state ($5) and role ($6) filters
+const profileFilter = `
+		FROM profiles p
+		JOIN users u ON u.id = p.user_id
+		WHERE u.id <> $1
+			AND u.status = 'active'
+			AND u.deactivated_at IS NULL
+			AND u.deleted_at IS NULL
+			AND u.merged_into IS NULL
+			AND ($2::text = '' OR p.search_vector @@ websearch_to_tsquery('english', $2::text))
+			AND (cardinality($3::text[]) = 0 OR p.sectors && $3::text[])
+			AND (cardinality($4::text[]) = 0 OR p.target_groups && $4::text[])
+			AND ($5::text = '' OR UPPER(p.state) = UPPER($5::text))
+			AND ($6::text = '' OR u.role = $6::text OR u.dual_role)
+`
+
+const (
+	// SelectProfilesQuery pages through the matching profiles, best text match
+	// first, then alphabetically
+	SelectProfilesQuery = `
+		SELECT
+			u.id,
+			p.organization_name,
+			p.profile_picture_url,
+			COALESCE(p.mission_statement, ''),
+			u.role,
+			u.dual_role,
+			COALESCE(p.state, ''),
+			COALESCE(p.city, ''),
+			COALESCE(p.sectors, '{}'),
+			COALESCE(p.target_groups, '{}'),
+			CASE
+				WHEN $2::text = '' THEN 0
+				ELSE ts_rank(p.search_vector, websearch_to_tsquery('english', $2::text))
+			END AS rank
+	` + profileFilter + `
+		ORDER BY rank DESC, p.organization_name, u.id
+		LIMIT $7 OFFSET $8
+	`
+
+	// CountProfilesQuery counts the profiles SelectProfilesQuery pages through
+	CountProfilesQuery = `SELECT COUNT(*)` + profileFilter
+)
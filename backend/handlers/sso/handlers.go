@@ -0,0 +1,414 @@
+package sso
+
+import (
+	"database/sql"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/crewjam/saml"
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+	"golang.org/x/crypto/bcrypt"
+
+	"matcherator/backend/handlers/auth"
+	"matcherator/backend/handlers/httputil"
+	"matcherator/backend/handlers/user_status"
+	"matcherator/backend/services/fieldcrypt"
+	"matcherator/backend/services/tokens"
+	"matcherator/backend/services/track"
+)
+
+// slugPattern restricts provider slugs to URL-safe identifiers
+var slugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,99}$`)
+
+// MetadataHandler serves our SP metadata for an organization's identity provider
+// Used by: /api/auth/saml/{slug}/metadata
+// Response: SAML EntityDescriptor XML
+func MetadataHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		provider, sp, ok := loadServiceProvider(w, db, mux.Vars(r)["slug"])
+		if !ok {
+			return
+		}
+
+		metadata, err := xml.MarshalIndent(sp.Metadata(), "", "  ")
+		if err != nil {
+			log.Printf("Error encoding SAML metadata for %s: %v", provider.Slug, err)
+			http.Error(w, "Error encoding metadata", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/samlmetadata+xml")
+		w.Write(metadata)
+	}
+}
+
+// LoginHandler starts SP-initiated SSO by redirecting to the identity provider
+// Used by: /api/auth/saml/{slug}/login
+// Response: redirect to the IdP
+func LoginHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		provider, sp, ok := loadServiceProvider(w, db, mux.Vars(r)["slug"])
+		if !ok {
+			return
+		}
+
+		idpURL := sp.GetSSOBindingLocation(saml.HTTPRedirectBinding)
+		if idpURL == "" {
+			http.Error(w, "Identity provider does not support the HTTP-Redirect binding", http.StatusBadGateway)
+			return
+		}
+
+		authnRequest, err := sp.MakeAuthenticationRequest(idpURL, saml.HTTPRedirectBinding, saml.HTTPPostBinding)
+		if err != nil {
+			log.Printf("Error creating AuthnRequest for %s: %v", provider.Slug, err)
+			http.Error(w, "Error creating SSO request", http.StatusInternalServerError)
+			return
+		}
+
+		if _, err := db.Exec(InsertRequestQuery, authnRequest.ID, provider.ID); err != nil {
+			log.Printf("Error storing AuthnRequest: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		// The request ID doubles as RelayState so the ACS knows which request is answered
+		redirectURL, err := authnRequest.Redirect(authnRequest.ID, sp)
+		if err != nil {
+			log.Printf("Error building SSO redirect for %s: %v", provider.Slug, err)
+			http.Error(w, "Error creating SSO request", http.StatusInternalServerError)
+			return
+		}
+
+		http.Redirect(w, r, redirectURL.String(), http.StatusFound)
+	}
+}
+
+// ACSHandler consumes the identity provider's assertion, provisions the user on
+// first login and hands a session token to the frontend
+// Used by: /api/auth/saml/{slug}/acs
+// Response: redirect to FRONTEND_URL/sso/callback, or auth.LoginResponse when unset
+func ACSHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		provider, sp, ok := loadServiceProvider(w, db, mux.Vars(r)["slug"])
+		if !ok {
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		var requestID string
+		err := db.QueryRow(ConsumeRequestQuery, r.PostForm.Get("RelayState"), provider.ID).Scan(&requestID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Unknown or expired SSO request", http.StatusUnauthorized)
+			return
+		} else if err != nil {
+			log.Printf("Error consuming AuthnRequest: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		assertion, err := sp.ParseResponse(r, []string{requestID})
+		if err != nil {
+			if invalid, ok := err.(*saml.InvalidResponseError); ok {
+				err = invalid.PrivateErr
+			}
+			log.Printf("Rejected SAML response for %s: %v", provider.Slug, err)
+			http.Error(w, "Invalid SAML response", http.StatusUnauthorized)
+			return
+		}
+
+		email := assertedEmail(assertion)
+		if email == "" {
+			http.Error(w, "SAML assertion does not contain an email address", http.StatusUnauthorized)
+			return
+		}
+
+		response, err := loginOrProvision(db, r, provider, email, assertedRole(provider, assertion))
+		if err == errPasswordAccount {
+			http.Error(w, "An account with this email already exists. Please log in with your password.", http.StatusConflict)
+			return
+		} else if err == errDeactivated {
+			http.Error(w, "Your account has been deactivated by your organization", http.StatusForbidden)
+			return
+		} else if err != nil {
+			log.Printf("Error signing in %s through %s: %v", email, provider.Slug, err)
+			http.Error(w, "Error completing sign in", http.StatusInternalServerError)
+			return
+		}
+
+		frontendURL := strings.TrimRight(os.Getenv("FRONTEND_URL"), "/")
+		if frontendURL == "" {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+
+		// Pass the session in the fragment so it never reaches server logs
+		fragment := url.Values{
+			"token":         {response.Token},
+			"refresh_token": {response.RefreshToken},
+			"id":            {strconv.Itoa(response.ID)},
+			"email":         {response.Email},
+			"role":          {response.Role},
+		}
+		http.Redirect(w, r, frontendURL+"/sso/callback#"+fragment.Encode(), http.StatusFound)
+	}
+}
+
+// errPasswordAccount is returned when the asserted email belongs to an account
+// that was not provisioned by the identity provider
+var errPasswordAccount = fmt.Errorf("account is not managed by this identity provider")
+
+// errDeactivated is returned when the account was deprovisioned through SCIM
+var errDeactivated = fmt.Errorf("account is deactivated")
+
+// loginOrProvision issues a token for the SSO user, creating the account with an
+// empty profile the first time they sign in
+func loginOrProvision(db *sql.DB, r *http.Request, provider Provider, email, role string) (auth.LoginResponse, error) {
+	response := auth.LoginResponse{Email: email}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return response, err
+	}
+	defer tx.Rollback()
+
+	var ssoProviderID sql.NullInt64
+	var deactivated, provisioned bool
+	err = tx.QueryRow(SelectUserByEmailQuery, email).Scan(&response.ID, &response.Role, &ssoProviderID, &deactivated)
+	switch {
+	case err == sql.ErrNoRows:
+		response.Role = role
+		if response.ID, err = provisionUser(tx, provider, email, role); err != nil {
+			return response, err
+		}
+		provisioned = true
+	case err != nil:
+		return response, fmt.Errorf("error looking up user: %v", err)
+	case !ssoProviderID.Valid || int(ssoProviderID.Int64) != provider.ID:
+		// Never let an identity provider take over a password or another tenant's account
+		return response, errPasswordAccount
+	case deactivated:
+		return response, errDeactivated
+	}
+
+	response.Token, err = auth.GenerateToken(response.ID)
+	if err != nil {
+		return response, fmt.Errorf("error generating token: %v", err)
+	}
+
+	response.RefreshToken, err = auth.StoreSession(tx, response.ID, response.Token, r)
+	if err != nil {
+		return response, fmt.Errorf("error storing token: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return response, err
+	}
+	if provisioned {
+		track.Event(db, response.ID, track.Signup, track.Properties{"method": "sso", "role": role, "provider": provider.Slug})
+	}
+	return response, nil
+}
+
+// provisionUser creates a just-in-time account mirroring SignupHandler. SSO users
+// get an unusable random password so they can only sign in through their IdP.
+func provisionUser(tx *sql.Tx, provider Provider, email, role string) (int, error) {
+	secret, err := tokens.NewSecret()
+	if err != nil {
+		return 0, fmt.Errorf("error generating password: %v", err)
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		return 0, fmt.Errorf("error hashing password: %v", err)
+	}
+
+	var userID int
+	if err := tx.QueryRow(InsertUserQuery, email, string(hashedPassword), role, provider.ID).Scan(&userID); err != nil {
+		return 0, fmt.Errorf("error creating user: %v", err)
+	}
+
+	contactEmail, err := fieldcrypt.Encrypt(email)
+	if err != nil {
+		return 0, fmt.Errorf("error encrypting contact email: %v", err)
+	}
+	if _, err := tx.Exec(InsertProfileQuery, userID, provider.Name, contactEmail); err != nil {
+		return 0, fmt.Errorf("error creating profile: %v", err)
+	}
+
+	roleDataQuery := InsertProviderDataQuery
+	if role == "recipient" {
+		roleDataQuery = InsertRecipientDataQuery
+	}
+	if _, err := tx.Exec(roleDataQuery, userID); err != nil {
+		return 0, fmt.Errorf("error creating role data: %v", err)
+	}
+
+	if err := user_status.UpdateUserStatus(tx, strconv.Itoa(userID)); err != nil {
+		return 0, fmt.Errorf("error updating user status: %v", err)
+	}
+
+	log.Printf("Provisioned user %d (%s) through SSO provider %s", userID, role, provider.Slug)
+	return userID, nil
+}
+
+// loadServiceProvider looks up an enabled identity provider and builds our SP for
+// it, writing the error response when either fails
+func loadServiceProvider(w http.ResponseWriter, db *sql.DB, slug string) (Provider, *saml.ServiceProvider, bool) {
+	provider, err := scanProvider(db.QueryRow(SelectProviderBySlugQuery, slug))
+	if err == sql.ErrNoRows {
+		http.Error(w, "SSO provider not found", http.StatusNotFound)
+		return provider, nil, false
+	} else if err != nil {
+		log.Printf("Error loading SSO provider %s: %v", slug, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return provider, nil, false
+	}
+
+	sp, err := serviceProvider(provider)
+	if err != nil {
+		log.Printf("Error configuring SSO provider %s: %v", slug, err)
+		http.Error(w, "SSO is not configured", http.StatusServiceUnavailable)
+		return provider, nil, false
+	}
+
+	return provider, sp, true
+}
+
+// scanProvider scans a row selected with the provider columns
+func scanProvider(row interface{ Scan(...interface{}) error }) (Provider, error) {
+	var p Provider
+	err := row.Scan(
+		&p.ID,
+		&p.Slug,
+		&p.Name,
+		&p.IDPMetadataXML,
+		&p.DefaultRole,
+		&p.RoleAttribute,
+		pq.Array(&p.ProviderRoleValues),
+		pq.Array(&p.RecipientRoleValues),
+		&p.Enabled,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+	)
+	return p, err
+}
+
+// ListProvidersHandler lists the configured identity providers
+// Used by: /api/admin/sso/providers
+// Response: []Provider
+func ListProvidersHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		rows, err := db.Query(SelectProvidersQuery)
+		if err != nil {
+			log.Printf("Error querying SSO providers: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		providers := []Provider{}
+		for rows.Next() {
+			p, err := scanProvider(rows)
+			if err != nil {
+				log.Printf("Error scanning SSO provider: %v", err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+			providers = append(providers, p)
+		}
+
+		if err = rows.Err(); err != nil {
+			log.Printf("Error iterating SSO providers: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(providers)
+	}
+}
+
+// UpsertProviderHandler creates or updates an organization's identity provider
+// Used by: /api/admin/sso/providers
+// Response: Provider
+func UpsertProviderHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		var req ProviderRequest
+		if !httputil.DecodeJSON(w, r, &req) {
+			return
+		}
+
+		req.Slug = strings.ToLower(strings.TrimSpace(req.Slug))
+		req.Name = strings.TrimSpace(req.Name)
+		if !slugPattern.MatchString(req.Slug) {
+			http.Error(w, "Slug must be lowercase letters, digits and dashes", http.StatusBadRequest)
+			return
+		}
+		if req.Name == "" {
+			http.Error(w, "Name is required", http.StatusBadRequest)
+			return
+		}
+		if req.DefaultRole == "" {
+			req.DefaultRole = "provider"
+		}
+		if req.DefaultRole != "provider" && req.DefaultRole != "recipient" {
+			http.Error(w, "Invalid default_role. Must be 'provider' or 'recipient'", http.StatusBadRequest)
+			return
+		}
+		if _, err := parseIDPMetadata(req.IDPMetadataXML); err != nil {
+			http.Error(w, "Invalid idp_metadata_xml: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.ProviderRoleValues == nil {
+			req.ProviderRoleValues = []string{}
+		}
+		if req.RecipientRoleValues == nil {
+			req.RecipientRoleValues = []string{}
+		}
+
+		provider := Provider{
+			Slug:                req.Slug,
+			Name:                req.Name,
+			IDPMetadataXML:      req.IDPMetadataXML,
+			DefaultRole:         req.DefaultRole,
+			RoleAttribute:       strings.TrimSpace(req.RoleAttribute),
+			ProviderRoleValues:  req.ProviderRoleValues,
+			RecipientRoleValues: req.RecipientRoleValues,
+			Enabled:             req.Enabled == nil || *req.Enabled,
+		}
+
+		err := db.QueryRow(UpsertProviderQuery,
+			provider.Slug,
+			provider.Name,
+			provider.IDPMetadataXML,
+			provider.DefaultRole,
+			provider.RoleAttribute,
+			pq.Array(provider.ProviderRoleValues),
+			pq.Array(provider.RecipientRoleValues),
+			provider.Enabled,
+		).Scan(&provider.ID, &provider.CreatedAt, &provider.UpdatedAt)
+		if err != nil {
+			log.Printf("Error saving SSO provider: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(provider)
+	}
+}
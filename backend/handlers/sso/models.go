@@ -0,0 +1,100 @@
+package sso
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Provider is an organization's SAML identity provider configuration
+type Provider struct {
+	ID                  int       `json:"id"`
+	Slug                string    `json:"slug"`
+	Name                string    `json:"name"`
+	IDPMetadataXML      string    `json:"idp_metadata_xml"`
+	DefaultRole         string    `json:"default_role"` // "provider" or "recipient"
+	RoleAttribute       string    `json:"role_attribute"`
+	ProviderRoleValues  []string  `json:"provider_role_values"`
+	RecipientRoleValues []string  `json:"recipient_role_values"`
+	Enabled             bool      `json:"enabled"`
+	CreatedAt           time.Time `json:"created_at"`
+	UpdatedAt           time.Time `json:"updated_at"`
+}
+
+// ProviderRequest represents the request body for creating or updating a provider
+type ProviderRequest struct {
+	Slug                string   `json:"slug"`
+	Name                string   `json:"name"`
+	IDPMetadataXML      string   `json:"idp_metadata_xml"`
+	DefaultRole         string   `json:"default_role"`
+	RoleAttribute       string   `json:"role_attribute"`
+	ProviderRoleValues  []string `json:"provider_role_values"`
+	RecipientRoleValues []string `json:"recipient_role_values"`
+	Enabled             *bool    `json:"enabled"`
+}
+
+// SCIM schema URNs (RFC 7643, RFC 7644)
+const (
+	scimUserSchema         = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimListResponseSchema = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	scimErrorSchema        = "urn:ietf:params:scim:api:messages:2.0:Error"
+)
+
+// SCIMUser is the SCIM representation of an organization member
+type SCIMUser struct {
+	Schemas    []string       `json:"schemas"`
+	ID         string         `json:"id,omitempty"`
+	ExternalID string         `json:"externalId,omitempty"`
+	UserName   string         `json:"userName"`
+	Active     *bool          `json:"active,omitempty"`
+	Emails     []SCIMMultiVal `json:"emails,omitempty"`
+	Roles      []SCIMMultiVal `json:"roles,omitempty"`
+	Meta       *SCIMMeta      `json:"meta,omitempty"`
+}
+
+// SCIMMultiVal is a SCIM multi-valued attribute entry such as an email or role
+type SCIMMultiVal struct {
+	Value   string `json:"value"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// SCIMMeta describes a SCIM resource
+type SCIMMeta struct {
+	ResourceType string    `json:"resourceType"`
+	Created      time.Time `json:"created"`
+	Location     string    `json:"location"`
+}
+
+// SCIMListResponse is a page of SCIM query results
+type SCIMListResponse struct {
+	Schemas      []string   `json:"schemas"`
+	TotalResults int        `json:"totalResults"`
+	StartIndex   int        `json:"startIndex"`
+	ItemsPerPage int        `json:"itemsPerPage"`
+	Resources    []SCIMUser `json:"Resources"`
+}
+
+// SCIMPatchRequest is a SCIM PATCH request body
+type SCIMPatchRequest struct {
+	Schemas    []string             `json:"schemas"`
+	Operations []SCIMPatchOperation `json:"Operations"`
+}
+
+// SCIMPatchOperation is a single SCIM PATCH operation
+type SCIMPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// SCIMError is a SCIM error response
+type SCIMError struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail"`
+}
+
+// SCIMTokenResponse returns a newly issued SCIM bearer token, shown only once
+type SCIMTokenResponse struct {
+	Token string `json:"token"`
+}
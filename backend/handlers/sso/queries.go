@@ -0,0 +1,156 @@
+package sso
+
+const (
+	// SelectProviderBySlugQuery loads an enabled identity provider
+	SelectProviderBySlugQuery = `
+		SELECT id, slug, name, idp_metadata_xml, default_role,
+			COALESCE(role_attribute, ''), provider_role_values, recipient_role_values,
+			enabled, created_at, updated_at
+		FROM sso_providers
+		WHERE slug = $1 AND enabled
+	`
+
+	// SelectProvidersQuery lists all identity providers
+	SelectProvidersQuery = `
+		SELECT id, slug, name, idp_metadata_xml, default_role,
+			COALESCE(role_attribute, ''), provider_role_values, recipient_role_values,
+			enabled, created_at, updated_at
+		FROM sso_providers
+		ORDER BY name
+	`
+
+	// UpsertProviderQuery creates or replaces an identity provider by slug
+	UpsertProviderQuery = `
+		INSERT INTO sso_providers (
+			slug, name, idp_metadata_xml, default_role, role_attribute,
+			provider_role_values, recipient_role_values, enabled
+		) VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7, $8)
+		ON CONFLICT (slug) DO UPDATE SET
+			name = EXCLUDED.name,
+			idp_metadata_xml = EXCLUDED.idp_metadata_xml,
+			default_role = EXCLUDED.default_role,
+			role_attribute = EXCLUDED.role_attribute,
+			provider_role_values = EXCLUDED.provider_role_values,
+			recipient_role_values = EXCLUDED.recipient_role_values,
+			enabled = EXCLUDED.enabled,
+			updated_at = CURRENT_TIMESTAMP
+		RETURNING id, created_at, updated_at
+	`
+
+	// InsertRequestQuery remembers an outstanding AuthnRequest
+	InsertRequestQuery = `
+		INSERT INTO sso_requests (id, provider_id)
+		VALUES ($1, $2)
+	`
+
+	// ConsumeRequestQuery deletes an outstanding AuthnRequest so its response can
+	// only be accepted once, and prunes requests that were never answered
+	ConsumeRequestQuery = `
+		WITH expired AS (
+			DELETE FROM sso_requests
+			WHERE created_at < NOW() - INTERVAL '10 minutes'
+		)
+		DELETE FROM sso_requests
+		WHERE id = $1 AND provider_id = $2 AND created_at >= NOW() - INTERVAL '10 minutes'
+		RETURNING id
+	`
+
+	// SelectUserByEmailQuery finds an existing account for an asserted email
+	SelectUserByEmailQuery = `
+		SELECT id, role, sso_provider_id, deactivated_at IS NOT NULL
+		FROM users
+		WHERE LOWER(email) = LOWER($1)
+	`
+
+	// InsertUserQuery creates a just-in-time provisioned account
+	InsertUserQuery = `
+		INSERT INTO users (email, password_hash, role, status, sso_provider_id)
+		VALUES ($1, $2, $3, 'inactive', $4)
+		RETURNING id
+	`
+
+	// InsertProfileQuery creates the empty profile of a provisioned account
+	InsertProfileQuery = `
+		INSERT INTO profiles (
+			user_id, organization_name, mission_statement,
+			sectors, target_groups, project_stage,
+			website_url, contact_email, chat_opt_in
+		) VALUES ($1, $2, '', '{}', '{}', '', '', $3, false)
+	`
+
+	// InsertRecipientDataQuery creates the empty recipient data of a provisioned account
+	InsertRecipientDataQuery = `
+		INSERT INTO recipient_data (
+			user_id, needs, budget_requested,
+			team_size, timeline, prior_funding
+		) VALUES ($1, '{}', 0, 0, '', false)
+	`
+
+	// InsertProviderDataQuery creates the empty provider data of a provisioned account
+	InsertProviderDataQuery = `
+		INSERT INTO provider_data (
+			user_id, funding_type, amount_offered,
+			region_scope, location_notes, eligibility_notes,
+			deadline, application_link
+		) VALUES ($1, '', 0, '', '', '', NULL, '')
+	`
+
+	// SelectProviderByTokenQuery authenticates a SCIM client by its bearer token hash
+	SelectProviderByTokenQuery = `
+		SELECT id, slug, name, idp_metadata_xml, default_role,
+			COALESCE(role_attribute, ''), provider_role_values, recipient_role_values,
+			enabled, created_at, updated_at
+		FROM sso_providers
+		WHERE scim_token_hash = $1 AND enabled
+	`
+
+	// UpdateSCIMTokenQuery replaces a provider's SCIM bearer token hash
+	UpdateSCIMTokenQuery = `
+		UPDATE sso_providers
+		SET scim_token_hash = $1, updated_at = CURRENT_TIMESTAMP
+		WHERE slug = $2
+	`
+
+	// SelectSCIMUsersQuery pages through a provider's users, optionally filtered
+	// by userName ($2) or externalId ($3)
+	SelectSCIMUsersQuery = `
+		SELECT id, COALESCE(external_id, ''), email, role, deactivated_at IS NULL, created_at,
+			COUNT(*) OVER ()
+		FROM users
+		WHERE sso_provider_id = $1
+			AND ($2::text IS NULL OR LOWER(email) = LOWER($2))
+			AND ($3::text IS NULL OR external_id = $3)
+		ORDER BY id
+		LIMIT $4 OFFSET $5
+	`
+
+	// SelectSCIMUserQuery loads one of a provider's users
+	SelectSCIMUserQuery = `
+		SELECT id, COALESCE(external_id, ''), email, role, deactivated_at IS NULL, created_at
+		FROM users
+		WHERE id = $1 AND sso_provider_id = $2
+	`
+
+	// UpdateSCIMUserQuery replaces the SCIM-managed attributes of a user
+	UpdateSCIMUserQuery = `
+		UPDATE users
+		SET email = $1,
+			external_id = NULLIF($2, ''),
+			deactivated_at = CASE
+				WHEN $3 THEN NULL
+				ELSE COALESCE(deactivated_at, CURRENT_TIMESTAMP)
+			END
+		WHERE id = $4 AND sso_provider_id = $5
+	`
+
+	// DeleteTokensQuery revokes all sessions of a user
+	DeleteTokensQuery = `
+		DELETE FROM tokens
+		WHERE user_id = $1
+	`
+
+	// SCIMUserExistsQuery checks that a user belongs to a provider
+	SCIMUserExistsQuery = `
+		SELECT EXISTS (SELECT 1 FROM users WHERE id = $1 AND sso_provider_id = $2)
+	`
+)
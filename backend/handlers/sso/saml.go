@@ -0,0 +1,146 @@
+package sso
+
+import (
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/crewjam/saml"
+)
+
+// Attribute names commonly used by identity providers for the user's email
+var emailAttributes = []string{
+	"email",
+	"mail",
+	"urn:oid:0.9.2342.19200300.100.1.3",
+	"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress",
+}
+
+// serviceProvider builds our SAML service provider for an organization's identity
+// provider. The SP key pair is read from SAML_SP_CERT_FILE and SAML_SP_KEY_FILE and
+// endpoint URLs are rooted at PUBLIC_URL.
+func serviceProvider(p Provider) (*saml.ServiceProvider, error) {
+	certFile, keyFile := os.Getenv("SAML_SP_CERT_FILE"), os.Getenv("SAML_SP_KEY_FILE")
+	if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("SAML_SP_CERT_FILE and SAML_SP_KEY_FILE environment variables not set")
+	}
+
+	keyPair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("error loading SAML key pair: %v", err)
+	}
+	key, ok := keyPair.PrivateKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("SAML key must be an RSA private key")
+	}
+	cert, err := x509.ParseCertificate(keyPair.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("error parsing SAML certificate: %v", err)
+	}
+
+	idpMetadata, err := parseIDPMetadata(p.IDPMetadataXML)
+	if err != nil {
+		return nil, err
+	}
+
+	rootURL, err := url.Parse(strings.TrimRight(os.Getenv("PUBLIC_URL"), "/"))
+	if err != nil || rootURL.Host == "" {
+		return nil, fmt.Errorf("PUBLIC_URL environment variable must be an absolute URL")
+	}
+	base := rootURL.String() + "/api/auth/saml/" + url.PathEscape(p.Slug)
+	metadataURL, err := url.Parse(base + "/metadata")
+	if err != nil {
+		return nil, fmt.Errorf("error building metadata URL: %v", err)
+	}
+	acsURL, err := url.Parse(base + "/acs")
+	if err != nil {
+		return nil, fmt.Errorf("error building ACS URL: %v", err)
+	}
+
+	return &saml.ServiceProvider{
+		EntityID:          metadataURL.String(),
+		Key:               key,
+		Certificate:       cert,
+		MetadataURL:       *metadataURL,
+		AcsURL:            *acsURL,
+		IDPMetadata:       idpMetadata,
+		AuthnNameIDFormat: saml.EmailAddressNameIDFormat,
+	}, nil
+}
+
+// parseIDPMetadata decodes an identity provider's metadata document
+func parseIDPMetadata(metadataXML string) (*saml.EntityDescriptor, error) {
+	var idpMetadata saml.EntityDescriptor
+	if err := xml.Unmarshal([]byte(metadataXML), &idpMetadata); err != nil {
+		return nil, fmt.Errorf("error parsing IdP metadata: %v", err)
+	}
+	if len(idpMetadata.IDPSSODescriptors) == 0 {
+		return nil, fmt.Errorf("IdP metadata has no IDPSSODescriptor")
+	}
+	return &idpMetadata, nil
+}
+
+// attributeValues returns the values of the named assertion attribute
+func attributeValues(assertion *saml.Assertion, name string) []string {
+	var values []string
+	for _, statement := range assertion.AttributeStatements {
+		for _, attr := range statement.Attributes {
+			if attr.Name != name && attr.FriendlyName != name {
+				continue
+			}
+			for _, v := range attr.Values {
+				values = append(values, strings.TrimSpace(v.Value))
+			}
+		}
+	}
+	return values
+}
+
+// assertedEmail returns the user's email from the NameID or a well-known attribute
+func assertedEmail(assertion *saml.Assertion) string {
+	if assertion.Subject != nil && assertion.Subject.NameID != nil {
+		if nameID := strings.TrimSpace(assertion.Subject.NameID.Value); strings.Contains(nameID, "@") {
+			return nameID
+		}
+	}
+	for _, name := range emailAttributes {
+		for _, v := range attributeValues(assertion, name) {
+			if strings.Contains(v, "@") {
+				return v
+			}
+		}
+	}
+	return ""
+}
+
+// assertedRole maps the provider's role attribute onto a matcherator role,
+// falling back to the provider's default role
+func assertedRole(p Provider, assertion *saml.Assertion) string {
+	if p.RoleAttribute == "" {
+		return p.DefaultRole
+	}
+	for _, v := range attributeValues(assertion, p.RoleAttribute) {
+		if containsFold(p.ProviderRoleValues, v) {
+			return "provider"
+		}
+		if containsFold(p.RecipientRoleValues, v) {
+			return "recipient"
+		}
+	}
+	return p.DefaultRole
+}
+
+// containsFold reports whether values contains s, ignoring case
+func containsFold(values []string, s string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
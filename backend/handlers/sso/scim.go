@@ -0,0 +1,503 @@
+package sso
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"matcherator/backend/services/accounts"
+	"matcherator/backend/services/tokens"
+	"matcherator/backend/services/track"
+)
+
+// scimProviderKey is the context key of the identity provider authenticated by SCIMMiddleware
+type scimProviderKey struct{}
+
+const (
+	scimContentType  = "application/scim+json"
+	scimDefaultCount = 100
+)
+
+// scimFilterPattern matches the equality filters identity providers send before
+// creating a user, e.g. userName eq "jane@example.edu"
+var scimFilterPattern = regexp.MustCompile(`^(?i)(userName|externalId)\s+eq\s+"([^"]*)"$`)
+
+// scimUser is a user row as exposed through SCIM
+type scimUser struct {
+	ID         int
+	ExternalID string
+	Email      string
+	Role       string
+	Active     bool
+}
+
+// SCIMMiddleware authenticates SCIM clients by the bearer token issued to their
+// identity provider and scopes the request to that provider's users
+func SCIMMiddleware(db *sql.DB) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if token == "" {
+				writeSCIMError(w, http.StatusUnauthorized, "", "Missing bearer token")
+				return
+			}
+
+			provider, err := scanProvider(db.QueryRow(SelectProviderByTokenQuery, tokens.Hash(token)))
+			if err == sql.ErrNoRows {
+				writeSCIMError(w, http.StatusUnauthorized, "", "Invalid bearer token")
+				return
+			} else if err != nil {
+				log.Printf("Error authenticating SCIM client: %v", err)
+				writeSCIMError(w, http.StatusInternalServerError, "", "Database error")
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), scimProviderKey{}, provider)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// CreateSCIMTokenHandler issues a new SCIM bearer token for an identity provider,
+// replacing any previous token
+// Used by: /api/admin/sso/providers/{slug}/scim-token
+// Response: SCIMTokenResponse
+func CreateSCIMTokenHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		token, err := tokens.NewSecret()
+		if err != nil {
+			log.Printf("Error generating SCIM token: %v", err)
+			http.Error(w, "Error generating token", http.StatusInternalServerError)
+			return
+		}
+
+		result, err := db.Exec(UpdateSCIMTokenQuery, tokens.Hash(token), mux.Vars(r)["slug"])
+		if err != nil {
+			log.Printf("Error storing SCIM token: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			http.Error(w, "SSO provider not found", http.StatusNotFound)
+			return
+		}
+
+		json.NewEncoder(w).Encode(SCIMTokenResponse{Token: token})
+	}
+}
+
+// ListSCIMUsersHandler lists the provider's users, supporting userName and
+// externalId equality filters and startIndex/count paging
+// Used by: GET /scim/v2/Users
+// Response: SCIMListResponse
+func ListSCIMUsersHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		provider := r.Context().Value(scimProviderKey{}).(Provider)
+		query := r.URL.Query()
+
+		var userName, externalID *string
+		if filter := strings.TrimSpace(query.Get("filter")); filter != "" {
+			m := scimFilterPattern.FindStringSubmatch(filter)
+			if m == nil {
+				writeSCIMError(w, http.StatusBadRequest, "invalidFilter", "Only userName eq and externalId eq filters are supported")
+				return
+			}
+			if strings.EqualFold(m[1], "userName") {
+				userName = &m[2]
+			} else {
+				externalID = &m[2]
+			}
+		}
+
+		startIndex, err := strconv.Atoi(query.Get("startIndex"))
+		if err != nil || startIndex < 1 {
+			startIndex = 1
+		}
+		count, err := strconv.Atoi(query.Get("count"))
+		if err != nil || count < 0 || count > scimDefaultCount {
+			count = scimDefaultCount
+		}
+
+		rows, err := db.Query(SelectSCIMUsersQuery, provider.ID, userName, externalID, count, startIndex-1)
+		if err != nil {
+			log.Printf("Error querying SCIM users: %v", err)
+			writeSCIMError(w, http.StatusInternalServerError, "", "Database error")
+			return
+		}
+		defer rows.Close()
+
+		response := SCIMListResponse{
+			Schemas:    []string{scimListResponseSchema},
+			StartIndex: startIndex,
+			Resources:  []SCIMUser{},
+		}
+		for rows.Next() {
+			var u scimUser
+			var meta SCIMMeta
+			if err := rows.Scan(&u.ID, &u.ExternalID, &u.Email, &u.Role, &u.Active, &meta.Created, &response.TotalResults); err != nil {
+				log.Printf("Error scanning SCIM user: %v", err)
+				writeSCIMError(w, http.StatusInternalServerError, "", "Database error")
+				return
+			}
+			response.Resources = append(response.Resources, u.resource(meta))
+		}
+
+		if err = rows.Err(); err != nil {
+			log.Printf("Error iterating SCIM users: %v", err)
+			writeSCIMError(w, http.StatusInternalServerError, "", "Database error")
+			return
+		}
+
+		response.ItemsPerPage = len(response.Resources)
+		writeSCIM(w, http.StatusOK, response)
+	}
+}
+
+// GetSCIMUserHandler returns one of the provider's users
+// Used by: GET /scim/v2/Users/{id}
+// Response: SCIMUser
+func GetSCIMUserHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		provider := r.Context().Value(scimProviderKey{}).(Provider)
+
+		resource, ok := loadSCIMUser(w, db, provider, scimUserID(r))
+		if !ok {
+			return
+		}
+		writeSCIM(w, http.StatusOK, resource)
+	}
+}
+
+// CreateSCIMUserHandler provisions an organization member with an empty profile
+// Used by: POST /scim/v2/Users
+// Response: SCIMUser
+func CreateSCIMUserHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		provider := r.Context().Value(scimProviderKey{}).(Provider)
+
+		var req SCIMUser
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeSCIMError(w, http.StatusBadRequest, "invalidSyntax", "Invalid request body")
+			return
+		}
+
+		email := strings.TrimSpace(req.UserName)
+		if !strings.Contains(email, "@") {
+			writeSCIMError(w, http.StatusBadRequest, "invalidValue", "userName must be an email address")
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			writeSCIMError(w, http.StatusInternalServerError, "", "Database error")
+			return
+		}
+		defer tx.Rollback()
+
+		var exists bool
+		if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM users WHERE LOWER(email) = LOWER($1))`, email).Scan(&exists); err != nil {
+			log.Printf("Error checking SCIM user: %v", err)
+			writeSCIMError(w, http.StatusInternalServerError, "", "Database error")
+			return
+		}
+		if exists {
+			writeSCIMError(w, http.StatusConflict, "uniqueness", "A user with this userName already exists")
+			return
+		}
+
+		userID, err := provisionUser(tx, provider, email, scimRole(provider, req.Roles))
+		if err != nil {
+			log.Printf("Error provisioning SCIM user: %v", err)
+			writeSCIMError(w, http.StatusInternalServerError, "", "Error creating user")
+			return
+		}
+
+		active := req.Active == nil || *req.Active
+		if _, err := tx.Exec(UpdateSCIMUserQuery, email, req.ExternalID, active, userID, provider.ID); err != nil {
+			log.Printf("Error updating SCIM user: %v", err)
+			writeSCIMError(w, http.StatusInternalServerError, "", "Error creating user")
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			writeSCIMError(w, http.StatusInternalServerError, "", "Error creating user")
+			return
+		}
+		track.Event(db, userID, track.Signup, track.Properties{"method": "scim", "role": scimRole(provider, req.Roles), "provider": provider.Slug})
+
+		resource, ok := loadSCIMUser(w, db, provider, userID)
+		if !ok {
+			return
+		}
+		writeSCIM(w, http.StatusCreated, resource)
+	}
+}
+
+// ReplaceSCIMUserHandler replaces a user's userName, externalId and active state
+// Used by: PUT /scim/v2/Users/{id}
+// Response: SCIMUser
+func ReplaceSCIMUserHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		provider := r.Context().Value(scimProviderKey{}).(Provider)
+
+		var req SCIMUser
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeSCIMError(w, http.StatusBadRequest, "invalidSyntax", "Invalid request body")
+			return
+		}
+
+		current, ok := loadSCIMUser(w, db, provider, scimUserID(r))
+		if !ok {
+			return
+		}
+
+		email := strings.TrimSpace(req.UserName)
+		if !strings.Contains(email, "@") {
+			writeSCIMError(w, http.StatusBadRequest, "invalidValue", "userName must be an email address")
+			return
+		}
+
+		saveSCIMUser(w, db, provider, current, email, req.ExternalID, req.Active == nil || *req.Active)
+	}
+}
+
+// PatchSCIMUserHandler applies add/replace operations to userName, externalId and
+// active, which is how most identity providers deactivate users
+// Used by: PATCH /scim/v2/Users/{id}
+// Response: SCIMUser
+func PatchSCIMUserHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		provider := r.Context().Value(scimProviderKey{}).(Provider)
+
+		var req SCIMPatchRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeSCIMError(w, http.StatusBadRequest, "invalidSyntax", "Invalid request body")
+			return
+		}
+
+		current, ok := loadSCIMUser(w, db, provider, scimUserID(r))
+		if !ok {
+			return
+		}
+
+		email, externalID, active := current.UserName, current.ExternalID, *current.Active
+		for _, op := range req.Operations {
+			if !strings.EqualFold(op.Op, "replace") && !strings.EqualFold(op.Op, "add") {
+				writeSCIMError(w, http.StatusBadRequest, "invalidPath", "Only add and replace operations are supported")
+				return
+			}
+
+			// Without a path the value is an object of attributes to set
+			values := map[string]json.RawMessage{}
+			if op.Path == "" {
+				if err := json.Unmarshal(op.Value, &values); err != nil {
+					writeSCIMError(w, http.StatusBadRequest, "invalidValue", "Operation value must be an object")
+					return
+				}
+			} else {
+				values[op.Path] = op.Value
+			}
+
+			for path, value := range values {
+				var err error
+				switch strings.ToLower(path) {
+				case "active":
+					active, err = parseSCIMBool(value)
+				case "username":
+					err = json.Unmarshal(value, &email)
+				case "externalid":
+					err = json.Unmarshal(value, &externalID)
+				default:
+					// Profile attributes such as name are not managed through SCIM
+					continue
+				}
+				if err != nil {
+					writeSCIMError(w, http.StatusBadRequest, "invalidValue", "Invalid value for "+path)
+					return
+				}
+			}
+		}
+
+		if !strings.Contains(email, "@") {
+			writeSCIMError(w, http.StatusBadRequest, "invalidValue", "userName must be an email address")
+			return
+		}
+
+		saveSCIMUser(w, db, provider, current, strings.TrimSpace(email), externalID, active)
+	}
+}
+
+// DeleteSCIMUserHandler deletes a provisioned user's account. The account is
+// anonymized and detached from the provider, so it is gone for SCIM.
+// Used by: DELETE /scim/v2/Users/{id}
+// Response: 204 No Content
+func DeleteSCIMUserHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		provider := r.Context().Value(scimProviderKey{}).(Provider)
+		userID := scimUserID(r)
+
+		var exists bool
+		if err := db.QueryRow(SCIMUserExistsQuery, userID, provider.ID).Scan(&exists); err != nil {
+			log.Printf("Error loading SCIM user: %v", err)
+			writeSCIMError(w, http.StatusInternalServerError, "", "Database error")
+			return
+		}
+		if !exists {
+			writeSCIMError(w, http.StatusNotFound, "", "User not found")
+			return
+		}
+
+		if err := accounts.Delete(db, userID); err != nil && err != sql.ErrNoRows {
+			log.Printf("Error deleting SCIM user: %v", err)
+			writeSCIMError(w, http.StatusInternalServerError, "", "Database error")
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// saveSCIMUser stores the SCIM-managed attributes and revokes the user's sessions
+// when they are deactivated
+func saveSCIMUser(w http.ResponseWriter, db *sql.DB, provider Provider, current SCIMUser, email, externalID string, active bool) {
+	tx, err := db.Begin()
+	if err != nil {
+		writeSCIMError(w, http.StatusInternalServerError, "", "Database error")
+		return
+	}
+	defer tx.Rollback()
+
+	userID, _ := strconv.Atoi(current.ID)
+	if _, err := tx.Exec(UpdateSCIMUserQuery, email, externalID, active, userID, provider.ID); err != nil {
+		if strings.Contains(err.Error(), "unique constraint") {
+			writeSCIMError(w, http.StatusConflict, "uniqueness", "A user with this userName already exists")
+			return
+		}
+		log.Printf("Error updating SCIM user: %v", err)
+		writeSCIMError(w, http.StatusInternalServerError, "", "Database error")
+		return
+	}
+
+	if !active {
+		if _, err := tx.Exec(DeleteTokensQuery, userID); err != nil {
+			log.Printf("Error revoking tokens: %v", err)
+			writeSCIMError(w, http.StatusInternalServerError, "", "Database error")
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeSCIMError(w, http.StatusInternalServerError, "", "Database error")
+		return
+	}
+
+	resource, ok := loadSCIMUser(w, db, provider, userID)
+	if !ok {
+		return
+	}
+	writeSCIM(w, http.StatusOK, resource)
+}
+
+// scimUserID parses the {id} route variable, returning 0 when it is not a user ID
+func scimUserID(r *http.Request) int {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	return id
+}
+
+// loadSCIMUser loads one of the provider's users, writing the error response when
+// it does not exist
+func loadSCIMUser(w http.ResponseWriter, db *sql.DB, provider Provider, userID int) (SCIMUser, bool) {
+	var u scimUser
+	var meta SCIMMeta
+	err := db.QueryRow(SelectSCIMUserQuery, userID, provider.ID).Scan(
+		&u.ID,
+		&u.ExternalID,
+		&u.Email,
+		&u.Role,
+		&u.Active,
+		&meta.Created,
+	)
+	if err == sql.ErrNoRows {
+		writeSCIMError(w, http.StatusNotFound, "", "User not found")
+		return SCIMUser{}, false
+	} else if err != nil {
+		log.Printf("Error loading SCIM user: %v", err)
+		writeSCIMError(w, http.StatusInternalServerError, "", "Database error")
+		return SCIMUser{}, false
+	}
+
+	return u.resource(meta), true
+}
+
+// resource converts a user row into its SCIM representation
+func (u scimUser) resource(meta SCIMMeta) SCIMUser {
+	id := strconv.Itoa(u.ID)
+	active := u.Active
+	meta.ResourceType = "User"
+	meta.Location = "/scim/v2/Users/" + id
+
+	return SCIMUser{
+		Schemas:    []string{scimUserSchema},
+		ID:         id,
+		ExternalID: u.ExternalID,
+		UserName:   u.Email,
+		Active:     &active,
+		Emails:     []SCIMMultiVal{{Value: u.Email, Primary: true}},
+		Roles:      []SCIMMultiVal{{Value: u.Role}},
+		Meta:       &meta,
+	}
+}
+
+// scimRole maps the requested SCIM roles onto a matcherator role using the
+// provider's role values, falling back to its default role
+func scimRole(p Provider, roles []SCIMMultiVal) string {
+	for _, role := range roles {
+		switch {
+		case strings.EqualFold(role.Value, "provider") || containsFold(p.ProviderRoleValues, role.Value):
+			return "provider"
+		case strings.EqualFold(role.Value, "recipient") || containsFold(p.RecipientRoleValues, role.Value):
+			return "recipient"
+		}
+	}
+	return p.DefaultRole
+}
+
+// parseSCIMBool accepts JSON booleans as well as the "True"/"False" strings some
+// identity providers send
+func parseSCIMBool(value json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(value, &b); err == nil {
+		return b, nil
+	}
+	var s string
+	if err := json.Unmarshal(value, &s); err != nil {
+		return false, err
+	}
+	return strconv.ParseBool(strings.ToLower(s))
+}
+
+// writeSCIM writes a SCIM JSON response
+func writeSCIM(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", scimContentType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// writeSCIMError writes a SCIM error response
+func writeSCIMError(w http.ResponseWriter, status int, scimType, detail string) {
+	writeSCIM(w, status, SCIMError{
+		Schemas:  []string{scimErrorSchema},
+		Status:   strconv.Itoa(status),
+		ScimType: scimType,
+		Detail:   detail,
+	})
+}
@@ -0,0 +1,367 @@
+package stories
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"matcherator/backend/handlers/auth"
+	"matcherator/backend/handlers/httputil"
+	"matcherator/backend/handlers/notifications"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	maxTitleLen = 150
+	maxBodyLen  = 3000
+	maxNoteLen  = 1000
+)
+
+// Notification types sent about success stories
+const (
+	NotificationApprovalRequested = "story_approval_requested"
+	NotificationPublished         = "story_published"
+	NotificationRejected          = "story_rejected"
+)
+
+// GetStoryHandler returns the success story of a connection to either side
+// Used by: /api/connections/{id}/story
+// Response: Story
+func GetStoryHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		parties, ok := connectionParties(w, r, db, userID)
+		if !ok {
+			return
+		}
+
+		story, err := scanStory(db.QueryRow(SelectStoryQuery, parties.connectionID))
+		if err == sql.ErrNoRows {
+			http.Error(w, "Story not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error loading story of connection %d: %v", parties.connectionID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(story)
+	}
+}
+
+// SaveStoryHandler writes the success story of a funded connection. Saving
+// counts as the author's approval; the other side must approve the new text
+// before it goes to admin review, so editing a published story takes it down.
+// Used by: /api/connections/{id}/story
+// Response: Story
+func SaveStoryHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req StoryRequest
+		if !httputil.DecodeJSON(w, r, &req) {
+			return
+		}
+		req.Title = strings.Join(strings.Fields(req.Title), " ")
+		req.Body = strings.TrimSpace(req.Body)
+		if req.Title == "" || req.Body == "" {
+			http.Error(w, "Title and body are required", http.StatusBadRequest)
+			return
+		}
+		if utf8.RuneCountInString(req.Title) > maxTitleLen {
+			http.Error(w, fmt.Sprintf("Title must be at most %d characters", maxTitleLen), http.StatusBadRequest)
+			return
+		}
+		if utf8.RuneCountInString(req.Body) > maxBodyLen {
+			http.Error(w, fmt.Sprintf("Body must be at most %d characters", maxBodyLen), http.StatusBadRequest)
+			return
+		}
+
+		parties, ok := connectionParties(w, r, db, userID)
+		if !ok {
+			return
+		}
+		if !parties.funded {
+			http.Error(w, "Only funded connections can share a success story", http.StatusConflict)
+			return
+		}
+
+		isProvider := userID == parties.providerID
+		_, err = db.Exec(UpsertStoryQuery, parties.connectionID, parties.providerID, parties.recipientID,
+			userID, req.Title, req.Body, isProvider)
+		if err != nil {
+			log.Printf("Error saving story of connection %d: %v", parties.connectionID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		story, err := scanStory(db.QueryRow(SelectStoryQuery, parties.connectionID))
+		if err != nil {
+			log.Printf("Error loading story of connection %d: %v", parties.connectionID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		notifications.Notify(db, parties.other(userID), NotificationApprovalRequested,
+			fmt.Sprintf("Please review and approve the success story \"%s\" before it is published", story.Title))
+
+		json.NewEncoder(w).Encode(story)
+	}
+}
+
+// ApproveStoryHandler records the caller's approval of a draft story. Once both
+// sides approved, the story waits for admin review.
+// Used by: /api/connections/{id}/story/approve
+// Response: Story
+func ApproveStoryHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		parties, ok := connectionParties(w, r, db, userID)
+		if !ok {
+			return
+		}
+
+		_, err = db.Exec(ApproveStoryQuery, parties.connectionID, userID == parties.providerID)
+		if err != nil {
+			log.Printf("Error approving story of connection %d: %v", parties.connectionID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		// No draft to approve means the story is missing or already past approval
+		story, err := scanStory(db.QueryRow(SelectStoryQuery, parties.connectionID))
+		if err == sql.ErrNoRows {
+			http.Error(w, "Story not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error loading story of connection %d: %v", parties.connectionID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(story)
+	}
+}
+
+// DeleteStoryHandler lets either side withdraw the success story, also taking
+// it down when published
+// Used by: /api/connections/{id}/story
+// Response: 204 No Content
+func DeleteStoryHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		parties, ok := connectionParties(w, r, db, userID)
+		if !ok {
+			return
+		}
+
+		result, err := db.Exec(DeleteStoryQuery, parties.connectionID)
+		if err != nil {
+			log.Printf("Error deleting story of connection %d: %v", parties.connectionID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			http.Error(w, "Story not found", http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// ListStoriesHandler lists success stories, those awaiting review by default
+// Used by: /api/admin/stories?status=
+// Response: []Story
+func ListStoriesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		status := r.URL.Query().Get("status")
+		if status == "" {
+			status = StatusPendingReview
+		}
+
+		rows, err := db.Query(SelectStoriesQuery, status)
+		if err != nil {
+			log.Printf("Error querying success stories: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		stories := []Story{}
+		for rows.Next() {
+			story, err := scanStory(rows)
+			if err != nil {
+				log.Printf("Error scanning success story: %v", err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+			stories = append(stories, *story)
+		}
+
+		if err = rows.Err(); err != nil {
+			log.Printf("Error iterating success stories: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(stories)
+	}
+}
+
+// ReviewStoryHandler publishes or rejects a story both sides approved, and
+// notifies both sides
+// Used by: /api/admin/stories/{id}/review
+// Response: Story
+func ReviewStoryHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		adminID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		storyID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid story ID", http.StatusBadRequest)
+			return
+		}
+
+		var req ReviewRequest
+		if !httputil.DecodeJSON(w, r, &req) {
+			return
+		}
+		req.Note = strings.TrimSpace(req.Note)
+		if utf8.RuneCountInString(req.Note) > maxNoteLen {
+			http.Error(w, fmt.Sprintf("Note must be at most %d characters", maxNoteLen), http.StatusBadRequest)
+			return
+		}
+
+		status := StatusRejected
+		if req.Approve {
+			status = StatusPublished
+		}
+
+		var providerID, recipientID int
+		err = db.QueryRow(ReviewStoryQuery, storyID, status, req.Note, adminID).Scan(&providerID, &recipientID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Story awaiting review not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error reviewing story %d: %v", storyID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		story, err := scanStory(db.QueryRow(SelectStoryByIDQuery, storyID))
+		if err != nil {
+			log.Printf("Error loading story %d: %v", storyID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		notificationType, content := NotificationPublished, fmt.Sprintf("Your success story \"%s\" is now public", story.Title)
+		if !req.Approve {
+			notificationType, content = NotificationRejected, fmt.Sprintf("Your success story \"%s\" was not approved for publication", story.Title)
+			if req.Note != "" {
+				content += ": " + req.Note
+			}
+		}
+		notifications.Notify(db, providerID, notificationType, content)
+		notifications.Notify(db, recipientID, notificationType, content)
+
+		json.NewEncoder(w).Encode(story)
+	}
+}
+
+// parties are the two sides of a connection
+type parties struct {
+	connectionID int
+	providerID   int
+	recipientID  int
+	funded       bool
+}
+
+// other returns the side of the connection that is not userID
+func (p parties) other(userID int) int {
+	if userID == p.providerID {
+		return p.recipientID
+	}
+	return p.providerID
+}
+
+// connectionParties loads the sides of a connection the user is part of,
+// writing the error response when there is no such connection
+func connectionParties(w http.ResponseWriter, r *http.Request, db *sql.DB, userID int) (parties, bool) {
+	p := parties{}
+	connectionID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid connection ID", http.StatusBadRequest)
+		return p, false
+	}
+	p.connectionID = connectionID
+
+	var fundedAt *time.Time
+	err = db.QueryRow(SelectConnectionQuery, connectionID, userID).Scan(&p.providerID, &p.recipientID, &fundedAt)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Connection not found", http.StatusNotFound)
+		return p, false
+	} else if err != nil {
+		log.Printf("Error loading connection %d: %v", connectionID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return p, false
+	}
+	p.funded = fundedAt != nil
+	return p, true
+}
+
+// scanStory reads a row selected with storyColumns
+func scanStory(row interface{ Scan(...interface{}) error }) (*Story, error) {
+	var s Story
+	err := row.Scan(&s.ID, &s.ConnectionID, &s.AuthorID,
+		&s.ProviderID, &s.ProviderName, &s.RecipientID, &s.RecipientName,
+		&s.Title, &s.Body, &s.Status, &s.ProviderApproved, &s.RecipientApproved,
+		&s.ReviewNote, &s.ReviewedAt, &s.PublishedAt, &s.CreatedAt, &s.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
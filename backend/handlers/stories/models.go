@@ -0,0 +1,68 @@
+package stories
+
+import "time"
+
+// Story statuses. A story is a draft until both sides of the connection have
+// approved its current text, then waits for admin review before it is published.
+const (
+	StatusDraft         = "draft"
+	StatusPendingReview = "pending_review"
+	StatusPublished     = "published"
+	StatusRejected      = "rejected"
+)
+
+// Story is the success story of a funded connection as seen by its two sides
+// and by admins
+type Story struct {
+	ID                int        `json:"id"`
+	ConnectionID      int        `json:"connection_id"`
+	AuthorID          int        `json:"author_id"`
+	ProviderID        int        `json:"provider_id"`
+	ProviderName      string     `json:"provider_name"`
+	RecipientID       int        `json:"recipient_id"`
+	RecipientName     string     `json:"recipient_name"`
+	Title             string     `json:"title"`
+	Body              string     `json:"body"`
+	Status            string     `json:"status"`
+	ProviderApproved  bool       `json:"provider_approved"`
+	RecipientApproved bool       `json:"recipient_approved"`
+	ReviewNote        *string    `json:"review_note"`
+	ReviewedAt        *time.Time `json:"reviewed_at"`
+	PublishedAt       *time.Time `json:"published_at"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+}
+
+// StoryRequest writes or rewrites a connection's story
+type StoryRequest struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+// ReviewRequest publishes or rejects a story awaiting review
+type ReviewRequest struct {
+	Approve bool   `json:"approve"`
+	Note    string `json:"note"`
+}
+
+// PublicStory is a published success story shown to anonymous visitors
+type PublicStory struct {
+	ID                 int       `json:"id"`
+	Title              string    `json:"title"`
+	Body               string    `json:"body"`
+	ProviderID         int       `json:"provider_id"`
+	ProviderName       string    `json:"provider_name"`
+	ProviderPictureURL *string   `json:"provider_picture_url"`
+	RecipientID        int       `json:"recipient_id"`
+	RecipientName      string    `json:"recipient_name"`
+	FundedAt           time.Time `json:"funded_at"`
+	PublishedAt        time.Time `json:"published_at"`
+}
+
+// PublicStoriesResponse is one page of published success stories
+type PublicStoriesResponse struct {
+	Stories  []PublicStory `json:"stories"`
+	Page     int           `json:"page"`
+	PageSize int           `json:"page_size"`
+	Total    int           `json:"total"`
+}
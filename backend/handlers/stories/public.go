@@ -0,0 +1,124 @@
+package stories
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultPageSize = 12
+	maxPageSize     = 50
+)
+
+// ListPublicStoriesHandler returns a page of published success stories, newest
+// first. No authentication is required.
+// Used by: /api/public/stories?page=&page_size=
+// Response: PublicStoriesResponse
+func ListPublicStoriesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		page, err := positiveIntParam(r, "page", 1)
+		if err != nil {
+			http.Error(w, "page must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		pageSize, err := positiveIntParam(r, "page_size", defaultPageSize)
+		if err != nil {
+			http.Error(w, "page_size must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		pageSize = min(pageSize, maxPageSize)
+
+		response := PublicStoriesResponse{Stories: []PublicStory{}, Page: page, PageSize: pageSize}
+		if err := db.QueryRow(CountPublishedStoriesQuery).Scan(&response.Total); err != nil {
+			log.Printf("Error counting success stories: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		rows, err := db.Query(SelectPublishedStoriesQuery, pageSize, (page-1)*pageSize)
+		if err != nil {
+			log.Printf("Error querying success stories: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			story, err := scanPublicStory(rows)
+			if err != nil {
+				log.Printf("Error scanning success story: %v", err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+			response.Stories = append(response.Stories, *story)
+		}
+		if err := rows.Err(); err != nil {
+			log.Printf("Error iterating success stories: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// GetPublicStoryHandler returns one published success story
+// Used by: /api/public/stories/{id}
+// Response: PublicStory
+func GetPublicStoryHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid story ID", http.StatusBadRequest)
+			return
+		}
+
+		story, err := scanPublicStory(db.QueryRow(SelectPublishedStoryQuery, id))
+		if err == sql.ErrNoRows {
+			http.Error(w, "Story not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error fetching success story %d: %v", id, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		json.NewEncoder(w).Encode(story)
+	}
+}
+
+// scanPublicStory reads a row selected with publicStoryColumns
+func scanPublicStory(row interface{ Scan(...interface{}) error }) (*PublicStory, error) {
+	var s PublicStory
+	err := row.Scan(&s.ID, &s.Title, &s.Body,
+		&s.ProviderID, &s.ProviderName, &s.ProviderPictureURL,
+		&s.RecipientID, &s.RecipientName, &s.FundedAt, &s.PublishedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// positiveIntParam reads a positive integer query parameter, or fallback when absent
+func positiveIntParam(r *http.Request, name string, fallback int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return 0, strconv.ErrSyntax
+	}
+	return n, nil
+}
@@ -0,0 +1,131 @@
+package stories
+
+import "matcherator/backend/services/matches"
+
+// storyColumns are the columns read by scanStory
+const storyColumns = `
+		SELECT s.id, s.connection_id, s.author_id,
+			s.provider_id, COALESCE(pp.organization_name, ''),
+			s.recipient_id, COALESCE(rp.organization_name, ''),
+			s.title, s.body, s.status,
+			s.provider_approved_at IS NOT NULL, s.recipient_approved_at IS NOT NULL,
+			s.review_note, s.reviewed_at, s.published_at, s.created_at, s.updated_at
+		FROM success_stories s
+		LEFT JOIN profiles pp ON pp.user_id = s.provider_id
+		LEFT JOIN profiles rp ON rp.user_id = s.recipient_id
+`
+
+// publishedStoriesFilter selects published stories of connections that are
+// still marked funded, between organizations that are still active
+const publishedStoriesFilter = `
+		FROM success_stories s
+		JOIN connections c ON c.id = s.connection_id
+		JOIN users pu ON pu.id = s.provider_id
+		JOIN users ru ON ru.id = s.recipient_id
+		LEFT JOIN profiles pp ON pp.user_id = s.provider_id
+		LEFT JOIN profiles rp ON rp.user_id = s.recipient_id
+		WHERE s.status = 'published'
+			AND c.funded_at IS NOT NULL
+			AND pu.deactivated_at IS NULL
+			AND ru.deactivated_at IS NULL
+`
+
+const (
+	// SelectConnectionQuery returns the provider and recipient of a connection
+	// the user is part of, and when it was marked funded
+	SelectConnectionQuery = `
+		SELECT pu.id, ru.id, c.funded_at
+		FROM connections c` + matches.ConnectionPartiesSQL + `
+		WHERE c.id = $1 AND $2 IN (c.initiator_id, c.target_id)
+	`
+
+	// SelectStoryQuery returns the story of a connection
+	SelectStoryQuery = storyColumns + `
+		WHERE s.connection_id = $1
+	`
+
+	// SelectStoryByIDQuery returns one story
+	SelectStoryByIDQuery = storyColumns + `
+		WHERE s.id = $1
+	`
+
+	// SelectStoriesQuery lists stories with a given status, oldest first
+	SelectStoriesQuery = storyColumns + `
+		WHERE s.status = $1
+		ORDER BY s.updated_at, s.id
+	`
+
+	// UpsertStoryQuery writes a connection's story. Any change puts it back to
+	// draft, approved only by the author ($7 says whether that is the provider).
+	UpsertStoryQuery = `
+		INSERT INTO success_stories (connection_id, provider_id, recipient_id, author_id, title, body,
+			provider_approved_at, recipient_approved_at)
+		VALUES ($1, $2, $3, $4, $5, $6,
+			CASE WHEN $7 THEN CURRENT_TIMESTAMP END, CASE WHEN NOT $7 THEN CURRENT_TIMESTAMP END)
+		ON CONFLICT (connection_id) DO UPDATE
+		SET author_id = EXCLUDED.author_id,
+			title = EXCLUDED.title,
+			body = EXCLUDED.body,
+			status = 'draft',
+			provider_approved_at = EXCLUDED.provider_approved_at,
+			recipient_approved_at = EXCLUDED.recipient_approved_at,
+			review_note = NULL,
+			reviewed_by = NULL,
+			reviewed_at = NULL,
+			published_at = NULL,
+			updated_at = CURRENT_TIMESTAMP
+	`
+
+	// ApproveStoryQuery records one side's approval of a draft ($2 says whether
+	// it is the provider) and sends it to review once both sides approved
+	ApproveStoryQuery = `
+		UPDATE success_stories
+		SET provider_approved_at = CASE WHEN $2 THEN COALESCE(provider_approved_at, CURRENT_TIMESTAMP) ELSE provider_approved_at END,
+			recipient_approved_at = CASE WHEN NOT $2 THEN COALESCE(recipient_approved_at, CURRENT_TIMESTAMP) ELSE recipient_approved_at END,
+			status = CASE
+				WHEN ($2 OR provider_approved_at IS NOT NULL) AND (NOT $2 OR recipient_approved_at IS NOT NULL)
+				THEN 'pending_review' ELSE status END
+		WHERE connection_id = $1 AND status = 'draft'
+	`
+
+	// DeleteStoryQuery removes a connection's story
+	DeleteStoryQuery = `
+		DELETE FROM success_stories WHERE connection_id = $1
+	`
+
+	// ReviewStoryQuery publishes or rejects a story awaiting review and returns
+	// both sides
+	ReviewStoryQuery = `
+		UPDATE success_stories
+		SET status = $2,
+			review_note = NULLIF($3, ''),
+			reviewed_by = $4,
+			reviewed_at = CURRENT_TIMESTAMP,
+			published_at = CASE WHEN $2 = 'published' THEN CURRENT_TIMESTAMP END
+		WHERE id = $1 AND status = 'pending_review'
+		RETURNING provider_id, recipient_id
+	`
+
+	// CountPublishedStoriesQuery counts the publicly shown stories
+	CountPublishedStoriesQuery = `SELECT COUNT(*)` + publishedStoriesFilter
+
+	// publicStoryColumns are the columns read by scanPublicStory
+	publicStoryColumns = `
+		SELECT s.id, s.title, s.body,
+			s.provider_id, COALESCE(pp.organization_name, ''), pp.profile_picture_url,
+			s.recipient_id, COALESCE(rp.organization_name, ''),
+			c.funded_at, s.published_at
+	`
+
+	// SelectPublishedStoriesQuery pages through the publicly shown stories,
+	// newest first
+	SelectPublishedStoriesQuery = publicStoryColumns + publishedStoriesFilter + `
+		ORDER BY s.published_at DESC, s.id DESC
+		LIMIT $1 OFFSET $2
+	`
+
+	// SelectPublishedStoryQuery fetches one publicly shown story
+	SelectPublishedStoryQuery = publicStoryColumns + publishedStoriesFilter + `
+			AND s.id = $1
+	`
+)
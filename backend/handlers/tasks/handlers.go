@@ -0,0 +1,328 @@
+package tasks
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"matcherator/backend/handlers/auth"
+	"matcherator/backend/handlers/httputil"
+	"matcherator/backend/handlers/notifications"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// maxOpenTasks caps the open tasks on a single connection
+	maxOpenTasks = 100
+	maxTitleLen  = 200
+	maxNotesLen  = 2000
+)
+
+// Notification types sent about tasks
+const (
+	NotificationCreated   = "task_created"
+	NotificationCompleted = "task_completed"
+	NotificationReminder  = "task_reminder"
+)
+
+// GetTasksHandler lists a connection's shared tasks for either side. Pass
+// ?status=open or ?status=completed to filter.
+// Used by: /api/connections/{id}/tasks
+// Response: TasksResponse
+func GetTasksHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		connectionID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid connection ID", http.StatusBadRequest)
+			return
+		}
+
+		status := r.URL.Query().Get("status")
+		if status != "" && status != "open" && status != "completed" {
+			http.Error(w, "Status must be open or completed", http.StatusBadRequest)
+			return
+		}
+
+		if _, ok := otherSide(w, db, connectionID, userID); !ok {
+			return
+		}
+
+		rows, err := db.Query(SelectTasksQuery, connectionID, status)
+		if err != nil {
+			log.Printf("Error querying tasks for connection %d: %v", connectionID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		response := TasksResponse{ConnectionID: connectionID, Tasks: []Task{}}
+		now := time.Now()
+		for rows.Next() {
+			task, err := scanTask(rows, now)
+			if err != nil {
+				log.Printf("Error scanning task: %v", err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+			if task.CompletedAt == nil {
+				response.Open++
+			}
+			if task.Overdue {
+				response.Overdue++
+			}
+			response.Tasks = append(response.Tasks, task)
+		}
+
+		if err = rows.Err(); err != nil {
+			log.Printf("Error iterating tasks: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// CreateTaskHandler adds a shared task to a connection and notifies the other side
+// Used by: /api/connections/{id}/tasks
+// Response: Task
+func CreateTaskHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		connectionID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid connection ID", http.StatusBadRequest)
+			return
+		}
+
+		var req CreateTaskRequest
+		if !httputil.DecodeJSON(w, r, &req) {
+			return
+		}
+
+		// Titles are single-line; they also make up reminder email subjects
+		req.Title = strings.Join(strings.Fields(req.Title), " ")
+		req.Notes = strings.TrimSpace(req.Notes)
+		if req.Title == "" {
+			http.Error(w, "Title is required", http.StatusBadRequest)
+			return
+		}
+		if utf8.RuneCountInString(req.Title) > maxTitleLen {
+			http.Error(w, fmt.Sprintf("Title must be at most %d characters", maxTitleLen), http.StatusBadRequest)
+			return
+		}
+		if utf8.RuneCountInString(req.Notes) > maxNotesLen {
+			http.Error(w, fmt.Sprintf("Notes must be at most %d characters", maxNotesLen), http.StatusBadRequest)
+			return
+		}
+		if req.DueAt.IsZero() {
+			http.Error(w, "Due date is required", http.StatusBadRequest)
+			return
+		}
+		if !req.DueAt.After(time.Now()) {
+			http.Error(w, "Due date must be in the future", http.StatusBadRequest)
+			return
+		}
+
+		otherID, ok := otherSide(w, db, connectionID, userID)
+		if !ok {
+			return
+		}
+		if req.AssigneeID != nil && *req.AssigneeID != userID && *req.AssigneeID != otherID {
+			http.Error(w, "Assignee must be one of the connected organizations", http.StatusBadRequest)
+			return
+		}
+
+		var open int
+		if err := db.QueryRow(CountOpenTasksQuery, connectionID).Scan(&open); err != nil {
+			log.Printf("Error counting tasks for connection %d: %v", connectionID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if open >= maxOpenTasks {
+			http.Error(w, fmt.Sprintf("A connection can have at most %d open tasks", maxOpenTasks), http.StatusConflict)
+			return
+		}
+
+		task, err := scanTask(db.QueryRow(InsertTaskQuery, connectionID, userID, req.AssigneeID, req.Title, req.Notes, req.DueAt), time.Now())
+		if err != nil {
+			log.Printf("Error creating task for connection %d: %v", connectionID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		notifications.Notify(db, otherID, NotificationCreated, fmt.Sprintf("New shared task: \"%s\", due %s", task.Title, task.DueAt.UTC().Format("Jan 2, 2006")))
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(task)
+	}
+}
+
+// CompleteTaskHandler marks a shared task done and notifies the other side
+// Used by: /api/connections/{id}/tasks/{taskId}/complete
+// Response: Task
+func CompleteTaskHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		connectionID, taskID, ok := taskVars(w, r)
+		if !ok {
+			return
+		}
+
+		otherID, ok := otherSide(w, db, connectionID, userID)
+		if !ok {
+			return
+		}
+
+		now := time.Now()
+		task, err := scanTask(db.QueryRow(CompleteTaskQuery, taskID, connectionID, userID), now)
+		if err == sql.ErrNoRows {
+			// Either there is no such task or it was already completed
+			task, err = scanTask(db.QueryRow(SelectTaskQuery, taskID, connectionID), now)
+			if err == sql.ErrNoRows {
+				http.Error(w, "Task not found", http.StatusNotFound)
+				return
+			} else if err != nil {
+				log.Printf("Error loading task %d: %v", taskID, err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+			json.NewEncoder(w).Encode(task)
+			return
+		} else if err != nil {
+			log.Printf("Error completing task %d: %v", taskID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		notifications.Notify(db, otherID, NotificationCompleted, fmt.Sprintf("Shared task completed: \"%s\"", task.Title))
+
+		json.NewEncoder(w).Encode(task)
+	}
+}
+
+// DeleteTaskHandler lets the creator of a task remove it
+// Used by: /api/connections/{id}/tasks/{taskId}
+// Response: 204 No Content
+func DeleteTaskHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		connectionID, taskID, ok := taskVars(w, r)
+		if !ok {
+			return
+		}
+
+		if _, ok := otherSide(w, db, connectionID, userID); !ok {
+			return
+		}
+
+		result, err := db.Exec(DeleteTaskQuery, taskID, connectionID, userID)
+		if err != nil {
+			log.Printf("Error deleting task %d: %v", taskID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			http.Error(w, "Task not found", http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// otherSide returns the other side of a connection the user is part of,
+// writing the error response when there is no such connection
+func otherSide(w http.ResponseWriter, db *sql.DB, connectionID, userID int) (int, bool) {
+	var initiatorID, targetID int
+	err := db.QueryRow(SelectConnectionSidesQuery, connectionID, userID).Scan(&initiatorID, &targetID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Connection not found", http.StatusNotFound)
+		return 0, false
+	} else if err != nil {
+		log.Printf("Error loading connection %d: %v", connectionID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return 0, false
+	}
+	if initiatorID == userID {
+		return targetID, true
+	}
+	return initiatorID, true
+}
+
+// taskVars parses the connection and task IDs from the route
+func taskVars(w http.ResponseWriter, r *http.Request) (connectionID, taskID int, ok bool) {
+	vars := mux.Vars(r)
+	connectionID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid connection ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	taskID, err = strconv.Atoi(vars["taskId"])
+	if err != nil {
+		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	return connectionID, taskID, true
+}
+
+// scanTask reads a row selected with taskColumns
+func scanTask(row interface{ Scan(...interface{}) error }, now time.Time) (Task, error) {
+	var task Task
+	var assigneeID, completedBy sql.NullInt64
+	var completedAt sql.NullTime
+	err := row.Scan(&task.ID, &task.ConnectionID, &task.CreatedBy, &assigneeID, &task.Title, &task.Notes,
+		&task.DueAt, &completedAt, &completedBy, &task.CreatedAt)
+	if err != nil {
+		return task, err
+	}
+	if assigneeID.Valid {
+		id := int(assigneeID.Int64)
+		task.AssigneeID = &id
+	}
+	if completedAt.Valid {
+		task.CompletedAt = &completedAt.Time
+	}
+	if completedBy.Valid {
+		id := int(completedBy.Int64)
+		task.CompletedBy = &id
+	}
+	task.Overdue = task.CompletedAt == nil && task.DueAt.Before(now)
+	return task, nil
+}
@@ -0,0 +1,35 @@
+package tasks
+
+import "time"
+
+// Task is a follow-up shared between the two sides of a connection
+type Task struct {
+	ID           int        `json:"id"`
+	ConnectionID int        `json:"connection_id"`
+	CreatedBy    int        `json:"created_by"`
+	AssigneeID   *int       `json:"assignee_id"`
+	Title        string     `json:"title"`
+	Notes        string     `json:"notes"`
+	DueAt        time.Time  `json:"due_at"`
+	CompletedAt  *time.Time `json:"completed_at"`
+	CompletedBy  *int       `json:"completed_by"`
+	Overdue      bool       `json:"overdue"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// CreateTaskRequest adds a task to a connection. The assignee, when set, must
+// be one of the two sides; otherwise the task is shared by both.
+type CreateTaskRequest struct {
+	Title      string    `json:"title"`
+	Notes      string    `json:"notes"`
+	DueAt      time.Time `json:"due_at"`
+	AssigneeID *int      `json:"assignee_id"`
+}
+
+// TasksResponse lists a connection's tasks
+type TasksResponse struct {
+	ConnectionID int    `json:"connection_id"`
+	Tasks        []Task `json:"tasks"`
+	Open         int    `json:"open"`
+	Overdue      int    `json:"overdue"`
+}
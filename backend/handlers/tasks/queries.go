@@ -0,0 +1,76 @@
+package tasks
+
+const taskColumns = `id, connection_id, created_by, assignee_id, title, COALESCE(notes, ''), due_at, completed_at, completed_by, created_at`
+
+const (
+	// SelectConnectionSidesQuery returns both sides of a connection the user is part of
+	SelectConnectionSidesQuery = `
+		SELECT initiator_id, target_id
+		FROM connections
+		WHERE id = $1 AND $2 IN (initiator_id, target_id)
+	`
+
+	// SelectTasksQuery lists a connection's tasks, open ones first by due date,
+	// optionally only open ($2 = 'open') or completed ($2 = 'completed') ones
+	SelectTasksQuery = `
+		SELECT ` + taskColumns + `
+		FROM shared_tasks
+		WHERE connection_id = $1
+			AND ($2 = '' OR ($2 = 'open') = (completed_at IS NULL))
+		ORDER BY completed_at IS NOT NULL, due_at, id
+	`
+
+	// CountOpenTasksQuery counts a connection's open tasks, capped by the handler
+	CountOpenTasksQuery = `
+		SELECT COUNT(*) FROM shared_tasks WHERE connection_id = $1 AND completed_at IS NULL
+	`
+
+	// InsertTaskQuery creates a task
+	InsertTaskQuery = `
+		INSERT INTO shared_tasks (connection_id, created_by, assignee_id, title, notes, due_at)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6)
+		RETURNING ` + taskColumns + `
+	`
+
+	// CompleteTaskQuery marks an open task done
+	CompleteTaskQuery = `
+		UPDATE shared_tasks
+		SET completed_at = CURRENT_TIMESTAMP, completed_by = $3, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND connection_id = $2 AND completed_at IS NULL
+		RETURNING ` + taskColumns + `
+	`
+
+	// SelectTaskQuery returns one of a connection's tasks
+	SelectTaskQuery = `
+		SELECT ` + taskColumns + `
+		FROM shared_tasks
+		WHERE id = $1 AND connection_id = $2
+	`
+
+	// DeleteTaskQuery removes a task its creator no longer needs
+	DeleteTaskQuery = `
+		DELETE FROM shared_tasks
+		WHERE id = $1 AND connection_id = $2 AND created_by = $3
+	`
+
+	// ClaimDueRemindersQuery marks open tasks due within the lead time as
+	// reminded and returns who to remind: the assignee, or both sides of the
+	// connection for shared tasks. Claiming in one statement keeps several
+	// backend instances from reminding twice.
+	ClaimDueRemindersQuery = `
+		WITH due AS (
+			UPDATE shared_tasks
+			SET reminded_at = CURRENT_TIMESTAMP
+			WHERE completed_at IS NULL
+				AND reminded_at IS NULL
+				AND due_at <= CURRENT_TIMESTAMP + $1 * INTERVAL '1 second'
+			RETURNING id, connection_id, assignee_id, title, due_at
+		)
+		SELECT d.id, d.title, d.due_at, u.id, u.email
+		FROM due d
+		JOIN connections c ON c.id = d.connection_id
+		JOIN users u ON u.id IN (c.initiator_id, c.target_id)
+			AND (d.assignee_id IS NULL OR u.id = d.assignee_id)
+		WHERE u.deactivated_at IS NULL
+	`
+)
@@ -0,0 +1,64 @@
+package tasks
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"matcherator/backend/handlers/notifications"
+)
+
+const (
+	// DefaultReminderInterval is how often due tasks are checked for
+	DefaultReminderInterval = 15 * time.Minute
+	// DefaultReminderLead is how long before a task is due its reminder goes out
+	DefaultReminderLead = 24 * time.Hour
+)
+
+// StartReminders sends one reminder for each open task once it is due within
+// TASK_REMINDER_LEAD (Go duration, default 24h), checking every
+// TASK_REMINDER_INTERVAL (default 15m) until ctx is done. Tasks created inside
+// the lead time are reminded on the next check.
+func StartReminders(ctx context.Context, db *sql.DB) {
+	lead := notifications.DurationFromEnv("TASK_REMINDER_LEAD", DefaultReminderLead)
+	notifications.Reminders{
+		Name:     "task",
+		Interval: notifications.DurationFromEnv("TASK_REMINDER_INTERVAL", DefaultReminderInterval),
+		Claim: func(db *sql.DB) (*sql.Rows, error) {
+			return db.Query(ClaimDueRemindersQuery, int64(lead/time.Second))
+		},
+		Message: reminderMessage,
+	}.Start(ctx, db)
+}
+
+// reminderMessage reminds whoever a claimed task is for that it is due
+func reminderMessage(rows *sql.Rows) (notifications.Reminder, error) {
+	var taskID, userID int
+	var title, email string
+	var dueAt time.Time
+	if err := rows.Scan(&taskID, &title, &dueAt, &userID, &email); err != nil {
+		return notifications.Reminder{}, err
+	}
+
+	when := "is due " + dueAt.UTC().Format("Mon Jan 2, 2006 15:04 MST")
+	if dueAt.Before(time.Now()) {
+		when = "was due " + dueAt.UTC().Format("Mon Jan 2, 2006 15:04 MST")
+	}
+	link := strings.TrimRight(os.Getenv("FRONTEND_URL"), "/") + "/chats"
+	return notifications.Reminder{
+		UserID:  userID,
+		Email:   email,
+		Type:    NotificationReminder,
+		Content: fmt.Sprintf("Reminder: \"%s\" %s", title, when),
+		Subject: "Reminder: " + title,
+		Body: fmt.Sprintf(`This is a reminder that the shared task "%s" %s.
+
+You can review and complete it with your connection here:
+%s
+`, title, when, link),
+		About: fmt.Sprintf("task %d", taskID),
+	}, nil
+}
@@ -0,0 +1,216 @@
+package templates
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"matcherator/backend/handlers/auth"
+	"matcherator/backend/handlers/httputil"
+	"matcherator/backend/handlers/plans"
+	"matcherator/backend/services/entitlements"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	maxNameLen = 100
+	maxBodyLen = 5000
+)
+
+// GetTemplatesHandler lists the user's message templates
+// Used by: /api/me/message-templates
+// Response: []Template
+func GetTemplatesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		rows, err := db.Query(SelectTemplatesQuery, userID)
+		if err != nil {
+			log.Printf("Error querying templates for user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		templates := []Template{}
+		for rows.Next() {
+			template, err := scanTemplate(rows)
+			if err != nil {
+				log.Printf("Error scanning template: %v", err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+			templates = append(templates, *template)
+		}
+		if err := rows.Err(); err != nil {
+			log.Printf("Error iterating templates: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(templates)
+	}
+}
+
+// CreateTemplateHandler saves a message template, within the plan's limit
+// Used by: /api/me/message-templates
+// Response: Template
+func CreateTemplateHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		req, ok := decodeTemplate(w, r)
+		if !ok {
+			return
+		}
+
+		plan, err := entitlements.ForUser(db, userID)
+		if err != nil {
+			log.Printf("Error loading entitlements for user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		limit := plan.Limit(entitlements.QuotaMessageTemplates)
+		if limit == 0 {
+			plans.QuotaExceeded(w, "Message templates are not included in your plan")
+			return
+		}
+
+		template, err := scanTemplate(db.QueryRow(InsertTemplateQuery, userID, req.Name, req.Body, limit))
+		if err == sql.ErrNoRows {
+			plans.QuotaExceeded(w, fmt.Sprintf("Your plan allows %d message templates", limit))
+			return
+		} else if err != nil {
+			log.Printf("Error creating template for user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(template)
+	}
+}
+
+// UpdateTemplateHandler replaces one of the user's message templates
+// Used by: /api/me/message-templates/{id}
+// Response: Template
+func UpdateTemplateHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid template ID", http.StatusBadRequest)
+			return
+		}
+
+		req, ok := decodeTemplate(w, r)
+		if !ok {
+			return
+		}
+
+		template, err := scanTemplate(db.QueryRow(UpdateTemplateQuery, id, userID, req.Name, req.Body))
+		if err == sql.ErrNoRows {
+			http.Error(w, "Template not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error updating template %d: %v", id, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(template)
+	}
+}
+
+// DeleteTemplateHandler removes one of the user's message templates
+// Used by: /api/me/message-templates/{id}
+// Response: 204 No Content
+func DeleteTemplateHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid template ID", http.StatusBadRequest)
+			return
+		}
+
+		result, err := db.Exec(DeleteTemplateQuery, id, userID)
+		if err != nil {
+			log.Printf("Error deleting template %d: %v", id, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			http.Error(w, "Template not found", http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// scanTemplate reads a row selected with templateColumns
+func scanTemplate(row interface{ Scan(...interface{}) error }) (*Template, error) {
+	var template Template
+	if err := row.Scan(&template.ID, &template.Name, &template.Body, &template.CreatedAt, &template.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+// decodeTemplate decodes and validates a template, writing the error response
+// when it is rejected
+func decodeTemplate(w http.ResponseWriter, r *http.Request) (*TemplateRequest, bool) {
+	var req TemplateRequest
+	if !httputil.DecodeJSON(w, r, &req) {
+		return nil, false
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	req.Body = strings.TrimSpace(req.Body)
+	if req.Name == "" || req.Body == "" {
+		http.Error(w, "Name and body are required", http.StatusBadRequest)
+		return nil, false
+	}
+	if utf8.RuneCountInString(req.Name) > maxNameLen {
+		http.Error(w, fmt.Sprintf("Name must be at most %d characters", maxNameLen), http.StatusBadRequest)
+		return nil, false
+	}
+	if utf8.RuneCountInString(req.Body) > maxBodyLen {
+		http.Error(w, fmt.Sprintf("Body must be at most %d characters", maxBodyLen), http.StatusBadRequest)
+		return nil, false
+	}
+	return &req, true
+}
@@ -0,0 +1,18 @@
+package templates
+
+import "time"
+
+// Template is a saved message the user can reuse when writing to connections
+type Template struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TemplateRequest creates or replaces a template
+type TemplateRequest struct {
+	Name string `json:"name"`
+	Body string `json:"body"`
+}
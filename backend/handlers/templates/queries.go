@@ -0,0 +1,37 @@
+package templates
+
+const templateColumns = `id, name, body, created_at, updated_at`
+
+const (
+	// SelectTemplatesQuery lists the user's templates by name
+	SelectTemplatesQuery = `
+		SELECT ` + templateColumns + `
+		FROM message_templates
+		WHERE user_id = $1
+		ORDER BY LOWER(name), id
+	`
+
+	// InsertTemplateQuery saves a template unless the user already has $4,
+	// where a negative $4 means no limit
+	InsertTemplateQuery = `
+		INSERT INTO message_templates (user_id, name, body)
+		SELECT $1, $2, $3
+		FROM message_templates
+		WHERE user_id = $1
+		HAVING $4 < 0 OR COUNT(*) < $4
+		RETURNING ` + templateColumns + `
+	`
+
+	// UpdateTemplateQuery replaces one of the user's templates
+	UpdateTemplateQuery = `
+		UPDATE message_templates
+		SET name = $3, body = $4, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND user_id = $2
+		RETURNING ` + templateColumns + `
+	`
+
+	// DeleteTemplateQuery removes one of the user's templates
+	DeleteTemplateQuery = `
+		DELETE FROM message_templates WHERE id = $1 AND user_id = $2
+	`
+)
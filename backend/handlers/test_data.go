@@ -1,5 +1,6 @@
-// Note: To generate test data, use:
+// Note: To generate random test data, use:
 // curl -X POST "http://localhost:8080/api/test/generate-users?count=5" -H "Content-Type: application/json"
+// For reproducible demo data, load a fixture with cmd/seed instead.
 
 package handlers
 
@@ -10,6 +11,7 @@ import (
 	"log"
 	"matcherator/backend/handlers/auth"
 	"matcherator/backend/handlers/user_status"
+	"matcherator/backend/services/fieldcrypt"
 	"matcherator/backend/services/matches"
 	"net/http"
 	"strconv"
@@ -182,6 +184,20 @@ func GenerateTestDataHandler(db *sql.DB) http.HandlerFunc {
 				selectedTargetGroups[j] = targetGroups[gofakeit.Number(0, len(targetGroups)-1)]
 			}
 
+			// Encrypt sensitive fields at rest
+			ein, err := fieldcrypt.Encrypt(fmt.Sprintf("%d-%d", gofakeit.Number(10, 99), gofakeit.Number(1000, 9999)))
+			if err != nil {
+				log.Printf("Error encrypting EIN: %v", err)
+				tx.Exec(fmt.Sprintf("ROLLBACK TO SAVEPOINT user_%d", i))
+				continue
+			}
+			contactEmail, err := fieldcrypt.Encrypt(email)
+			if err != nil {
+				log.Printf("Error encrypting contact email: %v", err)
+				tx.Exec(fmt.Sprintf("ROLLBACK TO SAVEPOINT user_%d", i))
+				continue
+			}
+
 			// Create profile for the user
 			_, err = tx.Exec(`
 				INSERT INTO profiles (
@@ -201,14 +217,14 @@ func GenerateTestDataHandler(db *sql.DB) http.HandlerFunc {
 				states[gofakeit.Number(0, len(states)-1)],
 				gofakeit.City(),
 				gofakeit.Zip(),
-				fmt.Sprintf("%d-%d", gofakeit.Number(10, 99), gofakeit.Number(1000, 9999)),
+				ein,
 				languages[gofakeit.Number(0, len(languages)-1)],
 				applicantTypes[gofakeit.Number(0, len(applicantTypes)-1)],
 				pq.Array(selectedSectors),
 				pq.Array(selectedTargetGroups),
 				projectStages[gofakeit.Number(0, len(projectStages)-1)],
 				fmt.Sprintf("https://www.%s.org", gofakeit.DomainName()),
-				email,
+				contactEmail,
 				gofakeit.Bool())
 			if err != nil {
 				log.Printf("Error creating profile: %v", err)
@@ -274,10 +290,7 @@ func GenerateTestDataHandler(db *sql.DB) http.HandlerFunc {
 				continue
 			}
 
-			_, err = tx.Exec(`
-				INSERT INTO tokens (user_id, token, expires_at)
-				VALUES ($1, $2, $3)
-			`, userID, token, time.Now().Add(time.Hour*24))
+			_, err = auth.StoreSession(tx, userID, token, r)
 			if err != nil {
 				log.Printf("Error storing token: %v", err)
 				tx.Exec(fmt.Sprintf("ROLLBACK TO SAVEPOINT user_%d", i))
@@ -317,9 +330,10 @@ func GenerateTestDataHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		// Recalculate matches for all users
-		if err := matches.RecalculateMatchesForAllUsers(db); err != nil {
-			log.Printf("Error recalculating matches: %v", err)
+		// Recalculate matches for all users in the background
+		recalculationJobID, err := matches.EnqueueRecalculateAll(db)
+		if err != nil {
+			log.Printf("Error queueing match recalculation: %v", err)
 			// Don't return error here as the users were still created successfully
 		}
 
@@ -330,11 +344,15 @@ func GenerateTestDataHandler(db *sql.DB) http.HandlerFunc {
 			UsersCreated int    `json:"users_created"`
 			Providers    int    `json:"providers"`
 			Recipients   int    `json:"recipients"`
+
+			// Poll /api/admin/matching/jobs/{id} for the recalculation's progress
+			RecalculationJobID int64 `json:"recalculation_job_id,omitempty"`
 		}{
-			Message:      "Test user(s) generated successfully",
-			UsersCreated: createdProviders + createdRecipients,
-			Providers:    createdProviders,
-			Recipients:   createdRecipients,
+			Message:            "Test user(s) generated successfully",
+			UsersCreated:       createdProviders + createdRecipients,
+			Providers:          createdProviders,
+			Recipients:         createdRecipients,
+			RecalculationJobID: recalculationJobID,
 		}
 
 		if err := json.NewEncoder(w).Encode(response); err != nil {
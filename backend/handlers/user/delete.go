@@ -0,0 +1,75 @@
+package user
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+
+	"matcherator/backend/handlers/auth"
+	"matcherator/backend/handlers/httputil"
+	"matcherator/backend/services/accounts"
+	"matcherator/backend/services/billing"
+	"matcherator/backend/services/entitlements"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// DeleteAccountRequest confirms an account deletion with the current password
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+}
+
+// DeleteAccountHandler deletes the authenticated user's account. Connected
+// organizations keep their conversations, with the user's messages shown as
+// sent by a deleted organization.
+// Used by: DELETE /api/me
+// Response: 204 No Content
+func DeleteAccountHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req DeleteAccountRequest
+		if !httputil.DecodeJSON(w, r, &req) {
+			return
+		}
+
+		var hashedPassword string
+		if err := db.QueryRow("SELECT password_hash FROM users WHERE id = $1", userID).Scan(&hashedPassword); err != nil {
+			log.Printf("Error loading user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(req.Password)) != nil {
+			http.Error(w, "Incorrect password", http.StatusForbidden)
+			return
+		}
+
+		// Deleting the account would not stop Stripe from charging it
+		subscription, err := entitlements.LoadSubscription(db, userID)
+		if err != nil {
+			log.Printf("Error loading subscription of user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if subscription != nil && subscription.Provider == billing.ProviderStripe && subscription.Status != entitlements.StatusCanceled {
+			http.Error(w, "Cancel your subscription in the billing portal before deleting your account", http.StatusConflict)
+			return
+		}
+
+		if err := accounts.Delete(db, userID); err == sql.ErrNoRows {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error deleting account of user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("User %d deleted their account", userID)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -3,14 +3,23 @@ package user
 import (
 	"database/sql"
 	"encoding/json"
+	"log"
 	"net/http"
+	"strconv"
 
 	"matcherator/backend/handlers/auth"
+	"matcherator/backend/handlers/httputil"
+	"matcherator/backend/services/fieldcrypt"
 
 	"github.com/gorilla/mux"
 	"github.com/lib/pq"
 )
 
+const (
+	defaultUsersPageSize = 50
+	maxUsersPageSize     = 200
+)
+
 // GetUserHandler returns basic user information
 func GetUserHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -32,12 +41,7 @@ func GetUserHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		var user BasicUserResponse
-		err = db.QueryRow(SelectBasicUserQuery, userID).Scan(
-			&user.ID,
-			&user.OrganizationName,
-			&user.ProfilePictureURL,
-		)
+		row, err := loadBasicUser(db, userID)
 
 		if err == sql.ErrNoRows {
 			http.Error(w, "User not found", http.StatusNotFound)
@@ -47,7 +51,7 @@ func GetUserHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		json.NewEncoder(w).Encode(user)
+		json.NewEncoder(w).Encode(row.response())
 	}
 }
 
@@ -72,29 +76,7 @@ func GetFullUserHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		var user MatchingUser
-		err = db.QueryRow(SelectUserQuery, userID).Scan(
-			&user.Role,
-			&user.ID,
-			&user.Email,
-			&user.OrganizationName,
-			&user.ProfilePictureURL,
-			&user.MissionStatement,
-			&user.State,
-			&user.City,
-			&user.ZIPCode,
-			&user.EIN,
-			&user.Language,
-			&user.ApplicantType,
-			pq.Array(&user.Sectors),
-			pq.Array(&user.TargetGroups),
-			&user.ProjectStage,
-			&user.WebsiteURL,
-			&user.ContactEmail,
-			&user.ChatOptIn,
-			&user.Location,
-			&user.Description,
-		)
+		row, err := loadUser(db, userID)
 
 		if err == sql.ErrNoRows {
 			http.Error(w, "User not found", http.StatusNotFound)
@@ -103,38 +85,32 @@ func GetFullUserHandler(db *sql.DB) http.HandlerFunc {
 			http.Error(w, "Database error", http.StatusInternalServerError)
 			return
 		}
+		user := row.response()
+
+		if user.EIN, err = fieldcrypt.DecryptPtr(user.EIN); err == nil {
+			user.ContactEmail, err = fieldcrypt.Decrypt(user.ContactEmail)
+		}
+		if err != nil {
+			log.Printf("Error decrypting user %s: %v", userID, err)
+			http.Error(w, "Error reading user", http.StatusInternalServerError)
+			return
+		}
 
 		// Get additional profile data based on user role
 		if user.Role == "recipient" {
-			var recipientData RecipientData
-			err = db.QueryRow(SelectRecipientQuery, userID).Scan(
-				pq.Array(&recipientData.Needs),
-				&recipientData.BudgetRequested,
-				&recipientData.TeamSize,
-				&recipientData.Timeline,
-				&recipientData.PriorFunding,
-			)
+			recipient, err := loadRecipient(db, userID)
 			if err != nil && err != sql.ErrNoRows {
 				http.Error(w, "Database error", http.StatusInternalServerError)
 				return
 			}
-			user.Description = &recipientData.Timeline
+			user.Description = recipient.response().Timeline
 		} else if user.Role == "provider" {
-			var providerData ProviderData
-			err = db.QueryRow(SelectProviderQuery, userID).Scan(
-				&providerData.FundingType,
-				&providerData.AmountOffered,
-				&providerData.RegionScope,
-				&providerData.LocationNotes,
-				&providerData.EligibilityNotes,
-				&providerData.Deadline,
-				&providerData.ApplicationLink,
-			)
+			provider, err := loadProvider(db, userID)
 			if err != nil && err != sql.ErrNoRows {
 				http.Error(w, "Database error", http.StatusInternalServerError)
 				return
 			}
-			user.Description = &providerData.EligibilityNotes
+			user.Description = provider.response().EligibilityNotes
 		}
 
 		json.NewEncoder(w).Encode(user)
@@ -152,12 +128,7 @@ func GetMyBasicInfoHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		var user BasicUserResponse
-		err = db.QueryRow(SelectBasicUserQuery, userID).Scan(
-			&user.ID,
-			&user.OrganizationName,
-			&user.ProfilePictureURL,
-		)
+		row, err := loadBasicUser(db, strconv.Itoa(userID))
 
 		if err == sql.ErrNoRows {
 			http.Error(w, "User not found", http.StatusNotFound)
@@ -167,11 +138,13 @@ func GetMyBasicInfoHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		json.NewEncoder(w).Encode(user)
+		json.NewEncoder(w).Encode(row.response())
 	}
 }
 
-// GetUsersHandler returns a list of all users
+// GetUsersHandler returns a page of users by ID
+// Used by: /api/users?limit=&offset=
+// Response: UsersResponse
 func GetUsersHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -183,18 +156,26 @@ func GetUsersHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		rows, err := db.Query(`
-			SELECT id, email, role
-			FROM users
-			ORDER BY id
-		`)
+		limit, offset, ok := httputil.ParsePage(w, r, defaultUsersPageSize, maxUsersPageSize)
+		if !ok {
+			return
+		}
+
+		response := UsersResponse{Users: []User{}, Limit: limit, Offset: offset}
+		if err := db.QueryRow(CountUsersQuery).Scan(&response.Total); err != nil {
+			log.Printf("Error counting users: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		rows, err := db.Query(SelectUsersPageQuery, limit, offset)
 		if err != nil {
+			log.Printf("Error querying users: %v", err)
 			http.Error(w, "Database error", http.StatusInternalServerError)
 			return
 		}
 		defer rows.Close()
 
-		var users []User
 		for rows.Next() {
 			var user User
 			err := rows.Scan(&user.ID, &user.Email, &user.Role)
@@ -202,7 +183,7 @@ func GetUsersHandler(db *sql.DB) http.HandlerFunc {
 				http.Error(w, "Database error", http.StatusInternalServerError)
 				return
 			}
-			users = append(users, user)
+			response.Users = append(response.Users, user)
 		}
 
 		if err = rows.Err(); err != nil {
@@ -210,6 +191,79 @@ func GetUsersHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		json.NewEncoder(w).Encode(users)
+		json.NewEncoder(w).Encode(response)
 	}
 }
+
+// loadBasicUser returns a user's SelectBasicUserQuery row, sql.ErrNoRows when
+// there is none
+func loadBasicUser(db *sql.DB, userID string) (basicUserRow, error) {
+	var row basicUserRow
+	err := db.QueryRow(SelectBasicUserQuery, userID).Scan(
+		&row.ID,
+		&row.OrganizationName,
+		&row.ProfilePictureURL,
+	)
+	return row, err
+}
+
+// loadUser returns a user's SelectUserQuery row, sql.ErrNoRows when there is
+// none
+func loadUser(db *sql.DB, userID string) (matchingUserRow, error) {
+	var row matchingUserRow
+	err := db.QueryRow(SelectUserQuery, userID).Scan(
+		&row.Role,
+		&row.ID,
+		&row.Email,
+		&row.OrganizationName,
+		&row.ProfilePictureURL,
+		&row.MissionStatement,
+		&row.State,
+		&row.City,
+		&row.ZIPCode,
+		&row.EIN,
+		&row.Language,
+		&row.ApplicantType,
+		pq.Array(&row.Sectors),
+		pq.Array(&row.TargetGroups),
+		&row.ProjectStage,
+		&row.WebsiteURL,
+		&row.ContactEmail,
+		&row.ChatOptIn,
+		&row.AnnualBudget,
+		&row.StaffSize,
+		&row.FoundedYear,
+		&row.Location,
+	)
+	return row, err
+}
+
+// loadRecipient returns a user's recipient data, sql.ErrNoRows when they have
+// none
+func loadRecipient(db *sql.DB, userID string) (recipientRow, error) {
+	var row recipientRow
+	err := db.QueryRow(SelectRecipientQuery, userID).Scan(
+		pq.Array(&row.Needs),
+		&row.BudgetRequested,
+		&row.TeamSize,
+		&row.Timeline,
+		&row.PriorFunding,
+	)
+	return row, err
+}
+
+// loadProvider returns a user's provider data, sql.ErrNoRows when they have
+// none
+func loadProvider(db *sql.DB, userID string) (providerRow, error) {
+	var row providerRow
+	err := db.QueryRow(SelectProviderQuery, userID).Scan(
+		&row.FundingType,
+		&row.AmountOffered,
+		&row.RegionScope,
+		&row.LocationNotes,
+		&row.EligibilityNotes,
+		&row.Deadline,
+		&row.ApplicationLink,
+	)
+	return row, err
+}
@@ -1,6 +1,11 @@
 package user
 
-import "time"
+import (
+	"database/sql"
+	"time"
+
+	"matcherator/backend/handlers/httputil"
+)
 
 // BasicUserResponse represents basic user information
 type BasicUserResponse struct {
@@ -29,28 +34,41 @@ type MatchingUser struct {
 	WebsiteURL        *string  `json:"website_url,omitempty"`
 	ContactEmail      string   `json:"contact_email"`
 	ChatOptIn         bool     `json:"chat_opt_in"`
+	AnnualBudget      *float64 `json:"annual_budget,omitempty"`
+	StaffSize         *int     `json:"staff_size,omitempty"`
+	FoundedYear       *int     `json:"founded_year,omitempty"`
 	Location          *string  `json:"location,omitempty"`
 	Description       *string  `json:"description,omitempty"`
 }
 
-// RecipientData represents recipient-specific information
+// RecipientData represents recipient-specific information; columns left
+// blank on signup are nil
 type RecipientData struct {
 	Needs           []string `json:"needs"`
-	BudgetRequested float64  `json:"budget_requested"`
-	TeamSize        int      `json:"team_size"`
-	Timeline        string   `json:"timeline"`
+	BudgetRequested *float64 `json:"budget_requested"`
+	TeamSize        *int     `json:"team_size"`
+	Timeline        *string  `json:"timeline"`
 	PriorFunding    bool     `json:"prior_funding"`
 }
 
-// ProviderData represents provider-specific information
+// ProviderData represents provider-specific information; columns left blank
+// on signup are nil
 type ProviderData struct {
-	FundingType      string `json:"funding_type"`
-	AmountOffered    string `json:"amount_offered"`
-	RegionScope      string `json:"region_scope"`
-	LocationNotes    string `json:"location_notes"`
-	EligibilityNotes string `json:"eligibility_notes"`
-	Deadline         string `json:"deadline"`
-	ApplicationLink  string `json:"application_link"`
+	FundingType      *string `json:"funding_type"`
+	AmountOffered    *string `json:"amount_offered"`
+	RegionScope      *string `json:"region_scope"`
+	LocationNotes    *string `json:"location_notes"`
+	EligibilityNotes *string `json:"eligibility_notes"`
+	Deadline         *string `json:"deadline"`
+	ApplicationLink  *string `json:"application_link"`
+}
+
+// UsersResponse is one page of users
+type UsersResponse struct {
+	Users  []User `json:"users"`
+	Total  int    `json:"total"`
+	Limit  int    `json:"limit"`
+	Offset int    `json:"offset"`
 }
 
 // User represents the core user entity
@@ -68,3 +86,134 @@ type LoginResponse struct {
 	Email string `json:"email"`
 	Token string `json:"token"`
 }
+
+// RoleRequest switches a user's primary role, optionally keeping the other one
+// for matching too
+type RoleRequest struct {
+	Role     string `json:"role"`      // "provider" or "recipient"
+	DualRole bool   `json:"dual_role"` // also match in the opposite role
+}
+
+// RoleResponse is a user's roles after a switch
+type RoleResponse struct {
+	Role     string `json:"role"`
+	DualRole bool   `json:"dual_role"`
+}
+
+// basicUserRow is SelectBasicUserQuery as scanned, before it becomes a
+// BasicUserResponse; users without a profile have NULL profile columns
+type basicUserRow struct {
+	ID                int
+	OrganizationName  sql.NullString
+	ProfilePictureURL sql.NullString
+}
+
+func (row basicUserRow) response() BasicUserResponse {
+	return BasicUserResponse{
+		ID:                row.ID,
+		OrganizationName:  httputil.StringPtr(row.OrganizationName),
+		ProfilePictureURL: httputil.StringPtr(row.ProfilePictureURL),
+	}
+}
+
+// matchingUserRow is SelectUserQuery as scanned, before it becomes a
+// MatchingUser; every profile column may be NULL
+type matchingUserRow struct {
+	Role              string
+	ID                int
+	Email             string
+	OrganizationName  sql.NullString
+	ProfilePictureURL sql.NullString
+	MissionStatement  sql.NullString
+	State             sql.NullString
+	City              sql.NullString
+	ZIPCode           sql.NullString
+	EIN               sql.NullString
+	Language          sql.NullString
+	ApplicantType     sql.NullString
+	Sectors           []string
+	TargetGroups      []string
+	ProjectStage      sql.NullString
+	WebsiteURL        sql.NullString
+	ContactEmail      sql.NullString
+	ChatOptIn         sql.NullBool
+	AnnualBudget      sql.NullFloat64
+	StaffSize         sql.NullInt64
+	FoundedYear       sql.NullInt64
+	Location          sql.NullString
+}
+
+func (row matchingUserRow) response() MatchingUser {
+	return MatchingUser{
+		ID:                row.ID,
+		Role:              row.Role,
+		Email:             row.Email,
+		OrganizationName:  httputil.StringPtr(row.OrganizationName),
+		ProfilePictureURL: httputil.StringPtr(row.ProfilePictureURL),
+		MissionStatement:  httputil.StringPtr(row.MissionStatement),
+		State:             httputil.StringPtr(row.State),
+		City:              httputil.StringPtr(row.City),
+		ZIPCode:           httputil.StringPtr(row.ZIPCode),
+		EIN:               httputil.StringPtr(row.EIN),
+		Language:          httputil.StringPtr(row.Language),
+		ApplicantType:     httputil.StringPtr(row.ApplicantType),
+		Sectors:           row.Sectors,
+		TargetGroups:      row.TargetGroups,
+		ProjectStage:      httputil.StringPtr(row.ProjectStage),
+		WebsiteURL:        httputil.StringPtr(row.WebsiteURL),
+		ContactEmail:      row.ContactEmail.String,
+		ChatOptIn:         row.ChatOptIn.Bool,
+		AnnualBudget:      httputil.Float64Ptr(row.AnnualBudget),
+		StaffSize:         httputil.IntPtr(row.StaffSize),
+		FoundedYear:       httputil.IntPtr(row.FoundedYear),
+		Location:          httputil.StringPtr(row.Location),
+	}
+}
+
+// recipientRow is SelectRecipientQuery as scanned, before it becomes
+// RecipientData
+type recipientRow struct {
+	Needs           []string
+	BudgetRequested sql.NullFloat64
+	TeamSize        sql.NullInt64
+	Timeline        sql.NullString
+	PriorFunding    sql.NullBool
+}
+
+func (row recipientRow) response() RecipientData {
+	needs := row.Needs
+	if needs == nil {
+		needs = []string{}
+	}
+	return RecipientData{
+		Needs:           needs,
+		BudgetRequested: httputil.Float64Ptr(row.BudgetRequested),
+		TeamSize:        httputil.IntPtr(row.TeamSize),
+		Timeline:        httputil.StringPtr(row.Timeline),
+		PriorFunding:    row.PriorFunding.Bool,
+	}
+}
+
+// providerRow is SelectProviderQuery as scanned, before it becomes
+// ProviderData
+type providerRow struct {
+	FundingType      sql.NullString
+	AmountOffered    sql.NullString
+	RegionScope      sql.NullString
+	LocationNotes    sql.NullString
+	EligibilityNotes sql.NullString
+	Deadline         sql.NullString
+	ApplicationLink  sql.NullString
+}
+
+func (row providerRow) response() ProviderData {
+	return ProviderData{
+		FundingType:      httputil.StringPtr(row.FundingType),
+		AmountOffered:    httputil.StringPtr(row.AmountOffered),
+		RegionScope:      httputil.StringPtr(row.RegionScope),
+		LocationNotes:    httputil.StringPtr(row.LocationNotes),
+		EligibilityNotes: httputil.StringPtr(row.EligibilityNotes),
+		Deadline:         httputil.StringPtr(row.Deadline),
+		ApplicationLink:  httputil.StringPtr(row.ApplicationLink),
+	}
+}
@@ -0,0 +1,94 @@
+package user
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestMatchingUserRowNulls(t *testing.T) {
+	tests := []struct {
+		name string
+		row  matchingUserRow
+		want string
+	}{
+		{
+			name: "user without a profile",
+			row:  matchingUserRow{Role: "recipient", ID: 1, Email: "a@example.org"},
+			want: `{"id":1,"role":"recipient","email":"a@example.org","contact_email":"","chat_opt_in":false}`,
+		},
+		{
+			name: "partial profile",
+			row: matchingUserRow{
+				Role:             "provider",
+				ID:               2,
+				Email:            "b@example.org",
+				OrganizationName: sql.NullString{String: "Fund", Valid: true},
+				ContactEmail:     sql.NullString{String: "c@example.org", Valid: true},
+				ChatOptIn:        sql.NullBool{Bool: true, Valid: true},
+				StaffSize:        sql.NullInt64{Int64: 0, Valid: true},
+				AnnualBudget:     sql.NullFloat64{},
+			},
+			want: `{"id":2,"role":"provider","email":"b@example.org","organization_name":"Fund","contact_email":"c@example.org","chat_opt_in":true,"staff_size":0}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertJSON(t, tt.row.response(), tt.want)
+		})
+	}
+}
+
+func TestRoleDataRowNulls(t *testing.T) {
+	tests := []struct {
+		name     string
+		response interface{}
+		want     string
+	}{
+		{
+			name:     "empty recipient data",
+			response: recipientRow{}.response(),
+			want:     `{"needs":[],"budget_requested":null,"team_size":null,"timeline":null,"prior_funding":false}`,
+		},
+		{
+			name: "recipient data",
+			response: recipientRow{
+				Needs:           []string{"capital"},
+				BudgetRequested: sql.NullFloat64{Float64: 5000, Valid: true},
+				Timeline:        sql.NullString{String: "Q3", Valid: true},
+				PriorFunding:    sql.NullBool{Bool: true, Valid: true},
+			}.response(),
+			want: `{"needs":["capital"],"budget_requested":5000,"team_size":null,"timeline":"Q3","prior_funding":true}`,
+		},
+		{
+			name:     "empty provider data",
+			response: providerRow{}.response(),
+			want:     `{"funding_type":null,"amount_offered":null,"region_scope":null,"location_notes":null,"eligibility_notes":null,"deadline":null,"application_link":null}`,
+		},
+		{
+			name:     "basic user without a profile",
+			response: basicUserRow{ID: 3}.response(),
+			want:     `{"id":3,"organization_name":null,"profile_picture_url":null}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertJSON(t, tt.response, tt.want)
+		})
+	}
+}
+
+func assertJSON(t *testing.T, v interface{}, want string) {
+	t.Helper()
+	got, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if strings.Contains(string(got), `"Valid"`) {
+		t.Errorf("JSON leaks a sql.Null value: %s", got)
+	}
+	if string(got) != want {
+		t.Errorf("JSON = %s\nwant   %s", got, want)
+	}
+}
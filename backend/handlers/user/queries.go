@@ -26,18 +26,55 @@ const (
 			COALESCE(p.target_groups, '{}'),
 			p.project_stage,
 			p.website_url,
-			p.contact_email,
-			p.chat_opt_in,
-			p.location,
+			COALESCE(p.contact_email, ''),
+			COALESCE(p.chat_opt_in, false),
+			p.annual_budget,
+			p.staff_size,
+			p.founded_year,
+			p.location
 		FROM users u
 		LEFT JOIN profiles p ON u.id = p.user_id
 		WHERE u.id = $1
 	`
 
+	// SelectUserAuthorizedQuery checks whether $1 may see $2's profile: their
+	// own, one they are connected to or matched with either way, or one of the
+	// other role (or dual-role) sharing their city, a sector or a target group that $1 has
+	// not dismissed
+	SelectUserAuthorizedQuery = `
+		SELECT $1::int = $2::int
+			OR EXISTS (
+				SELECT 1 FROM connections
+				WHERE (initiator_id = $1 AND target_id = $2) OR (initiator_id = $2 AND target_id = $1)
+			)
+			OR EXISTS (
+				SELECT 1 FROM matches
+				WHERE (user_id = $1 AND match_id = $2) OR (user_id = $2 AND match_id = $1)
+			)
+			OR EXISTS (
+				SELECT 1
+				FROM users ru
+				JOIN users tu ON tu.id = $2
+				LEFT JOIN matching_profiles rp ON rp.user_id = ru.id
+				LEFT JOIN matching_profiles tp ON tp.user_id = tu.id
+				WHERE ru.id = $1
+					AND (ru.role <> tu.role OR ru.dual_role OR tu.dual_role)
+					AND (
+						(rp.state IS NOT NULL AND rp.state = tp.state AND rp.city = tp.city)
+						OR rp.sectors && tp.sectors
+						OR rp.target_groups && tp.target_groups
+					)
+					AND NOT EXISTS (
+						SELECT 1 FROM dismissed_matches d
+						WHERE d.user_id = $1 AND d.match_id = $2
+					)
+			)
+	`
+
 	// SelectRecipientQuery retrieves recipient-specific information
 	SelectRecipientQuery = `
-		SELECT needs, budget_requested,
-			team_size, timeline, prior_funding
+		SELECT COALESCE(needs, '{}'), budget_requested,
+			team_size, timeline, COALESCE(prior_funding, false)
 		FROM recipient_data
 		WHERE user_id = $1
 	`
@@ -50,4 +87,52 @@ const (
 		FROM provider_data
 		WHERE user_id = $1
 	`
+
+	// SelectRoleForUpdateQuery locks a user's roles for a role switch
+	SelectRoleForUpdateQuery = `
+		SELECT role, dual_role FROM users
+		WHERE id = $1 AND deleted_at IS NULL
+		FOR UPDATE
+	`
+
+	// InsertMissingRecipientQuery creates a user's recipient data with the
+	// signup defaults unless they already have some
+	InsertMissingRecipientQuery = `
+		INSERT INTO recipient_data (
+			user_id, needs, budget_requested,
+			team_size, timeline, prior_funding
+		) VALUES ($1, '{}', 0, 0, '', false)
+		ON CONFLICT (user_id) DO NOTHING
+	`
+
+	// InsertMissingProviderQuery creates a user's provider data with the
+	// signup defaults unless they already have some
+	InsertMissingProviderQuery = `
+		INSERT INTO provider_data (
+			user_id, funding_type, amount_offered,
+			region_scope, location_notes, eligibility_notes,
+			deadline, application_link
+		) VALUES ($1, '', 0, '', '', '', NULL, '')
+		ON CONFLICT (user_id) DO NOTHING
+	`
+
+	// UpdateRoleQuery sets a user's primary role and whether they also match
+	// in the other one
+	UpdateRoleQuery = `
+		UPDATE users SET role = $2, dual_role = $3
+		WHERE id = $1
+	`
+
+	// SelectUsersPageQuery retrieves one page of users
+	SelectUsersPageQuery = `
+		SELECT id, email, role
+		FROM users
+		ORDER BY id
+		LIMIT $1 OFFSET $2
+	`
+
+	// CountUsersQuery counts the users SelectUsersPageQuery pages through
+	CountUsersQuery = `
+		SELECT COUNT(*) FROM users
+	`
 )
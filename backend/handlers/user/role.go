@@ -0,0 +1,102 @@
+package user
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"matcherator/backend/handlers/auth"
+	"matcherator/backend/handlers/httputil"
+	"matcherator/backend/services/matches"
+)
+
+// UpdateRoleHandler switches the user's primary role, or lets them hold both.
+// The provider_data or recipient_data the new role needs is created with the
+// signup defaults; data of a role the user leaves is kept, so switching back
+// restores it. The stored matches involving the user are updated.
+// Used by: /api/me/role
+// Response: RoleResponse
+func UpdateRoleHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req RoleRequest
+		if !httputil.DecodeJSON(w, r, &req) {
+			return
+		}
+		if req.Role != "provider" && req.Role != "recipient" {
+			http.Error(w, "role must be provider or recipient", http.StatusBadRequest)
+			return
+		}
+
+		before, err := matches.LoadMatchProfile(db, int64(userID))
+		if err != nil {
+			log.Printf("Error loading match profile for user %d: %v", userID, err)
+			before = nil
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		var current RoleResponse
+		err = tx.QueryRow(SelectRoleForUpdateQuery, userID).Scan(&current.Role, &current.DualRole)
+		if err == sql.ErrNoRows {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error loading role of user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		// Dual-role users match on both sides, so they need both datasets
+		needsProvider := req.Role == "provider" || req.DualRole
+		needsRecipient := req.Role == "recipient" || req.DualRole
+		if needsProvider {
+			if _, err := tx.Exec(InsertMissingProviderQuery, userID); err != nil {
+				log.Printf("Error creating provider data for user %d: %v", userID, err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+		}
+		if needsRecipient {
+			if _, err := tx.Exec(InsertMissingRecipientQuery, userID); err != nil {
+				log.Printf("Error creating recipient data for user %d: %v", userID, err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		if _, err := tx.Exec(UpdateRoleQuery, userID, req.Role, req.DualRole); err != nil {
+			log.Printf("Error updating role of user %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Error completing role change", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("User %d switched from %s (dual %t) to %s (dual %t)", userID, current.Role, current.DualRole, req.Role, req.DualRole)
+
+		if before != nil {
+			if _, err := matches.QueueUpdateIfChanged(db, before); err != nil {
+				log.Printf("Error queueing match update for user %d: %v", userID, err)
+				// Don't return error here as the role was still changed successfully
+			}
+		}
+
+		json.NewEncoder(w).Encode(RoleResponse{Role: req.Role, DualRole: req.DualRole})
+	}
+}
@@ -0,0 +1,275 @@
+package widget
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"matcherator/backend/handlers/auth"
+	"matcherator/backend/handlers/httputil"
+	"matcherator/backend/services/tokens"
+)
+
+const (
+	// maxOpportunities caps the grants listed in the widget
+	maxOpportunities = 20
+
+	// maxDescriptionLength truncates grant descriptions in the widget
+	maxDescriptionLength = 280
+
+	// maxAllowedOrigins caps the websites a token may be restricted to
+	maxAllowedOrigins = 10
+)
+
+// OpportunitiesHandler returns a provider's open grants and a "Match with us"
+// link for embedding on the provider's own website. It is authenticated by the
+// provider's publishable widget token; when the token lists allowed origins,
+// browsers on other sites are refused.
+// Used by: /api/widget/opportunities?token=&format=json|html
+// Response: WidgetResponse, or an HTML fragment with format=html
+func OpportunitiesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		format := query.Get("format")
+		if format != "" && format != "json" && format != "html" {
+			http.Error(w, "format must be json or html", http.StatusBadRequest)
+			return
+		}
+
+		token := query.Get("token")
+		if token == "" {
+			http.Error(w, "Missing widget token", http.StatusUnauthorized)
+			return
+		}
+
+		var response WidgetResponse
+		var allowedOrigins []string
+		err := db.QueryRow(SelectWidgetProviderQuery, tokens.Hash(token)).Scan(
+			&response.Provider.ID,
+			&response.Provider.OrganizationName,
+			&response.Provider.ProfilePictureURL,
+			&response.Provider.ProfilePictureAlt,
+			pq.Array(&allowedOrigins),
+		)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Invalid widget token", http.StatusUnauthorized)
+			return
+		} else if err != nil {
+			log.Printf("Error resolving widget token: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		if origin := r.Header.Get("Origin"); origin != "" && len(allowedOrigins) > 0 && !containsOrigin(allowedOrigins, origin) {
+			http.Error(w, "This widget is not enabled for this website", http.StatusForbidden)
+			return
+		}
+
+		response.Opportunities, err = openOpportunities(db, response.Provider.ID)
+		if err != nil {
+			log.Printf("Error loading widget opportunities for provider %d: %v", response.Provider.ID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		response.MatchURL = matchURL(response.Provider.ID)
+
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		w.Header().Add("Vary", "Origin")
+		if format == "html" {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			if err := snippetTemplate.Execute(w, newSnippet(response)); err != nil {
+				log.Printf("Error rendering widget for provider %d: %v", response.Provider.ID, err)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// CreateTokenHandler creates or rotates the current provider's widget token,
+// optionally restricted to a list of website origins
+// Used by: /api/me/widget-token
+// Response: TokenResponse
+func CreateTokenHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var role string
+		var dualRole bool
+		err = db.QueryRow("SELECT role, dual_role FROM users WHERE id = $1", userID).Scan(&role, &dualRole)
+		if err != nil {
+			log.Printf("Error getting user role: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if role != "provider" && !dualRole {
+			http.Error(w, "Only providers can embed a widget", http.StatusForbidden)
+			return
+		}
+
+		var req TokenRequest
+		if !httputil.DecodeOptionalJSON(w, r, &req) {
+			return
+		}
+		origins, err := normalizeOrigins(req.AllowedOrigins)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		token, err := newToken()
+		if err != nil {
+			http.Error(w, "Error generating token", http.StatusInternalServerError)
+			return
+		}
+
+		if _, err := db.Exec(UpsertWidgetTokenQuery, userID, tokens.Hash(token), pq.Array(origins)); err != nil {
+			log.Printf("Error storing widget token for provider %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(TokenResponse{
+			Token:          token,
+			AllowedOrigins: origins,
+			EmbedCode:      embedCode(r, token),
+		})
+	}
+}
+
+// DeleteTokenHandler revokes the current provider's widget token
+// Used by: /api/me/widget-token
+// Response: 204 No Content
+func DeleteTokenHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := auth.GetUserIDFromToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if _, err := db.Exec(DeleteWidgetTokenQuery, userID); err != nil {
+			log.Printf("Error revoking widget token for provider %d: %v", userID, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// openOpportunities lists the provider's open grants
+func openOpportunities(db *sql.DB, providerID int) ([]Opportunity, error) {
+	rows, err := db.Query(SelectOpenOpportunitiesQuery, providerID, maxOpportunities)
+	if err != nil {
+		return nil, fmt.Errorf("error querying opportunities: %v", err)
+	}
+	defer rows.Close()
+
+	opportunities := []Opportunity{}
+	for rows.Next() {
+		var o Opportunity
+		err := rows.Scan(&o.ID, &o.Title, &o.Description, &o.Amount, &o.Deadline, pq.Array(&o.Sectors))
+		if err != nil {
+			return nil, fmt.Errorf("error scanning opportunity: %v", err)
+		}
+		if runes := []rune(o.Description); len(runes) > maxDescriptionLength {
+			o.Description = strings.TrimSpace(string(runes[:maxDescriptionLength])) + "…"
+		}
+		opportunities = append(opportunities, o)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating opportunities: %v", err)
+	}
+	return opportunities, nil
+}
+
+// matchURL deep-links to recipient signup on FRONTEND_URL, tagged with the provider
+func matchURL(providerID int) string {
+	frontendURL := strings.TrimRight(os.Getenv("FRONTEND_URL"), "/")
+	if frontendURL == "" {
+		return ""
+	}
+	params := url.Values{
+		"signup":   {"recipient"},
+		"provider": {strconv.Itoa(providerID)},
+		"ref":      {"widget"},
+	}
+	return frontendURL + "/?" + params.Encode()
+}
+
+// embedCode returns a snippet that loads the HTML widget into the host page
+func embedCode(r *http.Request, token string) string {
+	baseURL := strings.TrimRight(os.Getenv("PUBLIC_URL"), "/")
+	if baseURL == "" {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		baseURL = scheme + "://" + r.Host
+	}
+	src := baseURL + "/api/widget/opportunities?format=html&token=" + url.QueryEscape(token)
+
+	return `<div id="matcherator-widget"></div>
+<script>
+fetch(` + strconv.Quote(src) + `)
+  .then(function (r) { return r.ok ? r.text() : ""; })
+  .then(function (html) { document.getElementById("matcherator-widget").innerHTML = html; });
+</script>`
+}
+
+// normalizeOrigins validates origins such as "https://example.org" and strips
+// trailing slashes
+func normalizeOrigins(origins []string) ([]string, error) {
+	if len(origins) > maxAllowedOrigins {
+		return nil, fmt.Errorf("at most %d allowed origins are supported", maxAllowedOrigins)
+	}
+
+	normalized := []string{}
+	for _, origin := range origins {
+		origin = strings.TrimRight(strings.TrimSpace(origin), "/")
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || u.Path != "" || u.RawQuery != "" {
+			return nil, fmt.Errorf("invalid origin %q: use a scheme and host such as https://example.org", origin)
+		}
+		normalized = append(normalized, strings.ToLower(u.Scheme+"://"+u.Host))
+	}
+	return normalized, nil
+}
+
+// containsOrigin reports whether origin is in the allowed list
+func containsOrigin(allowed []string, origin string) bool {
+	origin = strings.ToLower(strings.TrimRight(origin, "/"))
+	for _, o := range allowed {
+		if o == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// newToken returns a random publishable widget token
+func newToken() (string, error) {
+	secret, err := tokens.NewSecret()
+	if err != nil {
+		return "", err
+	}
+	return "wgt_" + secret, nil
+}
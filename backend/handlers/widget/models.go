@@ -0,0 +1,41 @@
+package widget
+
+import "time"
+
+// WidgetProvider identifies the provider shown in the widget
+type WidgetProvider struct {
+	ID                int     `json:"id"`
+	OrganizationName  string  `json:"organization_name"`
+	ProfilePictureURL *string `json:"profile_picture_url"`
+	ProfilePictureAlt *string `json:"profile_picture_alt"`
+}
+
+// Opportunity is an open grant listed in the widget
+type Opportunity struct {
+	ID          int        `json:"id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Amount      *float64   `json:"amount"`
+	Deadline    *time.Time `json:"deadline"`
+	Sectors     []string   `json:"sectors"`
+}
+
+// WidgetResponse is the JSON form of the widget
+type WidgetResponse struct {
+	Provider      WidgetProvider `json:"provider"`
+	Opportunities []Opportunity  `json:"opportunities"`
+	MatchURL      string         `json:"match_url"`
+}
+
+// TokenRequest configures a widget token
+type TokenRequest struct {
+	// AllowedOrigins restricts which websites may load the widget; empty allows any
+	AllowedOrigins []string `json:"allowed_origins"`
+}
+
+// TokenResponse returns a new widget token, shown once, with ready-to-paste embed code
+type TokenResponse struct {
+	Token          string   `json:"token"`
+	AllowedOrigins []string `json:"allowed_origins"`
+	EmbedCode      string   `json:"embed_code"`
+}
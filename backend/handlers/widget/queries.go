@@ -0,0 +1,39 @@
+package widget
+
+const (
+	// SelectWidgetProviderQuery resolves a widget token to its active provider
+	SelectWidgetProviderQuery = `
+		SELECT u.id, COALESCE(p.organization_name, ''), p.profile_picture_url, p.profile_picture_alt, wt.allowed_origins
+		FROM widget_tokens wt
+		JOIN users u ON u.id = wt.provider_id
+		LEFT JOIN profiles p ON p.user_id = u.id
+		WHERE wt.token_hash = $1
+			AND (u.role = 'provider' OR u.dual_role)
+			AND u.deactivated_at IS NULL
+	`
+
+	// SelectOpenOpportunitiesQuery lists a provider's grants that are not closed
+	// and whose deadline, if any, has not passed
+	SelectOpenOpportunitiesQuery = `
+		SELECT id, title, description, amount, deadline, COALESCE(sectors, '{}')
+		FROM grants
+		WHERE provider_id = $1
+			AND COALESCE(status, '') <> 'closed'
+			AND (deadline IS NULL OR deadline >= CURRENT_TIMESTAMP)
+		ORDER BY deadline NULLS LAST, created_at DESC
+		LIMIT $2
+	`
+
+	// UpsertWidgetTokenQuery creates or rotates a provider's widget token
+	UpsertWidgetTokenQuery = `
+		INSERT INTO widget_tokens (provider_id, token_hash, allowed_origins)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (provider_id) DO UPDATE
+		SET token_hash = EXCLUDED.token_hash,
+			allowed_origins = EXCLUDED.allowed_origins,
+			created_at = CURRENT_TIMESTAMP
+	`
+
+	// DeleteWidgetTokenQuery revokes a provider's widget token
+	DeleteWidgetTokenQuery = `DELETE FROM widget_tokens WHERE provider_id = $1`
+)
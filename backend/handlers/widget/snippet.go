@@ -0,0 +1,63 @@
+package widget
+
+import (
+	"html/template"
+	"strconv"
+)
+
+// snippet is the view rendered by snippetTemplate
+type snippet struct {
+	OrganizationName string
+	Opportunities    []snippetOpportunity
+	MatchURL         string
+}
+
+type snippetOpportunity struct {
+	Title       string
+	Description string
+	Amount      string
+	Deadline    string
+}
+
+// newSnippet formats a widget response for display
+func newSnippet(response WidgetResponse) snippet {
+	s := snippet{OrganizationName: response.Provider.OrganizationName, MatchURL: response.MatchURL}
+	for _, o := range response.Opportunities {
+		view := snippetOpportunity{Title: o.Title, Description: o.Description}
+		if o.Amount != nil {
+			view.Amount = "$" + strconv.FormatFloat(*o.Amount, 'f', 0, 64)
+		}
+		if o.Deadline != nil {
+			view.Deadline = o.Deadline.Format("January 2, 2006")
+		}
+		s.Opportunities = append(s.Opportunities, view)
+	}
+	return s
+}
+
+// snippetTemplate renders the widget as a self-contained HTML fragment. All
+// values are escaped by html/template.
+var snippetTemplate = template.Must(template.New("widget").Parse(`<div class="matcherator-widget" style="font-family: sans-serif; border: 1px solid #e5e7eb; border-radius: 8px; padding: 16px;">
+  <h3 style="margin: 0 0 12px;">Open opportunities from {{.OrganizationName}}</h3>
+  {{- if .Opportunities}}
+  <ul style="list-style: none; margin: 0; padding: 0;">
+    {{- range .Opportunities}}
+    <li style="margin-bottom: 12px;">
+      <strong>{{.Title}}</strong>
+      {{- if or .Amount .Deadline}}
+      <div style="color: #6b7280; font-size: 0.9em;">
+        {{- if .Amount}}Up to {{.Amount}}{{end}}{{if and .Amount .Deadline}} · {{end}}{{if .Deadline}}Apply by {{.Deadline}}{{end -}}
+      </div>
+      {{- end}}
+      <p style="margin: 4px 0 0;">{{.Description}}</p>
+    </li>
+    {{- end}}
+  </ul>
+  {{- else}}
+  <p>No open opportunities right now.</p>
+  {{- end}}
+  {{- if .MatchURL}}
+  <a href="{{.MatchURL}}" target="_blank" rel="noopener" style="display: inline-block; margin-top: 8px; padding: 8px 16px; background: #2563eb; color: #fff; border-radius: 6px; text-decoration: none;">Match with us</a>
+  {{- end}}
+</div>
+`))
@@ -0,0 +1,105 @@
+// Package wsproto frames the chat and notification WebSockets. Clients that
+// connect with ?v=1 exchange envelopes: {"v": 1, "type": ..., "data": ...}.
+// Clients without it keep the earlier unframed JSON, and envelopes they send
+// are understood either way.
+package wsproto
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// Version is the envelope version the server speaks; 0 is the unframed
+// protocol
+const Version = 1
+
+// Envelope types
+const (
+	TypeMessage  = "message"
+	TypeTyping   = "typing"
+	TypeRead     = "read"
+	TypePresence = "presence"
+	TypeError    = "error"
+	TypeAck      = "ack"
+	TypeResume   = "resume"
+	TypeResumed  = "resumed"
+	TypePin      = "pin"
+)
+
+// Envelope is one frame of the protocol
+type Envelope struct {
+	V    int             `json:"v"`
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// Error is the data of an error frame, sent in reply to a frame the server
+// could not act on
+type Error struct {
+	Message string `json:"message"`
+}
+
+// ClientVersion returns the protocol version a socket asked for with ?v=
+func ClientVersion(r *http.Request) (int, error) {
+	v := r.URL.Query().Get("v")
+	if v == "" {
+		return 0, nil
+	}
+	version, err := strconv.Atoi(v)
+	if err != nil || version < 0 || version > Version {
+		return 0, fmt.Errorf("unsupported protocol version %q", v)
+	}
+	return version, nil
+}
+
+// Encode frames an event in an envelope. A nil data is left out.
+func Encode(eventType string, data interface{}) ([]byte, error) {
+	envelope := Envelope{V: Version, Type: eventType}
+	if data != nil {
+		encoded, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		envelope.Data = encoded
+	}
+	return json.Marshal(envelope)
+}
+
+// Decode reads an inbound frame. It returns nil without an error for frames
+// of the unframed protocol, which have no type.
+func Decode(frame []byte) (*Envelope, error) {
+	var envelope Envelope
+	if err := json.Unmarshal(frame, &envelope); err != nil {
+		return nil, errors.New("frame is not a JSON object")
+	}
+	if envelope.Type == "" {
+		return nil, nil
+	}
+	if envelope.V != Version {
+		return nil, fmt.Errorf("unsupported protocol version %d", envelope.V)
+	}
+	return &envelope, nil
+}
+
+// DecodeData reads an envelope's data into dst, refusing unknown fields. An
+// envelope without data decodes as an empty object.
+func DecodeData(envelope *Envelope, dst interface{}) error {
+	data := envelope.Data
+	if len(data) == 0 || bytes.Equal(data, []byte("null")) {
+		data = []byte("{}")
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(dst); err != nil {
+		return fmt.Errorf("invalid %s data: %v", envelope.Type, err)
+	}
+	if decoder.More() {
+		return fmt.Errorf("invalid %s data: unexpected trailing data", envelope.Type)
+	}
+	return nil
+}
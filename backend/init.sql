@@ -8,6 +8,66 @@ CREATE TABLE IF NOT EXISTS users (
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 );
 
+-- Administrators can access /api/admin routes
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_admin BOOLEAN NOT NULL DEFAULT false;
+
+-- SAML identity providers of institutional funders, one per organization
+CREATE TABLE IF NOT EXISTS sso_providers (
+    id SERIAL PRIMARY KEY,
+    slug VARCHAR(100) UNIQUE NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    idp_metadata_xml TEXT NOT NULL,
+    default_role VARCHAR(20) NOT NULL DEFAULT 'provider' CHECK (default_role IN ('provider', 'recipient')),
+    role_attribute VARCHAR(255),                -- assertion attribute that carries the user's role
+    provider_role_values TEXT[] DEFAULT '{}',   -- role_attribute values that map to 'provider'
+    recipient_role_values TEXT[] DEFAULT '{}',  -- role_attribute values that map to 'recipient'
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Outstanding SP-initiated AuthnRequests, consumed by the assertion consumer service
+CREATE TABLE IF NOT EXISTS sso_requests (
+    id VARCHAR(255) PRIMARY KEY,
+    provider_id INTEGER NOT NULL REFERENCES sso_providers(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Users provisioned through SSO may only sign in through their identity provider
+ALTER TABLE users ADD COLUMN IF NOT EXISTS sso_provider_id INTEGER REFERENCES sso_providers(id) ON DELETE SET NULL;
+
+-- SCIM provisioning: bearer token per identity provider (SHA-256 hex), the IdP's
+-- identifier for each user, and deprovisioned accounts
+ALTER TABLE sso_providers ADD COLUMN IF NOT EXISTS scim_token_hash VARCHAR(64) UNIQUE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS external_id VARCHAR(255);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deactivated_at TIMESTAMP WITH TIME ZONE;
+
+-- Providers imported from an external grant source carry the source's name
+-- until their staff claim the account; claimed_at is when a claim was approved
+ALTER TABLE users ADD COLUMN IF NOT EXISTS imported_from VARCHAR(100);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS claimed_at TIMESTAMP WITH TIME ZONE;
+
+-- An imported provider merged into the registered provider it duplicated
+ALTER TABLE users ADD COLUMN IF NOT EXISTS merged_into INTEGER REFERENCES users(id) ON DELETE SET NULL;
+
+-- Last authenticated request or WebSocket message, throttled to a few minutes;
+-- long-inactive accounts rank lower in matches
+ALTER TABLE users ADD COLUMN IF NOT EXISTS last_active_at TIMESTAMP WITH TIME ZONE;
+
+-- When the user last asked for their matches to be recalculated, for the
+-- cooldown between such requests
+ALTER TABLE users ADD COLUMN IF NOT EXISTS match_recalc_requested_at TIMESTAMP WITH TIME ZONE;
+
+-- When the user's own match list was last recalculated, even if it came out
+-- empty, and when their matching inputs last changed; the list needs a refresh
+-- once it is older than either the staleness window or the change
+ALTER TABLE users ADD COLUMN IF NOT EXISTS matches_calculated_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS matches_changed_at TIMESTAMP WITH TIME ZONE;
+
+-- Whether the user also matches in the role opposite to role, with both
+-- provider_data and recipient_data; role stays the primary one
+ALTER TABLE users ADD COLUMN IF NOT EXISTS dual_role BOOLEAN NOT NULL DEFAULT false;
+
 -- Tokens table - for storing JWT tokens
 CREATE TABLE IF NOT EXISTS tokens (
     id SERIAL PRIMARY KEY,
@@ -17,9 +77,77 @@ CREATE TABLE IF NOT EXISTS tokens (
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 );
 
+-- Each token is a session; the device it was issued to is listed to the user
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS user_agent TEXT;
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS ip_address VARCHAR(45);
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS last_used_at TIMESTAMP WITH TIME ZONE;
+
+-- Sessions are keyed on the random jti claim of their token rather than the
+-- token itself, which is no longer stored. Sessions from before keep their
+-- token as the key; identical tokens issued in the same second are merged.
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS jti TEXT;
+ALTER TABLE tokens ALTER COLUMN token DROP NOT NULL;
+UPDATE tokens SET jti = token WHERE jti IS NULL;
+DELETE FROM tokens a USING tokens b WHERE a.jti = b.jti AND a.id < b.id;
+ALTER TABLE tokens ALTER COLUMN jti SET NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tokens_jti ON tokens(jti);
+
+-- Refresh tokens (SHA-256 hashes) renew a session's access token. Each is
+-- single use; one presented again revokes its session, as it was likely stolen.
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id SERIAL PRIMARY KEY,
+    session_id INTEGER NOT NULL REFERENCES tokens(id) ON DELETE CASCADE,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_session_id ON refresh_tokens(session_id);
+
+-- Successful password logins, used to alert users about sign-ins from a new
+-- country or device
+CREATE TABLE IF NOT EXISTS login_events (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    ip_address VARCHAR(45) NOT NULL,
+    country VARCHAR(2),                        -- ISO 3166-1 alpha-2, NULL when unknown
+    device_fingerprint VARCHAR(64) NOT NULL,   -- SHA-256 of user agent and accept-language
+    user_agent TEXT,
+    suspicious BOOLEAN NOT NULL DEFAULT false,
+    alert_token_hash VARCHAR(64) UNIQUE,       -- SHA-256 of the "this wasn't me" token
+    denied_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Recent failed password logins; enough of them for an email or address make
+-- login require a CAPTCHA
+CREATE TABLE IF NOT EXISTS failed_logins (
+    id SERIAL PRIMARY KEY,
+    email VARCHAR(255) NOT NULL,
+    ip_address VARCHAR(45) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Set when a user reports a login as not theirs; blocks password login until reset
+ALTER TABLE users ADD COLUMN IF NOT EXISTS password_reset_required BOOLEAN NOT NULL DEFAULT false;
+
+-- Single-use password reset tokens (SHA-256 hashes); they were kept in
+-- password_resets
+ALTER TABLE IF EXISTS password_resets RENAME TO password_reset_tokens;
+CREATE TABLE IF NOT EXISTS password_reset_tokens (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
 -- Create index for tokens
 CREATE INDEX IF NOT EXISTS idx_tokens_user_id ON tokens(user_id);
 CREATE INDEX IF NOT EXISTS idx_tokens_expires_at ON tokens(expires_at);
+CREATE INDEX IF NOT EXISTS idx_tokens_token ON tokens(token);
 
 -- Profiles table - organization/recipient information
 CREATE TABLE IF NOT EXISTS profiles (
@@ -46,6 +174,27 @@ CREATE TABLE IF NOT EXISTS profiles (
     UNIQUE(user_id)
 );
 
+-- Alt text describing the profile picture for screen-reader users
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS profile_picture_alt TEXT;
+
+-- EIN and contact email may hold envelope-encrypted values ("enc:v1:...")
+ALTER TABLE profiles ALTER COLUMN ein TYPE TEXT;
+ALTER TABLE profiles ALTER COLUMN contact_email TYPE TEXT;
+
+-- Providers opt in to the public directory and sitemap
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS public_listing BOOLEAN NOT NULL DEFAULT false;
+
+-- Organization size and age, matched against provider eligibility bands
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS annual_budget DECIMAL(14,2);
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS staff_size INTEGER;
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS founded_year INTEGER;
+
+-- Full-text search over the organization name (ranked higher) and mission
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', COALESCE(organization_name, '')), 'A') ||
+    setweight(to_tsvector('english', COALESCE(mission_statement, '')), 'B')
+) STORED;
+
 -- Provider data table - specific to grant providers
 CREATE TABLE IF NOT EXISTS provider_data (
     id SERIAL PRIMARY KEY,
@@ -62,6 +211,20 @@ CREATE TABLE IF NOT EXISTS provider_data (
     UNIQUE(user_id)
 );
 
+-- Typical award size range of a provider; matching drops recipients whose
+-- acceptable range does not overlap it
+ALTER TABLE provider_data ADD COLUMN IF NOT EXISTS award_min DECIMAL(12,2);
+ALTER TABLE provider_data ADD COLUMN IF NOT EXISTS award_max DECIMAL(12,2);
+
+-- Eligibility bands of a provider; recipients outside a band are not matched.
+-- Ages are in years since the recipient's founding year.
+ALTER TABLE provider_data ADD COLUMN IF NOT EXISTS eligible_budget_min DECIMAL(14,2);
+ALTER TABLE provider_data ADD COLUMN IF NOT EXISTS eligible_budget_max DECIMAL(14,2);
+ALTER TABLE provider_data ADD COLUMN IF NOT EXISTS eligible_staff_min INTEGER;
+ALTER TABLE provider_data ADD COLUMN IF NOT EXISTS eligible_staff_max INTEGER;
+ALTER TABLE provider_data ADD COLUMN IF NOT EXISTS eligible_min_age_years INTEGER;
+ALTER TABLE provider_data ADD COLUMN IF NOT EXISTS eligible_max_age_years INTEGER;
+
 -- Recipient data table - specific to grant recipients
 CREATE TABLE IF NOT EXISTS recipient_data (
     id SERIAL PRIMARY KEY,
@@ -76,6 +239,10 @@ CREATE TABLE IF NOT EXISTS recipient_data (
     UNIQUE(user_id)
 );
 
+-- Award size range a recipient accepts
+ALTER TABLE recipient_data ADD COLUMN IF NOT EXISTS award_min DECIMAL(12,2);
+ALTER TABLE recipient_data ADD COLUMN IF NOT EXISTS award_max DECIMAL(12,2);
+
 -- Connections table - following relationships
 CREATE TABLE IF NOT EXISTS connections (
     id SERIAL PRIMARY KEY,
@@ -87,6 +254,47 @@ CREATE TABLE IF NOT EXISTS connections (
     UNIQUE(initiator_id, target_id)
 );
 
+-- Dismissed matches table - matches a user chose to hide
+CREATE TABLE IF NOT EXISTS dismissed_matches (
+    user_id BIGINT NOT NULL,
+    match_id BIGINT NOT NULL,
+    dismissed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, match_id)
+);
+
+-- Why a match was dismissed, and its score at the time, for tuning the algorithm
+ALTER TABLE dismissed_matches ADD COLUMN IF NOT EXISTS reason VARCHAR(30);
+ALTER TABLE dismissed_matches ADD COLUMN IF NOT EXISTS comment TEXT;
+ALTER TABLE dismissed_matches ADD COLUMN IF NOT EXISTS match_score FLOAT;
+
+-- Stored matches - recalculated per user by the matches service, which upserts
+-- the pairs it scores and deletes the user's pairs that no longer match. They
+-- were kept in temp_matches, which each recalculation dropped
+ALTER TABLE IF EXISTS temp_matches RENAME TO matches;
+CREATE TABLE IF NOT EXISTS matches (
+    user_id BIGINT NOT NULL,
+    match_id BIGINT NOT NULL,
+    match_score FLOAT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    calculated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, match_id)
+);
+
+-- Experiment variant that scored the match, NULL outside experiments
+ALTER TABLE matches ADD COLUMN IF NOT EXISTS variant VARCHAR(50);
+
+-- Role user_id acts in for the match, so a dual-role user has a list as
+-- provider and one as recipient; NULL for matches stored before it was kept
+ALTER TABLE matches ADD COLUMN IF NOT EXISTS as_role VARCHAR(20);
+
+-- Profile views table - who looked at whose profile, for provider dashboards
+CREATE TABLE IF NOT EXISTS profile_views (
+    id SERIAL PRIMARY KEY,
+    viewer_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    viewed_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    viewed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
 -- Grants table - funding opportunities
 CREATE TABLE IF NOT EXISTS grants (
     id SERIAL PRIMARY KEY,
@@ -133,19 +341,823 @@ CREATE TABLE IF NOT EXISTS chat_messages (
     timestamp TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 );
 
+-- Provenance of forwarded messages: the original message (while it exists),
+-- who wrote it and when. forwarded_sent_at is set on every forward.
+ALTER TABLE chat_messages ADD COLUMN IF NOT EXISTS forwarded_from INTEGER REFERENCES chat_messages(id) ON DELETE SET NULL;
+ALTER TABLE chat_messages ADD COLUMN IF NOT EXISTS forwarded_sender_id INTEGER REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE chat_messages ADD COLUMN IF NOT EXISTS forwarded_sent_at TIMESTAMP WITH TIME ZONE;
+
+-- Messages pinned to the top of a conversation
+CREATE TABLE IF NOT EXISTS chat_pins (
+    match_id INTEGER NOT NULL REFERENCES connections(id) ON DELETE CASCADE,
+    message_id INTEGER NOT NULL REFERENCES chat_messages(id) ON DELETE CASCADE,
+    pinned_by INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    pinned_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (match_id, message_id)
+);
+
+-- Unsent replies, one per user and conversation, so they follow the user
+-- across devices
+CREATE TABLE IF NOT EXISTS chat_drafts (
+    match_id INTEGER NOT NULL REFERENCES connections(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    content TEXT NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (match_id, user_id)
+);
+
+-- Translations table - cache of machine-translated profile and chat text
+CREATE TABLE IF NOT EXISTS translations (
+    source_hash TEXT NOT NULL,
+    target_language VARCHAR(10) NOT NULL,
+    translated_text TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (source_hash, target_language)
+);
+
+-- Taxonomy synonyms table - maps normalized sector/target group aliases to a canonical term
+CREATE TABLE IF NOT EXISTS taxonomy_synonyms (
+    alias TEXT PRIMARY KEY,
+    canonical TEXT NOT NULL
+);
+
+INSERT INTO taxonomy_synonyms (alias, canonical) VALUES
+    ('children youth', 'youth development'),
+    ('youth services', 'youth development'),
+    ('climate', 'environment'),
+    ('climate change', 'environment'),
+    ('environmental', 'environment'),
+    ('conservation', 'environment'),
+    ('health', 'healthcare'),
+    ('health care', 'healthcare'),
+    ('arts', 'arts culture'),
+    ('human services', 'social services'),
+    ('tech', 'technology'),
+    ('seniors', 'elderly'),
+    ('older adults', 'elderly'),
+    ('people disabilities', 'disabilities'),
+    ('veteran', 'veterans'),
+    ('refugees', 'immigrants')
+ON CONFLICT (alias) DO NOTHING;
+
+-- Taxonomy terms table - canonical sectors and target groups offered in the profile editor
+CREATE TABLE IF NOT EXISTS taxonomy_terms (
+    id SERIAL PRIMARY KEY,
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('sector', 'target_group')),
+    name VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(kind, name)
+);
+
+INSERT INTO taxonomy_terms (kind, name) VALUES
+    ('sector', 'Education'),
+    ('sector', 'Healthcare'),
+    ('sector', 'Environment'),
+    ('sector', 'Arts & Culture'),
+    ('sector', 'Social Services'),
+    ('sector', 'Technology'),
+    ('sector', 'Economic Development'),
+    ('sector', 'Youth Development'),
+    ('sector', 'Community Development'),
+    ('sector', 'Research'),
+    ('target_group', 'Children'),
+    ('target_group', 'Youth'),
+    ('target_group', 'Elderly'),
+    ('target_group', 'Veterans'),
+    ('target_group', 'Immigrants'),
+    ('target_group', 'Low-income'),
+    ('target_group', 'Disabilities'),
+    ('target_group', 'Women'),
+    ('target_group', 'Minorities'),
+    ('target_group', 'LGBTQ+'),
+    ('target_group', 'Students'),
+    ('target_group', 'Unemployed')
+ON CONFLICT (kind, name) DO NOTHING;
+
+-- Taxonomy suggestions table - user-proposed terms awaiting admin review
+CREATE TABLE IF NOT EXISTS taxonomy_suggestions (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('sector', 'target_group')),
+    value VARCHAR(100) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'rejected')),
+    canonical_name VARCHAR(100),
+    reviewed_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    reviewed_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Values a user never wants to be matched with; matching skips a pair when
+-- either side excludes the other. Sectors are canonical, states upper case and
+-- applicant and funding types lower case.
+CREATE TABLE IF NOT EXISTS match_preferences (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    excluded_sectors TEXT[] NOT NULL DEFAULT '{}',
+    excluded_states TEXT[] NOT NULL DEFAULT '{}',
+    excluded_applicant_types TEXT[] NOT NULL DEFAULT '{}',
+    excluded_funding_types TEXT[] NOT NULL DEFAULT '{}',
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Whether a provider may be suggested to other providers as a co-funding partner
+ALTER TABLE match_preferences ADD COLUMN IF NOT EXISTS open_to_cofunding BOOLEAN NOT NULL DEFAULT false;
+
+-- Whether a recipient may be suggested to other recipients as a peer
+ALTER TABLE match_preferences ADD COLUMN IF NOT EXISTS open_to_peers BOOLEAN NOT NULL DEFAULT false;
+
+-- Onboarding progress, one row per step the user has acted on; missing steps
+-- are pending
+CREATE TABLE IF NOT EXISTS onboarding_steps (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    step VARCHAR(50) NOT NULL,
+    status VARCHAR(20) NOT NULL CHECK (status IN ('pending', 'completed', 'skipped')),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, step)
+);
+
+-- Documents a provider requires applicants to supply for a grant
+CREATE TABLE IF NOT EXISTS grant_requirements (
+    id SERIAL PRIMARY KEY,
+    grant_id INTEGER NOT NULL REFERENCES grants(id) ON DELETE CASCADE,
+    name VARCHAR(200) NOT NULL,
+    description TEXT,
+    position INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Documents a recipient uploaded against a requirement, one per connection
+CREATE TABLE IF NOT EXISTS requirement_documents (
+    id SERIAL PRIMARY KEY,
+    requirement_id INTEGER NOT NULL REFERENCES grant_requirements(id) ON DELETE CASCADE,
+    connection_id INTEGER NOT NULL REFERENCES connections(id) ON DELETE CASCADE,
+    uploaded_by INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    file_name VARCHAR(255) NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    file_path TEXT NOT NULL,
+    uploaded_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(requirement_id, connection_id)
+);
+
+-- Virus scan outcome of an upload. Quarantined files are not served until an
+-- admin releases them; scan_verdict says why they were quarantined.
+ALTER TABLE requirement_documents ADD COLUMN IF NOT EXISTS scan_status VARCHAR(20) NOT NULL DEFAULT 'clean' CHECK (scan_status IN ('clean', 'quarantined', 'released'));
+ALTER TABLE requirement_documents ADD COLUMN IF NOT EXISTS scan_verdict TEXT;
+
+-- Follow-up tasks shared between the two sides of a connection. A null
+-- assignee means the task is for both; reminded_at is set once the due-date
+-- reminder has gone out.
+CREATE TABLE IF NOT EXISTS shared_tasks (
+    id SERIAL PRIMARY KEY,
+    connection_id INTEGER NOT NULL REFERENCES connections(id) ON DELETE CASCADE,
+    created_by INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    assignee_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    title VARCHAR(200) NOT NULL,
+    notes TEXT,
+    due_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    completed_at TIMESTAMP WITH TIME ZONE,
+    completed_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    reminded_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Question-and-answer entries a provider publishes on their profile
+CREATE TABLE IF NOT EXISTS provider_faqs (
+    id SERIAL PRIMARY KEY,
+    provider_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    question VARCHAR(500) NOT NULL,
+    answer TEXT NOT NULL,
+    position INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Questions matched recipients ask providers. Answers are shown only to the
+-- asker unless the provider answers publicly.
+CREATE TABLE IF NOT EXISTS provider_questions (
+    id SERIAL PRIMARY KEY,
+    provider_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    recipient_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    question VARCHAR(500) NOT NULL,
+    answer TEXT,
+    visibility VARCHAR(10) CHECK (visibility IN ('private', 'public')),
+    answered_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Set by the provider once a connection led to funding
+ALTER TABLE connections ADD COLUMN IF NOT EXISTS funded_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE connections ADD COLUMN IF NOT EXISTS funded_by INTEGER REFERENCES users(id) ON DELETE SET NULL;
+
+-- Success stories of funded connections, one per connection. Both sides must
+-- approve the current text before an admin can publish it.
+CREATE TABLE IF NOT EXISTS success_stories (
+    id SERIAL PRIMARY KEY,
+    connection_id INTEGER NOT NULL UNIQUE REFERENCES connections(id) ON DELETE CASCADE,
+    provider_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    recipient_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    author_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    title VARCHAR(150) NOT NULL,
+    body TEXT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'draft' CHECK (status IN ('draft', 'pending_review', 'published', 'rejected')),
+    provider_approved_at TIMESTAMP WITH TIME ZONE,
+    recipient_approved_at TIMESTAMP WITH TIME ZONE,
+    review_note TEXT,
+    reviewed_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    reviewed_at TIMESTAMP WITH TIME ZONE,
+    published_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Progress reports a provider requests on a funded connection. metrics lists
+-- the names the recipient must report a value for; reminded_at is when the
+-- last overdue reminder went out.
+CREATE TABLE IF NOT EXISTS impact_reports (
+    id SERIAL PRIMARY KEY,
+    connection_id INTEGER NOT NULL REFERENCES connections(id) ON DELETE CASCADE,
+    requested_by INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    title VARCHAR(200) NOT NULL,
+    instructions TEXT,
+    metrics TEXT[] NOT NULL DEFAULT '{}',
+    due_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    narrative TEXT,
+    metric_values JSONB,
+    submitted_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    submitted_at TIMESTAMP WITH TIME ZONE,
+    reminded_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS impact_report_attachments (
+    id SERIAL PRIMARY KEY,
+    report_id INTEGER NOT NULL REFERENCES impact_reports(id) ON DELETE CASCADE,
+    uploaded_by INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    file_name VARCHAR(255) NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    file_path TEXT NOT NULL,
+    uploaded_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Virus scan outcome, as for requirement_documents
+ALTER TABLE impact_report_attachments ADD COLUMN IF NOT EXISTS scan_status VARCHAR(20) NOT NULL DEFAULT 'clean' CHECK (scan_status IN ('clean', 'quarantined', 'released'));
+ALTER TABLE impact_report_attachments ADD COLUMN IF NOT EXISTS scan_verdict TEXT;
+
+-- Plan a user is subscribed to, as recorded by the billing provider (or
+-- "manual" when assigned by an admin). Users without a row are on the free plan.
+CREATE TABLE IF NOT EXISTS plan_subscriptions (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    plan VARCHAR(20) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'past_due', 'canceled')),
+    provider VARCHAR(50) NOT NULL,
+    external_id VARCHAR(255),
+    current_period_end TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Billing state: grace_until is when a past-due subscription loses its plan
+ALTER TABLE plan_subscriptions ADD COLUMN IF NOT EXISTS cancel_at_period_end BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE plan_subscriptions ADD COLUMN IF NOT EXISTS grace_until TIMESTAMP WITH TIME ZONE;
+
+-- Where invoices and billing mail go when not the login email
+ALTER TABLE users ADD COLUMN IF NOT EXISTS billing_email VARCHAR(255);
+
+-- Deleted accounts are anonymized in place so conversations keep their messages
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+
+-- Billing provider customer of each organization, created at first checkout
+CREATE TABLE IF NOT EXISTS billing_customers (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    provider VARCHAR(50) NOT NULL,
+    customer_id VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (provider, customer_id)
+);
+
+-- Billing webhook events already handled, so redeliveries are skipped
+CREATE TABLE IF NOT EXISTS billing_events (
+    provider VARCHAR(50) NOT NULL,
+    event_id VARCHAR(255) NOT NULL,
+    event_type VARCHAR(100) NOT NULL,
+    received_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (provider, event_id)
+);
+
+-- Uses of metered quotas (e.g. exports) per user and calendar month
+CREATE TABLE IF NOT EXISTS usage_counters (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    quota VARCHAR(50) NOT NULL,
+    period_start TIMESTAMP WITH TIME ZONE NOT NULL,
+    used INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (user_id, quota, period_start)
+);
+
+CREATE TABLE IF NOT EXISTS message_templates (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    body TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Referral code of each organization, created when first requested
+CREATE TABLE IF NOT EXISTS referral_codes (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    code VARCHAR(16) NOT NULL UNIQUE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Organizations that signed up with a referral code. completed_at is when the
+-- referred organization completed its profile, which grants the rewards.
+CREATE TABLE IF NOT EXISTS referrals (
+    id SERIAL PRIMARY KEY,
+    referrer_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    referred_id INTEGER NOT NULL UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+    code VARCHAR(16) NOT NULL,
+    completed_at TIMESTAMP WITH TIME ZONE,
+    rewarded_at TIMESTAMP WITH TIME ZONE,
+    reward TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Domains on the disposable email block list that admins allowed anyway
+CREATE TABLE IF NOT EXISTS email_domain_overrides (
+    domain VARCHAR(255) PRIMARY KEY,
+    note TEXT NOT NULL DEFAULT '',
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- One-time passwordless login links. ip_address is who asked for the link,
+-- for rate limiting.
+CREATE TABLE IF NOT EXISTS magic_links (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    ip_address VARCHAR(45) NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Subject-access reports compiled for admins: a ZIP of everything stored
+-- about the user, downloadable until expires_at
+CREATE TABLE IF NOT EXISTS subject_access_requests (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    requested_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    job_id BIGINT,
+    file_path TEXT,
+    size_bytes BIGINT,
+    completed_at TIMESTAMP WITH TIME ZONE,
+    expires_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Profile and FAQ text flagged by moderation, queued for admin review.
+-- content_id is the user ID for profiles and the FAQ entry ID for FAQs.
+CREATE TABLE IF NOT EXISTS moderation_flags (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    content_type VARCHAR(20) NOT NULL CHECK (content_type IN ('profile', 'faq')),
+    content_id INTEGER NOT NULL,
+    field VARCHAR(50) NOT NULL,
+    excerpt TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'dismissed', 'removed')),
+    reviewed_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    review_note TEXT,
+    reviewed_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Funnel events (signup, profile_completed, first_match_viewed,
+-- first_connection, first_message), recorded once per user when first reached
+CREATE TABLE IF NOT EXISTS analytics_events (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    event VARCHAR(50) NOT NULL,
+    properties JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(user_id, event)
+);
+
+-- Events of users from before tracking, from the data they left
+INSERT INTO analytics_events (user_id, event, created_at)
+SELECT id, 'signup', created_at FROM users
+ON CONFLICT (user_id, event) DO NOTHING;
+
+INSERT INTO analytics_events (user_id, event, created_at)
+SELECT user_id, 'first_connection', MIN(created_at)
+FROM (
+    SELECT initiator_id AS user_id, created_at FROM connections
+    UNION ALL
+    SELECT target_id, created_at FROM connections
+) c
+GROUP BY user_id
+ON CONFLICT (user_id, event) DO NOTHING;
+
+INSERT INTO analytics_events (user_id, event, created_at)
+SELECT sender_id, 'first_message', MIN(timestamp) FROM chat_messages GROUP BY sender_id
+ON CONFLICT (user_id, event) DO NOTHING;
+
+-- Weeks (starting Monday, UTC) in which a user made an authenticated request,
+-- for cohort retention
+CREATE TABLE IF NOT EXISTS user_active_weeks (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    week DATE NOT NULL,
+    PRIMARY KEY (user_id, week)
+);
+
+-- A/B experiments of the matching algorithm. variants holds each variant's
+-- name, traffic share and scoring config; at most one experiment runs.
+CREATE TABLE IF NOT EXISTS experiments (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL DEFAULT 'draft' CHECK (status IN ('draft', 'running', 'stopped')),
+    variants JSONB NOT NULL,
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    started_at TIMESTAMP WITH TIME ZONE,
+    stopped_at TIMESTAMP WITH TIME ZONE
+);
+
+-- The variant each user was assigned when their matches were first scored
+-- during an experiment
+CREATE TABLE IF NOT EXISTS experiment_assignments (
+    experiment_id INTEGER NOT NULL REFERENCES experiments(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    variant VARCHAR(50) NOT NULL,
+    assigned_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (experiment_id, user_id)
+);
+
+-- Matches scored by a variant that were shown to the user, when first shown
+CREATE TABLE IF NOT EXISTS experiment_exposures (
+    experiment_id INTEGER NOT NULL REFERENCES experiments(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    match_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    variant VARCHAR(50) NOT NULL,
+    shown_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (experiment_id, user_id, match_id)
+);
+
+-- Candidate scoring configs run in shadow mode next to the live one; at most
+-- one runs
+CREATE TABLE IF NOT EXISTS shadow_runs (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL DEFAULT 'running' CHECK (status IN ('running', 'stopped')),
+    config JSONB NOT NULL,
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    stopped_at TIMESTAMP WITH TIME ZONE
+);
+
+-- How a user's candidate list differed from their stored one at their latest
+-- recalculation during a shadow run. changes lists the matches that were
+-- added, lost or moved, with their ranks and scores in both lists.
+CREATE TABLE IF NOT EXISTS shadow_diffs (
+    shadow_id INTEGER NOT NULL REFERENCES shadow_runs(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    current_matches INTEGER NOT NULL,
+    candidate_matches INTEGER NOT NULL,
+    new_matches INTEGER NOT NULL,
+    lost_matches INTEGER NOT NULL,
+    moved_matches INTEGER NOT NULL,
+    mean_rank_shift FLOAT NOT NULL,
+    top_overlap INTEGER NOT NULL,
+    changes JSONB NOT NULL DEFAULT '[]',
+    calculated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (shadow_id, user_id)
+);
+
+-- Announcements a provider sends to their connections as chat messages. The
+-- filter columns are empty when unused.
+CREATE TABLE IF NOT EXISTS campaigns (
+    id SERIAL PRIMARY KEY,
+    provider_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    content TEXT NOT NULL,
+    sectors TEXT[] NOT NULL DEFAULT '{}',
+    states TEXT[] NOT NULL DEFAULT '{}',
+    connection_ids INTEGER[] NOT NULL DEFAULT '{}',
+    status VARCHAR(20) NOT NULL DEFAULT 'queued' CHECK (status IN ('queued', 'sending', 'sent', 'canceled')),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP WITH TIME ZONE
+);
+
+-- One row per recipient of a campaign; message_id is the chat message once
+-- delivered
+CREATE TABLE IF NOT EXISTS campaign_deliveries (
+    campaign_id INTEGER NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE,
+    connection_id INTEGER NOT NULL REFERENCES connections(id) ON DELETE CASCADE,
+    recipient_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'delivered', 'skipped', 'canceled')),
+    message_id INTEGER REFERENCES chat_messages(id) ON DELETE SET NULL,
+    delivered_at TIMESTAMP WITH TIME ZONE,
+    PRIMARY KEY (campaign_id, connection_id)
+);
+
+-- Requests by an organization's staff to take over its imported account.
+-- The emailed link (token_hash) confirms the claimant's address; the claim is
+-- then backed by that address's domain or an uploaded EIN document, and
+-- approved or rejected by an admin.
+CREATE TABLE IF NOT EXISTS organization_claims (
+    id SERIAL PRIMARY KEY,
+    organization_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    email TEXT NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    ip_address VARCHAR(45) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'unverified' CHECK (status IN ('unverified', 'awaiting_document', 'pending_review', 'approved', 'rejected')),
+    method VARCHAR(20) CHECK (method IN ('email_domain', 'ein_document')),
+    document_name VARCHAR(255),
+    document_type VARCHAR(100),
+    document_path TEXT,
+    review_note TEXT,
+    reviewed_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    verified_at TIMESTAMP WITH TIME ZONE,
+    reviewed_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Likely duplicates between an imported provider and a registered one, found
+-- by the dedup scan for admins to merge or dismiss. reasons lists the signals
+-- that matched: ein, website_domain, name.
+CREATE TABLE IF NOT EXISTS provider_duplicates (
+    id SERIAL PRIMARY KEY,
+    imported_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    registered_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    score FLOAT NOT NULL,
+    name_similarity FLOAT NOT NULL,
+    reasons TEXT[] NOT NULL DEFAULT '{}',
+    status VARCHAR(20) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'merged', 'dismissed')),
+    detected_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    reviewed_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    reviewed_at TIMESTAMP WITH TIME ZONE,
+    UNIQUE (imported_id, registered_id)
+);
+
+-- Publishable tokens for the embeddable provider widget, one per provider
+CREATE TABLE IF NOT EXISTS widget_tokens (
+    provider_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    allowed_origins TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Outbound CRM sync configuration, one per organization. Credentials are JSON,
+-- envelope-encrypted like other sensitive fields when encryption is enabled.
+CREATE TABLE IF NOT EXISTS crm_connections (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    provider VARCHAR(20) NOT NULL CHECK (provider IN ('salesforce', 'generic')),
+    endpoint_url TEXT NOT NULL,
+    login_url TEXT,
+    object_name VARCHAR(80),
+    credentials TEXT NOT NULL,
+    field_mapping JSONB NOT NULL DEFAULT '{}',
+    status_mapping JSONB NOT NULL DEFAULT '{}',
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Records pushed to CRMs. counterpart_id has no foreign key so the log survives
+-- the other organization deleting its account.
+CREATE TABLE IF NOT EXISTS crm_sync_logs (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    counterpart_id INTEGER,
+    event VARCHAR(50) NOT NULL,
+    record JSONB NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'succeeded', 'failed')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    external_id TEXT,
+    last_error TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Background jobs run by the worker pool. Jobs that exhaust their attempts are
+-- kept as 'dead', forming the dead-letter queue.
+CREATE TABLE IF NOT EXISTS jobs (
+    id BIGSERIAL PRIMARY KEY,
+    kind VARCHAR(100) NOT NULL,
+    payload JSONB NOT NULL DEFAULT '{}',
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'succeeded', 'dead')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL DEFAULT 5,
+    run_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    locked_at TIMESTAMP WITH TIME ZONE,
+    last_error TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Progress reported by long-running jobs such as batch match recalculation
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS progress JSONB;
+
+-- Database exports queued by admins and uploaded to object storage.
+-- object_key is cleared once retention deletes the object.
+CREATE TABLE IF NOT EXISTS backups (
+    id SERIAL PRIMARY KEY,
+    requested_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    job_id BIGINT,
+    object_key TEXT,
+    location TEXT,
+    size_bytes BIGINT,
+    table_count INTEGER,
+    row_count BIGINT,
+    completed_at TIMESTAMP WITH TIME ZONE,
+    expires_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Info sessions and webinars providers host for the recipients they are
+-- matched or connected with. A null capacity means unlimited.
+CREATE TABLE IF NOT EXISTS provider_events (
+    id SERIAL PRIMARY KEY,
+    provider_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    title VARCHAR(200) NOT NULL,
+    description TEXT,
+    starts_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    link VARCHAR(500) NOT NULL,
+    capacity INTEGER CHECK (capacity IS NULL OR capacity > 0),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Who is coming to an event; reminded_at is set once the reminder before it
+-- starts has gone out
+CREATE TABLE IF NOT EXISTS event_rsvps (
+    event_id INTEGER NOT NULL REFERENCES provider_events(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reminded_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (event_id, user_id)
+);
+
+-- Read-only bearer tokens for research partners, who get anonymized aggregates
+-- from /api/research (SHA-256 hex of the token). scopes lists the endpoints the
+-- token may read.
+CREATE TABLE IF NOT EXISTS research_tokens (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(200) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP WITH TIME ZONE,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    last_used_at TIMESTAMP WITH TIME ZONE
+);
+
+-- One row per UTC day whose warehouse export has been scheduled
+CREATE TABLE IF NOT EXISTS warehouse_runs (
+    export_date DATE PRIMARY KEY,
+    job_id BIGINT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Daily table snapshots exported to object storage for BI tooling. An
+-- incremental export holds the rows whose cursor column is in [since, until).
+-- object_key is cleared once retention deletes the object.
+CREATE TABLE IF NOT EXISTS warehouse_exports (
+    id SERIAL PRIMARY KEY,
+    export_date DATE NOT NULL,
+    table_name VARCHAR(63) NOT NULL,
+    full_snapshot BOOLEAN NOT NULL,
+    since TIMESTAMP WITH TIME ZONE,
+    until TIMESTAMP WITH TIME ZONE NOT NULL,
+    object_key TEXT,
+    location TEXT,
+    row_count BIGINT NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    UNIQUE (export_date, table_name)
+);
+
+-- Anonymized open datasets of matches and outcomes built for transparency
+-- reporting; every published group holds at least k organizations of each
+-- side. file_path is cleared once the dataset expires or is deleted.
+CREATE TABLE IF NOT EXISTS public_datasets (
+    id SERIAL PRIMARY KEY,
+    requested_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    job_id BIGINT,
+    k INTEGER NOT NULL CHECK (k > 1),
+    file_path TEXT,
+    row_count INTEGER,
+    suppressed_rows INTEGER,
+    size_bytes BIGINT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP WITH TIME ZONE,
+    expires_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Organizations a user shortlisted; unlike connections they are private to
+-- the user
+CREATE TABLE IF NOT EXISTS bookmarks (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    bookmarked_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, bookmarked_id),
+    CHECK (user_id <> bookmarked_id)
+);
+
 -- Create indexes for better query performance
 CREATE INDEX IF NOT EXISTS idx_profiles_user_id ON profiles(user_id);
+CREATE INDEX IF NOT EXISTS idx_profiles_search ON profiles USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS idx_profiles_public_listing ON profiles(user_id) WHERE public_listing;
 CREATE INDEX IF NOT EXISTS idx_provider_data_user_id ON provider_data(user_id);
 CREATE INDEX IF NOT EXISTS idx_recipient_data_user_id ON recipient_data(user_id);
 CREATE INDEX IF NOT EXISTS idx_connections_initiator ON connections(initiator_id);
 CREATE INDEX IF NOT EXISTS idx_connections_target ON connections(target_id);
+-- One connection per pair of users, whichever direction it was made in. Any
+-- duplicates created before the index existed are merged into the oldest
+-- connection of their pair: their messages, tasks, documents, stories, reports
+-- and campaign deliveries move to it first, so removing the duplicates drops
+-- nothing. Rows that can't move because the oldest connection already has
+-- their counterpart (a draft by the same user, a story, a delivery of the same
+-- campaign) fail the migration on its unique key rather than being lost.
+DROP TABLE IF EXISTS pg_temp.duplicate_connections;
+CREATE TEMP TABLE duplicate_connections AS
+SELECT c.id, MIN(older.id) AS keep_id
+FROM connections c
+JOIN connections older
+  ON LEAST(older.initiator_id, older.target_id) = LEAST(c.initiator_id, c.target_id)
+ AND GREATEST(older.initiator_id, older.target_id) = GREATEST(c.initiator_id, c.target_id)
+ AND older.id < c.id
+GROUP BY c.id;
+UPDATE chat_messages t SET match_id = d.keep_id FROM duplicate_connections d WHERE t.match_id = d.id;
+UPDATE chat_pins t SET match_id = d.keep_id FROM duplicate_connections d WHERE t.match_id = d.id;
+UPDATE chat_drafts t SET match_id = d.keep_id FROM duplicate_connections d WHERE t.match_id = d.id;
+UPDATE requirement_documents t SET connection_id = d.keep_id FROM duplicate_connections d WHERE t.connection_id = d.id;
+UPDATE shared_tasks t SET connection_id = d.keep_id FROM duplicate_connections d WHERE t.connection_id = d.id;
+UPDATE success_stories t SET connection_id = d.keep_id FROM duplicate_connections d WHERE t.connection_id = d.id;
+UPDATE impact_reports t SET connection_id = d.keep_id FROM duplicate_connections d WHERE t.connection_id = d.id;
+UPDATE campaign_deliveries t SET connection_id = d.keep_id FROM duplicate_connections d WHERE t.connection_id = d.id;
+DELETE FROM connections c USING duplicate_connections d WHERE c.id = d.id;
+DROP TABLE duplicate_connections;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_connections_pair ON connections (LEAST(initiator_id, target_id), GREATEST(initiator_id, target_id));
+CREATE INDEX IF NOT EXISTS idx_provider_faqs_provider ON provider_faqs(provider_id, position);
+CREATE INDEX IF NOT EXISTS idx_provider_questions_provider ON provider_questions(provider_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_provider_questions_recipient ON provider_questions(recipient_id);
+CREATE INDEX IF NOT EXISTS idx_success_stories_status ON success_stories(status, published_at);
+CREATE INDEX IF NOT EXISTS idx_impact_reports_connection ON impact_reports(connection_id);
+CREATE INDEX IF NOT EXISTS idx_impact_reports_overdue ON impact_reports(due_at) WHERE submitted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_impact_report_attachments_report ON impact_report_attachments(report_id);
+CREATE INDEX IF NOT EXISTS idx_message_templates_user ON message_templates(user_id);
+CREATE INDEX IF NOT EXISTS idx_referrals_referrer ON referrals(referrer_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_failed_logins_email ON failed_logins(email, created_at);
+CREATE INDEX IF NOT EXISTS idx_failed_logins_ip ON failed_logins(ip_address, created_at);
+CREATE INDEX IF NOT EXISTS idx_failed_logins_created ON failed_logins(created_at);
+CREATE INDEX IF NOT EXISTS idx_magic_links_user ON magic_links(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_magic_links_ip ON magic_links(ip_address, created_at);
+CREATE INDEX IF NOT EXISTS idx_subject_access_requests_user ON subject_access_requests(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_moderation_flags_status ON moderation_flags(status, created_at);
+CREATE INDEX IF NOT EXISTS idx_moderation_flags_content ON moderation_flags(content_type, content_id);
+CREATE INDEX IF NOT EXISTS idx_users_created_at ON users(created_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_experiments_running ON experiments(status) WHERE status = 'running';
+CREATE INDEX IF NOT EXISTS idx_experiment_assignments_user ON experiment_assignments(user_id);
+CREATE INDEX IF NOT EXISTS idx_experiment_exposures_variant ON experiment_exposures(experiment_id, variant);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_shadow_runs_running ON shadow_runs(status) WHERE status = 'running';
+CREATE INDEX IF NOT EXISTS idx_campaigns_provider ON campaigns(provider_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_campaign_deliveries_recipient ON campaign_deliveries(recipient_id);
+CREATE INDEX IF NOT EXISTS idx_organization_claims_organization ON organization_claims(organization_id, status);
+CREATE INDEX IF NOT EXISTS idx_organization_claims_status ON organization_claims(status, created_at);
+CREATE INDEX IF NOT EXISTS idx_organization_claims_ip ON organization_claims(ip_address, created_at);
+CREATE INDEX IF NOT EXISTS idx_provider_duplicates_status ON provider_duplicates(status, score DESC);
+CREATE INDEX IF NOT EXISTS idx_backups_created ON backups(created_at);
+CREATE INDEX IF NOT EXISTS idx_requirement_documents_quarantined ON requirement_documents(uploaded_at) WHERE scan_status = 'quarantined';
+CREATE INDEX IF NOT EXISTS idx_impact_report_attachments_quarantined ON impact_report_attachments(uploaded_at) WHERE scan_status = 'quarantined';
 CREATE INDEX IF NOT EXISTS idx_grants_provider ON grants(provider_id);
+CREATE INDEX IF NOT EXISTS idx_profile_views_viewed ON profile_views(viewed_id, viewed_at);
 CREATE INDEX IF NOT EXISTS idx_messages_sender ON messages(sender_id);
 CREATE INDEX IF NOT EXISTS idx_messages_recipient ON messages(recipient_id);
 CREATE INDEX IF NOT EXISTS idx_notifications_user ON notifications(user_id);
+CREATE INDEX IF NOT EXISTS idx_login_events_user ON login_events(user_id);
 CREATE INDEX IF NOT EXISTS idx_chat_messages_match ON chat_messages(match_id);
 CREATE INDEX IF NOT EXISTS idx_chat_messages_sender ON chat_messages(sender_id);
 CREATE INDEX IF NOT EXISTS idx_chat_messages_timestamp ON chat_messages(timestamp);
+CREATE INDEX IF NOT EXISTS idx_taxonomy_suggestions_status ON taxonomy_suggestions(status);
+CREATE INDEX IF NOT EXISTS idx_jobs_status_run_at ON jobs(status, run_at);
+CREATE INDEX IF NOT EXISTS idx_crm_sync_logs_user ON crm_sync_logs(user_id, id);
+CREATE INDEX IF NOT EXISTS idx_crm_sync_logs_counterpart ON crm_sync_logs(user_id, counterpart_id, id) WHERE external_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_grant_requirements_grant ON grant_requirements(grant_id, position);
+CREATE INDEX IF NOT EXISTS idx_requirement_documents_connection ON requirement_documents(connection_id);
+CREATE INDEX IF NOT EXISTS idx_shared_tasks_connection ON shared_tasks(connection_id, due_at);
+CREATE INDEX IF NOT EXISTS idx_shared_tasks_due_reminder ON shared_tasks(due_at) WHERE completed_at IS NULL AND reminded_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_dismissed_matches_dismissed_at ON dismissed_matches(dismissed_at);
+CREATE INDEX IF NOT EXISTS idx_provider_events_provider ON provider_events(provider_id, starts_at);
+CREATE INDEX IF NOT EXISTS idx_provider_events_starts_at ON provider_events(starts_at);
+CREATE INDEX IF NOT EXISTS idx_event_rsvps_user ON event_rsvps(user_id);
 
 -- Create GIN indexes for array columns
 CREATE INDEX IF NOT EXISTS idx_profiles_sectors ON profiles USING GIN(sectors);
@@ -189,3 +1201,45 @@ CREATE TRIGGER update_grants_updated_at
     BEFORE UPDATE ON grants
     FOR EACH ROW
     EXECUTE FUNCTION update_updated_at_column();
+
+-- Normalizes a taxonomy term for comparison: lower case, "&" read as "and",
+-- punctuation and stop words removed
+CREATE OR REPLACE FUNCTION normalize_taxonomy_term(term TEXT)
+RETURNS TEXT AS $$
+    SELECT COALESCE(string_agg(word, ' ' ORDER BY position), '')
+    FROM regexp_split_to_table(
+        regexp_replace(replace(lower(term), '&', ' and '), '[^a-z0-9+ ]', ' ', 'g'),
+        '\s+'
+    ) WITH ORDINALITY AS t(word, position)
+    WHERE word <> ''
+    AND word NOT IN ('a', 'an', 'and', 'the', 'of', 'for', 'in', 'on', 'to', 'with')
+$$ LANGUAGE sql IMMUTABLE;
+
+-- Maps an array of taxonomy terms to their distinct canonical forms
+CREATE OR REPLACE FUNCTION canonical_taxonomy_terms(terms TEXT[])
+RETURNS TEXT[] AS $$
+    SELECT COALESCE(array_agg(DISTINCT COALESCE(s.canonical, n.term)), '{}')
+    FROM (SELECT normalize_taxonomy_term(t) AS term FROM unnest(terms) AS t) n
+    LEFT JOIN taxonomy_synonyms s ON s.alias = n.term
+    WHERE n.term <> ''
+$$ LANGUAGE sql STABLE;
+
+-- Profiles as seen by the matching engine, with canonicalized taxonomies
+CREATE OR REPLACE VIEW matching_profiles AS
+SELECT
+    p.user_id,
+    canonical_taxonomy_terms(p.sectors) AS sectors,
+    canonical_taxonomy_terms(p.target_groups) AS target_groups,
+    p.state,
+    p.city,
+    p.project_stage,
+    p.applicant_type,
+    p.annual_budget,
+    p.staff_size,
+    p.founded_year
+FROM profiles p;
+CREATE INDEX IF NOT EXISTS idx_warehouse_exports_table ON warehouse_exports(table_name, until);
+CREATE INDEX IF NOT EXISTS idx_public_datasets_created ON public_datasets(created_at);
+CREATE INDEX IF NOT EXISTS idx_bookmarks_bookmarked ON bookmarks(bookmarked_id);
+CREATE INDEX IF NOT EXISTS idx_matches_match_id ON matches(match_id);
+CREATE INDEX IF NOT EXISTS idx_matches_user_score ON matches(user_id, match_score DESC);
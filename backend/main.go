@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"expvar"
 	"log"
 	"net/http"
 	"os"
@@ -9,22 +11,69 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
-	_ "github.com/lib/pq"
 	"github.com/rs/cors"
 	"golang.org/x/exp/rand"
 
 	"matcherator/backend/handlers"
+	"matcherator/backend/handlers/admin"
 	"matcherator/backend/handlers/auth"
+	"matcherator/backend/handlers/bookmarks"
 	"matcherator/backend/handlers/chat"
+	"matcherator/backend/handlers/claims"
 	"matcherator/backend/handlers/connection"
+	"matcherator/backend/handlers/crm"
+	"matcherator/backend/handlers/dashboard"
+	"matcherator/backend/handlers/directory"
+	"matcherator/backend/handlers/events"
+	"matcherator/backend/handlers/faq"
+	"matcherator/backend/handlers/httputil"
 	"matcherator/backend/handlers/media"
+	"matcherator/backend/handlers/meta"
 	"matcherator/backend/handlers/notifications"
+	"matcherator/backend/handlers/onboarding"
+	"matcherator/backend/handlers/plans"
 	"matcherator/backend/handlers/profile"
+	"matcherator/backend/handlers/referrals"
+	"matcherator/backend/handlers/reports"
+	"matcherator/backend/handlers/requirements"
+	"matcherator/backend/handlers/research"
+	"matcherator/backend/handlers/search"
+	"matcherator/backend/handlers/sso"
 	"matcherator/backend/handlers/status"
+	"matcherator/backend/handlers/stories"
+	"matcherator/backend/handlers/tasks"
+	"matcherator/backend/handlers/templates"
 	"matcherator/backend/handlers/user"
+	"matcherator/backend/handlers/widget"
+	"matcherator/backend/services/backups"
+	"matcherator/backend/services/billing"
+	"matcherator/backend/services/campaigns"
+	"matcherator/backend/services/captcha"
+	"matcherator/backend/services/crmsync"
+	"matcherator/backend/services/datasets"
+	"matcherator/backend/services/dedup"
+	"matcherator/backend/services/emaildomains"
+	"matcherator/backend/services/fieldcrypt"
+	"matcherator/backend/services/geoip"
+	"matcherator/backend/services/jobs"
+	"matcherator/backend/services/logredact"
+	"matcherator/backend/services/mail"
+	"matcherator/backend/services/matches"
+	"matcherator/backend/services/moderation"
+	"matcherator/backend/services/objectstore"
+	"matcherator/backend/services/schemacheck"
+	"matcherator/backend/services/subjectaccess"
+	"matcherator/backend/services/telemetry"
+	"matcherator/backend/services/translate"
+	"matcherator/backend/services/virusscan"
+	"matcherator/backend/services/warehouse"
+	"matcherator/backend/services/webhooks"
 )
 
 func main() {
+	// Redact tokens, emails, EINs and message content from all log output
+	log.SetOutput(logredact.NewWriter(os.Stderr))
+
 	// Load environment variables from .env file
 	if err := godotenv.Load(); err != nil {
 		log.Printf("Warning: .env file not found: %v", err)
@@ -39,24 +88,133 @@ func main() {
 		log.Printf("Environment variable %s is set", envVar)
 	}
 
+	// Optional machine translation of profile and chat content
+	translate.SetProvider(translate.NewProviderFromEnv())
+
+	// Optional email delivery and IP geolocation for login alerts
+	mail.SetSender(mail.NewSenderFromEnv())
+	geoip.SetLocator(geoip.NewLocatorFromEnv())
+
+	// Optional virus scanning of documents uploaded within connections
+	virusscan.SetScanner(virusscan.NewScannerFromEnv())
+
+	// Optional object storage that database backups are uploaded to
+	objectstore.SetStore(objectstore.NewStoreFromEnv())
+
+	// CAPTCHA on signup, password reset and repeated failed logins
+	captcha.SetVerifier(captcha.NewVerifierFromEnv(), os.Getenv("CAPTCHA_BYPASS_TOKEN"))
+
+	// Optional encryption of sensitive profile fields at rest
+	fieldcrypt.ConfigureFromEnv()
+
+	// Tracing, exported when OTEL_EXPORTER_OTLP_ENDPOINT is set, and Sentry
+	// error reporting when SENTRY_DSN is set
+	shutdownTelemetry := telemetry.Init(context.Background())
+	defer shutdownTelemetry(context.Background())
+
 	// Initialize random seed
 	rand.Seed(uint64(time.Now().UnixNano()))
 
 	// Initialize database connection
-	db, err := sql.Open("postgres", os.Getenv("DATABASE_URL"))
+	db, err := sql.Open(telemetry.DriverName, os.Getenv("DATABASE_URL"))
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer db.Close()
 
+	// Fail fast when the database lacks tables or columns the queries use
+	if os.Getenv("SKIP_SCHEMA_CHECK") != "true" {
+		if err := schemacheck.Check(context.Background(), db, handlers.SchemaStatements); err != nil {
+			log.Fatalf("Schema check failed; apply init.sql or set SKIP_SCHEMA_CHECK=true to start anyway: %v", err)
+		}
+	}
+
+	// Encrypt sensitive fields stored before encryption was enabled or under a
+	// rotated key
+	go func() {
+		if err := fieldcrypt.EncryptExistingProfiles(db); err != nil {
+			log.Printf("Error encrypting existing profiles: %v", err)
+		}
+		if err := crmsync.ReencryptCredentials(db); err != nil {
+			log.Printf("Error encrypting CRM credentials: %v", err)
+		}
+	}()
+
+	// Background job workers
+	matches.RegisterJobs(db)
+	crmsync.RegisterJobs(db)
+	subjectaccess.RegisterJobs(db)
+	datasets.RegisterJobs(db, admin.CensusRegion)
+	backups.RegisterJobs(db)
+	warehouse.RegisterJobs(db)
+	dedup.RegisterJobs(db)
+	campaigns.RegisterJobs(db, chat.CampaignHooks(db))
+	jobs.Register(mail.SendJob, mail.SendJobHandler())
+	jobs.Register(media.ProcessImageJob, media.ProcessImageJobHandler())
+	jobs.Register(webhooks.DeliverJob, webhooks.DeliverJobHandler())
+	jobs.Start(context.Background(), db)
+
+	// Keep the public directory sitemap up to date
+	directory.StartSitemapRefresher(context.Background(), db)
+
+	// Cache the providers visitors without an account can browse
+	directory.StartBrowseRefresher(context.Background(), db)
+
+	// Use the configured moderation term list
+	moderation.LoadTermsFromEnv()
+
+	// Use the configured warehouse export tables
+	warehouse.LoadConfigFromEnv()
+
+	// Reload the disposable email domain block list when its file changes
+	emaildomains.StartReloader(context.Background())
+
+	// Delete expired sessions, subject-access reports, open datasets and backups
+	auth.StartSessionPurger(context.Background(), db)
+	subjectaccess.StartPurger(context.Background(), db)
+	datasets.StartPurger(context.Background(), db)
+	backups.StartPurger(context.Background(), db)
+
+	// Export the core tables to object storage daily for BI tooling
+	warehouse.StartScheduler(context.Background(), db)
+
+	// Remind connected organizations of shared tasks coming due
+	tasks.StartReminders(context.Background(), db)
+
+	// Remind attendees of provider events about to start
+	events.StartReminders(context.Background(), db)
+
+	// Remind recipients of overdue progress reports
+	reports.StartReminders(context.Background(), db)
+
+	// Sell paid plans through Stripe when configured
+	stripe, err := billing.NewStripeFromEnv()
+	if err != nil {
+		log.Printf("Stripe billing disabled: %v", err)
+	}
+
 	// Create router
 	r := mux.NewRouter()
 
+	// Tag requests with an ID and turn handler panics into JSON 500s
+	r.Use(httputil.RequestIDMiddleware, httputil.RecoveryMiddleware)
+
+	// Trace every request and return its trace ID to the client
+	r.Use(telemetry.Middleware)
+
+	// Cap request bodies; uploads get room for a 10 MB file plus multipart overhead
+	r.Use(httputil.BodyLimitMiddleware(httputil.DefaultMaxBodyBytes, map[string]int64{
+		"/api/upload/profile-picture":                                 11 << 20,
+		"/api/connections/{id}/requirements/{requirementId}/document": requirements.MaxDocumentSize + 1<<20,
+		"/api/connections/{id}/reports/{reportId}/attachments":        reports.MaxAttachmentSize + 1<<20,
+	}))
+
 	// CORS middleware
 	c := cors.New(cors.Options{
 		AllowedOrigins:   []string{"*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Content-Type", "Authorization"},
+		AllowedMethods:   []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Content-Type", "Authorization", "traceparent", "tracestate", httputil.RequestIDHeader},
+		ExposedHeaders:   []string{telemetry.TraceIDHeader, httputil.RequestIDHeader, "X-Matches-Total", auth.CaptchaRequiredHeader},
 		AllowCredentials: true,
 		MaxAge:           86400, // 24 hours
 	})
@@ -64,11 +222,58 @@ func main() {
 	// Public routes (no auth required)
 	r.HandleFunc("/api/auth/signup", auth.SignupHandler(db)).Methods("POST", "OPTIONS")
 	r.HandleFunc("/api/auth/login", auth.LoginHandler(db)).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/auth/refresh", auth.RefreshHandler(db)).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/auth/magic-link", auth.RequestMagicLinkHandler(db)).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/auth/magic-link/exchange", auth.ExchangeMagicLinkHandler(db)).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/auth/login-alerts/{token}/deny", auth.DenyLoginHandler(db)).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/auth/forgot-password", auth.ForgotPasswordHandler(db)).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/auth/reset-password", auth.ResetPasswordHandler(db)).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/auth/password-reset", auth.ResetPasswordHandler(db)).Methods("POST", "OPTIONS") // older clients
+	r.HandleFunc("/api/auth/saml/{slug}/metadata", sso.MetadataHandler(db)).Methods("GET")
+	r.HandleFunc("/api/auth/saml/{slug}/login", sso.LoginHandler(db)).Methods("GET")
+	r.HandleFunc("/api/auth/saml/{slug}/acs", sso.ACSHandler(db)).Methods("POST")
+	r.HandleFunc("/api/public/providers", directory.ListProvidersHandler(db)).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/public/providers/{id}", directory.GetProviderHandler(db)).Methods("GET", "OPTIONS")
+	r.Handle("/api/public/browse/providers", httputil.RateLimitMiddleware(directory.BrowseRateLimit, time.Minute, auth.ClientIP)(directory.BrowseProvidersHandler())).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/public/providers/{id}/claims", claims.CreateClaimHandler(db)).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/public/claims/verify", claims.VerifyClaimHandler(db)).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/public/claims/document", claims.UploadDocumentHandler(db)).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/public/stories", stories.ListPublicStoriesHandler(db)).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/public/stories/{id}", stories.GetPublicStoryHandler(db)).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/public/datasets/{id}/download", admin.DownloadDatasetHandler(db)).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/plans", plans.ListPlansHandler()).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/billing/stripe/webhook", plans.StripeWebhookHandler(db, stripe)).Methods("POST")
+	r.HandleFunc("/api/widget/opportunities", widget.OpportunitiesHandler(db)).Methods("GET", "OPTIONS")
+	r.HandleFunc("/sitemap.xml", directory.SitemapHandler()).Methods("GET")
 	r.HandleFunc("/api/test/generate-users", handlers.GenerateTestDataHandler(db)).Methods("POST", "OPTIONS")
 
+	// SCIM 2.0 provisioning, authenticated per identity provider
+	scimRoutes := r.PathPrefix("/scim/v2").Subrouter()
+	scimRoutes.Use(sso.SCIMMiddleware(db))
+	scimRoutes.HandleFunc("/Users", sso.ListSCIMUsersHandler(db)).Methods("GET")
+	scimRoutes.HandleFunc("/Users", sso.CreateSCIMUserHandler(db)).Methods("POST")
+	scimRoutes.HandleFunc("/Users/{id}", sso.GetSCIMUserHandler(db)).Methods("GET")
+	scimRoutes.HandleFunc("/Users/{id}", sso.ReplaceSCIMUserHandler(db)).Methods("PUT")
+	scimRoutes.HandleFunc("/Users/{id}", sso.PatchSCIMUserHandler(db)).Methods("PATCH")
+	scimRoutes.HandleFunc("/Users/{id}", sso.DeleteSCIMUserHandler(db)).Methods("DELETE")
+
+	// Anonymized aggregates for research partners, authenticated by read-only tokens
+	researchRoutes := r.PathPrefix("/api/research").Subrouter()
+	researchRoutes.Use(research.TokenMiddleware(db))
+	researchRoutes.HandleFunc("/sectors", research.SectorsHandler(db)).Methods("GET")
+	researchRoutes.HandleFunc("/geo", research.GeoHandler(db)).Methods("GET")
+	researchRoutes.HandleFunc("/matches", research.MatchesHandler(db)).Methods("GET")
+
+	// WebSocket routes authenticate the token they are opened with
+	wsRoutes := r.PathPrefix("/ws").Subrouter()
+
 	// Create a subrouter for protected routes
 	protected := r.PathPrefix("/api").Subrouter()
-	protected.Use(auth.AuthMiddleware)
+	protected.Use(auth.AuthMiddleware(db))
+	protected.Use(auth.ActivityMiddleware(db))
+
+	// Sign out the requesting session
+	protected.HandleFunc("/auth/logout", auth.LogoutHandler(db)).Methods("POST", "OPTIONS")
 
 	// User routes
 	protected.HandleFunc("/users", user.GetUsersHandler(db)).Methods("GET", "OPTIONS")
@@ -77,46 +282,247 @@ func main() {
 	protected.HandleFunc("/users/{id}/profile", profile.GetUserProfileHandler(db)).Methods("GET", "OPTIONS")
 	protected.HandleFunc("/users/{id}/bio", profile.GetUserBioHandler(db)).Methods("GET", "OPTIONS")
 
+	// Full-text search over organization profiles
+	protected.HandleFunc("/search/profiles", search.SearchProfilesHandler(db)).Methods("GET", "OPTIONS")
+
 	// Me routes
 	protected.HandleFunc("/me", user.GetMyBasicInfoHandler(db)).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/me", user.DeleteAccountHandler(db)).Methods("DELETE", "OPTIONS")
 	protected.HandleFunc("/me/profile", profile.GetUserProfileHandler(db)).Methods("GET", "OPTIONS")
 	protected.HandleFunc("/me/profile", profile.UpdateProfileHandler(db)).Methods("PUT", "OPTIONS")
+	protected.HandleFunc("/me/email", auth.ChangeEmailHandler(db)).Methods("PUT", "OPTIONS")
+	protected.HandleFunc("/me/role", user.UpdateRoleHandler(db)).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/me/sessions", auth.GetSessionsHandler(db)).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/me/sessions", auth.DeleteSessionsHandler(db)).Methods("DELETE", "OPTIONS")
+	protected.HandleFunc("/me/sessions/{id}", auth.DeleteSessionHandler(db)).Methods("DELETE", "OPTIONS")
 	protected.HandleFunc("/me/bio", profile.GetMyBioHandler(db)).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/me/provider-dashboard", dashboard.GetProviderDashboardHandler(db)).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/me/recipient-dashboard", dashboard.GetRecipientDashboardHandler(db)).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/me/award-range", connection.GetAwardRangeHandler(db)).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/me/award-range", connection.UpdateAwardRangeHandler(db)).Methods("PUT", "OPTIONS")
+	protected.HandleFunc("/me/eligibility", connection.GetEligibilityHandler(db)).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/me/eligibility", connection.UpdateEligibilityHandler(db)).Methods("PUT", "OPTIONS")
+	protected.HandleFunc("/me/match-preferences", connection.GetMatchPreferencesHandler(db)).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/me/match-preferences", connection.UpdateMatchPreferencesHandler(db)).Methods("PUT", "OPTIONS")
+	protected.HandleFunc("/me/onboarding", onboarding.GetOnboardingHandler(db)).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/me/onboarding", onboarding.UpdateOnboardingHandler(db)).Methods("PUT", "OPTIONS")
+	protected.HandleFunc("/me/widget-token", widget.CreateTokenHandler(db)).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/me/widget-token", widget.DeleteTokenHandler(db)).Methods("DELETE", "OPTIONS")
+	protected.HandleFunc("/me/crm", crm.GetConnectionHandler(db)).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/me/crm", crm.SaveConnectionHandler(db)).Methods("PUT", "OPTIONS")
+	protected.HandleFunc("/me/crm", crm.DeleteConnectionHandler(db)).Methods("DELETE", "OPTIONS")
+	protected.HandleFunc("/me/crm/sync-logs", crm.ListSyncLogsHandler(db)).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/me/crm/sync-logs/{id}/retry", crm.RetrySyncHandler(db)).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/me/bookmarks", bookmarks.GetBookmarksHandler(db)).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/me/bookmarks/{userId}", bookmarks.CreateBookmarkHandler(db)).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/me/bookmarks/{userId}", bookmarks.DeleteBookmarkHandler(db)).Methods("DELETE", "OPTIONS")
 
 	// Upload routes
 	protected.HandleFunc("/upload/profile-picture", media.UploadProfilePictureHandler(db)).Methods("POST", "OPTIONS")
 	protected.HandleFunc("/upload/profile-picture", media.DeleteProfilePictureHandler(db)).Methods("DELETE", "OPTIONS")
+	protected.HandleFunc("/upload/profile-picture/alt", media.UpdateProfilePictureAltHandler(db)).Methods("PUT", "OPTIONS")
 
 	// Connections and Matching routes
 	protected.HandleFunc("/connections", connection.GetConnectionsHandler(db)).Methods("GET", "OPTIONS")
 	protected.HandleFunc("/connections", connection.CreateConnectionHandler(db)).Methods("POST", "OPTIONS")
 	protected.HandleFunc("/connections/{id}", connection.DeleteConnectionHandler(db)).Methods("DELETE", "OPTIONS")
+	protected.HandleFunc("/connections/with/{userId}", connection.DeleteConnectionWithUserHandler(db)).Methods("DELETE", "OPTIONS")
 	protected.HandleFunc("/potential-matches", connection.GetPotentialMatchesHandler(db)).Methods("GET", "OPTIONS")
 	protected.HandleFunc("/potential-matches/recalculate", connection.RecalculateMatchesHandler(db)).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/potential-matches/recalculate/{id}", connection.GetRecalculationHandler(db)).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/potential-partners", connection.GetPotentialPartnersHandler(db)).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/potential-peers", connection.GetPotentialPeersHandler(db)).Methods("GET", "OPTIONS")
 	protected.HandleFunc("/matches/dismiss/{id}", connection.DismissMatchHandler(db)).Methods("DELETE", "OPTIONS")
+	protected.HandleFunc("/matches/dismiss/{id}/restore", connection.RestoreMatchHandler(db)).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/matches/dismissed", connection.GetDismissedMatchesHandler(db)).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/matches/compare", connection.CompareMatchesHandler(db)).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/connections/{id}/funded", connection.MarkFundedHandler(db)).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/connections/{id}/funded", connection.UnmarkFundedHandler(db)).Methods("DELETE", "OPTIONS")
+
+	// Success story routes
+	protected.HandleFunc("/connections/{id}/story", stories.GetStoryHandler(db)).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/connections/{id}/story", stories.SaveStoryHandler(db)).Methods("PUT", "OPTIONS")
+	protected.HandleFunc("/connections/{id}/story", stories.DeleteStoryHandler(db)).Methods("DELETE", "OPTIONS")
+	protected.HandleFunc("/connections/{id}/story/approve", stories.ApproveStoryHandler(db)).Methods("POST", "OPTIONS")
+
+	// Grant requirement checklist routes
+	protected.HandleFunc("/grants/{id}/requirements", requirements.GetRequirementsHandler(db)).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/grants/{id}/requirements", requirements.CreateRequirementHandler(db)).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/grants/{id}/requirements/{requirementId}", requirements.DeleteRequirementHandler(db)).Methods("DELETE", "OPTIONS")
+	protected.HandleFunc("/connections/{id}/requirements", requirements.GetConnectionChecklistsHandler(db)).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/connections/{id}/requirements/{requirementId}/document", requirements.UploadDocumentHandler(db)).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/connections/{id}/requirements/{requirementId}/document", requirements.DownloadDocumentHandler(db)).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/connections/{id}/requirements/{requirementId}/document", requirements.DeleteDocumentHandler(db)).Methods("DELETE", "OPTIONS")
+
+	// Shared task routes
+	protected.HandleFunc("/connections/{id}/tasks", tasks.GetTasksHandler(db)).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/connections/{id}/tasks", tasks.CreateTaskHandler(db)).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/connections/{id}/tasks/{taskId}/complete", tasks.CompleteTaskHandler(db)).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/connections/{id}/tasks/{taskId}", tasks.DeleteTaskHandler(db)).Methods("DELETE", "OPTIONS")
+	protected.HandleFunc("/me/events", events.GetEventsHandler(db)).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/me/events", events.CreateEventHandler(db)).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/me/events/{id}", events.CancelEventHandler(db)).Methods("DELETE", "OPTIONS")
+	protected.HandleFunc("/me/events/{id}/attendees", events.GetAttendeesHandler(db)).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/events/{id}/rsvp", events.RSVPHandler(db)).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/events/{id}/rsvp", events.CancelRSVPHandler(db)).Methods("DELETE", "OPTIONS")
+
+	// Progress report routes
+	protected.HandleFunc("/connections/{id}/reports", reports.GetReportsHandler(db)).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/connections/{id}/reports", reports.CreateReportHandler(db)).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/connections/{id}/reports/{reportId}", reports.DeleteReportHandler(db)).Methods("DELETE", "OPTIONS")
+	protected.HandleFunc("/connections/{id}/reports/{reportId}/submission", reports.SubmitReportHandler(db)).Methods("PUT", "OPTIONS")
+	protected.HandleFunc("/connections/{id}/reports/{reportId}/attachments", reports.UploadAttachmentHandler(db)).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/connections/{id}/reports/{reportId}/attachments/{attachmentId}", reports.DownloadAttachmentHandler(db)).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/connections/{id}/reports/{reportId}/attachments/{attachmentId}", reports.DeleteAttachmentHandler(db)).Methods("DELETE", "OPTIONS")
+
+	// Plan, referral and billing routes
+	protected.HandleFunc("/me/plan", plans.GetMyPlanHandler(db)).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/me/referrals", referrals.GetReferralsHandler(db)).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/me/billing/checkout", plans.CheckoutHandler(db, stripe)).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/me/billing/portal", plans.PortalHandler(db, stripe)).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/me/billing/invoices", plans.GetInvoicesHandler(db, stripe)).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/me/billing/settings", plans.GetBillingSettingsHandler(db)).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/me/billing/settings", plans.UpdateBillingSettingsHandler(db, stripe)).Methods("PUT", "OPTIONS")
+
+	// Message template routes
+	protected.HandleFunc("/me/message-templates", templates.GetTemplatesHandler(db)).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/me/message-templates", templates.CreateTemplateHandler(db)).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/me/message-templates/{id}", templates.UpdateTemplateHandler(db)).Methods("PUT", "OPTIONS")
+	protected.HandleFunc("/me/message-templates/{id}", templates.DeleteTemplateHandler(db)).Methods("DELETE", "OPTIONS")
+
+	// Campaign routes
+	protected.HandleFunc("/me/campaigns", chat.GetCampaignsHandler(db)).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/me/campaigns", chat.CreateCampaignHandler(db)).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/me/campaigns/preview", chat.PreviewCampaignHandler(db)).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/me/campaigns/{id}", chat.GetCampaignHandler(db)).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/me/campaigns/{id}/cancel", chat.CancelCampaignHandler(db)).Methods("POST", "OPTIONS")
+
+	// Export routes
+	protected.HandleFunc("/me/exports/connections", connection.ExportConnectionsHandler(db)).Methods("GET", "OPTIONS")
+
+	// Provider FAQ and question routes
+	protected.HandleFunc("/me/faqs", faq.GetMyFAQsHandler(db)).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/me/faqs", faq.CreateFAQHandler(db)).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/me/faqs/{id}", faq.UpdateFAQHandler(db)).Methods("PUT", "OPTIONS")
+	protected.HandleFunc("/me/faqs/{id}", faq.DeleteFAQHandler(db)).Methods("DELETE", "OPTIONS")
+	protected.HandleFunc("/me/questions", faq.GetMyQuestionsHandler(db)).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/me/questions/{id}/answer", faq.AnswerQuestionHandler(db)).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/users/{id}/faqs", faq.GetProfileFAQsHandler(db)).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/users/{id}/questions", faq.AskQuestionHandler(db)).Methods("POST", "OPTIONS")
+
+	// Taxonomy routes
+	protected.HandleFunc("/meta/taxonomy", meta.GetTaxonomyHandler(db)).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/meta/suggestions", meta.CreateSuggestionHandler(db)).Methods("POST", "OPTIONS")
 
 	// Notification routes
 	protected.HandleFunc("/notifications", notifications.GetNotificationsHandler(db)).Methods("GET", "OPTIONS")
 	protected.HandleFunc("/notifications/read", notifications.MarkNotificationsAsReadHandler(db)).Methods("POST", "OPTIONS")
-	r.HandleFunc("/ws/notifications", notifications.HandleNotificationWebSocket())
+	wsRoutes.HandleFunc("/notifications", notifications.HandleNotificationWebSocket(db))
+
+	// Push live match updates published by the matches service
+	go notifications.ListenForMatchUpdates(os.Getenv("DATABASE_URL"))
 
 	// Chat routes
 	protected.HandleFunc("/chat/preferences", chat.GetChatPreferencesHandler(db)).Methods("GET", "OPTIONS")
 	protected.HandleFunc("/chat/preferences", chat.UpdateChatPreferencesHandler(db)).Methods("PUT", "OPTIONS")
 	protected.HandleFunc("/chat", chat.GetChatsHandler(db)).Methods("GET", "OPTIONS")
 	protected.HandleFunc("/chat/{id}/messages", chat.GetChatMessagesHandler(db)).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/chat/{id}/messages", chat.SendMessageHandler(db)).Methods("POST", "OPTIONS")
 	protected.HandleFunc("/chat/{id}/messages/read", chat.MarkMessagesAsReadHandler(db)).Methods("POST", "OPTIONS")
-	r.HandleFunc("/ws/chat/{matchId}", chat.HandleWebSocket(db))
+	protected.HandleFunc("/chat/{id}/messages/{message_id}/forward", chat.ForwardMessageHandler(db)).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/chat/{id}/messages/{message_id}/pin", chat.PinMessageHandler(db)).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/chat/{id}/messages/{message_id}/pin", chat.UnpinMessageHandler(db)).Methods("DELETE", "OPTIONS")
+	protected.HandleFunc("/chat/{id}/pins", chat.GetPinnedMessagesHandler(db)).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/chat/{id}/draft", chat.GetDraftHandler(db)).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/chat/{id}/draft", chat.SaveDraftHandler(db)).Methods("PUT", "OPTIONS")
+	wsRoutes.HandleFunc("/chat/{matchId}", chat.HandleWebSocket(db))
 
 	// Status routes
 	protected.HandleFunc("/status/{id}", status.GetStatusHandler(db)).Methods("GET", "OPTIONS")
 	protected.HandleFunc("/status", status.GetMyStatusHandler(db)).Methods("GET", "OPTIONS")
 
+	// Admin routes
+	adminRoutes := protected.PathPrefix("/admin").Subrouter()
+	adminRoutes.Use(auth.AdminMiddleware(db))
+	adminRoutes.Handle("/metrics", expvar.Handler()).Methods("GET", "OPTIONS")
+	adminRoutes.HandleFunc("/jobs", admin.ListJobsHandler(db)).Methods("GET", "OPTIONS")
+	adminRoutes.HandleFunc("/jobs/{id}/retry", admin.RetryJobHandler(db)).Methods("POST", "OPTIONS")
+	adminRoutes.HandleFunc("/matching/explain", admin.ExplainMatchHandler(db)).Methods("GET", "OPTIONS")
+	adminRoutes.HandleFunc("/matching/recalculate-all", admin.RecalculateAllHandler(db)).Methods("POST", "OPTIONS")
+	adminRoutes.HandleFunc("/matching/jobs/{id}", admin.GetRecalculationJobHandler(db)).Methods("GET", "OPTIONS")
+	adminRoutes.HandleFunc("/matching/dismissals", connection.DismissalAnalyticsHandler(db)).Methods("GET", "OPTIONS")
+	adminRoutes.HandleFunc("/experiments", admin.ListExperimentsHandler(db)).Methods("GET", "OPTIONS")
+	adminRoutes.HandleFunc("/experiments", admin.CreateExperimentHandler(db)).Methods("POST", "OPTIONS")
+	adminRoutes.HandleFunc("/experiments/{id}/start", admin.StartExperimentHandler(db)).Methods("POST", "OPTIONS")
+	adminRoutes.HandleFunc("/experiments/{id}/stop", admin.StopExperimentHandler(db)).Methods("POST", "OPTIONS")
+	adminRoutes.HandleFunc("/experiments/{id}/results", admin.ExperimentResultsHandler(db)).Methods("GET", "OPTIONS")
+	adminRoutes.HandleFunc("/shadow-runs", admin.ListShadowRunsHandler(db)).Methods("GET", "OPTIONS")
+	adminRoutes.HandleFunc("/shadow-runs", admin.CreateShadowRunHandler(db)).Methods("POST", "OPTIONS")
+	adminRoutes.HandleFunc("/shadow-runs/{id}/stop", admin.StopShadowRunHandler(db)).Methods("POST", "OPTIONS")
+	adminRoutes.HandleFunc("/shadow-runs/{id}/report", admin.ShadowReportHandler(db)).Methods("GET", "OPTIONS")
+	adminRoutes.HandleFunc("/shadow-runs/{id}/users/{user_id}", admin.ShadowDiffHandler(db)).Methods("GET", "OPTIONS")
+	adminRoutes.HandleFunc("/onboarding/funnel", onboarding.FunnelHandler(db)).Methods("GET", "OPTIONS")
+	adminRoutes.HandleFunc("/taxonomy/suggestions", meta.ListSuggestionsHandler(db)).Methods("GET", "OPTIONS")
+	adminRoutes.HandleFunc("/taxonomy/suggestions/{id}/approve", meta.ApproveSuggestionHandler(db)).Methods("POST", "OPTIONS")
+	adminRoutes.HandleFunc("/taxonomy/suggestions/{id}/reject", meta.RejectSuggestionHandler(db)).Methods("POST", "OPTIONS")
+	adminRoutes.HandleFunc("/email-domains/overrides", admin.ListEmailDomainOverridesHandler(db)).Methods("GET", "OPTIONS")
+	adminRoutes.HandleFunc("/email-domains/overrides/{domain}", admin.SaveEmailDomainOverrideHandler(db)).Methods("PUT", "OPTIONS")
+	adminRoutes.HandleFunc("/email-domains/overrides/{domain}", admin.DeleteEmailDomainOverrideHandler(db)).Methods("DELETE", "OPTIONS")
+	adminRoutes.HandleFunc("/stats/geo", admin.GeoStatsHandler(db)).Methods("GET", "OPTIONS")
+	adminRoutes.HandleFunc("/stats/sectors", admin.SectorGapsHandler(db)).Methods("GET", "OPTIONS")
+	adminRoutes.HandleFunc("/analytics/cohorts/retention", admin.CohortRetentionHandler(db)).Methods("GET", "OPTIONS")
+	adminRoutes.HandleFunc("/analytics/cohorts/conversion", admin.CohortConversionHandler(db)).Methods("GET", "OPTIONS")
+	adminRoutes.HandleFunc("/profiles", admin.ListProfilesHandler(db)).Methods("GET", "OPTIONS")
+	adminRoutes.HandleFunc("/moderation/flags", admin.ListModerationFlagsHandler(db)).Methods("GET", "OPTIONS")
+	adminRoutes.HandleFunc("/moderation/flags/{id}/review", admin.ReviewModerationFlagHandler(db)).Methods("POST", "OPTIONS")
+	adminRoutes.HandleFunc("/users/{id}/plan", plans.SetUserPlanHandler(db)).Methods("PUT", "OPTIONS")
+	adminRoutes.HandleFunc("/users/{id}/subject-access", admin.CreateSubjectAccessHandler(db)).Methods("POST", "OPTIONS")
+	adminRoutes.HandleFunc("/subject-access", admin.ListSubjectAccessHandler(db)).Methods("GET", "OPTIONS")
+	adminRoutes.HandleFunc("/subject-access/{id}", admin.GetSubjectAccessHandler(db)).Methods("GET", "OPTIONS")
+	adminRoutes.HandleFunc("/subject-access/{id}", admin.DeleteSubjectAccessHandler(db)).Methods("DELETE", "OPTIONS")
+	adminRoutes.HandleFunc("/subject-access/{id}/download", admin.DownloadSubjectAccessHandler(db)).Methods("GET", "OPTIONS")
+	adminRoutes.HandleFunc("/datasets", admin.ListDatasetsHandler(db)).Methods("GET", "OPTIONS")
+	adminRoutes.HandleFunc("/datasets", admin.CreateDatasetHandler(db)).Methods("POST", "OPTIONS")
+	adminRoutes.HandleFunc("/datasets/{id}", admin.GetDatasetHandler(db)).Methods("GET", "OPTIONS")
+	adminRoutes.HandleFunc("/datasets/{id}", admin.DeleteDatasetHandler(db)).Methods("DELETE", "OPTIONS")
+	adminRoutes.HandleFunc("/datasets/{id}/link", admin.CreateDatasetLinkHandler(db)).Methods("POST", "OPTIONS")
+	adminRoutes.HandleFunc("/stories", stories.ListStoriesHandler(db)).Methods("GET", "OPTIONS")
+	adminRoutes.HandleFunc("/stories/{id}/review", stories.ReviewStoryHandler(db)).Methods("POST", "OPTIONS")
+	adminRoutes.HandleFunc("/claims", claims.ListClaimsHandler(db)).Methods("GET", "OPTIONS")
+	adminRoutes.HandleFunc("/claims/{id}/document", claims.DownloadDocumentHandler(db)).Methods("GET", "OPTIONS")
+	adminRoutes.HandleFunc("/claims/{id}/review", claims.ReviewClaimHandler(db)).Methods("POST", "OPTIONS")
+	adminRoutes.HandleFunc("/duplicates", admin.ListDuplicatesHandler(db)).Methods("GET", "OPTIONS")
+	adminRoutes.HandleFunc("/duplicates/scan", admin.ScanDuplicatesHandler(db)).Methods("POST", "OPTIONS")
+	adminRoutes.HandleFunc("/duplicates/{id}/review", admin.ReviewDuplicateHandler(db)).Methods("POST", "OPTIONS")
+	adminRoutes.HandleFunc("/quarantine", admin.ListQuarantineHandler(db)).Methods("GET", "OPTIONS")
+	adminRoutes.HandleFunc("/quarantine/{kind}/{id}/review", admin.ReviewQuarantineHandler(db)).Methods("POST", "OPTIONS")
+	adminRoutes.HandleFunc("/backups", admin.ListBackupsHandler(db)).Methods("GET", "OPTIONS")
+	adminRoutes.HandleFunc("/backups", admin.CreateBackupHandler(db)).Methods("POST", "OPTIONS")
+	adminRoutes.HandleFunc("/warehouse/exports", admin.ListWarehouseExportsHandler(db)).Methods("GET", "OPTIONS")
+	adminRoutes.HandleFunc("/sso/providers", sso.ListProvidersHandler(db)).Methods("GET", "OPTIONS")
+	adminRoutes.HandleFunc("/sso/providers", sso.UpsertProviderHandler(db)).Methods("POST", "OPTIONS")
+	adminRoutes.HandleFunc("/sso/providers/{slug}/scim-token", sso.CreateSCIMTokenHandler(db)).Methods("POST", "OPTIONS")
+	adminRoutes.HandleFunc("/research-tokens", research.ListTokensHandler(db)).Methods("GET", "OPTIONS")
+	adminRoutes.HandleFunc("/research-tokens", research.CreateTokenHandler(db)).Methods("POST", "OPTIONS")
+	adminRoutes.HandleFunc("/research-tokens/{id}", research.RevokeTokenHandler(db)).Methods("DELETE", "OPTIONS")
+
+	// Route introspection for admins, listing every route registered above
+	routeList := protected.Path("/routes").Subrouter()
+	routeList.Use(auth.AdminMiddleware(db))
+	routeList.Methods("GET", "OPTIONS").HandlerFunc(admin.ListRoutesHandler(r, map[*mux.Router]string{
+		protected:      "user",
+		adminRoutes:    "admin",
+		routeList:      "admin",
+		wsRoutes:       "user",
+		scimRoutes:     "scim",
+		researchRoutes: "research",
+	}))
+
 	// Start server
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
 	}
 	log.Printf("Server starting on port %s...\n", port)
-	log.Fatal(http.ListenAndServe(":"+port, c.Handler(r)))
+	log.Fatal(http.ListenAndServe(":"+port, c.Handler(httputil.MethodsHandler(r))))
 }
@@ -0,0 +1,123 @@
+// Package accounts creates administrators, resets passwords and deletes
+// organization accounts. Deleted accounts are anonymized rather than removed,
+// so the organizations they worked with keep their chat transcripts, tasks
+// and reports without the deleted organization's identity.
+package accounts
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// DeletedName stands in for the name of a deleted organization
+const DeletedName = "Deleted organization"
+
+// minScrubbedNameLen is the shortest organization name replaced in other
+// users' notifications; shorter names would match unrelated words
+const minScrubbedNameLen = 3
+
+// Delete anonymizes an organization's account: it can no longer sign in, its
+// profile and contact details are cleared, and its name is replaced in other
+// users' notifications. Messages it sent stay with the conversations, shown as
+// sent by DeletedName.
+func Delete(db *sql.DB, userID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting account deletion: %v", err)
+	}
+	defer tx.Rollback()
+
+	var name, email string
+	err = tx.QueryRow(`
+		SELECT COALESCE(p.organization_name, ''), u.email
+		FROM users u
+		LEFT JOIN profiles p ON p.user_id = u.id
+		WHERE u.id = $1 AND u.deleted_at IS NULL
+		FOR UPDATE OF u
+	`, userID).Scan(&name, &email)
+	if err == sql.ErrNoRows {
+		return sql.ErrNoRows
+	} else if err != nil {
+		return fmt.Errorf("error loading account: %v", err)
+	}
+
+	if name = strings.TrimSpace(name); len(name) >= minScrubbedNameLen {
+		_, err = tx.Exec(`
+			UPDATE notifications
+			SET content = REPLACE(content, $2, $3)
+			WHERE user_id <> $1 AND strpos(content, $2) > 0
+		`, userID, name, DeletedName)
+		if err != nil {
+			return fmt.Errorf("error scrubbing notifications: %v", err)
+		}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE profiles
+		SET organization_name = '',
+			profile_picture_url = NULL,
+			profile_picture_alt = NULL,
+			mission_statement = '',
+			city = NULL,
+			zip_code = NULL,
+			ein = NULL,
+			website_url = '',
+			contact_email = '',
+			public_listing = false,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1
+	`, userID)
+	if err != nil {
+		return fmt.Errorf("error clearing profile: %v", err)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE provider_data
+		SET location_notes = '', eligibility_notes = '', application_link = ''
+		WHERE user_id = $1
+	`, userID)
+	if err != nil {
+		return fmt.Errorf("error clearing provider data: %v", err)
+	}
+
+	// The address must stay unique; .invalid can never receive mail
+	_, err = tx.Exec(`
+		UPDATE users
+		SET email = 'deleted-' || id || '@deleted.invalid',
+			password_hash = '!',
+			billing_email = NULL,
+			external_id = NULL,
+			sso_provider_id = NULL,
+			is_admin = false,
+			deactivated_at = COALESCE(deactivated_at, CURRENT_TIMESTAMP),
+			deleted_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`, userID)
+	if err != nil {
+		return fmt.Errorf("error anonymizing user: %v", err)
+	}
+
+	for _, query := range []string{
+		"DELETE FROM tokens WHERE user_id = $1",
+		"DELETE FROM notifications WHERE user_id = $1",
+		"DELETE FROM login_events WHERE user_id = $1",
+		"DELETE FROM password_reset_tokens WHERE user_id = $1",
+		"DELETE FROM magic_links WHERE user_id = $1",
+		"DELETE FROM message_templates WHERE user_id = $1",
+		"DELETE FROM moderation_flags WHERE user_id = $1",
+		"DELETE FROM bookmarks WHERE user_id = $1 OR bookmarked_id = $1",
+	} {
+		if _, err := tx.Exec(query, userID); err != nil {
+			return fmt.Errorf("error deleting account data: %v", err)
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM failed_logins WHERE email = $1", strings.ToLower(email)); err != nil {
+		return fmt.Errorf("error deleting account data: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing account deletion: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package accounts
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MinPasswordLength is the shortest password operators can set
+const MinPasswordLength = 8
+
+// ErrNotFound is returned when no live account has the given email or ID
+var ErrNotFound = errors.New("account not found")
+
+// Account identifies an account for operator tools
+type Account struct {
+	ID      int    `json:"id"`
+	Email   string `json:"email"`
+	Role    string `json:"role"`
+	IsAdmin bool   `json:"is_admin"`
+}
+
+// Find looks up a live account by ID, when ref is a number, or by email
+func Find(db *sql.DB, ref string) (*Account, error) {
+	var a Account
+	err := db.QueryRow(`
+		SELECT id, email, role, is_admin
+		FROM users
+		WHERE (id::text = $1 OR LOWER(email) = LOWER($1)) AND deleted_at IS NULL
+	`, strings.TrimSpace(ref)).Scan(&a.ID, &a.Email, &a.Role, &a.IsAdmin)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("error loading account: %v", err)
+	}
+	return &a, nil
+}
+
+// CreateAdmin gives an account administrator access, creating it with role
+// and password when no account has the email. Created accounts start
+// inactive, so they aren't matched until they complete a profile. It reports
+// whether the account was created.
+func CreateAdmin(db *sql.DB, email, password, role string) (*Account, bool, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	a, err := Find(db, email)
+	if err == nil {
+		if _, err := db.Exec(`UPDATE users SET is_admin = true WHERE id = $1`, a.ID); err != nil {
+			return nil, false, fmt.Errorf("error promoting account: %v", err)
+		}
+		a.IsAdmin = true
+		return a, false, nil
+	} else if err != ErrNotFound {
+		return nil, false, err
+	}
+
+	if role != "provider" && role != "recipient" {
+		return nil, false, fmt.Errorf("role must be provider or recipient")
+	}
+	hashedPassword, err := hashPassword(password)
+	if err != nil {
+		return nil, false, err
+	}
+
+	a = &Account{Email: email, Role: role, IsAdmin: true}
+	err = db.QueryRow(`
+		INSERT INTO users (email, password_hash, role, status, is_admin)
+		VALUES ($1, $2, $3, 'inactive', true)
+		RETURNING id
+	`, email, hashedPassword, role).Scan(&a.ID)
+	if err != nil {
+		return nil, false, fmt.Errorf("error creating account: %v", err)
+	}
+	return a, true, nil
+}
+
+// ResetPassword sets an account's password and signs it out everywhere
+func ResetPassword(db *sql.DB, userID int, password string) error {
+	hashedPassword, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting password reset: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE users
+		SET password_hash = $1, password_reset_required = false
+		WHERE id = $2 AND deleted_at IS NULL
+	`, hashedPassword, userID)
+	if err != nil {
+		return fmt.Errorf("error updating password: %v", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+
+	if _, err := tx.Exec(`DELETE FROM tokens WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("error revoking tokens: %v", err)
+	}
+	if _, err := tx.Exec(`UPDATE password_reset_tokens SET used_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND used_at IS NULL`, userID); err != nil {
+		return fmt.Errorf("error expiring password resets: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing password reset: %v", err)
+	}
+	return nil
+}
+
+func hashPassword(password string) (string, error) {
+	if len(password) < MinPasswordLength {
+		return "", fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("error hashing password: %v", err)
+	}
+	return string(hashedPassword), nil
+}
@@ -0,0 +1,342 @@
+// Package backups exports the database for operators: every table as CSV from
+// one consistent snapshot, zipped and uploaded to the configured object
+// storage, where backups past their retention are deleted.
+package backups
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"matcherator/backend/services/jobs"
+	"matcherator/backend/services/objectstore"
+)
+
+// ExportJob is the job kind that exports a backup
+const ExportJob = "backups.export"
+
+// Backup statuses; failed means the job was dead-lettered, expired that
+// retention deleted the object
+const (
+	StatusPending = "pending"
+	StatusRunning = "running"
+	StatusReady   = "ready"
+	StatusFailed  = "failed"
+	StatusExpired = "expired"
+)
+
+const (
+	// exportTimeout bounds one attempt at exporting a backup
+	exportTimeout = 2 * time.Hour
+
+	// DefaultRetention is how long backups are kept when BACKUP_RETENTION is
+	// not set
+	DefaultRetention = 30 * 24 * time.Hour
+
+	// purgeInterval is how often expired backups are deleted
+	purgeInterval = time.Hour
+)
+
+var (
+	// ErrNotFound is returned when no backup has the given ID
+	ErrNotFound = errors.New("backup not found")
+
+	// ErrNotConfigured is returned when there is no object storage to upload to
+	ErrNotConfigured = errors.New("object storage is not configured")
+)
+
+// Backup is an export requested by an admin
+type Backup struct {
+	ID          int        `json:"id"`
+	RequestedBy *int       `json:"requested_by"`
+	JobID       int64      `json:"job_id"`
+	Status      string     `json:"status"`
+	LastError   *string    `json:"last_error"`
+	Location    *string    `json:"location"` // Where the object is stored, while it is
+	SizeBytes   *int64     `json:"size_bytes"`
+	Tables      *int       `json:"tables"`
+	Rows        *int64     `json:"rows"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+}
+
+// ExportPayload is the payload of an ExportJob
+type ExportPayload struct {
+	BackupID int `json:"backup_id"`
+}
+
+// RegisterJobs installs the handler of ExportJob
+func RegisterJobs(db *sql.DB) {
+	jobs.RegisterWithTimeout(ExportJob, exportTimeout, ExportJobHandler(db))
+}
+
+// Retention is how long backups are kept, from BACKUP_RETENTION (a Go
+// duration). The most recent backup is kept regardless.
+func Retention() time.Duration {
+	if value := os.Getenv("BACKUP_RETENTION"); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d > 0 {
+			return d
+		}
+		log.Printf("Invalid BACKUP_RETENTION %q, using %s", value, DefaultRetention)
+	}
+	return DefaultRetention
+}
+
+// Create queues a backup requested by an admin. A backup that is already
+// pending or running is returned rather than duplicated.
+func Create(db *sql.DB, adminID int) (*Backup, error) {
+	if objectstore.Current() == nil {
+		return nil, ErrNotConfigured
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting backup: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Serialize requests so two admins can't queue concurrent exports
+	if _, err := tx.Exec(`LOCK TABLE backups IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+		return nil, fmt.Errorf("error locking backups: %v", err)
+	}
+
+	var backupID int
+	err = tx.QueryRow(`
+		SELECT b.id FROM backups b
+		JOIN jobs j ON j.id = b.job_id
+		WHERE b.completed_at IS NULL AND j.status IN ('pending', 'running')
+		ORDER BY b.id
+		LIMIT 1
+	`).Scan(&backupID)
+	if err == nil {
+		return Get(db, backupID)
+	} else if err != sql.ErrNoRows {
+		return nil, fmt.Errorf("error checking active backups: %v", err)
+	}
+
+	err = tx.QueryRow(`INSERT INTO backups (requested_by) VALUES ($1) RETURNING id`, adminID).Scan(&backupID)
+	if err != nil {
+		return nil, fmt.Errorf("error creating backup: %v", err)
+	}
+	jobID, err := jobs.Enqueue(tx, ExportJob, ExportPayload{BackupID: backupID})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("UPDATE backups SET job_id = $2 WHERE id = $1", backupID, jobID); err != nil {
+		return nil, fmt.Errorf("error linking backup job: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing backup: %v", err)
+	}
+	return Get(db, backupID)
+}
+
+// backupColumns are scanned by scanBackup. The status follows the job until
+// the backup is uploaded.
+const backupColumns = `
+	b.id, b.requested_by, COALESCE(b.job_id, 0),
+	CASE
+		WHEN b.completed_at IS NOT NULL AND b.object_key IS NULL THEN 'expired'
+		WHEN b.completed_at IS NOT NULL THEN 'ready'
+		WHEN j.status = 'dead' THEN 'failed'
+		WHEN j.status = 'running' THEN 'running'
+		ELSE 'pending'
+	END,
+	j.last_error, CASE WHEN b.object_key IS NOT NULL THEN b.location END,
+	b.size_bytes, b.table_count, b.row_count, b.created_at, b.completed_at, b.expires_at
+`
+
+// Get returns a backup by ID
+func Get(db *sql.DB, id int) (*Backup, error) {
+	backup, err := scanBackup(db.QueryRow(`
+		SELECT `+backupColumns+`
+		FROM backups b
+		LEFT JOIN jobs j ON j.id = b.job_id
+		WHERE b.id = $1
+	`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("error loading backup: %v", err)
+	}
+	return backup, nil
+}
+
+// List returns the most recent backups, ready or not
+func List(db *sql.DB, limit int) ([]Backup, error) {
+	rows, err := db.Query(`
+		SELECT `+backupColumns+`
+		FROM backups b
+		LEFT JOIN jobs j ON j.id = b.job_id
+		ORDER BY b.created_at DESC
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error listing backups: %v", err)
+	}
+	defer rows.Close()
+
+	backups := []Backup{}
+	for rows.Next() {
+		backup, err := scanBackup(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning backup: %v", err)
+		}
+		backups = append(backups, *backup)
+	}
+	return backups, rows.Err()
+}
+
+// scanBackup scans backupColumns
+func scanBackup(row interface{ Scan(...interface{}) error }) (*Backup, error) {
+	var b Backup
+	err := row.Scan(
+		&b.ID, &b.RequestedBy, &b.JobID, &b.Status, &b.LastError, &b.Location,
+		&b.SizeBytes, &b.Tables, &b.Rows, &b.CreatedAt, &b.CompletedAt, &b.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// ExportJobHandler exports queued backups and uploads them
+func ExportJobHandler(db *sql.DB) jobs.Handler {
+	return func(ctx context.Context, payload json.RawMessage) error {
+		var p ExportPayload
+		if err := json.Unmarshal(payload, &p); err != nil {
+			return jobs.Permanent(fmt.Errorf("error decoding backup: %v", err))
+		}
+
+		var exists bool
+		err := db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM backups WHERE id = $1)", p.BackupID).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("error loading backup: %v", err)
+		} else if !exists {
+			return jobs.Permanent(fmt.Errorf("backup %d no longer exists", p.BackupID))
+		}
+
+		store := objectstore.Current()
+		if store == nil {
+			return ErrNotConfigured
+		}
+
+		file, manifest, err := export(ctx, db)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(file.Name())
+		defer file.Close()
+
+		info, err := file.Stat()
+		if err != nil {
+			return fmt.Errorf("error reading backup: %v", err)
+		}
+		if _, err := file.Seek(0, 0); err != nil {
+			return fmt.Errorf("error reading backup: %v", err)
+		}
+
+		key := fmt.Sprintf("backups/matcherator-%s-%d.zip", manifest.SnapshotAt.Format("20060102T150405Z"), p.BackupID)
+		if err := store.Put(ctx, key, file, info.Size()); err != nil {
+			return err
+		}
+
+		_, err = db.ExecContext(ctx, `
+			UPDATE backups
+			SET object_key = $2, location = $3, size_bytes = $4, table_count = $5, row_count = $6,
+				completed_at = CURRENT_TIMESTAMP, expires_at = $7
+			WHERE id = $1
+		`, p.BackupID, key, store.Location(key), info.Size(), len(manifest.Tables), manifest.Rows(),
+			time.Now().Add(Retention()))
+		if err != nil {
+			deleteObject(store, key)
+			return fmt.Errorf("error storing backup: %v", err)
+		}
+		log.Printf("Backup %d uploaded to %s (%d bytes)", p.BackupID, store.Location(key), info.Size())
+		return nil
+	}
+}
+
+// StartPurger deletes expired backups every hour until ctx is done
+func StartPurger(ctx context.Context, db *sql.DB) {
+	go func() {
+		ticker := time.NewTicker(purgeInterval)
+		defer ticker.Stop()
+
+		for {
+			if err := purgeExpired(ctx, db); err != nil {
+				log.Printf("Error purging expired backups: %v", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// purgeExpired deletes the objects of backups past their expiry, except the
+// most recent backup, then forgets their keys
+func purgeExpired(ctx context.Context, db *sql.DB) error {
+	store := objectstore.Current()
+	if store == nil {
+		return nil
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, object_key FROM backups
+		WHERE object_key IS NOT NULL AND expires_at <= CURRENT_TIMESTAMP
+			AND id <> (
+				SELECT id FROM backups
+				WHERE object_key IS NOT NULL
+				ORDER BY completed_at DESC
+				LIMIT 1
+			)
+	`)
+	if err != nil {
+		return fmt.Errorf("error querying expired backups: %v", err)
+	}
+	defer rows.Close()
+
+	expired := map[int]string{}
+	for rows.Next() {
+		var id int
+		var key string
+		if err := rows.Scan(&id, &key); err != nil {
+			return fmt.Errorf("error scanning expired backup: %v", err)
+		}
+		expired[id] = key
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// The key is only forgotten once the object is gone, so failed deletes
+	// are retried on the next run
+	for id, key := range expired {
+		if err := store.Delete(ctx, key); err != nil {
+			log.Printf("Error deleting expired backup %d: %v", id, err)
+			continue
+		}
+		if _, err := db.ExecContext(ctx, "UPDATE backups SET object_key = NULL WHERE id = $1", id); err != nil {
+			return fmt.Errorf("error marking backup %d deleted: %v", id, err)
+		}
+	}
+	return nil
+}
+
+// deleteObject removes an uploaded backup, logging failures
+func deleteObject(store objectstore.Store, key string) {
+	if err := store.Delete(context.Background(), key); err != nil {
+		log.Printf("Error deleting backup object %s: %v", key, err)
+	}
+}
@@ -0,0 +1,201 @@
+package backups
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// nullValue stands for NULL in the CSV files, so they can be restored with
+// COPY ... WITH (FORMAT csv, HEADER, NULL '\N')
+const nullValue = `\N`
+
+// Manifest is manifest.json at the root of a backup
+type Manifest struct {
+	SnapshotAt time.Time    `json:"snapshot_at"`
+	Tables     []TableCount `json:"tables"`
+	NullValue  string       `json:"null_value"`
+}
+
+// TableCount is how many rows of a table a backup holds, in <table>.csv
+type TableCount struct {
+	Name string `json:"name"`
+	Rows int64  `json:"rows"`
+}
+
+// Rows is the number of rows across tables
+func (m *Manifest) Rows() int64 {
+	var n int64
+	for _, table := range m.Tables {
+		n += table.Rows
+	}
+	return n
+}
+
+// export writes every table of the schema to a ZIP in a temporary file, all
+// read in one repeatable-read transaction so the tables are consistent with
+// each other. The caller removes the file.
+func export(ctx context.Context, db *sql.DB) (*os.File, *Manifest, error) {
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, nil, fmt.Errorf("error starting export: %v", err)
+	}
+	defer tx.Rollback()
+
+	manifest := &Manifest{NullValue: nullValue}
+	if err := tx.QueryRowContext(ctx, "SELECT CURRENT_TIMESTAMP").Scan(&manifest.SnapshotAt); err != nil {
+		return nil, nil, fmt.Errorf("error starting export: %v", err)
+	}
+	manifest.SnapshotAt = manifest.SnapshotAt.UTC()
+
+	tables, err := listTables(ctx, tx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	file, err := os.CreateTemp("", "matcherator-backup-*.zip")
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating backup file: %v", err)
+	}
+	fail := func(err error) (*os.File, *Manifest, error) {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, nil, err
+	}
+
+	archive := zip.NewWriter(file)
+	for _, table := range tables {
+		n, err := exportTable(ctx, tx, archive, table)
+		if err != nil {
+			return fail(fmt.Errorf("error exporting %s: %v", table, err))
+		}
+		manifest.Tables = append(manifest.Tables, TableCount{Name: table, Rows: n})
+	}
+
+	entry, err := archive.Create("manifest.json")
+	if err != nil {
+		return fail(fmt.Errorf("error writing manifest: %v", err))
+	}
+	encoder := json.NewEncoder(entry)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(manifest); err != nil {
+		return fail(fmt.Errorf("error writing manifest: %v", err))
+	}
+	if err := archive.Close(); err != nil {
+		return fail(fmt.Errorf("error writing backup: %v", err))
+	}
+	return file, manifest, nil
+}
+
+// listTables returns the tables of the current schema
+func listTables(ctx context.Context, tx *sql.Tx) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT table_name FROM information_schema.tables
+		WHERE table_schema = current_schema() AND table_type = 'BASE TABLE'
+		ORDER BY table_name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("error listing tables: %v", err)
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("error scanning table: %v", err)
+		}
+		tables = append(tables, name)
+	}
+	return tables, rows.Err()
+}
+
+// listColumns returns the columns of a table a restore can COPY into, leaving
+// out generated columns, in table order
+func listColumns(ctx context.Context, tx *sql.Tx, table string) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT column_name FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = $1 AND is_generated = 'NEVER'
+		ORDER BY ordinal_position
+	`, table)
+	if err != nil {
+		return nil, fmt.Errorf("error listing columns: %v", err)
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("error scanning column: %v", err)
+		}
+		columns = append(columns, name)
+	}
+	return columns, rows.Err()
+}
+
+// exportTable writes a table to <table>.csv with a header row and returns the
+// number of rows
+func exportTable(ctx context.Context, tx *sql.Tx, archive *zip.Writer, table string) (int64, error) {
+	columns, err := listColumns(ctx, tx, table)
+	if err != nil {
+		return 0, err
+	}
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = pq.QuoteIdentifier(column)
+	}
+
+	rows, err := tx.QueryContext(ctx, "SELECT "+strings.Join(quoted, ", ")+" FROM "+pq.QuoteIdentifier(table))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	entry, err := archive.Create(table + ".csv")
+	if err != nil {
+		return 0, err
+	}
+	w := csv.NewWriter(entry)
+	if err := w.Write(columns); err != nil {
+		return 0, err
+	}
+
+	values := make([]sql.NullString, len(columns))
+	targets := make([]interface{}, len(columns))
+	for i := range values {
+		targets[i] = &values[i]
+	}
+	record := make([]string, len(columns))
+
+	var n int64
+	for rows.Next() {
+		if err := rows.Scan(targets...); err != nil {
+			return 0, err
+		}
+		for i, value := range values {
+			record[i] = nullValue
+			if value.Valid {
+				record[i] = value.String
+			}
+		}
+		if err := w.Write(record); err != nil {
+			return 0, err
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	w.Flush()
+	return n, w.Error()
+}
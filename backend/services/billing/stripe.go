@@ -0,0 +1,355 @@
+// Package billing sells plans through Stripe and keeps the entitlements
+// service in sync with the state of each organization's subscription.
+package billing
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"matcherator/backend/services/entitlements"
+)
+
+// ProviderStripe names Stripe in billing_customers and plan_subscriptions
+const ProviderStripe = "stripe"
+
+const stripeAPIURL = "https://api.stripe.com/v1"
+
+// signatureTolerance is how old a webhook signature may be, to limit replays
+const signatureTolerance = 5 * time.Minute
+
+// ErrNotConfigured is returned when STRIPE_SECRET_KEY is not set
+var ErrNotConfigured = errors.New("billing is not configured")
+
+// ErrInvalidSignature is returned for webhook payloads not signed by Stripe
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// Stripe is a client for the parts of the Stripe API used to sell plans
+type Stripe struct {
+	secretKey     string
+	webhookSecret string
+	prices        map[string]string // Plan name to Stripe price ID
+	client        *http.Client
+}
+
+// NewStripeFromEnv returns a client configured by STRIPE_SECRET_KEY,
+// STRIPE_WEBHOOK_SECRET and STRIPE_PRICE_<PLAN> (e.g. STRIPE_PRICE_PRO)
+func NewStripeFromEnv() (*Stripe, error) {
+	secretKey := os.Getenv("STRIPE_SECRET_KEY")
+	if secretKey == "" {
+		return nil, ErrNotConfigured
+	}
+
+	prices := map[string]string{}
+	for name := range entitlements.Plans {
+		if price := os.Getenv("STRIPE_PRICE_" + strings.ToUpper(name)); price != "" {
+			prices[name] = price
+		}
+	}
+
+	webhookSecret := os.Getenv("STRIPE_WEBHOOK_SECRET")
+	if webhookSecret == "" {
+		log.Printf("STRIPE_WEBHOOK_SECRET is not set, Stripe webhooks will be rejected")
+	}
+
+	return &Stripe{
+		secretKey:     secretKey,
+		webhookSecret: webhookSecret,
+		prices:        prices,
+		client:        &http.Client{Timeout: 15 * time.Second},
+	}, nil
+}
+
+// PriceFor returns the Stripe price of a plan, if it is sold
+func (s *Stripe) PriceFor(plan string) (string, bool) {
+	price, ok := s.prices[plan]
+	return price, ok
+}
+
+// PlanFor returns the plan a Stripe price sells
+func (s *Stripe) PlanFor(price string) (string, bool) {
+	for plan, id := range s.prices {
+		if id == price {
+			return plan, true
+		}
+	}
+	return "", false
+}
+
+// StripeSubscription is the part of a Stripe subscription object we use
+type StripeSubscription struct {
+	ID                string `json:"id"`
+	Customer          string `json:"customer"`
+	Status            string `json:"status"`
+	CancelAtPeriodEnd bool   `json:"cancel_at_period_end"`
+	CurrentPeriodEnd  int64  `json:"current_period_end"`
+	Items             struct {
+		Data []struct {
+			CurrentPeriodEnd int64 `json:"current_period_end"`
+			Price            struct {
+				ID string `json:"id"`
+			} `json:"price"`
+		} `json:"data"`
+	} `json:"items"`
+	Metadata map[string]string `json:"metadata"`
+}
+
+// PeriodEnd returns when the paid period ends. Newer API versions only report
+// it per item.
+func (s *StripeSubscription) PeriodEnd() *time.Time {
+	end := s.CurrentPeriodEnd
+	if end == 0 && len(s.Items.Data) > 0 {
+		end = s.Items.Data[0].CurrentPeriodEnd
+	}
+	if end == 0 {
+		return nil
+	}
+	t := time.Unix(end, 0).UTC()
+	return &t
+}
+
+// Price returns the price of the subscription's first item
+func (s *StripeSubscription) Price() string {
+	if len(s.Items.Data) == 0 {
+		return ""
+	}
+	return s.Items.Data[0].Price.ID
+}
+
+// Event is a Stripe webhook event
+type Event struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	Data struct {
+		Object json.RawMessage `json:"object"`
+	} `json:"data"`
+}
+
+// CreateCustomer creates a Stripe customer for an organization
+func (s *Stripe) CreateCustomer(userID int, email, name string) (string, error) {
+	form := url.Values{}
+	form.Set("email", email)
+	if name != "" {
+		form.Set("name", name)
+	}
+	form.Set("metadata[user_id]", strconv.Itoa(userID))
+
+	var customer struct {
+		ID string `json:"id"`
+	}
+	if err := s.post("/customers", form, &customer); err != nil {
+		return "", fmt.Errorf("error creating customer: %v", err)
+	}
+	return customer.ID, nil
+}
+
+// CreateCheckoutSession starts a hosted checkout for a subscription to price
+// and returns the URL to send the user to
+func (s *Stripe) CreateCheckoutSession(userID int, customerID, price, successURL, cancelURL string) (string, error) {
+	form := url.Values{}
+	form.Set("mode", "subscription")
+	form.Set("customer", customerID)
+	form.Set("client_reference_id", strconv.Itoa(userID))
+	form.Set("line_items[0][price]", price)
+	form.Set("line_items[0][quantity]", "1")
+	form.Set("subscription_data[metadata][user_id]", strconv.Itoa(userID))
+	form.Set("success_url", successURL)
+	form.Set("cancel_url", cancelURL)
+
+	var session struct {
+		URL string `json:"url"`
+	}
+	if err := s.post("/checkout/sessions", form, &session); err != nil {
+		return "", fmt.Errorf("error creating checkout session: %v", err)
+	}
+	return session.URL, nil
+}
+
+// CreatePortalSession returns the URL of Stripe's billing portal, where the
+// customer updates payment details or cancels
+func (s *Stripe) CreatePortalSession(customerID, returnURL string) (string, error) {
+	form := url.Values{}
+	form.Set("customer", customerID)
+	form.Set("return_url", returnURL)
+
+	var session struct {
+		URL string `json:"url"`
+	}
+	if err := s.post("/billing_portal/sessions", form, &session); err != nil {
+		return "", fmt.Errorf("error creating portal session: %v", err)
+	}
+	return session.URL, nil
+}
+
+// UpdateCustomerEmail changes where Stripe sends a customer's invoices and
+// receipts
+func (s *Stripe) UpdateCustomerEmail(customerID, email string) error {
+	form := url.Values{}
+	form.Set("email", email)
+
+	var customer struct {
+		ID string `json:"id"`
+	}
+	if err := s.post("/customers/"+url.PathEscape(customerID), form, &customer); err != nil {
+		return fmt.Errorf("error updating customer %s: %v", customerID, err)
+	}
+	return nil
+}
+
+// Invoice is the part of a Stripe invoice shown to the customer. Amounts are
+// in the currency's smallest unit (e.g. cents).
+type Invoice struct {
+	ID               string `json:"id"`
+	Number           string `json:"number"`
+	Status           string `json:"status"`
+	Currency         string `json:"currency"`
+	AmountDue        int64  `json:"amount_due"`
+	AmountPaid       int64  `json:"amount_paid"`
+	Created          int64  `json:"created"`
+	PeriodStart      int64  `json:"period_start"`
+	PeriodEnd        int64  `json:"period_end"`
+	HostedInvoiceURL string `json:"hosted_invoice_url"`
+	InvoicePDF       string `json:"invoice_pdf"`
+}
+
+// ListInvoices returns a page of the customer's invoices, newest first,
+// starting after the invoice startingAfter when set
+func (s *Stripe) ListInvoices(customerID string, limit int, startingAfter string) ([]Invoice, bool, error) {
+	query := url.Values{}
+	query.Set("customer", customerID)
+	query.Set("limit", strconv.Itoa(limit))
+	if startingAfter != "" {
+		query.Set("starting_after", startingAfter)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, stripeAPIURL+"/invoices?"+query.Encode(), nil)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var page struct {
+		Data    []Invoice `json:"data"`
+		HasMore bool      `json:"has_more"`
+	}
+	if err := s.do(req, &page); err != nil {
+		return nil, false, fmt.Errorf("error listing invoices: %v", err)
+	}
+	return page.Data, page.HasMore, nil
+}
+
+// GetSubscription fetches the current state of a subscription
+func (s *Stripe) GetSubscription(id string) (*StripeSubscription, error) {
+	req, err := http.NewRequest(http.MethodGet, stripeAPIURL+"/subscriptions/"+url.PathEscape(id), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var subscription StripeSubscription
+	if err := s.do(req, &subscription); err != nil {
+		return nil, fmt.Errorf("error fetching subscription %s: %v", id, err)
+	}
+	return &subscription, nil
+}
+
+// ParseEvent verifies the Stripe-Signature header of a webhook payload and
+// decodes the event
+func (s *Stripe) ParseEvent(payload []byte, signatureHeader string, now time.Time) (*Event, error) {
+	if s.webhookSecret == "" {
+		return nil, ErrInvalidSignature
+	}
+
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(signatureHeader, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+
+	signedAt, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return nil, ErrInvalidSignature
+	}
+	if age := now.Sub(time.Unix(signedAt, 0)); age > signatureTolerance || age < -signatureTolerance {
+		return nil, ErrInvalidSignature
+	}
+
+	mac := hmac.New(sha256.New, []byte(s.webhookSecret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	expected := mac.Sum(nil)
+
+	valid := false
+	for _, signature := range signatures {
+		decoded, err := hex.DecodeString(signature)
+		if err == nil && hmac.Equal(decoded, expected) {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return nil, ErrInvalidSignature
+	}
+
+	var event Event
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("error decoding event: %v", err)
+	}
+	return &event, nil
+}
+
+// post sends a form-encoded request to the Stripe API
+func (s *Stripe) post(path string, form url.Values, result interface{}) error {
+	req, err := http.NewRequest(http.MethodPost, stripeAPIURL+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return s.do(req, result)
+}
+
+// do authenticates and sends a request, decoding the JSON response
+func (s *Stripe) do(req *http.Request, result interface{}) error {
+	req.SetBasicAuth(s.secretKey, "")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error calling Stripe: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("error reading Stripe response: %v", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var apiError struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		json.Unmarshal(body, &apiError)
+		return fmt.Errorf("Stripe returned status %d: %s", resp.StatusCode, apiError.Error.Message)
+	}
+
+	if err := json.Unmarshal(body, result); err != nil {
+		return fmt.Errorf("error decoding Stripe response: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package billing
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+
+	"matcherator/backend/services/entitlements"
+)
+
+// Change is how a synced subscription changed the organization's plan
+type Change struct {
+	UserID   int
+	Previous *entitlements.Subscription // Nil for a first subscription
+	Current  entitlements.Subscription
+}
+
+// CustomerFor returns the organization's Stripe customer, or "" without one
+func CustomerFor(db *sql.DB, userID int) (string, error) {
+	var customerID string
+	err := db.QueryRow(`
+		SELECT customer_id FROM billing_customers WHERE user_id = $1 AND provider = $2
+	`, userID, ProviderStripe).Scan(&customerID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("error loading billing customer: %v", err)
+	}
+	return customerID, nil
+}
+
+// SaveCustomer links a Stripe customer to the organization
+func SaveCustomer(db *sql.DB, userID int, customerID string) error {
+	_, err := db.Exec(`
+		INSERT INTO billing_customers (user_id, provider, customer_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE
+		SET provider = EXCLUDED.provider, customer_id = EXCLUDED.customer_id
+	`, userID, ProviderStripe, customerID)
+	if err != nil {
+		return fmt.Errorf("error saving billing customer: %v", err)
+	}
+	return nil
+}
+
+// ClaimEvent records a webhook event as handled and reports whether it was
+// new. Release it when handling fails so Stripe's retry is processed.
+func ClaimEvent(db *sql.DB, event *Event) (bool, error) {
+	result, err := db.Exec(`
+		INSERT INTO billing_events (provider, event_id, event_type)
+		VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING
+	`, ProviderStripe, event.ID, event.Type)
+	if err != nil {
+		return false, fmt.Errorf("error recording billing event: %v", err)
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+// ReleaseEvent forgets a webhook event whose handling failed
+func ReleaseEvent(db *sql.DB, event *Event) error {
+	_, err := db.Exec(`
+		DELETE FROM billing_events WHERE provider = $1 AND event_id = $2
+	`, ProviderStripe, event.ID)
+	if err != nil {
+		return fmt.Errorf("error releasing billing event: %v", err)
+	}
+	return nil
+}
+
+// SyncSubscription fetches a subscription's current state from Stripe and
+// records it with the entitlements service. Fetching rather than trusting the
+// event payload makes out-of-order deliveries harmless. It returns nil when
+// there was nothing to record.
+func (s *Stripe) SyncSubscription(db *sql.DB, subscriptionID string) (*Change, error) {
+	subscription, err := s.GetSubscription(subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	status, ok := subscriptionStatus(subscription.Status)
+	if !ok {
+		// Checkout not finished yet; the next update will say how it went
+		return nil, nil
+	}
+
+	plan, ok := s.PlanFor(subscription.Price())
+	if !ok {
+		return nil, fmt.Errorf("subscription %s has unknown price %q", subscription.ID, subscription.Price())
+	}
+
+	userID, err := userForSubscription(db, subscription)
+	if err != nil {
+		return nil, err
+	}
+
+	previous, err := entitlements.LoadSubscription(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// A late event about an old subscription must not end a newer one
+	if previous != nil && previous.Provider == ProviderStripe && previous.ExternalID != nil &&
+		*previous.ExternalID != subscription.ID && previous.Status != entitlements.StatusCanceled &&
+		status == entitlements.StatusCanceled {
+		return nil, nil
+	}
+
+	current := entitlements.Subscription{
+		Plan:              plan,
+		Status:            status,
+		Provider:          ProviderStripe,
+		ExternalID:        &subscription.ID,
+		CurrentPeriodEnd:  subscription.PeriodEnd(),
+		CancelAtPeriodEnd: subscription.CancelAtPeriodEnd,
+	}
+	if err := entitlements.SetSubscription(db, userID, current); err != nil {
+		return nil, err
+	}
+
+	stored, err := entitlements.LoadSubscription(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &Change{UserID: userID, Previous: previous, Current: *stored}, nil
+}
+
+// userForSubscription finds the organization a subscription belongs to, by
+// its customer or the user ID checkout put in its metadata
+func userForSubscription(db *sql.DB, subscription *StripeSubscription) (int, error) {
+	var userID int
+	err := db.QueryRow(`
+		SELECT user_id FROM billing_customers WHERE provider = $1 AND customer_id = $2
+	`, ProviderStripe, subscription.Customer).Scan(&userID)
+	if err == nil {
+		return userID, nil
+	} else if err != sql.ErrNoRows {
+		return 0, fmt.Errorf("error looking up billing customer: %v", err)
+	}
+
+	userID, err = strconv.Atoi(subscription.Metadata["user_id"])
+	if err != nil {
+		return 0, fmt.Errorf("subscription %s belongs to unknown customer %s", subscription.ID, subscription.Customer)
+	}
+	if err := SaveCustomer(db, userID, subscription.Customer); err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
+
+// subscriptionStatus maps a Stripe subscription status onto ours. Incomplete
+// subscriptions (first payment pending) are not mapped.
+func subscriptionStatus(status string) (string, bool) {
+	switch status {
+	case "active", "trialing":
+		return entitlements.StatusActive, true
+	case "past_due", "unpaid":
+		return entitlements.StatusPastDue, true
+	case "canceled", "incomplete_expired", "paused":
+		return entitlements.StatusCanceled, true
+	default:
+		return "", false
+	}
+}
+
+// BillingEmail returns where billing mail for the organization goes: its
+// billing email when set, its login email otherwise
+func BillingEmail(db *sql.DB, userID int) (string, error) {
+	var email string
+	err := db.QueryRow(`
+		SELECT COALESCE(billing_email, email) FROM users WHERE id = $1
+	`, userID).Scan(&email)
+	if err != nil {
+		return "", fmt.Errorf("error loading billing email: %v", err)
+	}
+	return email, nil
+}
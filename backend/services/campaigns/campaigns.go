@@ -0,0 +1,537 @@
+// Package campaigns sends a provider's announcement to their connections as
+// individual chat messages. Recipients are chosen when the campaign is
+// created; a background job delivers to them one at a time, throttled, and
+// records the outcome per recipient so an interrupted send resumes where it
+// stopped.
+package campaigns
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+
+	"matcherator/backend/services/jobs"
+)
+
+// SendJob is the job kind that delivers a campaign
+const SendJob = "campaigns.send"
+
+// Campaign statuses
+const (
+	StatusQueued   = "queued"
+	StatusSending  = "sending"
+	StatusSent     = "sent"
+	StatusCanceled = "canceled"
+)
+
+// Delivery statuses. Skipped recipients could no longer be messaged when
+// their turn came, e.g. they opted out of chat or were deactivated.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliverySkipped   = "skipped"
+	DeliveryCanceled  = "canceled"
+)
+
+const (
+	// MaxRecipients caps the recipients of one campaign
+	MaxRecipients = 500
+
+	// MinInterval is how long a provider waits between campaigns
+	MinInterval = 24 * time.Hour
+
+	// sendInterval throttles delivery to about five messages a second
+	sendInterval = 200 * time.Millisecond
+
+	// sendTimeout bounds one attempt at delivering a campaign
+	sendTimeout = time.Hour
+)
+
+// Hooks let the chat layer push delivered messages to open chats and tell
+// the provider when a campaign is done. Either may be nil.
+type Hooks struct {
+	Delivered func(Message)
+	Finished  func(*Campaign)
+}
+
+var (
+	// ErrNotFound is returned for unknown campaigns, or those of another provider
+	ErrNotFound = errors.New("campaign not found")
+	// ErrNoRecipients is returned when the filter matches no connection
+	ErrNoRecipients = errors.New("no connections match the filter")
+	// ErrTooManyRecipients is returned when the filter matches more than MaxRecipients
+	ErrTooManyRecipients = errors.New("too many recipients")
+	// ErrTooSoon is returned when the provider sent a campaign within MinInterval
+	ErrTooSoon = errors.New("campaign sent too recently")
+	// ErrInProgress is returned while the provider's previous campaign is being sent
+	ErrInProgress = errors.New("a campaign is still being sent")
+	// ErrFinished is returned when canceling a campaign that is done
+	ErrFinished = errors.New("campaign already finished")
+)
+
+// Filter narrows the recipients to a subset of the provider's connections.
+// Empty fields don't filter; set fields must all match.
+type Filter struct {
+	Sectors       []string `json:"sectors,omitempty"` // recipient works in any of these
+	States        []string `json:"states,omitempty"`  // recipient is based in any of these
+	ConnectionIDs []int    `json:"connection_ids,omitempty"`
+}
+
+// Campaign is a provider's announcement and its delivery progress
+type Campaign struct {
+	ID          int        `json:"id"`
+	ProviderID  int        `json:"provider_id"`
+	Content     string     `json:"content"`
+	Filter      Filter     `json:"filter"`
+	Status      string     `json:"status"`
+	Recipients  int        `json:"recipients"`
+	Delivered   int        `json:"delivered"`
+	Skipped     int        `json:"skipped"`
+	Read        int        `json:"read"` // delivered messages the recipient has read
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+}
+
+// Delivery is a campaign's message to one recipient
+type Delivery struct {
+	CampaignID    int        `json:"-"`
+	ConnectionID  int        `json:"connection_id"`
+	RecipientID   int        `json:"recipient_id"`
+	RecipientName string     `json:"recipient_name"`
+	Status        string     `json:"status"`
+	MessageID     *int       `json:"message_id"`
+	Read          bool       `json:"read"`
+	DeliveredAt   *time.Time `json:"delivered_at"`
+}
+
+// SendPayload is the payload of a SendJob
+type SendPayload struct {
+	CampaignID int `json:"campaign_id"`
+}
+
+// RegisterJobs installs the handler of SendJob
+func RegisterJobs(db *sql.DB, hooks Hooks) {
+	jobs.RegisterWithTimeout(SendJob, sendTimeout, SendJobHandler(db, hooks))
+}
+
+// SendJobHandler delivers queued campaigns. A retried job skips the
+// recipients already messaged.
+func SendJobHandler(db *sql.DB, hooks Hooks) jobs.Handler {
+	return func(ctx context.Context, payload json.RawMessage) error {
+		var p SendPayload
+		if err := json.Unmarshal(payload, &p); err != nil {
+			return jobs.Permanent(fmt.Errorf("error decoding campaign job: %v", err))
+		}
+
+		campaign, err := Send(ctx, db, p.CampaignID, hooks.Delivered)
+		if err != nil {
+			return err
+		}
+		if campaign != nil && hooks.Finished != nil {
+			hooks.Finished(campaign)
+		}
+		return nil
+	}
+}
+
+// recipientsQuery selects the provider's ($1) connections with a recipient
+// that can be messaged: both sides active and opted in to chat, as the chat
+// socket requires. $2-$4 are the filter's sectors, states and connection IDs.
+const recipientsQuery = `
+	SELECT c.id, r.id
+	FROM connections c
+	JOIN users pu ON pu.id = $1
+	JOIN users r ON r.id = CASE WHEN c.initiator_id = $1 THEN c.target_id ELSE c.initiator_id END
+	JOIN profiles pp ON pp.user_id = pu.id
+	JOIN profiles rp ON rp.user_id = r.id
+	WHERE (c.initiator_id = $1 OR c.target_id = $1)
+		AND pu.role = 'provider' AND r.role = 'recipient'
+		AND pu.status = 'active' AND r.status = 'active'
+		AND pu.deleted_at IS NULL AND r.deleted_at IS NULL
+		AND pp.chat_opt_in AND rp.chat_opt_in
+		AND (cardinality($2::text[]) = 0 OR rp.sectors && $2::text[])
+		AND (cardinality($3::text[]) = 0 OR rp.state = ANY($3::text[]))
+		AND (cardinality($4::int[]) = 0 OR c.id = ANY($4::int[]))
+`
+
+// filterArgs returns the filter as arguments $2-$4 of recipientsQuery
+func filterArgs(filter Filter) []interface{} {
+	return []interface{}{
+		pq.Array(nonNil(filter.Sectors)),
+		pq.Array(nonNil(filter.States)),
+		connectionIDs(filter),
+	}
+}
+
+// connectionIDs returns the filter's connection IDs as an array argument,
+// empty rather than NULL when unset
+func connectionIDs(filter Filter) pq.Int64Array {
+	ids := pq.Int64Array{}
+	for _, id := range filter.ConnectionIDs {
+		ids = append(ids, int64(id))
+	}
+	return ids
+}
+
+// CountRecipients returns how many connections the filter would message
+func CountRecipients(db *sql.DB, providerID int, filter Filter) (int, error) {
+	var count int
+	args := append([]interface{}{providerID}, filterArgs(filter)...)
+	if err := db.QueryRow("SELECT COUNT(*) FROM ("+recipientsQuery+") recipients", args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("error counting campaign recipients: %v", err)
+	}
+	return count, nil
+}
+
+// Create records a campaign to the connections matching the filter and
+// queues its delivery. reserve, e.g. taking a plan quota, is called once the
+// campaign passes the anti-spam limits and before it is committed; its error
+// aborts the campaign.
+func Create(db *sql.DB, providerID int, content string, filter Filter, reserve func() error) (*Campaign, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting campaign: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Serialize campaigns of the same provider so the limits hold under concurrent requests
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext('campaigns'), $1)", providerID); err != nil {
+		return nil, fmt.Errorf("error locking campaigns: %v", err)
+	}
+
+	var inProgress bool
+	var lastCreated sql.NullTime
+	err = tx.QueryRow(`
+		SELECT
+			COALESCE(bool_or(status IN ('queued', 'sending')), false),
+			MAX(created_at) FILTER (WHERE status <> 'canceled' OR delivered > 0)
+		FROM (
+			SELECT c.status, c.created_at,
+				(SELECT COUNT(*) FROM campaign_deliveries d WHERE d.campaign_id = c.id AND d.status = 'delivered') AS delivered
+			FROM campaigns c
+			WHERE c.provider_id = $1
+		) campaigns
+	`, providerID).Scan(&inProgress, &lastCreated)
+	if err != nil {
+		return nil, fmt.Errorf("error checking previous campaigns: %v", err)
+	}
+	if inProgress {
+		return nil, ErrInProgress
+	}
+	if lastCreated.Valid && time.Since(lastCreated.Time) < MinInterval {
+		return nil, ErrTooSoon
+	}
+
+	var campaignID int
+	err = tx.QueryRow(`
+		INSERT INTO campaigns (provider_id, content, sectors, states, connection_ids)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`, providerID, content, pq.Array(nonNil(filter.Sectors)), pq.Array(nonNil(filter.States)), connectionIDs(filter)).Scan(&campaignID)
+	if err != nil {
+		return nil, fmt.Errorf("error creating campaign: %v", err)
+	}
+
+	args := append([]interface{}{providerID}, filterArgs(filter)...)
+	args = append(args, campaignID)
+	result, err := tx.Exec(`
+		INSERT INTO campaign_deliveries (campaign_id, connection_id, recipient_id)
+		SELECT $5, recipients.* FROM (`+recipientsQuery+`) recipients
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error selecting campaign recipients: %v", err)
+	}
+	recipients, _ := result.RowsAffected()
+	if recipients == 0 {
+		return nil, ErrNoRecipients
+	}
+	if recipients > MaxRecipients {
+		return nil, ErrTooManyRecipients
+	}
+
+	if reserve != nil {
+		if err := reserve(); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := jobs.Enqueue(tx, SendJob, SendPayload{CampaignID: campaignID}); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing campaign: %v", err)
+	}
+	return Get(db, providerID, campaignID)
+}
+
+// campaignColumns are scanned by scanCampaign
+const campaignColumns = `
+	c.id, c.provider_id, c.content, c.sectors, c.states, c.connection_ids, c.status, c.created_at, c.completed_at,
+	(SELECT COUNT(*) FROM campaign_deliveries d WHERE d.campaign_id = c.id),
+	(SELECT COUNT(*) FROM campaign_deliveries d WHERE d.campaign_id = c.id AND d.status = 'delivered'),
+	(SELECT COUNT(*) FROM campaign_deliveries d WHERE d.campaign_id = c.id AND d.status = 'skipped'),
+	(SELECT COUNT(*) FROM campaign_deliveries d JOIN chat_messages cm ON cm.id = d.message_id
+		WHERE d.campaign_id = c.id AND cm.read)
+`
+
+// Get returns one of the provider's campaigns
+func Get(db *sql.DB, providerID, id int) (*Campaign, error) {
+	campaign, err := scanCampaign(db.QueryRow(`
+		SELECT `+campaignColumns+`
+		FROM campaigns c
+		WHERE c.id = $1 AND c.provider_id = $2
+	`, id, providerID))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("error loading campaign: %v", err)
+	}
+	return campaign, nil
+}
+
+// List returns the provider's campaigns, newest first
+func List(db *sql.DB, providerID int) ([]Campaign, error) {
+	rows, err := db.Query(`
+		SELECT `+campaignColumns+`
+		FROM campaigns c
+		WHERE c.provider_id = $1
+		ORDER BY c.created_at DESC
+	`, providerID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing campaigns: %v", err)
+	}
+	defer rows.Close()
+
+	campaigns := []Campaign{}
+	for rows.Next() {
+		campaign, err := scanCampaign(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning campaign: %v", err)
+		}
+		campaigns = append(campaigns, *campaign)
+	}
+	return campaigns, rows.Err()
+}
+
+// Deliveries returns the campaign's per-recipient delivery status
+func Deliveries(db *sql.DB, campaignID int) ([]Delivery, error) {
+	rows, err := db.Query(`
+		SELECT d.campaign_id, d.connection_id, d.recipient_id, COALESCE(p.organization_name, ''),
+			d.status, d.message_id, COALESCE(cm.read, false), d.delivered_at
+		FROM campaign_deliveries d
+		LEFT JOIN profiles p ON p.user_id = d.recipient_id
+		LEFT JOIN chat_messages cm ON cm.id = d.message_id
+		WHERE d.campaign_id = $1
+		ORDER BY d.connection_id
+	`, campaignID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing campaign deliveries: %v", err)
+	}
+	defer rows.Close()
+
+	deliveries := []Delivery{}
+	for rows.Next() {
+		var d Delivery
+		if err := rows.Scan(&d.CampaignID, &d.ConnectionID, &d.RecipientID, &d.RecipientName, &d.Status, &d.MessageID, &d.Read, &d.DeliveredAt); err != nil {
+			return nil, fmt.Errorf("error scanning campaign delivery: %v", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// Cancel stops a campaign; messages already delivered stay
+func Cancel(db *sql.DB, providerID, id int) (*Campaign, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting cancellation: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE campaigns SET status = 'canceled', completed_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND provider_id = $2 AND status IN ('queued', 'sending')
+	`, id, providerID)
+	if err != nil {
+		return nil, fmt.Errorf("error canceling campaign: %v", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		if _, err := Get(db, providerID, id); err != nil {
+			return nil, err
+		}
+		return nil, ErrFinished
+	}
+	if _, err := tx.Exec(`
+		UPDATE campaign_deliveries SET status = 'canceled'
+		WHERE campaign_id = $1 AND status = 'pending'
+	`, id); err != nil {
+		return nil, fmt.Errorf("error canceling campaign deliveries: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing cancellation: %v", err)
+	}
+	return Get(db, providerID, id)
+}
+
+// Message is a campaign message just stored in a chat
+type Message struct {
+	CampaignID   int
+	ProviderID   int
+	ConnectionID int
+	RecipientID  int
+	MessageID    int
+	Content      string
+	SentAt       time.Time
+}
+
+// Send delivers a campaign's pending messages, throttled, calling delivered
+// after each one is stored. It stops early when the campaign is canceled and
+// returns the campaign once finished.
+func Send(ctx context.Context, db *sql.DB, campaignID int, delivered func(Message)) (*Campaign, error) {
+	var providerID int
+	var content, status string
+	err := db.QueryRowContext(ctx, `
+		UPDATE campaigns SET status = 'sending'
+		WHERE id = $1 AND status IN ('queued', 'sending')
+		RETURNING provider_id, content, status
+	`, campaignID).Scan(&providerID, &content, &status)
+	if err == sql.ErrNoRows {
+		// Canceled or deleted before it was sent
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error starting campaign: %v", err)
+	}
+
+	for {
+		message, more, err := deliverNext(ctx, db, campaignID, providerID, content)
+		if err != nil {
+			return nil, err
+		}
+		if !more {
+			break
+		}
+		if message != nil && delivered != nil {
+			delivered(*message)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(sendInterval):
+		}
+	}
+
+	if _, err := db.ExecContext(ctx, `
+		UPDATE campaigns SET status = 'sent', completed_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND status = 'sending'
+	`, campaignID); err != nil {
+		return nil, fmt.Errorf("error completing campaign: %v", err)
+	}
+	return Get(db, providerID, campaignID)
+}
+
+// deliverNext delivers the next pending message of a campaign, reporting
+// false once none is left or the campaign was canceled. The returned message
+// is nil when the recipient was skipped.
+func deliverNext(ctx context.Context, db *sql.DB, campaignID, providerID int, content string) (*Message, bool, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, false, fmt.Errorf("error starting delivery: %v", err)
+	}
+	defer tx.Rollback()
+
+	var connectionID, recipientID int
+	err = tx.QueryRowContext(ctx, `
+		SELECT d.connection_id, d.recipient_id
+		FROM campaign_deliveries d
+		JOIN campaigns c ON c.id = d.campaign_id AND c.status = 'sending'
+		WHERE d.campaign_id = $1 AND d.status = 'pending'
+		ORDER BY d.connection_id
+		LIMIT 1
+		FOR UPDATE OF d SKIP LOCKED
+	`, campaignID).Scan(&connectionID, &recipientID)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, fmt.Errorf("error loading next campaign delivery: %v", err)
+	}
+
+	// Recheck the recipient, who may have opted out or left since the campaign was created
+	var reachable bool
+	args := append([]interface{}{providerID}, filterArgs(Filter{ConnectionIDs: []int{connectionID}})...)
+	err = tx.QueryRowContext(ctx, "SELECT EXISTS ("+recipientsQuery+")", args...).Scan(&reachable)
+	if err != nil {
+		return nil, false, fmt.Errorf("error checking campaign recipient: %v", err)
+	}
+	if !reachable {
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE campaign_deliveries SET status = 'skipped'
+			WHERE campaign_id = $1 AND connection_id = $2
+		`, campaignID, connectionID); err != nil {
+			return nil, false, fmt.Errorf("error skipping campaign recipient: %v", err)
+		}
+		return nil, true, tx.Commit()
+	}
+
+	message := Message{
+		CampaignID:   campaignID,
+		ProviderID:   providerID,
+		ConnectionID: connectionID,
+		RecipientID:  recipientID,
+		Content:      content,
+		SentAt:       time.Now(),
+	}
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO chat_messages (match_id, sender_id, content, timestamp)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`, connectionID, providerID, content, message.SentAt).Scan(&message.MessageID)
+	if err != nil {
+		return nil, false, fmt.Errorf("error storing campaign message: %v", err)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE campaign_deliveries SET status = 'delivered', message_id = $3, delivered_at = $4
+		WHERE campaign_id = $1 AND connection_id = $2
+	`, campaignID, connectionID, message.MessageID, message.SentAt); err != nil {
+		return nil, false, fmt.Errorf("error recording campaign delivery: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, false, fmt.Errorf("error committing campaign delivery: %v", err)
+	}
+	return &message, true, nil
+}
+
+// scanCampaign scans campaignColumns
+func scanCampaign(row interface{ Scan(...interface{}) error }) (*Campaign, error) {
+	var c Campaign
+	var connectionIDs []int64
+	err := row.Scan(
+		&c.ID, &c.ProviderID, &c.Content,
+		pq.Array(&c.Filter.Sectors), pq.Array(&c.Filter.States), pq.Array(&connectionIDs),
+		&c.Status, &c.CreatedAt, &c.CompletedAt,
+		&c.Recipients, &c.Delivered, &c.Skipped, &c.Read,
+	)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range connectionIDs {
+		c.Filter.ConnectionIDs = append(c.Filter.ConnectionIDs, int(id))
+	}
+	return &c, nil
+}
+
+// nonNil returns values, or an empty slice for nil so pq sends '{}'
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
@@ -0,0 +1,64 @@
+// Package chat decides who may chat with whom.
+package chat
+
+import (
+	"database/sql"
+
+	"matcherator/backend/services/matches"
+)
+
+// party is one side of a connection, as far as chatting goes
+type party struct {
+	ID        int
+	Role      string
+	DualRole  bool
+	Active    bool // active and not deleted
+	ChatOptIn bool
+}
+
+// CanChat reports whether the user may chat in a connection: they take part
+// in it, it pairs a provider with a recipient, and both sides are active,
+// opted in to chat and not deleted. Either side may have initiated the
+// connection, and a dual-role user counts as whichever side matching puts
+// them on.
+func CanChat(db *sql.DB, matchID, userID int) (bool, error) {
+	var initiator, target party
+	err := db.QueryRow(`
+		SELECT ui.id, ui.role, ui.dual_role,
+			ui.status = 'active' AND ui.deleted_at IS NULL,
+			COALESCE(pi.chat_opt_in, false),
+			ut.id, ut.role, ut.dual_role,
+			ut.status = 'active' AND ut.deleted_at IS NULL,
+			COALESCE(pt.chat_opt_in, false)
+		FROM connections c
+		JOIN users ui ON ui.id = c.initiator_id
+		JOIN users ut ON ut.id = c.target_id
+		JOIN profiles pi ON pi.user_id = ui.id
+		JOIN profiles pt ON pt.user_id = ut.id
+		WHERE c.id = $1
+	`, matchID).Scan(
+		&initiator.ID, &initiator.Role, &initiator.DualRole, &initiator.Active, &initiator.ChatOptIn,
+		&target.ID, &target.Role, &target.DualRole, &target.Active, &target.ChatOptIn,
+	)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return canChat(userID, initiator, target), nil
+}
+
+// canChat is CanChat's decision for a loaded connection
+func canChat(userID int, initiator, target party) bool {
+	if userID != initiator.ID && userID != target.ID {
+		return false
+	}
+	if !matches.CanPair(
+		&matches.MatchProfile{Role: initiator.Role, DualRole: initiator.DualRole},
+		&matches.MatchProfile{Role: target.Role, DualRole: target.DualRole},
+	) {
+		return false
+	}
+	return initiator.Active && target.Active && initiator.ChatOptIn && target.ChatOptIn
+}
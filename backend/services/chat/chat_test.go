@@ -0,0 +1,42 @@
+package chat
+
+import "testing"
+
+func TestCanChat(t *testing.T) {
+	provider := party{ID: 1, Role: "provider", Active: true, ChatOptIn: true}
+	recipient := party{ID: 2, Role: "recipient", Active: true, ChatOptIn: true}
+	otherRecipient := party{ID: 3, Role: "recipient", Active: true, ChatOptIn: true}
+	dualRecipient := party{ID: 4, Role: "recipient", DualRole: true, Active: true, ChatOptIn: true}
+	optedOut := recipient
+	optedOut.ChatOptIn = false
+	inactive := recipient
+	inactive.Active = false
+
+	tests := []struct {
+		name              string
+		initiator, target party
+		userID            int
+		want              bool
+	}{
+		{"provider initiated, provider chats", provider, recipient, 1, true},
+		{"provider initiated, recipient chats", provider, recipient, 2, true},
+		{"recipient initiated, recipient chats", recipient, provider, 2, true},
+		{"recipient initiated, provider chats", recipient, provider, 1, true},
+		{"outsider", provider, recipient, 9, false},
+		{"outsider, recipient initiated", recipient, provider, 9, false},
+		{"two recipients", recipient, otherRecipient, 2, false},
+		{"dual-role recipient initiated with a recipient", dualRecipient, recipient, 2, true},
+		{"recipient initiated with a dual-role recipient", recipient, dualRecipient, 2, true},
+		{"recipient opted out, provider initiated", provider, optedOut, 1, false},
+		{"recipient opted out, recipient initiated", optedOut, provider, 1, false},
+		{"recipient inactive, provider initiated", provider, inactive, 1, false},
+		{"recipient inactive, recipient initiated", inactive, provider, 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := canChat(tt.userID, tt.initiator, tt.target); got != tt.want {
+				t.Errorf("canChat(%d) = %v, want %v", tt.userID, got, tt.want)
+			}
+		})
+	}
+}
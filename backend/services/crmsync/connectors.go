@@ -0,0 +1,250 @@
+package crmsync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"matcherator/backend/services/jobs"
+)
+
+// requestTimeout bounds a single request to a CRM
+const requestTimeout = 15 * time.Second
+
+// salesforceAPIVersion is the REST API version used for Salesforce requests
+const salesforceAPIVersion = "v59.0"
+
+var client = &http.Client{Timeout: requestTimeout}
+
+// errNotFound is returned by connectors when the record to update no longer exists
+var errNotFound = errors.New("CRM record not found")
+
+// connector pushes records to one organization's CRM
+type connector interface {
+	// push creates a record with fields, or updates the record with externalID,
+	// and returns the record's ID in the CRM
+	push(ctx context.Context, externalID string, fields map[string]string) (string, error)
+}
+
+// newConnector returns the connector for config
+func newConnector(config Config, credentials Credentials) (connector, error) {
+	switch config.Provider {
+	case ProviderSalesforce:
+		return &salesforce{config: config, credentials: credentials}, nil
+	case ProviderGeneric:
+		return &generic{config: config, credentials: credentials}, nil
+	default:
+		return nil, fmt.Errorf("unknown CRM provider %q", config.Provider)
+	}
+}
+
+// salesforce creates and updates sObjects through the Salesforce REST API
+type salesforce struct {
+	config      Config
+	credentials Credentials
+}
+
+// salesforceSession is an access token and the instance it is valid for
+type salesforceSession struct {
+	AccessToken string `json:"access_token"`
+	InstanceURL string `json:"instance_url"`
+}
+
+// salesforceSessions caches access tokens by refresh token. Salesforce does not
+// report an expiry, so a session is dropped when the API rejects it.
+var salesforceSessions sync.Map
+
+func (s *salesforce) push(ctx context.Context, externalID string, fields map[string]string) (string, error) {
+	id, err := s.pushOnce(ctx, externalID, fields)
+	if errors.Is(err, errUnauthorized) {
+		salesforceSessions.Delete(s.credentials.RefreshToken)
+		id, err = s.pushOnce(ctx, externalID, fields)
+	}
+	if errors.Is(err, errNotFound) {
+		// The record was deleted in Salesforce; start a new one
+		id, err = s.pushOnce(ctx, "", fields)
+	}
+	return id, err
+}
+
+// errUnauthorized is returned when Salesforce rejects the access token
+var errUnauthorized = errors.New("salesforce session expired")
+
+func (s *salesforce) pushOnce(ctx context.Context, externalID string, fields map[string]string) (string, error) {
+	session, err := s.session(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	instanceURL := strings.TrimRight(session.InstanceURL, "/")
+	if instanceURL == "" {
+		instanceURL = s.config.EndpointURL
+	}
+	endpoint := instanceURL + "/services/data/" + salesforceAPIVersion + "/sobjects/" + s.config.ObjectName
+	method := http.MethodPost
+	if externalID != "" {
+		endpoint += "/" + url.PathEscape(externalID)
+		method = http.MethodPatch
+	}
+
+	resp, err := sendJSON(ctx, method, endpoint, "Bearer "+session.AccessToken, fields)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusUnauthorized:
+		return "", errUnauthorized
+	case http.StatusNotFound:
+		if externalID != "" {
+			return "", errNotFound
+		}
+	}
+	if err := responseError("Salesforce", resp); err != nil {
+		return "", err
+	}
+	if externalID != "" {
+		return externalID, nil
+	}
+	return decodeID(resp.Body)
+}
+
+// session returns a cached access token or exchanges the refresh token for one
+func (s *salesforce) session(ctx context.Context) (salesforceSession, error) {
+	if cached, ok := salesforceSessions.Load(s.credentials.RefreshToken); ok {
+		return cached.(salesforceSession), nil
+	}
+
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"client_id":     {s.credentials.ClientID},
+		"client_secret": {s.credentials.ClientSecret},
+		"refresh_token": {s.credentials.RefreshToken},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.config.LoginURL+"/services/oauth2/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return salesforceSession{}, jobs.Permanent(fmt.Errorf("error creating Salesforce token request: %v", err))
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return salesforceSession{}, fmt.Errorf("error requesting Salesforce token: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// A revoked or wrong refresh token is a 400 invalid_grant, which retrying won't fix
+	if err := responseError("Salesforce login", resp); err != nil {
+		return salesforceSession{}, err
+	}
+
+	var session salesforceSession
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&session); err != nil || session.AccessToken == "" {
+		return salesforceSession{}, fmt.Errorf("error decoding Salesforce token response: %v", err)
+	}
+	salesforceSessions.Store(s.credentials.RefreshToken, session)
+	return session, nil
+}
+
+// generic POSTs records as JSON objects to an endpoint, and PATCHes
+// endpoint/{id} to update them. The response's "id" identifies the record.
+type generic struct {
+	config      Config
+	credentials Credentials
+}
+
+func (g *generic) push(ctx context.Context, externalID string, fields map[string]string) (string, error) {
+	endpoint := g.config.EndpointURL
+	method := http.MethodPost
+	if externalID != "" {
+		endpoint += "/" + url.PathEscape(externalID)
+		method = http.MethodPatch
+	}
+
+	resp, err := sendJSON(ctx, method, endpoint, "Bearer "+g.credentials.APIKey, fields)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound && externalID != "" {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		return g.push(ctx, "", fields)
+	}
+	if err := responseError("CRM", resp); err != nil {
+		return "", err
+	}
+
+	id, err := decodeID(resp.Body)
+	if err != nil || id == "" {
+		// Updates and endpoints that don't return IDs keep the previous ID
+		return externalID, nil
+	}
+	return id, nil
+}
+
+// sendJSON sends body as JSON with the given Authorization header
+func sendJSON(ctx context.Context, method, endpoint, authorization string, body interface{}) (*http.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, jobs.Permanent(fmt.Errorf("error encoding CRM record: %v", err))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return nil, jobs.Permanent(fmt.Errorf("error creating CRM request: %v", err))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", authorization)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending record to CRM: %v", err)
+	}
+	return resp, nil
+}
+
+// responseError returns nil for 2xx responses. Client errors other than 408 and
+// 429 are permanent; the start of the body is included since CRMs explain
+// rejected fields there.
+func responseError(service string, resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err := fmt.Errorf("%s returned status %d: %s", service, resp.StatusCode, strings.TrimSpace(string(detail)))
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+		resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+		return jobs.Permanent(err)
+	}
+	return err
+}
+
+// decodeID reads the "id" of a created record, which may be a string or number
+func decodeID(body io.Reader) (string, error) {
+	var created struct {
+		ID json.RawMessage `json:"id"`
+	}
+	if err := json.NewDecoder(io.LimitReader(body, 64<<10)).Decode(&created); err != nil {
+		return "", fmt.Errorf("error decoding CRM response: %v", err)
+	}
+
+	if len(created.ID) == 0 || string(created.ID) == "null" {
+		return "", nil
+	}
+	var id string
+	if err := json.Unmarshal(created.ID, &id); err == nil {
+		return id, nil
+	}
+	return strings.TrimSpace(string(created.ID)), nil
+}
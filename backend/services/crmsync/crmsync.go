@@ -0,0 +1,299 @@
+package crmsync
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"matcherator/backend/services/jobs"
+)
+
+// CRM providers
+const (
+	ProviderSalesforce = "salesforce"
+	ProviderGeneric    = "generic"
+)
+
+// Events synced to a CRM
+const (
+	// EventConnection is a connection with another organization being created or
+	// removed; the record's status is StatusConnected or StatusDisconnected
+	EventConnection = "connection.status_changed"
+)
+
+// Connection statuses
+const (
+	StatusConnected    = "connected"
+	StatusDisconnected = "disconnected"
+)
+
+// Sync log statuses
+const (
+	LogPending   = "pending"
+	LogSucceeded = "succeeded"
+	LogFailed    = "failed"
+)
+
+// Defaults for Salesforce Nonprofit Success Pack, where grants and the
+// relationships leading to them are tracked as opportunities
+const (
+	defaultSalesforceLoginURL = "https://login.salesforce.com"
+	defaultSalesforceObject   = "Opportunity"
+)
+
+var (
+	// ErrNotFound is returned when the organization has no CRM connection, or for
+	// Retry no failed sync log, with the given ID
+	ErrNotFound = errors.New("not found")
+
+	// ErrCredentialsRequired is returned by Save when a connection is created, or
+	// switched to another provider, without credentials
+	ErrCredentialsRequired = errors.New("credentials are required")
+
+	// identifierPattern matches CRM object and field API names
+	identifierPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]{0,79}$`)
+)
+
+// RecordFields are the fields of a synced record that a field mapping can refer to
+var RecordFields = []string{
+	"event", "status", "timestamp", "date", "name", "description",
+	"organization_id", "organization_name", "organization_email", "organization_role",
+}
+
+// Record is one event as pushed to the CRM, keyed by the names in RecordFields
+type Record map[string]string
+
+// Config describes where and how an organization's records are synced
+type Config struct {
+	Provider string `json:"provider"`
+
+	// EndpointURL is the Salesforce instance URL, or the URL records are POSTed
+	// to for the generic provider
+	EndpointURL string `json:"endpoint_url"`
+
+	// LoginURL is the Salesforce OAuth host, e.g. https://test.salesforce.com for sandboxes
+	LoginURL string `json:"login_url,omitempty"`
+
+	// ObjectName is the Salesforce object records are created as
+	ObjectName string `json:"object_name,omitempty"`
+
+	// FieldMapping maps CRM field names to record fields
+	FieldMapping map[string]string `json:"field_mapping"`
+
+	// StatusMapping translates record statuses, e.g. "connected" to a stage name
+	StatusMapping map[string]string `json:"status_mapping"`
+}
+
+// Credentials authenticate against the CRM. Salesforce uses an OAuth refresh
+// token of a connected app; the generic provider sends APIKey as a bearer token.
+type Credentials struct {
+	ClientID     string `json:"client_id,omitempty"`
+	ClientSecret string `json:"client_secret,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	APIKey       string `json:"api_key,omitempty"`
+}
+
+// Normalize validates the config and fills in provider defaults
+func (c *Config) Normalize() error {
+	switch c.Provider {
+	case ProviderSalesforce:
+		if c.LoginURL == "" {
+			c.LoginURL = defaultSalesforceLoginURL
+		}
+		if c.ObjectName == "" {
+			c.ObjectName = defaultSalesforceObject
+		}
+		if len(c.FieldMapping) == 0 {
+			c.FieldMapping = map[string]string{
+				"Name":        "name",
+				"StageName":   "status",
+				"CloseDate":   "date",
+				"Description": "description",
+			}
+		}
+		if len(c.StatusMapping) == 0 {
+			c.StatusMapping = map[string]string{
+				StatusConnected:    "Prospecting",
+				StatusDisconnected: "Closed Lost",
+			}
+		}
+		if !identifierPattern.MatchString(c.ObjectName) {
+			return fmt.Errorf("invalid object name %q", c.ObjectName)
+		}
+		if err := validateURL(c.LoginURL); err != nil {
+			return err
+		}
+	case ProviderGeneric:
+		c.LoginURL = ""
+		c.ObjectName = ""
+		if len(c.FieldMapping) == 0 {
+			c.FieldMapping = make(map[string]string, len(RecordFields))
+			for _, field := range RecordFields {
+				c.FieldMapping[field] = field
+			}
+		}
+	default:
+		return fmt.Errorf("provider must be %q or %q", ProviderSalesforce, ProviderGeneric)
+	}
+
+	c.EndpointURL = strings.TrimRight(c.EndpointURL, "/")
+	if err := validateURL(c.EndpointURL); err != nil {
+		return err
+	}
+
+	if c.StatusMapping == nil {
+		c.StatusMapping = map[string]string{}
+	}
+	for crmField, recordField := range c.FieldMapping {
+		if !identifierPattern.MatchString(crmField) {
+			return fmt.Errorf("invalid CRM field name %q", crmField)
+		}
+		if !isRecordField(recordField) {
+			return fmt.Errorf("unknown record field %q for %s; use one of %s", recordField, crmField, strings.Join(RecordFields, ", "))
+		}
+	}
+	return nil
+}
+
+// Validate checks that the credentials needed by provider are present
+func (c Credentials) Validate(provider string) error {
+	switch provider {
+	case ProviderSalesforce:
+		if c.ClientID == "" || c.ClientSecret == "" || c.RefreshToken == "" {
+			return errors.New("salesforce requires client_id, client_secret and refresh_token")
+		}
+	case ProviderGeneric:
+		if c.APIKey == "" {
+			return errors.New("generic CRM requires api_key")
+		}
+	}
+	return nil
+}
+
+// SyncConnection queues a sync of a connection status change to the CRM of each
+// side that has one enabled. Each side's record describes the other organization.
+func SyncConnection(db *sql.DB, initiatorID, targetID int, status string) error {
+	var errs []error
+	for _, side := range [][2]int{{initiatorID, targetID}, {targetID, initiatorID}} {
+		if err := enqueue(db, side[0], side[1], EventConnection, status); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// enqueue logs and queues a sync of event for userID when their CRM connection
+// is enabled
+func enqueue(db *sql.DB, userID, counterpartID int, event, status string) error {
+	var enabled bool
+	err := db.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM crm_connections WHERE user_id = $1 AND enabled)
+	`, userID).Scan(&enabled)
+	if err != nil {
+		return fmt.Errorf("error checking CRM connection: %v", err)
+	}
+	if !enabled {
+		return nil
+	}
+
+	record, err := newRecord(db, counterpartID, event, status)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("error encoding CRM record: %v", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var logID int64
+	err = tx.QueryRow(`
+		INSERT INTO crm_sync_logs (user_id, counterpart_id, event, record)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`, userID, counterpartID, event, body).Scan(&logID)
+	if err != nil {
+		return fmt.Errorf("error logging CRM sync: %v", err)
+	}
+
+	if _, err := jobs.Enqueue(tx, SyncJob, SyncPayload{LogID: logID}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// newRecord describes the counterpart organization of an event
+func newRecord(db *sql.DB, counterpartID int, event, status string) (Record, error) {
+	var name, email, role string
+	err := db.QueryRow(`
+		SELECT COALESCE(p.organization_name, ''), u.email, u.role
+		FROM users u
+		LEFT JOIN profiles p ON p.user_id = u.id
+		WHERE u.id = $1
+	`, counterpartID).Scan(&name, &email, &role)
+	if err != nil {
+		return nil, fmt.Errorf("error loading organization %d for CRM sync: %v", counterpartID, err)
+	}
+	if name == "" {
+		name = email
+	}
+
+	now := time.Now().UTC()
+	return Record{
+		"event":              event,
+		"status":             status,
+		"timestamp":          now.Format(time.RFC3339),
+		"date":               now.Format("2006-01-02"),
+		"name":               "Grant Matcherator: " + name,
+		"description":        fmt.Sprintf("%s (%s) is %s on Grant Matcherator.", name, role, status),
+		"organization_id":    strconv.Itoa(counterpartID),
+		"organization_name":  name,
+		"organization_email": email,
+		"organization_role":  role,
+	}, nil
+}
+
+// mapFields builds the CRM fields of record according to config
+func mapFields(record Record, config Config) map[string]string {
+	fields := make(map[string]string, len(config.FieldMapping))
+	for crmField, recordField := range config.FieldMapping {
+		value := record[recordField]
+		if recordField == "status" {
+			if mapped, ok := config.StatusMapping[value]; ok {
+				value = mapped
+			}
+		}
+		fields[crmField] = value
+	}
+	return fields
+}
+
+// isRecordField reports whether field is one of RecordFields
+func isRecordField(field string) bool {
+	for _, f := range RecordFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// validateURL accepts absolute https URLs, and http for local development
+func validateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("invalid URL %q", raw)
+	}
+	return nil
+}
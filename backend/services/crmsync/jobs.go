@@ -0,0 +1,141 @@
+package crmsync
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"matcherator/backend/services/fieldcrypt"
+	"matcherator/backend/services/jobs"
+)
+
+// SyncJob is the job kind that pushes one logged record to an organization's CRM
+const SyncJob = "crm.sync"
+
+// SyncPayload is the payload of a SyncJob
+type SyncPayload struct {
+	LogID int64 `json:"log_id"`
+}
+
+// RegisterJobs installs the handlers of this package's job kinds
+func RegisterJobs(db *sql.DB) {
+	jobs.Register(SyncJob, SyncJobHandler(db))
+}
+
+// SyncJobHandler pushes queued records and records the outcome on the sync log.
+// Failed attempts are retried by the job queue; the log keeps the last error.
+func SyncJobHandler(db *sql.DB) jobs.Handler {
+	return func(ctx context.Context, payload json.RawMessage) error {
+		var p SyncPayload
+		if err := json.Unmarshal(payload, &p); err != nil {
+			return jobs.Permanent(fmt.Errorf("error decoding CRM sync: %v", err))
+		}
+
+		err := pushLog(ctx, db, p.LogID)
+		if err != nil {
+			_, dbErr := db.Exec(`
+				UPDATE crm_sync_logs
+				SET status = $2, last_error = $3, updated_at = CURRENT_TIMESTAMP
+				WHERE id = $1
+			`, p.LogID, LogFailed, err.Error())
+			if dbErr != nil {
+				return fmt.Errorf("%v (and error updating sync log: %v)", err, dbErr)
+			}
+		}
+		return err
+	}
+}
+
+// pushLog pushes the record of one sync log, updating the record previously
+// created for the same organization when there is one
+func pushLog(ctx context.Context, db *sql.DB, logID int64) error {
+	var (
+		record                        Record
+		config                        Config
+		recordJSON, mapping, statuses []byte
+		sealedCredentials             string
+		externalID                    sql.NullString
+	)
+	err := db.QueryRowContext(ctx, `
+		UPDATE crm_sync_logs l
+		SET attempts = l.attempts + 1, updated_at = CURRENT_TIMESTAMP
+		FROM crm_connections c
+		WHERE l.id = $1 AND c.user_id = l.user_id
+		RETURNING l.record, c.provider, c.endpoint_url, COALESCE(c.login_url, ''),
+			COALESCE(c.object_name, ''), c.credentials, c.field_mapping, c.status_mapping,
+			(
+				SELECT prev.external_id FROM crm_sync_logs prev
+				WHERE prev.user_id = l.user_id
+					AND prev.counterpart_id = l.counterpart_id
+					AND prev.external_id IS NOT NULL
+					AND prev.id <> l.id
+				ORDER BY prev.id DESC
+				LIMIT 1
+			)
+	`, logID).Scan(
+		&recordJSON, &config.Provider, &config.EndpointURL, &config.LoginURL,
+		&config.ObjectName, &sealedCredentials, &mapping, &statuses, &externalID,
+	)
+	if err == sql.ErrNoRows {
+		return jobs.Permanent(fmt.Errorf("CRM connection for sync log %d was removed", logID))
+	} else if err != nil {
+		return fmt.Errorf("error loading CRM sync: %v", err)
+	}
+
+	if err := json.Unmarshal(recordJSON, &record); err != nil {
+		return jobs.Permanent(fmt.Errorf("error decoding CRM record: %v", err))
+	}
+	if err := json.Unmarshal(mapping, &config.FieldMapping); err != nil {
+		return jobs.Permanent(fmt.Errorf("error decoding field mapping: %v", err))
+	}
+	if err := json.Unmarshal(statuses, &config.StatusMapping); err != nil {
+		return jobs.Permanent(fmt.Errorf("error decoding status mapping: %v", err))
+	}
+	credentials, err := openCredentials(sealedCredentials)
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+
+	c, err := newConnector(config, credentials)
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+	id, err := c.push(ctx, externalID.String, mapFields(record, config))
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, `
+		UPDATE crm_sync_logs
+		SET status = $2, external_id = NULLIF($3, ''), last_error = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`, logID, LogSucceeded, id)
+	if err != nil {
+		return fmt.Errorf("error updating sync log: %v", err)
+	}
+	return nil
+}
+
+// sealCredentials encodes credentials for storage, encrypted when field
+// encryption is enabled
+func sealCredentials(credentials Credentials) (string, error) {
+	data, err := json.Marshal(credentials)
+	if err != nil {
+		return "", fmt.Errorf("error encoding CRM credentials: %v", err)
+	}
+	return fieldcrypt.Encrypt(string(data))
+}
+
+// openCredentials decodes stored credentials
+func openCredentials(sealed string) (Credentials, error) {
+	var credentials Credentials
+	data, err := fieldcrypt.Decrypt(sealed)
+	if err != nil {
+		return credentials, fmt.Errorf("error decrypting CRM credentials: %v", err)
+	}
+	if err := json.Unmarshal([]byte(data), &credentials); err != nil {
+		return credentials, fmt.Errorf("error decoding CRM credentials: %v", err)
+	}
+	return credentials, nil
+}
@@ -0,0 +1,236 @@
+package crmsync
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"matcherator/backend/services/fieldcrypt"
+	"matcherator/backend/services/jobs"
+)
+
+// Connection is an organization's CRM configuration as shown to them. The
+// credentials are never returned.
+type Connection struct {
+	Config
+	Enabled        bool      `json:"enabled"`
+	HasCredentials bool      `json:"has_credentials"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// SyncLog is one record pushed, or being pushed, to an organization's CRM
+type SyncLog struct {
+	ID            int64           `json:"id"`
+	CounterpartID *int            `json:"counterpart_id"`
+	Event         string          `json:"event"`
+	Status        string          `json:"status"`
+	Attempts      int             `json:"attempts"`
+	ExternalID    *string         `json:"external_id"`
+	LastError     *string         `json:"last_error"`
+	Record        json.RawMessage `json:"record"`
+	CreatedAt     time.Time       `json:"created_at"`
+	UpdatedAt     time.Time       `json:"updated_at"`
+}
+
+// Load returns the user's CRM connection, or ErrNotFound
+func Load(db *sql.DB, userID int) (*Connection, error) {
+	var c Connection
+	var mapping, statuses []byte
+	err := db.QueryRow(`
+		SELECT provider, endpoint_url, COALESCE(login_url, ''), COALESCE(object_name, ''),
+			field_mapping, status_mapping, enabled, credentials <> '', created_at, updated_at
+		FROM crm_connections
+		WHERE user_id = $1
+	`, userID).Scan(
+		&c.Provider, &c.EndpointURL, &c.LoginURL, &c.ObjectName,
+		&mapping, &statuses, &c.Enabled, &c.HasCredentials, &c.CreatedAt, &c.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("error loading CRM connection: %v", err)
+	}
+	if err := json.Unmarshal(mapping, &c.FieldMapping); err != nil {
+		return nil, fmt.Errorf("error decoding field mapping: %v", err)
+	}
+	if err := json.Unmarshal(statuses, &c.StatusMapping); err != nil {
+		return nil, fmt.Errorf("error decoding status mapping: %v", err)
+	}
+	return &c, nil
+}
+
+// Save creates or replaces the user's CRM connection. Nil credentials keep the
+// stored ones, which must then exist and belong to the same provider.
+func Save(db *sql.DB, userID int, config Config, credentials *Credentials, enabled bool) error {
+	if err := config.Normalize(); err != nil {
+		return err
+	}
+
+	var sealed string
+	if credentials != nil {
+		if err := credentials.Validate(config.Provider); err != nil {
+			return err
+		}
+		var err error
+		if sealed, err = sealCredentials(*credentials); err != nil {
+			return err
+		}
+	} else {
+		existing, err := Load(db, userID)
+		if err == ErrNotFound || (err == nil && existing.Provider != config.Provider) {
+			return ErrCredentialsRequired
+		} else if err != nil {
+			return err
+		}
+	}
+
+	mapping, err := json.Marshal(config.FieldMapping)
+	if err != nil {
+		return fmt.Errorf("error encoding field mapping: %v", err)
+	}
+	statuses, err := json.Marshal(config.StatusMapping)
+	if err != nil {
+		return fmt.Errorf("error encoding status mapping: %v", err)
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO crm_connections (
+			user_id, provider, endpoint_url, login_url, object_name,
+			credentials, field_mapping, status_mapping, enabled
+		) VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), $6, $7, $8, $9)
+		ON CONFLICT (user_id) DO UPDATE
+		SET provider = EXCLUDED.provider,
+			endpoint_url = EXCLUDED.endpoint_url,
+			login_url = EXCLUDED.login_url,
+			object_name = EXCLUDED.object_name,
+			credentials = COALESCE(NULLIF(EXCLUDED.credentials, ''), crm_connections.credentials),
+			field_mapping = EXCLUDED.field_mapping,
+			status_mapping = EXCLUDED.status_mapping,
+			enabled = EXCLUDED.enabled,
+			updated_at = CURRENT_TIMESTAMP
+	`, userID, config.Provider, config.EndpointURL, config.LoginURL, config.ObjectName,
+		sealed, mapping, statuses, enabled)
+	if err != nil {
+		return fmt.Errorf("error saving CRM connection: %v", err)
+	}
+	return nil
+}
+
+// Delete removes the user's CRM connection and its credentials. Sync logs are
+// kept; queued syncs fail permanently.
+func Delete(db *sql.DB, userID int) error {
+	result, err := db.Exec(`DELETE FROM crm_connections WHERE user_id = $1`, userID)
+	if err != nil {
+		return fmt.Errorf("error deleting CRM connection: %v", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Logs returns the user's most recent sync logs, optionally filtered by status
+func Logs(db *sql.DB, userID int, status string, limit int) ([]SyncLog, error) {
+	rows, err := db.Query(`
+		SELECT id, counterpart_id, event, status, attempts, external_id, last_error,
+			record, created_at, updated_at
+		FROM crm_sync_logs
+		WHERE user_id = $1 AND ($2 = '' OR status = $2)
+		ORDER BY id DESC
+		LIMIT $3
+	`, userID, status, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying sync logs: %v", err)
+	}
+	defer rows.Close()
+
+	logs := []SyncLog{}
+	for rows.Next() {
+		var l SyncLog
+		err := rows.Scan(&l.ID, &l.CounterpartID, &l.Event, &l.Status, &l.Attempts,
+			&l.ExternalID, &l.LastError, &l.Record, &l.CreatedAt, &l.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning sync log: %v", err)
+		}
+		logs = append(logs, l)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating sync logs: %v", err)
+	}
+	return logs, nil
+}
+
+// Retry queues a failed sync of the user's again, or returns ErrNotFound
+func Retry(db *sql.DB, userID int, logID int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE crm_sync_logs
+		SET status = $3, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND user_id = $2 AND status = $4
+	`, logID, userID, LogPending, LogFailed)
+	if err != nil {
+		return fmt.Errorf("error requeueing sync log: %v", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+
+	if _, err := jobs.Enqueue(tx, SyncJob, SyncPayload{LogID: logID}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ReencryptCredentials encrypts stored credentials that are plaintext or were
+// written under a previous field encryption key with the current key
+func ReencryptCredentials(db *sql.DB) error {
+	rows, err := db.Query(`SELECT user_id, credentials FROM crm_connections`)
+	if err != nil {
+		return fmt.Errorf("error querying CRM credentials: %v", err)
+	}
+
+	stored := map[int]string{}
+	for rows.Next() {
+		var userID int
+		var sealed string
+		if err := rows.Scan(&userID, &sealed); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning CRM credentials: %v", err)
+		}
+		if fieldcrypt.NeedsReencryption(sealed) {
+			stored[userID] = sealed
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating CRM credentials: %v", err)
+	}
+
+	for userID, sealed := range stored {
+		reencrypted, err := fieldcrypt.Reencrypt(sealed)
+		if err != nil {
+			return fmt.Errorf("error re-encrypting CRM credentials of user %d: %v", userID, err)
+		}
+
+		// Only overwrite credentials that are still the ones we read
+		_, err = db.Exec(`
+			UPDATE crm_connections SET credentials = $3 WHERE user_id = $1 AND credentials = $2
+		`, userID, sealed, reencrypted)
+		if err != nil {
+			return fmt.Errorf("error storing CRM credentials of user %d: %v", userID, err)
+		}
+	}
+
+	if len(stored) > 0 {
+		log.Printf("Encrypted CRM credentials of %d connections under the current key", len(stored))
+	}
+	return nil
+}
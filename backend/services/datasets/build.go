@@ -0,0 +1,357 @@
+package datasets
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// datasetDir holds built datasets. They are only served through signed links.
+var datasetDir = filepath.Join("uploads", "datasets")
+
+const (
+	// scoreBandWidth is the width of the match score bands published
+	scoreBandWidth = 20
+
+	// otherValue replaces values held by fewer than K organizations, and
+	// unknownValue missing ones
+	otherValue   = "other"
+	unknownValue = "unknown"
+)
+
+// Outcomes of a match, most advanced first
+const (
+	OutcomeFunded    = "funded"
+	OutcomeConnected = "connected"
+	OutcomeDismissed = "dismissed"
+	OutcomeOpen      = "open"
+)
+
+// matchColumns is the header of matches.csv. The first seven are the
+// quasi-identifiers every published combination of is shared by K recipients
+// and K providers.
+var matchColumns = []string{
+	"period",
+	"recipient_region",
+	"recipient_applicant_type",
+	"recipient_sector",
+	"provider_region",
+	"provider_funding_type",
+	"score_band",
+	"outcome",
+	"dismiss_reason",
+}
+
+// Manifest is manifest.json at the root of the ZIP, describing the dataset
+type Manifest struct {
+	GeneratedAt    time.Time         `json:"generated_at"`
+	K              int               `json:"k"`
+	Rows           int               `json:"rows"`
+	SuppressedRows int               `json:"suppressed_rows"`
+	Columns        map[string]string `json:"columns"`
+}
+
+// columnDescriptions document matches.csv in the manifest
+var columnDescriptions = map[string]string{
+	"period":                   "Quarter the provider and recipient were first matched or connected, as YYYY-Qn",
+	"recipient_region":         "Census region the recipient is based in",
+	"recipient_applicant_type": "Recipient's applicant type",
+	"recipient_sector":         "First sector on the recipient's profile",
+	"provider_region":          "Census region the provider is based in",
+	"provider_funding_type":    "Provider's funding type",
+	"score_band":               "Match score band, as low-high; unknown for connections made without a match",
+	"outcome":                  "funded, connected, dismissed by either side, or open",
+	"dismiss_reason":           "Reason given for a dismissal, when outcome is dismissed",
+}
+
+// pair is one provider and recipient who were matched or connected
+type pair struct {
+	recipientID, providerID int64
+	values                  []string // matchColumns, quasi-identifiers generalized
+}
+
+// built is a dataset file written by build
+type built struct {
+	path       string
+	size       int64
+	rows       int
+	suppressed int
+}
+
+// build writes a dataset of every provider and recipient matched or
+// connected and returns the file. Values held by fewer than k organizations
+// are generalized to "other", then pairs whose quasi-identifiers are shared by
+// fewer than k recipients or k providers are suppressed.
+func build(ctx context.Context, db *sql.DB, datasetID, k int, regionOf RegionFunc) (*built, error) {
+	pairs, err := loadPairs(ctx, db, regionOf)
+	if err != nil {
+		return nil, err
+	}
+
+	// Rare applicant types, sectors and funding types could single out an
+	// organization on their own
+	generalize(pairs, 2, k, func(p pair) int64 { return p.recipientID })
+	generalize(pairs, 3, k, func(p pair) int64 { return p.recipientID })
+	generalize(pairs, 5, k, func(p pair) int64 { return p.providerID })
+
+	published, suppressed := suppress(pairs, k)
+	sort.Slice(published, func(i, j int) bool {
+		return strings.Join(published[i].values, "\x00") < strings.Join(published[j].values, "\x00")
+	})
+
+	if err := os.MkdirAll(datasetDir, 0750); err != nil {
+		return nil, fmt.Errorf("error creating dataset directory: %v", err)
+	}
+	name, err := randomName()
+	if err != nil {
+		return nil, fmt.Errorf("error naming dataset: %v", err)
+	}
+	path := filepath.Join(datasetDir, fmt.Sprintf("%d-%s.zip", datasetID, name))
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0640)
+	if err != nil {
+		return nil, fmt.Errorf("error creating dataset: %v", err)
+	}
+	manifest := Manifest{
+		GeneratedAt:    time.Now().UTC(),
+		K:              k,
+		Rows:           len(published),
+		SuppressedRows: suppressed,
+		Columns:        columnDescriptions,
+	}
+	if err := writeZip(file, &manifest, published); err != nil {
+		file.Close()
+		removeDataset(path)
+		return nil, err
+	}
+	if err := file.Close(); err != nil {
+		removeDataset(path)
+		return nil, fmt.Errorf("error writing dataset: %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		removeDataset(path)
+		return nil, fmt.Errorf("error writing dataset: %v", err)
+	}
+	return &built{path: path, size: info.Size(), rows: len(published), suppressed: suppressed}, nil
+}
+
+// loadPairs reads every pair of active provider and recipient that are
+// matched, dismissed or connected, with their attributes generalized
+func loadPairs(ctx context.Context, db *sql.DB, regionOf RegionFunc) ([]pair, error) {
+	rows, err := db.QueryContext(ctx, `
+		WITH active AS (
+			SELECT u.id, u.role
+			FROM users u
+			WHERE u.role IN ('provider', 'recipient')
+				AND u.deactivated_at IS NULL AND u.deleted_at IS NULL
+		),
+		events AS (
+			SELECT
+				CASE WHEN COALESCE(m.as_role, a.role) = 'recipient' THEN m.user_id ELSE m.match_id END AS recipient_id,
+				CASE WHEN COALESCE(m.as_role, a.role) = 'recipient' THEN m.match_id ELSE m.user_id END AS provider_id,
+				m.match_score AS score, m.created_at AS at,
+				false AS dismissed, NULL::text AS reason, false AS connected, false AS funded
+			FROM matches m
+			JOIN active a ON a.id = m.user_id
+			UNION ALL
+			SELECT
+				CASE WHEN a.role = 'recipient' THEN d.user_id ELSE d.match_id END,
+				CASE WHEN a.role = 'recipient' THEN d.match_id ELSE d.user_id END,
+				d.match_score, d.dismissed_at, true, d.reason, false, false
+			FROM dismissed_matches d
+			JOIN active a ON a.id = d.user_id
+			UNION ALL
+			SELECT
+				CASE WHEN i.role = 'recipient' THEN c.initiator_id ELSE c.target_id END,
+				CASE WHEN i.role = 'recipient' THEN c.target_id ELSE c.initiator_id END,
+				NULL, c.created_at, false, NULL, true, c.funded_at IS NOT NULL
+			FROM connections c
+			JOIN active i ON i.id = c.initiator_id
+			JOIN active t ON t.id = c.target_id AND t.role <> i.role
+		)
+		SELECT
+			e.recipient_id, e.provider_id, MIN(e.at), MAX(e.score),
+			bool_or(e.funded), bool_or(e.connected), bool_or(e.dismissed), MIN(e.reason),
+			COALESCE(MAX(rp.state), ''), COALESCE(MAX(rp.applicant_type), ''), COALESCE(MAX(rp.sectors[1]), ''),
+			COALESCE(MAX(pp.state), ''), COALESCE(MAX(pd.funding_type), '')
+		FROM events e
+		JOIN active r ON r.id = e.recipient_id
+		JOIN active p ON p.id = e.provider_id
+		LEFT JOIN profiles rp ON rp.user_id = e.recipient_id
+		LEFT JOIN profiles pp ON pp.user_id = e.provider_id
+		LEFT JOIN provider_data pd ON pd.user_id = e.provider_id
+		WHERE e.recipient_id <> e.provider_id
+		GROUP BY e.recipient_id, e.provider_id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying matches: %v", err)
+	}
+	defer rows.Close()
+
+	var pairs []pair
+	for rows.Next() {
+		var p pair
+		var at sql.NullTime
+		var score sql.NullFloat64
+		var funded, connected, dismissed bool
+		var reason sql.NullString
+		var recipientState, applicantType, sector, providerState, fundingType string
+		err := rows.Scan(
+			&p.recipientID, &p.providerID, &at, &score, &funded, &connected, &dismissed, &reason,
+			&recipientState, &applicantType, &sector, &providerState, &fundingType,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning match: %v", err)
+		}
+
+		outcome, dismissReason := OutcomeOpen, ""
+		switch {
+		case funded:
+			outcome = OutcomeFunded
+		case connected:
+			outcome = OutcomeConnected
+		case dismissed:
+			outcome, dismissReason = OutcomeDismissed, term(reason.String)
+		}
+
+		p.values = []string{
+			period(at),
+			regionOf(recipientState),
+			term(applicantType),
+			term(sector),
+			regionOf(providerState),
+			term(fundingType),
+			scoreBand(score),
+			outcome,
+			dismissReason,
+		}
+		pairs = append(pairs, p)
+	}
+	return pairs, rows.Err()
+}
+
+// generalize replaces the values of column held by fewer than k
+// organizations, as told apart by org, with otherValue
+func generalize(pairs []pair, column, k int, org func(pair) int64) {
+	holders := map[string]map[int64]bool{}
+	for _, p := range pairs {
+		value := p.values[column]
+		if holders[value] == nil {
+			holders[value] = map[int64]bool{}
+		}
+		holders[value][org(p)] = true
+	}
+	for i := range pairs {
+		if len(holders[pairs[i].values[column]]) < k {
+			pairs[i].values[column] = otherValue
+		}
+	}
+}
+
+// suppress returns the pairs whose quasi-identifiers are shared by at least
+// k recipients and k providers, and how many were left out
+func suppress(pairs []pair, k int) ([]pair, int) {
+	type group struct {
+		recipients, providers map[int64]bool
+	}
+	groups := map[string]*group{}
+	key := func(p pair) string {
+		return strings.Join(p.values[:7], "\x00")
+	}
+	for _, p := range pairs {
+		g := groups[key(p)]
+		if g == nil {
+			g = &group{recipients: map[int64]bool{}, providers: map[int64]bool{}}
+			groups[key(p)] = g
+		}
+		g.recipients[p.recipientID] = true
+		g.providers[p.providerID] = true
+	}
+
+	published := []pair{}
+	for _, p := range pairs {
+		g := groups[key(p)]
+		if len(g.recipients) >= k && len(g.providers) >= k {
+			published = append(published, p)
+		}
+	}
+	return published, len(pairs) - len(published)
+}
+
+// term normalizes a free-form attribute, unknownValue when empty
+func term(value string) string {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return unknownValue
+	}
+	return value
+}
+
+// period returns the quarter of t, as YYYY-Qn
+func period(t sql.NullTime) string {
+	if !t.Valid {
+		return unknownValue
+	}
+	utc := t.Time.UTC()
+	return fmt.Sprintf("%d-Q%d", utc.Year(), (int(utc.Month())-1)/3+1)
+}
+
+// scoreBand returns the band of width scoreBandWidth a match score falls in
+func scoreBand(score sql.NullFloat64) string {
+	if !score.Valid {
+		return unknownValue
+	}
+	low := int(math.Floor(math.Max(score.Float64, 0)/scoreBandWidth)) * scoreBandWidth
+	return strconv.Itoa(low) + "-" + strconv.Itoa(low+scoreBandWidth)
+}
+
+// writeZip writes manifest.json and matches.csv
+func writeZip(w io.Writer, manifest *Manifest, pairs []pair) error {
+	archive := zip.NewWriter(w)
+
+	entry, err := archive.Create("manifest.json")
+	if err != nil {
+		return fmt.Errorf("error writing dataset: %v", err)
+	}
+	encoder := json.NewEncoder(entry)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(manifest); err != nil {
+		return fmt.Errorf("error writing manifest: %v", err)
+	}
+
+	entry, err = archive.Create("matches.csv")
+	if err != nil {
+		return fmt.Errorf("error writing dataset: %v", err)
+	}
+	csvWriter := csv.NewWriter(entry)
+	if err := csvWriter.Write(matchColumns); err != nil {
+		return fmt.Errorf("error writing matches: %v", err)
+	}
+	for _, p := range pairs {
+		if err := csvWriter.Write(p.values); err != nil {
+			return fmt.Errorf("error writing matches: %v", err)
+		}
+	}
+	csvWriter.Flush()
+	if err := csvWriter.Error(); err != nil {
+		return fmt.Errorf("error writing matches: %v", err)
+	}
+
+	if err := archive.Close(); err != nil {
+		return fmt.Errorf("error writing dataset: %v", err)
+	}
+	return nil
+}
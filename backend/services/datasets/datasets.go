@@ -0,0 +1,401 @@
+// Package datasets builds anonymized open datasets of matches and their
+// outcomes for transparency reporting. Organizations are described only by
+// generalized attributes, and every published combination of them is shared
+// by at least K recipients and K providers (k-anonymity); rarer rows are
+// suppressed. Built datasets are downloaded through expiring signed links.
+package datasets
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"matcherator/backend/services/jobs"
+)
+
+// BuildJob is the job kind that builds a dataset
+const BuildJob = "datasets.build"
+
+// Dataset statuses; failed means the job was dead-lettered, expired that the
+// dataset file was deleted
+const (
+	StatusPending = "pending"
+	StatusRunning = "running"
+	StatusReady   = "ready"
+	StatusFailed  = "failed"
+	StatusExpired = "expired"
+)
+
+const (
+	// DefaultK and MinK are the default and smallest group size a dataset can
+	// be built with; MaxK is the largest
+	DefaultK = 10
+	MinK     = 5
+	MaxK     = 100
+
+	// MaxLinkValidity is how long a signed download link can be valid for
+	MaxLinkValidity = 30 * 24 * time.Hour
+
+	// buildTimeout bounds one attempt at building a dataset
+	buildTimeout = 30 * time.Minute
+
+	// retention is how long a built dataset can be downloaded
+	retention = 180 * 24 * time.Hour
+
+	// purgeInterval is how often expired dataset files are deleted
+	purgeInterval = time.Hour
+)
+
+var (
+	// ErrNotFound is returned when no dataset has the given ID
+	ErrNotFound = errors.New("dataset not found")
+
+	// ErrNotReady is returned when a link is asked for a dataset that can't be
+	// downloaded
+	ErrNotReady = errors.New("dataset is not ready")
+
+	// ErrLinksNotConfigured is returned when DATASET_SIGNING_KEY or PUBLIC_URL
+	// is not set
+	ErrLinksNotConfigured = errors.New("dataset links are not configured")
+
+	// ErrInvalidLink is returned for a link that is expired or wasn't signed by
+	// this server
+	ErrInvalidLink = errors.New("invalid or expired dataset link")
+)
+
+// Dataset is an admin's request for an open dataset
+type Dataset struct {
+	ID             int        `json:"id"`
+	RequestedBy    *int       `json:"requested_by"`
+	JobID          int64      `json:"job_id"`
+	K              int        `json:"k"`
+	Status         string     `json:"status"`
+	LastError      *string    `json:"last_error"`
+	RowCount       *int       `json:"row_count"`
+	SuppressedRows *int       `json:"suppressed_rows"` // matches left out to keep every group at least K strong
+	SizeBytes      *int64     `json:"size_bytes"`
+	CreatedAt      time.Time  `json:"created_at"`
+	CompletedAt    *time.Time `json:"completed_at"`
+	ExpiresAt      *time.Time `json:"expires_at"`
+
+	filePath *string
+}
+
+// Link is a signed download link of a dataset
+type Link struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// BuildPayload is the payload of a BuildJob
+type BuildPayload struct {
+	DatasetID int `json:"dataset_id"`
+}
+
+// RegionFunc returns the region a state code or name is generalized to
+type RegionFunc func(state string) string
+
+// RegisterJobs installs the handler of BuildJob; regionOf generalizes the
+// states organizations are based in
+func RegisterJobs(db *sql.DB, regionOf RegionFunc) {
+	jobs.RegisterWithTimeout(BuildJob, buildTimeout, BuildJobHandler(db, regionOf))
+}
+
+// Create records an admin's request for a dataset with groups of at least k
+// organizations and queues it
+func Create(db *sql.DB, adminID, k int) (*Dataset, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting dataset: %v", err)
+	}
+	defer tx.Rollback()
+
+	var datasetID int
+	err = tx.QueryRow(`
+		INSERT INTO public_datasets (requested_by, k) VALUES ($1, $2) RETURNING id
+	`, adminID, k).Scan(&datasetID)
+	if err != nil {
+		return nil, fmt.Errorf("error creating dataset: %v", err)
+	}
+
+	jobID, err := jobs.Enqueue(tx, BuildJob, BuildPayload{DatasetID: datasetID})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("UPDATE public_datasets SET job_id = $2 WHERE id = $1", datasetID, jobID); err != nil {
+		return nil, fmt.Errorf("error linking dataset job: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing dataset: %v", err)
+	}
+	return Get(db, datasetID)
+}
+
+// datasetColumns are scanned by scanDataset. The status follows the job until
+// the dataset is stored.
+const datasetColumns = `
+	d.id, d.requested_by, COALESCE(d.job_id, 0), d.k,
+	CASE
+		WHEN d.completed_at IS NOT NULL AND (d.file_path IS NULL OR d.expires_at <= CURRENT_TIMESTAMP) THEN 'expired'
+		WHEN d.completed_at IS NOT NULL THEN 'ready'
+		WHEN j.status = 'dead' THEN 'failed'
+		WHEN j.status = 'running' THEN 'running'
+		ELSE 'pending'
+	END,
+	j.last_error, d.row_count, d.suppressed_rows, d.size_bytes, d.created_at, d.completed_at, d.expires_at, d.file_path
+`
+
+// Get returns a dataset by ID
+func Get(db *sql.DB, id int) (*Dataset, error) {
+	dataset, err := scanDataset(db.QueryRow(`
+		SELECT `+datasetColumns+`
+		FROM public_datasets d
+		LEFT JOIN jobs j ON j.id = d.job_id
+		WHERE d.id = $1
+	`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("error loading dataset: %v", err)
+	}
+	return dataset, nil
+}
+
+// List returns the most recent datasets
+func List(db *sql.DB, limit int) ([]Dataset, error) {
+	rows, err := db.Query(`
+		SELECT `+datasetColumns+`
+		FROM public_datasets d
+		LEFT JOIN jobs j ON j.id = d.job_id
+		ORDER BY d.created_at DESC
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error listing datasets: %v", err)
+	}
+	defer rows.Close()
+
+	datasets := []Dataset{}
+	for rows.Next() {
+		dataset, err := scanDataset(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning dataset: %v", err)
+		}
+		datasets = append(datasets, *dataset)
+	}
+	return datasets, rows.Err()
+}
+
+// FilePath returns where a ready dataset is stored, or "" when it cannot be
+// downloaded (not built yet, expired or deleted)
+func (d *Dataset) FilePath() string {
+	if d.Status != StatusReady || d.filePath == nil || (d.ExpiresAt != nil && time.Now().After(*d.ExpiresAt)) {
+		return ""
+	}
+	return *d.filePath
+}
+
+// scanDataset scans datasetColumns
+func scanDataset(row interface{ Scan(...interface{}) error }) (*Dataset, error) {
+	var d Dataset
+	err := row.Scan(
+		&d.ID, &d.RequestedBy, &d.JobID, &d.K, &d.Status, &d.LastError, &d.RowCount,
+		&d.SuppressedRows, &d.SizeBytes, &d.CreatedAt, &d.CompletedAt, &d.ExpiresAt, &d.filePath,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// BuildJobHandler builds queued datasets
+func BuildJobHandler(db *sql.DB, regionOf RegionFunc) jobs.Handler {
+	return func(ctx context.Context, payload json.RawMessage) error {
+		var p BuildPayload
+		if err := json.Unmarshal(payload, &p); err != nil {
+			return jobs.Permanent(fmt.Errorf("error decoding dataset job: %v", err))
+		}
+
+		var k int
+		err := db.QueryRowContext(ctx, "SELECT k FROM public_datasets WHERE id = $1", p.DatasetID).Scan(&k)
+		if err == sql.ErrNoRows {
+			return jobs.Permanent(fmt.Errorf("dataset %d no longer exists", p.DatasetID))
+		} else if err != nil {
+			return fmt.Errorf("error loading dataset: %v", err)
+		}
+
+		built, err := build(ctx, db, p.DatasetID, k, regionOf)
+		if err != nil {
+			return err
+		}
+
+		_, err = db.ExecContext(ctx, `
+			UPDATE public_datasets
+			SET file_path = $2, row_count = $3, suppressed_rows = $4, size_bytes = $5,
+				completed_at = CURRENT_TIMESTAMP, expires_at = $6
+			WHERE id = $1
+		`, p.DatasetID, built.path, built.rows, built.suppressed, built.size, time.Now().Add(retention))
+		if err != nil {
+			removeDataset(built.path)
+			return fmt.Errorf("error storing dataset: %v", err)
+		}
+		return nil
+	}
+}
+
+// Delete removes a dataset's file, so its links stop working, keeping the
+// dataset as a record that it was published
+func Delete(db *sql.DB, id int) error {
+	var path sql.NullString
+	err := db.QueryRow(`
+		UPDATE public_datasets d
+		SET file_path = NULL, expires_at = CURRENT_TIMESTAMP
+		FROM public_datasets old
+		WHERE d.id = $1 AND old.id = d.id
+		RETURNING old.file_path
+	`, id).Scan(&path)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	} else if err != nil {
+		return fmt.Errorf("error deleting dataset: %v", err)
+	}
+	if path.Valid {
+		removeDataset(path.String)
+	}
+	return nil
+}
+
+// signingKey is the HMAC key download links are signed with, from
+// DATASET_SIGNING_KEY
+func signingKey() []byte {
+	return []byte(os.Getenv("DATASET_SIGNING_KEY"))
+}
+
+// signature signs a dataset ID and link expiry
+func signature(id int, expires int64) string {
+	mac := hmac.New(sha256.New, signingKey())
+	fmt.Fprintf(mac, "dataset:%d:%d", id, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignLink returns a link that downloads a ready dataset without signing in
+// until validity has passed, or the dataset expires if that is sooner
+func SignLink(d *Dataset, validity time.Duration) (*Link, error) {
+	baseURL := strings.TrimRight(os.Getenv("PUBLIC_URL"), "/")
+	if len(signingKey()) == 0 || baseURL == "" {
+		return nil, ErrLinksNotConfigured
+	}
+	if d.FilePath() == "" {
+		return nil, ErrNotReady
+	}
+
+	expiresAt := time.Now().Add(validity).Truncate(time.Second)
+	if d.ExpiresAt != nil && d.ExpiresAt.Before(expiresAt) {
+		expiresAt = d.ExpiresAt.Truncate(time.Second)
+	}
+	query := url.Values{
+		"expires":   {strconv.FormatInt(expiresAt.Unix(), 10)},
+		"signature": {signature(d.ID, expiresAt.Unix())},
+	}
+	return &Link{
+		URL:       fmt.Sprintf("%s/api/public/datasets/%d/download?%s", baseURL, d.ID, query.Encode()),
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// VerifyLink checks the expiry and signature of a download link
+func VerifyLink(id int, expires, sig string) error {
+	if len(signingKey()) == 0 {
+		return ErrInvalidLink
+	}
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > unix {
+		return ErrInvalidLink
+	}
+	if !hmac.Equal([]byte(sig), []byte(signature(id, unix))) {
+		return ErrInvalidLink
+	}
+	return nil
+}
+
+// StartPurger deletes the files of expired datasets every hour until ctx is
+// done
+func StartPurger(ctx context.Context, db *sql.DB) {
+	go func() {
+		ticker := time.NewTicker(purgeInterval)
+		defer ticker.Stop()
+
+		for {
+			if err := purgeExpired(db); err != nil {
+				log.Printf("Error purging expired datasets: %v", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// purgeExpired deletes the files of datasets past their expiry
+func purgeExpired(db *sql.DB) error {
+	rows, err := db.Query(`
+		UPDATE public_datasets d
+		SET file_path = NULL
+		FROM public_datasets old
+		WHERE old.id = d.id AND d.file_path IS NOT NULL AND d.expires_at <= CURRENT_TIMESTAMP
+		RETURNING old.file_path
+	`)
+	if err != nil {
+		return fmt.Errorf("error claiming expired datasets: %v", err)
+	}
+	defer rows.Close()
+
+	var paths []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return fmt.Errorf("error scanning expired dataset: %v", err)
+		}
+		paths = append(paths, path)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		removeDataset(path)
+	}
+	return nil
+}
+
+// randomName returns a random file name stem, so dataset paths cannot be guessed
+func randomName() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// removeDataset deletes a dataset file, logging failures
+func removeDataset(path string) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		log.Printf("Error removing dataset %s: %v", path, err)
+	}
+}
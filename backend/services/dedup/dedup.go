@@ -0,0 +1,319 @@
+// Package dedup finds imported providers that duplicate a registered provider
+// and merges or dismisses them once an admin has looked.
+package dedup
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/lib/pq"
+
+	"matcherator/backend/services/fieldcrypt"
+	"matcherator/backend/services/jobs"
+)
+
+// ScanJob is the job kind that looks for duplicates among all providers
+const ScanJob = "dedup.scan"
+
+// Signals that two providers are the same organization, as listed in a
+// candidate's reasons
+const (
+	ReasonEIN           = "ein"
+	ReasonWebsiteDomain = "website_domain"
+	ReasonName          = "name"
+)
+
+const (
+	// scanTimeout bounds one run of the scan
+	scanTimeout = time.Hour
+
+	// progressInterval is how often scan progress is stored
+	progressInterval = 2 * time.Second
+
+	// nameThreshold is the name similarity from which names alone make a
+	// candidate
+	nameThreshold = 0.85
+)
+
+// Weights of the signals in a candidate's score, which is at most 1
+const (
+	einWeight    = 0.5
+	domainWeight = 0.3
+	nameWeight   = 0.2
+)
+
+// legalWords are left out of names before comparing them
+var legalWords = map[string]bool{
+	"the": true, "inc": true, "incorporated": true, "llc": true, "ltd": true,
+	"co": true, "corp": true, "corporation": true, "company": true,
+}
+
+// sharedHosts host pages of many organizations, so they say nothing about
+// which one a website belongs to
+var sharedHosts = map[string]bool{
+	"facebook.com": true, "linkedin.com": true, "instagram.com": true,
+	"twitter.com": true, "x.com": true, "sites.google.com": true,
+	"guidestar.org": true, "candid.org": true,
+}
+
+// ScanProgress is the progress of a ScanJob
+type ScanProgress struct {
+	Imported   int `json:"imported"`
+	Registered int `json:"registered"`
+	Done       int `json:"done"`
+	Candidates int `json:"candidates"`
+}
+
+// provider is what the scan compares of a provider
+type provider struct {
+	id       int
+	imported bool
+	ein      string
+	host     string
+	trigrams map[string]bool
+}
+
+// RegisterJobs installs the handler of ScanJob
+func RegisterJobs(db *sql.DB) {
+	jobs.RegisterWithTimeout(ScanJob, scanTimeout, ScanJobHandler(db))
+}
+
+// EnqueueScan queues a scan and returns its job ID. A scan that is already
+// pending or running is reused rather than duplicated.
+func EnqueueScan(db *sql.DB) (int64, error) {
+	active, err := jobs.Active(db, ScanJob)
+	if err != nil {
+		return 0, err
+	}
+	if active != nil {
+		return active.ID, nil
+	}
+	return jobs.Enqueue(db, ScanJob, struct{}{})
+}
+
+// ScanJobHandler runs scans, storing ScanProgress as it goes
+func ScanJobHandler(db *sql.DB) jobs.Handler {
+	return func(ctx context.Context, _ json.RawMessage) error {
+		return scan(ctx, db)
+	}
+}
+
+// scan compares every unclaimed imported provider with every registered one
+// and stores the likely duplicates as open candidates. Open candidates the
+// scan no longer finds are dropped; reviewed ones are kept as they are, so a
+// dismissed pair is not raised again.
+func scan(ctx context.Context, db *sql.DB) error {
+	var started time.Time
+	if err := db.QueryRowContext(ctx, "SELECT CURRENT_TIMESTAMP").Scan(&started); err != nil {
+		return fmt.Errorf("error reading the time: %v", err)
+	}
+
+	providers, err := loadProviders(ctx, db)
+	if err != nil {
+		return err
+	}
+	var imported, registered []provider
+	for _, p := range providers {
+		if p.imported {
+			imported = append(imported, p)
+		} else {
+			registered = append(registered, p)
+		}
+	}
+
+	progress := ScanProgress{Imported: len(imported), Registered: len(registered)}
+	report := func() {
+		if err := jobs.SetProgress(ctx, db, progress); err != nil {
+			log.Printf("Error reporting dedup scan progress: %v", err)
+		}
+	}
+	report()
+
+	lastReport := time.Now()
+	for _, imp := range imported {
+		if err := ctx.Err(); err != nil {
+			report()
+			return err
+		}
+
+		for _, reg := range registered {
+			score, similarity, reasons := compare(imp, reg)
+			if len(reasons) == 0 {
+				continue
+			}
+			_, err := db.ExecContext(ctx, `
+				INSERT INTO provider_duplicates (imported_id, registered_id, score, name_similarity, reasons)
+				VALUES ($1, $2, $3, $4, $5)
+				ON CONFLICT (imported_id, registered_id) DO UPDATE
+				SET score = EXCLUDED.score,
+					name_similarity = EXCLUDED.name_similarity,
+					reasons = EXCLUDED.reasons,
+					detected_at = CURRENT_TIMESTAMP
+				WHERE provider_duplicates.status = 'open'
+			`, imp.id, reg.id, score, similarity, pq.Array(reasons))
+			if err != nil {
+				return fmt.Errorf("error storing duplicate candidate: %v", err)
+			}
+			progress.Candidates++
+		}
+		progress.Done++
+
+		if time.Since(lastReport) >= progressInterval {
+			report()
+			lastReport = time.Now()
+		}
+	}
+
+	_, err = db.ExecContext(ctx, `
+		DELETE FROM provider_duplicates WHERE status = 'open' AND detected_at < $1
+	`, started)
+	if err != nil {
+		return fmt.Errorf("error dropping stale duplicate candidates: %v", err)
+	}
+
+	report()
+	return nil
+}
+
+// loadProviders returns the providers to compare: unclaimed imported ones and
+// those that registered or claimed their account
+func loadProviders(ctx context.Context, db *sql.DB) ([]provider, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT u.id, u.imported_from IS NOT NULL AND u.claimed_at IS NULL,
+			COALESCE(p.organization_name, ''), p.ein, COALESCE(p.website_url, '')
+		FROM users u
+		JOIN profiles p ON p.user_id = u.id
+		WHERE u.role = 'provider'
+			AND u.merged_into IS NULL
+			AND u.deleted_at IS NULL
+		ORDER BY u.id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying providers: %v", err)
+	}
+	defer rows.Close()
+
+	var providers []provider
+	for rows.Next() {
+		var p provider
+		var name, website string
+		var ein *string
+		if err := rows.Scan(&p.id, &p.imported, &name, &ein, &website); err != nil {
+			return nil, fmt.Errorf("error scanning provider: %v", err)
+		}
+		if ein, err = fieldcrypt.DecryptPtr(ein); err != nil {
+			return nil, fmt.Errorf("error decrypting EIN of provider %d: %v", p.id, err)
+		}
+		if ein != nil {
+			p.ein = normalizeEIN(*ein)
+		}
+		if host := WebsiteHost(website); !sharedHosts[host] {
+			p.host = host
+		}
+		p.trigrams = trigrams(normalizeName(name))
+		providers = append(providers, p)
+	}
+	return providers, rows.Err()
+}
+
+// compare scores how likely two providers are the same organization and
+// lists the signals that say so; none when they are likely not
+func compare(a, b provider) (float64, float64, []string) {
+	similarity := dice(a.trigrams, b.trigrams)
+
+	reasons := []string{}
+	score := nameWeight * similarity
+	if a.ein != "" && a.ein == b.ein {
+		reasons = append(reasons, ReasonEIN)
+		score += einWeight
+	}
+	if a.host != "" && a.host == b.host {
+		reasons = append(reasons, ReasonWebsiteDomain)
+		score += domainWeight
+	}
+	if similarity >= nameThreshold {
+		reasons = append(reasons, ReasonName)
+	}
+	return score, similarity, reasons
+}
+
+// normalizeEIN keeps the digits of a 9-digit EIN, or returns ""
+func normalizeEIN(ein string) string {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, ein)
+	if len(digits) != 9 {
+		return ""
+	}
+	return digits
+}
+
+// normalizeName lowercases a name to its words, without punctuation and
+// legal forms
+func normalizeName(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	kept := words[:0]
+	for _, word := range words {
+		if !legalWords[word] {
+			kept = append(kept, word)
+		}
+	}
+	return strings.Join(kept, " ")
+}
+
+// trigrams returns the three-letter sequences of a name, padded so short
+// names and word boundaries count
+func trigrams(name string) map[string]bool {
+	set := make(map[string]bool)
+	if name == "" {
+		return set
+	}
+	runes := []rune("  " + name + " ")
+	for i := 0; i+3 <= len(runes); i++ {
+		set[string(runes[i:i+3])] = true
+	}
+	return set
+}
+
+// dice is the Sørensen–Dice similarity of two trigram sets, from 0 to 1
+func dice(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	shared := 0
+	for t := range a {
+		if b[t] {
+			shared++
+		}
+	}
+	return 2 * float64(shared) / float64(len(a)+len(b))
+}
+
+// WebsiteHost returns the lowercased host of a website without "www.", or ""
+func WebsiteHost(websiteURL string) string {
+	websiteURL = strings.TrimSpace(websiteURL)
+	if websiteURL == "" {
+		return ""
+	}
+	if !strings.Contains(websiteURL, "://") {
+		websiteURL = "https://" + websiteURL
+	}
+	u, err := url.Parse(websiteURL)
+	if err != nil {
+		return ""
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	return strings.TrimPrefix(host, "www.")
+}
@@ -0,0 +1,226 @@
+package dedup
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+
+	"matcherator/backend/services/matches"
+)
+
+// Candidate statuses. Merged candidates folded the imported provider into
+// the registered one; dismissed ones are not raised again.
+const (
+	StatusOpen      = "open"
+	StatusMerged    = "merged"
+	StatusDismissed = "dismissed"
+)
+
+var (
+	// ErrNotFound is returned when no open candidate has the given ID
+	ErrNotFound = errors.New("duplicate candidate not found")
+	// ErrClaimed is returned when merging an imported provider that was
+	// claimed, merged or removed since it was detected
+	ErrClaimed = errors.New("imported provider can no longer be merged")
+)
+
+// Side is one of the two providers of a candidate
+type Side struct {
+	ID               int     `json:"id"`
+	OrganizationName string  `json:"organization_name"`
+	WebsiteURL       *string `json:"website_url"`
+	ImportedFrom     *string `json:"imported_from,omitempty"`
+}
+
+// Candidate is a likely duplicate as admins review it
+type Candidate struct {
+	ID             int        `json:"id"`
+	Imported       Side       `json:"imported"`
+	Registered     Side       `json:"registered"`
+	Score          float64    `json:"score"`
+	NameSimilarity float64    `json:"name_similarity"`
+	Reasons        []string   `json:"reasons"`
+	Status         string     `json:"status"`
+	DetectedAt     time.Time  `json:"detected_at"`
+	ReviewedBy     *int       `json:"reviewed_by"`
+	ReviewedAt     *time.Time `json:"reviewed_at"`
+}
+
+const candidateColumns = `
+	SELECT d.id,
+		d.imported_id, COALESCE(ip.organization_name, ''), ip.website_url, iu.imported_from,
+		d.registered_id, COALESCE(rp.organization_name, ''), rp.website_url,
+		d.score, d.name_similarity, d.reasons, d.status, d.detected_at, d.reviewed_by, d.reviewed_at
+	FROM provider_duplicates d
+	JOIN users iu ON iu.id = d.imported_id
+	LEFT JOIN profiles ip ON ip.user_id = d.imported_id
+	LEFT JOIN profiles rp ON rp.user_id = d.registered_id
+`
+
+// List returns the candidates with a status, most likely first
+func List(db *sql.DB, status string) ([]Candidate, error) {
+	rows, err := db.Query(candidateColumns+`
+		WHERE d.status = $1
+		ORDER BY d.score DESC, d.id
+	`, status)
+	if err != nil {
+		return nil, fmt.Errorf("error querying duplicate candidates: %v", err)
+	}
+	defer rows.Close()
+
+	candidates := []Candidate{}
+	for rows.Next() {
+		c, err := scanCandidate(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning duplicate candidate: %v", err)
+		}
+		candidates = append(candidates, *c)
+	}
+	return candidates, rows.Err()
+}
+
+// Get returns a candidate, or ErrNotFound
+func Get(db *sql.DB, id int) (*Candidate, error) {
+	c, err := scanCandidate(db.QueryRow(candidateColumns+`WHERE d.id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return c, err
+}
+
+// Dismiss marks an open candidate as not a duplicate
+func Dismiss(db *sql.DB, id, adminID int) error {
+	result, err := db.Exec(`
+		UPDATE provider_duplicates
+		SET status = 'dismissed', reviewed_by = $2, reviewed_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND status = 'open'
+	`, id, adminID)
+	if err != nil {
+		return fmt.Errorf("error dismissing duplicate candidate: %v", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Merge folds the imported provider of an open candidate into the registered
+// one: its grants and connections move over, and the imported account is
+// deactivated, unlisted and dropped from everyone's matches. Open claims on it
+// and its other candidates are closed.
+func Merge(db *sql.DB, id, adminID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting merge: %v", err)
+	}
+	defer tx.Rollback()
+
+	var importedID, registeredID int
+	err = tx.QueryRow(`
+		SELECT imported_id, registered_id FROM provider_duplicates
+		WHERE id = $1 AND status = 'open'
+		FOR UPDATE
+	`, id).Scan(&importedID, &registeredID)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	} else if err != nil {
+		return fmt.Errorf("error loading duplicate candidate: %v", err)
+	}
+
+	var locked int
+	err = tx.QueryRow(`
+		SELECT id FROM users
+		WHERE id = $1 AND imported_from IS NOT NULL AND claimed_at IS NULL
+			AND merged_into IS NULL AND deleted_at IS NULL
+		FOR UPDATE
+	`, importedID).Scan(&locked)
+	if err == sql.ErrNoRows {
+		return ErrClaimed
+	} else if err != nil {
+		return fmt.Errorf("error locking imported provider: %v", err)
+	}
+
+	for _, query := range []string{
+		`UPDATE grants SET provider_id = $2 WHERE provider_id = $1`,
+		// A connection moves unless the registered provider already has one
+		// with the same organization
+		`UPDATE connections c SET initiator_id = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE c.initiator_id = $1 AND c.target_id <> $2
+			AND NOT EXISTS (
+				SELECT 1 FROM connections o
+				WHERE LEAST(o.initiator_id, o.target_id) = LEAST($2, c.target_id)
+					AND GREATEST(o.initiator_id, o.target_id) = GREATEST($2, c.target_id)
+			)`,
+		`UPDATE connections c SET target_id = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE c.target_id = $1 AND c.initiator_id <> $2
+			AND NOT EXISTS (
+				SELECT 1 FROM connections o
+				WHERE LEAST(o.initiator_id, o.target_id) = LEAST($2, c.initiator_id)
+					AND GREATEST(o.initiator_id, o.target_id) = GREATEST($2, c.initiator_id)
+			)`,
+		`UPDATE users
+		SET status = 'inactive', merged_into = $2, deactivated_at = COALESCE(deactivated_at, CURRENT_TIMESTAMP)
+		WHERE id = $1`,
+	} {
+		if _, err := tx.Exec(query, importedID, registeredID); err != nil {
+			return fmt.Errorf("error merging provider %d into %d: %v", importedID, registeredID, err)
+		}
+	}
+
+	for _, query := range []string{
+		`UPDATE profiles SET public_listing = false WHERE user_id = $1`,
+		`DELETE FROM matches WHERE user_id = $1 OR match_id = $1`,
+		`DELETE FROM tokens WHERE user_id = $1`,
+	} {
+		if _, err := tx.Exec(query, importedID); err != nil {
+			return fmt.Errorf("error retiring provider %d: %v", importedID, err)
+		}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE organization_claims
+		SET status = 'rejected', review_note = 'The organization was merged into its registered account',
+			reviewed_by = $2, reviewed_at = CURRENT_TIMESTAMP
+		WHERE organization_id = $1 AND status IN ('unverified', 'awaiting_document', 'pending_review')
+	`, importedID, adminID)
+	if err != nil {
+		return fmt.Errorf("error closing claims on provider %d: %v", importedID, err)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE provider_duplicates
+		SET status = CASE WHEN id = $1 THEN 'merged' ELSE 'dismissed' END,
+			reviewed_by = $3, reviewed_at = CURRENT_TIMESTAMP
+		WHERE imported_id = $2 AND (id = $1 OR status = 'open')
+	`, id, importedID, adminID)
+	if err != nil {
+		return fmt.Errorf("error closing duplicate candidates: %v", err)
+	}
+
+	// The registered provider's matches now cover the moved grants
+	if err := matches.EnqueueRecalculation(tx, int64(registeredID), "provider"); err != nil {
+		return fmt.Errorf("error queueing match recalculation: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing merge: %v", err)
+	}
+	return nil
+}
+
+func scanCandidate(row interface{ Scan(...interface{}) error }) (*Candidate, error) {
+	var c Candidate
+	err := row.Scan(
+		&c.ID,
+		&c.Imported.ID, &c.Imported.OrganizationName, &c.Imported.WebsiteURL, &c.Imported.ImportedFrom,
+		&c.Registered.ID, &c.Registered.OrganizationName, &c.Registered.WebsiteURL,
+		&c.Score, &c.NameSimilarity, pq.Array(&c.Reasons), &c.Status, &c.DetectedAt, &c.ReviewedBy, &c.ReviewedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
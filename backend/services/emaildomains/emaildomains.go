@@ -0,0 +1,163 @@
+// Package emaildomains rejects email addresses at throwaway ("disposable")
+// providers. The block list ships with the backend and can be replaced at
+// runtime from a file; admins allow domains listed by mistake.
+package emaildomains
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	_ "embed"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// DefaultReloadInterval is used when DISPOSABLE_EMAIL_DOMAINS_RELOAD is unset or invalid
+const DefaultReloadInterval = 5 * time.Minute
+
+//go:embed disposable_domains.txt
+var builtinList string
+
+var (
+	blocked     = parse(strings.NewReader(builtinList))
+	blockedLock sync.RWMutex
+)
+
+// StartReloader loads the list from DISPOSABLE_EMAIL_DOMAINS_FILE, when set,
+// and reloads it whenever the file changes, checking every
+// DISPOSABLE_EMAIL_DOMAINS_RELOAD (Go duration, default 5m) until ctx is done
+func StartReloader(ctx context.Context) {
+	path := os.Getenv("DISPOSABLE_EMAIL_DOMAINS_FILE")
+	if path == "" {
+		return
+	}
+
+	interval := DefaultReloadInterval
+	if value := os.Getenv("DISPOSABLE_EMAIL_DOMAINS_RELOAD"); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d > 0 {
+			interval = d
+		} else {
+			log.Printf("Invalid DISPOSABLE_EMAIL_DOMAINS_RELOAD %q, using %s", value, DefaultReloadInterval)
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		var loadedAt time.Time
+		for {
+			if info, err := os.Stat(path); err != nil {
+				log.Printf("Error reading disposable email domains: %v", err)
+			} else if info.ModTime() != loadedAt {
+				if err := loadFile(path); err != nil {
+					log.Printf("Error loading disposable email domains: %v", err)
+				} else {
+					loadedAt = info.ModTime()
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Domain returns the lowercased domain of an email address, or ""
+func Domain(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return ""
+	}
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(email[at+1:])), ".")
+}
+
+// Listed reports whether a domain, or a domain it is a subdomain of, is on
+// the block list, and returns the listed domain
+func Listed(domain string) (string, bool) {
+	blockedLock.RLock()
+	defer blockedLock.RUnlock()
+
+	for domain != "" {
+		if blocked[domain] {
+			return domain, true
+		}
+		_, parent, found := strings.Cut(domain, ".")
+		if !found {
+			break
+		}
+		domain = parent
+	}
+	return "", false
+}
+
+// Blocked reports whether an email address is at a disposable provider that
+// no admin has allowed. An override for a domain also covers its subdomains.
+func Blocked(db *sql.DB, email string) (bool, error) {
+	domain := Domain(email)
+	listed, ok := Listed(domain)
+	if !ok {
+		return false, nil
+	}
+
+	// The overrides that could apply: the domain itself up to the listed one
+	candidates := []string{domain}
+	for domain != listed {
+		_, domain, _ = strings.Cut(domain, ".")
+		candidates = append(candidates, domain)
+	}
+
+	var allowed bool
+	err := db.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM email_domain_overrides WHERE domain = ANY($1))
+	`, pq.Array(candidates)).Scan(&allowed)
+	if err != nil {
+		return false, fmt.Errorf("error checking email domain overrides: %v", err)
+	}
+	return !allowed, nil
+}
+
+// loadFile replaces the block list with the domains in the file at path
+func loadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	domains := parse(file)
+	if len(domains) == 0 {
+		// Most likely a truncated write; keep the current list
+		return fmt.Errorf("%s lists no domains", path)
+	}
+
+	blockedLock.Lock()
+	blocked = domains
+	blockedLock.Unlock()
+	log.Printf("Loaded %d disposable email domains from %s", len(domains), path)
+	return nil
+}
+
+// parse reads one domain per line, skipping blank lines and # comments
+func parse(r io.Reader) map[string]bool {
+	domains := map[string]bool{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		line = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(line)), ".")
+		if line != "" {
+			domains[line] = true
+		}
+	}
+	return domains
+}
@@ -0,0 +1,372 @@
+// Package entitlements resolves which plan an organization is on and enforces
+// the plan's quotas. It does not know about billing providers: whatever sells
+// the plans records the outcome with SetSubscription.
+package entitlements
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+)
+
+// Plans
+const (
+	PlanFree = "free"
+	PlanPro  = "pro"
+)
+
+// Quotas. A limit of 0 turns the feature off for the plan.
+const (
+	// QuotaVisibleMatches caps how many of the best potential matches are shown
+	QuotaVisibleMatches = "visible_matches"
+	// QuotaMessageTemplates caps the saved message templates
+	QuotaMessageTemplates = "message_templates"
+	// QuotaMonthlyExports caps the data exports per calendar month (UTC)
+	QuotaMonthlyExports = "monthly_exports"
+	// QuotaMonthlyCampaigns caps the messaging campaigns per calendar month (UTC)
+	QuotaMonthlyCampaigns = "monthly_campaigns"
+)
+
+// Unlimited is the limit of a quota the plan does not cap
+const Unlimited = -1
+
+// DefaultGracePeriod is used when BILLING_GRACE_PERIOD is unset or invalid
+const DefaultGracePeriod = 7 * 24 * time.Hour
+
+// Subscription statuses
+const (
+	StatusActive   = "active"
+	StatusPastDue  = "past_due"
+	StatusCanceled = "canceled"
+)
+
+// ErrQuotaExceeded is returned when a quota is used up or the plan does not
+// include the feature
+var ErrQuotaExceeded = errors.New("plan quota exceeded")
+
+// ErrUnknownPlan is returned for plan names not in Plans
+var ErrUnknownPlan = errors.New("unknown plan")
+
+// ErrSubscribed is returned when a trial is granted to an organization that
+// already has a subscription
+var ErrSubscribed = errors.New("already subscribed")
+
+// ProviderTrial records plans granted as free trials rather than sold
+const ProviderTrial = "trial"
+
+// Plan is a tier with its quota limits
+type Plan struct {
+	Name   string         `json:"name"`
+	Limits map[string]int `json:"limits"`
+}
+
+// Plans lists the available plans by name
+var Plans = map[string]Plan{
+	PlanFree: {
+		Name: PlanFree,
+		Limits: map[string]int{
+			QuotaVisibleMatches:   10,
+			QuotaMessageTemplates: 3,
+			QuotaMonthlyExports:   1,
+			QuotaMonthlyCampaigns: 2,
+		},
+	},
+	PlanPro: {
+		Name: PlanPro,
+		Limits: map[string]int{
+			QuotaVisibleMatches:   Unlimited,
+			QuotaMessageTemplates: 50,
+			QuotaMonthlyExports:   30,
+			QuotaMonthlyCampaigns: 20,
+		},
+	},
+}
+
+// Subscription is an organization's paid plan as recorded by a billing
+// provider, or by an admin ("manual")
+type Subscription struct {
+	Plan              string     `json:"plan"`
+	Status            string     `json:"status"`
+	Provider          string     `json:"provider"`
+	ExternalID        *string    `json:"external_id,omitempty"`
+	CurrentPeriodEnd  *time.Time `json:"current_period_end"`
+	CancelAtPeriodEnd bool       `json:"cancel_at_period_end"`
+	GraceUntil        *time.Time `json:"grace_until"` // Set while past due: when the plan lapses unless paid
+	UpdatedAt         time.Time  `json:"updated_at"`
+}
+
+// Entitlements are what an organization may currently use
+type Entitlements struct {
+	UserID       int
+	Plan         Plan
+	Subscription *Subscription
+}
+
+// Limit returns the quota's limit on the plan, Unlimited or a count
+func (e *Entitlements) Limit(quota string) int {
+	return e.Plan.Limits[quota]
+}
+
+// Enabled reports whether the plan includes the feature behind a quota at all
+func (e *Entitlements) Enabled(quota string) bool {
+	return e.Limit(quota) != 0
+}
+
+// Allows reports whether one more use fits the quota when used are in use
+func (e *Entitlements) Allows(quota string, used int) bool {
+	limit := e.Limit(quota)
+	return limit == Unlimited || used < limit
+}
+
+// ForUser returns the user's entitlements: their subscription's plan while it
+// is active, the free plan otherwise
+func ForUser(db *sql.DB, userID int) (*Entitlements, error) {
+	subscription, err := LoadSubscription(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	entitlements := &Entitlements{UserID: userID, Plan: Plans[PlanFree], Subscription: subscription}
+	if subscription != nil && subscription.active(time.Now()) {
+		if plan, ok := Plans[subscription.Plan]; ok {
+			entitlements.Plan = plan
+		}
+	}
+	return entitlements, nil
+}
+
+// active reports whether the subscription grants its plan at now. Past due
+// subscriptions keep it until their grace period ends, and active ones for a
+// grace period after the paid period in case the renewal is late to arrive.
+func (s *Subscription) active(now time.Time) bool {
+	switch s.Status {
+	case StatusActive:
+		if s.CurrentPeriodEnd == nil {
+			return true
+		}
+		if s.Provider == ProviderTrial {
+			return s.CurrentPeriodEnd.After(now)
+		}
+		return s.CurrentPeriodEnd.Add(GracePeriod()).After(now)
+	case StatusPastDue:
+		return s.GraceUntil != nil && s.GraceUntil.After(now)
+	default:
+		return false
+	}
+}
+
+// GracePeriod returns how long a paid plan is kept after a failed payment,
+// read from BILLING_GRACE_PERIOD as a Go duration (e.g. "72h")
+func GracePeriod() time.Duration {
+	value := os.Getenv("BILLING_GRACE_PERIOD")
+	if value == "" {
+		return DefaultGracePeriod
+	}
+
+	period, err := time.ParseDuration(value)
+	if err != nil || period < 0 {
+		log.Printf("Invalid BILLING_GRACE_PERIOD %q, using %s", value, DefaultGracePeriod)
+		return DefaultGracePeriod
+	}
+	return period
+}
+
+// LoadSubscription returns the user's subscription, or nil without one
+func LoadSubscription(db *sql.DB, userID int) (*Subscription, error) {
+	var s Subscription
+	err := db.QueryRow(`
+		SELECT plan, status, provider, external_id, current_period_end, cancel_at_period_end, grace_until, updated_at
+		FROM plan_subscriptions
+		WHERE user_id = $1
+	`, userID).Scan(&s.Plan, &s.Status, &s.Provider, &s.ExternalID, &s.CurrentPeriodEnd, &s.CancelAtPeriodEnd, &s.GraceUntil, &s.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error loading subscription: %v", err)
+	}
+	return &s, nil
+}
+
+// SetSubscription records the user's plan as sold by a billing provider. The
+// grace period starts when the subscription first becomes past due.
+func SetSubscription(db *sql.DB, userID int, s Subscription) error {
+	if _, ok := Plans[s.Plan]; !ok {
+		return ErrUnknownPlan
+	}
+	switch s.Status {
+	case StatusActive, StatusPastDue, StatusCanceled:
+	default:
+		return fmt.Errorf("invalid subscription status %q", s.Status)
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO plan_subscriptions (user_id, plan, status, provider, external_id, current_period_end,
+			cancel_at_period_end, grace_until)
+		VALUES ($1, $2, $3::varchar, $4, $5, $6, $7,
+			CASE WHEN $3 = 'past_due' THEN CURRENT_TIMESTAMP + $8 * INTERVAL '1 second' END)
+		ON CONFLICT (user_id) DO UPDATE
+		SET plan = EXCLUDED.plan,
+			status = EXCLUDED.status,
+			provider = EXCLUDED.provider,
+			external_id = EXCLUDED.external_id,
+			current_period_end = EXCLUDED.current_period_end,
+			cancel_at_period_end = EXCLUDED.cancel_at_period_end,
+			grace_until = CASE
+				WHEN EXCLUDED.status <> 'past_due' THEN NULL
+				WHEN plan_subscriptions.status = 'past_due' THEN plan_subscriptions.grace_until
+				ELSE EXCLUDED.grace_until
+			END,
+			updated_at = CURRENT_TIMESTAMP
+	`, userID, s.Plan, s.Status, s.Provider, s.ExternalID, s.CurrentPeriodEnd, s.CancelAtPeriodEnd, GracePeriod().Seconds())
+	if err != nil {
+		return fmt.Errorf("error saving subscription: %v", err)
+	}
+	return nil
+}
+
+// ExtendTrial grants the organization a free trial of plan, or extends the
+// trial it is on, by length. Organizations with a subscription get
+// ErrSubscribed.
+func ExtendTrial(db *sql.DB, userID int, plan string, length time.Duration) (time.Time, error) {
+	if _, ok := Plans[plan]; !ok {
+		return time.Time{}, ErrUnknownPlan
+	}
+
+	var until time.Time
+	err := db.QueryRow(`
+		INSERT INTO plan_subscriptions (user_id, plan, status, provider, current_period_end)
+		VALUES ($1, $2, 'active', $3, CURRENT_TIMESTAMP + $4 * INTERVAL '1 second')
+		ON CONFLICT (user_id) DO UPDATE
+		SET plan = EXCLUDED.plan,
+			status = 'active',
+			provider = EXCLUDED.provider,
+			external_id = NULL,
+			cancel_at_period_end = false,
+			grace_until = NULL,
+			current_period_end = GREATEST(
+				CASE WHEN plan_subscriptions.provider = $3 AND plan_subscriptions.status = 'active'
+					THEN plan_subscriptions.current_period_end END,
+				CURRENT_TIMESTAMP
+			) + $4 * INTERVAL '1 second',
+			updated_at = CURRENT_TIMESTAMP
+		WHERE plan_subscriptions.status = 'canceled' OR plan_subscriptions.provider = $3
+		RETURNING current_period_end
+	`, userID, plan, ProviderTrial, length.Seconds()).Scan(&until)
+	if err == sql.ErrNoRows {
+		return time.Time{}, ErrSubscribed
+	} else if err != nil {
+		return time.Time{}, fmt.Errorf("error extending trial: %v", err)
+	}
+	return until, nil
+}
+
+// Consume records one use of a monthly quota, or returns ErrQuotaExceeded
+// when the month's uses are used up
+func Consume(db *sql.DB, userID int, quota string) error {
+	entitlements, err := ForUser(db, userID)
+	if err != nil {
+		return err
+	}
+	limit := entitlements.Limit(quota)
+	if limit == 0 {
+		return ErrQuotaExceeded
+	}
+
+	var used int
+	err = db.QueryRow(`
+		INSERT INTO usage_counters (user_id, quota, period_start, used)
+		VALUES ($1, $2, $3, 1)
+		ON CONFLICT (user_id, quota, period_start) DO UPDATE
+		SET used = usage_counters.used + 1
+		WHERE $4 < 0 OR usage_counters.used < $4
+		RETURNING used
+	`, userID, quota, periodStart(time.Now()), limit).Scan(&used)
+	if err == sql.ErrNoRows {
+		return ErrQuotaExceeded
+	} else if err != nil {
+		return fmt.Errorf("error recording %s usage: %v", quota, err)
+	}
+	return nil
+}
+
+// QuotaUsage is how much of a quota is in use
+type QuotaUsage struct {
+	Quota     string     `json:"quota"`
+	Limit     int        `json:"limit"` // Unlimited (-1) or a count
+	Used      int        `json:"used"`
+	Remaining *int       `json:"remaining"` // Null when unlimited
+	ResetsAt  *time.Time `json:"resets_at,omitempty"`
+}
+
+// UsageReport is an organization's plan with its usage against each limit
+type UsageReport struct {
+	Plan         string        `json:"plan"`
+	Subscription *Subscription `json:"subscription"`
+	Quotas       []QuotaUsage  `json:"quotas"`
+}
+
+// Usage reports the user's current usage against their plan's limits
+func Usage(db *sql.DB, userID int) (*UsageReport, error) {
+	entitlements, err := ForUser(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	start := periodStart(now)
+	resetsAt := start.AddDate(0, 1, 0)
+
+	var matches, templates, exports, campaigns int
+	err = db.QueryRow(`
+		SELECT
+			(SELECT COUNT(*) FROM matches WHERE user_id = $1),
+			(SELECT COUNT(*) FROM message_templates WHERE user_id = $1),
+			COALESCE((
+				SELECT used FROM usage_counters
+				WHERE user_id = $1 AND quota = $2 AND period_start = $3
+			), 0),
+			COALESCE((
+				SELECT used FROM usage_counters
+				WHERE user_id = $1 AND quota = $4 AND period_start = $3
+			), 0)
+	`, userID, QuotaMonthlyExports, start, QuotaMonthlyCampaigns).Scan(&matches, &templates, &exports, &campaigns)
+	if err != nil {
+		return nil, fmt.Errorf("error counting usage: %v", err)
+	}
+	used := map[string]int{
+		QuotaVisibleMatches:   matches,
+		QuotaMessageTemplates: templates,
+		QuotaMonthlyExports:   exports,
+		QuotaMonthlyCampaigns: campaigns,
+	}
+
+	report := &UsageReport{Plan: entitlements.Plan.Name, Subscription: entitlements.Subscription}
+	quotas := make([]string, 0, len(entitlements.Plan.Limits))
+	for quota := range entitlements.Plan.Limits {
+		quotas = append(quotas, quota)
+	}
+	sort.Strings(quotas)
+
+	for _, quota := range quotas {
+		usage := QuotaUsage{Quota: quota, Limit: entitlements.Limit(quota), Used: used[quota]}
+		if usage.Limit != Unlimited {
+			remaining := max(usage.Limit-usage.Used, 0)
+			usage.Remaining = &remaining
+		}
+		if quota == QuotaMonthlyExports || quota == QuotaMonthlyCampaigns {
+			usage.ResetsAt = &resetsAt
+		}
+		report.Quotas = append(report.Quotas, usage)
+	}
+	return report, nil
+}
+
+// periodStart returns the first instant of the calendar month (UTC) of t
+func periodStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,292 @@
+// Package experiments runs A/B tests of the matching algorithm: users are
+// assigned to a variant of the running experiment, their matches are scored
+// with the variant's scoring config, and the matches they are shown are
+// recorded so connection and dismissal rates can be compared per variant.
+package experiments
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Experiment statuses. At most one experiment runs at a time.
+const (
+	StatusDraft   = "draft"
+	StatusRunning = "running"
+	StatusStopped = "stopped"
+)
+
+var (
+	// ErrNotFound is returned for unknown experiments
+	ErrNotFound = errors.New("experiment not found")
+	// ErrAlreadyRunning is returned when starting an experiment while another runs
+	ErrAlreadyRunning = errors.New("another experiment is already running")
+	// ErrInvalidStatus is returned for transitions the experiment's status forbids
+	ErrInvalidStatus = errors.New("experiment cannot change to that status")
+)
+
+// ScoringConfig changes how matches are scored for a variant. Weights are
+// keyed by scorer name (e.g. "sectors", "geo"); scorers left out keep their
+// default weight and a weight of 0 turns a scorer off. An empty config scores
+// like the default pipeline.
+type ScoringConfig struct {
+	Weights  map[string]float64 `json:"weights,omitempty"`
+	MinScore *float64           `json:"min_score,omitempty"`
+}
+
+// Variant is one arm of an experiment. Traffic is its relative share of users.
+type Variant struct {
+	Name    string        `json:"name"`
+	Traffic int           `json:"traffic"`
+	Config  ScoringConfig `json:"config"`
+}
+
+// Experiment compares variants of the matching algorithm
+type Experiment struct {
+	ID          int        `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Status      string     `json:"status"`
+	Variants    []Variant  `json:"variants"`
+	CreatedBy   *int       `json:"created_by"`
+	CreatedAt   time.Time  `json:"created_at"`
+	StartedAt   *time.Time `json:"started_at"`
+	StoppedAt   *time.Time `json:"stopped_at"`
+}
+
+// Variant returns the named variant, or nil
+func (e *Experiment) Variant(name string) *Variant {
+	for i := range e.Variants {
+		if e.Variants[i].Name == name {
+			return &e.Variants[i]
+		}
+	}
+	return nil
+}
+
+// Querier is satisfied by both *sql.DB and *sql.Tx
+type Querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+const selectExperimentQuery = `
+	SELECT id, name, description, status, variants, created_by, created_at, started_at, stopped_at
+	FROM experiments
+`
+
+// Create stores a new experiment as a draft
+func Create(db *sql.DB, name, description string, variants []Variant, createdBy int) (*Experiment, error) {
+	encoded, err := json.Marshal(variants)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding variants: %v", err)
+	}
+
+	var id int
+	err = db.QueryRow(`
+		INSERT INTO experiments (name, description, variants, created_by)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`, name, description, encoded, createdBy).Scan(&id)
+	if err != nil {
+		return nil, fmt.Errorf("error creating experiment: %v", err)
+	}
+	return Get(db, id)
+}
+
+// Get returns an experiment
+func Get(q Querier, id int) (*Experiment, error) {
+	experiment, err := scanExperiment(q.QueryRow(selectExperimentQuery+"WHERE id = $1", id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return experiment, err
+}
+
+// List returns every experiment, newest first
+func List(db *sql.DB) ([]Experiment, error) {
+	rows, err := db.Query(selectExperimentQuery + "ORDER BY created_at DESC, id DESC")
+	if err != nil {
+		return nil, fmt.Errorf("error querying experiments: %v", err)
+	}
+	defer rows.Close()
+
+	experiments := []Experiment{}
+	for rows.Next() {
+		experiment, err := scanExperiment(rows)
+		if err != nil {
+			return nil, err
+		}
+		experiments = append(experiments, *experiment)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating experiments: %v", err)
+	}
+	return experiments, nil
+}
+
+// Running returns the running experiment, or nil when none runs
+func Running(q Querier) (*Experiment, error) {
+	experiment, err := scanExperiment(q.QueryRow(selectExperimentQuery + "WHERE status = 'running'"))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return experiment, err
+}
+
+// Start runs a draft experiment. Users are assigned to its variants as their
+// matches are next recalculated.
+func Start(db *sql.DB, id int) (*Experiment, error) {
+	result, err := db.Exec(`
+		UPDATE experiments SET status = 'running', started_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND status = 'draft'
+	`, id)
+	if err != nil {
+		if strings.Contains(err.Error(), "unique constraint") {
+			return nil, ErrAlreadyRunning
+		}
+		return nil, fmt.Errorf("error starting experiment: %v", err)
+	}
+	return transitioned(db, id, result)
+}
+
+// Stop ends a running experiment. Its assignments and exposures are kept for
+// the results; matches are scored with the default pipeline again as they
+// are recalculated.
+func Stop(db *sql.DB, id int) (*Experiment, error) {
+	result, err := db.Exec(`
+		UPDATE experiments SET status = 'stopped', stopped_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND status = 'running'
+	`, id)
+	if err != nil {
+		return nil, fmt.Errorf("error stopping experiment: %v", err)
+	}
+	return transitioned(db, id, result)
+}
+
+// transitioned returns the experiment after a status update, telling unknown
+// experiments from ones whose status did not allow it
+func transitioned(db *sql.DB, id int, result sql.Result) (*Experiment, error) {
+	experiment, err := Get(db, id)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, ErrInvalidStatus
+	}
+	return experiment, nil
+}
+
+// Assign returns the user's variant in the experiment, assigning one on first
+// use. Assignment hashes the experiment and user, so it is stable and spread
+// over the variants by their traffic.
+func Assign(q Querier, experiment *Experiment, userID int64) (*Variant, error) {
+	var total int
+	for _, v := range experiment.Variants {
+		total += v.Traffic
+	}
+	if total <= 0 {
+		return nil, fmt.Errorf("experiment %d has no traffic", experiment.ID)
+	}
+
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%d:%d", experiment.ID, userID)
+	bucket := int(h.Sum32() % uint32(total))
+
+	name := experiment.Variants[len(experiment.Variants)-1].Name
+	for _, v := range experiment.Variants {
+		if bucket < v.Traffic {
+			name = v.Name
+			break
+		}
+		bucket -= v.Traffic
+	}
+
+	// An existing assignment wins, so users keep their variant
+	err := q.QueryRow(`
+		INSERT INTO experiment_assignments (experiment_id, user_id, variant)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (experiment_id, user_id) DO UPDATE SET variant = experiment_assignments.variant
+		RETURNING variant
+	`, experiment.ID, userID, name).Scan(&name)
+	if err != nil {
+		return nil, fmt.Errorf("error assigning experiment variant: %v", err)
+	}
+
+	if variant := experiment.Variant(name); variant != nil {
+		return variant, nil
+	}
+	return nil, fmt.Errorf("experiment %d has no variant %q", experiment.ID, name)
+}
+
+// Exposure is a match shown to a user, with the variant that scored it
+type Exposure struct {
+	MatchID int64
+	Variant string
+}
+
+// RecordExposures records the matches shown to a user that were scored by
+// their variant of the running experiment. Matches scored outside the
+// experiment are ignored, as is a match shown again.
+func RecordExposures(db *sql.DB, userID int, shown []Exposure) error {
+	var matchIDs []int64
+	var variants []string
+	for _, exposure := range shown {
+		if exposure.Variant != "" {
+			matchIDs = append(matchIDs, exposure.MatchID)
+			variants = append(variants, exposure.Variant)
+		}
+	}
+	if len(matchIDs) == 0 {
+		return nil
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO experiment_exposures (experiment_id, user_id, match_id, variant)
+		SELECT a.experiment_id, a.user_id, shown.match_id, a.variant
+		FROM experiment_assignments a
+		JOIN experiments e ON e.id = a.experiment_id AND e.status = 'running'
+		JOIN unnest($2::bigint[], $3::text[]) AS shown(match_id, variant) ON shown.variant = a.variant
+		WHERE a.user_id = $1
+		ON CONFLICT (experiment_id, user_id, match_id) DO NOTHING
+	`, userID, pq.Array(matchIDs), pq.Array(variants))
+	if err != nil {
+		return fmt.Errorf("error recording experiment exposures: %v", err)
+	}
+	return nil
+}
+
+// scanExperiment scans a row produced by selectExperimentQuery
+func scanExperiment(row interface{ Scan(...interface{}) error }) (*Experiment, error) {
+	var experiment Experiment
+	var variants []byte
+	err := row.Scan(
+		&experiment.ID,
+		&experiment.Name,
+		&experiment.Description,
+		&experiment.Status,
+		&variants,
+		&experiment.CreatedBy,
+		&experiment.CreatedAt,
+		&experiment.StartedAt,
+		&experiment.StoppedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error scanning experiment: %v", err)
+	}
+	if err := json.Unmarshal(variants, &experiment.Variants); err != nil {
+		return nil, fmt.Errorf("error decoding variants of experiment %d: %v", experiment.ID, err)
+	}
+	return &experiment, nil
+}
@@ -0,0 +1,108 @@
+package experiments
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// VariantResults are the outcomes of the matches a variant produced and users
+// were shown. A connection or dismissal counts when it was made after the
+// match was first shown, by either side for connections.
+type VariantResults struct {
+	Variant        string  `json:"variant"`
+	Traffic        int     `json:"traffic"`
+	AssignedUsers  int     `json:"assigned_users"`
+	ExposedUsers   int     `json:"exposed_users"`
+	Exposures      int     `json:"exposures"` // distinct matches shown
+	Connections    int     `json:"connections"`
+	Dismissals     int     `json:"dismissals"`
+	ConnectionRate float64 `json:"connection_rate"` // connections per exposure
+	DismissalRate  float64 `json:"dismissal_rate"`  // dismissals per exposure
+}
+
+// Results is an experiment with the results of each of its variants
+type Results struct {
+	Experiment *Experiment      `json:"experiment"`
+	Variants   []VariantResults `json:"variants"`
+}
+
+// LoadResults compiles the results of an experiment, in variant order
+func LoadResults(db *sql.DB, id int) (*Results, error) {
+	experiment, err := Get(db, id)
+	if err != nil {
+		return nil, err
+	}
+
+	byVariant := make(map[string]*VariantResults)
+	results := &Results{Experiment: experiment, Variants: make([]VariantResults, len(experiment.Variants))}
+	for i, v := range experiment.Variants {
+		results.Variants[i] = VariantResults{Variant: v.Name, Traffic: v.Traffic}
+		byVariant[v.Name] = &results.Variants[i]
+	}
+
+	rows, err := db.Query(`
+		WITH assigned AS (
+			SELECT variant, COUNT(*) AS users
+			FROM experiment_assignments
+			WHERE experiment_id = $1
+			GROUP BY variant
+		),
+		outcomes AS (
+			SELECT
+				x.variant,
+				COUNT(DISTINCT x.user_id) AS users,
+				COUNT(*) AS exposures,
+				COUNT(*) FILTER (WHERE EXISTS (
+					SELECT 1 FROM connections c
+					WHERE ((c.initiator_id = x.user_id AND c.target_id = x.match_id)
+						OR (c.initiator_id = x.match_id AND c.target_id = x.user_id))
+						AND c.created_at >= x.shown_at
+				)) AS connections,
+				COUNT(*) FILTER (WHERE EXISTS (
+					SELECT 1 FROM dismissed_matches dm
+					WHERE dm.user_id = x.user_id AND dm.match_id = x.match_id
+						AND dm.dismissed_at >= x.shown_at
+				)) AS dismissals
+			FROM experiment_exposures x
+			WHERE x.experiment_id = $1
+			GROUP BY x.variant
+		)
+		SELECT
+			COALESCE(a.variant, o.variant),
+			COALESCE(a.users, 0),
+			COALESCE(o.users, 0),
+			COALESCE(o.exposures, 0),
+			COALESCE(o.connections, 0),
+			COALESCE(o.dismissals, 0)
+		FROM assigned a
+		FULL JOIN outcomes o ON o.variant = a.variant
+	`, id)
+	if err != nil {
+		return nil, fmt.Errorf("error querying experiment results: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		var r VariantResults
+		if err := rows.Scan(&name, &r.AssignedUsers, &r.ExposedUsers, &r.Exposures, &r.Connections, &r.Dismissals); err != nil {
+			return nil, fmt.Errorf("error scanning experiment results: %v", err)
+		}
+		variant, ok := byVariant[name]
+		if !ok {
+			// Variants are fixed once created, so this is not expected
+			continue
+		}
+		r.Variant, r.Traffic = variant.Variant, variant.Traffic
+		if r.Exposures > 0 {
+			r.ConnectionRate = float64(r.Connections) / float64(r.Exposures)
+			r.DismissalRate = float64(r.Dismissals) / float64(r.Exposures)
+		}
+		*variant = r
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating experiment results: %v", err)
+	}
+
+	return results, nil
+}
@@ -0,0 +1,296 @@
+package experiments
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TopRanks is how many of the best matches are compared for overlap, about
+// what a user sees without scrolling
+const TopRanks = 10
+
+// ShadowRun scores matches with a candidate config next to the live one. Each
+// time a user's matches are recalculated while it runs, the candidate list is
+// compared with the stored one and the difference kept; users keep seeing the
+// stored list. At most one shadow run is active; it runs from creation until
+// stopped.
+type ShadowRun struct {
+	ID          int           `json:"id"`
+	Name        string        `json:"name"`
+	Description string        `json:"description"`
+	Status      string        `json:"status"` // running or stopped
+	Config      ScoringConfig `json:"config"`
+	CreatedBy   *int          `json:"created_by"`
+	CreatedAt   time.Time     `json:"created_at"`
+	StoppedAt   *time.Time    `json:"stopped_at"`
+}
+
+// RankChange is a match whose rank differs between the stored and candidate
+// lists. A nil rank means the match is missing from that list.
+type RankChange struct {
+	MatchID        int64    `json:"match_id"`
+	CurrentRank    *int     `json:"current_rank"`
+	CandidateRank  *int     `json:"candidate_rank"`
+	CurrentScore   *float64 `json:"current_score"`
+	CandidateScore *float64 `json:"candidate_score"`
+}
+
+// ShadowDiff compares a user's latest stored and candidate match lists
+type ShadowDiff struct {
+	UserID           int          `json:"user_id"`
+	Role             string       `json:"role"`
+	CurrentMatches   int          `json:"current_matches"`
+	CandidateMatches int          `json:"candidate_matches"`
+	NewMatches       int          `json:"new_matches"`   // only in the candidate list
+	LostMatches      int          `json:"lost_matches"`  // only in the stored list
+	MovedMatches     int          `json:"moved_matches"` // in both, at another rank
+	MeanRankShift    float64      `json:"mean_rank_shift"`
+	TopOverlap       int          `json:"top_overlap"` // matches in the top 10 of both lists
+	Changes          []RankChange `json:"changes,omitempty"`
+	CalculatedAt     time.Time    `json:"calculated_at"`
+}
+
+// ShadowReport aggregates the diffs of a shadow run
+type ShadowReport struct {
+	Run               *ShadowRun   `json:"run"`
+	Users             int          `json:"users"`               // users compared so far
+	ChangedUsers      int          `json:"changed_users"`       // users whose list would change at all
+	AvgCurrent        float64      `json:"avg_current_matches"` // per user
+	AvgCandidate      float64      `json:"avg_candidate_matches"`
+	NewMatches        int          `json:"new_matches"`
+	LostMatches       int          `json:"lost_matches"`
+	MovedMatches      int          `json:"moved_matches"`
+	AvgMeanRankShift  float64      `json:"avg_mean_rank_shift"`
+	AvgTopOverlapRate float64      `json:"avg_top_overlap_rate"` // share of the top 10 kept
+	UsersLosingAll    int          `json:"users_losing_all"`     // users with matches who would have none
+	LargestChanges    []ShadowDiff `json:"largest_changes"`
+}
+
+const selectShadowRunQuery = `
+	SELECT id, name, description, status, config, created_by, created_at, stopped_at
+	FROM shadow_runs
+`
+
+// CreateShadow starts a shadow run of a candidate config
+func CreateShadow(db *sql.DB, name, description string, config ScoringConfig, createdBy int) (*ShadowRun, error) {
+	encoded, err := json.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding config: %v", err)
+	}
+
+	var id int
+	err = db.QueryRow(`
+		INSERT INTO shadow_runs (name, description, config, created_by)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`, name, description, encoded, createdBy).Scan(&id)
+	if err != nil {
+		if strings.Contains(err.Error(), "unique constraint") {
+			return nil, ErrAlreadyRunning
+		}
+		return nil, fmt.Errorf("error creating shadow run: %v", err)
+	}
+	return GetShadow(db, id)
+}
+
+// GetShadow returns a shadow run
+func GetShadow(q Querier, id int) (*ShadowRun, error) {
+	run, err := scanShadowRun(q.QueryRow(selectShadowRunQuery+"WHERE id = $1", id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return run, err
+}
+
+// ListShadows returns every shadow run, newest first
+func ListShadows(db *sql.DB) ([]ShadowRun, error) {
+	rows, err := db.Query(selectShadowRunQuery + "ORDER BY created_at DESC, id DESC")
+	if err != nil {
+		return nil, fmt.Errorf("error querying shadow runs: %v", err)
+	}
+	defer rows.Close()
+
+	runs := []ShadowRun{}
+	for rows.Next() {
+		run, err := scanShadowRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, *run)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating shadow runs: %v", err)
+	}
+	return runs, nil
+}
+
+// RunningShadow returns the active shadow run, or nil when none runs
+func RunningShadow(q Querier) (*ShadowRun, error) {
+	run, err := scanShadowRun(q.QueryRow(selectShadowRunQuery + "WHERE status = 'running'"))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return run, err
+}
+
+// StopShadow stops a shadow run; its diffs are kept for the report
+func StopShadow(db *sql.DB, id int) (*ShadowRun, error) {
+	result, err := db.Exec(`
+		UPDATE shadow_runs SET status = 'stopped', stopped_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND status = 'running'
+	`, id)
+	if err != nil {
+		return nil, fmt.Errorf("error stopping shadow run: %v", err)
+	}
+
+	run, err := GetShadow(db, id)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, ErrInvalidStatus
+	}
+	return run, nil
+}
+
+// LoadShadowReport aggregates the diffs of a shadow run, listing the users
+// whose lists would change most
+func LoadShadowReport(db *sql.DB, id int, largest int) (*ShadowReport, error) {
+	run, err := GetShadow(db, id)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ShadowReport{Run: run, LargestChanges: []ShadowDiff{}}
+	err = db.QueryRow(`
+		SELECT
+			COUNT(*),
+			COUNT(*) FILTER (WHERE new_matches + lost_matches + moved_matches > 0),
+			COALESCE(AVG(current_matches), 0),
+			COALESCE(AVG(candidate_matches), 0),
+			COALESCE(SUM(new_matches), 0),
+			COALESCE(SUM(lost_matches), 0),
+			COALESCE(SUM(moved_matches), 0),
+			COALESCE(AVG(mean_rank_shift), 0),
+			COALESCE(AVG(top_overlap::float / LEAST($2, current_matches)) FILTER (WHERE current_matches > 0), 0),
+			COUNT(*) FILTER (WHERE current_matches > 0 AND candidate_matches = 0)
+		FROM shadow_diffs
+		WHERE shadow_id = $1
+	`, id, TopRanks).Scan(
+		&report.Users,
+		&report.ChangedUsers,
+		&report.AvgCurrent,
+		&report.AvgCandidate,
+		&report.NewMatches,
+		&report.LostMatches,
+		&report.MovedMatches,
+		&report.AvgMeanRankShift,
+		&report.AvgTopOverlapRate,
+		&report.UsersLosingAll,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error aggregating shadow diffs: %v", err)
+	}
+
+	rows, err := db.Query(selectShadowDiffQuery+`
+		WHERE d.shadow_id = $1 AND d.new_matches + d.lost_matches + d.moved_matches > 0
+		ORDER BY d.new_matches + d.lost_matches DESC, d.moved_matches DESC, d.user_id
+		LIMIT $2
+	`, id, largest)
+	if err != nil {
+		return nil, fmt.Errorf("error querying shadow diffs: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		diff, err := scanShadowDiff(rows)
+		if err != nil {
+			return nil, err
+		}
+		// The report lists users; their changes are fetched one at a time
+		diff.Changes = nil
+		report.LargestChanges = append(report.LargestChanges, *diff)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating shadow diffs: %v", err)
+	}
+
+	return report, nil
+}
+
+// GetShadowDiff returns a user's latest diff in a shadow run, with every
+// match that changed rank
+func GetShadowDiff(db *sql.DB, id, userID int) (*ShadowDiff, error) {
+	diff, err := scanShadowDiff(db.QueryRow(selectShadowDiffQuery+"WHERE d.shadow_id = $1 AND d.user_id = $2", id, userID))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return diff, err
+}
+
+const selectShadowDiffQuery = `
+	SELECT
+		d.user_id, u.role, d.current_matches, d.candidate_matches,
+		d.new_matches, d.lost_matches, d.moved_matches,
+		d.mean_rank_shift, d.top_overlap, d.changes, d.calculated_at
+	FROM shadow_diffs d
+	JOIN users u ON u.id = d.user_id
+`
+
+// scanShadowDiff scans a row produced by selectShadowDiffQuery
+func scanShadowDiff(row interface{ Scan(...interface{}) error }) (*ShadowDiff, error) {
+	var diff ShadowDiff
+	var changes []byte
+	err := row.Scan(
+		&diff.UserID,
+		&diff.Role,
+		&diff.CurrentMatches,
+		&diff.CandidateMatches,
+		&diff.NewMatches,
+		&diff.LostMatches,
+		&diff.MovedMatches,
+		&diff.MeanRankShift,
+		&diff.TopOverlap,
+		&changes,
+		&diff.CalculatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error scanning shadow diff: %v", err)
+	}
+	if err := json.Unmarshal(changes, &diff.Changes); err != nil {
+		return nil, fmt.Errorf("error decoding shadow diff of user %d: %v", diff.UserID, err)
+	}
+	return &diff, nil
+}
+
+// scanShadowRun scans a row produced by selectShadowRunQuery
+func scanShadowRun(row interface{ Scan(...interface{}) error }) (*ShadowRun, error) {
+	var run ShadowRun
+	var config []byte
+	err := row.Scan(
+		&run.ID,
+		&run.Name,
+		&run.Description,
+		&run.Status,
+		&config,
+		&run.CreatedBy,
+		&run.CreatedAt,
+		&run.StoppedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error scanning shadow run: %v", err)
+	}
+	if err := json.Unmarshal(config, &run.Config); err != nil {
+		return nil, fmt.Errorf("error decoding config of shadow run %d: %v", run.ID, err)
+	}
+	return &run, nil
+}
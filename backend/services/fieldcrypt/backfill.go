@@ -0,0 +1,72 @@
+package fieldcrypt
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+)
+
+// EncryptExistingProfiles encrypts EIN and contact email values that were stored
+// before encryption was enabled, or under a key that has since been rotated
+func EncryptExistingProfiles(db *sql.DB) error {
+	current := currentPrefix()
+	if current == "" {
+		return nil
+	}
+
+	rows, err := db.Query(`
+		SELECT user_id, COALESCE(ein, ''), COALESCE(contact_email, '')
+		FROM profiles
+		WHERE (ein <> '' AND NOT starts_with(ein, $1))
+			OR (contact_email <> '' AND NOT starts_with(contact_email, $1))
+	`, current)
+	if err != nil {
+		return fmt.Errorf("error querying profiles to encrypt: %v", err)
+	}
+
+	type storedProfile struct {
+		userID       int
+		ein          string
+		contactEmail string
+	}
+	var profiles []storedProfile
+	for rows.Next() {
+		var p storedProfile
+		if err := rows.Scan(&p.userID, &p.ein, &p.contactEmail); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning profile: %v", err)
+		}
+		profiles = append(profiles, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating profiles: %v", err)
+	}
+
+	for _, p := range profiles {
+		ein, err := Reencrypt(p.ein)
+		if err != nil {
+			return err
+		}
+		contactEmail, err := Reencrypt(p.contactEmail)
+		if err != nil {
+			return err
+		}
+
+		// Only overwrite values that are still the ones we read
+		_, err = db.Exec(`
+			UPDATE profiles
+			SET ein = CASE WHEN ein = $2 THEN $3 ELSE ein END,
+				contact_email = CASE WHEN contact_email = $4 THEN $5 ELSE contact_email END
+			WHERE user_id = $1
+		`, p.userID, p.ein, ein, p.contactEmail, contactEmail)
+		if err != nil {
+			return fmt.Errorf("error encrypting profile of user %d: %v", p.userID, err)
+		}
+	}
+
+	if len(profiles) > 0 {
+		log.Printf("Encrypted sensitive fields of %d existing profiles under the current key", len(profiles))
+	}
+	return nil
+}
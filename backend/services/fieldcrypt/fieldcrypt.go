@@ -0,0 +1,288 @@
+package fieldcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// prefix marks encrypted values; values without it are legacy plaintext
+const prefix = "enc:v1:"
+
+// KeyWrapper protects per-value data keys with a key-encryption key kept outside
+// the database, such as a local key from the environment or a KMS key
+type KeyWrapper interface {
+	KeyID() string
+	Wrap(dataKey []byte) ([]byte, error)
+	Unwrap(wrappedKey []byte) ([]byte, error)
+}
+
+var (
+	wrappers    = map[string]KeyWrapper{}
+	current     KeyWrapper
+	wrapperLock sync.RWMutex
+)
+
+// SetKeyWrapper installs the wrapper used to encrypt new values. Previously
+// installed wrappers stay available to decrypt values written under their key
+// ID; nil disables encryption of new values.
+func SetKeyWrapper(w KeyWrapper) {
+	wrapperLock.Lock()
+	defer wrapperLock.Unlock()
+	current = w
+	if w != nil {
+		wrappers[w.KeyID()] = w
+	}
+}
+
+// AddPreviousKeyWrapper installs a retired wrapper that only decrypts values
+// written under its key ID
+func AddPreviousKeyWrapper(w KeyWrapper) {
+	wrapperLock.Lock()
+	defer wrapperLock.Unlock()
+	if _, ok := wrappers[w.KeyID()]; !ok {
+		wrappers[w.KeyID()] = w
+	}
+}
+
+// ConfigureFromEnv installs the wrapper of NewKeyWrapperFromEnv for new values
+// and those of PreviousKeyWrappersFromEnv to decrypt older ones
+func ConfigureFromEnv() {
+	current := NewKeyWrapperFromEnv()
+	SetKeyWrapper(current)
+	for _, w := range PreviousKeyWrappersFromEnv() {
+		if current != nil && w.KeyID() == current.KeyID() {
+			log.Printf("FIELD_ENCRYPTION_PREVIOUS_KEYS reuses the current key ID %q, entry ignored", w.KeyID())
+			continue
+		}
+		AddPreviousKeyWrapper(w)
+	}
+}
+
+// NewKeyWrapperFromEnv returns a local wrapper for FIELD_ENCRYPTION_KEY (base64,
+// 32 bytes) named FIELD_ENCRYPTION_KEY_ID, or nil when encryption is not configured
+func NewKeyWrapperFromEnv() KeyWrapper {
+	encoded := os.Getenv("FIELD_ENCRYPTION_KEY")
+	if encoded == "" {
+		return nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != 32 {
+		log.Printf("FIELD_ENCRYPTION_KEY must be 32 base64-encoded bytes, field encryption disabled")
+		return nil
+	}
+
+	keyID := os.Getenv("FIELD_ENCRYPTION_KEY_ID")
+	if keyID == "" {
+		keyID = "local"
+	}
+
+	w, err := NewLocalKeyWrapper(keyID, key)
+	if err != nil {
+		log.Printf("Error configuring field encryption: %v", err)
+		return nil
+	}
+	return w
+}
+
+// PreviousKeyWrappersFromEnv returns local wrappers for the retired keys in
+// FIELD_ENCRYPTION_PREVIOUS_KEYS, comma-separated keyid:key pairs with keys as
+// in FIELD_ENCRYPTION_KEY. To rotate, move the current key into it, set a new
+// FIELD_ENCRYPTION_KEY and FIELD_ENCRYPTION_KEY_ID, and drop the old entry once
+// startup has re-encrypted the values written under it. Invalid entries are
+// logged and skipped.
+func PreviousKeyWrappersFromEnv() []KeyWrapper {
+	var previous []KeyWrapper
+	for _, entry := range strings.Split(os.Getenv("FIELD_ENCRYPTION_PREVIOUS_KEYS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		keyID, encoded, ok := strings.Cut(entry, ":")
+		if !ok || keyID == "" {
+			log.Printf("FIELD_ENCRYPTION_PREVIOUS_KEYS entries must be keyid:key, entry ignored")
+			continue
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != 32 {
+			log.Printf("FIELD_ENCRYPTION_PREVIOUS_KEYS key %q must be 32 base64-encoded bytes, entry ignored", keyID)
+			continue
+		}
+		w, err := NewLocalKeyWrapper(keyID, key)
+		if err != nil {
+			log.Printf("Error configuring previous field encryption key %q: %v", keyID, err)
+			continue
+		}
+		previous = append(previous, w)
+	}
+	return previous
+}
+
+// Enabled reports whether new values are encrypted
+func Enabled() bool {
+	wrapperLock.RLock()
+	defer wrapperLock.RUnlock()
+	return current != nil
+}
+
+// IsEncrypted reports whether a stored value was written by Encrypt
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// currentPrefix is the prefix of values encrypted under the current key, or ""
+// when encryption is disabled
+func currentPrefix() string {
+	wrapperLock.RLock()
+	defer wrapperLock.RUnlock()
+	if current == nil {
+		return ""
+	}
+	return prefix + current.KeyID() + ":"
+}
+
+// NeedsReencryption reports whether a stored value is plaintext or was written
+// under a previous key while encryption is enabled
+func NeedsReencryption(value string) bool {
+	current := currentPrefix()
+	return current != "" && value != "" && !strings.HasPrefix(value, current)
+}
+
+// Reencrypt encrypts a plaintext value, or one written under a previous key,
+// under the current key
+func Reencrypt(value string) (string, error) {
+	plaintext, err := Decrypt(value)
+	if err != nil {
+		return "", err
+	}
+	return Encrypt(plaintext)
+}
+
+// Encrypt seals value under a fresh data key wrapped by the current key. Empty
+// values, and all values when encryption is disabled, are returned unchanged.
+func Encrypt(value string) (string, error) {
+	wrapperLock.RLock()
+	w := current
+	wrapperLock.RUnlock()
+
+	if w == nil || value == "" || IsEncrypted(value) {
+		return value, nil
+	}
+
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", fmt.Errorf("error generating data key: %v", err)
+	}
+
+	sealed, err := seal(dataKey, []byte(value))
+	if err != nil {
+		return "", err
+	}
+
+	wrappedKey, err := w.Wrap(dataKey)
+	if err != nil {
+		return "", fmt.Errorf("error wrapping data key: %v", err)
+	}
+
+	return prefix + w.KeyID() + ":" +
+		base64.RawStdEncoding.EncodeToString(wrappedKey) + ":" +
+		base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value written by Encrypt. Legacy plaintext values are
+// returned unchanged.
+func Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+
+	parts := strings.Split(strings.TrimPrefix(value, prefix), ":")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("malformed encrypted value")
+	}
+
+	wrapperLock.RLock()
+	w := wrappers[parts[0]]
+	wrapperLock.RUnlock()
+	if w == nil {
+		return "", fmt.Errorf("no key configured for key ID %q", parts[0])
+	}
+
+	wrappedKey, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", fmt.Errorf("malformed wrapped key: %v", err)
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", fmt.Errorf("malformed ciphertext: %v", err)
+	}
+
+	dataKey, err := w.Unwrap(wrappedKey)
+	if err != nil {
+		return "", fmt.Errorf("error unwrapping data key: %v", err)
+	}
+
+	plaintext, err := open(dataKey, sealed)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// DecryptPtr is Decrypt for nullable columns
+func DecryptPtr(value *string) (*string, error) {
+	if value == nil {
+		return nil, nil
+	}
+	plaintext, err := Decrypt(*value)
+	if err != nil {
+		return nil, err
+	}
+	return &plaintext, nil
+}
+
+// seal encrypts plaintext with AES-256-GCM, prepending the nonce
+func seal(key, plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("error generating nonce: %v", err)
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// open decrypts a nonce-prefixed AES-256-GCM ciphertext
+func open(key, sealed []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting value: %v", err)
+	}
+	return plaintext, nil
+}
+
+// newGCM creates an AES-GCM cipher for a 32-byte key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("error creating cipher: %v", err)
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,55 @@
+package fieldcrypt
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestKeyRotation(t *testing.T) {
+	oldKey := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("a", 32)))
+	newKey := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("b", 32)))
+	defer func() {
+		SetKeyWrapper(nil)
+		wrappers = map[string]KeyWrapper{}
+	}()
+
+	t.Setenv("FIELD_ENCRYPTION_KEY", oldKey)
+	t.Setenv("FIELD_ENCRYPTION_KEY_ID", "old")
+	ConfigureFromEnv()
+	sealed, err := Encrypt("12-3456789")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rotate in a fresh process: the old key only decrypts, new values use the
+	// new key
+	wrappers = map[string]KeyWrapper{}
+	t.Setenv("FIELD_ENCRYPTION_KEY", newKey)
+	t.Setenv("FIELD_ENCRYPTION_KEY_ID", "new")
+	t.Setenv("FIELD_ENCRYPTION_PREVIOUS_KEYS", "old:"+oldKey+", broken:not-base64")
+	ConfigureFromEnv()
+
+	if plaintext, err := Decrypt(sealed); err != nil || plaintext != "12-3456789" {
+		t.Errorf("Decrypt under previous key = %q, %v", plaintext, err)
+	}
+	fresh, err := Encrypt("someone@example.org")
+	if err != nil || !strings.HasPrefix(fresh, prefix+"new:") {
+		t.Errorf("Encrypt = %q, %v; want the new key ID", fresh, err)
+	}
+
+	if !NeedsReencryption(sealed) || NeedsReencryption(fresh) || NeedsReencryption("") {
+		t.Error("NeedsReencryption should hold only for values under a previous key or plaintext")
+	}
+	if !NeedsReencryption("plaintext") {
+		t.Error("NeedsReencryption(plaintext) = false")
+	}
+
+	reencrypted, err := Reencrypt(sealed)
+	if err != nil || !strings.HasPrefix(reencrypted, prefix+"new:") {
+		t.Fatalf("Reencrypt = %q, %v; want the new key ID", reencrypted, err)
+	}
+	if plaintext, err := Decrypt(reencrypted); err != nil || plaintext != "12-3456789" {
+		t.Errorf("Decrypt after Reencrypt = %q, %v", plaintext, err)
+	}
+}
@@ -0,0 +1,35 @@
+package fieldcrypt
+
+import "fmt"
+
+// LocalKeyWrapper wraps data keys with a key-encryption key held in process memory
+type LocalKeyWrapper struct {
+	keyID string
+	key   []byte
+}
+
+// NewLocalKeyWrapper creates a wrapper for a 32-byte AES key
+func NewLocalKeyWrapper(keyID string, key []byte) (*LocalKeyWrapper, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("key must be 32 bytes, got %d", len(key))
+	}
+	if keyID == "" {
+		return nil, fmt.Errorf("key ID must not be empty")
+	}
+	return &LocalKeyWrapper{keyID: keyID, key: key}, nil
+}
+
+// KeyID implements KeyWrapper
+func (l *LocalKeyWrapper) KeyID() string {
+	return l.keyID
+}
+
+// Wrap implements KeyWrapper
+func (l *LocalKeyWrapper) Wrap(dataKey []byte) ([]byte, error) {
+	return seal(l.key, dataKey)
+}
+
+// Unwrap implements KeyWrapper
+func (l *LocalKeyWrapper) Unwrap(wrappedKey []byte) ([]byte, error) {
+	return open(l.key, wrappedKey)
+}
@@ -0,0 +1,64 @@
+package geoip
+
+import (
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Locator resolves an IP address to an ISO 3166-1 alpha-2 country code
+type Locator interface {
+	Country(ip string) (string, error)
+}
+
+var (
+	locator     Locator
+	locatorLock sync.RWMutex
+)
+
+// SetLocator installs the geolocation provider; nil disables geolocation
+func SetLocator(l Locator) {
+	locatorLock.Lock()
+	defer locatorLock.Unlock()
+	locator = l
+}
+
+// NewLocatorFromEnv returns the provider selected by GEOIP_PROVIDER, or nil when
+// geolocation is not configured
+func NewLocatorFromEnv() Locator {
+	switch strings.ToLower(os.Getenv("GEOIP_PROVIDER")) {
+	case "":
+		return nil
+	case "ipinfo":
+		apiURL := os.Getenv("GEOIP_API_URL")
+		if apiURL == "" {
+			apiURL = "https://ipinfo.io"
+		}
+		return NewIPInfo(apiURL, os.Getenv("GEOIP_API_TOKEN"))
+	default:
+		log.Printf("Unknown GEOIP_PROVIDER %q, geolocation disabled", os.Getenv("GEOIP_PROVIDER"))
+		return nil
+	}
+}
+
+// Country returns the country of a public IP address, or "" when geolocation is
+// not configured, the address is private or the lookup fails
+func Country(ip string) string {
+	locatorLock.RLock()
+	l := locator
+	locatorLock.RUnlock()
+
+	parsed := net.ParseIP(ip)
+	if l == nil || parsed == nil || parsed.IsLoopback() || parsed.IsPrivate() || parsed.IsUnspecified() {
+		return ""
+	}
+
+	country, err := l.Country(parsed.String())
+	if err != nil {
+		log.Printf("Error geolocating IP address: %v", err)
+		return ""
+	}
+	return strings.ToUpper(country)
+}
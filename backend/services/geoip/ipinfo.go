@@ -0,0 +1,55 @@
+package geoip
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// IPInfo is a Locator backed by the ipinfo.io API
+type IPInfo struct {
+	apiURL string
+	token  string
+	client *http.Client
+}
+
+// NewIPInfo creates a locator for the API at apiURL; token may be empty
+func NewIPInfo(apiURL, token string) *IPInfo {
+	return &IPInfo{
+		apiURL: strings.TrimRight(apiURL, "/"),
+		token:  token,
+		client: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// Country implements Locator
+func (i *IPInfo) Country(ip string) (string, error) {
+	endpoint := i.apiURL + "/" + url.PathEscape(ip) + "/country"
+	if i.token != "" {
+		endpoint += "?token=" + url.QueryEscape(i.token)
+	}
+
+	resp, err := i.client.Get(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("error calling geolocation API: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("geolocation API returned status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64))
+	if err != nil {
+		return "", fmt.Errorf("error reading geolocation response: %v", err)
+	}
+
+	country := strings.TrimSpace(string(body))
+	if len(country) != 2 {
+		return "", fmt.Errorf("unexpected geolocation response %q", country)
+	}
+	return country, nil
+}
@@ -0,0 +1,304 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Job statuses. Jobs that exhaust their attempts stay "dead" until an admin
+// retries them, which makes the dead rows the dead-letter queue.
+const (
+	StatusPending   = "pending"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusDead      = "dead"
+)
+
+// DefaultMaxAttempts is how many times a job runs before it is dead-lettered
+const DefaultMaxAttempts = 5
+
+// ErrNotFound is returned when no job, or for Retry no dead job, has the given ID
+var ErrNotFound = errors.New("job not found")
+
+// Handler runs one job of a registered kind with its JSON payload
+type Handler func(ctx context.Context, payload json.RawMessage) error
+
+// Job is a queued unit of work as listed to admins. The payload is left out
+// because it can hold email bodies and links.
+type Job struct {
+	ID          int64      `json:"id"`
+	Kind        string     `json:"kind"`
+	Status      string     `json:"status"`
+	Attempts    int        `json:"attempts"`
+	MaxAttempts int        `json:"max_attempts"`
+	RunAt       time.Time  `json:"run_at"`
+	LastError   *string    `json:"last_error"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+
+	// Progress is whatever the handler last reported with SetProgress
+	Progress json.RawMessage `json:"progress,omitempty"`
+}
+
+// DefaultTimeout bounds a single attempt of jobs registered without a timeout
+const DefaultTimeout = 5 * time.Minute
+
+// registration is a handler and the time one attempt may take
+type registration struct {
+	handler Handler
+	timeout time.Duration
+}
+
+var (
+	handlers     = make(map[string]registration)
+	handlersLock sync.RWMutex
+)
+
+// Register installs the handler for jobs of kind
+func Register(kind string, handler Handler) {
+	RegisterWithTimeout(kind, DefaultTimeout, handler)
+}
+
+// RegisterWithTimeout installs the handler for long-running jobs of kind. Such
+// handlers should call SetProgress regularly, which also tells the sweeper the
+// job is still alive.
+func RegisterWithTimeout(kind string, timeout time.Duration, handler Handler) {
+	handlersLock.Lock()
+	defer handlersLock.Unlock()
+	handlers[kind] = registration{handler: handler, timeout: timeout}
+}
+
+// registrationFor returns the registration for kind
+func registrationFor(kind string) (registration, bool) {
+	handlersLock.RLock()
+	defer handlersLock.RUnlock()
+	reg, ok := handlers[kind]
+	return reg, ok
+}
+
+type jobIDKey struct{}
+
+// SetProgress stores progress, encoded as JSON, on the job running in ctx
+func SetProgress(ctx context.Context, db *sql.DB, progress interface{}) error {
+	id, ok := ctx.Value(jobIDKey{}).(int64)
+	if !ok {
+		return fmt.Errorf("no job in context")
+	}
+
+	data, err := json.Marshal(progress)
+	if err != nil {
+		return fmt.Errorf("error encoding progress of job %d: %v", id, err)
+	}
+
+	_, err = db.Exec(`
+		UPDATE jobs
+		SET progress = $2, locked_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND status = 'running'
+	`, id, data)
+	if err != nil {
+		return fmt.Errorf("error storing progress of job %d: %v", id, err)
+	}
+	return nil
+}
+
+// Querier is satisfied by both *sql.DB and *sql.Tx, so jobs can be enqueued in
+// the same transaction as the change that triggers them
+type Querier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Enqueue queues a job of kind with payload encoded as JSON and returns its ID
+func Enqueue(q Querier, kind string, payload interface{}) (int64, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return 0, fmt.Errorf("error encoding %s job payload: %v", kind, err)
+	}
+
+	var id int64
+	err = q.QueryRow(`
+		INSERT INTO jobs (kind, payload, max_attempts)
+		VALUES ($1, $2, $3)
+		RETURNING id
+	`, kind, data, DefaultMaxAttempts).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("error enqueueing %s job: %v", kind, err)
+	}
+	return id, nil
+}
+
+// permanentError marks a failure that retrying cannot fix
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps err so the job is dead-lettered without further attempts
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+// List returns the most recent jobs, optionally filtered by status and kind
+func List(db *sql.DB, status, kind string, limit int) ([]Job, error) {
+	rows, err := db.Query(`
+		SELECT `+jobColumns+`
+		FROM jobs
+		WHERE ($1 = '' OR status = $1)
+			AND ($2 = '' OR kind = $2)
+		ORDER BY id DESC
+		LIMIT $3
+	`, status, kind, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying jobs: %v", err)
+	}
+	defer rows.Close()
+
+	jobs := []Job{}
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, *job)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating jobs: %v", err)
+	}
+	return jobs, nil
+}
+
+// Get returns the job with id, or ErrNotFound
+func Get(db *sql.DB, id int64) (*Job, error) {
+	job, err := scanJob(db.QueryRow(`SELECT `+jobColumns+` FROM jobs WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return job, err
+}
+
+// Active returns the oldest pending or running job of kind, or nil when there is none
+func Active(db *sql.DB, kind string) (*Job, error) {
+	job, err := scanJob(db.QueryRow(`
+		SELECT `+jobColumns+`
+		FROM jobs
+		WHERE kind = $1 AND status IN ('pending', 'running')
+		ORDER BY id
+		LIMIT 1
+	`, kind))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return job, err
+}
+
+// ActiveWith returns the oldest pending or running job of one of kinds whose
+// payload contains fields, encoded as JSON, or nil when there is none
+func ActiveWith(db *sql.DB, kinds []string, fields interface{}) (*Job, error) {
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding job fields: %v", err)
+	}
+	job, err := scanJob(db.QueryRow(`
+		SELECT `+jobColumns+`
+		FROM jobs
+		WHERE kind = ANY($1) AND status IN ('pending', 'running') AND payload @> $2
+		ORDER BY id
+		LIMIT 1
+	`, pq.Array(kinds), data))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return job, err
+}
+
+// GetWith returns the job with id when it is of one of kinds and its payload
+// contains fields, and ErrNotFound otherwise, so users can look up only their
+// own jobs
+func GetWith(db *sql.DB, id int64, kinds []string, fields interface{}) (*Job, error) {
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding job fields: %v", err)
+	}
+	job, err := scanJob(db.QueryRow(`
+		SELECT `+jobColumns+`
+		FROM jobs
+		WHERE id = $1 AND kind = ANY($2) AND payload @> $3
+	`, id, pq.Array(kinds), data))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return job, err
+}
+
+// jobColumns are the columns read by scanJob
+const jobColumns = `id, kind, status, attempts, max_attempts, run_at, last_error, created_at, completed_at, progress`
+
+// scanJob reads a row of jobColumns
+func scanJob(row interface{ Scan(...interface{}) error }) (*Job, error) {
+	var job Job
+	var progress []byte
+	err := row.Scan(&job.ID, &job.Kind, &job.Status, &job.Attempts, &job.MaxAttempts,
+		&job.RunAt, &job.LastError, &job.CreatedAt, &job.CompletedAt, &progress)
+	if err == sql.ErrNoRows {
+		return nil, err
+	} else if err != nil {
+		return nil, fmt.Errorf("error scanning job: %w", err)
+	}
+	job.Progress = progress
+	return &job, nil
+}
+
+// Counts returns the number of jobs in each status
+func Counts(db *sql.DB) (map[string]int, error) {
+	counts := map[string]int{
+		StatusPending:   0,
+		StatusRunning:   0,
+		StatusSucceeded: 0,
+		StatusDead:      0,
+	}
+
+	rows, err := db.Query(`SELECT status, COUNT(*) FROM jobs GROUP BY status`)
+	if err != nil {
+		return nil, fmt.Errorf("error counting jobs: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, fmt.Errorf("error scanning job count: %v", err)
+		}
+		counts[status] = count
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating job counts: %v", err)
+	}
+	return counts, nil
+}
+
+// Retry moves a dead job back to the queue with a fresh set of attempts
+func Retry(db *sql.DB, id int64) error {
+	result, err := db.Exec(`
+		UPDATE jobs
+		SET status = 'pending', attempts = 0, run_at = CURRENT_TIMESTAMP, locked_at = NULL
+		WHERE id = $1 AND status = 'dead'
+	`, id)
+	if err != nil {
+		return fmt.Errorf("error retrying job %d: %v", id, err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("error retrying job %d: %v", id, err)
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
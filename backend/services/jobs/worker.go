@@ -0,0 +1,225 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"matcherator/backend/services/telemetry"
+)
+
+const (
+	// DefaultWorkers is used when JOB_WORKERS is unset or invalid
+	DefaultWorkers = 4
+
+	// pollInterval is how long an idle worker waits before checking for jobs again
+	pollInterval = time.Second
+
+	// lockTimeout is how long a job may stay running without reporting progress
+	// before it is assumed to belong to a crashed worker and is queued again
+	lockTimeout = 15 * time.Minute
+
+	// sweepInterval is how often stuck jobs are requeued and old ones pruned
+	sweepInterval = time.Minute
+
+	// succeededRetention is how long completed jobs are kept for inspection
+	succeededRetention = 7 * 24 * time.Hour
+
+	// Retries back off exponentially from baseBackoff up to maxBackoff
+	baseBackoff = 30 * time.Second
+	maxBackoff  = time.Hour
+)
+
+// claimedJob is a job taken by a worker
+type claimedJob struct {
+	id          int64
+	kind        string
+	payload     json.RawMessage
+	attempts    int
+	maxAttempts int
+}
+
+// Start runs JOB_WORKERS (default 4) workers and a sweeper until ctx is done
+func Start(ctx context.Context, db *sql.DB) {
+	workers := DefaultWorkers
+	if value := os.Getenv("JOB_WORKERS"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			workers = n
+		} else {
+			log.Printf("Invalid JOB_WORKERS %q, using %d", value, DefaultWorkers)
+		}
+	}
+
+	for i := 0; i < workers; i++ {
+		go work(ctx, db)
+	}
+	go sweep(ctx, db)
+}
+
+// work claims and runs jobs until ctx is done
+func work(ctx context.Context, db *sql.DB) {
+	for {
+		job, err := claim(db)
+		if err != nil {
+			log.Printf("Error claiming job: %v", err)
+		}
+		if job != nil {
+			run(db, job)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// claim takes the oldest due job, or returns nil when there is none. SKIP LOCKED
+// lets several workers and backend instances poll the same table.
+func claim(db *sql.DB) (*claimedJob, error) {
+	var job claimedJob
+	err := db.QueryRow(`
+		UPDATE jobs
+		SET status = 'running', attempts = attempts + 1, locked_at = CURRENT_TIMESTAMP
+		WHERE id = (
+			SELECT id FROM jobs
+			WHERE status = 'pending' AND run_at <= CURRENT_TIMESTAMP
+			ORDER BY run_at, id
+			FOR UPDATE SKIP LOCKED
+			LIMIT 1
+		)
+		RETURNING id, kind, payload, attempts, max_attempts
+	`).Scan(&job.id, &job.kind, &job.payload, &job.attempts, &job.maxAttempts)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// run executes a claimed job and records the outcome: success, a retry after
+// backoff, or the dead-letter queue
+func run(db *sql.DB, job *claimedJob) {
+	timeout := DefaultTimeout
+	if reg, ok := registrationFor(job.kind); ok {
+		timeout = reg.timeout
+	}
+	ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), jobIDKey{}, job.id), timeout)
+	defer cancel()
+
+	ctx, span := telemetry.Tracer().Start(ctx, "job "+job.kind, trace.WithAttributes(
+		attribute.Int64("job.id", job.id),
+		attribute.Int("job.attempt", job.attempts),
+	))
+	defer span.End()
+
+	err := execute(ctx, job)
+	if err == nil {
+		_, err = db.Exec(`
+			UPDATE jobs
+			SET status = 'succeeded', payload = '{}', last_error = NULL,
+				locked_at = NULL, completed_at = CURRENT_TIMESTAMP
+			WHERE id = $1
+		`, job.id)
+		if err != nil {
+			log.Printf("Error completing job %d: %v", job.id, err)
+		}
+		return
+	}
+
+	var permanent permanentError
+	var dbErr error
+	if errors.As(err, &permanent) || job.attempts >= job.maxAttempts {
+		log.Printf("Job %d (%s) failed after %d attempts, moving to dead-letter queue: %v", job.id, job.kind, job.attempts, err)
+		telemetry.ReportError(ctx, fmt.Errorf("job %d (%s) dead-lettered: %v", job.id, job.kind, err))
+		_, dbErr = db.Exec(`
+			UPDATE jobs
+			SET status = 'dead', last_error = $2, locked_at = NULL, completed_at = CURRENT_TIMESTAMP
+			WHERE id = $1
+		`, job.id, err.Error())
+	} else {
+		log.Printf("Job %d (%s) attempt %d failed, retrying: %v", job.id, job.kind, job.attempts, err)
+		_, dbErr = db.Exec(`
+			UPDATE jobs
+			SET status = 'pending', last_error = $2, locked_at = NULL, run_at = $3
+			WHERE id = $1
+		`, job.id, err.Error(), time.Now().Add(backoff(job.attempts)))
+	}
+	if dbErr != nil {
+		log.Printf("Error recording failure of job %d: %v", job.id, dbErr)
+	}
+}
+
+// execute calls the job's handler, turning panics into errors
+func execute(ctx context.Context, job *claimedJob) (err error) {
+	reg, ok := registrationFor(job.kind)
+	if !ok {
+		return Permanent(fmt.Errorf("no handler registered for job kind %q", job.kind))
+	}
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("panic: %v", recovered)
+		}
+	}()
+	return reg.handler(ctx, job.payload)
+}
+
+// backoff returns the delay before the next attempt, doubling per attempt with
+// up to 20% jitter so failed jobs do not retry in lockstep
+func backoff(attempts int) time.Duration {
+	delay := maxBackoff
+	if attempts < 20 {
+		if d := baseBackoff << (attempts - 1); d < maxBackoff {
+			delay = d
+		}
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay)/5+1))
+}
+
+// sweep periodically requeues jobs abandoned by crashed workers and prunes
+// succeeded jobs past their retention
+func sweep(ctx context.Context, db *sql.DB) {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		_, err := db.Exec(`
+			UPDATE jobs
+			SET status = CASE WHEN attempts >= max_attempts THEN 'dead' ELSE 'pending' END,
+				last_error = 'worker stopped while running the job',
+				locked_at = NULL
+			WHERE status = 'running' AND locked_at < $1
+		`, time.Now().Add(-lockTimeout))
+		if err != nil {
+			log.Printf("Error requeueing stuck jobs: %v", err)
+		}
+
+		_, err = db.Exec(`
+			DELETE FROM jobs
+			WHERE status = 'succeeded' AND completed_at < $1
+		`, time.Now().Add(-succeededRetention))
+		if err != nil {
+			log.Printf("Error pruning succeeded jobs: %v", err)
+		}
+	}
+}
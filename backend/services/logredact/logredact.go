@@ -0,0 +1,61 @@
+package logredact
+
+import (
+	"io"
+	"regexp"
+)
+
+// rule replaces matches of pattern with replacement
+type rule struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// rules are applied in order; token rules run before the email rule so that
+// credentials embedded in URLs are removed as a whole
+var rules = []rule{
+	// JWTs anywhere in the line, e.g. tokens in URLs or error messages
+	{regexp.MustCompile(`eyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`), "[REDACTED_TOKEN]"},
+	// Authorization headers and bearer credentials, unless the JWT rule already
+	// replaced them
+	{regexp.MustCompile(`(?i)(bearer\s+)[^\s\[\]"',]+`), "${1}[REDACTED_TOKEN]"},
+	// token, password and secret query parameters or key=value pairs
+	{regexp.MustCompile(`(?i)\b((?:access_|refresh_|scim_)?token|password|secret)=[^&\s"',]+`), "${1}=[REDACTED]"},
+	// token, password and secret JSON fields
+	{regexp.MustCompile(`(?i)("(?:access_|refresh_)?(?:token|password|secret)"\s*:\s*")(?:[^"\\]|\\.)*"`), `${1}[REDACTED]"`},
+	// Chat message content in JSON or key=value form
+	{regexp.MustCompile(`(?i)("(?:content|last_message|translated_content)"\s*:\s*")(?:[^"\\]|\\.)*"`), `${1}[REDACTED_CONTENT]"`},
+	{regexp.MustCompile(`(?i)\b(content|lastMessage|last_message)=(?:"(?:[^"\\]|\\.)*"|\S+)`), "${1}=[REDACTED_CONTENT]"},
+	// Email addresses
+	{regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`), "[REDACTED_EMAIL]"},
+	// Employer Identification Numbers (NN-NNNNNNN)
+	{regexp.MustCompile(`\b\d{2}-\d{7}\b`), "[REDACTED_EIN]"},
+}
+
+// Redact removes tokens, credentials, emails, EINs and message content from s
+func Redact(s string) string {
+	for _, r := range rules {
+		s = r.pattern.ReplaceAllString(s, r.replacement)
+	}
+	return s
+}
+
+// Writer redacts everything written to it before passing it on. The log package
+// writes each entry with a single Write call, so patterns never span writes.
+type Writer struct {
+	out io.Writer
+}
+
+// NewWriter wraps out with redaction; install with log.SetOutput
+func NewWriter(out io.Writer) *Writer {
+	return &Writer{out: out}
+}
+
+// Write implements io.Writer, reporting len(p) so callers don't see the
+// redacted length as a short write
+func (w *Writer) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(w.out, Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,46 @@
+package mail
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"matcherator/backend/services/jobs"
+)
+
+// SendJob is the job kind that delivers one email
+const SendJob = "mail.send"
+
+// Message is the payload of a SendJob
+type Message struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// Enqueue queues an email for delivery by the job workers, retrying on SMTP
+// failures. It returns ErrNotConfigured without queueing when email is disabled.
+func Enqueue(q jobs.Querier, to, subject, body string) error {
+	if !Configured() {
+		return ErrNotConfigured
+	}
+	_, err := jobs.Enqueue(q, SendJob, Message{To: to, Subject: subject, Body: body})
+	return err
+}
+
+// SendJobHandler delivers queued emails
+func SendJobHandler() jobs.Handler {
+	return func(ctx context.Context, payload json.RawMessage) error {
+		var message Message
+		if err := json.Unmarshal(payload, &message); err != nil {
+			return jobs.Permanent(fmt.Errorf("error decoding email: %v", err))
+		}
+
+		err := Send(message.To, message.Subject, message.Body)
+		if errors.Is(err, ErrNotConfigured) || errors.Is(err, ErrInvalidHeader) {
+			return jobs.Permanent(err)
+		}
+		return err
+	}
+}
@@ -0,0 +1,84 @@
+package mail
+
+import (
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Sender delivers plain-text email
+type Sender interface {
+	Send(to, subject, body string) error
+}
+
+var (
+	// ErrNotConfigured is returned when no sender is installed
+	ErrNotConfigured = errors.New("email is not configured")
+
+	// ErrInvalidHeader is returned for recipients or subjects containing line breaks
+	ErrInvalidHeader = errors.New("invalid email header")
+)
+
+var (
+	sender     Sender
+	senderLock sync.RWMutex
+)
+
+// SetSender installs the mail sender; nil disables email
+func SetSender(s Sender) {
+	senderLock.Lock()
+	defer senderLock.Unlock()
+	sender = s
+}
+
+// NewSenderFromEnv returns the sender MAIL_FROM sends from: SendGrid when
+// SENDGRID_API_KEY is set, otherwise SMTP configured by SMTP_HOST, SMTP_PORT,
+// SMTP_USERNAME and SMTP_PASSWORD. It returns nil when neither is set.
+func NewSenderFromEnv() Sender {
+	apiKey := os.Getenv("SENDGRID_API_KEY")
+	host := os.Getenv("SMTP_HOST")
+	if apiKey == "" && host == "" {
+		return nil
+	}
+
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		log.Printf("MAIL_FROM is not set, email disabled")
+		return nil
+	}
+
+	if apiKey != "" {
+		return NewSendGrid(apiKey, from)
+	}
+
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+
+	return NewSMTP(host, port, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), from)
+}
+
+// Send emails to through the configured sender
+func Send(to, subject, body string) error {
+	senderLock.RLock()
+	s := sender
+	senderLock.RUnlock()
+
+	if s == nil {
+		return ErrNotConfigured
+	}
+	if strings.ContainsAny(to+subject, "\r\n") {
+		return ErrInvalidHeader
+	}
+	return s.Send(to, subject, body)
+}
+
+// Configured reports whether a sender is installed
+func Configured() bool {
+	senderLock.RLock()
+	defer senderLock.RUnlock()
+	return sender != nil
+}
@@ -0,0 +1,64 @@
+package mail
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// sendGridURL is SendGrid's v3 mail send endpoint
+const sendGridURL = "https://api.sendgrid.com/v3/mail/send"
+
+// SendGrid is a Sender backed by the SendGrid HTTP API
+type SendGrid struct {
+	apiKey string
+	from   string
+	client *http.Client
+}
+
+// NewSendGrid creates a sender using a SendGrid API key with the mail send
+// permission; from must be a verified sender
+func NewSendGrid(apiKey, from string) *SendGrid {
+	return &SendGrid{
+		apiKey: apiKey,
+		from:   from,
+		client: &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// Send implements Sender
+func (s *SendGrid) Send(to, subject, body string) error {
+	type address struct {
+		Email string `json:"email"`
+	}
+	payload, err := json.Marshal(map[string]interface{}{
+		"personalizations": []map[string]interface{}{{"to": []address{{to}}}},
+		"from":             address{s.from},
+		"subject":          subject,
+		"content":          []map[string]string{{"type": "text/plain", "value": body}},
+	})
+	if err != nil {
+		return fmt.Errorf("error encoding email: %v", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, sendGridURL, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("error creating SendGrid request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending email: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// SendGrid answers 202 once the message is queued
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("SendGrid returned status %d", resp.StatusCode)
+	}
+	return nil
+}
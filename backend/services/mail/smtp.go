@@ -0,0 +1,46 @@
+package mail
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// SMTP is a Sender backed by an SMTP relay
+type SMTP struct {
+	addr string
+	host string
+	auth smtp.Auth
+	from string
+}
+
+// NewSMTP creates a sender for host:port; username may be empty for relays
+// without authentication
+func NewSMTP(host, port, username, password, from string) *SMTP {
+	s := &SMTP{addr: net.JoinHostPort(host, port), host: host, from: from}
+	if username != "" {
+		s.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return s
+}
+
+// Send implements Sender
+func (s *SMTP) Send(to, subject, body string) error {
+	msg := strings.Join([]string{
+		"From: " + s.from,
+		"To: " + to,
+		"Subject: " + subject,
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		body,
+	}, "\r\n")
+
+	if err := smtp.SendMail(s.addr, s.auth, s.from, []string{to}, []byte(msg)); err != nil {
+		return fmt.Errorf("error sending email: %v", err)
+	}
+	return nil
+}
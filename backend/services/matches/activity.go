@@ -0,0 +1,64 @@
+package matches
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+const (
+	// InactivityThreshold is how long an account can go without activity
+	// before its match score starts to decay
+	InactivityThreshold = 60 * 24 * time.Hour
+
+	// ActivityHalfLife is how much longer it takes the score of an inactive
+	// account to halve
+	ActivityHalfLife = 60 * 24 * time.Hour
+
+	// MinActivityFactor is the lowest the activity decay brings a score to,
+	// as a fraction of the undecayed score
+	MinActivityFactor = 0.5
+
+	// recentlyActiveWindow is how long an account counts as "active" in match results
+	recentlyActiveWindow = 7 * 24 * time.Hour
+)
+
+// Activity recency of a matched account, as shown in match results
+const (
+	ActivityActive   = "active"   // active within the last week
+	ActivityRecent   = "recent"   // active within InactivityThreshold
+	ActivityInactive = "inactive" // score is being decayed
+)
+
+// ActivityFactor is the multiplier applied to the score of a candidate last
+// active at lastActive: 1 within InactivityThreshold, then halving every
+// ActivityHalfLife down to MinActivityFactor
+func ActivityFactor(lastActive, now time.Time) float64 {
+	inactive := now.Sub(lastActive) - InactivityThreshold
+	if inactive <= 0 {
+		return 1
+	}
+	return math.Max(MinActivityFactor, math.Pow(0.5, inactive.Hours()/ActivityHalfLife.Hours()))
+}
+
+// ActivityRecency buckets how recently an account was active
+func ActivityRecency(lastActive, now time.Time) string {
+	switch idle := now.Sub(lastActive); {
+	case idle <= recentlyActiveWindow:
+		return ActivityActive
+	case idle <= InactivityThreshold:
+		return ActivityRecent
+	default:
+		return ActivityInactive
+	}
+}
+
+// activityFactorSQL is ActivityFactor for the candidate u of the fast-path query.
+// Accounts that were never seen active count from their creation.
+var activityFactorSQL = fmt.Sprintf(
+	`GREATEST(%[1]s, POWER(0.5, GREATEST(0, EXTRACT(EPOCH FROM (CURRENT_TIMESTAMP - COALESCE(u.last_active_at, u.created_at, CURRENT_TIMESTAMP))) - %[2]s) / %[3]s))`,
+	strconv.FormatFloat(MinActivityFactor, 'f', -1, 64),
+	strconv.FormatFloat(InactivityThreshold.Seconds(), 'f', -1, 64),
+	strconv.FormatFloat(ActivityHalfLife.Seconds(), 'f', -1, 64),
+)
@@ -0,0 +1,126 @@
+package matches
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"matcherator/backend/services/jobs"
+)
+
+// RecalculateAllJob is the job kind that recalculates every active user's matches
+const RecalculateAllJob = "matches.recalculate_all"
+
+const (
+	// recalculateAllTimeout bounds one run of the batch
+	recalculateAllTimeout = 2 * time.Hour
+
+	// progressInterval is how often batch progress is stored
+	progressInterval = 2 * time.Second
+
+	// maxReportedFailures caps the failures listed in BatchProgress
+	maxReportedFailures = 20
+)
+
+// BatchProgress is the progress of a RecalculateAllJob
+type BatchProgress struct {
+	Total    int            `json:"total"`
+	Done     int            `json:"done"`
+	Failed   int            `json:"failed"`
+	Failures []BatchFailure `json:"failures"`
+}
+
+// BatchFailure describes a user whose matches could not be recalculated
+type BatchFailure struct {
+	UserID int64  `json:"user_id"`
+	Error  string `json:"error"`
+}
+
+// EnqueueRecalculateAll queues a batch recalculation and returns its job ID. A
+// batch that is already pending or running is reused rather than duplicated.
+func EnqueueRecalculateAll(db *sql.DB) (int64, error) {
+	active, err := jobs.Active(db, RecalculateAllJob)
+	if err != nil {
+		return 0, err
+	}
+	if active != nil {
+		return active.ID, nil
+	}
+	return jobs.Enqueue(db, RecalculateAllJob, struct{}{})
+}
+
+// RecalculateAllJobHandler runs batch recalculations, storing BatchProgress as it
+// goes. Individual users that fail are recorded and skipped; the batch itself
+// fails, and is retried, when recalculations are suspended by the circuit breaker.
+func RecalculateAllJobHandler(db *sql.DB) jobs.Handler {
+	return func(ctx context.Context, _ json.RawMessage) error {
+		return recalculateAll(ctx, db)
+	}
+}
+
+// recalculateAll recalculates matches for every active user
+func recalculateAll(ctx context.Context, db *sql.DB) error {
+	type user struct {
+		id   int64
+		role string
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT id, role FROM users WHERE status = 'active' ORDER BY id")
+	if err != nil {
+		return fmt.Errorf("error querying users: %v", err)
+	}
+	var users []user
+	for rows.Next() {
+		var u user
+		if err := rows.Scan(&u.id, &u.role); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning user: %v", err)
+		}
+		users = append(users, u)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("error iterating users: %v", err)
+	}
+
+	progress := BatchProgress{Total: len(users), Failures: []BatchFailure{}}
+	report := func() {
+		if err := jobs.SetProgress(ctx, db, progress); err != nil {
+			log.Printf("Error reporting batch recalculation progress: %v", err)
+		}
+	}
+	report()
+
+	lastReport := time.Now()
+	for _, u := range users {
+		if err := ctx.Err(); err != nil {
+			report()
+			return err
+		}
+
+		if err := CalculateAndStoreMatches(db, u.id, u.role); err != nil {
+			if errors.Is(err, ErrCircuitOpen) {
+				report()
+				return err
+			}
+			log.Printf("Error calculating matches for user %d: %v", u.id, err)
+			progress.Failed++
+			if len(progress.Failures) < maxReportedFailures {
+				progress.Failures = append(progress.Failures, BatchFailure{UserID: u.id, Error: err.Error()})
+			}
+		}
+		progress.Done++
+
+		if time.Since(lastReport) >= progressInterval {
+			report()
+			lastReport = time.Now()
+		}
+	}
+
+	report()
+	return nil
+}
@@ -0,0 +1,165 @@
+package matches
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultRecalcTimeout bounds a single recalculation when MATCH_RECALC_TIMEOUT is unset
+	DefaultRecalcTimeout = 30 * time.Second
+
+	// DefaultBreakerThreshold is the number of consecutive failed recalculations
+	// that opens the breaker when MATCH_BREAKER_THRESHOLD is unset
+	DefaultBreakerThreshold = 5
+
+	// DefaultBreakerCoolDown is how long the breaker stays open when
+	// MATCH_BREAKER_COOLDOWN is unset
+	DefaultBreakerCoolDown = time.Minute
+)
+
+// ErrCircuitOpen is returned instead of recalculating while the breaker is open
+var ErrCircuitOpen = errors.New("match recalculation is temporarily disabled after repeated failures")
+
+// Breaker stops running recalculations after threshold consecutive failures or
+// timeouts. Once coolDown has passed a single trial run is allowed; its success
+// closes the breaker and its failure reopens it.
+type Breaker struct {
+	timeout   time.Duration
+	threshold int
+	coolDown  time.Duration
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	trial    bool
+}
+
+// NewBreaker creates a closed breaker
+func NewBreaker(timeout time.Duration, threshold int, coolDown time.Duration) *Breaker {
+	return &Breaker{timeout: timeout, threshold: threshold, coolDown: coolDown}
+}
+
+// NewBreakerFromEnv configures a breaker from MATCH_RECALC_TIMEOUT,
+// MATCH_BREAKER_THRESHOLD and MATCH_BREAKER_COOLDOWN
+func NewBreakerFromEnv() *Breaker {
+	return NewBreaker(
+		durationFromEnv("MATCH_RECALC_TIMEOUT", DefaultRecalcTimeout),
+		intFromEnv("MATCH_BREAKER_THRESHOLD", DefaultBreakerThreshold),
+		durationFromEnv("MATCH_BREAKER_COOLDOWN", DefaultBreakerCoolDown),
+	)
+}
+
+var (
+	recalcBreaker     *Breaker
+	recalcBreakerOnce sync.Once
+)
+
+// recalculations returns the breaker guarding every match recalculation. It is
+// configured on first use so settings loaded from .env are honoured.
+func recalculations() *Breaker {
+	recalcBreakerOnce.Do(func() {
+		recalcBreaker = NewBreakerFromEnv()
+	})
+	return recalcBreaker
+}
+
+// RecalculationsSuspended reports whether the recalculation breaker is open, in
+// which case stored matches are served even when stale
+func RecalculationsSuspended() bool {
+	return recalculations().Open()
+}
+
+// Open reports whether calls are currently being rejected
+func (b *Breaker) Open() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.failures >= b.threshold && (b.trial || time.Since(b.openedAt) < b.coolDown)
+}
+
+// Run calls fn with a context bounded by the breaker's timeout, unless the
+// breaker is open, and records the outcome
+func (b *Breaker) Run(fn func(ctx context.Context) error) error {
+	if !b.allow() {
+		return ErrCircuitOpen
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+	defer cancel()
+
+	err := fn(ctx)
+	if err == nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	b.record(err)
+	return err
+}
+
+// allow reports whether a call may run, admitting one trial call after the cool-down
+func (b *Breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return true
+	}
+	if b.trial || time.Since(b.openedAt) < b.coolDown {
+		return false
+	}
+	b.trial = true
+	return true
+}
+
+// record updates the failure count after a call
+func (b *Breaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+	if err == nil {
+		if b.failures >= b.threshold {
+			log.Printf("Match recalculation breaker closed")
+		}
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.failures >= b.threshold {
+		log.Printf("Match recalculation breaker open for %s after %d consecutive failures: %v", b.coolDown, b.failures, err)
+		b.openedAt = time.Now()
+	}
+}
+
+// durationFromEnv reads a positive Go duration from key, or returns fallback
+func durationFromEnv(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Printf("Invalid %s %q, using %s", key, value, fallback)
+		return fallback
+	}
+	return d
+}
+
+// intFromEnv reads a positive integer from key, or returns fallback
+func intFromEnv(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		log.Printf("Invalid %s %q, using %d", key, value, fallback)
+		return fallback
+	}
+	return n
+}
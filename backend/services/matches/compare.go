@@ -0,0 +1,194 @@
+package matches
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// MaxCompared caps the matches compared side by side
+const MaxCompared = 4
+
+// Comparison lines up a few of a user's matches attribute by attribute, one
+// row per attribute with a cell per match in the order of Matches
+type Comparison struct {
+	Matches []ComparedMatch `json:"matches"`
+	Rows    []ComparisonRow `json:"rows"`
+}
+
+// ComparedMatch heads a column of a comparison
+type ComparedMatch struct {
+	ID                int64   `json:"id"`
+	OrganizationName  string  `json:"organization_name"`
+	ProfilePictureURL *string `json:"profile_picture_url"`
+	Role              string  `json:"role"`
+	AsRole            string  `json:"as_role"`
+}
+
+// ComparisonRow is one compared attribute. Group is score, dimension,
+// funding, location or eligibility.
+type ComparisonRow struct {
+	Key   string           `json:"key"`
+	Group string           `json:"group"`
+	Cells []ComparisonCell `json:"cells"`
+}
+
+// ComparisonCell is a match's value for a row, nil when unknown. Numeric rows
+// also carry the value normalized to 0-1 so they can be drawn as bars, and
+// mark the best of the compared matches.
+type ComparisonCell struct {
+	Value      interface{} `json:"value"`
+	Normalized *float64    `json:"normalized,omitempty"`
+	Best       bool        `json:"best,omitempty"`
+	Detail     string      `json:"detail,omitempty"`
+}
+
+// Compare builds the comparison of the given matches of userID, as returned
+// by GetStoredMatches. Scoring dimensions and eligibility checks come from
+// ExplainMatch, so they reflect the current profiles even when the stored
+// score is older.
+func Compare(db *sql.DB, userID int64, compared []Match) (*Comparison, error) {
+	comparison := &Comparison{Matches: make([]ComparedMatch, len(compared))}
+	explanations := make([]*Explanation, len(compared))
+	for i, match := range compared {
+		explanation, err := ExplainMatch(db, userID, match.ID)
+		if err != nil {
+			return nil, fmt.Errorf("error explaining match %d: %v", match.ID, err)
+		}
+		explanations[i] = explanation
+
+		comparison.Matches[i] = ComparedMatch{
+			ID:                match.ID,
+			OrganizationName:  match.OrganizationName,
+			ProfilePictureURL: match.ProfilePictureURL,
+			Role:              match.Role,
+			AsRole:            match.AsRole,
+		}
+	}
+
+	// Overall score, already on a 0-100 scale
+	row := newRow("score", "score", len(compared))
+	for i, match := range compared {
+		normalized := match.Score / 100
+		row.Cells[i] = ComparisonCell{Value: match.Score, Normalized: &normalized}
+	}
+	comparison.Rows = append(comparison.Rows, markBest(row))
+
+	// Points per scoring dimension, normalized by the dimension's weight
+	for d, scorer := range DefaultPipeline.Scorers() {
+		row := newRow(scorer.Name(), "dimension", len(compared))
+		for i, explanation := range explanations {
+			dimension := explanation.Dimensions[d]
+			ratio := dimension.Ratio
+			row.Cells[i] = ComparisonCell{
+				Value:      dimension.Points,
+				Normalized: &ratio,
+				Detail:     strings.Join(dimension.Overlap, ", "),
+			}
+		}
+		comparison.Rows = append(comparison.Rows, markBest(row))
+	}
+
+	// The amount a provider offers or a recipient requests, relative to the
+	// largest compared
+	row = newRow("amount", "funding", len(compared))
+	var largest float64
+	for _, match := range compared {
+		if amount := matchAmount(match); amount != nil && *amount > largest {
+			largest = *amount
+		}
+	}
+	for i, match := range compared {
+		amount := matchAmount(match)
+		if amount == nil {
+			continue
+		}
+		row.Cells[i].Value = *amount
+		if largest > 0 {
+			normalized := *amount / largest
+			row.Cells[i].Normalized = &normalized
+		}
+	}
+	comparison.Rows = append(comparison.Rows, row)
+
+	row = newRow("funding_type", "funding", len(compared))
+	for i, match := range compared {
+		if match.FundingType != nil {
+			row.Cells[i].Value = *match.FundingType
+		}
+	}
+	comparison.Rows = append(comparison.Rows, row)
+
+	row = newRow("deadline", "funding", len(compared))
+	for i, match := range compared {
+		if match.Deadline != nil {
+			row.Cells[i].Value = match.Deadline.Format("2006-01-02")
+		}
+	}
+	comparison.Rows = append(comparison.Rows, row)
+
+	row = newRow("location", "location", len(compared))
+	for i, match := range compared {
+		var place []string
+		if match.City != nil && *match.City != "" {
+			place = append(place, *match.City)
+		}
+		if match.State != nil && *match.State != "" {
+			place = append(place, *match.State)
+		}
+		if len(place) > 0 {
+			row.Cells[i].Value = strings.Join(place, ", ")
+		}
+		if match.Location != nil {
+			row.Cells[i].Detail = *match.Location
+		}
+	}
+	comparison.Rows = append(comparison.Rows, row)
+
+	// Whether each pair still passes the eligibility filters of matching
+	for _, name := range []string{"award_ranges_overlap", "within_eligibility_bands", "not_excluded_by_user", "not_excluded_by_candidate"} {
+		row := newRow(name, "eligibility", len(compared))
+		for i, explanation := range explanations {
+			for _, check := range explanation.Checks {
+				if check.Name == name {
+					row.Cells[i] = ComparisonCell{Value: check.Passed, Detail: check.Detail}
+				}
+			}
+		}
+		comparison.Rows = append(comparison.Rows, row)
+	}
+
+	return comparison, nil
+}
+
+// newRow creates a row with an empty cell per compared match
+func newRow(key, group string, n int) ComparisonRow {
+	return ComparisonRow{Key: key, Group: group, Cells: make([]ComparisonCell, n)}
+}
+
+// markBest marks the cells holding the highest positive value of a numeric row
+func markBest(row ComparisonRow) ComparisonRow {
+	var best float64
+	for _, cell := range row.Cells {
+		if value, ok := cell.Value.(float64); ok && value > best {
+			best = value
+		}
+	}
+	if best <= 0 {
+		return row
+	}
+	for i, cell := range row.Cells {
+		if value, ok := cell.Value.(float64); ok && value == best {
+			row.Cells[i].Best = true
+		}
+	}
+	return row
+}
+
+// matchAmount is the amount a provider match offers or a recipient match requests
+func matchAmount(match Match) *float64 {
+	if match.Role == "provider" {
+		return match.AmountOffered
+	}
+	return match.BudgetRequested
+}
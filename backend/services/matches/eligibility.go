@@ -0,0 +1,86 @@
+package matches
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// EligibilityBands restrict the size and age of recipients a provider is
+// matched with. Unset bounds are open, and recipients that have not declared a
+// value are not filtered on it.
+type EligibilityBands struct {
+	BudgetMin   sql.NullFloat64
+	BudgetMax   sql.NullFloat64
+	StaffMin    sql.NullInt64
+	StaffMax    sql.NullInt64
+	MinAgeYears sql.NullInt64
+	MaxAgeYears sql.NullInt64
+}
+
+// eligibilityFilter is a pair condition that is true unless the profile %[2]s
+// falls outside the bands of provider data %[1]s. It is true when %[1]s is a
+// recipient's, which has no provider data.
+const eligibilityFilter = `NOT COALESCE(
+		%[2]s.annual_budget < %[1]s.eligible_budget_min
+		OR %[2]s.annual_budget > %[1]s.eligible_budget_max
+		OR %[2]s.staff_size < %[1]s.eligible_staff_min
+		OR %[2]s.staff_size > %[1]s.eligible_staff_max
+		OR EXTRACT(YEAR FROM CURRENT_DATE) - %[2]s.founded_year < %[1]s.eligible_min_age_years
+		OR EXTRACT(YEAR FROM CURRENT_DATE) - %[2]s.founded_year > %[1]s.eligible_max_age_years,
+		false
+	)`
+
+// eligibilityViolations returns why the recipient of a pair falls outside the
+// provider's bands, mirroring eligibilityFilter
+func eligibilityViolations(user, candidate *MatchProfile) []string {
+	provider, recipient := user, candidate
+	if user.Role == "recipient" {
+		provider, recipient = candidate, user
+	}
+	bands := provider.Eligibility
+
+	var violations []string
+	if recipient.AnnualBudget.Valid {
+		budget := recipient.AnnualBudget.Float64
+		if (bands.BudgetMin.Valid && budget < bands.BudgetMin.Float64) || (bands.BudgetMax.Valid && budget > bands.BudgetMax.Float64) {
+			violations = append(violations, fmt.Sprintf("annual budget %s outside %s", formatFloat(budget), formatBand(bands.BudgetMin, bands.BudgetMax)))
+		}
+	}
+	if recipient.StaffSize.Valid {
+		staff := recipient.StaffSize.Int64
+		if (bands.StaffMin.Valid && staff < bands.StaffMin.Int64) || (bands.StaffMax.Valid && staff > bands.StaffMax.Int64) {
+			violations = append(violations, fmt.Sprintf("staff size %d outside %s", staff, formatBand(nullFloat(bands.StaffMin), nullFloat(bands.StaffMax))))
+		}
+	}
+	if recipient.FoundedYear.Valid {
+		age := int64(time.Now().Year()) - recipient.FoundedYear.Int64
+		if (bands.MinAgeYears.Valid && age < bands.MinAgeYears.Int64) || (bands.MaxAgeYears.Valid && age > bands.MaxAgeYears.Int64) {
+			violations = append(violations, fmt.Sprintf("age %d years outside %s", age, formatBand(nullFloat(bands.MinAgeYears), nullFloat(bands.MaxAgeYears))))
+		}
+	}
+	return violations
+}
+
+// formatBand describes a band such as "0-1000000", "*-50" or "any"
+func formatBand(min, max sql.NullFloat64) string {
+	if !min.Valid && !max.Valid {
+		return "any"
+	}
+	bound := func(v sql.NullFloat64) string {
+		if !v.Valid {
+			return "*"
+		}
+		return formatFloat(v.Float64)
+	}
+	return bound(min) + "-" + bound(max)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func nullFloat(v sql.NullInt64) sql.NullFloat64 {
+	return sql.NullFloat64{Float64: float64(v.Int64), Valid: v.Valid}
+}
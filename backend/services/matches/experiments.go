@@ -0,0 +1,113 @@
+package matches
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+
+	"matcherator/backend/services/experiments"
+)
+
+// experimentScorers are the scorers an experiment variant can weight, by name
+var experimentScorers = map[string]Scorer{
+	SectorScorer{}.Name():      SectorScorer{},
+	TargetGroupScorer{}.Name(): TargetGroupScorer{},
+	GeoScorer{}.Name():         GeoScorer{},
+	BudgetScorer{}.Name():      BudgetScorer{},
+	AwardSizeScorer{}.Name():   AwardSizeScorer{},
+}
+
+// PipelineFor builds the pipeline scoring matches for an experiment variant:
+// DefaultPipeline with the config's weights and minimum score applied. The
+// variant is recorded with the matches it stores.
+func PipelineFor(variant string, config experiments.ScoringConfig) (*Pipeline, error) {
+	for name, weight := range config.Weights {
+		if experimentScorers[name] == nil {
+			return nil, fmt.Errorf("unknown scorer %q", name)
+		}
+		if weight < 0 || math.IsNaN(weight) || math.IsInf(weight, 0) {
+			return nil, fmt.Errorf("weight of %s must be a non-negative number", name)
+		}
+	}
+
+	minScore := DefaultPipeline.MinScore
+	if config.MinScore != nil {
+		if *config.MinScore < 0 || math.IsNaN(*config.MinScore) || math.IsInf(*config.MinScore, 0) {
+			return nil, fmt.Errorf("min_score must be a non-negative number")
+		}
+		minScore = *config.MinScore
+	}
+
+	p := NewPipeline(minScore)
+	p.activityDecay = DefaultPipeline.activityDecay
+	p.variant = variant
+
+	weighted := make(map[string]bool)
+	for _, s := range DefaultPipeline.Scorers() {
+		weighted[s.Name()] = true
+		weight, ok := config.Weights[s.Name()]
+		if !ok {
+			weight = s.Weight
+		}
+		if weight > 0 {
+			p.Register(s.Scorer, weight)
+		}
+	}
+	for name, weight := range config.Weights {
+		if !weighted[name] && weight > 0 {
+			p.Register(experimentScorers[name], weight)
+		}
+	}
+
+	if len(p.scorers) == 0 {
+		return nil, fmt.Errorf("at least one scorer needs a positive weight")
+	}
+	return p, nil
+}
+
+// pipelineForUser returns the pipeline scoring the user's own matches: their
+// variant's when an experiment runs, assigning them on first use, and
+// DefaultPipeline otherwise
+func pipelineForUser(tx *sql.Tx, userID int64) (*Pipeline, error) {
+	experiment, err := experiments.Running(tx)
+	if err != nil || experiment == nil {
+		return DefaultPipeline, err
+	}
+
+	variant, err := experiments.Assign(tx, experiment, userID)
+	if err != nil {
+		return nil, err
+	}
+	return PipelineFor(variant.Name, variant.Config)
+}
+
+// storeCandidateMatches stores the user as a candidate in every other user's
+// list, scoring each list with the pipeline of its owner's variant. Users not
+// yet assigned keep DefaultPipeline until their own list is recalculated.
+func storeCandidateMatches(ctx context.Context, tx *sql.Tx, userID int64) error {
+	experiment, err := experiments.Running(tx)
+	if err != nil {
+		return err
+	}
+	if experiment == nil {
+		return DefaultPipeline.storeMatches(ctx, tx, "u.id = $1", userID)
+	}
+
+	for _, variant := range experiment.Variants {
+		p, err := PipelineFor(variant.Name, variant.Config)
+		if err != nil {
+			return fmt.Errorf("error building pipeline of variant %s: %v", variant.Name, err)
+		}
+		err = p.storeMatches(ctx, tx, `u.id = $1 AND usr.id IN (
+			SELECT user_id FROM experiment_assignments WHERE experiment_id = $2 AND variant = $3
+		)`, userID, experiment.ID, variant.Name)
+		if err != nil {
+			return err
+		}
+	}
+
+	return DefaultPipeline.storeMatches(ctx, tx, `u.id = $1 AND usr.id NOT IN (
+		SELECT user_id FROM experiment_assignments WHERE experiment_id = $2
+	)`, userID, experiment.ID)
+}
@@ -0,0 +1,207 @@
+package matches
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrUserNotFound is returned when one side of an explained pair does not exist
+var ErrUserNotFound = errors.New("user not found")
+
+// Explanation describes how the matching pipeline scores a candidate for a user
+type Explanation struct {
+	UserID      int64       `json:"user_id"`
+	CandidateID int64       `json:"candidate_id"`
+	Dimensions  []Dimension `json:"dimensions"`
+	Checks      []Check     `json:"checks"`
+	Score       float64     `json:"score"`
+	Normalized  float64     `json:"normalized_score"`
+	Matches     bool        `json:"matches"`
+
+	// ActivityFactor multiplies the summed points when the candidate has been
+	// inactive for longer than InactivityThreshold
+	ActivityFactor      float64   `json:"activity_factor"`
+	CandidateLastActive time.Time `json:"candidate_last_active_at"`
+}
+
+// Dimension is a single scoring component with its inputs and intermediate values
+type Dimension struct {
+	Name            string   `json:"name"`
+	UserValues      []string `json:"user_values,omitempty"`
+	CandidateValues []string `json:"candidate_values,omitempty"`
+	Overlap         []string `json:"overlap,omitempty"`
+	Ratio           float64  `json:"ratio"`
+	Weight          float64  `json:"weight"`
+	Points          float64  `json:"points"`
+}
+
+// Check is a filter the candidate must pass to appear in the user's matches
+type Check struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// ExplainMatch runs DefaultPipeline for a single pair and reports every step,
+// from the point of view of userID.
+// Taxonomy values are reported in their canonical (synonym-resolved) form.
+func ExplainMatch(db *sql.DB, userID, candidateID int64) (*Explanation, error) {
+	user, err := loadMatchProfile(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	candidate, err := loadMatchProfile(db, candidateID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Dual-role users are compared in the role they act in for this pair
+	userRole, candidateRole, opposite := pairSide(user, candidate)
+	if opposite && userRole != user.Role {
+		if user, err = loadMatchProfileAs(db, userID, userRole); err != nil {
+			return nil, err
+		}
+	}
+	if opposite && candidateRole != candidate.Role {
+		if candidate, err = loadMatchProfileAs(db, candidateID, candidateRole); err != nil {
+			return nil, err
+		}
+	}
+
+	explanation := &Explanation{
+		UserID:      userID,
+		CandidateID: candidateID,
+		Dimensions:  []Dimension{},
+	}
+	for _, scorer := range DefaultPipeline.Scorers() {
+		dimension := explainScorer(scorer, user, candidate)
+		explanation.Dimensions = append(explanation.Dimensions, dimension)
+		explanation.Score += dimension.Points
+	}
+	explanation.CandidateLastActive = candidate.LastActiveAt
+	explanation.ActivityFactor = DefaultPipeline.activityFactor(candidate, time.Now())
+	explanation.Score *= explanation.ActivityFactor
+	explanation.Normalized = NormalizeScore(explanation.Score)
+
+	userPrefs, err := LoadPreferences(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	candidatePrefs, err := LoadPreferences(db, candidateID)
+	if err != nil {
+		return nil, err
+	}
+	excludedByUser := userPrefs.excludes(candidate)
+	excludedByCandidate := candidatePrefs.excludes(user)
+	ineligible := eligibilityViolations(user, candidate)
+
+	var dismissed, connected bool
+	err = db.QueryRow(`
+		SELECT
+			EXISTS (
+				SELECT 1 FROM dismissed_matches
+				WHERE user_id = $1 AND match_id = $2
+			),
+			EXISTS (
+				SELECT 1 FROM connections
+				WHERE (initiator_id = $1 AND target_id = $2)
+				   OR (initiator_id = $2 AND target_id = $1)
+			)
+	`, userID, candidateID).Scan(&dismissed, &connected)
+	if err != nil {
+		return nil, fmt.Errorf("error checking match filters: %v", err)
+	}
+
+	explanation.Checks = []Check{
+		{
+			Name:   "opposite_role",
+			Passed: opposite,
+			Detail: fmt.Sprintf("user is %s, candidate is %s", user.Role, candidate.Role),
+		},
+		{
+			Name:   "candidate_active",
+			Passed: candidate.Status == "active",
+			Detail: fmt.Sprintf("candidate status is %q", candidate.Status),
+		},
+		{
+			Name:   "candidate_role_data",
+			Passed: candidate.HasRoleData,
+			Detail: "candidate must have provider_data or recipient_data matching their role",
+		},
+		{
+			Name:   "not_dismissed",
+			Passed: !dismissed,
+		},
+		{
+			Name:   "not_connected",
+			Passed: !connected,
+		},
+		{
+			Name:   "award_ranges_overlap",
+			Passed: awardRangesOverlap(user, candidate),
+			Detail: fmt.Sprintf("user %s, candidate %s", formatAwardRange(user), formatAwardRange(candidate)),
+		},
+		{
+			Name:   "within_eligibility_bands",
+			Passed: len(ineligible) == 0,
+			Detail: strings.Join(ineligible, "; "),
+		},
+		{
+			Name:   "not_excluded_by_user",
+			Passed: len(excludedByUser) == 0,
+			Detail: strings.Join(excludedByUser, "; "),
+		},
+		{
+			Name:   "not_excluded_by_candidate",
+			Passed: len(excludedByCandidate) == 0,
+			Detail: strings.Join(excludedByCandidate, "; "),
+		},
+		{
+			Name: "sector_or_target_group_overlap",
+			Passed: len(overlap(user.Sectors, candidate.Sectors)) > 0 ||
+				len(overlap(user.TargetGroups, candidate.TargetGroups)) > 0,
+		},
+		{
+			Name:   "minimum_score",
+			Passed: explanation.Score >= DefaultPipeline.MinScore,
+			Detail: fmt.Sprintf("score %.2f, minimum %.2f", explanation.Score, DefaultPipeline.MinScore),
+		},
+	}
+
+	explanation.Matches = true
+	for _, check := range explanation.Checks {
+		if !check.Passed {
+			explanation.Matches = false
+			break
+		}
+	}
+
+	return explanation, nil
+}
+
+// explainScorer evaluates one weighted scorer, including the compared values for
+// taxonomy scorers
+func explainScorer(scorer WeightedScorer, user, candidate *MatchProfile) Dimension {
+	dimension := Dimension{
+		Name:   scorer.Name(),
+		Ratio:  scorer.Score(user, candidate),
+		Weight: scorer.Weight,
+	}
+	dimension.Points = dimension.Ratio * scorer.Weight
+
+	if vs, ok := scorer.Scorer.(valueScorer); ok {
+		dimension.UserValues = vs.values(user)
+		dimension.CandidateValues = vs.values(candidate)
+		dimension.Overlap = overlap(dimension.UserValues, dimension.CandidateValues)
+	}
+
+	return dimension
+}
+
+// formatAwardRange describes a declared award range, e.g. "500-5000" or "any"
+func formatAwardRange(p *MatchProfile) string {
+	return formatBand(p.AwardMin, p.AwardMax)
+}
@@ -0,0 +1,89 @@
+package matches
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// DefaultStalenessWindow is used when MATCH_STALENESS_WINDOW is unset or invalid
+const DefaultStalenessWindow = 24 * time.Hour
+
+// StalenessWindow returns how long stored matches stay fresh, read from
+// MATCH_STALENESS_WINDOW as a Go duration (e.g. "6h")
+func StalenessWindow() time.Duration {
+	value := os.Getenv("MATCH_STALENESS_WINDOW")
+	if value == "" {
+		return DefaultStalenessWindow
+	}
+
+	window, err := time.ParseDuration(value)
+	if err != nil || window <= 0 {
+		log.Printf("Invalid MATCH_STALENESS_WINDOW %q, using %s", value, DefaultStalenessWindow)
+		return DefaultStalenessWindow
+	}
+	return window
+}
+
+// NeedsRefresh reports whether the user's match list was never calculated, or
+// last calculated before the staleness window or a change to their matching
+// inputs. A list that came out empty counts as fresh.
+func NeedsRefresh(db *sql.DB, userID int64) (bool, error) {
+	var needed bool
+	err := db.QueryRow(`
+		SELECT matches_calculated_at IS NULL
+			OR matches_calculated_at < $2
+			OR matches_calculated_at < COALESCE(matches_changed_at, matches_calculated_at)
+		FROM users
+		WHERE id = $1
+	`, userID, time.Now().Add(-StalenessWindow())).Scan(&needed)
+	if err != nil {
+		return false, fmt.Errorf("error checking match freshness: %v", err)
+	}
+
+	return needed, nil
+}
+
+// DefaultRecalculationCooldown is used when MATCH_RECALC_COOLDOWN is unset or
+// invalid
+const DefaultRecalculationCooldown = 10 * time.Minute
+
+// RecalculationCooldown returns how long a user waits between recalculations
+// they request, read from MATCH_RECALC_COOLDOWN as a Go duration
+func RecalculationCooldown() time.Duration {
+	return durationFromEnv("MATCH_RECALC_COOLDOWN", DefaultRecalculationCooldown)
+}
+
+// ClaimRecalculation records a recalculation the user requested. When they
+// requested one within the cooldown nothing is recorded, and it returns how
+// long until the next is allowed. Claiming in one statement keeps concurrent
+// requests, on any backend instance, from both going through.
+func ClaimRecalculation(db *sql.DB, userID int64) (time.Duration, error) {
+	cooldown := RecalculationCooldown()
+
+	var claimed bool
+	var wait float64
+	err := db.QueryRow(`
+		WITH claimed AS (
+			UPDATE users SET match_recalc_requested_at = CURRENT_TIMESTAMP
+			WHERE id = $1
+				AND (match_recalc_requested_at IS NULL
+					OR match_recalc_requested_at <= CURRENT_TIMESTAMP - $2 * INTERVAL '1 second')
+			RETURNING id
+		)
+		SELECT EXISTS (SELECT 1 FROM claimed),
+			COALESCE(EXTRACT(EPOCH FROM match_recalc_requested_at + $2 * INTERVAL '1 second' - CURRENT_TIMESTAMP), $2)
+		FROM users WHERE id = $1
+	`, userID, cooldown.Seconds()).Scan(&claimed, &wait)
+	if err != nil {
+		return 0, fmt.Errorf("error claiming match recalculation: %v", err)
+	}
+
+	if claimed {
+		return 0, nil
+	}
+	// A concurrent claim may not be visible to this statement yet
+	return max(time.Duration(wait*float64(time.Second)), time.Second), nil
+}
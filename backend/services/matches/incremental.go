@@ -0,0 +1,117 @@
+package matches
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"matcherator/backend/services/telemetry"
+)
+
+// LoadMatchProfile fetches the matching-related fields for a user. Handlers take a
+// snapshot before an edit and pass it to QueueUpdateIfChanged afterwards.
+func LoadMatchProfile(db *sql.DB, userID int64) (*MatchProfile, error) {
+	return loadMatchProfile(db, userID)
+}
+
+// QueueUpdateIfChanged queues an update of the stored matches involving
+// before.UserID when any field that takes part in matching has changed since
+// the snapshot. It reports whether an update was queued.
+func QueueUpdateIfChanged(db *sql.DB, before *MatchProfile) (bool, error) {
+	after, err := loadMatchProfile(db, before.UserID)
+	if err != nil {
+		return false, err
+	}
+
+	// A dual-role snapshot only covers the primary role's data
+	if !before.DualRole && sameScoringInputs(before, after) {
+		return false, nil
+	}
+
+	_, err = QueueUpdate(db, before.UserID)
+	return err == nil, err
+}
+
+// UpdateMatchesForUser recomputes only the stored matches involving userID, in both
+// directions: the user's own match list and their entry in every other user's list.
+// It returns ErrCircuitOpen without updating while recalculations are suspended.
+func UpdateMatchesForUser(db *sql.DB, userID int64) error {
+	return recalculations().Run(func(ctx context.Context) error {
+		return updateMatchesForUser(ctx, db, userID)
+	})
+}
+
+func updateMatchesForUser(ctx context.Context, db *sql.DB, userID int64) (err error) {
+	ctx, span := telemetry.Tracer().Start(ctx, "matches.update_for_user", trace.WithAttributes(
+		attribute.Int64("user.id", userID),
+	))
+	defer span.End()
+	defer func() { telemetry.ReportError(ctx, err) }()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// The user's own list
+	pipeline, err := pipelineForUser(tx, userID)
+	if err != nil {
+		return err
+	}
+	if err = pipeline.storeMatches(ctx, tx, "usr.id = $1", userID); err != nil {
+		return err
+	}
+	if err = pruneMatches(ctx, tx, "user_id = $1", userID); err != nil {
+		return err
+	}
+	storeShadowDiff(ctx, tx, userID)
+	if err = markCalculated(ctx, tx, userID); err != nil {
+		return err
+	}
+
+	// The user as a candidate in other users' lists
+	if err = storeCandidateMatches(ctx, tx, userID); err != nil {
+		return err
+	}
+	if err = pruneMatches(ctx, tx, "match_id = $1", userID); err != nil {
+		return err
+	}
+
+	if err = notifyNewMatches(tx, userID); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
+	calibrations.invalidate()
+
+	return nil
+}
+
+// sameScoringInputs reports whether two snapshots of a user would match identically
+func sameScoringInputs(a, b *MatchProfile) bool {
+	return a.Role == b.Role &&
+		a.DualRole == b.DualRole &&
+		a.Status == b.Status &&
+		a.State == b.State &&
+		a.City == b.City &&
+		a.ApplicantType == b.ApplicantType &&
+		a.FundingType == b.FundingType &&
+		a.AmountOffered == b.AmountOffered &&
+		a.BudgetRequested == b.BudgetRequested &&
+		a.AwardMin == b.AwardMin &&
+		a.AwardMax == b.AwardMax &&
+		a.AnnualBudget == b.AnnualBudget &&
+		a.StaffSize == b.StaffSize &&
+		a.FoundedYear == b.FoundedYear &&
+		a.Eligibility == b.Eligibility &&
+		a.HasRoleData == b.HasRoleData &&
+		slices.Equal(a.Sectors, b.Sectors) &&
+		slices.Equal(a.TargetGroups, b.TargetGroups)
+}
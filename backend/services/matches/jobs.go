@@ -0,0 +1,141 @@
+package matches
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"matcherator/backend/services/jobs"
+)
+
+// RecalculateJob is the job kind that recalculates one user's stored matches
+const RecalculateJob = "matches.recalculate"
+
+// UpdateJob is the job kind that updates the stored matches involving one
+// user in both directions, queued when their matching inputs change
+const UpdateJob = "matches.update"
+
+// RecalculatePayload is the payload of a RecalculateJob
+type RecalculatePayload struct {
+	UserID int64  `json:"user_id"`
+	Role   string `json:"role"`
+}
+
+// UpdatePayload is the payload of an UpdateJob
+type UpdatePayload struct {
+	UserID int64 `json:"user_id"`
+}
+
+// RegisterJobs installs the handlers of this package's job kinds
+func RegisterJobs(db *sql.DB) {
+	jobs.Register(RecalculateJob, RecalculateJobHandler(db))
+	jobs.Register(UpdateJob, UpdateJobHandler(db))
+	jobs.RegisterWithTimeout(RecalculateAllJob, recalculateAllTimeout, RecalculateAllJobHandler(db))
+}
+
+// EnqueueRecalculation queues a recalculation of the user's matches
+func EnqueueRecalculation(q jobs.Querier, userID int64, userRole string) error {
+	_, err := jobs.Enqueue(q, RecalculateJob, RecalculatePayload{UserID: userID, Role: userRole})
+	return err
+}
+
+// QueueRecalculation queues a recalculation of the user's matches and returns
+// its job ID. A recalculation or update of the user's matches already pending
+// or running is reused, as an update recalculates the user's own list too.
+func QueueRecalculation(db *sql.DB, userID int64, userRole string) (int64, error) {
+	active, err := jobs.ActiveWith(db, []string{RecalculateJob, UpdateJob}, UpdatePayload{UserID: userID})
+	if err != nil {
+		return 0, err
+	}
+	if active != nil {
+		return active.ID, nil
+	}
+	return jobs.Enqueue(db, RecalculateJob, RecalculatePayload{UserID: userID, Role: userRole})
+}
+
+// QueueUpdate records that the user's matching inputs changed and queues an
+// update of the stored matches involving them, returning its job ID. An update
+// already pending or running is reused; one that read the inputs before the
+// change queues another when it finishes.
+func QueueUpdate(db *sql.DB, userID int64) (int64, error) {
+	if _, err := db.Exec(`UPDATE users SET matches_changed_at = CURRENT_TIMESTAMP WHERE id = $1`, userID); err != nil {
+		return 0, fmt.Errorf("error marking matches of user %d changed: %v", userID, err)
+	}
+
+	payload := UpdatePayload{UserID: userID}
+	active, err := jobs.ActiveWith(db, []string{UpdateJob}, payload)
+	if err != nil {
+		return 0, err
+	}
+	if active != nil {
+		return active.ID, nil
+	}
+	return jobs.Enqueue(db, UpdateJob, payload)
+}
+
+// Recalculation is the state of a queued recalculation as its user sees it.
+// Status is pending (also while waiting to be retried), running, succeeded or
+// dead once every attempt failed.
+type Recalculation struct {
+	JobID       int64      `json:"job_id"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+}
+
+// GetRecalculation returns one of the user's queued recalculations or updates,
+// or jobs.ErrNotFound when the job is neither for their matches
+func GetRecalculation(db *sql.DB, userID, jobID int64) (*Recalculation, error) {
+	job, err := jobs.GetWith(db, jobID, []string{RecalculateJob, UpdateJob}, UpdatePayload{UserID: userID})
+	if err != nil {
+		return nil, err
+	}
+	return &Recalculation{
+		JobID:       job.ID,
+		Status:      job.Status,
+		CreatedAt:   job.CreatedAt,
+		CompletedAt: job.CompletedAt,
+	}, nil
+}
+
+// RecalculateJobHandler runs queued recalculations. While the circuit breaker is
+// open the job fails and is retried after backoff.
+func RecalculateJobHandler(db *sql.DB) jobs.Handler {
+	return func(ctx context.Context, payload json.RawMessage) error {
+		var p RecalculatePayload
+		if err := json.Unmarshal(payload, &p); err != nil {
+			return jobs.Permanent(fmt.Errorf("error decoding recalculation: %v", err))
+		}
+		return CalculateAndStoreMatches(db, p.UserID, p.Role)
+	}
+}
+
+// UpdateJobHandler runs queued updates. A change saved while the update ran
+// was deduplicated against it, so another update is queued to pick it up.
+func UpdateJobHandler(db *sql.DB) jobs.Handler {
+	return func(ctx context.Context, payload json.RawMessage) error {
+		var p UpdatePayload
+		if err := json.Unmarshal(payload, &p); err != nil {
+			return jobs.Permanent(fmt.Errorf("error decoding match update: %v", err))
+		}
+		if err := UpdateMatchesForUser(db, p.UserID); err != nil {
+			return err
+		}
+
+		var changed bool
+		err := db.QueryRowContext(ctx, `
+			SELECT COALESCE(matches_changed_at > matches_calculated_at, false)
+			FROM users WHERE id = $1
+		`, p.UserID).Scan(&changed)
+		if err != nil && err != sql.ErrNoRows {
+			return fmt.Errorf("error checking matches of user %d for changes: %v", p.UserID, err)
+		}
+		if changed {
+			_, err = jobs.Enqueue(db, UpdateJob, p)
+			return err
+		}
+		return nil
+	}
+}
@@ -1,273 +1,238 @@
 package matches
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
-	"log"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"matcherator/backend/services/telemetry"
+)
+
+const (
+	// MatchUpdatesChannel is the Postgres NOTIFY channel used to announce new matches
+	MatchUpdatesChannel = "match_updates"
+
+	// HighScoreThreshold is the minimum score for a match to be announced to the user
+	HighScoreThreshold = 45.0
+
+	// MinMatchScore is the minimum combined sector and target group score for a match
+	MinMatchScore = 30.0
+
+	// SectorWeight and TargetGroupWeight are the points awarded for a full overlap
+	SectorWeight      = 30.0
+	TargetGroupWeight = 30.0
+
+	// AwardSizeWeight is the points awarded when the provider's typical awards
+	// cover the recipient's whole acceptable range
+	AwardSizeWeight = 10.0
 )
 
-// CalculateAndStoreMatches calculates and stores matches for a user
+// MatchUpdate is the payload published on MatchUpdatesChannel
+type MatchUpdate struct {
+	UserID int64 `json:"user_id"`
+	Count  int   `json:"count"` // new high-score matches
+}
+
+// CalculateAndStoreMatches calculates and stores matches for a user. A dual-role
+// user gets a list in each role, told apart by the stored as_role. It returns
+// ErrCircuitOpen without recalculating while recalculations are suspended.
 func CalculateAndStoreMatches(db *sql.DB, userID int64, userRole string) error {
-	tx, err := db.Begin()
+	return recalculations().Run(func(ctx context.Context) error {
+		return calculateAndStoreMatches(ctx, db, userID, userRole)
+	})
+}
+
+func calculateAndStoreMatches(ctx context.Context, db *sql.DB, userID int64, userRole string) (err error) {
+	ctx, span := telemetry.Tracer().Start(ctx, "matches.calculate", trace.WithAttributes(
+		attribute.Int64("user.id", userID),
+		attribute.String("user.role", userRole),
+	))
+	defer span.End()
+	defer func() { telemetry.ReportError(ctx, err) }()
+
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("error starting transaction: %v", err)
 	}
 	defer tx.Rollback()
 
-	// Drop and recreate the temp_matches table to ensure a clean state
-	_, err = tx.Exec(`DROP TABLE IF EXISTS temp_matches`)
+	// Score the user against every candidate, with their experiment variant's pipeline if any
+	pipeline, err := pipelineForUser(tx, userID)
 	if err != nil {
-		return fmt.Errorf("error dropping temp table: %v", err)
+		return err
+	}
+	if err = pipeline.storeMatches(ctx, tx, "usr.id = $1 AND usr.role = $2", userID, userRole); err != nil {
+		return err
+	}
+	if err = pruneMatches(ctx, tx, "user_id = $1", userID); err != nil {
+		return err
+	}
+	storeShadowDiff(ctx, tx, userID)
+	if err = markCalculated(ctx, tx, userID); err != nil {
+		return err
 	}
 
-	// Create dismissed_matches table if it doesn't exist
-	_, err = tx.Exec(`
-		CREATE TABLE IF NOT EXISTS dismissed_matches (
-			user_id BIGINT NOT NULL,
-			match_id BIGINT NOT NULL,
-			dismissed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-			PRIMARY KEY (user_id, match_id)
-		)
-	`)
+	// Announce new high-score matches; pg_notify is only delivered once the transaction commits
+	if err = notifyNewMatches(tx, userID); err != nil {
+		return err
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
+	calibrations.invalidate()
+
+	return nil
+}
+
+// pruneMatches deletes the stored matches selected by cond, with $1 the user,
+// that the transaction did not store again. Stored pairs carry the start of the
+// transaction in calculated_at, which is what CURRENT_TIMESTAMP returns until
+// it commits.
+func pruneMatches(ctx context.Context, tx *sql.Tx, cond string, userID int64) error {
+	_, err := tx.ExecContext(ctx, `
+		DELETE FROM matches
+		WHERE (`+cond+`) AND calculated_at < CURRENT_TIMESTAMP
+	`, userID)
 	if err != nil {
-		return fmt.Errorf("error creating dismissed_matches table: %v", err)
+		return fmt.Errorf("error removing outdated matches of user %d: %v", userID, err)
 	}
+	return nil
+}
 
-	// Create temporary table for matches
-	_, err = tx.Exec(`
-		CREATE TABLE temp_matches (
-			user_id BIGINT NOT NULL,
-			match_id BIGINT NOT NULL,
-			match_score FLOAT NOT NULL,
-			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-			PRIMARY KEY (user_id, match_id)
-		)
-	`)
+// markCalculated records that the user's match list was recalculated as of
+// the start of the transaction, so an empty list counts as fresh too
+func markCalculated(ctx context.Context, tx *sql.Tx, userID int64) error {
+	_, err := tx.ExecContext(ctx, `
+		UPDATE users SET matches_calculated_at = CURRENT_TIMESTAMP WHERE id = $1
+	`, userID)
 	if err != nil {
-		return fmt.Errorf("error creating temp table: %v", err)
+		return fmt.Errorf("error marking matches of user %d calculated: %v", userID, err)
 	}
+	return nil
+}
 
-	// Build the match calculation query based on user role
-	var query string
-	if userRole == "provider" {
-		query = `
-			INSERT INTO temp_matches (user_id, match_id, match_score)
-			SELECT 
-				$1 as user_id,
-				u.id as match_id,
-				(
-					-- Sector match score (30%)
-					COALESCE(
-						(
-							SELECT COUNT(*) 
-							FROM UNNEST(p1.sectors) s
-							WHERE s = ANY(p2.sectors)
-						)::float / 
-						NULLIF(
-							(
-								SELECT COUNT(*) 
-								FROM UNNEST(p2.sectors) s
-							), 0
-						),
-						0
-					) * 30 +
-					-- Target group match score (30%)
-					COALESCE(
-						(
-							SELECT COUNT(*) 
-							FROM UNNEST(p1.target_groups) t
-							WHERE t = ANY(p2.target_groups)
-						)::float / 
-						NULLIF(
-							(
-								SELECT COUNT(*) 
-								FROM UNNEST(p2.target_groups) t
-							), 0
-						),
-						0
-					) * 30
-				) as match_score
-			FROM users u
-			JOIN profiles p1 ON u.id = p1.user_id
-			JOIN profiles p2 ON p2.user_id = $1
-			JOIN recipient_data r ON u.id = r.user_id
-			WHERE u.role = 'recipient'
-			AND u.status = 'active'
-			AND NOT EXISTS (
-				SELECT 1 FROM dismissed_matches dm
-				WHERE dm.user_id = $1 AND dm.match_id = u.id
-			)
-			AND NOT EXISTS (
-				SELECT 1 FROM connections c
-				WHERE (c.initiator_id = $1 AND c.target_id = u.id)
-				   OR (c.initiator_id = u.id AND c.target_id = $1)
-			)
-			AND (
-				-- Sector match (if both have sectors)
-				(p1.sectors IS NOT NULL AND p2.sectors IS NOT NULL AND p1.sectors && p2.sectors)
-				OR
-				-- Target group match (if both have target groups)
-				(p1.target_groups IS NOT NULL AND p2.target_groups IS NOT NULL AND p1.target_groups && p2.target_groups)
-			)
-			AND (
-				-- Sector match score
-				COALESCE(
-					(
-						SELECT COUNT(*) 
-						FROM UNNEST(p1.sectors) s
-						WHERE s = ANY(p2.sectors)
-					)::float / 
-					NULLIF(
-						(
-							SELECT COUNT(*) 
-							FROM UNNEST(p2.sectors) s
-						), 0
-					),
-					0
-				) * 30 +
-				-- Target group match score
-				COALESCE(
-					(
-						SELECT COUNT(*) 
-						FROM UNNEST(p1.target_groups) t
-						WHERE t = ANY(p2.target_groups)
-					)::float / 
-					NULLIF(
-						(
-							SELECT COUNT(*) 
-							FROM UNNEST(p2.target_groups) t
-						), 0
-					),
-					0
-				) * 30
-			) >= 30  -- At least 30% match on sectors and target groups combined
-		`
-	} else {
-		query = `
-			INSERT INTO temp_matches (user_id, match_id, match_score)
-			SELECT 
-				$1 as user_id,
-				u.id as match_id,
-				(
-					-- Sector match score (30%)
-					COALESCE(
-						(
-							SELECT COUNT(*) 
-							FROM UNNEST(p1.sectors) s
-							WHERE s = ANY(p2.sectors)
-						)::float / 
-						NULLIF(
-							(
-								SELECT COUNT(*) 
-								FROM UNNEST(p2.sectors) s
-							), 0
-						),
-						0
-					) * 30 +
-					-- Target group match score (30%)
-					COALESCE(
-						(
-							SELECT COUNT(*) 
-							FROM UNNEST(p1.target_groups) t
-							WHERE t = ANY(p2.target_groups)
-						)::float / 
-						NULLIF(
-							(
-								SELECT COUNT(*) 
-								FROM UNNEST(p2.target_groups) t
-							), 0
-						),
-						0
-					) * 30
-				) as match_score
-			FROM users u
-			JOIN profiles p1 ON u.id = p1.user_id
-			JOIN profiles p2 ON p2.user_id = $1
-			JOIN provider_data p ON u.id = p.user_id
-			WHERE u.role = 'provider'
-			AND u.status = 'active'
-			AND NOT EXISTS (
-				SELECT 1 FROM dismissed_matches dm
-				WHERE dm.user_id = $1 AND dm.match_id = u.id
-			)
-			AND NOT EXISTS (
-				SELECT 1 FROM connections c
-				WHERE (c.initiator_id = $1 AND c.target_id = u.id)
-				   OR (c.initiator_id = u.id AND c.target_id = $1)
-			)
-			AND (
-				-- Sector match (if both have sectors)
-				(p1.sectors IS NOT NULL AND p2.sectors IS NOT NULL AND p1.sectors && p2.sectors)
-				OR
-				-- Target group match (if both have target groups)
-				(p1.target_groups IS NOT NULL AND p2.target_groups IS NOT NULL AND p1.target_groups && p2.target_groups)
-			)
-			AND (
-				-- Sector match score
-				COALESCE(
-					(
-						SELECT COUNT(*) 
-						FROM UNNEST(p1.sectors) s
-						WHERE s = ANY(p2.sectors)
-					)::float / 
-					NULLIF(
-						(
-							SELECT COUNT(*) 
-							FROM UNNEST(p2.sectors) s
-						), 0
-					),
-					0
-				) * 30 +
-				-- Target group match score
-				COALESCE(
-					(
-						SELECT COUNT(*) 
-						FROM UNNEST(p1.target_groups) t
-						WHERE t = ANY(p2.target_groups)
-					)::float / 
-					NULLIF(
-						(
-							SELECT COUNT(*) 
-							FROM UNNEST(p2.target_groups) t
-						), 0
-					),
-					0
-				) * 30
-			) >= 30  -- At least 30% match on sectors and target groups combined
-		`
+// notifyNewMatches publishes a MatchUpdate when the transaction stored
+// high-score matches the user did not have yet. Pairs stored before keep
+// their created_at when upserted, so only pairs first inserted by the
+// transaction carry its start time.
+func notifyNewMatches(tx *sql.Tx, userID int64) error {
+	var count int
+	err := tx.QueryRow(`
+		SELECT COUNT(*)
+		FROM matches
+		WHERE user_id = $1 AND match_score >= $2 AND created_at = CURRENT_TIMESTAMP
+	`, userID, HighScoreThreshold).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("error counting new high-score matches: %v", err)
 	}
 
-	// Execute the match calculation query
-	_, err = tx.Exec(query, userID)
+	if count == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(MatchUpdate{UserID: userID, Count: count})
 	if err != nil {
-		return fmt.Errorf("error calculating matches: %v", err)
+		return fmt.Errorf("error encoding match update: %v", err)
 	}
 
-	// Commit transaction
-	if err = tx.Commit(); err != nil {
-		return fmt.Errorf("error committing transaction: %v", err)
+	if _, err = tx.Exec(`SELECT pg_notify($1, $2)`, MatchUpdatesChannel, string(payload)); err != nil {
+		return fmt.Errorf("error publishing match update: %v", err)
 	}
 
 	return nil
 }
 
-// GetStoredMatches retrieves pre-calculated matches for a user
-func GetStoredMatches(db *sql.DB, userID int64) ([]Match, error) {
+// storedMatchesFrom selects a user's stored matches: $1 is the user, $2 the
+// staleness cutoff, $3 whether stale matches are kept too and $4 the role
+// the user acts in, "" for every list
+const storedMatchesFrom = `
+		FROM matches tm
+		JOIN users u ON u.id = tm.match_id
+		JOIN users usr ON usr.id = tm.user_id
+		CROSS JOIN LATERAL (
+			SELECT
+				COALESCE(tm.as_role, usr.role) AS as_role,
+				CASE COALESCE(tm.as_role, usr.role) WHEN 'provider' THEN 'recipient' ELSE 'provider' END AS role
+		) side
+		LEFT JOIN profiles p ON p.user_id = tm.match_id
+		LEFT JOIN provider_data pd ON pd.user_id = tm.match_id AND side.role = 'provider'
+		LEFT JOIN recipient_data rd ON rd.user_id = tm.match_id AND side.role = 'recipient'
+		WHERE tm.user_id = $1
+		AND ($3 OR tm.calculated_at >= $2)
+		AND ($4 = '' OR side.as_role = $4)
+`
+
+// GetStoredMatches retrieves pre-calculated matches for a user, excluding those
+// calculated before the staleness window. While recalculations are suspended the
+// stale ones are returned too, flagged as Stale. asRole keeps only the list the
+// user has as "provider" or "recipient"; "" returns every list.
+func GetStoredMatches(db *sql.DB, userID int64, asRole string) ([]Match, error) {
+	return queryStoredMatches(db, userID, asRole, time.Now().Add(-StalenessWindow()), nil, 0)
+}
+
+// GetStoredMatchesPage returns limit of the matches GetStoredMatches returns,
+// from offset in the same order, and how many there are in all
+func GetStoredMatchesPage(db *sql.DB, userID int64, asRole string, limit, offset int) ([]Match, int, error) {
+	cutoff := time.Now().Add(-StalenessWindow())
+	var total int
+	err := db.QueryRow(`SELECT COUNT(*)`+storedMatchesFrom, userID, cutoff, RecalculationsSuspended(), asRole).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error counting matches: %v", err)
+	}
+	if limit <= 0 || offset >= total {
+		return []Match{}, total, nil
+	}
+
+	matches, err := queryStoredMatches(db, userID, asRole, cutoff, &limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	return matches, total, nil
+}
+
+// queryStoredMatches returns a user's stored matches calculated since cutoff,
+// at most limit of them from offset when limit isn't nil
+func queryStoredMatches(db *sql.DB, userID int64, asRole string, cutoff time.Time, limit *int, offset int) ([]Match, error) {
+	includeStale := RecalculationsSuspended()
+
 	query := `
 		SELECT 
 			tm.match_id,
 			tm.match_score,
+			tm.calculated_at,
 			u.email,
 			p.organization_name,
-			p.profile_picture_url
-		FROM temp_matches tm
-		JOIN users u ON u.id = tm.match_id
-		LEFT JOIN profiles p ON p.user_id = tm.match_id
-		WHERE tm.user_id = $1
-		ORDER BY tm.match_score DESC
+			p.profile_picture_url,
+			p.profile_picture_alt,
+			COALESCE(u.last_active_at, u.created_at, CURRENT_TIMESTAMP),
+			COALESCE(tm.variant, ''),
+			side.as_role,
+			side.role,
+			COALESCE(p.sectors, '{}'),
+			COALESCE(p.target_groups, '{}'),
+			p.location,
+			p.state,
+			p.city,
+			COALESCE(p.mission_statement, ''),
+			pd.funding_type,
+			pd.amount_offered,
+			pd.deadline,
+			rd.budget_requested,
+			EXISTS (SELECT 1 FROM bookmarks b WHERE b.user_id = tm.user_id AND b.bookmarked_id = tm.match_id)` + storedMatchesFrom + `
+		ORDER BY tm.match_score DESC, tm.match_id
+		LIMIT $5 OFFSET $6
 	`
 
-	rows, err := db.Query(query, userID)
+	rows, err := db.Query(query, userID, cutoff, includeStale, asRole, limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("error querying matches: %v", err)
 	}
@@ -276,16 +241,39 @@ func GetStoredMatches(db *sql.DB, userID int64) ([]Match, error) {
 	var matches []Match
 	for rows.Next() {
 		var match Match
+		var mission string
 		err := rows.Scan(
 			&match.ID,
-			&match.Score,
+			&match.RawScore,
+			&match.CalculatedAt,
 			&match.Email,
 			&match.OrganizationName,
 			&match.ProfilePictureURL,
+			&match.ProfilePictureAlt,
+			&match.LastActiveAt,
+			&match.Variant,
+			&match.AsRole,
+			&match.Role,
+			pq.Array(&match.Sectors),
+			pq.Array(&match.TargetGroups),
+			&match.Location,
+			&match.State,
+			&match.City,
+			&mission,
+			&match.FundingType,
+			&match.AmountOffered,
+			&match.Deadline,
+			&match.BudgetRequested,
+			&match.Bookmarked,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning match: %v", err)
 		}
+		match.MissionSnippet = missionSnippet(mission)
+		match.Stale = match.CalculatedAt.Before(cutoff)
+		match.Activity = ActivityRecency(match.LastActiveAt, time.Now())
+		// Only the day is shown to the other side
+		match.LastActiveAt = match.LastActiveAt.UTC().Truncate(24 * time.Hour)
 		matches = append(matches, match)
 	}
 
@@ -293,43 +281,65 @@ func GetStoredMatches(db *sql.DB, userID int64) ([]Match, error) {
 		return nil, fmt.Errorf("error iterating matches: %v", err)
 	}
 
-	return matches, nil
-}
-
-// RecalculateMatchesForAllUsers recalculates matches for all users
-func RecalculateMatchesForAllUsers(db *sql.DB) error {
-	rows, err := db.Query("SELECT id, role FROM users WHERE status = 'active'")
+	// Calibrate displayed scores against the population of stored matches
+	calibration, err := CurrentCalibration(db)
 	if err != nil {
-		return fmt.Errorf("error querying users: %v", err)
+		return nil, err
 	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var userID int64
-		var role string
-		if err := rows.Scan(&userID, &role); err != nil {
-			log.Printf("Error scanning user: %v", err)
-			continue
-		}
-
-		if err := CalculateAndStoreMatches(db, userID, role); err != nil {
-			log.Printf("Error calculating matches for user %d: %v", userID, err)
-			continue
-		}
+	for i := range matches {
+		matches[i].Score = calibration.Score(matches[i].RawScore)
 	}
 
-	if err = rows.Err(); err != nil {
-		return fmt.Errorf("error iterating users: %v", err)
-	}
-
-	return nil
+	return matches, nil
 }
 
 // Match represents a match between users
 type Match struct {
-	ID                int64          `json:"id"`
-	Score             float64        `json:"score"`
-	Email             string         `json:"email"`
-	OrganizationName  string         `json:"organization_name"`
-	ProfilePictureURL sql.NullString `json:"profile_picture_url"`
+	ID                int64     `json:"id"`
+	Score             float64   `json:"score"`     // calibrated 0-100 score
+	RawScore          float64   `json:"raw_score"` // pipeline score before calibration
+	CalculatedAt      time.Time `json:"calculated_at"`
+	Email             string    `json:"email"`
+	OrganizationName  string    `json:"organization_name"`
+	ProfilePictureURL *string   `json:"profile_picture_url"`
+	ProfilePictureAlt *string   `json:"profile_picture_alt"`
+	Stale             bool      `json:"stale"` // calculated before the staleness window
+	LastActiveAt      time.Time `json:"last_active_at"`
+	Activity          string    `json:"activity"`   // active, recent or inactive
+	Variant           string    `json:"-"`          // experiment variant that scored the match, "" outside experiments
+	AsRole            string    `json:"as_role"`    // role the user acts in for the match
+	Bookmarked        bool      `json:"bookmarked"` // the user bookmarked the match
+
+	// What a match card shows, so listing matches needs no profile request
+	// per match. Funding details are set for providers, the budget requested
+	// for recipients; Role is the one the match acts in.
+	Role            string     `json:"role"`
+	Sectors         []string   `json:"sectors"`
+	TargetGroups    []string   `json:"target_groups"`
+	Location        *string    `json:"location"`
+	State           *string    `json:"state"`
+	City            *string    `json:"city"`
+	MissionSnippet  string     `json:"mission_snippet"`
+	FundingType     *string    `json:"funding_type,omitempty"`
+	AmountOffered   *float64   `json:"amount_offered,omitempty"`
+	Deadline        *time.Time `json:"deadline,omitempty"`
+	BudgetRequested *float64   `json:"budget_requested,omitempty"`
+}
+
+// missionSnippetLen is how much of a mission statement a match card shows
+const missionSnippetLen = 200
+
+// missionSnippet shortens a mission statement for a match card, at a word
+// boundary where there is one
+func missionSnippet(mission string) string {
+	mission = strings.Join(strings.Fields(mission), " ")
+	runes := []rune(mission)
+	if len(runes) <= missionSnippetLen {
+		return mission
+	}
+	cut := string(runes[:missionSnippetLen])
+	if i := strings.LastIndex(cut, " "); i > missionSnippetLen/2 {
+		cut = cut[:i]
+	}
+	return cut + "…"
 }
@@ -0,0 +1,138 @@
+package matches
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MinCalibrationSize is the smallest population used for percentile calibration;
+// below it scores are only rescaled linearly
+const MinCalibrationSize = 20
+
+// NormalizeScore rescales a raw DefaultPipeline score to 0-100
+func NormalizeScore(raw float64) float64 {
+	maxScore := DefaultPipeline.MaxScore()
+	if math.IsNaN(raw) || raw <= 0 || maxScore <= 0 {
+		return 0
+	}
+	if raw >= maxScore {
+		return 100
+	}
+	return raw / maxScore * 100
+}
+
+// Calibration maps raw scores to their percentile rank within a population
+type Calibration struct {
+	scores []float64
+}
+
+// NewCalibration builds a calibration from a population of raw scores, ignoring invalid values
+func NewCalibration(population []float64) *Calibration {
+	scores := make([]float64, 0, len(population))
+	for _, s := range population {
+		if !math.IsNaN(s) && !math.IsInf(s, 0) {
+			scores = append(scores, s)
+		}
+	}
+	sort.Float64s(scores)
+	return &Calibration{scores: scores}
+}
+
+// Score returns the displayed 0-100 score for a raw score. With a large enough
+// population it is the mid-rank percentile; otherwise the linear normalization.
+func (c *Calibration) Score(raw float64) float64 {
+	if c == nil || len(c.scores) < MinCalibrationSize {
+		return NormalizeScore(raw)
+	}
+	if math.IsNaN(raw) {
+		return 0
+	}
+
+	below := sort.SearchFloat64s(c.scores, raw)
+	above := sort.Search(len(c.scores), func(i int) bool { return c.scores[i] > raw })
+	equal := above - below
+
+	percentile := (float64(below) + 0.5*float64(equal)) / float64(len(c.scores)) * 100
+	return math.Round(percentile*100) / 100
+}
+
+// Calibration cache ages. The cache is reloaded once it reaches
+// CalibrationMaxAge, or after a recalculation once it reaches
+// calibrationMinAge, so a run of recalculations reloads it at most that often.
+const (
+	CalibrationMaxAge = 10 * time.Minute
+	calibrationMinAge = 30 * time.Second
+)
+
+// calibrationCache holds the calibration GetStoredMatches scores against, so
+// reading matches doesn't scan every stored score
+type calibrationCache struct {
+	mu       sync.Mutex
+	current  *Calibration
+	loadedAt time.Time
+	stale    bool
+}
+
+var calibrations calibrationCache
+
+// get returns the cached calibration, reloading it with load when it is too
+// old. Concurrent callers wait for a single reload.
+func (c *calibrationCache) get(now time.Time, load func() (*Calibration, error)) (*Calibration, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	age := now.Sub(c.loadedAt)
+	if c.current != nil && age < CalibrationMaxAge && (!c.stale || age < calibrationMinAge) {
+		return c.current, nil
+	}
+
+	calibration, err := load()
+	if err != nil {
+		return nil, err
+	}
+	c.current, c.loadedAt, c.stale = calibration, now, false
+	return calibration, nil
+}
+
+// invalidate marks the cached calibration outdated by a recalculation
+func (c *calibrationCache) invalidate() {
+	c.mu.Lock()
+	c.stale = true
+	c.mu.Unlock()
+}
+
+// CurrentCalibration returns the calibration of the stored match scores,
+// loaded with LoadCalibration and cached between recalculations
+func CurrentCalibration(db *sql.DB) (*Calibration, error) {
+	return calibrations.get(time.Now(), func() (*Calibration, error) {
+		return LoadCalibration(db)
+	})
+}
+
+// LoadCalibration builds a calibration from every stored match score
+func LoadCalibration(db *sql.DB) (*Calibration, error) {
+	rows, err := db.Query(`SELECT match_score FROM matches`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying match scores: %v", err)
+	}
+	defer rows.Close()
+
+	var population []float64
+	for rows.Next() {
+		var score float64
+		if err := rows.Scan(&score); err != nil {
+			return nil, fmt.Errorf("error scanning match score: %v", err)
+		}
+		population = append(population, score)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating match scores: %v", err)
+	}
+
+	return NewCalibration(population), nil
+}
@@ -0,0 +1,88 @@
+package matches
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCalibrationScore(t *testing.T) {
+	identical := make([]float64, MinCalibrationSize)
+	for i := range identical {
+		identical[i] = 42
+	}
+	spread := make([]float64, MinCalibrationSize)
+	for i := range spread {
+		spread[i] = float64(i + 1)
+	}
+	maxScore := DefaultPipeline.MaxScore()
+
+	tests := []struct {
+		name       string
+		population []float64
+		raw        float64
+		want       float64
+	}{
+		{"empty population rescales linearly", nil, maxScore / 2, 50},
+		{"empty population, zero score", nil, 0, 0},
+		{"single row rescales linearly", []float64{maxScore / 4}, maxScore / 4, 25},
+		{"identical scores rank in the middle", identical, 42, 50},
+		{"below identical scores", identical, 41, 0},
+		{"above identical scores", identical, 43, 100},
+		{"lowest of a spread", spread, 1, 2.5},
+		{"highest of a spread", spread, float64(MinCalibrationSize), 97.5},
+		{"between two scores", spread, 10.5, 50},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewCalibration(tt.population).Score(tt.raw); got != tt.want {
+				t.Errorf("Score(%v) = %v, want %v", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCalibrationCache(t *testing.T) {
+	var c calibrationCache
+	loads := 0
+	load := func() (*Calibration, error) {
+		loads++
+		return NewCalibration(nil), nil
+	}
+	start := time.Now()
+
+	first, err := c.get(start, load)
+	if err != nil || loads != 1 {
+		t.Fatalf("first get: loads = %d, err = %v", loads, err)
+	}
+	if cached, _ := c.get(start.Add(time.Minute), load); cached != first || loads != 1 {
+		t.Errorf("get within max age reloaded: loads = %d", loads)
+	}
+
+	// A recalculation reloads only once the minimum age has passed
+	c.invalidate()
+	c.get(start.Add(calibrationMinAge/2), load)
+	if loads != 1 {
+		t.Errorf("get before min age reloaded: loads = %d", loads)
+	}
+	c.get(start.Add(calibrationMinAge), load)
+	if loads != 2 {
+		t.Errorf("get after invalidation didn't reload: loads = %d", loads)
+	}
+
+	c.get(start.Add(calibrationMinAge+CalibrationMaxAge), load)
+	if loads != 3 {
+		t.Errorf("get after max age didn't reload: loads = %d", loads)
+	}
+
+	// A failed reload is retried by the next get
+	failing := func() (*Calibration, error) { return nil, errors.New("down") }
+	c.invalidate()
+	if _, err := c.get(start.Add(2*CalibrationMaxAge), failing); err == nil {
+		t.Error("get returned no error from a failed load")
+	}
+	c.get(start.Add(2*CalibrationMaxAge), load)
+	if loads != 4 {
+		t.Errorf("get after a failed load didn't reload: loads = %d", loads)
+	}
+}
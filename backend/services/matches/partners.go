@@ -0,0 +1,144 @@
+package matches
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// PartnerSectorWeight, PartnerGeoWeight and PartnerFundingTypeWeight are the
+	// points a co-funding partner earns for a full sector overlap, the same city
+	// and the same funding type
+	PartnerSectorWeight      = 30.0
+	PartnerGeoWeight         = 10.0
+	PartnerFundingTypeWeight = 10.0
+
+	// maxPartners caps the partners suggested at once
+	maxPartners = 50
+)
+
+var (
+	// ErrNotProvider is returned when a user who doesn't fund asks for partners
+	ErrNotProvider = errors.New("only providers can look for co-funding partners")
+
+	// ErrCofundingDisabled is returned when the user hasn't opted into
+	// co-funding discovery
+	ErrCofundingDisabled = errors.New("co-funding discovery is turned off")
+)
+
+// Partner is another provider a funder could co-fund with
+type Partner struct {
+	ID                int64    `json:"id"`
+	OrganizationName  string   `json:"organization_name"`
+	ProfilePictureURL *string  `json:"profile_picture_url"`
+	State             string   `json:"state"`
+	City              string   `json:"city"`
+	FundingType       string   `json:"funding_type"`
+	SharedSectors     []string `json:"shared_sectors"`
+	Score             float64  `json:"score"`
+}
+
+// partnerScoreSQL scores a candidate partner (u, p1, pd1) for the user (usr, p2,
+// pd2) with the sector and geography scorers of matching and the funding type
+var partnerScoreSQL = fmt.Sprintf(`(%s) * %s + (%s) * %s + (CASE
+		WHEN COALESCE(pd2.funding_type, '') <> '' AND LOWER(pd1.funding_type) = LOWER(pd2.funding_type) THEN 1
+		ELSE 0
+	END) * %s`,
+	SectorScorer{}.SQL(), strconv.FormatFloat(PartnerSectorWeight, 'f', -1, 64),
+	GeoScorer{}.SQL(), strconv.FormatFloat(PartnerGeoWeight, 'f', -1, 64),
+	strconv.FormatFloat(PartnerFundingTypeWeight, 'f', -1, 64),
+)
+
+// FindPartners returns active providers sharing a sector with the user, best
+// first. Both sides must have opted into co-funding discovery in their match
+// preferences, and neither may exclude the other.
+func FindPartners(db *sql.DB, userID int64) ([]Partner, error) {
+	holdsRole, optedIn, err := loadOptIn(db, userID, "provider", "open_to_cofunding")
+	if err != nil {
+		return nil, err
+	}
+	if !holdsRole {
+		return nil, ErrNotProvider
+	}
+	if !optedIn {
+		return nil, ErrCofundingDisabled
+	}
+
+	rows, err := db.Query(`
+		SELECT
+			u.id,
+			COALESCE(pr.organization_name, ''),
+			pr.profile_picture_url,
+			COALESCE(p1.state, ''),
+			COALESCE(p1.city, ''),
+			COALESCE(pd1.funding_type, ''),
+			ARRAY(SELECT s FROM UNNEST(p1.sectors) s WHERE s = ANY(p2.sectors) ORDER BY s),
+			`+partnerScoreSQL+` AS score
+		FROM users usr
+		JOIN matching_profiles p2 ON p2.user_id = usr.id
+		JOIN provider_data pd2 ON pd2.user_id = usr.id
+		JOIN match_preferences ex2 ON ex2.user_id = usr.id
+		JOIN users u ON u.id <> usr.id
+		JOIN matching_profiles p1 ON p1.user_id = u.id
+		JOIN provider_data pd1 ON pd1.user_id = u.id
+		JOIN match_preferences ex1 ON ex1.user_id = u.id AND ex1.open_to_cofunding
+		LEFT JOIN profiles pr ON pr.user_id = u.id
+		WHERE usr.id = $1
+			AND (u.role = 'provider' OR u.dual_role)
+			AND u.status = 'active'
+			AND u.deleted_at IS NULL
+			AND p1.sectors && p2.sectors
+			AND `+fmt.Sprintf(exclusionFilter, "ex2", "p1", "pd1")+`
+			AND `+fmt.Sprintf(exclusionFilter, "ex1", "p2", "pd2")+`
+		ORDER BY score DESC, u.id
+		LIMIT $2
+	`, userID, maxPartners)
+	if err != nil {
+		return nil, fmt.Errorf("error querying co-funding partners: %v", err)
+	}
+	defer rows.Close()
+
+	partners := []Partner{}
+	for rows.Next() {
+		var p Partner
+		err := rows.Scan(
+			&p.ID,
+			&p.OrganizationName,
+			&p.ProfilePictureURL,
+			&p.State,
+			&p.City,
+			&p.FundingType,
+			pq.Array(&p.SharedSectors),
+			&p.Score,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning co-funding partner: %v", err)
+		}
+		partners = append(partners, p)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating co-funding partners: %v", err)
+	}
+	return partners, nil
+}
+
+// loadOptIn reports whether the user holds role, as their primary role or as a
+// dual-role user, and has turned on the match_preferences flag column
+func loadOptIn(db *sql.DB, userID int64, role, flag string) (holdsRole, optedIn bool, err error) {
+	err = db.QueryRow(`
+		SELECT u.role = $2 OR u.dual_role, COALESCE(mp.`+flag+`, false)
+		FROM users u
+		LEFT JOIN match_preferences mp ON mp.user_id = u.id
+		WHERE u.id = $1
+	`, userID, role).Scan(&holdsRole, &optedIn)
+	if err == sql.ErrNoRows {
+		return false, false, ErrUserNotFound
+	} else if err != nil {
+		return false, false, fmt.Errorf("error loading %s setting: %v", flag, err)
+	}
+	return holdsRole, optedIn, nil
+}
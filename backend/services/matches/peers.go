@@ -0,0 +1,125 @@
+package matches
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// PeerSectorWeight, PeerTargetGroupWeight and PeerGeoWeight are the points a
+	// peer recipient earns for a full sector overlap, a full target group overlap
+	// and the same city
+	PeerSectorWeight      = 30.0
+	PeerTargetGroupWeight = 20.0
+	PeerGeoWeight         = 20.0
+
+	// maxPeers caps the peers suggested at once
+	maxPeers = 50
+)
+
+var (
+	// ErrNotRecipient is returned when a user who doesn't seek funding asks for peers
+	ErrNotRecipient = errors.New("only recipients can look for peers")
+
+	// ErrPeersDisabled is returned when the user hasn't opted into peer networking
+	ErrPeersDisabled = errors.New("peer networking is turned off")
+)
+
+// Peer is another recipient in the same field or region, to share knowledge with
+type Peer struct {
+	ID                 int64    `json:"id"`
+	OrganizationName   string   `json:"organization_name"`
+	ProfilePictureURL  *string  `json:"profile_picture_url"`
+	State              string   `json:"state"`
+	City               string   `json:"city"`
+	ApplicantType      string   `json:"applicant_type"`
+	SharedSectors      []string `json:"shared_sectors"`
+	SharedTargetGroups []string `json:"shared_target_groups"`
+	Score              float64  `json:"score"`
+}
+
+// peerScoreSQL scores a candidate peer (p1) for the user (p2) with the sector,
+// target group and geography scorers of matching
+var peerScoreSQL = fmt.Sprintf(`(%s) * %s + (%s) * %s + (%s) * %s`,
+	SectorScorer{}.SQL(), strconv.FormatFloat(PeerSectorWeight, 'f', -1, 64),
+	TargetGroupScorer{}.SQL(), strconv.FormatFloat(PeerTargetGroupWeight, 'f', -1, 64),
+	GeoScorer{}.SQL(), strconv.FormatFloat(PeerGeoWeight, 'f', -1, 64),
+)
+
+// FindPeers returns active recipients sharing a sector with the user or in the
+// same state, best first. Both sides must have opted into peer networking in
+// their match preferences; nobody else is ever suggested or shown as a peer.
+func FindPeers(db *sql.DB, userID int64) ([]Peer, error) {
+	holdsRole, optedIn, err := loadOptIn(db, userID, "recipient", "open_to_peers")
+	if err != nil {
+		return nil, err
+	}
+	if !holdsRole {
+		return nil, ErrNotRecipient
+	}
+	if !optedIn {
+		return nil, ErrPeersDisabled
+	}
+
+	rows, err := db.Query(`
+		SELECT
+			u.id,
+			COALESCE(pr.organization_name, ''),
+			pr.profile_picture_url,
+			COALESCE(p1.state, ''),
+			COALESCE(p1.city, ''),
+			COALESCE(p1.applicant_type, ''),
+			ARRAY(SELECT s FROM UNNEST(p1.sectors) s WHERE s = ANY(p2.sectors) ORDER BY s),
+			ARRAY(SELECT g FROM UNNEST(p1.target_groups) g WHERE g = ANY(p2.target_groups) ORDER BY g),
+			`+peerScoreSQL+` AS score
+		FROM users usr
+		JOIN matching_profiles p2 ON p2.user_id = usr.id
+		JOIN users u ON u.id <> usr.id
+		JOIN matching_profiles p1 ON p1.user_id = u.id
+		JOIN recipient_data rd1 ON rd1.user_id = u.id
+		JOIN match_preferences ex1 ON ex1.user_id = u.id AND ex1.open_to_peers
+		LEFT JOIN profiles pr ON pr.user_id = u.id
+		WHERE usr.id = $1
+			AND (u.role = 'recipient' OR u.dual_role)
+			AND u.status = 'active'
+			AND u.deleted_at IS NULL
+			AND (
+				p1.sectors && p2.sectors
+				OR (COALESCE(p2.state, '') <> '' AND UPPER(p1.state) = UPPER(p2.state))
+			)
+		ORDER BY score DESC, u.id
+		LIMIT $2
+	`, userID, maxPeers)
+	if err != nil {
+		return nil, fmt.Errorf("error querying peers: %v", err)
+	}
+	defer rows.Close()
+
+	peers := []Peer{}
+	for rows.Next() {
+		var p Peer
+		err := rows.Scan(
+			&p.ID,
+			&p.OrganizationName,
+			&p.ProfilePictureURL,
+			&p.State,
+			&p.City,
+			&p.ApplicantType,
+			pq.Array(&p.SharedSectors),
+			pq.Array(&p.SharedTargetGroups),
+			&p.Score,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning peer: %v", err)
+		}
+		peers = append(peers, p)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating peers: %v", err)
+	}
+	return peers, nil
+}
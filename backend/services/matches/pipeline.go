@@ -0,0 +1,453 @@
+package matches
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// MatchProfile holds the fields of a user that take part in matching.
+// Taxonomy values are canonical (synonym-resolved), as in matching_profiles.
+type MatchProfile struct {
+	UserID          int64
+	Role            string // the role the profile was loaded as
+	DualRole        bool   // the user also matches in the opposite role
+	Status          string
+	LastActiveAt    time.Time // last authenticated activity, or account creation
+	Sectors         []string
+	TargetGroups    []string
+	State           string
+	City            string
+	ApplicantType   string
+	FundingType     string          // providers only
+	AmountOffered   sql.NullFloat64 // providers only
+	BudgetRequested sql.NullFloat64 // recipients only
+	AwardMin        sql.NullFloat64 // typical (providers) or acceptable (recipients) award size
+	AwardMax        sql.NullFloat64 // upper bound of the same range
+	AnnualBudget    sql.NullFloat64
+	StaffSize       sql.NullInt64
+	FoundedYear     sql.NullInt64
+	Eligibility     EligibilityBands // providers only
+	HasRoleData     bool             // provider_data or recipient_data exists for the role
+}
+
+// Scorer scores a single dimension of a candidate for a user.
+// Score returns a ratio between 0 and 1; the pipeline applies the weight.
+type Scorer interface {
+	Name() string
+	Score(user, candidate *MatchProfile) float64
+}
+
+// SQLScorer is a Scorer that can also be computed inside the match query.
+// SQL returns an expression evaluating to a ratio between 0 and 1, using the aliases
+// of the fast-path query: u/usr (candidate/user users), p1/p2 (candidate/user
+// matching_profiles), pd1/pd2 (provider_data), rd1/rd2 (recipient_data) and
+// ex1/ex2 (match_preferences).
+type SQLScorer interface {
+	Scorer
+	SQL() string
+}
+
+// WeightedScorer is a Scorer registered in a Pipeline
+type WeightedScorer struct {
+	Scorer
+	Weight float64
+}
+
+// Pipeline combines weighted scorers into a single match score
+type Pipeline struct {
+	scorers       []WeightedScorer
+	activityDecay bool
+	variant       string // experiment variant recorded with stored matches, "" outside experiments
+	MinScore      float64
+}
+
+// DefaultPipeline is the pipeline used to calculate stored matches
+var DefaultPipeline = NewPipeline(MinMatchScore).
+	Register(SectorScorer{}, SectorWeight).
+	Register(TargetGroupScorer{}, TargetGroupWeight).
+	Register(AwardSizeScorer{}, AwardSizeWeight).
+	WithActivityDecay()
+
+// NewPipeline creates an empty pipeline keeping candidates scoring at least minScore
+func NewPipeline(minScore float64) *Pipeline {
+	return &Pipeline{MinScore: minScore}
+}
+
+// Register adds a scorer with the given weight and returns the pipeline for chaining
+func (p *Pipeline) Register(scorer Scorer, weight float64) *Pipeline {
+	p.scorers = append(p.scorers, WeightedScorer{Scorer: scorer, Weight: weight})
+	return p
+}
+
+// WithActivityDecay makes the pipeline multiply scores by the candidate's
+// ActivityFactor, so long-inactive accounts rank lower, and returns it for chaining
+func (p *Pipeline) WithActivityDecay() *Pipeline {
+	p.activityDecay = true
+	return p
+}
+
+// Scorers returns the registered scorers in order
+func (p *Pipeline) Scorers() []WeightedScorer {
+	return p.scorers
+}
+
+// MaxScore is the highest score the pipeline can produce
+func (p *Pipeline) MaxScore() float64 {
+	var max float64
+	for _, s := range p.scorers {
+		max += s.Weight
+	}
+	return max
+}
+
+// Score computes the weighted score of a candidate for a user
+func (p *Pipeline) Score(user, candidate *MatchProfile) float64 {
+	var total float64
+	for _, s := range p.scorers {
+		total += s.Score(user, candidate) * s.Weight
+	}
+	return total * p.activityFactor(candidate, time.Now())
+}
+
+// activityFactor is the candidate's ActivityFactor, or 1 without activity decay
+func (p *Pipeline) activityFactor(candidate *MatchProfile, now time.Time) float64 {
+	if !p.activityDecay {
+		return 1
+	}
+	return ActivityFactor(candidate.LastActiveAt, now)
+}
+
+// sqlExpression returns the weighted score as a single SQL expression, or false
+// when a registered scorer can only be evaluated in Go
+func (p *Pipeline) sqlExpression() (string, bool) {
+	if len(p.scorers) == 0 {
+		return "", false
+	}
+
+	terms := make([]string, 0, len(p.scorers))
+	for _, s := range p.scorers {
+		sqlScorer, ok := s.Scorer.(SQLScorer)
+		if !ok {
+			return "", false
+		}
+		terms = append(terms, fmt.Sprintf(
+			"-- %s\n(%s) * %s",
+			s.Name(), sqlScorer.SQL(), strconv.FormatFloat(s.Weight, 'f', -1, 64),
+		))
+	}
+
+	expr := strings.Join(terms, " +\n")
+	if p.activityDecay {
+		expr = "(" + expr + "\n) * " + activityFactorSQL
+	}
+	return expr, true
+}
+
+// pairJoins joins every user (usr, p2, pd2, rd2, ex2) to every candidate (u, p1,
+// pd1, rd1, ex1). side.provides is whether the candidate acts as the provider of
+// the pair, or null when neither can take the opposite role of the other; only
+// the role data of the side each one acts on is joined.
+const pairJoins = `
+	FROM users u
+	JOIN users usr ON usr.id <> u.id
+	CROSS JOIN LATERAL (SELECT ` + pairSideSQL + ` AS provides) side
+	JOIN matching_profiles p1 ON p1.user_id = u.id
+	JOIN matching_profiles p2 ON p2.user_id = usr.id
+	LEFT JOIN provider_data pd1 ON pd1.user_id = u.id AND side.provides
+	LEFT JOIN recipient_data rd1 ON rd1.user_id = u.id AND NOT side.provides
+	LEFT JOIN provider_data pd2 ON pd2.user_id = usr.id AND NOT side.provides
+	LEFT JOIN recipient_data rd2 ON rd2.user_id = usr.id AND side.provides
+	LEFT JOIN match_preferences ex1 ON ex1.user_id = u.id
+	LEFT JOIN match_preferences ex2 ON ex2.user_id = usr.id
+`
+
+// pairSideSQL decides which of usr and u provides, as pairSide does: the user keeps
+// their primary role when the candidate can take the opposite one, and a
+// dual-role user otherwise takes the role opposite to the candidate's
+const pairSideSQL = `CASE
+		WHEN usr.role = 'recipient' AND (u.role = 'provider' OR u.dual_role) THEN true
+		WHEN usr.role = 'provider' AND (u.role = 'recipient' OR u.dual_role) THEN false
+		WHEN usr.dual_role THEN u.role = 'provider'
+	END`
+
+// ConnectionPartiesSQL joins the provider (pu) and recipient (ru) of
+// connection c. Sides are decided by pairSideSQL with the initiator as the
+// user, so a dual-role user can be either side; a connection between users
+// who cannot be paired joins no rows.
+const ConnectionPartiesSQL = `
+		JOIN users usr ON usr.id = c.initiator_id
+		JOIN users u ON u.id = c.target_id
+		CROSS JOIN LATERAL (SELECT ` + pairSideSQL + ` AS provides) side
+		JOIN users pu ON side.provides IS NOT NULL AND pu.id = CASE WHEN side.provides THEN u.id ELSE usr.id END
+		JOIN users ru ON side.provides IS NOT NULL AND ru.id = CASE WHEN side.provides THEN usr.id ELSE u.id END
+`
+
+// pairSide returns the roles user and candidate act in when matched, or false
+// when neither can take the opposite role of the other
+func pairSide(user, candidate *MatchProfile) (userRole, candidateRole string, ok bool) {
+	opposite := map[string]string{"provider": "recipient", "recipient": "provider"}
+	switch {
+	case candidate.Role == opposite[user.Role] || candidate.DualRole:
+		return user.Role, opposite[user.Role], true
+	case user.DualRole:
+		return opposite[candidate.Role], candidate.Role, true
+	}
+	return "", "", false
+}
+
+// CanPair reports whether two users can be paired as a provider and a
+// recipient, whichever of them is the user. A dual-role user can take
+// either side.
+func CanPair(user, candidate *MatchProfile) bool {
+	_, _, ok := pairSide(user, candidate)
+	return ok
+}
+
+// awardRangeFilter drops provider and recipient pairs whose declared award ranges
+// do not overlap; undeclared bounds never filter
+const awardRangeFilter = `NOT COALESCE(
+		COALESCE(pd1.award_max, pd2.award_max) < COALESCE(rd1.award_min, rd2.award_min)
+		OR COALESCE(pd1.award_min, pd2.award_min) > COALESCE(rd1.award_max, rd2.award_max),
+		false
+	)`
+
+// pairFilter keeps active candidates acting in the opposite role with role data for it who share a
+// sector or target group with the user, are not dismissed by or connected to them,
+// have overlapping award ranges, where the recipient is within the provider's
+// eligibility bands, and are not excluded by the user's preferences
+// nor exclude the user by theirs
+var pairFilter = `
+	side.provides IS NOT NULL
+	AND u.status = 'active'
+	AND (
+		(side.provides AND pd1.id IS NOT NULL)
+		OR (NOT side.provides AND rd1.id IS NOT NULL)
+	)
+	AND NOT EXISTS (
+		SELECT 1 FROM dismissed_matches dm
+		WHERE dm.user_id = usr.id AND dm.match_id = u.id
+	)
+	AND NOT EXISTS (
+		SELECT 1 FROM connections c
+		WHERE (c.initiator_id = usr.id AND c.target_id = u.id)
+		   OR (c.initiator_id = u.id AND c.target_id = usr.id)
+	)
+	AND (p1.sectors && p2.sectors OR p1.target_groups && p2.target_groups)
+	AND ` + awardRangeFilter + `
+	AND ` + fmt.Sprintf(eligibilityFilter, "pd2", "p1") + `
+	AND ` + fmt.Sprintf(eligibilityFilter, "pd1", "p2") + `
+	AND ` + fmt.Sprintf(exclusionFilter, "ex2", "p1", "pd1") + `
+	AND ` + fmt.Sprintf(exclusionFilter, "ex1", "p2", "pd2") + `
+`
+
+// selectProfileQuery loads MatchProfile fields as role $2, or as the user's
+// primary role when it is empty; callers append a WHERE clause on u using $1
+const selectProfileQuery = `
+	SELECT
+		u.id,
+		side.role,
+		u.dual_role,
+		u.status,
+		COALESCE(u.last_active_at, u.created_at, CURRENT_TIMESTAMP),
+		COALESCE(mp.sectors, '{}'),
+		COALESCE(mp.target_groups, '{}'),
+		COALESCE(mp.state, ''),
+		COALESCE(mp.city, ''),
+		COALESCE(mp.applicant_type, ''),
+		COALESCE(pd.funding_type, ''),
+		pd.amount_offered,
+		rd.budget_requested,
+		COALESCE(pd.award_min, rd.award_min),
+		COALESCE(pd.award_max, rd.award_max),
+		mp.annual_budget,
+		mp.staff_size,
+		mp.founded_year,
+		pd.eligible_budget_min,
+		pd.eligible_budget_max,
+		pd.eligible_staff_min,
+		pd.eligible_staff_max,
+		pd.eligible_min_age_years,
+		pd.eligible_max_age_years,
+		COALESCE(pd.id, rd.id) IS NOT NULL
+	FROM users u
+	CROSS JOIN LATERAL (SELECT COALESCE(NULLIF($2, ''), u.role) AS role) side
+	LEFT JOIN matching_profiles mp ON mp.user_id = u.id
+	LEFT JOIN provider_data pd ON pd.user_id = u.id AND side.role = 'provider'
+	LEFT JOIN recipient_data rd ON rd.user_id = u.id AND side.role = 'recipient'
+`
+
+// upsertMatchClause replaces the score of a pair stored before, keeping when
+// it was first matched in created_at
+const upsertMatchClause = `
+	ON CONFLICT (user_id, match_id) DO UPDATE SET
+		match_score = EXCLUDED.match_score,
+		variant = EXCLUDED.variant,
+		as_role = EXCLUDED.as_role,
+		calculated_at = CURRENT_TIMESTAMP
+`
+
+// storeMatches scores the pairs selected by cond, a condition on usr and u using
+// args, into matches, replacing the stored score of pairs already there. The SQL fast path is used when every scorer has a SQL
+// form; otherwise pairs are scored in Go.
+func (p *Pipeline) storeMatches(ctx context.Context, tx *sql.Tx, cond string, args ...interface{}) error {
+	return p.scoreInto(ctx, tx, "matches", cond, args...)
+}
+
+// scoreInto is storeMatches writing to table, which has the columns and primary key of matches
+func (p *Pipeline) scoreInto(ctx context.Context, tx *sql.Tx, table, cond string, args ...interface{}) error {
+	if expr, ok := p.sqlExpression(); ok {
+		query := `
+			INSERT INTO ` + table + ` (user_id, match_id, match_score, variant, as_role)
+			SELECT user_id, match_id, match_score, NULLIF($` + strconv.Itoa(len(args)+2) + `, ''), as_role
+			FROM (
+				SELECT usr.id AS user_id, u.id AS match_id, (` + expr + `) AS match_score,
+					CASE WHEN side.provides THEN 'recipient' ELSE 'provider' END AS as_role
+				` + pairJoins + `
+				WHERE ` + pairFilter + ` AND ` + cond + `
+			) scored
+			WHERE match_score >= $` + strconv.Itoa(len(args)+1) + `
+		` + upsertMatchClause
+		if _, err := tx.ExecContext(ctx, query, append(args, p.MinScore, p.variant)...); err != nil {
+			return fmt.Errorf("error calculating matches: %v", err)
+		}
+		return nil
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT usr.id, u.id, side.provides
+		`+pairJoins+`
+		WHERE `+pairFilter+` AND `+cond, args...)
+	if err != nil {
+		return fmt.Errorf("error querying match candidates: %v", err)
+	}
+
+	type candidatePair struct {
+		userID, candidateID int64
+		provides            bool // whether the candidate is the provider
+	}
+	var pairs []candidatePair
+	for rows.Next() {
+		var pair candidatePair
+		if err := rows.Scan(&pair.userID, &pair.candidateID, &pair.provides); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning match candidate: %v", err)
+		}
+		pairs = append(pairs, pair)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("error iterating match candidates: %v", err)
+	}
+
+	// Dual-role users have a profile for each role they act in
+	type profileKey struct {
+		id   int64
+		role string
+	}
+	profiles := make(map[profileKey]*MatchProfile)
+	load := func(id int64, role string) (*MatchProfile, error) {
+		key := profileKey{id, role}
+		if profiles[key] == nil {
+			profile, err := loadMatchProfileAs(tx, id, role)
+			if err != nil {
+				return nil, err
+			}
+			profiles[key] = profile
+		}
+		return profiles[key], nil
+	}
+	for _, pair := range pairs {
+		userRole, candidateRole := "provider", "recipient"
+		if pair.provides {
+			userRole, candidateRole = candidateRole, userRole
+		}
+		user, err := load(pair.userID, userRole)
+		if err != nil {
+			return err
+		}
+		candidate, err := load(pair.candidateID, candidateRole)
+		if err != nil {
+			return err
+		}
+
+		score := p.Score(user, candidate)
+		if score < p.MinScore {
+			continue
+		}
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO `+table+` (user_id, match_id, match_score, variant, as_role)
+			VALUES ($1, $2, $3, NULLIF($4, ''), $5)
+		`+upsertMatchClause, pair.userID, pair.candidateID, score, p.variant, userRole)
+		if err != nil {
+			return fmt.Errorf("error storing match: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// queryRower is satisfied by both *sql.DB and *sql.Tx
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// loadMatchProfile fetches the matching-related fields for a user in their
+// primary role
+func loadMatchProfile(q queryRower, userID int64) (*MatchProfile, error) {
+	return loadMatchProfileAs(q, userID, "")
+}
+
+// loadMatchProfileAs fetches the matching-related fields for a user acting in
+// role, with the provider_data or recipient_data of that role only
+func loadMatchProfileAs(q queryRower, userID int64, role string) (*MatchProfile, error) {
+	profile, err := scanMatchProfile(q.QueryRow(selectProfileQuery+`WHERE u.id = $1`, userID, role))
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	return profile, err
+}
+
+// scanMatchProfile scans a row produced by selectProfileQuery
+func scanMatchProfile(row interface{ Scan(...interface{}) error }) (*MatchProfile, error) {
+	profile := &MatchProfile{}
+	err := row.Scan(
+		&profile.UserID,
+		&profile.Role,
+		&profile.DualRole,
+		&profile.Status,
+		&profile.LastActiveAt,
+		pq.Array(&profile.Sectors),
+		pq.Array(&profile.TargetGroups),
+		&profile.State,
+		&profile.City,
+		&profile.ApplicantType,
+		&profile.FundingType,
+		&profile.AmountOffered,
+		&profile.BudgetRequested,
+		&profile.AwardMin,
+		&profile.AwardMax,
+		&profile.AnnualBudget,
+		&profile.StaffSize,
+		&profile.FoundedYear,
+		&profile.Eligibility.BudgetMin,
+		&profile.Eligibility.BudgetMax,
+		&profile.Eligibility.StaffMin,
+		&profile.Eligibility.StaffMax,
+		&profile.Eligibility.MinAgeYears,
+		&profile.Eligibility.MaxAgeYears,
+		&profile.HasRoleData,
+	)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error scanning match profile: %v", err)
+	}
+	return profile, nil
+}
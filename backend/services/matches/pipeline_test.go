@@ -0,0 +1,115 @@
+package matches
+
+import (
+	"database/sql"
+	"math"
+	"testing"
+	"time"
+)
+
+// emptyProvider and emptyRecipient have no sectors, target groups or amounts
+func emptyProvider() *MatchProfile {
+	return &MatchProfile{UserID: 1, Role: "provider", LastActiveAt: time.Now()}
+}
+
+func emptyRecipient() *MatchProfile {
+	return &MatchProfile{UserID: 2, Role: "recipient", LastActiveAt: time.Now()}
+}
+
+func TestScorersWithoutData(t *testing.T) {
+	health := []string{"Health"}
+	amount := sql.NullFloat64{Float64: 50000, Valid: true}
+
+	tests := []struct {
+		name      string
+		user      *MatchProfile
+		candidate *MatchProfile
+	}{
+		{"nothing on either side", emptyProvider(), emptyRecipient()},
+		{"nothing on either side, as recipient", emptyRecipient(), emptyProvider()},
+		{"user without lists or budget", emptyRecipient(), &MatchProfile{Role: "provider", Sectors: health, TargetGroups: health, AmountOffered: amount}},
+		{"candidate without lists or budget", &MatchProfile{Role: "provider", Sectors: health, TargetGroups: health, AmountOffered: amount}, emptyRecipient()},
+		{"empty, not nil, lists", &MatchProfile{Role: "provider", Sectors: []string{}, TargetGroups: []string{}}, &MatchProfile{Role: "recipient", Sectors: []string{}, TargetGroups: []string{}}},
+	}
+	scorers := []Scorer{SectorScorer{}, TargetGroupScorer{}, AwardSizeScorer{}, BudgetScorer{}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, s := range scorers {
+				if got := s.Score(tt.user, tt.candidate); got != 0 {
+					t.Errorf("%s score = %v, want 0", s.Name(), got)
+				}
+			}
+		})
+	}
+}
+
+func TestBudgetScorerZeroBudget(t *testing.T) {
+	provider := emptyProvider()
+	provider.AmountOffered = sql.NullFloat64{Float64: 50000, Valid: true}
+	recipient := emptyRecipient()
+	recipient.BudgetRequested = sql.NullFloat64{Float64: 0, Valid: true}
+
+	if got := (BudgetScorer{}).Score(provider, recipient); got != 0 {
+		t.Errorf("score against a zero budget = %v, want 0", got)
+	}
+}
+
+func TestPipelineScoreWithoutData(t *testing.T) {
+	for _, pair := range [][2]*MatchProfile{
+		{emptyProvider(), emptyRecipient()},
+		{emptyRecipient(), emptyProvider()},
+	} {
+		raw := DefaultPipeline.Score(pair[0], pair[1])
+		if raw != 0 {
+			t.Errorf("%s score = %v, want 0", pair[0].Role, raw)
+		}
+		if got := NormalizeScore(raw); got != 0 {
+			t.Errorf("%s normalized score = %v, want 0", pair[0].Role, got)
+		}
+		if got := NewCalibration(nil).Score(raw); got != 0 {
+			t.Errorf("%s calibrated score = %v, want 0", pair[0].Role, got)
+		}
+	}
+
+	// A candidate who was never active decays, but doesn't break the score
+	candidate := emptyRecipient()
+	candidate.LastActiveAt = time.Time{}
+	if got := DefaultPipeline.Score(emptyProvider(), candidate); got != 0 {
+		t.Errorf("score of a never active candidate = %v, want 0", got)
+	}
+}
+
+func TestNormalizeScoreRange(t *testing.T) {
+	maxScore := DefaultPipeline.MaxScore()
+	tests := []struct {
+		raw  float64
+		want float64
+	}{
+		{math.NaN(), 0},
+		{math.Inf(-1), 0},
+		{-5, 0},
+		{0, 0},
+		{maxScore / 2, 50},
+		{maxScore, 100},
+		{maxScore * 2, 100},
+		{math.Inf(1), 100},
+	}
+	for _, tt := range tests {
+		if got := NormalizeScore(tt.raw); got != tt.want {
+			t.Errorf("NormalizeScore(%v) = %v, want %v", tt.raw, got, tt.want)
+		}
+	}
+
+	// Calibrated scores stay within 0-100 too, for any raw score
+	population := make([]float64, MinCalibrationSize)
+	for i := range population {
+		population[i] = float64(i)
+	}
+	population = append(population, math.NaN(), math.Inf(1))
+	c := NewCalibration(population)
+	for _, raw := range []float64{math.NaN(), math.Inf(-1), -1, 0, 10, maxScore, math.Inf(1)} {
+		if got := c.Score(raw); math.IsNaN(got) || got < 0 || got > 100 {
+			t.Errorf("calibrated Score(%v) = %v, want 0-100", raw, got)
+		}
+	}
+}
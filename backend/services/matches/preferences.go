@@ -0,0 +1,166 @@
+package matches
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// MaxExclusions caps each list of excluded values
+const MaxExclusions = 50
+
+// Preferences are values a user never wants to be matched with. They apply in
+// both directions: a pair is skipped when either side excludes the other.
+// OpenToCofunding lets a provider find, and be found by, other providers as a
+// co-funding partner; OpenToPeers does the same for recipients and their peers.
+type Preferences struct {
+	ExcludedSectors        []string `json:"excluded_sectors"`
+	ExcludedStates         []string `json:"excluded_states"`
+	ExcludedApplicantTypes []string `json:"excluded_applicant_types"`
+	ExcludedFundingTypes   []string `json:"excluded_funding_types"`
+	OpenToCofunding        bool     `json:"open_to_cofunding"`
+	OpenToPeers            bool     `json:"open_to_peers"`
+}
+
+// exclusionFilter is a pair condition that is true when the preferences %[1]s
+// exclude the profile %[2]s with provider data %[3]s. Sectors are compared in
+// canonical form, states upper case and types lower case, as stored.
+const exclusionFilter = `NOT COALESCE(
+		%[1]s.excluded_sectors && %[2]s.sectors
+		OR UPPER(%[2]s.state) = ANY(%[1]s.excluded_states)
+		OR LOWER(%[2]s.applicant_type) = ANY(%[1]s.excluded_applicant_types)
+		OR LOWER(%[3]s.funding_type) = ANY(%[1]s.excluded_funding_types),
+		false
+	)`
+
+// LoadPreferences returns the user's match preferences; users without any get
+// empty lists
+func LoadPreferences(db *sql.DB, userID int64) (*Preferences, error) {
+	prefs := &Preferences{}
+	err := db.QueryRow(`
+		SELECT excluded_sectors, excluded_states, excluded_applicant_types, excluded_funding_types,
+			open_to_cofunding, open_to_peers
+		FROM match_preferences
+		WHERE user_id = $1
+	`, userID).Scan(
+		pq.Array(&prefs.ExcludedSectors),
+		pq.Array(&prefs.ExcludedStates),
+		pq.Array(&prefs.ExcludedApplicantTypes),
+		pq.Array(&prefs.ExcludedFundingTypes),
+		&prefs.OpenToCofunding,
+		&prefs.OpenToPeers,
+	)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("error loading match preferences: %v", err)
+	}
+	prefs.normalize()
+	return prefs, nil
+}
+
+// SavePreferences replaces the user's match preferences and returns them as
+// stored, with sectors resolved to their canonical names. Callers should then
+// queue an update of the user's matches with QueueUpdate.
+func SavePreferences(db *sql.DB, userID int64, prefs Preferences) (*Preferences, error) {
+	if err := prefs.Validate(); err != nil {
+		return nil, err
+	}
+
+	saved := &Preferences{}
+	err := db.QueryRow(`
+		INSERT INTO match_preferences (
+			user_id, excluded_sectors, excluded_states,
+			excluded_applicant_types, excluded_funding_types, open_to_cofunding, open_to_peers
+		) VALUES ($1, canonical_taxonomy_terms($2), $3, $4, $5, $6, $7)
+		ON CONFLICT (user_id) DO UPDATE
+		SET excluded_sectors = EXCLUDED.excluded_sectors,
+			excluded_states = EXCLUDED.excluded_states,
+			excluded_applicant_types = EXCLUDED.excluded_applicant_types,
+			excluded_funding_types = EXCLUDED.excluded_funding_types,
+			open_to_cofunding = EXCLUDED.open_to_cofunding,
+			open_to_peers = EXCLUDED.open_to_peers,
+			updated_at = CURRENT_TIMESTAMP
+		RETURNING excluded_sectors, excluded_states, excluded_applicant_types, excluded_funding_types,
+			open_to_cofunding, open_to_peers
+	`, userID,
+		pq.Array(prefs.ExcludedSectors),
+		pq.Array(prefs.ExcludedStates),
+		pq.Array(prefs.ExcludedApplicantTypes),
+		pq.Array(prefs.ExcludedFundingTypes),
+		prefs.OpenToCofunding,
+		prefs.OpenToPeers,
+	).Scan(
+		pq.Array(&saved.ExcludedSectors),
+		pq.Array(&saved.ExcludedStates),
+		pq.Array(&saved.ExcludedApplicantTypes),
+		pq.Array(&saved.ExcludedFundingTypes),
+		&saved.OpenToCofunding,
+		&saved.OpenToPeers,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error saving match preferences: %v", err)
+	}
+	saved.normalize()
+	return saved, nil
+}
+
+// Validate normalizes the preferences and checks the size of each list
+func (p *Preferences) Validate() error {
+	p.normalize()
+	for _, list := range []struct {
+		name   string
+		values []string
+	}{
+		{"excluded_sectors", p.ExcludedSectors},
+		{"excluded_states", p.ExcludedStates},
+		{"excluded_applicant_types", p.ExcludedApplicantTypes},
+		{"excluded_funding_types", p.ExcludedFundingTypes},
+	} {
+		if len(list.values) > MaxExclusions {
+			return fmt.Errorf("%s: at most %d values are allowed", list.name, MaxExclusions)
+		}
+	}
+	return nil
+}
+
+// normalize trims and de-duplicates the lists and brings them into the case
+// exclusionFilter compares in
+func (p *Preferences) normalize() {
+	p.ExcludedSectors = cleanValues(p.ExcludedSectors, strings.TrimSpace)
+	p.ExcludedStates = cleanValues(p.ExcludedStates, strings.ToUpper)
+	p.ExcludedApplicantTypes = cleanValues(p.ExcludedApplicantTypes, strings.ToLower)
+	p.ExcludedFundingTypes = cleanValues(p.ExcludedFundingTypes, strings.ToLower)
+}
+
+// excludes returns the reasons the preferences exclude profile, if any
+func (p *Preferences) excludes(profile *MatchProfile) []string {
+	var reasons []string
+	if shared := overlap(p.ExcludedSectors, profile.Sectors); len(shared) > 0 {
+		reasons = append(reasons, "sector "+strings.Join(shared, ", "))
+	}
+	if profile.State != "" && slices.Contains(p.ExcludedStates, strings.ToUpper(profile.State)) {
+		reasons = append(reasons, "state "+profile.State)
+	}
+	if profile.ApplicantType != "" && slices.Contains(p.ExcludedApplicantTypes, strings.ToLower(profile.ApplicantType)) {
+		reasons = append(reasons, "applicant type "+profile.ApplicantType)
+	}
+	if profile.FundingType != "" && slices.Contains(p.ExcludedFundingTypes, strings.ToLower(profile.FundingType)) {
+		reasons = append(reasons, "funding type "+profile.FundingType)
+	}
+	return reasons
+}
+
+// cleanValues applies transform to each trimmed value, dropping empty values and
+// duplicates; the result is never nil
+func cleanValues(values []string, transform func(string) string) []string {
+	cleaned := []string{}
+	for _, v := range values {
+		v = transform(strings.TrimSpace(v))
+		if v != "" && !slices.Contains(cleaned, v) {
+			cleaned = append(cleaned, v)
+		}
+	}
+	return cleaned
+}
@@ -0,0 +1,197 @@
+package matches
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// overlapSQL is the share of the user's values (p2) found in the candidate's (p1)
+const overlapSQL = `COALESCE(
+	(SELECT COUNT(*) FROM UNNEST(p1.%[1]s) v WHERE v = ANY(p2.%[1]s))::float /
+	NULLIF(cardinality(p2.%[1]s), 0),
+	0
+)`
+
+// valueScorer is implemented by scorers comparing lists of taxonomy values
+type valueScorer interface {
+	values(p *MatchProfile) []string
+}
+
+// SectorScorer scores the share of the user's sectors the candidate also works in
+type SectorScorer struct{}
+
+func (SectorScorer) Name() string { return "sectors" }
+
+func (SectorScorer) Score(user, candidate *MatchProfile) float64 {
+	return overlapRatio(user.Sectors, candidate.Sectors)
+}
+
+func (SectorScorer) SQL() string { return fmt.Sprintf(overlapSQL, "sectors") }
+
+func (SectorScorer) values(p *MatchProfile) []string { return p.Sectors }
+
+// TargetGroupScorer scores the share of the user's target groups the candidate also serves
+type TargetGroupScorer struct{}
+
+func (TargetGroupScorer) Name() string { return "target_groups" }
+
+func (TargetGroupScorer) Score(user, candidate *MatchProfile) float64 {
+	return overlapRatio(user.TargetGroups, candidate.TargetGroups)
+}
+
+func (TargetGroupScorer) SQL() string { return fmt.Sprintf(overlapSQL, "target_groups") }
+
+func (TargetGroupScorer) values(p *MatchProfile) []string { return p.TargetGroups }
+
+// GeoScorer rewards candidates in the same city (1) or state (0.5) as the user
+type GeoScorer struct{}
+
+func (GeoScorer) Name() string { return "geo" }
+
+func (GeoScorer) Score(user, candidate *MatchProfile) float64 {
+	if user.State == "" || !strings.EqualFold(user.State, candidate.State) {
+		return 0
+	}
+	if user.City != "" && strings.EqualFold(user.City, candidate.City) {
+		return 1
+	}
+	return 0.5
+}
+
+func (GeoScorer) SQL() string {
+	return `CASE
+		WHEN COALESCE(p2.state, '') = '' OR UPPER(p1.state) IS DISTINCT FROM UPPER(p2.state) THEN 0
+		WHEN COALESCE(p2.city, '') <> '' AND LOWER(p1.city) = LOWER(p2.city) THEN 1
+		ELSE 0.5
+	END`
+}
+
+// BudgetScorer scores how much of the recipient's requested budget the provider's
+// offered amount covers, capped at 1
+type BudgetScorer struct{}
+
+func (BudgetScorer) Name() string { return "budget" }
+
+func (BudgetScorer) Score(user, candidate *MatchProfile) float64 {
+	provider, recipient := user, candidate
+	if user.Role == "recipient" {
+		provider, recipient = candidate, user
+	}
+	if !provider.AmountOffered.Valid || !recipient.BudgetRequested.Valid || recipient.BudgetRequested.Float64 <= 0 {
+		return 0
+	}
+	return math.Min(provider.AmountOffered.Float64/recipient.BudgetRequested.Float64, 1)
+}
+
+func (BudgetScorer) SQL() string {
+	return `COALESCE(LEAST(
+		COALESCE(pd1.amount_offered, pd2.amount_offered)::float /
+		NULLIF(COALESCE(rd1.budget_requested, rd2.budget_requested), 0)::float,
+		1
+	), 0)`
+}
+
+// AwardSizeScorer scores how much of the recipient's acceptable award range the
+// provider's typical award range covers. Unset bounds fall back to the provider's
+// amount offered (upper bound, lower bound 0) and the recipient's requested
+// budget; without both ranges the score is 0.
+type AwardSizeScorer struct{}
+
+func (AwardSizeScorer) Name() string { return "award_size" }
+
+func (AwardSizeScorer) Score(user, candidate *MatchProfile) float64 {
+	provider, recipient := user, candidate
+	if user.Role == "recipient" {
+		provider, recipient = candidate, user
+	}
+
+	providerMin := provider.AwardMin
+	if !providerMin.Valid {
+		providerMin = sql.NullFloat64{Float64: 0, Valid: true}
+	}
+	providerMax := provider.AwardMax
+	if !providerMax.Valid {
+		providerMax = provider.AmountOffered
+	}
+	recipientMin, recipientMax := recipient.AwardMin, recipient.AwardMax
+	if !recipientMin.Valid {
+		recipientMin = recipient.BudgetRequested
+	}
+	if !recipientMax.Valid {
+		recipientMax = recipient.BudgetRequested
+	}
+	if !providerMax.Valid || !recipientMin.Valid || !recipientMax.Valid {
+		return 0
+	}
+
+	covered := math.Min(providerMax.Float64, recipientMax.Float64) - math.Max(providerMin.Float64, recipientMin.Float64)
+	width := recipientMax.Float64 - recipientMin.Float64
+	switch {
+	case covered < 0:
+		return 0
+	case width <= 0:
+		return 1
+	default:
+		return math.Min(covered/width, 1)
+	}
+}
+
+func (AwardSizeScorer) SQL() string {
+	return `COALESCE((
+		SELECT CASE
+			WHEN LEAST(pmax, rmax) - GREATEST(pmin, rmin) < 0 THEN 0
+			WHEN rmax - rmin <= 0 THEN 1
+			ELSE LEAST((LEAST(pmax, rmax) - GREATEST(pmin, rmin)) / (rmax - rmin), 1)
+		END
+		FROM (SELECT
+			COALESCE(pd1.award_min, pd2.award_min, 0)::float AS pmin,
+			COALESCE(pd1.award_max, pd2.award_max, pd1.amount_offered, pd2.amount_offered)::float AS pmax,
+			COALESCE(rd1.award_min, rd2.award_min, rd1.budget_requested, rd2.budget_requested)::float AS rmin,
+			COALESCE(rd1.award_max, rd2.award_max, rd1.budget_requested, rd2.budget_requested)::float AS rmax
+		) ranges
+	), 0)`
+}
+
+// awardRangesOverlap reports whether the declared award ranges of a provider and
+// recipient pair overlap; pairs where either side declared nothing pass. It
+// mirrors awardRangeFilter.
+func awardRangesOverlap(user, candidate *MatchProfile) bool {
+	provider, recipient := user, candidate
+	if user.Role == "recipient" {
+		provider, recipient = candidate, user
+	}
+	if provider.AwardMax.Valid && recipient.AwardMin.Valid && provider.AwardMax.Float64 < recipient.AwardMin.Float64 {
+		return false
+	}
+	if provider.AwardMin.Valid && recipient.AwardMax.Valid && provider.AwardMin.Float64 > recipient.AwardMax.Float64 {
+		return false
+	}
+	return true
+}
+
+// overlapRatio counts candidate values found in the user's values, relative to
+// the number of user values, exactly like overlapSQL
+func overlapRatio(userValues, candidateValues []string) float64 {
+	if len(userValues) == 0 {
+		return 0
+	}
+	return float64(len(overlap(userValues, candidateValues))) / float64(len(userValues))
+}
+
+// overlap returns the candidate values that also appear in the user's values
+func overlap(userValues, candidateValues []string) []string {
+	lookup := make(map[string]bool, len(userValues))
+	for _, v := range userValues {
+		lookup[v] = true
+	}
+
+	shared := []string{}
+	for _, v := range candidateValues {
+		if lookup[v] {
+			shared = append(shared, v)
+		}
+	}
+	return shared
+}
@@ -0,0 +1,123 @@
+package matches
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+
+	"matcherator/backend/services/experiments"
+)
+
+// storeShadowDiff scores the user's list with the running shadow run's config,
+// if any, and records how it differs from the list just stored. The candidate
+// list lives in a temporary table dropped at commit, so users never see it.
+// Failures are logged and rolled back without failing the recalculation.
+func storeShadowDiff(ctx context.Context, tx *sql.Tx, userID int64) {
+	run, err := experiments.RunningShadow(tx)
+	if err != nil {
+		log.Printf("Error loading shadow run: %v", err)
+		return
+	}
+	if run == nil {
+		return
+	}
+
+	pipeline, err := PipelineFor("", run.Config)
+	if err != nil {
+		log.Printf("Error building pipeline of shadow run %d: %v", run.ID, err)
+		return
+	}
+
+	if _, err := tx.ExecContext(ctx, "SAVEPOINT shadow"); err != nil {
+		log.Printf("Error starting shadow scoring: %v", err)
+		return
+	}
+	if err := scoreShadow(ctx, tx, pipeline, run.ID, userID); err != nil {
+		log.Printf("Error scoring shadow run %d for user %d: %v", run.ID, userID, err)
+		if _, err := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT shadow"); err != nil {
+			log.Printf("Error rolling back shadow scoring: %v", err)
+		}
+		return
+	}
+	if _, err := tx.ExecContext(ctx, "RELEASE SAVEPOINT shadow"); err != nil {
+		log.Printf("Error finishing shadow scoring: %v", err)
+	}
+}
+
+// scoreShadow stores the user's candidate list in shadow_matches and records the diff
+func scoreShadow(ctx context.Context, tx *sql.Tx, pipeline *Pipeline, runID int, userID int64) error {
+	_, err := tx.ExecContext(ctx, `
+		CREATE TEMPORARY TABLE IF NOT EXISTS shadow_matches (LIKE matches INCLUDING DEFAULTS INCLUDING INDEXES) ON COMMIT DROP
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating shadow table: %v", err)
+	}
+	if _, err = tx.ExecContext(ctx, "DELETE FROM shadow_matches"); err != nil {
+		return fmt.Errorf("error clearing shadow table: %v", err)
+	}
+
+	if err = pipeline.scoreInto(ctx, tx, "shadow_matches", "usr.id = $1", userID); err != nil {
+		return err
+	}
+	return recordShadowDiff(ctx, tx, runID, userID, "shadow_matches")
+}
+
+// recordShadowDiff stores how the user's candidate list, in table, differs
+// from their stored list, replacing their previous diff
+func recordShadowDiff(ctx context.Context, tx *sql.Tx, runID int, userID int64, table string) error {
+	_, err := tx.ExecContext(ctx, `
+		WITH stored AS (
+			SELECT match_id, match_score, ROW_NUMBER() OVER (ORDER BY match_score DESC, match_id) AS rank
+			FROM matches WHERE user_id = $2
+		),
+		candidate AS (
+			SELECT match_id, match_score, ROW_NUMBER() OVER (ORDER BY match_score DESC, match_id) AS rank
+			FROM `+table+` WHERE user_id = $2
+		),
+		pairs AS (
+			SELECT
+				COALESCE(c.match_id, n.match_id) AS match_id,
+				c.rank AS current_rank, n.rank AS candidate_rank,
+				c.match_score AS current_score, n.match_score AS candidate_score
+			FROM stored c
+			FULL JOIN candidate n ON n.match_id = c.match_id
+		)
+		INSERT INTO shadow_diffs (
+			shadow_id, user_id, current_matches, candidate_matches,
+			new_matches, lost_matches, moved_matches, mean_rank_shift, top_overlap, changes
+		)
+		SELECT
+			$1, $2,
+			COUNT(current_rank),
+			COUNT(candidate_rank),
+			COUNT(*) FILTER (WHERE current_rank IS NULL),
+			COUNT(*) FILTER (WHERE candidate_rank IS NULL),
+			COUNT(*) FILTER (WHERE current_rank <> candidate_rank),
+			COALESCE(AVG(ABS(current_rank - candidate_rank)), 0),
+			COUNT(*) FILTER (WHERE current_rank <= $3 AND candidate_rank <= $3),
+			COALESCE(jsonb_agg(jsonb_build_object(
+				'match_id', match_id,
+				'current_rank', current_rank,
+				'candidate_rank', candidate_rank,
+				'current_score', current_score,
+				'candidate_score', candidate_score
+			) ORDER BY LEAST(current_rank, candidate_rank), match_id)
+			FILTER (WHERE current_rank IS DISTINCT FROM candidate_rank), '[]')
+		FROM pairs
+		ON CONFLICT (shadow_id, user_id) DO UPDATE SET
+			current_matches = EXCLUDED.current_matches,
+			candidate_matches = EXCLUDED.candidate_matches,
+			new_matches = EXCLUDED.new_matches,
+			lost_matches = EXCLUDED.lost_matches,
+			moved_matches = EXCLUDED.moved_matches,
+			mean_rank_shift = EXCLUDED.mean_rank_shift,
+			top_overlap = EXCLUDED.top_overlap,
+			changes = EXCLUDED.changes,
+			calculated_at = CURRENT_TIMESTAMP
+	`, runID, userID, experiments.TopRanks)
+	if err != nil {
+		return fmt.Errorf("error recording shadow diff: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package moderation
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Content types of moderation flags
+const (
+	ContentProfile = "profile" // content_id is the user ID
+	ContentFAQ     = "faq"     // content_id is the provider_faqs ID
+)
+
+// Flag statuses. Dismissed flags left the content as is; removed ones took
+// it down.
+const (
+	StatusPending   = "pending"
+	StatusDismissed = "dismissed"
+	StatusRemoved   = "removed"
+)
+
+var (
+	// ErrNotFound is returned when no flag has the given ID
+	ErrNotFound = errors.New("moderation flag not found")
+	// ErrReviewed is returned when reviewing a flag that is no longer pending
+	ErrReviewed = errors.New("moderation flag was already reviewed")
+)
+
+// ReviewFlag is flagged content awaiting, or after, admin review
+type ReviewFlag struct {
+	ID          int        `json:"id"`
+	UserID      int        `json:"user_id"`
+	ContentType string     `json:"content_type"`
+	ContentID   int        `json:"content_id"`
+	Field       string     `json:"field"`
+	Excerpt     string     `json:"excerpt"`
+	Reason      string     `json:"reason"`
+	Status      string     `json:"status"`
+	ReviewedBy  *int       `json:"reviewed_by"`
+	ReviewNote  *string    `json:"review_note"`
+	ReviewedAt  *time.Time `json:"reviewed_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// maxExcerpt caps the content stored with a flag
+const maxExcerpt = 500
+
+// Querier runs statements on a database or in a transaction
+type Querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// Record replaces the pending flags on the fields of a piece of content with
+// the result's flagged findings, so saving content that passes clears them.
+// Text an admin already dismissed is not flagged again.
+func Record(q Querier, userID int, contentType string, contentID int, fields []Field, result Result) error {
+	names := make([]string, 0, len(fields))
+	texts := make(map[string]string, len(fields))
+	for _, field := range fields {
+		names = append(names, field.Name)
+		texts[field.Name] = field.Text
+	}
+
+	if _, err := q.Exec(`
+		DELETE FROM moderation_flags
+		WHERE content_type = $1 AND content_id = $2 AND field = ANY($3) AND status = 'pending'
+	`, contentType, contentID, pq.Array(names)); err != nil {
+		return fmt.Errorf("error clearing moderation flags: %v", err)
+	}
+
+	for _, finding := range result.Findings {
+		if finding.Verdict != Flag {
+			continue
+		}
+		if _, err := q.Exec(`
+			INSERT INTO moderation_flags (user_id, content_type, content_id, field, excerpt, reason)
+			SELECT $1, $2, $3, $4, $5, $6
+			WHERE NOT EXISTS (
+				SELECT 1 FROM moderation_flags
+				WHERE content_type = $2 AND content_id = $3 AND field = $4 AND excerpt = $5
+					AND status IN ('pending', 'dismissed')
+			)
+		`, userID, contentType, contentID, finding.Field, excerpt(texts[finding.Field]), finding.Check+": "+finding.Reason); err != nil {
+			return fmt.Errorf("error recording moderation flag: %v", err)
+		}
+	}
+	return nil
+}
+
+// Clear drops the pending flags of content that was deleted
+func Clear(q Querier, contentType string, contentID int) error {
+	if _, err := q.Exec(`
+		DELETE FROM moderation_flags
+		WHERE content_type = $1 AND content_id = $2 AND status = 'pending'
+	`, contentType, contentID); err != nil {
+		return fmt.Errorf("error clearing moderation flags: %v", err)
+	}
+	return nil
+}
+
+// flagColumns are scanned by scanFlag
+const flagColumns = `
+	id, user_id, content_type, content_id, field, excerpt, reason, status,
+	reviewed_by, review_note, reviewed_at, created_at
+`
+
+// ListFlags returns flags with the status, oldest first so the queue is
+// worked in order
+func ListFlags(db *sql.DB, status string, limit int) ([]ReviewFlag, error) {
+	rows, err := db.Query(`
+		SELECT `+flagColumns+`
+		FROM moderation_flags
+		WHERE status = $1
+		ORDER BY created_at, id
+		LIMIT $2
+	`, status, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying moderation flags: %v", err)
+	}
+	defer rows.Close()
+
+	flags := []ReviewFlag{}
+	for rows.Next() {
+		flag, err := scanFlag(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning moderation flag: %v", err)
+		}
+		flags = append(flags, *flag)
+	}
+	return flags, rows.Err()
+}
+
+// Resolve records an admin's review of a pending flag. Removing takes the
+// flagged content down: the profile field is cleared or the FAQ entry
+// deleted, resolving the other pending flags on it too.
+func Resolve(db *sql.DB, id, adminID int, remove bool, note string) (*ReviewFlag, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting moderation review: %v", err)
+	}
+	defer tx.Rollback()
+
+	status := StatusDismissed
+	if remove {
+		status = StatusRemoved
+	}
+
+	flag, err := scanFlag(tx.QueryRow(`
+		UPDATE moderation_flags
+		SET status = $2, reviewed_by = $3, review_note = NULLIF($4, ''), reviewed_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND status = 'pending'
+		RETURNING `+flagColumns, id, status, adminID, note))
+	if err == sql.ErrNoRows {
+		var exists bool
+		if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM moderation_flags WHERE id = $1)", id).Scan(&exists); err != nil {
+			return nil, fmt.Errorf("error loading moderation flag: %v", err)
+		}
+		if exists {
+			return nil, ErrReviewed
+		}
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("error reviewing moderation flag: %v", err)
+	}
+
+	if remove {
+		if err := removeContent(tx, flag); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing moderation review: %v", err)
+	}
+	return flag, nil
+}
+
+// removeContent takes down flagged content and resolves the other pending
+// flags on what was removed
+func removeContent(tx *sql.Tx, flag *ReviewFlag) error {
+	var err error
+	switch {
+	case flag.ContentType == ContentProfile && flag.Field == "organization_name":
+		_, err = tx.Exec("UPDATE profiles SET organization_name = '' WHERE user_id = $1", flag.ContentID)
+	case flag.ContentType == ContentProfile && flag.Field == "mission_statement":
+		_, err = tx.Exec("UPDATE profiles SET mission_statement = '' WHERE user_id = $1", flag.ContentID)
+	case flag.ContentType == ContentFAQ:
+		_, err = tx.Exec("DELETE FROM provider_faqs WHERE id = $1", flag.ContentID)
+	default:
+		return fmt.Errorf("cannot remove %s field %q", flag.ContentType, flag.Field)
+	}
+	if err != nil {
+		return fmt.Errorf("error removing flagged content: %v", err)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE moderation_flags
+		SET status = 'removed', reviewed_by = $4, reviewed_at = CURRENT_TIMESTAMP
+		WHERE content_type = $1 AND content_id = $2 AND status = 'pending'
+			AND ($1 = 'faq' OR field = $3)
+	`, flag.ContentType, flag.ContentID, flag.Field, flag.ReviewedBy)
+	if err != nil {
+		return fmt.Errorf("error resolving moderation flags: %v", err)
+	}
+	return nil
+}
+
+// scanFlag scans flagColumns
+func scanFlag(row interface{ Scan(...interface{}) error }) (*ReviewFlag, error) {
+	var f ReviewFlag
+	err := row.Scan(
+		&f.ID, &f.UserID, &f.ContentType, &f.ContentID, &f.Field, &f.Excerpt, &f.Reason, &f.Status,
+		&f.ReviewedBy, &f.ReviewNote, &f.ReviewedAt, &f.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// excerpt shortens content stored with a flag
+func excerpt(text string) string {
+	runes := []rune(text)
+	if len(runes) <= maxExcerpt {
+		return text
+	}
+	return string(runes[:maxExcerpt]) + "…"
+}
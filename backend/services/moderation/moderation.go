@@ -0,0 +1,259 @@
+// Package moderation screens user-written content before it is published.
+// Each registered check returns a verdict per field; the strictest wins.
+// Blocked content is rejected, flagged content is saved and queued for admin
+// review.
+package moderation
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Verdict is what happens to checked content, from least to most strict
+type Verdict int
+
+const (
+	Allow Verdict = iota
+	Flag
+	Block
+)
+
+// Check screens one field of text. It returns Allow, or the verdict and a
+// short reason (e.g. the matched term) shown to admins.
+type Check func(text string) (Verdict, string)
+
+// Field is a named piece of content to check
+type Field struct {
+	Name string // e.g. "mission_statement"
+	Text string
+}
+
+// Finding is a check that flagged or blocked a field
+type Finding struct {
+	Field   string
+	Check   string
+	Reason  string
+	Verdict Verdict
+}
+
+// Result is the outcome of checking content
+type Result struct {
+	Verdict  Verdict
+	Findings []Finding
+}
+
+// Blocked returns the first finding that blocks the content, or nil
+func (r Result) Blocked() *Finding {
+	for i := range r.Findings {
+		if r.Findings[i].Verdict == Block {
+			return &r.Findings[i]
+		}
+	}
+	return nil
+}
+
+// Message is the error shown to the author of blocked content
+func (f Finding) Message() string {
+	label := strings.ReplaceAll(f.Field, "_", " ")
+	if label != "" {
+		label = strings.ToUpper(label[:1]) + label[1:]
+	}
+	return label + " contains language that isn't allowed. Please revise it"
+}
+
+//go:embed terms.txt
+var builtinTerms string
+
+var (
+	checksLock sync.RWMutex
+	checks     = map[string]Check{"terms": termsCheck}
+
+	termsLock sync.RWMutex
+	terms     = mustParseTerms(strings.NewReader(builtinTerms))
+)
+
+// RegisterCheck adds a check run on all moderated content, replacing any
+// registered under the same name
+func RegisterCheck(name string, check Check) {
+	checksLock.Lock()
+	defer checksLock.Unlock()
+	checks[name] = check
+}
+
+// LoadTermsFromEnv replaces the built-in term list with MODERATION_TERMS_FILE,
+// when set. A list that fails to load keeps the built-in one.
+func LoadTermsFromEnv() {
+	path := os.Getenv("MODERATION_TERMS_FILE")
+	if path == "" {
+		return
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		log.Printf("Error opening moderation terms, using the built-in list: %v", err)
+		return
+	}
+	defer file.Close()
+
+	list, err := parseTerms(file)
+	if err != nil {
+		log.Printf("Error loading moderation terms, using the built-in list: %v", err)
+		return
+	}
+
+	termsLock.Lock()
+	terms = list
+	termsLock.Unlock()
+	log.Printf("Loaded %d moderation terms from %s", len(list), path)
+}
+
+// Review runs every check on the fields
+func Review(fields ...Field) Result {
+	checksLock.RLock()
+	defer checksLock.RUnlock()
+
+	// Run checks in a stable order so findings are reported consistently
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var result Result
+	for _, field := range fields {
+		if strings.TrimSpace(field.Text) == "" {
+			continue
+		}
+		for _, name := range names {
+			verdict, reason := checks[name](field.Text)
+			if verdict == Allow {
+				continue
+			}
+			result.Findings = append(result.Findings, Finding{Field: field.Name, Check: name, Reason: reason, Verdict: verdict})
+			if verdict > result.Verdict {
+				result.Verdict = verdict
+			}
+		}
+	}
+	return result
+}
+
+// term is a word sequence from the term list
+type term struct {
+	words   []string
+	prefix  bool // The last word also matches longer words
+	verdict Verdict
+	text    string
+}
+
+// termsCheck matches the text against the term list, returning the strictest
+// matching term
+func termsCheck(text string) (Verdict, string) {
+	termsLock.RLock()
+	defer termsLock.RUnlock()
+
+	words := tokenize(text)
+	verdict, reason := Allow, ""
+	for _, t := range terms {
+		if t.verdict > verdict && t.matches(words) {
+			verdict, reason = t.verdict, fmt.Sprintf("matched %q", t.text)
+		}
+	}
+	return verdict, reason
+}
+
+// matches reports whether the term occurs in words
+func (t term) matches(words []string) bool {
+	for start := 0; start+len(t.words) <= len(words); start++ {
+		matched := true
+		for i, word := range t.words {
+			candidate := words[start+i]
+			if i == len(t.words)-1 && t.prefix {
+				matched = strings.HasPrefix(candidate, word)
+			} else {
+				matched = candidate == word
+			}
+			if !matched {
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// substitutions undoes common character swaps used to dodge filters
+var substitutions = map[rune]rune{
+	'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't',
+	'@': 'a', '$': 's', '!': 'i', '|': 'i',
+}
+
+// tokenize lowercases text, undoes substitutions and splits it into words
+func tokenize(text string) []string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(text) {
+		if sub, ok := substitutions[r]; ok {
+			r = sub
+		}
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune(' ')
+		}
+	}
+	return strings.Fields(b.String())
+}
+
+// parseTerms reads a term list: one term per line, optionally prefixed with
+// "block:" or "flag:"; blank lines and # comments are skipped
+func parseTerms(r io.Reader) ([]term, error) {
+	var list []term
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		t := term{verdict: Flag}
+		if action, rest, found := strings.Cut(text, ":"); found {
+			switch strings.ToLower(strings.TrimSpace(action)) {
+			case "block":
+				t.verdict = Block
+			case "flag":
+				t.verdict = Flag
+			default:
+				return nil, fmt.Errorf("line %d: unknown action %q", line, action)
+			}
+			text = strings.TrimSpace(rest)
+		}
+
+		t.prefix = strings.HasSuffix(text, "*")
+		t.words = tokenize(strings.TrimSuffix(text, "*"))
+		if len(t.words) == 0 {
+			return nil, fmt.Errorf("line %d: empty term", line)
+		}
+		t.text = text
+		list = append(list, t)
+	}
+	return list, scanner.Err()
+}
+
+// mustParseTerms parses the built-in list, which must be valid
+func mustParseTerms(r io.Reader) []term {
+	list, err := parseTerms(r)
+	if err != nil {
+		panic(fmt.Sprintf("moderation: invalid built-in terms: %v", err))
+	}
+	return list
+}
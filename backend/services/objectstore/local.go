@@ -0,0 +1,81 @@
+package objectstore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Local keeps objects as files under a directory
+type Local struct {
+	dir string
+}
+
+// NewLocal returns a store keeping objects under dir
+func NewLocal(dir string) *Local {
+	return &Local{dir: dir}
+}
+
+// Put writes the object to a temporary file and renames it into place, so a
+// failed upload never leaves a partial object
+func (l *Local) Put(ctx context.Context, key string, r io.ReadSeeker, size int64) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("error creating object directory: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("error creating object: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if _, err := io.CopyN(tmp, r, size); err != nil {
+		return fmt.Errorf("error writing object: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing object: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("error storing object: %v", err)
+	}
+	return nil
+}
+
+// Delete removes the object's file
+func (l *Local) Delete(ctx context.Context, key string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error deleting object: %v", err)
+	}
+	return nil
+}
+
+// Location is the object's file path
+func (l *Local) Location(key string) string {
+	path, err := l.path(key)
+	if err != nil {
+		return ""
+	}
+	return path
+}
+
+// path maps a key to a file under the directory, rejecting keys that would
+// escape it
+func (l *Local) path(key string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(key))
+	if key == "" || filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid object key %q", key)
+	}
+	return filepath.Join(l.dir, clean), nil
+}
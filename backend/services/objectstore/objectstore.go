@@ -0,0 +1,80 @@
+// Package objectstore uploads files to the configured object storage: a
+// local directory or an S3-compatible bucket.
+package objectstore
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Store keeps objects under slash-separated keys
+type Store interface {
+	// Put stores size bytes read from r under key, replacing any object there
+	Put(ctx context.Context, key string, r io.ReadSeeker, size int64) error
+	// Delete removes the object under key; missing objects are not an error
+	Delete(ctx context.Context, key string) error
+	// Location describes where the object under key is kept, for operators
+	Location(key string) string
+}
+
+var (
+	store     Store
+	storeLock sync.RWMutex
+)
+
+// SetStore installs the object storage; nil disables it
+func SetStore(s Store) {
+	storeLock.Lock()
+	defer storeLock.Unlock()
+	store = s
+}
+
+// Current returns the installed object storage, or nil when none is configured
+func Current() Store {
+	storeLock.RLock()
+	defer storeLock.RUnlock()
+	return store
+}
+
+// NewStoreFromEnv returns the storage selected by OBJECT_STORAGE, or nil when
+// object storage is not configured
+func NewStoreFromEnv() Store {
+	switch strings.ToLower(os.Getenv("OBJECT_STORAGE")) {
+	case "":
+		return nil
+	case "local":
+		dir := os.Getenv("OBJECT_STORAGE_DIR")
+		if dir == "" {
+			dir = "objects"
+		}
+		return NewLocal(dir)
+	case "s3":
+		region := os.Getenv("S3_REGION")
+		if region == "" {
+			region = "us-east-1"
+		}
+		endpoint := os.Getenv("S3_ENDPOINT")
+		if endpoint == "" {
+			endpoint = "https://s3." + region + ".amazonaws.com"
+		}
+		if os.Getenv("S3_BUCKET") == "" {
+			log.Printf("OBJECT_STORAGE=s3 needs S3_BUCKET, object storage disabled")
+			return nil
+		}
+		return NewS3(S3Config{
+			Endpoint:        endpoint,
+			Region:          region,
+			Bucket:          os.Getenv("S3_BUCKET"),
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("S3_SESSION_TOKEN"),
+		})
+	default:
+		log.Printf("Unknown OBJECT_STORAGE %q, object storage disabled", os.Getenv("OBJECT_STORAGE"))
+		return nil
+	}
+}
@@ -0,0 +1,200 @@
+// Package referrals gives every organization a referral code, attributes
+// signups to the code they came with, and rewards the referrer once the
+// referred organization completes its profile.
+package referrals
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"matcherator/backend/services/entitlements"
+)
+
+// DefaultTrialDays is used when REFERRAL_TRIAL_DAYS is unset or invalid
+const DefaultTrialDays = 30
+
+// codeAlphabet leaves out characters that are easily confused (0/O, 1/I/L)
+const codeAlphabet = "23456789ABCDEFGHJKMNPQRSTUVWXYZ"
+
+const codeLength = 8
+
+// Reward is run once for each referral whose referred organization completed
+// its profile. It returns a description of what was granted, or "" when
+// nothing was.
+type Reward func(db *sql.DB, referrerID, referredID int) (string, error)
+
+var (
+	rewardsLock sync.RWMutex
+	rewards     = map[string]Reward{"pro_trial": proTrialReward}
+)
+
+// RegisterReward adds a reward granted for completed referrals, replacing
+// any registered under the same name
+func RegisterReward(name string, reward Reward) {
+	rewardsLock.Lock()
+	defer rewardsLock.Unlock()
+	rewards[name] = reward
+}
+
+// CodeFor returns the organization's referral code, creating it on first use
+func CodeFor(db *sql.DB, userID int) (string, error) {
+	var code string
+	err := db.QueryRow("SELECT code FROM referral_codes WHERE user_id = $1", userID).Scan(&code)
+	if err == nil {
+		return code, nil
+	} else if err != sql.ErrNoRows {
+		return "", fmt.Errorf("error loading referral code: %v", err)
+	}
+
+	// Retry on the rare collision with another organization's code
+	for attempt := 0; attempt < 5; attempt++ {
+		if code, err = newCode(); err != nil {
+			return "", err
+		}
+		err = db.QueryRow(`
+			INSERT INTO referral_codes (user_id, code)
+			VALUES ($1, $2)
+			ON CONFLICT (user_id) DO UPDATE SET user_id = EXCLUDED.user_id
+			RETURNING code
+		`, userID, code).Scan(&code)
+		if err == nil {
+			return code, nil
+		}
+		if !strings.Contains(err.Error(), "unique constraint") {
+			return "", fmt.Errorf("error creating referral code: %v", err)
+		}
+	}
+	return "", fmt.Errorf("error creating referral code: %v", err)
+}
+
+// Attribute records that the new organization signed up with a referral
+// code. Unknown codes are ignored; it reports whether the signup was
+// attributed.
+func Attribute(db *sql.DB, referredID int, code string) (bool, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" {
+		return false, nil
+	}
+
+	result, err := db.Exec(`
+		INSERT INTO referrals (referrer_id, referred_id, code)
+		SELECT user_id, $1, code
+		FROM referral_codes
+		WHERE code = $2 AND user_id <> $1
+		ON CONFLICT (referred_id) DO NOTHING
+	`, referredID, code)
+	if err != nil {
+		return false, fmt.Errorf("error attributing referral: %v", err)
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+// Rewarded is a referral whose rewards were just granted
+type Rewarded struct {
+	ReferrerID int
+	ReferredID int
+	Reward     string // What was granted, "" when nothing was
+}
+
+// RewardIfComplete grants the referral rewards once the referred
+// organization's profile is complete, returning nil until then. It is safe to
+// call on every profile update: each referral is rewarded once.
+func RewardIfComplete(db *sql.DB, referredID int) (*Rewarded, error) {
+	var referrerID int
+	err := db.QueryRow(`
+		UPDATE referrals r
+		SET completed_at = CURRENT_TIMESTAMP
+		FROM profiles p
+		WHERE r.referred_id = $1
+			AND r.completed_at IS NULL
+			AND p.user_id = r.referred_id
+			AND p.organization_name <> ''
+			AND COALESCE(p.mission_statement, '') <> ''
+			AND cardinality(p.sectors) > 0
+			AND COALESCE(p.state, '') <> ''
+		RETURNING r.referrer_id
+	`, referredID).Scan(&referrerID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error checking referral: %v", err)
+	}
+
+	rewardsLock.RLock()
+	defer rewardsLock.RUnlock()
+
+	var granted []string
+	for name, reward := range rewards {
+		description, err := reward(db, referrerID, referredID)
+		if err != nil {
+			// Keep granting the other rewards; this one is logged for follow-up
+			log.Printf("Error granting %s referral reward to user %d: %v", name, referrerID, err)
+			continue
+		}
+		if description != "" {
+			granted = append(granted, description)
+		}
+	}
+
+	reward := strings.Join(granted, "; ")
+	if _, err := db.Exec(`
+		UPDATE referrals SET rewarded_at = CURRENT_TIMESTAMP, reward = NULLIF($2, '')
+		WHERE referred_id = $1
+	`, referredID, reward); err != nil {
+		return nil, fmt.Errorf("error recording referral reward: %v", err)
+	}
+	return &Rewarded{ReferrerID: referrerID, ReferredID: referredID, Reward: reward}, nil
+}
+
+// proTrialReward extends the referrer's pro trial by REFERRAL_TRIAL_DAYS.
+// Paying organizations get nothing from it.
+func proTrialReward(db *sql.DB, referrerID, referredID int) (string, error) {
+	days := TrialDays()
+	if days == 0 {
+		return "", nil
+	}
+
+	until, err := entitlements.ExtendTrial(db, referrerID, entitlements.PlanPro, time.Duration(days)*24*time.Hour)
+	if err == entitlements.ErrSubscribed {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d days of the pro plan (until %s)", days, until.UTC().Format("Jan 2, 2006")), nil
+}
+
+// TrialDays returns the pro trial days granted per completed referral, read
+// from REFERRAL_TRIAL_DAYS; 0 turns the reward off
+func TrialDays() int {
+	value := os.Getenv("REFERRAL_TRIAL_DAYS")
+	if value == "" {
+		return DefaultTrialDays
+	}
+
+	days, err := strconv.Atoi(value)
+	if err != nil || days < 0 {
+		log.Printf("Invalid REFERRAL_TRIAL_DAYS %q, using %d", value, DefaultTrialDays)
+		return DefaultTrialDays
+	}
+	return days
+}
+
+// newCode returns a random referral code
+func newCode() (string, error) {
+	b := make([]byte, codeLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating referral code: %v", err)
+	}
+	for i := range b {
+		b[i] = codeAlphabet[int(b[i])%len(codeAlphabet)]
+	}
+	return string(b), nil
+}
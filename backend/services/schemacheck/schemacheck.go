@@ -0,0 +1,161 @@
+// Package schemacheck verifies at startup that the database has the tables
+// and columns the queries rely on, so a schema that is behind init.sql fails
+// fast with a report rather than as 500s on the requests that hit it.
+package schemacheck
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Statement is a query checked by preparing it, which makes the server
+// resolve every table and column it names without running it
+type Statement struct {
+	Name  string
+	Query string
+}
+
+// required lists the tables and columns that most requests depend on. Other
+// tables are covered by the statements passed to Check.
+var required = map[string][]string{
+	"users": {
+		"id", "email", "password_hash", "role", "status", "is_admin", "created_at",
+		"deactivated_at", "deleted_at", "password_reset_required", "last_active_at",
+	},
+	"profiles": {
+		"user_id", "organization_name", "profile_picture_url", "mission_statement", "location",
+		"state", "city", "zip_code", "ein", "language", "applicant_type", "sectors",
+		"target_groups", "project_stage", "website_url", "contact_email", "chat_opt_in",
+		"public_listing", "annual_budget", "staff_size", "founded_year",
+	},
+	"provider_data":  {"user_id", "funding_type", "amount_offered", "region_scope", "deadline", "award_min", "award_max"},
+	"recipient_data": {"user_id", "needs", "budget_requested", "team_size", "timeline", "prior_funding"},
+	"tokens":         {"user_id", "jti", "expires_at", "last_used_at"},
+	"refresh_tokens": {"session_id", "token_hash", "expires_at", "used_at"},
+	"connections":    {"id", "initiator_id", "target_id", "connection_type", "funded_at", "funded_by"},
+	"chat_messages":  {"id", "match_id", "sender_id", "content", "read", "timestamp"},
+	"notifications":  {"id", "user_id", "type", "content", "read_at", "created_at"},
+	"matches":        {"user_id", "match_id", "match_score"},
+	"grants":         {"id", "provider_id", "title", "description", "deadline", "status"},
+	"jobs":           {"id", "kind", "payload", "status", "attempts", "run_at", "progress"},
+}
+
+// Report lists what the database lacks. It is the error Check returns.
+type Report struct {
+	MissingTables    []string
+	MissingColumns   []string // table.column
+	FailedStatements []string // name: the server's error
+}
+
+func (r *Report) empty() bool {
+	return len(r.MissingTables) == 0 && len(r.MissingColumns) == 0 && len(r.FailedStatements) == 0
+}
+
+func (r *Report) Error() string {
+	var b strings.Builder
+	b.WriteString("the database schema does not match the queries")
+	for _, section := range []struct {
+		title string
+		items []string
+	}{
+		{"missing tables", r.MissingTables},
+		{"missing columns", r.MissingColumns},
+		{"statements that do not prepare", r.FailedStatements},
+	} {
+		if len(section.items) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n%s (%d):", section.title, len(section.items))
+		for _, item := range section.items {
+			b.WriteString("\n  - " + item)
+		}
+	}
+	return b.String()
+}
+
+// Check looks up the required tables and columns and prepares statements. It
+// returns a *Report when anything is missing, or the error that kept it from
+// checking.
+func Check(ctx context.Context, db *sql.DB, statements []Statement) error {
+	report := &Report{}
+	if err := checkColumns(ctx, db, report); err != nil {
+		return err
+	}
+
+	// One connection, so every statement is prepared against the same session
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("error connecting to the database: %v", err)
+	}
+	defer conn.Close()
+
+	for _, statement := range statements {
+		stmt, err := conn.PrepareContext(ctx, statement.Query)
+		if err != nil {
+			if _, ok := err.(*pq.Error); !ok {
+				return fmt.Errorf("error preparing %s: %v", statement.Name, err)
+			}
+			report.FailedStatements = append(report.FailedStatements, statement.Name+": "+err.Error())
+			continue
+		}
+		stmt.Close()
+	}
+
+	if report.empty() {
+		return nil
+	}
+	return report
+}
+
+// checkColumns records the required tables and columns the schema lacks
+func checkColumns(ctx context.Context, db *sql.DB, report *Report) error {
+	tables := make([]string, 0, len(required))
+	for table := range required {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT table_name, column_name
+		FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = ANY($1)
+	`, pq.Array(tables))
+	if err != nil {
+		return fmt.Errorf("error reading the schema: %v", err)
+	}
+	defer rows.Close()
+
+	present := make(map[string]map[string]bool)
+	for rows.Next() {
+		var table, column string
+		if err := rows.Scan(&table, &column); err != nil {
+			return fmt.Errorf("error reading the schema: %v", err)
+		}
+		if present[table] == nil {
+			present[table] = make(map[string]bool)
+		}
+		present[table][column] = true
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error reading the schema: %v", err)
+	}
+
+	for _, table := range tables {
+		columns, ok := present[table]
+		if !ok {
+			report.MissingTables = append(report.MissingTables, table)
+			continue
+		}
+		for _, column := range required[table] {
+			if !columns[column] {
+				report.MissingColumns = append(report.MissingColumns, table+"."+column)
+			}
+		}
+	}
+	return nil
+}
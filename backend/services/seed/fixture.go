@@ -0,0 +1,225 @@
+// Package seed loads fixture files of organizations, grants, connections and
+// conversations into the database, for demos and local development.
+package seed
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultPassword signs in organizations whose fixture sets no password
+const DefaultPassword = "demopass123"
+
+// Fixture is the content of a seed file. Organizations are referred to by
+// their key everywhere else in the file.
+type Fixture struct {
+	Password      string         `json:"password" yaml:"password"`
+	Organizations []Organization `json:"organizations" yaml:"organizations"`
+	Grants        []Grant        `json:"grants" yaml:"grants"`
+	Connections   []Connection   `json:"connections" yaml:"connections"`
+	Conversations []Conversation `json:"conversations" yaml:"conversations"`
+}
+
+// Organization is an account with its profile and role data
+type Organization struct {
+	Key       string     `json:"key" yaml:"key"`
+	Email     string     `json:"email" yaml:"email"`
+	Password  string     `json:"password" yaml:"password"`
+	Role      string     `json:"role" yaml:"role"`
+	IsAdmin   bool       `json:"is_admin" yaml:"is_admin"`
+	Profile   Profile    `json:"profile" yaml:"profile"`
+	Provider  *Provider  `json:"provider" yaml:"provider"`
+	Recipient *Recipient `json:"recipient" yaml:"recipient"`
+}
+
+// Profile is an organization's public profile
+type Profile struct {
+	OrganizationName string   `json:"organization_name" yaml:"organization_name"`
+	MissionStatement string   `json:"mission_statement" yaml:"mission_statement"`
+	Location         string   `json:"location" yaml:"location"`
+	State            string   `json:"state" yaml:"state"`
+	City             string   `json:"city" yaml:"city"`
+	ZipCode          string   `json:"zip_code" yaml:"zip_code"`
+	EIN              string   `json:"ein" yaml:"ein"`
+	Language         string   `json:"language" yaml:"language"`
+	ApplicantType    string   `json:"applicant_type" yaml:"applicant_type"`
+	Sectors          []string `json:"sectors" yaml:"sectors"`
+	TargetGroups     []string `json:"target_groups" yaml:"target_groups"`
+	ProjectStage     string   `json:"project_stage" yaml:"project_stage"`
+	WebsiteURL       string   `json:"website_url" yaml:"website_url"`
+	ContactEmail     string   `json:"contact_email" yaml:"contact_email"`
+	ChatOptIn        bool     `json:"chat_opt_in" yaml:"chat_opt_in"`
+	PublicListing    bool     `json:"public_listing" yaml:"public_listing"`
+}
+
+// Provider is what a provider offers
+type Provider struct {
+	FundingType      string     `json:"funding_type" yaml:"funding_type"`
+	AmountOffered    *float64   `json:"amount_offered" yaml:"amount_offered"`
+	RegionScope      string     `json:"region_scope" yaml:"region_scope"`
+	EligibilityNotes string     `json:"eligibility_notes" yaml:"eligibility_notes"`
+	Deadline         *time.Time `json:"deadline" yaml:"deadline"`
+	ApplicationLink  string     `json:"application_link" yaml:"application_link"`
+	AwardMin         *float64   `json:"award_min" yaml:"award_min"`
+	AwardMax         *float64   `json:"award_max" yaml:"award_max"`
+}
+
+// Recipient is what a recipient is looking for
+type Recipient struct {
+	Needs           []string `json:"needs" yaml:"needs"`
+	BudgetRequested *float64 `json:"budget_requested" yaml:"budget_requested"`
+	TeamSize        *int     `json:"team_size" yaml:"team_size"`
+	Timeline        string   `json:"timeline" yaml:"timeline"`
+	PriorFunding    bool     `json:"prior_funding" yaml:"prior_funding"`
+	AwardMin        *float64 `json:"award_min" yaml:"award_min"`
+	AwardMax        *float64 `json:"award_max" yaml:"award_max"`
+}
+
+// Grant is a grant a provider offers
+type Grant struct {
+	Provider     string     `json:"provider" yaml:"provider"`
+	Title        string     `json:"title" yaml:"title"`
+	Description  string     `json:"description" yaml:"description"`
+	Amount       *float64   `json:"amount" yaml:"amount"`
+	Deadline     *time.Time `json:"deadline" yaml:"deadline"`
+	Sectors      []string   `json:"sectors" yaml:"sectors"`
+	TargetGroups []string   `json:"target_groups" yaml:"target_groups"`
+	Status       string     `json:"status" yaml:"status"`
+}
+
+// Connection is one organization following another; funded connections are
+// marked funded by their provider
+type Connection struct {
+	From   string `json:"from" yaml:"from"`
+	To     string `json:"to" yaml:"to"`
+	Funded bool   `json:"funded" yaml:"funded"`
+}
+
+// Conversation is the chat of a connection between two organizations
+type Conversation struct {
+	Between  [2]string `json:"between" yaml:"between"`
+	Messages []Message `json:"messages" yaml:"messages"`
+}
+
+// Message is a chat message. Messages without a time are spaced a minute
+// apart, ending now.
+type Message struct {
+	From    string     `json:"from" yaml:"from"`
+	Content string     `json:"content" yaml:"content"`
+	SentAt  *time.Time `json:"sent_at" yaml:"sent_at"`
+	Read    bool       `json:"read" yaml:"read"`
+}
+
+// Load reads a fixture file, as YAML (.yaml, .yml) or JSON, and checks that
+// it is consistent
+func Load(path string) (*Fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var fixture Fixture
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err = dec.Decode(&fixture)
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&fixture)
+	default:
+		return nil, fmt.Errorf("fixture must be a .yaml, .yml or .json file")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", path, err)
+	}
+
+	if err := fixture.validate(); err != nil {
+		return nil, fmt.Errorf("invalid fixture %s: %v", path, err)
+	}
+	return &fixture, nil
+}
+
+// validate checks roles and that every reference names an organization of
+// the file
+func (f *Fixture) validate() error {
+	roles := make(map[string]string)
+	emails := make(map[string]bool)
+	for i, org := range f.Organizations {
+		switch {
+		case org.Key == "":
+			return fmt.Errorf("organization %d has no key", i+1)
+		case roles[org.Key] != "":
+			return fmt.Errorf("organization key %q is used twice", org.Key)
+		case org.Email == "":
+			return fmt.Errorf("organization %q has no email", org.Key)
+		case emails[strings.ToLower(org.Email)]:
+			return fmt.Errorf("email %s is used twice", org.Email)
+		case org.Role != "provider" && org.Role != "recipient":
+			return fmt.Errorf("organization %q must have role provider or recipient", org.Key)
+		case org.Profile.OrganizationName == "":
+			return fmt.Errorf("organization %q has no profile.organization_name", org.Key)
+		case org.Role == "provider" && org.Recipient != nil, org.Role == "recipient" && org.Provider != nil:
+			return fmt.Errorf("organization %q has data of the other role", org.Key)
+		}
+		roles[org.Key] = org.Role
+		emails[strings.ToLower(org.Email)] = true
+	}
+
+	for i, grant := range f.Grants {
+		if roles[grant.Provider] != "provider" {
+			return fmt.Errorf("grant %d: %q is not a provider of the file", i+1, grant.Provider)
+		}
+		if grant.Title == "" || grant.Description == "" {
+			return fmt.Errorf("grant %d needs a title and a description", i+1)
+		}
+	}
+
+	connected := make(map[[2]string]bool)
+	for i, conn := range f.Connections {
+		if roles[conn.From] == "" || roles[conn.To] == "" {
+			return fmt.Errorf("connection %d: %q or %q is not an organization of the file", i+1, conn.From, conn.To)
+		}
+		if conn.From == conn.To {
+			return fmt.Errorf("connection %d connects %q with itself", i+1, conn.From)
+		}
+		if conn.Funded && roles[conn.From] == roles[conn.To] {
+			return fmt.Errorf("connection %d is funded but not between a provider and a recipient", i+1)
+		}
+		connected[pair(conn.From, conn.To)] = true
+	}
+
+	for i, conv := range f.Conversations {
+		if !connected[pair(conv.Between[0], conv.Between[1])] {
+			return fmt.Errorf("conversation %d: %q and %q are not connected in the file", i+1, conv.Between[0], conv.Between[1])
+		}
+		if roles[conv.Between[0]] == roles[conv.Between[1]] {
+			return fmt.Errorf("conversation %d is not between a provider and a recipient", i+1)
+		}
+		for j, msg := range conv.Messages {
+			if msg.From != conv.Between[0] && msg.From != conv.Between[1] {
+				return fmt.Errorf("conversation %d, message %d: %q is not part of the conversation", i+1, j+1, msg.From)
+			}
+			if strings.TrimSpace(msg.Content) == "" {
+				return fmt.Errorf("conversation %d, message %d is empty", i+1, j+1)
+			}
+		}
+	}
+	return nil
+}
+
+// pair orders two keys so either direction of a connection gives the same pair
+func pair(a, b string) [2]string {
+	if a > b {
+		a, b = b, a
+	}
+	return [2]string{a, b}
+}
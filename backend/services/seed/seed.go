@@ -0,0 +1,292 @@
+package seed
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"golang.org/x/crypto/bcrypt"
+
+	"matcherator/backend/services/fieldcrypt"
+)
+
+// Summary counts what a seed run added. Records that already exist, matched
+// by email, provider and title, or pair of organizations, are kept as they
+// are, so a fixture can be loaded again.
+type Summary struct {
+	Organizations int `json:"organizations"`
+	Existing      int `json:"existing"`
+	Grants        int `json:"grants"`
+	Connections   int `json:"connections"`
+	Messages      int `json:"messages"`
+}
+
+// Apply loads a fixture in one transaction
+func Apply(db *sql.DB, fixture *Fixture) (*Summary, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	summary := &Summary{}
+	ids := make(map[string]int, len(fixture.Organizations))
+	for _, org := range fixture.Organizations {
+		id, created, err := seedOrganization(tx, org, fixture.Password)
+		if err != nil {
+			return nil, fmt.Errorf("organization %q: %v", org.Key, err)
+		}
+		ids[org.Key] = id
+		if created {
+			summary.Organizations++
+		} else {
+			summary.Existing++
+		}
+	}
+
+	for _, grant := range fixture.Grants {
+		var exists bool
+		err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM grants WHERE provider_id = $1 AND title = $2)`,
+			ids[grant.Provider], grant.Title).Scan(&exists)
+		if err != nil {
+			return nil, fmt.Errorf("grant %q: %v", grant.Title, err)
+		}
+		if exists {
+			continue
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO grants (provider_id, title, description, amount, deadline, sectors, target_groups, status)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		`, ids[grant.Provider], grant.Title, grant.Description, grant.Amount, grant.Deadline,
+			pq.Array(orEmpty(grant.Sectors)), pq.Array(orEmpty(grant.TargetGroups)), nullIfEmpty(grant.Status))
+		if err != nil {
+			return nil, fmt.Errorf("grant %q: %v", grant.Title, err)
+		}
+		summary.Grants++
+	}
+
+	for _, conn := range fixture.Connections {
+		var id int
+		var created bool
+		err := tx.QueryRow(`
+			WITH inserted AS (
+				INSERT INTO connections (initiator_id, target_id, connection_type)
+				VALUES ($1, $2, 'following')
+				ON CONFLICT ((LEAST(initiator_id, target_id)), (GREATEST(initiator_id, target_id))) DO NOTHING
+				RETURNING id
+			)
+			SELECT id, true FROM inserted
+			UNION ALL
+			SELECT id, false FROM connections
+			WHERE LEAST(initiator_id, target_id) = LEAST($1, $2)
+				AND GREATEST(initiator_id, target_id) = GREATEST($1, $2)
+			LIMIT 1
+		`, ids[conn.From], ids[conn.To]).Scan(&id, &created)
+		if err != nil {
+			return nil, fmt.Errorf("connection %s -> %s: %v", conn.From, conn.To, err)
+		}
+		if created {
+			summary.Connections++
+		}
+
+		if conn.Funded {
+			providerID := ids[conn.From]
+			if roleOf(fixture, conn.To) == "provider" {
+				providerID = ids[conn.To]
+			}
+			_, err := tx.Exec(`
+				UPDATE connections
+				SET funded_at = COALESCE(funded_at, CURRENT_TIMESTAMP), funded_by = COALESCE(funded_by, $2)
+				WHERE id = $1
+			`, id, providerID)
+			if err != nil {
+				return nil, fmt.Errorf("connection %s -> %s: %v", conn.From, conn.To, err)
+			}
+		}
+	}
+
+	for _, conv := range fixture.Conversations {
+		n, err := seedConversation(tx, conv, ids)
+		if err != nil {
+			return nil, fmt.Errorf("conversation between %s and %s: %v", conv.Between[0], conv.Between[1], err)
+		}
+		summary.Messages += n
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing seed: %v", err)
+	}
+	return summary, nil
+}
+
+// seedOrganization creates an organization's account, profile and role data,
+// or returns the ID of the account that already has its email
+func seedOrganization(tx *sql.Tx, org Organization, defaultPassword string) (int, bool, error) {
+	email := strings.ToLower(strings.TrimSpace(org.Email))
+
+	var id int
+	err := tx.QueryRow(`SELECT id FROM users WHERE LOWER(email) = $1`, email).Scan(&id)
+	if err == nil {
+		log.Printf("Keeping existing account %d for %q", id, org.Key)
+		return id, false, nil
+	} else if err != sql.ErrNoRows {
+		return 0, false, fmt.Errorf("error looking up account: %v", err)
+	}
+
+	password := org.Password
+	if password == "" {
+		password = defaultPassword
+	}
+	if password == "" {
+		password = DefaultPassword
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return 0, false, fmt.Errorf("error hashing password: %v", err)
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO users (email, password_hash, role, status, is_admin)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`, email, string(hashedPassword), org.Role, status(org), org.IsAdmin).Scan(&id)
+	if err != nil {
+		return 0, false, fmt.Errorf("error creating account: %v", err)
+	}
+
+	// Encrypt sensitive fields at rest
+	ein, err := fieldcrypt.Encrypt(org.Profile.EIN)
+	if err != nil {
+		return 0, false, fmt.Errorf("error encrypting EIN: %v", err)
+	}
+	contactEmail, err := fieldcrypt.Encrypt(org.Profile.ContactEmail)
+	if err != nil {
+		return 0, false, fmt.Errorf("error encrypting contact email: %v", err)
+	}
+
+	p := org.Profile
+	_, err = tx.Exec(`
+		INSERT INTO profiles (
+			user_id, organization_name, mission_statement, location, state, city, zip_code,
+			ein, language, applicant_type, sectors, target_groups, project_stage,
+			website_url, contact_email, chat_opt_in, public_listing
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
+	`, id, p.OrganizationName, nullIfEmpty(p.MissionStatement), nullIfEmpty(p.Location), nullIfEmpty(p.State),
+		nullIfEmpty(p.City), nullIfEmpty(p.ZipCode), nullIfEmpty(ein), nullIfEmpty(p.Language),
+		nullIfEmpty(p.ApplicantType), pq.Array(orEmpty(p.Sectors)), pq.Array(orEmpty(p.TargetGroups)),
+		nullIfEmpty(p.ProjectStage), nullIfEmpty(p.WebsiteURL), nullIfEmpty(contactEmail), p.ChatOptIn, p.PublicListing)
+	if err != nil {
+		return 0, false, fmt.Errorf("error creating profile: %v", err)
+	}
+
+	if org.Provider != nil {
+		d := org.Provider
+		_, err = tx.Exec(`
+			INSERT INTO provider_data (
+				user_id, funding_type, amount_offered, region_scope, eligibility_notes,
+				deadline, application_link, award_min, award_max
+			)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		`, id, nullIfEmpty(d.FundingType), d.AmountOffered, nullIfEmpty(d.RegionScope), nullIfEmpty(d.EligibilityNotes),
+			d.Deadline, nullIfEmpty(d.ApplicationLink), d.AwardMin, d.AwardMax)
+	} else if org.Recipient != nil {
+		d := org.Recipient
+		_, err = tx.Exec(`
+			INSERT INTO recipient_data (
+				user_id, needs, budget_requested, team_size, timeline, prior_funding, award_min, award_max
+			)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		`, id, pq.Array(orEmpty(d.Needs)), d.BudgetRequested, d.TeamSize, nullIfEmpty(d.Timeline), d.PriorFunding,
+			d.AwardMin, d.AwardMax)
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("error creating %s data: %v", org.Role, err)
+	}
+
+	return id, true, nil
+}
+
+// seedConversation adds the messages of a conversation that has none yet
+func seedConversation(tx *sql.Tx, conv Conversation, ids map[string]int) (int, error) {
+	a, b := ids[conv.Between[0]], ids[conv.Between[1]]
+
+	var matchID int
+	var existing bool
+	err := tx.QueryRow(`
+		SELECT c.id, EXISTS (SELECT 1 FROM chat_messages m WHERE m.match_id = c.id)
+		FROM connections c
+		WHERE LEAST(c.initiator_id, c.target_id) = LEAST($1, $2)
+			AND GREATEST(c.initiator_id, c.target_id) = GREATEST($1, $2)
+	`, a, b).Scan(&matchID, &existing)
+	if err != nil {
+		return 0, fmt.Errorf("error loading connection: %v", err)
+	}
+	if existing {
+		return 0, nil
+	}
+
+	// Untimed messages are spaced a minute apart up to now
+	next := time.Now().Add(-time.Duration(len(conv.Messages)) * time.Minute)
+	for _, msg := range conv.Messages {
+		next = next.Add(time.Minute)
+		sentAt := next
+		if msg.SentAt != nil {
+			sentAt = *msg.SentAt
+		}
+		_, err := tx.Exec(`
+			INSERT INTO chat_messages (match_id, sender_id, content, read, timestamp)
+			VALUES ($1, $2, $3, $4, $5)
+		`, matchID, ids[msg.From], msg.Content, msg.Read, sentAt)
+		if err != nil {
+			return 0, fmt.Errorf("error storing message: %v", err)
+		}
+	}
+	return len(conv.Messages), nil
+}
+
+// status is the account status an organization starts with, by the rules
+// profile updates apply: providers are active until their deadline passes,
+// recipients once their profile is complete
+func status(org Organization) string {
+	if org.Role == "provider" {
+		if org.Provider != nil && org.Provider.Deadline != nil && org.Provider.Deadline.Before(time.Now()) {
+			return "inactive"
+		}
+		return "active"
+	}
+
+	p := org.Profile
+	if len(p.Sectors) > 0 && len(p.TargetGroups) > 0 && p.State != "" && p.City != "" && p.ZipCode != "" {
+		return "active"
+	}
+	return "inactive"
+}
+
+// roleOf returns the role of the organization with a key
+func roleOf(fixture *Fixture, key string) string {
+	for _, org := range fixture.Organizations {
+		if org.Key == key {
+			return org.Role
+		}
+	}
+	return ""
+}
+
+func nullIfEmpty(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+func orEmpty(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
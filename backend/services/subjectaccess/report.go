@@ -0,0 +1,307 @@
+package subjectaccess
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"matcherator/backend/services/fieldcrypt"
+)
+
+// reportDir holds compiled reports. They are only served through the admin
+// download endpoint.
+var reportDir = filepath.Join("uploads", "subject_access")
+
+// section is one table's rows about the user, $1 being the user ID. Secrets
+// (password and token hashes, credentials) and derived search columns are left
+// out by name.
+type section struct {
+	name  string
+	query string
+	omit  []string
+}
+
+// sections lists everything stored about a user
+var sections = []section{
+	{"account", "SELECT * FROM users WHERE id = $1", []string{"password_hash"}},
+	{"profile", "SELECT * FROM profiles WHERE user_id = $1", []string{"search_vector"}},
+	{"provider_data", "SELECT * FROM provider_data WHERE user_id = $1", nil},
+	{"recipient_data", "SELECT * FROM recipient_data WHERE user_id = $1", nil},
+	{"match_preferences", "SELECT * FROM match_preferences WHERE user_id = $1", nil},
+	{"onboarding_steps", "SELECT * FROM onboarding_steps WHERE user_id = $1", nil},
+	{"sessions", "SELECT * FROM tokens WHERE user_id = $1 ORDER BY created_at", []string{"token", "jti"}},
+	{"login_events", "SELECT * FROM login_events WHERE user_id = $1 ORDER BY created_at", []string{"alert_token_hash"}},
+	{"failed_logins", "SELECT f.* FROM failed_logins f JOIN users u ON LOWER(u.email) = f.email WHERE u.id = $1 ORDER BY f.created_at", nil},
+	{"password_reset_tokens", "SELECT * FROM password_reset_tokens WHERE user_id = $1 ORDER BY created_at", []string{"token_hash"}},
+	{"magic_links", "SELECT * FROM magic_links WHERE user_id = $1 ORDER BY created_at", []string{"token_hash"}},
+	{"connections", "SELECT * FROM connections WHERE initiator_id = $1 OR target_id = $1 ORDER BY created_at", nil},
+	{"matches", "SELECT * FROM matches WHERE user_id = $1 ORDER BY match_score DESC", nil},
+	{"dismissed_matches", "SELECT * FROM dismissed_matches WHERE user_id = $1 ORDER BY dismissed_at", nil},
+	{"profile_views", "SELECT * FROM profile_views WHERE viewer_id = $1 OR viewed_id = $1", nil},
+	{"chat_messages", `
+		SELECT cm.* FROM chat_messages cm
+		JOIN connections c ON c.id = cm.match_id
+		WHERE c.initiator_id = $1 OR c.target_id = $1
+		ORDER BY cm.timestamp`, nil},
+	{"chat_pins", "SELECT * FROM chat_pins WHERE pinned_by = $1 ORDER BY pinned_at", nil},
+	{"chat_drafts", "SELECT * FROM chat_drafts WHERE user_id = $1", nil},
+	{"messages", "SELECT * FROM messages WHERE sender_id = $1 OR recipient_id = $1 ORDER BY created_at", nil},
+	{"message_templates", "SELECT * FROM message_templates WHERE user_id = $1 ORDER BY created_at", nil},
+	{"bookmarks", "SELECT * FROM bookmarks WHERE user_id = $1 ORDER BY created_at", nil},
+	{"notifications", "SELECT * FROM notifications WHERE user_id = $1 ORDER BY created_at", nil},
+	{"grants", "SELECT * FROM grants WHERE provider_id = $1", nil},
+	{"requirement_documents", "SELECT * FROM requirement_documents WHERE uploaded_by = $1 ORDER BY uploaded_at", []string{"file_path"}},
+	{"shared_tasks", "SELECT * FROM shared_tasks WHERE created_by = $1 OR assignee_id = $1 OR completed_by = $1 ORDER BY created_at", nil},
+	{"impact_reports", "SELECT * FROM impact_reports WHERE requested_by = $1 OR submitted_by = $1", nil},
+	{"impact_report_attachments", "SELECT * FROM impact_report_attachments WHERE uploaded_by = $1 ORDER BY uploaded_at", []string{"file_path"}},
+	{"provider_faqs", "SELECT * FROM provider_faqs WHERE provider_id = $1", nil},
+	{"provider_questions", "SELECT * FROM provider_questions WHERE provider_id = $1 OR recipient_id = $1", nil},
+	{"success_stories", "SELECT * FROM success_stories WHERE provider_id = $1 OR recipient_id = $1 OR author_id = $1", nil},
+	{"taxonomy_suggestions", "SELECT * FROM taxonomy_suggestions WHERE user_id = $1", nil},
+	{"analytics_events", "SELECT * FROM analytics_events WHERE user_id = $1 ORDER BY created_at", nil},
+	{"active_weeks", "SELECT * FROM user_active_weeks WHERE user_id = $1 ORDER BY week", nil},
+	{"experiment_assignments", "SELECT * FROM experiment_assignments WHERE user_id = $1", nil},
+	{"experiment_exposures", "SELECT * FROM experiment_exposures WHERE user_id = $1 ORDER BY shown_at", nil},
+	{"shadow_diffs", "SELECT * FROM shadow_diffs WHERE user_id = $1", nil},
+	{"campaigns", "SELECT * FROM campaigns WHERE provider_id = $1 ORDER BY created_at", nil},
+	{"campaign_deliveries", "SELECT * FROM campaign_deliveries WHERE recipient_id = $1", nil},
+	{"organization_claims", "SELECT * FROM organization_claims WHERE organization_id = $1 ORDER BY created_at", []string{"token_hash", "document_path"}},
+	{"provider_duplicates", "SELECT * FROM provider_duplicates WHERE imported_id = $1 OR registered_id = $1 ORDER BY detected_at", nil},
+	{"moderation_flags", "SELECT * FROM moderation_flags WHERE user_id = $1 ORDER BY created_at", nil},
+	{"plan_subscription", "SELECT * FROM plan_subscriptions WHERE user_id = $1", nil},
+	{"billing_customers", "SELECT * FROM billing_customers WHERE user_id = $1", nil},
+	{"usage_counters", "SELECT * FROM usage_counters WHERE user_id = $1 ORDER BY period_start", nil},
+	{"referral_codes", "SELECT * FROM referral_codes WHERE user_id = $1", nil},
+	{"referrals", "SELECT * FROM referrals WHERE referrer_id = $1 OR referred_id = $1", nil},
+	{"widget_tokens", "SELECT * FROM widget_tokens WHERE provider_id = $1", []string{"token_hash"}},
+	{"crm_connections", "SELECT * FROM crm_connections WHERE user_id = $1", []string{"credentials"}},
+	{"crm_sync_logs", "SELECT * FROM crm_sync_logs WHERE user_id = $1 ORDER BY created_at", nil},
+	{"subject_access_requests", "SELECT * FROM subject_access_requests WHERE user_id = $1 ORDER BY created_at", []string{"file_path"}},
+}
+
+// encryptedFields are profile fields stored encrypted; the report has them
+// in plain text
+var encryptedFields = []string{"ein", "contact_email"}
+
+// Report is report.json at the root of the ZIP
+type Report struct {
+	UserID      int                          `json:"user_id"`
+	GeneratedAt time.Time                    `json:"generated_at"`
+	Data        map[string][]json.RawMessage `json:"data"`
+	Files       []ReportFile                 `json:"files"`
+}
+
+// ReportFile is an upload included under files/ in the ZIP
+type ReportFile struct {
+	Section  string `json:"section"`
+	RecordID int    `json:"record_id,omitempty"`
+	Name     string `json:"name"`
+	Path     string `json:"path,omitempty"` // Path within the ZIP; empty when the file is missing
+}
+
+// upload is a stored file of the user's
+type upload struct {
+	section  string
+	recordID int
+	name     string
+	path     string
+}
+
+// compile writes the user's report and returns its path and size
+func compile(ctx context.Context, db *sql.DB, requestID, userID int) (string, int64, error) {
+	report := Report{UserID: userID, GeneratedAt: time.Now().UTC(), Data: map[string][]json.RawMessage{}, Files: []ReportFile{}}
+	for _, s := range sections {
+		rows, err := sectionRows(ctx, db, s, userID)
+		if err != nil {
+			return "", 0, fmt.Errorf("error compiling %s: %v", s.name, err)
+		}
+		report.Data[s.name] = rows
+	}
+	if err := decryptProfile(report.Data["profile"]); err != nil {
+		return "", 0, err
+	}
+
+	uploads, err := userUploads(ctx, db, userID)
+	if err != nil {
+		return "", 0, err
+	}
+
+	if err := os.MkdirAll(reportDir, 0750); err != nil {
+		return "", 0, fmt.Errorf("error creating report directory: %v", err)
+	}
+	name, err := randomName()
+	if err != nil {
+		return "", 0, fmt.Errorf("error naming report: %v", err)
+	}
+	path := filepath.Join(reportDir, fmt.Sprintf("%d-%s.zip", requestID, name))
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0640)
+	if err != nil {
+		return "", 0, fmt.Errorf("error creating report: %v", err)
+	}
+	if err := writeZip(file, &report, uploads); err != nil {
+		file.Close()
+		removeReport(path)
+		return "", 0, err
+	}
+	if err := file.Close(); err != nil {
+		removeReport(path)
+		return "", 0, fmt.Errorf("error writing report: %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		removeReport(path)
+		return "", 0, fmt.Errorf("error writing report: %v", err)
+	}
+	return path, info.Size(), nil
+}
+
+// sectionRows returns a section's rows as JSON objects
+func sectionRows(ctx context.Context, db *sql.DB, s section, userID int) ([]json.RawMessage, error) {
+	omit := s.omit
+	if omit == nil {
+		omit = []string{}
+	}
+
+	var data []byte
+	err := db.QueryRowContext(ctx, `
+		SELECT COALESCE(jsonb_agg(to_jsonb(t) - $2::text[]), '[]'::jsonb)
+		FROM (`+s.query+`) t
+	`, userID, pq.Array(omit)).Scan(&data)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []json.RawMessage
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// decryptProfile replaces the encrypted profile fields with their plain text
+func decryptProfile(rows []json.RawMessage) error {
+	for i, row := range rows {
+		var fields map[string]interface{}
+		if err := json.Unmarshal(row, &fields); err != nil {
+			return fmt.Errorf("error decoding profile: %v", err)
+		}
+		for _, name := range encryptedFields {
+			value, ok := fields[name].(string)
+			if !ok {
+				continue
+			}
+			plain, err := fieldcrypt.Decrypt(value)
+			if err != nil {
+				return fmt.Errorf("error decrypting profile %s: %v", name, err)
+			}
+			fields[name] = plain
+		}
+		data, err := json.Marshal(fields)
+		if err != nil {
+			return fmt.Errorf("error encoding profile: %v", err)
+		}
+		rows[i] = data
+	}
+	return nil
+}
+
+// userUploads lists the files the user uploaded, leaving out quarantined ones
+func userUploads(ctx context.Context, db *sql.DB, userID int) ([]upload, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT 'requirement_documents', id, file_name, file_path
+		FROM requirement_documents WHERE uploaded_by = $1 AND scan_status <> 'quarantined'
+		UNION ALL
+		SELECT 'impact_report_attachments', id, file_name, file_path
+		FROM impact_report_attachments WHERE uploaded_by = $1 AND scan_status <> 'quarantined'
+		UNION ALL
+		SELECT 'profile', 0, 'profile_picture' || COALESCE(substring(profile_picture_url from '\.[A-Za-z0-9]+$'), ''),
+			ltrim(profile_picture_url, '/')
+		FROM profiles WHERE user_id = $1 AND profile_picture_url LIKE '/uploads/%'
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing uploads: %v", err)
+	}
+	defer rows.Close()
+
+	var uploads []upload
+	for rows.Next() {
+		var u upload
+		if err := rows.Scan(&u.section, &u.recordID, &u.name, &u.path); err != nil {
+			return nil, fmt.Errorf("error scanning upload: %v", err)
+		}
+		uploads = append(uploads, u)
+	}
+	return uploads, rows.Err()
+}
+
+// writeZip writes report.json and the uploads that still exist
+func writeZip(w io.Writer, report *Report, uploads []upload) error {
+	archive := zip.NewWriter(w)
+
+	for _, u := range uploads {
+		file := ReportFile{Section: u.section, RecordID: u.recordID, Name: u.name}
+		inZip := fmt.Sprintf("files/%s/%d-%s", u.section, u.recordID, filepath.Base(u.name))
+		if err := copyUpload(archive, u.path, inZip); err == nil {
+			file.Path = inZip
+		} else if !os.IsNotExist(err) {
+			return fmt.Errorf("error adding %s to report: %v", u.path, err)
+		}
+		report.Files = append(report.Files, file)
+	}
+
+	entry, err := archive.Create("report.json")
+	if err != nil {
+		return fmt.Errorf("error writing report: %v", err)
+	}
+	encoder := json.NewEncoder(entry)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return fmt.Errorf("error writing report: %v", err)
+	}
+
+	if err := archive.Close(); err != nil {
+		return fmt.Errorf("error writing report: %v", err)
+	}
+	return nil
+}
+
+// copyUpload adds a stored upload to the archive. Only files under uploads/
+// are read.
+func copyUpload(archive *zip.Writer, path, name string) error {
+	clean := filepath.Clean(path)
+	if !strings.HasPrefix(clean, "uploads"+string(filepath.Separator)) {
+		return os.ErrNotExist
+	}
+
+	file, err := os.Open(clean)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	entry, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, file)
+	return err
+}
+
+// removeReport deletes a report file, logging failures
+func removeReport(path string) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		log.Printf("Error removing subject-access report %s: %v", path, err)
+	}
+}
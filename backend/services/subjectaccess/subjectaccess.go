@@ -0,0 +1,301 @@
+// Package subjectaccess compiles everything stored about a user into a
+// downloadable ZIP report, for answering subject-access requests. Reports are
+// built by a background job because they read every table and upload.
+package subjectaccess
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"matcherator/backend/services/jobs"
+)
+
+// ReportJob is the job kind that compiles a subject-access report
+const ReportJob = "subjectaccess.report"
+
+// Request statuses; failed means the job was dead-lettered, expired that the
+// report file was deleted
+const (
+	StatusPending = "pending"
+	StatusRunning = "running"
+	StatusReady   = "ready"
+	StatusFailed  = "failed"
+	StatusExpired = "expired"
+)
+
+const (
+	// reportTimeout bounds one attempt at compiling a report
+	reportTimeout = 30 * time.Minute
+
+	// retention is how long a compiled report can be downloaded
+	retention = 30 * 24 * time.Hour
+
+	// purgeInterval is how often expired report files are deleted
+	purgeInterval = time.Hour
+)
+
+// ErrNotFound is returned when no request has the given ID
+var ErrNotFound = errors.New("subject-access request not found")
+
+// Request is an admin's request for a user's report
+type Request struct {
+	ID          int        `json:"id"`
+	UserID      int        `json:"user_id"`
+	RequestedBy *int       `json:"requested_by"`
+	JobID       int64      `json:"job_id"`
+	Status      string     `json:"status"`
+	LastError   *string    `json:"last_error"`
+	SizeBytes   *int64     `json:"size_bytes"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+
+	filePath *string
+}
+
+// ReportPayload is the payload of a ReportJob
+type ReportPayload struct {
+	RequestID int `json:"request_id"`
+}
+
+// RegisterJobs installs the handler of ReportJob
+func RegisterJobs(db *sql.DB) {
+	jobs.RegisterWithTimeout(ReportJob, reportTimeout, ReportJobHandler(db))
+}
+
+// Create records an admin's request for a user's report and queues it
+func Create(db *sql.DB, userID, adminID int) (*Request, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting subject-access request: %v", err)
+	}
+	defer tx.Rollback()
+
+	var requestID int
+	err = tx.QueryRow(`
+		INSERT INTO subject_access_requests (user_id, requested_by)
+		SELECT id, $2 FROM users WHERE id = $1
+		RETURNING id
+	`, userID, adminID).Scan(&requestID)
+	if err == sql.ErrNoRows {
+		return nil, sql.ErrNoRows
+	} else if err != nil {
+		return nil, fmt.Errorf("error creating subject-access request: %v", err)
+	}
+
+	jobID, err := jobs.Enqueue(tx, ReportJob, ReportPayload{RequestID: requestID})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("UPDATE subject_access_requests SET job_id = $2 WHERE id = $1", requestID, jobID); err != nil {
+		return nil, fmt.Errorf("error linking subject-access job: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing subject-access request: %v", err)
+	}
+	return Get(db, requestID)
+}
+
+// requestColumns are scanned by scanRequest. The status follows the job until
+// the report is stored.
+const requestColumns = `
+	r.id, r.user_id, r.requested_by, COALESCE(r.job_id, 0),
+	CASE
+		WHEN r.completed_at IS NOT NULL AND (r.file_path IS NULL OR r.expires_at <= CURRENT_TIMESTAMP) THEN 'expired'
+		WHEN r.completed_at IS NOT NULL THEN 'ready'
+		WHEN j.status = 'dead' THEN 'failed'
+		WHEN j.status = 'running' THEN 'running'
+		ELSE 'pending'
+	END,
+	j.last_error, r.size_bytes, r.created_at, r.completed_at, r.expires_at, r.file_path
+`
+
+// Get returns a request by ID
+func Get(db *sql.DB, id int) (*Request, error) {
+	request, err := scanRequest(db.QueryRow(`
+		SELECT `+requestColumns+`
+		FROM subject_access_requests r
+		LEFT JOIN jobs j ON j.id = r.job_id
+		WHERE r.id = $1
+	`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("error loading subject-access request: %v", err)
+	}
+	return request, nil
+}
+
+// List returns the most recent requests, for one user when userID is not 0
+func List(db *sql.DB, userID, limit int) ([]Request, error) {
+	rows, err := db.Query(`
+		SELECT `+requestColumns+`
+		FROM subject_access_requests r
+		LEFT JOIN jobs j ON j.id = r.job_id
+		WHERE $1 = 0 OR r.user_id = $1
+		ORDER BY r.created_at DESC
+		LIMIT $2
+	`, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error listing subject-access requests: %v", err)
+	}
+	defer rows.Close()
+
+	requests := []Request{}
+	for rows.Next() {
+		request, err := scanRequest(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning subject-access request: %v", err)
+		}
+		requests = append(requests, *request)
+	}
+	return requests, rows.Err()
+}
+
+// FilePath returns where a ready report is stored, or "" when it cannot be
+// downloaded (not compiled yet, expired or deleted)
+func (r *Request) FilePath() string {
+	if r.Status != StatusReady || r.filePath == nil || (r.ExpiresAt != nil && time.Now().After(*r.ExpiresAt)) {
+		return ""
+	}
+	return *r.filePath
+}
+
+// scanRequest scans requestColumns
+func scanRequest(row interface{ Scan(...interface{}) error }) (*Request, error) {
+	var r Request
+	err := row.Scan(
+		&r.ID, &r.UserID, &r.RequestedBy, &r.JobID, &r.Status,
+		&r.LastError, &r.SizeBytes, &r.CreatedAt, &r.CompletedAt, &r.ExpiresAt, &r.filePath,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// ReportJobHandler compiles queued reports
+func ReportJobHandler(db *sql.DB) jobs.Handler {
+	return func(ctx context.Context, payload json.RawMessage) error {
+		var p ReportPayload
+		if err := json.Unmarshal(payload, &p); err != nil {
+			return jobs.Permanent(fmt.Errorf("error decoding subject-access report: %v", err))
+		}
+
+		var userID int
+		err := db.QueryRowContext(ctx, "SELECT user_id FROM subject_access_requests WHERE id = $1", p.RequestID).Scan(&userID)
+		if err == sql.ErrNoRows {
+			return jobs.Permanent(fmt.Errorf("subject-access request %d no longer exists", p.RequestID))
+		} else if err != nil {
+			return fmt.Errorf("error loading subject-access request: %v", err)
+		}
+
+		path, size, err := compile(ctx, db, p.RequestID, userID)
+		if err != nil {
+			return err
+		}
+
+		_, err = db.ExecContext(ctx, `
+			UPDATE subject_access_requests
+			SET file_path = $2, size_bytes = $3, completed_at = CURRENT_TIMESTAMP, expires_at = $4
+			WHERE id = $1
+		`, p.RequestID, path, size, time.Now().Add(retention))
+		if err != nil {
+			removeReport(path)
+			return fmt.Errorf("error storing subject-access report: %v", err)
+		}
+		return nil
+	}
+}
+
+// Delete removes a request's report file, keeping the request as a record
+// that it was answered
+func Delete(db *sql.DB, id int) error {
+	var path sql.NullString
+	err := db.QueryRow(`
+		UPDATE subject_access_requests r
+		SET file_path = NULL, expires_at = CURRENT_TIMESTAMP
+		FROM subject_access_requests old
+		WHERE r.id = $1 AND old.id = r.id
+		RETURNING old.file_path
+	`, id).Scan(&path)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	} else if err != nil {
+		return fmt.Errorf("error deleting subject-access report: %v", err)
+	}
+	if path.Valid {
+		removeReport(path.String)
+	}
+	return nil
+}
+
+// StartPurger deletes the files of expired reports every hour until ctx is
+// done
+func StartPurger(ctx context.Context, db *sql.DB) {
+	go func() {
+		ticker := time.NewTicker(purgeInterval)
+		defer ticker.Stop()
+
+		for {
+			if err := purgeExpired(db); err != nil {
+				log.Printf("Error purging expired subject-access reports: %v", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// purgeExpired deletes the files of reports past their expiry
+func purgeExpired(db *sql.DB) error {
+	rows, err := db.Query(`
+		UPDATE subject_access_requests r
+		SET file_path = NULL
+		FROM subject_access_requests old
+		WHERE old.id = r.id AND r.file_path IS NOT NULL AND r.expires_at <= CURRENT_TIMESTAMP
+		RETURNING old.file_path
+	`)
+	if err != nil {
+		return fmt.Errorf("error claiming expired reports: %v", err)
+	}
+	defer rows.Close()
+
+	var paths []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return fmt.Errorf("error scanning expired report: %v", err)
+		}
+		paths = append(paths, path)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		removeReport(path)
+	}
+	return nil
+}
+
+// randomName returns a random file name stem, so report paths cannot be guessed
+func randomName() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
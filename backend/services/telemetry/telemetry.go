@@ -0,0 +1,121 @@
+package telemetry
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// defaultServiceName is reported when OTEL_SERVICE_NAME is not set
+const defaultServiceName = "matcherator-backend"
+
+// tracer delegates to the provider installed by Init
+var tracer = otel.Tracer("matcherator/backend")
+
+// sentryEnabled is set by Init when SENTRY_DSN is configured
+var sentryEnabled bool
+
+// Init installs the tracer provider and, when SENTRY_DSN is set, Sentry error
+// reporting. Spans are exported over OTLP/HTTP when OTEL_EXPORTER_OTLP_ENDPOINT
+// or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT is set; otherwise they are still created
+// so every request has a trace ID. The returned function flushes both on shutdown.
+func Init(ctx context.Context) func(context.Context) {
+	serviceName := os.Getenv("OTEL_SERVICE_NAME")
+	if serviceName == "" {
+		serviceName = defaultServiceName
+	}
+
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+	}
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != "" {
+		exporter, err := otlptracehttp.New(ctx)
+		if err != nil {
+			log.Printf("Error creating OTLP trace exporter, spans will not be exported: %v", err)
+		} else {
+			opts = append(opts, sdktrace.WithBatcher(exporter))
+		}
+	}
+
+	provider := sdktrace.NewTracerProvider(opts...)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	if dsn := os.Getenv("SENTRY_DSN"); dsn != "" {
+		err := sentry.Init(sentry.ClientOptions{
+			Dsn:         dsn,
+			Environment: os.Getenv("SENTRY_ENVIRONMENT"),
+		})
+		if err != nil {
+			log.Printf("Error initializing Sentry, error reporting disabled: %v", err)
+		} else {
+			sentryEnabled = true
+		}
+	}
+
+	return func(ctx context.Context) {
+		if err := provider.Shutdown(ctx); err != nil {
+			log.Printf("Error shutting down tracer provider: %v", err)
+		}
+		if sentryEnabled {
+			sentry.Flush(2 * time.Second)
+		}
+	}
+}
+
+// Tracer returns the application tracer
+func Tracer() trace.Tracer {
+	return tracer
+}
+
+// TraceID returns the trace ID of the span in ctx, or "" when there is none
+func TraceID(ctx context.Context) string {
+	spanContext := trace.SpanFromContext(ctx).SpanContext()
+	if !spanContext.HasTraceID() {
+		return ""
+	}
+	return spanContext.TraceID().String()
+}
+
+// ReportError records err on the span in ctx and sends it to Sentry, tagged with
+// the trace ID so the two can be correlated
+func ReportError(ctx context.Context, err error) {
+	if err == nil {
+		return
+	}
+
+	span := trace.SpanFromContext(ctx)
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+
+	if !sentryEnabled {
+		return
+	}
+	hub := sentry.CurrentHub().Clone()
+	if traceID := TraceID(ctx); traceID != "" {
+		hub.Scope().SetTag("trace_id", traceID)
+	}
+	hub.CaptureException(err)
+}
+
+// reportPanic sends a recovered panic to Sentry, tagged with the trace ID
+func reportPanic(traceID string, recovered interface{}) {
+	if !sentryEnabled {
+		return
+	}
+	hub := sentry.CurrentHub().Clone()
+	hub.Scope().SetTag("trace_id", traceID)
+	hub.Recover(recovered)
+	hub.Flush(2 * time.Second)
+}
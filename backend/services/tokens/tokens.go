@@ -0,0 +1,28 @@
+// Package tokens creates the random secrets handed out as bearer tokens and
+// links, and the hashes stored in their place
+package tokens
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// SecretSize is the number of random bytes in a secret
+const SecretSize = 32
+
+// NewSecret returns a random SecretSize-byte secret, hex encoded
+func NewSecret() (string, error) {
+	secret := make([]byte, SecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+// Hash returns the SHA-256 hex digest stored for a token, so a leaked table
+// doesn't leak usable tokens
+func Hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
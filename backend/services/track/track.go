@@ -0,0 +1,82 @@
+// Package track records product analytics: the funnel milestones each user
+// reaches and the weeks they are active, for cohort retention and conversion
+// reports.
+package track
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"sync"
+)
+
+// Funnel events, each recorded once per user when first reached
+const (
+	Signup           = "signup"
+	ProfileCompleted = "profile_completed"
+	FirstMatchViewed = "first_match_viewed"
+	FirstConnection  = "first_connection"
+	FirstMessage     = "first_message"
+)
+
+// Funnel lists the funnel events in the order users are expected to reach them
+var Funnel = []string{Signup, ProfileCompleted, FirstMatchViewed, FirstConnection, FirstMessage}
+
+// Properties describe an event, e.g. the signup method
+type Properties map[string]interface{}
+
+type recordedKey struct {
+	userID int
+	event  string
+}
+
+// recorded remembers events already stored by this process, so hot paths like
+// chat messages only write once
+var recorded sync.Map
+
+// Event records that the user reached a funnel event. Only the first time
+// counts; later calls are no-ops. The write is made in the background, so it
+// is cheap to call on every request.
+func Event(db *sql.DB, userID int, event string, props Properties) {
+	key := recordedKey{userID, event}
+	if _, seen := recorded.LoadOrStore(key, true); seen {
+		return
+	}
+
+	go func() {
+		if err := record(db, userID, event, props); err != nil {
+			// Let a later call retry
+			recorded.Delete(key)
+			log.Printf("Error tracking %s for user %d: %v", event, userID, err)
+		}
+	}()
+}
+
+// record stores an event unless the user already reached it
+func record(db *sql.DB, userID int, event string, props Properties) error {
+	if props == nil {
+		props = Properties{}
+	}
+	encoded, err := json.Marshal(props)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO analytics_events (user_id, event, properties)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, event) DO NOTHING
+	`, userID, event, encoded)
+	return err
+}
+
+// Active records that the user was active this week. Callers throttle it;
+// see auth.TouchActivity.
+func Active(db *sql.DB, userID int) error {
+	_, err := db.Exec(`
+		INSERT INTO user_active_weeks (user_id, week)
+		VALUES ($1, date_trunc('week', CURRENT_TIMESTAMP AT TIME ZONE 'UTC')::date)
+		ON CONFLICT DO NOTHING
+	`, userID)
+	return err
+}
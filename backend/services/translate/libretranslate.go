@@ -0,0 +1,59 @@
+package translate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// LibreTranslate is a Provider backed by a LibreTranslate-compatible HTTP API
+type LibreTranslate struct {
+	apiURL string
+	apiKey string
+	client *http.Client
+}
+
+// NewLibreTranslate creates a provider for the API at apiURL; apiKey may be empty
+func NewLibreTranslate(apiURL, apiKey string) *LibreTranslate {
+	return &LibreTranslate{
+		apiURL: strings.TrimRight(apiURL, "/"),
+		apiKey: apiKey,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Translate implements Provider
+func (l *LibreTranslate) Translate(text, sourceLang, targetLang string) (string, error) {
+	body, err := json.Marshal(map[string]string{
+		"q":       text,
+		"source":  sourceLang,
+		"target":  targetLang,
+		"format":  "text",
+		"api_key": l.apiKey,
+	})
+	if err != nil {
+		return "", fmt.Errorf("error encoding translation request: %v", err)
+	}
+
+	resp, err := l.client.Post(l.apiURL+"/translate", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("error calling translation API: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("translation API returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		TranslatedText string `json:"translatedText"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("error decoding translation response: %v", err)
+	}
+
+	return result.TranslatedText, nil
+}
@@ -0,0 +1,135 @@
+package translate
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Provider machine-translates text between ISO 639-1 language codes
+type Provider interface {
+	Translate(text, sourceLang, targetLang string) (string, error)
+}
+
+var (
+	provider     Provider
+	providerLock sync.RWMutex
+)
+
+// languageCodes maps the names stored in profiles.language to ISO 639-1 codes
+var languageCodes = map[string]string{
+	"english":    "en",
+	"spanish":    "es",
+	"french":     "fr",
+	"german":     "de",
+	"portuguese": "pt",
+	"italian":    "it",
+	"chinese":    "zh",
+	"arabic":     "ar",
+	"vietnamese": "vi",
+	"korean":     "ko",
+}
+
+// SetProvider installs the translation provider; nil disables translation
+func SetProvider(p Provider) {
+	providerLock.Lock()
+	defer providerLock.Unlock()
+	provider = p
+}
+
+// NewProviderFromEnv returns the provider selected by TRANSLATION_PROVIDER, or nil
+// when translation is not configured
+func NewProviderFromEnv() Provider {
+	switch strings.ToLower(os.Getenv("TRANSLATION_PROVIDER")) {
+	case "":
+		return nil
+	case "libretranslate":
+		apiURL := os.Getenv("TRANSLATION_API_URL")
+		if apiURL == "" {
+			log.Printf("TRANSLATION_API_URL is not set, translation disabled")
+			return nil
+		}
+		return NewLibreTranslate(apiURL, os.Getenv("TRANSLATION_API_KEY"))
+	default:
+		log.Printf("Unknown TRANSLATION_PROVIDER %q, translation disabled", os.Getenv("TRANSLATION_PROVIDER"))
+		return nil
+	}
+}
+
+// LanguageCode returns the ISO 639-1 code for a profile language name or code
+func LanguageCode(language string) string {
+	language = strings.ToLower(strings.TrimSpace(language))
+	if code, ok := languageCodes[language]; ok {
+		return code
+	}
+	if len(language) == 2 {
+		return language
+	}
+	return ""
+}
+
+// Translate returns text translated from sourceLanguage to targetLanguage (profile
+// language names or codes). It reports false when no provider is configured, the
+// languages are unknown or equal, or the provider fails. Results are cached in the
+// translations table.
+func Translate(db *sql.DB, text, sourceLanguage, targetLanguage string) (string, bool) {
+	providerLock.RLock()
+	p := provider
+	providerLock.RUnlock()
+
+	source, target := LanguageCode(sourceLanguage), LanguageCode(targetLanguage)
+	if p == nil || strings.TrimSpace(text) == "" || source == "" || target == "" || source == target {
+		return "", false
+	}
+
+	sum := sha256.Sum256([]byte(source + "\x00" + text))
+	sourceHash := hex.EncodeToString(sum[:])
+
+	var translated string
+	err := db.QueryRow(`
+		SELECT translated_text
+		FROM translations
+		WHERE source_hash = $1 AND target_language = $2
+	`, sourceHash, target).Scan(&translated)
+	if err == nil {
+		return translated, true
+	}
+	if err != sql.ErrNoRows {
+		log.Printf("Error reading translation cache: %v", err)
+	}
+
+	translated, err = p.Translate(text, source, target)
+	if err != nil {
+		log.Printf("Error translating text from %s to %s: %v", source, target, err)
+		return "", false
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO translations (source_hash, target_language, translated_text)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (source_hash, target_language) DO UPDATE SET translated_text = EXCLUDED.translated_text
+	`, sourceHash, target, translated)
+	if err != nil {
+		log.Printf("Error caching translation: %v", err)
+	}
+
+	return translated, true
+}
+
+// UserLanguage returns the language of a user's profile, or "" when unset
+func UserLanguage(db *sql.DB, userID int) string {
+	var language string
+	err := db.QueryRow(`
+		SELECT COALESCE(language, '')
+		FROM profiles
+		WHERE user_id = $1
+	`, userID).Scan(&language)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Error getting language for user %d: %v", userID, err)
+	}
+	return language
+}
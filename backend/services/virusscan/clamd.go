@@ -0,0 +1,82 @@
+package virusscan
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// chunkSize is how much of a file is sent to clamd at a time
+const chunkSize = 64 << 10
+
+// Clamd scans files with a ClamAV daemon over its INSTREAM command
+type Clamd struct {
+	addr string
+}
+
+// NewClamd returns a scanner for the clamd listening on addr (host:port)
+func NewClamd(addr string) *Clamd {
+	return &Clamd{addr: addr}
+}
+
+// Scan streams r to clamd and returns the signature it found, if any
+func (c *Clamd) Scan(ctx context.Context, r io.Reader) (string, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return "", fmt.Errorf("error connecting to clamd: %v", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return "", fmt.Errorf("error starting clamd stream: %v", err)
+	}
+
+	// Each chunk is prefixed with its length; a zero length ends the stream
+	buf := make([]byte, chunkSize)
+	size := make([]byte, 4)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size, uint32(n))
+			if _, err := conn.Write(append(size, buf[:n]...)); err != nil {
+				return "", fmt.Errorf("error streaming to clamd: %v", err)
+			}
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return "", fmt.Errorf("error reading file: %v", err)
+		}
+	}
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return "", fmt.Errorf("error ending clamd stream: %v", err)
+	}
+
+	reply, err := io.ReadAll(conn)
+	if err != nil {
+		return "", fmt.Errorf("error reading clamd reply: %v", err)
+	}
+	return parseReply(string(bytes.TrimRight(reply, "\x00\n")))
+}
+
+// parseReply reads clamd's "stream: OK", "stream: <signature> FOUND" or
+// "... ERROR" reply
+func parseReply(reply string) (string, error) {
+	result := strings.TrimSpace(strings.TrimPrefix(reply, "stream:"))
+	switch {
+	case result == "OK":
+		return "", nil
+	case strings.HasSuffix(result, " FOUND"):
+		return strings.TrimSuffix(result, " FOUND"), nil
+	default:
+		return "", fmt.Errorf("clamd replied %q", reply)
+	}
+}
@@ -0,0 +1,148 @@
+package virusscan
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// Kinds of uploads that are scanned
+const (
+	KindRequirementDocument = "requirement_document"
+	KindReportAttachment    = "report_attachment"
+)
+
+// ErrNotFound is returned when no quarantined upload has the given kind and ID
+var ErrNotFound = errors.New("quarantined upload not found")
+
+// tables stores each kind of upload
+var tables = map[string]string{
+	KindRequirementDocument: "requirement_documents",
+	KindReportAttachment:    "impact_report_attachments",
+}
+
+// Upload is a quarantined file as admins review it
+type Upload struct {
+	Kind          string    `json:"kind"`
+	ID            int       `json:"id"`
+	ConnectionID  int       `json:"connection_id"`
+	UploadedBy    int       `json:"uploaded_by"`
+	UploaderEmail string    `json:"uploader_email"`
+	FileName      string    `json:"file_name"`
+	ContentType   string    `json:"content_type"`
+	SizeBytes     int64     `json:"size_bytes"`
+	Verdict       string    `json:"verdict"`
+	UploadedAt    time.Time `json:"uploaded_at"`
+	path          string
+}
+
+const quarantinedQuery = `
+	SELECT kind, id, connection_id, uploaded_by, email, file_name, content_type, size_bytes, verdict, uploaded_at, file_path
+	FROM (
+		SELECT 'requirement_document' AS kind, d.id, d.connection_id, d.uploaded_by, u.email,
+			d.file_name, d.content_type, d.size_bytes, COALESCE(d.scan_verdict, '') AS verdict, d.uploaded_at, d.file_path
+		FROM requirement_documents d
+		JOIN users u ON u.id = d.uploaded_by
+		WHERE d.scan_status = 'quarantined'
+		UNION ALL
+		SELECT 'report_attachment', a.id, r.connection_id, a.uploaded_by, u.email,
+			a.file_name, a.content_type, a.size_bytes, COALESCE(a.scan_verdict, ''), a.uploaded_at, a.file_path
+		FROM impact_report_attachments a
+		JOIN impact_reports r ON r.id = a.report_id
+		JOIN users u ON u.id = a.uploaded_by
+		WHERE a.scan_status = 'quarantined'
+	) q
+`
+
+// ValidKind reports whether kind names a kind of scanned upload
+func ValidKind(kind string) bool {
+	_, ok := tables[kind]
+	return ok
+}
+
+// List returns the quarantined uploads, oldest first
+func List(db *sql.DB) ([]Upload, error) {
+	rows, err := db.Query(quarantinedQuery + `ORDER BY uploaded_at, kind, id`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying quarantined uploads: %v", err)
+	}
+	defer rows.Close()
+
+	uploads := []Upload{}
+	for rows.Next() {
+		u, err := scanUpload(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning quarantined upload: %v", err)
+		}
+		uploads = append(uploads, *u)
+	}
+	return uploads, rows.Err()
+}
+
+// Release serves a quarantined upload again and returns it
+func Release(db *sql.DB, kind string, id int) (*Upload, error) {
+	upload, err := get(db, kind, id)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := db.Exec(`UPDATE `+tables[kind]+` SET scan_status = 'released' WHERE id = $1 AND scan_status = 'quarantined'`, id)
+	if err != nil {
+		return nil, fmt.Errorf("error releasing upload: %v", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, ErrNotFound
+	}
+	return upload, nil
+}
+
+// Delete removes a quarantined upload and its file and returns what it was
+func Delete(db *sql.DB, kind string, id int) (*Upload, error) {
+	upload, err := get(db, kind, id)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := db.Exec(`DELETE FROM `+tables[kind]+` WHERE id = $1 AND scan_status = 'quarantined'`, id)
+	if err != nil {
+		return nil, fmt.Errorf("error deleting upload: %v", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, ErrNotFound
+	}
+
+	if err := os.Remove(upload.path); err != nil && !os.IsNotExist(err) {
+		// Don't return error here as the upload was still removed successfully
+		log.Printf("Error deleting quarantined file %s: %v", upload.path, err)
+	}
+	return upload, nil
+}
+
+// get returns a quarantined upload, or ErrNotFound
+func get(db *sql.DB, kind string, id int) (*Upload, error) {
+	if !ValidKind(kind) {
+		return nil, ErrNotFound
+	}
+	upload, err := scanUpload(db.QueryRow(quarantinedQuery+`WHERE kind = $1 AND id = $2`, kind, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("error loading quarantined upload: %v", err)
+	}
+	return upload, nil
+}
+
+func scanUpload(row interface{ Scan(...interface{}) error }) (*Upload, error) {
+	var u Upload
+	err := row.Scan(
+		&u.Kind, &u.ID, &u.ConnectionID, &u.UploadedBy, &u.UploaderEmail,
+		&u.FileName, &u.ContentType, &u.SizeBytes, &u.Verdict, &u.UploadedAt, &u.path,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
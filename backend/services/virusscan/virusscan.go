@@ -0,0 +1,107 @@
+// Package virusscan checks uploaded files with the configured scanner. Files
+// that are infected, or that could not be scanned, are quarantined: kept but
+// not served until an admin releases or deletes them.
+package virusscan
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scan statuses of an upload. Released files were quarantined until an admin
+// judged them safe; they are served like clean ones.
+const (
+	StatusClean       = "clean"
+	StatusQuarantined = "quarantined"
+	StatusReleased    = "released"
+)
+
+// scanTimeout bounds the scan of one file
+const scanTimeout = 30 * time.Second
+
+// Scanner checks a file's content. It returns the name of the signature found,
+// or "" when the file is clean.
+type Scanner interface {
+	Scan(ctx context.Context, r io.Reader) (string, error)
+}
+
+// Verdict is the outcome of scanning an upload
+type Verdict struct {
+	Status string
+	// Reason is why a quarantined file was quarantined, nil for clean ones
+	Reason *string
+}
+
+var (
+	scanner     Scanner
+	scannerLock sync.RWMutex
+)
+
+// SetScanner installs the virus scanner; nil disables scanning
+func SetScanner(s Scanner) {
+	scannerLock.Lock()
+	defer scannerLock.Unlock()
+	scanner = s
+}
+
+// NewScannerFromEnv returns the scanner selected by VIRUS_SCANNER, or nil when
+// scanning is not configured
+func NewScannerFromEnv() Scanner {
+	switch strings.ToLower(os.Getenv("VIRUS_SCANNER")) {
+	case "":
+		return nil
+	case "clamd":
+		addr := os.Getenv("CLAMD_ADDR")
+		if addr == "" {
+			addr = "localhost:3310"
+		}
+		return NewClamd(addr)
+	default:
+		log.Printf("Unknown VIRUS_SCANNER %q, virus scanning disabled", os.Getenv("VIRUS_SCANNER"))
+		return nil
+	}
+}
+
+// ScanFile scans a stored upload. Files pass as clean when scanning is not
+// configured; scanner failures quarantine the file rather than serve it
+// unchecked.
+func ScanFile(ctx context.Context, path string) Verdict {
+	scannerLock.RLock()
+	s := scanner
+	scannerLock.RUnlock()
+
+	if s == nil {
+		return Verdict{Status: StatusClean}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return quarantine(path, "scan failed: could not open the file", err)
+	}
+	defer file.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, scanTimeout)
+	defer cancel()
+
+	signature, err := s.Scan(ctx, file)
+	if err != nil {
+		return quarantine(path, "scan failed: the scanner could not be reached", err)
+	}
+	if signature != "" {
+		log.Printf("Quarantined upload %s: %s", path, signature)
+		reason := "infected: " + signature
+		return Verdict{Status: StatusQuarantined, Reason: &reason}
+	}
+	return Verdict{Status: StatusClean}
+}
+
+// quarantine logs why a file could not be scanned and quarantines it
+func quarantine(path, reason string, err error) Verdict {
+	log.Printf("Error scanning upload %s, quarantining it: %v", path, err)
+	return Verdict{Status: StatusQuarantined, Reason: &reason}
+}
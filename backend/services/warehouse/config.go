@@ -0,0 +1,167 @@
+package warehouse
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultRetentionDays is how long exported snapshots are kept when neither
+// the table nor the config sets a retention
+const DefaultRetentionDays = 90
+
+// Config lists the tables exported to the warehouse
+type Config struct {
+	RetentionDays int     `yaml:"retention_days"`
+	Tables        []Table `yaml:"tables"`
+}
+
+// Table is how one table is exported. Only the listed columns leave the
+// database: Columns as they are, Hash keyed-hashed so they still join but
+// can't be read. With a Cursor, each export holds the rows whose cursor moved
+// since the previous one; without, it is a full snapshot.
+type Table struct {
+	Name          string   `yaml:"name"`
+	Cursor        string   `yaml:"cursor"`
+	Columns       []string `yaml:"columns"`
+	Hash          []string `yaml:"hash"`
+	RetentionDays int      `yaml:"retention_days"`
+}
+
+// builtinConfig exports the core tables without names, contact details or
+// free text. Emails are hashed so accounts can still be told apart.
+const builtinConfig = `
+retention_days: 90
+tables:
+  - name: users
+    columns: [id, role, dual_role, status, is_admin, sso_provider_id, created_at, deactivated_at, claimed_at, merged_into, last_active_at, deleted_at]
+    hash: [email]
+  - name: profiles
+    cursor: updated_at
+    columns: [user_id, state, city, zip_code, language, applicant_type, sectors, target_groups, project_stage, public_listing, annual_budget, staff_size, founded_year, created_at, updated_at]
+  - name: provider_data
+    cursor: updated_at
+    columns: [user_id, funding_type, amount_offered, region_scope, deadline, award_min, award_max, created_at, updated_at]
+  - name: recipient_data
+    cursor: updated_at
+    columns: [user_id, needs, budget_requested, team_size, timeline, prior_funding, award_min, award_max, created_at, updated_at]
+  - name: connections
+    columns: [id, initiator_id, target_id, connection_type, created_at, updated_at, funded_at, funded_by]
+  - name: matches
+    columns: [user_id, match_id, match_score, as_role, variant, calculated_at]
+  - name: dismissed_matches
+    cursor: dismissed_at
+    columns: [user_id, match_id, reason, match_score, dismissed_at]
+`
+
+// identifierPattern matches the plain lower-case table and column names the
+// config may use
+var identifierPattern = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+var (
+	configLock sync.RWMutex
+	config     = mustParseConfig(strings.NewReader(builtinConfig))
+)
+
+// LoadConfigFromEnv replaces the built-in config with WAREHOUSE_EXPORT_CONFIG,
+// a YAML file, when set. A config that fails to load keeps the built-in one.
+func LoadConfigFromEnv() {
+	path := os.Getenv("WAREHOUSE_EXPORT_CONFIG")
+	if path == "" {
+		return
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		log.Printf("Error opening warehouse export config, using the built-in one: %v", err)
+		return
+	}
+	defer file.Close()
+
+	loaded, err := parseConfig(file)
+	if err != nil {
+		log.Printf("Error loading warehouse export config, using the built-in one: %v", err)
+		return
+	}
+
+	configLock.Lock()
+	config = loaded
+	configLock.Unlock()
+	log.Printf("Loaded warehouse export config for %d tables from %s", len(loaded.Tables), path)
+}
+
+// currentConfig returns the config in use
+func currentConfig() *Config {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	return config
+}
+
+// parseConfig reads and validates a YAML config
+func parseConfig(r io.Reader) (*Config, error) {
+	var c Config
+	decoder := yaml.NewDecoder(r)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&c); err != nil {
+		return nil, fmt.Errorf("error parsing config: %v", err)
+	}
+
+	if c.RetentionDays < 0 {
+		return nil, fmt.Errorf("retention_days must not be negative")
+	}
+	if c.RetentionDays == 0 {
+		c.RetentionDays = DefaultRetentionDays
+	}
+
+	seen := map[string]bool{}
+	for i := range c.Tables {
+		table := &c.Tables[i]
+		if !identifierPattern.MatchString(table.Name) {
+			return nil, fmt.Errorf("invalid table name %q", table.Name)
+		}
+		if seen[table.Name] {
+			return nil, fmt.Errorf("table %s is listed twice", table.Name)
+		}
+		seen[table.Name] = true
+
+		if len(table.Columns)+len(table.Hash) == 0 {
+			return nil, fmt.Errorf("table %s exports no columns", table.Name)
+		}
+		columns := map[string]bool{}
+		for _, column := range append(append([]string{}, table.Columns...), table.Hash...) {
+			if !identifierPattern.MatchString(column) {
+				return nil, fmt.Errorf("invalid column name %q in table %s", column, table.Name)
+			}
+			if columns[column] {
+				return nil, fmt.Errorf("column %s of table %s is listed twice", column, table.Name)
+			}
+			columns[column] = true
+		}
+		if table.Cursor != "" && !identifierPattern.MatchString(table.Cursor) {
+			return nil, fmt.Errorf("invalid cursor column %q in table %s", table.Cursor, table.Name)
+		}
+
+		if table.RetentionDays < 0 {
+			return nil, fmt.Errorf("retention_days of table %s must not be negative", table.Name)
+		}
+		if table.RetentionDays == 0 {
+			table.RetentionDays = c.RetentionDays
+		}
+	}
+	return &c, nil
+}
+
+// mustParseConfig parses the built-in config
+func mustParseConfig(r io.Reader) *Config {
+	c, err := parseConfig(r)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
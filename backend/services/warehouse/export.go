@@ -0,0 +1,181 @@
+package warehouse
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"matcherator/backend/services/objectstore"
+
+	"github.com/lib/pq"
+)
+
+// nullValue stands for NULL in the CSV files, as in backups
+const nullValue = `\N`
+
+// exportTable writes one table's rows for date to a gzipped CSV, uploads it
+// and records the export. Rows are read in one repeatable-read transaction so
+// the window an incremental export covers matches what it holds.
+func exportTable(ctx context.Context, db *sql.DB, store objectstore.Store, date string, table Table) error {
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("error starting export: %v", err)
+	}
+	defer tx.Rollback()
+
+	var snapshotAt time.Time
+	if err := tx.QueryRowContext(ctx, "SELECT CURRENT_TIMESTAMP").Scan(&snapshotAt); err != nil {
+		return fmt.Errorf("error starting export: %v", err)
+	}
+
+	// Incremental exports continue where the last export of the table stopped;
+	// the first export of a table holds every row up to the window
+	var since sql.NullTime
+	until := snapshotAt.UTC()
+	if table.Cursor != "" {
+		until = until.Add(-cursorLag)
+		err := tx.QueryRowContext(ctx, `
+			SELECT MAX(until) FROM warehouse_exports WHERE table_name = $1
+		`, table.Name).Scan(&since)
+		if err != nil {
+			return fmt.Errorf("error loading last export: %v", err)
+		}
+	}
+	fullSnapshot := table.Cursor == "" || !since.Valid
+
+	columns := make([]string, 0, len(table.Columns)+len(table.Hash))
+	for _, column := range append(append([]string{}, table.Columns...), table.Hash...) {
+		columns = append(columns, pq.QuoteIdentifier(column))
+	}
+	query := "SELECT " + strings.Join(columns, ", ") + " FROM " + pq.QuoteIdentifier(table.Name)
+	var args []interface{}
+	if table.Cursor != "" {
+		cursor := pq.QuoteIdentifier(table.Cursor)
+		if fullSnapshot {
+			query += " WHERE " + cursor + " < $1 OR " + cursor + " IS NULL"
+			args = append(args, until)
+		} else {
+			query += " WHERE " + cursor + " >= $1 AND " + cursor + " < $2"
+			args = append(args, since.Time, until)
+		}
+	}
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("error querying rows: %v", err)
+	}
+	defer rows.Close()
+
+	file, err := os.CreateTemp("", "matcherator-warehouse-*.csv.gz")
+	if err != nil {
+		return fmt.Errorf("error creating export file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	n, err := writeRows(rows, file, table)
+	if err != nil {
+		return err
+	}
+	rows.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("error reading export file: %v", err)
+	}
+	if _, err := file.Seek(0, 0); err != nil {
+		return fmt.Errorf("error reading export file: %v", err)
+	}
+
+	// Partitioned by date so BI tools can load a day, or everything, at once
+	key := fmt.Sprintf("warehouse/%s/date=%s/%s-%s.csv.gz", table.Name, date, table.Name, until.Format("20060102T150405Z"))
+	if err := store.Put(ctx, key, file, info.Size()); err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO warehouse_exports
+			(export_date, table_name, full_snapshot, since, until, object_key, location, row_count, size_bytes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`, date, table.Name, fullSnapshot, since, until, key, store.Location(key), n, info.Size(),
+		time.Now().AddDate(0, 0, table.RetentionDays))
+	if err != nil {
+		if err := store.Delete(context.Background(), key); err != nil {
+			log.Printf("Error deleting warehouse export object %s: %v", key, err)
+		}
+		return fmt.Errorf("error storing export: %v", err)
+	}
+	return nil
+}
+
+// writeRows writes a header row and the rows to w as gzipped CSV, hashing the
+// table's Hash columns, and returns the number of rows
+func writeRows(rows *sql.Rows, w *os.File, table Table) (int64, error) {
+	zw := gzip.NewWriter(w)
+	cw := csv.NewWriter(zw)
+
+	header := append(append([]string{}, table.Columns...), table.Hash...)
+	if err := cw.Write(header); err != nil {
+		return 0, fmt.Errorf("error writing export: %v", err)
+	}
+
+	key := []byte(hashKey())
+	values := make([]sql.NullString, len(header))
+	targets := make([]interface{}, len(header))
+	for i := range values {
+		targets[i] = &values[i]
+	}
+	record := make([]string, len(header))
+
+	var n int64
+	for rows.Next() {
+		if err := rows.Scan(targets...); err != nil {
+			return 0, fmt.Errorf("error scanning row: %v", err)
+		}
+		for i, value := range values {
+			record[i] = nullValue
+			if !value.Valid {
+				continue
+			}
+			record[i] = value.String
+			if i >= len(table.Columns) {
+				record[i] = hashValue(key, value.String)
+			}
+		}
+		if err := cw.Write(record); err != nil {
+			return 0, fmt.Errorf("error writing export: %v", err)
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error iterating rows: %v", err)
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return 0, fmt.Errorf("error writing export: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		return 0, fmt.Errorf("error writing export: %v", err)
+	}
+	return n, nil
+}
+
+// hashValue is the keyed hash personal data is exported as. The same value
+// always hashes the same, so hashed columns still join and count distinct,
+// but without the key they can't be reversed by hashing guesses. Values are
+// compared case-insensitively, as emails are.
+func hashValue(key []byte, value string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(strings.ToLower(strings.TrimSpace(value))))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,258 @@
+// Package warehouse exports the core tables to object storage once a day for
+// BI tooling: a gzipped CSV per table, incremental where the table has a
+// cursor column, with personal data left out or hashed as configured.
+// Exports past their table's retention are deleted.
+package warehouse
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"matcherator/backend/services/jobs"
+	"matcherator/backend/services/objectstore"
+)
+
+// ExportJob is the job kind that exports one day's snapshots
+const ExportJob = "warehouse.export"
+
+const (
+	// exportTimeout bounds one attempt at exporting a day's snapshots
+	exportTimeout = 2 * time.Hour
+
+	// scheduleInterval is how often the day's export is scheduled if it hasn't
+	// been yet, and expired exports are deleted
+	scheduleInterval = time.Hour
+
+	// cursorLag keeps incremental exports this far behind the snapshot, so rows
+	// of transactions still in flight when it was taken are picked up next time
+	cursorLag = 10 * time.Minute
+
+	// dateLayout is how export dates are written in payloads and object keys
+	dateLayout = "2006-01-02"
+)
+
+// ErrNotConfigured is returned when exports are not set up: there is no
+// object storage or no WAREHOUSE_HASH_KEY to hash personal data with
+var ErrNotConfigured = errors.New("warehouse export is not configured")
+
+// Export is one table's snapshot of a day
+type Export struct {
+	ID           int        `json:"id"`
+	ExportDate   string     `json:"export_date"`
+	Table        string     `json:"table"`
+	FullSnapshot bool       `json:"full_snapshot"`
+	Since        *time.Time `json:"since"` // Rows whose cursor moved from here, for incremental exports
+	Until        time.Time  `json:"until"`
+	Location     *string    `json:"location"` // Where the object is stored, until retention deletes it
+	Rows         int64      `json:"rows"`
+	SizeBytes    int64      `json:"size_bytes"`
+	CreatedAt    time.Time  `json:"created_at"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+}
+
+// ExportPayload is the payload of an ExportJob
+type ExportPayload struct {
+	ExportDate string `json:"export_date"`
+}
+
+// RegisterJobs installs the handler of ExportJob
+func RegisterJobs(db *sql.DB) {
+	jobs.RegisterWithTimeout(ExportJob, exportTimeout, ExportJobHandler(db))
+}
+
+// hashKey is the HMAC key personal data is hashed with, from WAREHOUSE_HASH_KEY
+func hashKey() string {
+	return os.Getenv("WAREHOUSE_HASH_KEY")
+}
+
+// Configured reports whether exports can run
+func Configured() bool {
+	return objectstore.Current() != nil && hashKey() != ""
+}
+
+// StartScheduler schedules the export of each UTC day and deletes expired
+// exports, checking every hour until ctx is done. Nothing runs until exports
+// are configured.
+func StartScheduler(ctx context.Context, db *sql.DB) {
+	go func() {
+		ticker := time.NewTicker(scheduleInterval)
+		defer ticker.Stop()
+
+		for {
+			if Configured() {
+				if err := schedule(db, time.Now().UTC().Format(dateLayout)); err != nil {
+					log.Printf("Error scheduling warehouse export: %v", err)
+				}
+				if err := purgeExpired(ctx, db); err != nil {
+					log.Printf("Error purging expired warehouse exports: %v", err)
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// schedule queues the export of date unless it already was. Claiming the date
+// in warehouse_runs keeps several backend instances from queueing it twice.
+func schedule(db *sql.DB, date string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting warehouse run: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT INTO warehouse_runs (export_date) VALUES ($1)
+		ON CONFLICT (export_date) DO NOTHING
+	`, date)
+	if err != nil {
+		return fmt.Errorf("error claiming warehouse run: %v", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil
+	}
+
+	jobID, err := jobs.Enqueue(tx, ExportJob, ExportPayload{ExportDate: date})
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE warehouse_runs SET job_id = $2 WHERE export_date = $1", date, jobID); err != nil {
+		return fmt.Errorf("error linking warehouse run job: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing warehouse run: %v", err)
+	}
+	log.Printf("Scheduled warehouse export of %s", date)
+	return nil
+}
+
+// ExportJobHandler exports every configured table not yet exported for the
+// payload's date. Each table is stored as soon as it is uploaded, so a retry
+// picks up where a failed attempt stopped, and one failing table does not
+// hold up the others.
+func ExportJobHandler(db *sql.DB) jobs.Handler {
+	return func(ctx context.Context, payload json.RawMessage) error {
+		var p ExportPayload
+		if err := json.Unmarshal(payload, &p); err != nil {
+			return jobs.Permanent(fmt.Errorf("error decoding warehouse export: %v", err))
+		}
+		if _, err := time.Parse(dateLayout, p.ExportDate); err != nil {
+			return jobs.Permanent(fmt.Errorf("invalid warehouse export date %q", p.ExportDate))
+		}
+
+		store := objectstore.Current()
+		if store == nil || hashKey() == "" {
+			return ErrNotConfigured
+		}
+
+		var failed error
+		tables := currentConfig().Tables
+		for i, table := range tables {
+			var done bool
+			err := db.QueryRowContext(ctx, `
+				SELECT EXISTS (SELECT 1 FROM warehouse_exports WHERE export_date = $1 AND table_name = $2)
+			`, p.ExportDate, table.Name).Scan(&done)
+			if err != nil {
+				return fmt.Errorf("error checking warehouse export of %s: %v", table.Name, err)
+			}
+
+			if !done {
+				if err := exportTable(ctx, db, store, p.ExportDate, table); err != nil {
+					log.Printf("Error exporting %s to the warehouse: %v", table.Name, err)
+					if failed == nil {
+						failed = fmt.Errorf("error exporting %s: %v", table.Name, err)
+					}
+				}
+			}
+
+			if err := jobs.SetProgress(ctx, db, map[string]int{"tables_done": i + 1, "tables": len(tables)}); err != nil {
+				log.Printf("Error reporting warehouse export progress: %v", err)
+			}
+		}
+		return failed
+	}
+}
+
+// List returns the most recent table exports, newest first
+func List(db *sql.DB, limit int) ([]Export, error) {
+	rows, err := db.Query(`
+		SELECT id, export_date::text, table_name, full_snapshot, since, until,
+			CASE WHEN object_key IS NOT NULL THEN location END,
+			row_count, size_bytes, created_at, expires_at
+		FROM warehouse_exports
+		ORDER BY export_date DESC, table_name
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error listing warehouse exports: %v", err)
+	}
+	defer rows.Close()
+
+	exports := []Export{}
+	for rows.Next() {
+		var e Export
+		err := rows.Scan(&e.ID, &e.ExportDate, &e.Table, &e.FullSnapshot, &e.Since, &e.Until,
+			&e.Location, &e.Rows, &e.SizeBytes, &e.CreatedAt, &e.ExpiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning warehouse export: %v", err)
+		}
+		exports = append(exports, e)
+	}
+	return exports, rows.Err()
+}
+
+// purgeExpired deletes the objects of exports past their retention, then
+// forgets their keys
+func purgeExpired(ctx context.Context, db *sql.DB) error {
+	store := objectstore.Current()
+	if store == nil {
+		return nil
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, object_key FROM warehouse_exports
+		WHERE object_key IS NOT NULL AND expires_at <= CURRENT_TIMESTAMP
+	`)
+	if err != nil {
+		return fmt.Errorf("error querying expired warehouse exports: %v", err)
+	}
+	defer rows.Close()
+
+	expired := map[int]string{}
+	for rows.Next() {
+		var id int
+		var key string
+		if err := rows.Scan(&id, &key); err != nil {
+			return fmt.Errorf("error scanning expired warehouse export: %v", err)
+		}
+		expired[id] = key
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// The key is only forgotten once the object is gone, so failed deletes
+	// are retried on the next run
+	for id, key := range expired {
+		if err := store.Delete(ctx, key); err != nil {
+			log.Printf("Error deleting expired warehouse export %d: %v", id, err)
+			continue
+		}
+		if _, err := db.ExecContext(ctx, "UPDATE warehouse_exports SET object_key = NULL WHERE id = $1", id); err != nil {
+			return fmt.Errorf("error marking warehouse export %d deleted: %v", id, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"matcherator/backend/services/jobs"
+)
+
+// DeliverJob is the job kind that POSTs one event to a webhook endpoint
+const DeliverJob = "webhooks.deliver"
+
+// Headers sent with every delivery
+const (
+	EventHeader     = "X-Matcherator-Event"
+	SignatureHeader = "X-Matcherator-Signature"
+)
+
+// deliveryTimeout bounds a single delivery attempt
+const deliveryTimeout = 10 * time.Second
+
+// Delivery is the payload of a DeliverJob
+type Delivery struct {
+	URL   string          `json:"url"`
+	Event string          `json:"event"`
+	Data  json.RawMessage `json:"data"`
+}
+
+var client = &http.Client{Timeout: deliveryTimeout}
+
+// Enqueue queues delivery of event with data, encoded as JSON, to endpoint
+func Enqueue(q jobs.Querier, endpoint, event string, data interface{}) error {
+	if err := validateURL(endpoint); err != nil {
+		return err
+	}
+	body, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("error encoding webhook data: %v", err)
+	}
+	_, err = jobs.Enqueue(q, DeliverJob, Delivery{URL: endpoint, Event: event, Data: body})
+	return err
+}
+
+// DeliverJobHandler POSTs queued events. When WEBHOOK_SIGNING_SECRET is set the
+// body is signed as "sha256=<hex HMAC>" in X-Matcherator-Signature. Client errors
+// other than 408 and 429 are not retried.
+func DeliverJobHandler() jobs.Handler {
+	return func(ctx context.Context, payload json.RawMessage) error {
+		var delivery Delivery
+		if err := json.Unmarshal(payload, &delivery); err != nil {
+			return jobs.Permanent(fmt.Errorf("error decoding webhook delivery: %v", err))
+		}
+		if err := validateURL(delivery.URL); err != nil {
+			return jobs.Permanent(err)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Data))
+		if err != nil {
+			return jobs.Permanent(fmt.Errorf("error creating webhook request: %v", err))
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(EventHeader, delivery.Event)
+		if secret := os.Getenv("WEBHOOK_SIGNING_SECRET"); secret != "" {
+			mac := hmac.New(sha256.New, []byte(secret))
+			mac.Write(delivery.Data)
+			req.Header.Set(SignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return fmt.Errorf("error delivering webhook: %v", err)
+		}
+		defer resp.Body.Close()
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+		switch {
+		case resp.StatusCode >= 200 && resp.StatusCode < 300:
+			return nil
+		case resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+			resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests:
+			return jobs.Permanent(fmt.Errorf("webhook endpoint rejected delivery with status %d", resp.StatusCode))
+		default:
+			return fmt.Errorf("webhook endpoint returned status %d", resp.StatusCode)
+		}
+	}
+}
+
+// validateURL accepts absolute http(s) URLs
+func validateURL(endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("invalid webhook URL %q", endpoint)
+	}
+	return nil
+}
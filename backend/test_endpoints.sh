@@ -115,6 +115,33 @@ RECIPIENT_TOKEN=$(curl -s -X POST "http://localhost:8080/api/auth/login" \
 echo "Provider token: $PROVIDER_TOKEN"
 echo "Recipient token: $RECIPIENT_TOKEN"
 
+# Test auth sessions with a separate provider login, so the tokens above stay valid
+echo -e "\n${GREEN}Testing auth sessions...${NC}"
+SESSION_REFRESH_TOKEN=$(curl -s -X POST "$BASE_URL/api/auth/login" \
+    -H "Content-Type: application/json" \
+    -d "{\"email\": \"$PROVIDER_EMAIL\", \"password\": \"testpass123\"}" | jq -r '.refresh_token')
+
+echo "Refreshing the session..."
+REFRESHED=$(curl -s -X POST "$BASE_URL/api/auth/refresh" \
+    -H "Content-Type: application/json" \
+    -d "{\"refresh_token\": \"$SESSION_REFRESH_TOKEN\"}")
+echo "$REFRESHED" | jq .
+SESSION_TOKEN=$(echo "$REFRESHED" | jq -r '.token')
+NEW_REFRESH_TOKEN=$(echo "$REFRESHED" | jq -r '.refresh_token')
+
+test_endpoint "GET" "/api/me/sessions" "" "Get Provider Sessions" "$PROVIDER_TOKEN"
+SESSION_ID=$(curl -s -X GET "$BASE_URL/api/me/sessions" -H "Authorization: Bearer $SESSION_TOKEN" | jq -r '.[] | select(.current) | .id')
+test_endpoint "DELETE" "/api/me/sessions/$SESSION_ID" "" "Delete Session" "$PROVIDER_TOKEN"
+test_endpoint "GET" "/api/me" "" "Use Token of Deleted Session (expect 401)" "$SESSION_TOKEN"
+test_endpoint "POST" "/api/auth/refresh" "{\"refresh_token\": \"$NEW_REFRESH_TOKEN\"}" "Refresh Deleted Session (expect 401)" ""
+test_endpoint "POST" "/api/auth/refresh" "{\"refresh_token\": \"$SESSION_REFRESH_TOKEN\"}" "Reuse Refresh Token (expect 401)" ""
+
+# Test password reset (forgot-password answers 503 unless mail is configured)
+echo -e "\n${GREEN}Testing password reset...${NC}"
+test_endpoint "POST" "/api/auth/forgot-password" "{\"email\": \"$PROVIDER_EMAIL\"}" "Forgot Password" ""
+test_endpoint "POST" "/api/auth/reset-password" '{"token": "invalid", "password": "newpass12345"}' "Reset Password with Invalid Token (expect 400)" ""
+test_endpoint "POST" "/api/auth/reset-password" '{"token": "invalid", "password": "short"}' "Reset Password Too Short (expect 400)" ""
+
 # Test endpoints as provider
 echo -e "\n${GREEN}Testing endpoints as provider...${NC}"
 
@@ -142,6 +169,43 @@ test_endpoint "GET" "/api/me/bio" "" "Get My Bio" "$PROVIDER_TOKEN"
 # Test potential matches
 echo -e "\n${GREEN}Testing potential matches...${NC}"
 test_endpoint "GET" "/api/potential-matches" "" "Get Potential Matches" "$PROVIDER_TOKEN"
+test_endpoint "GET" "/api/potential-matches?as=provider&limit=5&offset=0" "" "Get Potential Matches Page as Provider" "$PROVIDER_TOKEN"
+test_endpoint "GET" "/api/potential-matches?limit=0" "" "Get Potential Matches with Invalid Limit (expect 400)" "$PROVIDER_TOKEN"
+
+# Test match recalculation jobs (within the cooldown the stored matches are returned instead of a job)
+echo -e "\n${GREEN}Testing match recalculation...${NC}"
+RECALCULATION=$(curl -s -X POST "$BASE_URL/api/potential-matches/recalculate" -H "Authorization: Bearer $PROVIDER_TOKEN")
+echo "$RECALCULATION" | jq .
+JOB_ID=$(echo "$RECALCULATION" | jq -r '.job_id // empty')
+if [ -n "$JOB_ID" ]; then
+    test_endpoint "GET" "/api/potential-matches/recalculate/$JOB_ID" "" "Get Recalculation" "$PROVIDER_TOKEN"
+    test_endpoint "GET" "/api/potential-matches/recalculate/$JOB_ID" "" "Get Another User's Recalculation (expect 404)" "$RECIPIENT_TOKEN"
+else
+    echo "Recalculation is cooling down; no job to poll"
+fi
+
+# Test match dismissals
+echo -e "\n${GREEN}Testing match dismissals...${NC}"
+test_endpoint "DELETE" "/api/matches/dismiss/$PROVIDER_ID" '{"reason": "boring"}' "Dismiss Match with Unknown Reason (expect 400)" "$RECIPIENT_TOKEN"
+test_endpoint "DELETE" "/api/matches/dismiss/$PROVIDER_ID" '{"reason": "wrong_sector", "comment": "Not our focus area"}' "Dismiss Match" "$RECIPIENT_TOKEN"
+test_endpoint "GET" "/api/matches/dismissed" "" "Get Dismissed Matches" "$RECIPIENT_TOKEN"
+
+# Dismissal analytics are admin only; make the provider an admin for the call
+test_endpoint "GET" "/api/admin/matching/dismissals" "" "Get Dismissal Analytics as Non-Admin (expect 403)" "$PROVIDER_TOKEN"
+PGPASSWORD=$DB_PASS psql -U $DB_USER -h $DB_HOST -d $DB_NAME -c "UPDATE users SET is_admin = true WHERE id = $PROVIDER_ID;" -q
+test_endpoint "GET" "/api/admin/matching/dismissals?role=recipient" "" "Get Dismissal Analytics" "$PROVIDER_TOKEN"
+test_endpoint "GET" "/api/admin/matching/dismissals?since=yesterday" "" "Get Dismissal Analytics with Invalid Date (expect 400)" "$PROVIDER_TOKEN"
+PGPASSWORD=$DB_PASS psql -U $DB_USER -h $DB_HOST -d $DB_NAME -c "UPDATE users SET is_admin = false WHERE id = $PROVIDER_ID;" -q
+
+test_endpoint "POST" "/api/matches/dismiss/$PROVIDER_ID/restore" "" "Restore Dismissed Match" "$RECIPIENT_TOKEN"
+test_endpoint "POST" "/api/matches/dismiss/$PROVIDER_ID/restore" "" "Restore Match Not Dismissed (expect 404)" "$RECIPIENT_TOKEN"
+
+# Test profile search
+echo -e "\n${GREEN}Testing profile search...${NC}"
+test_endpoint "GET" "/api/search/profiles?q=Test&limit=5" "" "Search Profiles" "$RECIPIENT_TOKEN"
+test_endpoint "GET" "/api/search/profiles?sectors=Technology,Health&role=provider&offset=0" "" "Search Profiles by Sector and Role" "$RECIPIENT_TOKEN"
+test_endpoint "GET" "/api/search/profiles?q=$(printf 'a%.0s' {1..201})" "" "Search with Too Long Query (expect 400)" "$RECIPIENT_TOKEN"
+test_endpoint "GET" "/api/search/profiles?role=admin" "" "Search with Invalid Role (expect 400)" "$RECIPIENT_TOKEN"
 
 # Test WebSocket endpoints (these will only test the HTTP upgrade request)
 echo -e "\n${GREEN}Testing WebSocket endpoints...${NC}"
@@ -247,6 +311,13 @@ echo -e "\n${GREEN}Testing profile picture upload/delete for recipient...${NC}"
 test_endpoint "POST" "/api/upload/profile-picture" "" "Upload Profile Picture" "$RECIPIENT_TOKEN" "test_image.png"
 test_endpoint "DELETE" "/api/upload/profile-picture" "" "Delete Profile Picture" "$RECIPIENT_TOKEN"
 
+# Test signing out
+echo -e "\n${GREEN}Testing sign out...${NC}"
+test_endpoint "DELETE" "/api/me/sessions?keep_current=true" "" "Sign Out Other Sessions" "$RECIPIENT_TOKEN"
+test_endpoint "POST" "/api/auth/logout" "" "Logout Provider" "$PROVIDER_TOKEN"
+test_endpoint "POST" "/api/auth/logout" "" "Logout Recipient" "$RECIPIENT_TOKEN"
+test_endpoint "GET" "/api/me" "" "Use Token After Logout (expect 401)" "$PROVIDER_TOKEN"
+
 # Clean up test image
 rm test_image.png
 
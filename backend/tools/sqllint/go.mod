@@ -0,0 +1,10 @@
+module matcherator/backend/tools/sqllint
+
+go 1.22
+
+require github.com/pganalyze/pg_query_go/v5 v5.1.0
+
+require (
+	github.com/google/go-cmp v0.5.5 // indirect
+	google.golang.org/protobuf v1.31.0 // indirect
+)
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// scope is what a statement's names can refer to. Aliases are collected
+// across the whole statement rather than per subquery, which only makes the
+// check more lenient.
+type scope struct {
+	aliases map[string][]string // Table alias or name to the tables it stands for
+	opaque  map[string]bool     // Subqueries, functions and CTEs, whose columns aren't checked
+	names   map[string]bool     // Names an unqualified column may have
+	target  string              // Table an INSERT, UPDATE or DELETE writes
+	catalog bool                // Whether a table outside the schema, such as information_schema's, is read
+}
+
+// lint returns the problems of a query
+func lint(schema *Schema, q Query) []string {
+	statements, err := parse(q.SQL)
+	if err != nil {
+		return []string{fmt.Sprintf("does not parse: %v", err)}
+	}
+
+	var problems []string
+	if len(statements) > 1 && q.HasArgs {
+		problems = append(problems, "several statements in a call with arguments, which Postgres rejects")
+	}
+	if len(statements) == 1 && q.Dests > 0 {
+		if columns := resultColumns(statements[0]); columns >= 0 && columns != q.Dests {
+			problems = append(problems, fmt.Sprintf("returns %d columns but is scanned into %d", columns, q.Dests))
+		}
+	}
+	for _, stmt := range statements {
+		problems = append(problems, check(schema, stmt)...)
+	}
+	return problems
+}
+
+// resultColumns returns the number of columns a statement returns, -1 when
+// it can't tell, as for a * in the select list
+func resultColumns(stmt node) int {
+	var targets []node
+	switch {
+	case stmt["SelectStmt"] != nil:
+		sel := child(stmt, "SelectStmt")
+		// The columns of a UNION, INTERSECT or EXCEPT are its first operand's
+		for child(sel, "larg") != nil {
+			sel = child(sel, "larg")
+		}
+		targets = list(sel, "targetList")
+	case stmt["InsertStmt"] != nil:
+		targets = list(child(stmt, "InsertStmt"), "returningList")
+	case stmt["UpdateStmt"] != nil:
+		targets = list(child(stmt, "UpdateStmt"), "returningList")
+	case stmt["DeleteStmt"] != nil:
+		targets = list(child(stmt, "DeleteStmt"), "returningList")
+	}
+	if len(targets) == 0 {
+		return -1
+	}
+	for _, target := range targets {
+		for _, field := range list(child(child(child(target, "ResTarget"), "val"), "ColumnRef"), "fields") {
+			if field["A_Star"] != nil {
+				return -1
+			}
+		}
+	}
+	return len(targets)
+}
+
+func check(schema *Schema, stmt node) []string {
+	problems := map[string]bool{}
+	report := func(format string, args ...interface{}) {
+		problems[fmt.Sprintf(format, args...)] = true
+	}
+
+	// FOR UPDATE OF names tables by their aliases
+	dropLocking(stmt)
+	s := collectScope(schema, stmt)
+	known := func(table string) bool {
+		return schema.relations[table] != nil || s.opaque[table]
+	}
+
+	// Tables
+	walk(stmt, func(kind string, fields node) {
+		var relation node
+		switch kind {
+		case "RangeVar":
+			relation = fields
+		case "InsertStmt", "UpdateStmt", "DeleteStmt":
+			relation = child(fields, "relation")
+		default:
+			return
+		}
+		if name := str(relation, "relname"); str(relation, "schemaname") == "" && !known(name) {
+			report("unknown table %s", name)
+		}
+	})
+
+	// Columns
+	hasColumn := func(tables []string, column string) bool {
+		for _, table := range tables {
+			columns := schema.relations[table]
+			if columns == nil || columns[column] {
+				return true
+			}
+		}
+		return false
+	}
+	walk(stmt, func(kind string, fields node) {
+		switch kind {
+		case "ColumnRef":
+			var names []string
+			for _, field := range list(fields, "fields") {
+				name := str(child(field, "String"), "sval")
+				if name == "" {
+					return // table.*
+				}
+				names = append(names, name)
+			}
+			switch len(names) {
+			case 1:
+				if !s.catalog && !s.names[names[0]] {
+					report("unknown column %s", names[0])
+				}
+			case 2:
+				alias, column := names[0], names[1]
+				tables := s.aliases[alias]
+				if alias == "excluded" && s.target != "" {
+					tables = []string{s.target}
+				}
+				if s.opaque[alias] {
+					return
+				}
+				if len(tables) == 0 {
+					report("unknown table or alias %s in %s.%s", alias, alias, column)
+				} else if !hasColumn(tables, column) {
+					report("%s has no column %s", strings.Join(tables, "/"), column)
+				}
+			}
+
+		case "InsertStmt", "UpdateStmt":
+			table := str(child(fields, "relation"), "relname")
+			targets := list(fields, "cols")
+			if kind == "UpdateStmt" {
+				targets = list(fields, "targetList")
+			}
+			if conflict := child(fields, "onConflictClause"); conflict != nil {
+				targets = append(targets, list(conflict, "targetList")...)
+			}
+			for _, target := range targets {
+				if column := str(child(target, "ResTarget"), "name"); !hasColumn([]string{table}, column) {
+					report("%s has no column %s", table, column)
+				}
+			}
+		}
+	})
+
+	sorted := make([]string, 0, len(problems))
+	for problem := range problems {
+		sorted = append(sorted, problem)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+func collectScope(schema *Schema, stmt node) *scope {
+	s := &scope{
+		aliases: map[string][]string{},
+		opaque:  map[string]bool{},
+		names:   map[string]bool{},
+	}
+	addTable := func(relation node) {
+		table := str(relation, "relname")
+		name := table
+		if alias := str(child(relation, "alias"), "aliasname"); alias != "" {
+			name = alias
+		}
+		s.aliases[name] = append(s.aliases[name], table)
+		s.names[name] = true
+		for column := range schema.relations[table] {
+			s.names[column] = true
+		}
+	}
+	addAlias := func(alias node) {
+		if name := str(alias, "aliasname"); name != "" {
+			s.opaque[name] = true
+			s.names[name] = true
+		}
+		for _, column := range list(alias, "colnames") {
+			s.names[str(child(column, "String"), "sval")] = true
+		}
+	}
+
+	walk(stmt, func(kind string, fields node) {
+		switch kind {
+		case "RangeVar":
+			addTable(fields)
+			s.catalog = s.catalog || str(fields, "schemaname") != ""
+		case "InsertStmt", "UpdateStmt", "DeleteStmt":
+			relation := child(fields, "relation")
+			addTable(relation)
+			s.target = str(relation, "relname")
+		case "RangeSubselect":
+			addAlias(child(fields, "alias"))
+		case "RangeFunction":
+			addAlias(child(fields, "alias"))
+			// Without a column list, a function's column is named after it
+			walk(fields["functions"], func(kind string, call node) {
+				if kind == "FuncCall" {
+					if name := list(call, "funcname"); len(name) > 0 {
+						s.names[str(child(name[len(name)-1], "String"), "sval")] = true
+					}
+				}
+			})
+		case "CommonTableExpr":
+			name := str(fields, "ctename")
+			s.opaque[name] = true
+			for _, column := range list(fields, "aliascolnames") {
+				s.names[str(child(column, "String"), "sval")] = true
+			}
+		case "ResTarget":
+			if name := outputName(fields); name != "" {
+				s.names[name] = true
+			}
+		}
+	})
+	return s
+}
+
+// dropLocking removes the locking clauses under n
+func dropLocking(n interface{}) {
+	switch v := n.(type) {
+	case map[string]interface{}:
+		delete(v, "lockingClause")
+		for _, value := range v {
+			dropLocking(value)
+		}
+	case []interface{}:
+		for _, item := range v {
+			dropLocking(item)
+		}
+	}
+}
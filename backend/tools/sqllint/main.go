@@ -0,0 +1,86 @@
+// Command sqllint checks the SQL the backend sends against init.sql without a
+// database. It finds the query passed to every Query, QueryRow, Exec and
+// Prepare call (and their Context variants) whose SQL is a constant, parses
+// it with the Postgres parser and reports:
+//
+//   - statements that don't parse, such as a trailing comma in a select list
+//     or an unexpanded ${...} placeholder
+//   - tables that init.sql doesn't create
+//   - columns a table doesn't have, when qualified by the table or its alias
+//     or named by INSERT and UPDATE
+//   - several statements in one call that also passes arguments
+//   - rows scanned into a different number of destinations than the query
+//     returns columns, for a QueryRow call scanned right away or a Query
+//     call whose rows variable is scanned
+//
+// Queries built at run time are skipped; the startup schema check prepares
+// the handler queries against the real database.
+//
+//	cd backend/tools/sqllint && go run . -schema ../../init.sql ../..
+//
+// It exits with status 1 when it reports anything. It lives in its own module
+// because the parser needs cgo, which the server build doesn't.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+)
+
+func main() {
+	log.SetFlags(0)
+	schemaPath := flag.String("schema", "init.sql", "schema the queries run against")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: sqllint [-schema init.sql] [dir ...]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	dirs := flag.Args()
+	if len(dirs) == 0 {
+		dirs = []string{"."}
+	}
+
+	source, err := os.ReadFile(*schemaPath)
+	if err != nil {
+		log.Fatalf("error reading schema: %v", err)
+	}
+	schema, err := loadSchema(string(source))
+	if err != nil {
+		log.Fatalf("error loading %s: %v", *schemaPath, err)
+	}
+
+	var queries []Query
+	for _, dir := range dirs {
+		found, err := findQueries(dir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		queries = append(queries, found...)
+	}
+
+	// Tables the code creates itself, such as temporary ones, are known to
+	// every query
+	for _, q := range queries {
+		schema.addCreated(q.SQL)
+	}
+
+	var problems []string
+	for _, q := range queries {
+		for _, problem := range lint(schema, q) {
+			problems = append(problems, fmt.Sprintf("%s: %s", q.Pos, problem))
+		}
+	}
+	sort.Strings(problems)
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+
+	log.Printf("%d queries checked, %d problems", len(queries), len(problems))
+	if len(problems) > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+
+	pg_query "github.com/pganalyze/pg_query_go/v5"
+)
+
+// node is a parse tree node as pg_query renders it in JSON
+type node = map[string]interface{}
+
+// Schema is the tables and views the queries can use, with their columns
+type Schema struct {
+	relations map[string]map[string]bool
+}
+
+// loadSchema reads the tables, added columns and views of a schema script
+func loadSchema(sql string) (*Schema, error) {
+	statements, err := parse(sql)
+	if err != nil {
+		return nil, err
+	}
+	s := &Schema{relations: map[string]map[string]bool{}}
+	for _, stmt := range statements {
+		s.apply(stmt)
+	}
+	return s, nil
+}
+
+// addCreated adds the tables sql creates, if it parses
+func (s *Schema) addCreated(sql string) {
+	statements, err := parse(sql)
+	if err != nil {
+		return
+	}
+	for _, stmt := range statements {
+		if _, ok := stmt["CreateStmt"]; ok {
+			s.apply(stmt)
+		}
+	}
+}
+
+func (s *Schema) apply(stmt node) {
+	switch {
+	case stmt["CreateStmt"] != nil:
+		create := child(stmt, "CreateStmt")
+		name := str(child(create, "relation"), "relname")
+		columns := s.relations[name]
+		if columns == nil {
+			columns = map[string]bool{}
+			s.relations[name] = columns
+		}
+		for _, elt := range list(create, "tableElts") {
+			if def := child(elt, "ColumnDef"); def != nil {
+				columns[str(def, "colname")] = true
+			} else if like := child(elt, "TableLikeClause"); like != nil {
+				for column := range s.relations[str(child(like, "relation"), "relname")] {
+					columns[column] = true
+				}
+			}
+		}
+
+	case stmt["AlterTableStmt"] != nil:
+		alter := child(stmt, "AlterTableStmt")
+		columns := s.relations[str(child(alter, "relation"), "relname")]
+		if columns == nil {
+			return
+		}
+		for _, cmd := range list(alter, "cmds") {
+			cmd = child(cmd, "AlterTableCmd")
+			if str(cmd, "subtype") == "AT_AddColumn" {
+				columns[str(child(child(cmd, "def"), "ColumnDef"), "colname")] = true
+			}
+		}
+
+	case stmt["ViewStmt"] != nil:
+		view := child(stmt, "ViewStmt")
+		columns := map[string]bool{}
+		s.relations[str(child(view, "view"), "relname")] = columns
+		if aliases := list(view, "aliases"); len(aliases) > 0 {
+			for _, alias := range aliases {
+				columns[str(child(alias, "String"), "sval")] = true
+			}
+			return
+		}
+		for _, target := range list(child(child(view, "query"), "SelectStmt"), "targetList") {
+			if name := outputName(child(target, "ResTarget")); name != "" {
+				columns[name] = true
+			}
+		}
+	}
+}
+
+// outputName is the name of a select list item: its alias, or the column it
+// names
+func outputName(target node) string {
+	if name := str(target, "name"); name != "" {
+		return name
+	}
+	ref := child(child(target, "val"), "ColumnRef")
+	fields := list(ref, "fields")
+	if len(fields) == 0 {
+		return ""
+	}
+	return str(child(fields[len(fields)-1], "String"), "sval")
+}
+
+// parse returns the statements of sql as parse trees
+func parse(sql string) ([]node, error) {
+	tree, err := pg_query.ParseToJSON(sql)
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		Stmts []struct {
+			Stmt node `json:"stmt"`
+		} `json:"stmts"`
+	}
+	if err := json.Unmarshal([]byte(tree), &result); err != nil {
+		return nil, err
+	}
+	statements := make([]node, len(result.Stmts))
+	for i, stmt := range result.Stmts {
+		statements[i] = stmt.Stmt
+	}
+	return statements, nil
+}
+
+func child(n node, key string) node {
+	c, _ := n[key].(map[string]interface{})
+	return c
+}
+
+func list(n node, key string) []node {
+	items, _ := n[key].([]interface{})
+	nodes := make([]node, 0, len(items))
+	for _, item := range items {
+		if c, ok := item.(map[string]interface{}); ok {
+			nodes = append(nodes, c)
+		}
+	}
+	return nodes
+}
+
+func str(n node, key string) string {
+	s, _ := n[key].(string)
+	return s
+}
+
+// walk calls fn with the type and fields of every node under n
+func walk(n interface{}, fn func(kind string, fields node)) {
+	switch v := n.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if fields, ok := value.(map[string]interface{}); ok && len(v) == 1 && key[0] >= 'A' && key[0] <= 'Z' {
+				fn(key, fields)
+			}
+			walk(value, fn)
+		}
+	case []interface{}:
+		for _, item := range v {
+			walk(item, fn)
+		}
+	}
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Query is SQL passed to a database call
+type Query struct {
+	Pos     token.Position
+	SQL     string
+	HasArgs bool
+	Dests   int // Destinations its rows are scanned into, 0 when unknown
+}
+
+// sqlArg is the index of the SQL argument of each database method
+var sqlArg = map[string]int{
+	"Query":           0,
+	"QueryRow":        0,
+	"Exec":            0,
+	"Prepare":         0,
+	"QueryContext":    1,
+	"QueryRowContext": 1,
+	"ExecContext":     1,
+	"PrepareContext":  1,
+}
+
+// skipDirs are never searched for queries
+var skipDirs = map[string]bool{"tools": true, "vendor": true, "testdata": true, "node_modules": true}
+
+// constant is a const declaration and the file it is in, which resolves the
+// package names it refers to
+type constant struct {
+	expr ast.Expr
+	file *ast.File
+}
+
+type goPackage struct {
+	files  []*ast.File
+	consts map[string]constant
+}
+
+type finder struct {
+	fset     *token.FileSet
+	packages map[string]*goPackage // By import path
+}
+
+// findQueries returns the constant SQL passed to database calls in the Go
+// packages under dir
+func findQueries(dir string) ([]Query, error) {
+	root, module, err := findModule(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &finder{fset: token.NewFileSet(), packages: map[string]*goPackage{}}
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p != dir && (skipDirs[d.Name()] || strings.HasPrefix(d.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(p, ".go") || strings.HasSuffix(p, "_test.go") {
+			return nil
+		}
+
+		file, err := parser.ParseFile(f.fset, p, nil, parser.SkipObjectResolution)
+		if err != nil {
+			return fmt.Errorf("error parsing %s: %v", p, err)
+		}
+		abs, err := filepath.Abs(filepath.Dir(p))
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, abs)
+		if err != nil {
+			return err
+		}
+		importPath := path.Join(module, filepath.ToSlash(rel))
+		pkg := f.packages[importPath]
+		if pkg == nil {
+			pkg = &goPackage{consts: map[string]constant{}}
+			f.packages[importPath] = pkg
+		}
+		pkg.files = append(pkg.files, file)
+		for _, decl := range file.Decls {
+			if gen, ok := decl.(*ast.GenDecl); ok {
+				collectConsts(gen, file, pkg.consts)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var queries []Query
+	for _, pkg := range f.packages {
+		for _, file := range pkg.files {
+			queries = append(queries, f.fileQueries(pkg, file)...)
+		}
+	}
+	return queries, nil
+}
+
+// findModule returns the absolute directory of the go.mod above dir and its
+// module path
+func findModule(dir string) (string, string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", "", err
+	}
+	for d := abs; ; d = filepath.Dir(d) {
+		data, err := os.ReadFile(filepath.Join(d, "go.mod"))
+		if err == nil {
+			for _, line := range strings.Split(string(data), "\n") {
+				if fields := strings.Fields(line); len(fields) == 2 && fields[0] == "module" {
+					return d, fields[1], nil
+				}
+			}
+			return "", "", fmt.Errorf("%s has no module line", filepath.Join(d, "go.mod"))
+		}
+		if filepath.Dir(d) == d {
+			return "", "", fmt.Errorf("no go.mod above %s", dir)
+		}
+	}
+}
+
+func collectConsts(gen *ast.GenDecl, file *ast.File, consts map[string]constant) {
+	if gen.Tok != token.CONST {
+		return
+	}
+	for _, spec := range gen.Specs {
+		value := spec.(*ast.ValueSpec)
+		for i, name := range value.Names {
+			if i < len(value.Values) {
+				consts[name.Name] = constant{value.Values[i], file}
+			}
+		}
+	}
+}
+
+// fileQueries returns the queries of the database calls in file
+func (f *finder) fileQueries(pkg *goPackage, file *ast.File) []Query {
+	var queries []Query
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Body == nil {
+			continue
+		}
+
+		locals := localValues(fn.Body, file)
+		dests := scanDests(fn.Body)
+		ast.Inspect(fn.Body, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			sel, ok := call.Fun.(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			index, ok := sqlArg[sel.Sel.Name]
+			if !ok || len(call.Args) <= index {
+				return true
+			}
+			// A variable set in several branches is checked with each value
+			arg := call.Args[index]
+			values := []constant{{arg, file}}
+			if ident, ok := arg.(*ast.Ident); ok && len(locals[ident.Name]) > 1 {
+				values = locals[ident.Name]
+			}
+			for _, value := range values {
+				if sql, ok := f.eval(pkg, file, locals, value.expr, 0); ok {
+					queries = append(queries, Query{
+						Pos:     f.fset.Position(arg.Pos()),
+						SQL:     sql,
+						HasArgs: len(call.Args) > index+1,
+						Dests:   dests[call],
+					})
+				}
+			}
+			return true
+		})
+	}
+	return queries
+}
+
+// scanDests returns the number of Scan destinations of the query calls in a
+// function whose rows are scanned: a QueryRow call scanned right away, or a
+// Query call assigned to a variable that is only ever set by it and always
+// scanned into the same number of destinations
+func scanDests(body *ast.BlockStmt) map[*ast.CallExpr]int {
+	dests := map[*ast.CallExpr]int{}
+	assigned := map[string][]*ast.CallExpr{} // Query calls by the variable they set
+	scanned := map[string][]int{}            // Scan destinations by variable
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			ident, ok := n.Lhs[0].(*ast.Ident)
+			if !ok {
+				return true
+			}
+			var call *ast.CallExpr
+			if len(n.Rhs) == 1 {
+				call, _ = n.Rhs[0].(*ast.CallExpr)
+			}
+			if name := calledMethod(call); name == "Query" || name == "QueryContext" {
+				assigned[ident.Name] = append(assigned[ident.Name], call)
+			} else {
+				assigned[ident.Name] = append(assigned[ident.Name], nil)
+			}
+		case *ast.CallExpr:
+			sel, ok := n.Fun.(*ast.SelectorExpr)
+			if !ok || sel.Sel.Name != "Scan" {
+				return true
+			}
+			count := len(n.Args)
+			if n.Ellipsis.IsValid() {
+				count = -1
+			}
+			switch x := sel.X.(type) {
+			case *ast.CallExpr:
+				if name := calledMethod(x); (name == "QueryRow" || name == "QueryRowContext") && count > 0 {
+					dests[x] = count
+				}
+			case *ast.Ident:
+				scanned[x.Name] = append(scanned[x.Name], count)
+			}
+		}
+		return true
+	})
+	for name, calls := range assigned {
+		counts := scanned[name]
+		if len(calls) != 1 || calls[0] == nil || len(counts) == 0 {
+			continue
+		}
+		same := counts[0] > 0
+		for _, count := range counts {
+			same = same && count == counts[0]
+		}
+		if same {
+			dests[calls[0]] = counts[0]
+		}
+	}
+	return dests
+}
+
+// calledMethod returns the method name of a call, "" when call isn't a
+// method call
+func calledMethod(call *ast.CallExpr) string {
+	if call == nil {
+		return ""
+	}
+	if sel, ok := call.Fun.(*ast.SelectorExpr); ok {
+		return sel.Sel.Name
+	}
+	return ""
+}
+
+// localValues returns the constants declared in a function and the values
+// of its variables that are only ever set by plain assignment, wherever they
+// are in it
+func localValues(body *ast.BlockStmt, file *ast.File) map[string][]constant {
+	locals := map[string][]constant{}
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.DeclStmt:
+			consts := map[string]constant{}
+			collectConsts(n.Decl.(*ast.GenDecl), file, consts)
+			for name, c := range consts {
+				locals[name] = append(locals[name], c)
+			}
+		case *ast.AssignStmt:
+			for i, lhs := range n.Lhs {
+				ident, ok := lhs.(*ast.Ident)
+				if !ok {
+					continue
+				}
+				if (n.Tok == token.DEFINE || n.Tok == token.ASSIGN) && len(n.Lhs) == len(n.Rhs) {
+					locals[ident.Name] = append(locals[ident.Name], constant{n.Rhs[i], file})
+				} else {
+					// Set from a call or updated in place: a nil value makes
+					// every use non-constant
+					locals[ident.Name] = append(locals[ident.Name], constant{})
+				}
+			}
+		}
+		return true
+	})
+	return locals
+}
+
+// eval returns the value of a constant string expression
+func (f *finder) eval(pkg *goPackage, file *ast.File, locals map[string][]constant, expr ast.Expr, depth int) (string, bool) {
+	if depth > 32 {
+		return "", false
+	}
+	switch e := expr.(type) {
+	case *ast.BasicLit:
+		if e.Kind != token.STRING {
+			return "", false
+		}
+		s, err := strconv.Unquote(e.Value)
+		return s, err == nil
+	case *ast.ParenExpr:
+		return f.eval(pkg, file, locals, e.X, depth+1)
+	case *ast.BinaryExpr:
+		if e.Op != token.ADD {
+			return "", false
+		}
+		left, ok := f.eval(pkg, file, locals, e.X, depth+1)
+		if !ok {
+			return "", false
+		}
+		right, ok := f.eval(pkg, file, locals, e.Y, depth+1)
+		return left + right, ok
+	case *ast.Ident:
+		if values, ok := locals[e.Name]; ok {
+			if len(values) != 1 {
+				return "", false
+			}
+			return f.eval(pkg, values[0].file, locals, values[0].expr, depth+1)
+		}
+		if c, ok := pkg.consts[e.Name]; ok {
+			return f.eval(pkg, c.file, nil, c.expr, depth+1)
+		}
+	case *ast.SelectorExpr:
+		name, ok := e.X.(*ast.Ident)
+		if !ok {
+			return "", false
+		}
+		other := f.imported(file, name.Name)
+		if other == nil {
+			return "", false
+		}
+		if c, ok := other.consts[e.Sel.Name]; ok {
+			return f.eval(other, c.file, nil, c.expr, depth+1)
+		}
+	}
+	return "", false
+}
+
+// imported returns the searched package file imports as name
+func (f *finder) imported(file *ast.File, name string) *goPackage {
+	for _, spec := range file.Imports {
+		importPath, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		if spec.Name != nil && spec.Name.Name == name || spec.Name == nil && path.Base(importPath) == name {
+			return f.packages[importPath]
+		}
+	}
+	return nil
+}
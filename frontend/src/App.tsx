@@ -10,6 +10,11 @@ import Profile from "./pages/Profile";
 import Chats from "./pages/Chats";
 import Matches from "./pages/Matches";
 import UserProfile from "./pages/UserProfile";
+import SsoCallback from "./pages/SsoCallback";
+import LoginAlert from "./pages/LoginAlert";
+import ResetPassword from "./pages/ResetPassword";
+import Directory from "./pages/Directory";
+import DirectoryProvider from "./pages/DirectoryProvider";
 
 const queryClient = new QueryClient({
   defaultOptions: {
@@ -32,6 +37,11 @@ const App = () => {
         <BrowserRouter>
           <Routes>
             <Route path="/" element={<Index />} />
+            <Route path="/sso/callback" element={<SsoCallback />} />
+            <Route path="/login-alert" element={<LoginAlert />} />
+            <Route path="/reset-password" element={<ResetPassword />} />
+            <Route path="/directory" element={<Directory />} />
+            <Route path="/directory/:providerId" element={<DirectoryProvider />} />
             <Route
               path="/dashboard"
               element={
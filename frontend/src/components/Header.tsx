@@ -6,6 +6,7 @@ import { MessageSquare, UserRound, Handshake, BellDot, Users } from "lucide-reac
 import { useToast } from "@/hooks/use-toast";
 import { useMutation } from "@tanstack/react-query";
 import { apiRequest } from "@/lib/api";
+import { auth } from "@/lib/api/config";
 import { cn } from "@/lib/utils";
 
 interface Message {
@@ -63,68 +64,8 @@ export const Header = () => {
           return;
         }
 
-        // Get existing connections to find match IDs
-        try {
-          const connectionsResponse = await apiRequest("/connections");
-          console.log("Connections response:", connectionsResponse);
-          
-          if (Array.isArray(connectionsResponse)) {
-            // Close any existing WebSocket connections
-            newWs.forEach(ws => {
-              if (ws.readyState === WebSocket.OPEN) {
-                ws.close();
-              }
-            });
-            newWs.length = 0;
-
-            // Get chat preferences first
-            try {
-              const chatPrefs = await apiRequest("/chat/preferences");
-              console.log("Chat preferences:", chatPrefs);
-              
-              if (!chatPrefs.opt_in) {
-                console.log("Chat is not enabled for this user");
-                return;
-              }
-
-              // Create new connections
-              connectionsResponse.forEach((connection) => {
-                console.log(`Processing connection:`, connection);
-                if (connection.id) {
-                  console.log(`Connecting to chat WebSocket for match ${connection.id}`);
-                  const wsUrl = `${import.meta.env.VITE_WS_URL}/ws/chat/${connection.id}?token=Bearer ${token}`;
-                  const chatWs = new WebSocket(wsUrl);
-                  
-                  chatWs.onopen = () => {
-                    console.log(`Chat WebSocket connected for match ${connection.id}`);
-                  };
-
-                  chatWs.onerror = (error) => {
-                    console.error(`Chat WebSocket error for match ${connection.id}:`, error);
-                    // Don't retry on error, just log it
-                  };
-
-                  chatWs.onclose = () => {
-                    console.log(`Chat WebSocket closed for match ${connection.id}`);
-                    // Remove from array
-                    const index = newWs.indexOf(chatWs);
-                    if (index > -1) {
-                      newWs.splice(index, 1);
-                    }
-                  };
-
-                  newWs.push(chatWs);
-                }
-              });
-            } catch (error) {
-              console.error("Error fetching chat preferences:", error);
-            }
-          }
-        } catch (error) {
-          console.error("Error fetching connections:", error);
-        }
-
-        // Connect to notifications WebSocket
+        // Connect to notifications WebSocket; chat events of every
+        // conversation arrive over it, so no socket per match is needed
         const notificationsWsUrl = `${import.meta.env.VITE_WS_URL}/ws/notifications?token=Bearer ${token}`;
         const notificationsWs = new WebSocket(notificationsWsUrl);
         
@@ -132,6 +73,19 @@ export const Header = () => {
           console.log("Notifications WebSocket connected");
         };
 
+        notificationsWs.onmessage = (event) => {
+          try {
+            const data = JSON.parse(event.data);
+            if (data.type === "chat_unread") {
+              setUnreadMessages(data.total_unread);
+            } else if (data.type === "chat_preview" || data.type === "new_matches") {
+              queryClient.invalidateQueries({ queryKey: ["notifications"] });
+            }
+          } catch (error) {
+            console.error("Error parsing notification:", error);
+          }
+        };
+
         notificationsWs.onerror = (error) => {
           console.error("Notifications WebSocket error:", error);
           // Don't retry on error, just log it
@@ -171,7 +125,9 @@ export const Header = () => {
 
   const handleLogout = () => {
     console.log("Logging out...");
+    auth.logout().catch(() => {});
     localStorage.removeItem("token");
+    localStorage.removeItem("refresh_token");
     localStorage.removeItem("user");
     toast({ title: "Logged out successfully", description: "See you next time!" });
     navigate("/");
@@ -45,7 +45,7 @@ export const Matches = () => {
 
       const response = await apiRequest('/connections');
       console.log('Raw API response:', response);
-      return response as Connection[];
+      return (response?.connections ?? []) as Connection[];
     },
     retry: false,
     staleTime: 0,
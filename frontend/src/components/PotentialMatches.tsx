@@ -16,6 +16,7 @@ interface PotentialMatch {
   email: string;
   organization_name: string;
   profile_picture_url: string | null;
+  stale?: boolean;
 }
 
 interface LikeResponse {
@@ -56,7 +57,10 @@ export const PotentialMatches = () => {
     mutationFn: async () => {
       console.log('=== Recalculate Matches Start ===');
       try {
-        await connection.recalculateMatches();
+        const result = await connection.recalculateMatches();
+        if (result?.job_id) {
+          await connection.waitForRecalculation(result.job_id);
+        }
         console.log('Recalculate Matches Success');
       } catch (error) {
         console.error('Recalculate Matches Error:', {
@@ -79,7 +83,8 @@ export const PotentialMatches = () => {
       console.log('=== Potential Matches Fetch Start ===');
       console.log('Making request to /potential-matches');
       try {
-        const response = await apiRequest("/potential-matches");
+        const page = await apiRequest("/potential-matches");
+        const response = page?.matches;
         console.log('Potential Matches API Response:', {
           status: 'success',
           data: response,
@@ -304,6 +309,11 @@ export const PotentialMatches = () => {
                   <span className="text-sm text-green-600">
                     {Math.round(match.score)}% Match
                   </span>
+                  {match.stale && (
+                    <Badge variant="outline" title="This score could not be refreshed recently">
+                      Outdated
+                    </Badge>
+                  )}
                 </div>
               </div>
               <div className="mt-4 flex justify-end gap-2">
@@ -1,5 +1,5 @@
 import { useState } from "react";
-import { useNavigate } from "react-router-dom";
+import { Link, useNavigate } from "react-router-dom";
 import { Button } from "@/components/ui/button";
 import { Input } from "@/components/ui/input";
 import { useToast } from "@/hooks/use-toast";
@@ -21,6 +21,7 @@ export const LoginForm = () => {
       
       // Store token and user data
       localStorage.setItem("token", response.token);
+      localStorage.setItem("refresh_token", response.refresh_token);
       localStorage.setItem("user", JSON.stringify({
         id: response.id,
         email: response.email,
@@ -73,6 +74,9 @@ export const LoginForm = () => {
       >
         {isLoading ? "Logging in..." : "Login"}
       </Button>
+      <Link to="/reset-password" className="block text-center text-sm text-muted-foreground hover:underline">
+        Forgot your password?
+      </Link>
     </form>
   );
 };
\ No newline at end of file
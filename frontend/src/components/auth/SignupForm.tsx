@@ -33,6 +33,7 @@ export const SignupForm = () => {
       
       // Store token and user data
       localStorage.setItem("token", response.token);
+      localStorage.setItem("refresh_token", response.refresh_token);
       localStorage.setItem("user", JSON.stringify({
         id: response.id,
         email: response.email,
@@ -1,4 +1,5 @@
 import axios from 'axios';
+import { AwardRange, BillingSettings, Bookmark, BookmarksPage, BrowsePage, Campaign, CampaignDetail, CampaignFilter, Connection, ConnectionChecklists, DirectoryPage, DismissedMatchesPage, EligibilityBands, EventAttendee, GrantRequirement, ImpactReport, ImpactReports, InvoicesPage, MatchComparison, MatchPreferences, MessageTemplate, Onboarding, OnboardingStatus, OnboardingStep, Partner, Peer, Plan, PlanName, PlanUsage, ProfileFAQs, ProfileSearchPage, ProviderEvent, ProviderFAQ, ProviderQuestion, PublicProvider, PublicStoriesPage, PublicStory, Recalculation, Referrals, ReportAttachment, RequirementDocument, Session, SharedTask, SharedTasks, SuccessStory } from '@/types';
 
 const API_URL = import.meta.env.VITE_API_URL || 'http://localhost:8080/api';
 
@@ -19,12 +20,45 @@ api.interceptors.request.use((config) => {
   return config;
 });
 
-// Add response interceptor to handle errors
+// Refreshes in flight are shared, since a refresh token works only once
+let refreshing: Promise<string> | null = null;
+
+const refreshToken = () => {
+  if (!refreshing) {
+    const token = localStorage.getItem('refresh_token');
+    refreshing = axios
+      .post(`${API_URL}/auth/refresh`, { refresh_token: token })
+      .then((response) => {
+        localStorage.setItem('token', response.data.token);
+        localStorage.setItem('refresh_token', response.data.refresh_token);
+        return response.data.token as string;
+      })
+      .finally(() => {
+        refreshing = null;
+      });
+  }
+  return refreshing;
+};
+
+// Add response interceptor to handle errors; an expired token is refreshed
+// once and the request retried before signing out
 api.interceptors.response.use(
   (response) => response,
-  (error) => {
+  async (error) => {
+    const request = error.config;
+    if (error.response?.status === 401 && request && !request._retried && localStorage.getItem('refresh_token')) {
+      request._retried = true;
+      try {
+        const token = await refreshToken();
+        request.headers.Authorization = `Bearer ${token}`;
+        return api(request);
+      } catch {
+        // Fall through to signing out
+      }
+    }
     if (error.response?.status === 401) {
       localStorage.removeItem('token');
+      localStorage.removeItem('refresh_token');
       localStorage.removeItem('user');
       window.location.href = '/';
     }
@@ -34,14 +68,38 @@ api.interceptors.response.use(
 
 // Auth service
 export const auth = {
-  login: async (data: { email: string; password: string }) => {
+  login: async (data: { email: string; password: string; captcha_token?: string }) => {
     const response = await api.post('/auth/login', data);
     return response.data;
   },
-  signup: async (data: { email: string; password: string; role: 'provider' | 'recipient' }) => {
-    const response = await api.post('/auth/signup', data);
+  signup: async (data: { email: string; password: string; role: 'provider' | 'recipient'; captcha_token?: string }, ref?: string) => {
+    const response = await api.post('/auth/signup', data, { params: ref ? { ref } : undefined });
     return response.data;
   },
+  requestMagicLink: async (email: string) => {
+    const response = await api.post('/auth/magic-link', { email });
+    return response.data as { message: string };
+  },
+  exchangeMagicLink: async (token: string) => {
+    const response = await api.post('/auth/magic-link/exchange', { token });
+    return response.data;
+  },
+  denyLogin: async (alertToken: string) => {
+    const response = await api.post(`/auth/login-alerts/${encodeURIComponent(alertToken)}/deny`);
+    return response.data as { reset_token: string; expires_at: string };
+  },
+  forgotPassword: async (data: { email: string; captcha_token?: string }) => {
+    const response = await api.post('/auth/forgot-password', data);
+    return response.data as { message: string };
+  },
+  resetPassword: async (data: { token: string; password: string; captcha_token?: string }) => {
+    await api.post('/auth/reset-password', data);
+  },
+  // The token is read now, as callers clear it right after
+  logout: () => {
+    const token = localStorage.getItem('token');
+    return api.post('/auth/logout', null, { headers: { Authorization: `Bearer ${token}` } });
+  },
 };
 
 // User service
@@ -54,6 +112,24 @@ export const user = {
     const response = await api.put('/me/profile', data);
     return response.data;
   },
+  changeEmail: async (data: { email: string; password: string }) => {
+    const response = await api.put('/me/email', data);
+    return response.data as { email: string };
+  },
+  deleteAccount: async (password: string) => {
+    await api.delete('/me', { data: { password } });
+  },
+  getSessions: async () => {
+    const response = await api.get('/me/sessions');
+    return response.data as Session[];
+  },
+  deleteSession: async (id: number) => {
+    await api.delete(`/me/sessions/${id}`);
+  },
+  deleteAllSessions: async (keepCurrent = false) => {
+    const response = await api.delete('/me/sessions', { params: keepCurrent ? { keep_current: true } : undefined });
+    return response.data as { revoked: number };
+  },
   getBio: async () => {
     const response = await api.get('/me/bio');
     return response.data;
@@ -86,26 +162,73 @@ export const chat = {
     const response = await api.get(`/chat/${chatId}/messages`);
     return response.data;
   },
+  sendMessage: async (chatId: number, content: string) => {
+    const response = await api.post(`/chat/${chatId}/messages`, { content });
+    return response.data;
+  },
   markMessagesRead: async (chatId: number) => {
     const response = await api.post(`/chat/${chatId}/messages/read`);
     return response.data;
   },
+  forwardMessage: async (chatId: number, messageId: number, toChatId: number) => {
+    const response = await api.post(`/chat/${chatId}/messages/${messageId}/forward`, { match_id: toChatId });
+    return response.data;
+  },
+  getPins: async (chatId: number) => {
+    const response = await api.get(`/chat/${chatId}/pins`);
+    return response.data;
+  },
+  pinMessage: async (chatId: number, messageId: number) => {
+    const response = await api.post(`/chat/${chatId}/messages/${messageId}/pin`);
+    return response.data;
+  },
+  unpinMessage: async (chatId: number, messageId: number) => {
+    const response = await api.delete(`/chat/${chatId}/messages/${messageId}/pin`);
+    return response.data;
+  },
+  getDraft: async (chatId: number) => {
+    const response = await api.get(`/chat/${chatId}/draft`);
+    return response.data as { content: string; updated_at: string | null };
+  },
+  saveDraft: async (chatId: number, content: string) => {
+    const response = await api.put(`/chat/${chatId}/draft`, { content });
+    return response.data as { content: string; updated_at: string | null };
+  },
 };
 
 // Connection service
 export const connection = {
-  getConnections: async () => {
-    const response = await api.get('/connections');
-    return response.data;
+  getConnections: async (params?: { limit?: number; offset?: number }) => {
+    const response = await api.get('/connections', { params });
+    return response.data as { connections: Connection[]; total: number; limit: number; offset: number };
   },
-  getPotentialMatches: async () => {
-    const response = await api.get('/potential-matches');
+  getPotentialMatches: async (params?: { as?: 'provider' | 'recipient'; limit?: number; offset?: number }) => {
+    const response = await api.get('/potential-matches', { params });
     return response.data;
   },
   recalculateMatches: async () => {
-    const response = await api.post('/potential-matches/recalculate');
+    // A 202 queues the recalculation as job_id. A 429 means matches were
+    // recalculated recently; the stored ones come back marked stale
+    const response = await api.post('/potential-matches/recalculate', undefined, {
+      validateStatus: (status) => (status >= 200 && status < 300) || status === 429,
+    });
     return response.data;
   },
+  getRecalculation: async (jobId: number): Promise<Recalculation> => {
+    const response = await api.get(`/potential-matches/recalculate/${jobId}`);
+    return response.data as Recalculation;
+  },
+  // Polls a queued recalculation until it finishes or timeoutMs passes
+  waitForRecalculation: async (jobId: number, timeoutMs = 60000, intervalMs = 2000): Promise<Recalculation> => {
+    const deadline = Date.now() + timeoutMs;
+    for (;;) {
+      const recalculation = await connection.getRecalculation(jobId);
+      if (recalculation.status === 'succeeded' || recalculation.status === 'dead' || Date.now() >= deadline) {
+        return recalculation;
+      }
+      await new Promise((resolve) => setTimeout(resolve, intervalMs));
+    }
+  },
   requestConnection: async (userId: number) => {
     const response = await api.post(`/connections/${userId}/request`);
     return response.data;
@@ -118,6 +241,30 @@ export const connection = {
     const response = await api.post(`/connections/${userId}/reject`);
     return response.data;
   },
+  deleteConnectionWith: async (userId: number) => {
+    await api.delete(`/connections/with/${userId}`);
+  },
+  markFunded: async (connectionId: number) => {
+    const response = await api.post(`/connections/${connectionId}/funded`);
+    return response.data as { connection_id: number; funded: boolean; funded_at: string | null };
+  },
+  unmarkFunded: async (connectionId: number) => {
+    await api.delete(`/connections/${connectionId}/funded`);
+  },
+  getDismissedMatches: async (params?: { limit?: number; offset?: number }) => {
+    const response = await api.get('/matches/dismissed', { params });
+    return response.data as DismissedMatchesPage;
+  },
+  // Resolves to the queued recalculation's job_id, or undefined when the
+  // recalculation cooldown is running and the match returns with the next one
+  restoreMatch: async (userId: number): Promise<number | undefined> => {
+    const response = await api.post(`/matches/dismiss/${userId}/restore`);
+    return response.status === 202 ? response.data.job_id : undefined;
+  },
+  compareMatches: async (matchIds: number[]) => {
+    const response = await api.post('/matches/compare', { match_ids: matchIds });
+    return response.data as MatchComparison;
+  },
 };
 
 // Notification service
@@ -130,4 +277,370 @@ export const notification = {
     const response = await api.post(`/notifications/${notificationId}/read`);
     return response.data;
   },
-}; 
\ No newline at end of file
+}; 
+// Public provider directory (no account needed)
+export const directory = {
+  listProviders: async (page: number, pageSize = 24) => {
+    const response = await api.get('/public/providers', { params: { page, page_size: pageSize } });
+    return response.data as DirectoryPage;
+  },
+  getProvider: async (id: number) => {
+    const response = await api.get(`/public/providers/${id}`);
+    return response.data as PublicProvider;
+  },
+  // Every active provider, with name, sectors and funding type only
+  browseProviders: async (page: number, sector?: string, pageSize = 50) => {
+    const response = await api.get('/public/browse/providers', { params: { page, page_size: pageSize, sector: sector || undefined } });
+    return response.data as BrowsePage;
+  },
+};
+
+// Onboarding progress, kept server-side so it follows the user across devices
+export const onboarding = {
+  get: async () => {
+    const response = await api.get('/me/onboarding');
+    return response.data as Onboarding;
+  },
+  updateStep: async (step: OnboardingStep, status: OnboardingStatus) => {
+    const response = await api.put('/me/onboarding', { step, status });
+    return response.data as Onboarding;
+  },
+};
+
+// Sectors, states, applicant types and funding types excluded from matching
+export const matchPreferences = {
+  get: async () => {
+    const response = await api.get('/me/match-preferences');
+    return response.data as MatchPreferences;
+  },
+  update: async (preferences: MatchPreferences) => {
+    const response = await api.put('/me/match-preferences', preferences);
+    return response.data as MatchPreferences;
+  },
+  // Needs open_to_cofunding on both sides
+  getPartners: async () => {
+    const response = await api.get('/potential-partners');
+    return response.data as Partner[];
+  },
+  // Needs open_to_peers on both sides
+  getPeers: async () => {
+    const response = await api.get('/potential-peers');
+    return response.data as Peer[];
+  },
+  getAwardRange: async () => {
+    const response = await api.get('/me/award-range');
+    return response.data as AwardRange;
+  },
+  updateAwardRange: async (range: AwardRange) => {
+    const response = await api.put('/me/award-range', range);
+    return response.data as AwardRange;
+  },
+  getEligibility: async () => {
+    const response = await api.get('/me/eligibility');
+    return response.data as EligibilityBands;
+  },
+  updateEligibility: async (bands: EligibilityBands) => {
+    const response = await api.put('/me/eligibility', bands);
+    return response.data as EligibilityBands;
+  },
+};
+
+// Grant document checklists and uploads against them within a connection
+export const requirements = {
+  list: async (grantId: number) => {
+    const response = await api.get(`/grants/${grantId}/requirements`);
+    return response.data.requirements as GrantRequirement[];
+  },
+  create: async (grantId: number, data: { name: string; description?: string }) => {
+    const response = await api.post(`/grants/${grantId}/requirements`, data);
+    return response.data as GrantRequirement;
+  },
+  remove: async (grantId: number, requirementId: number) => {
+    await api.delete(`/grants/${grantId}/requirements/${requirementId}`);
+  },
+  getChecklists: async (connectionId: number, grantId?: number) => {
+    const response = await api.get(`/connections/${connectionId}/requirements`, { params: grantId ? { grant_id: grantId } : {} });
+    return response.data as ConnectionChecklists;
+  },
+  uploadDocument: async (connectionId: number, requirementId: number, file: File) => {
+    const formData = new FormData();
+    formData.append('file', file);
+    const response = await api.post(`/connections/${connectionId}/requirements/${requirementId}/document`, formData, {
+      headers: { 'Content-Type': 'multipart/form-data' },
+    });
+    return response.data as RequirementDocument;
+  },
+  downloadDocument: async (connectionId: number, requirementId: number) => {
+    const response = await api.get(`/connections/${connectionId}/requirements/${requirementId}/document`, { responseType: 'blob' });
+    return response.data as Blob;
+  },
+  removeDocument: async (connectionId: number, requirementId: number) => {
+    await api.delete(`/connections/${connectionId}/requirements/${requirementId}/document`);
+  },
+};
+
+// Follow-up tasks shared with a connection
+export const tasks = {
+  list: async (connectionId: number, status?: 'open' | 'completed') => {
+    const response = await api.get(`/connections/${connectionId}/tasks`, { params: status ? { status } : {} });
+    return response.data as SharedTasks;
+  },
+  create: async (connectionId: number, data: { title: string; due_at: string; notes?: string; assignee_id?: number }) => {
+    const response = await api.post(`/connections/${connectionId}/tasks`, data);
+    return response.data as SharedTask;
+  },
+  complete: async (connectionId: number, taskId: number) => {
+    const response = await api.post(`/connections/${connectionId}/tasks/${taskId}/complete`);
+    return response.data as SharedTask;
+  },
+  remove: async (connectionId: number, taskId: number) => {
+    await api.delete(`/connections/${connectionId}/tasks/${taskId}`);
+  },
+};
+
+// Info sessions and webinars hosted by providers
+export const events = {
+  upcoming: async () => {
+    const response = await api.get('/me/events');
+    return response.data as ProviderEvent[];
+  },
+  hosted: async () => {
+    const response = await api.get('/me/events', { params: { hosted: true } });
+    return response.data as ProviderEvent[];
+  },
+  create: async (data: { title: string; starts_at: string; link: string; description?: string; capacity?: number | null }) => {
+    const response = await api.post('/me/events', data);
+    return response.data as ProviderEvent;
+  },
+  cancel: async (eventId: number) => {
+    await api.delete(`/me/events/${eventId}`);
+  },
+  attendees: async (eventId: number) => {
+    const response = await api.get(`/me/events/${eventId}/attendees`);
+    return response.data as EventAttendee[];
+  },
+  rsvp: async (eventId: number) => {
+    const response = await api.post(`/events/${eventId}/rsvp`);
+    return response.data as ProviderEvent;
+  },
+  cancelRsvp: async (eventId: number) => {
+    await api.delete(`/events/${eventId}/rsvp`);
+  },
+};
+
+// Full-text search over organization profiles
+export const search = {
+  profiles: async (params: {
+    q?: string;
+    sectors?: string[];
+    target_groups?: string[];
+    state?: string;
+    role?: 'provider' | 'recipient';
+    limit?: number;
+    offset?: number;
+  }) => {
+    const response = await api.get('/search/profiles', {
+      params: {
+        ...params,
+        sectors: params.sectors?.length ? params.sectors.join(',') : undefined,
+        target_groups: params.target_groups?.length ? params.target_groups.join(',') : undefined,
+      },
+    });
+    return response.data as ProfileSearchPage;
+  },
+};
+
+// Private shortlist of organizations
+export const bookmarks = {
+  list: async (limit = 50, offset = 0) => {
+    const response = await api.get('/me/bookmarks', { params: { limit, offset } });
+    return response.data as BookmarksPage;
+  },
+  add: async (userId: number) => {
+    const response = await api.post(`/me/bookmarks/${userId}`);
+    return response.data as Bookmark;
+  },
+  remove: async (userId: number) => {
+    await api.delete(`/me/bookmarks/${userId}`);
+  },
+};
+
+// Provider FAQ and questions from matched recipients
+export const faqs = {
+  listMine: async () => {
+    const response = await api.get('/me/faqs');
+    return response.data as ProviderFAQ[];
+  },
+  create: async (data: { question: string; answer: string; position?: number }) => {
+    const response = await api.post('/me/faqs', data);
+    return response.data as ProviderFAQ;
+  },
+  update: async (id: number, data: { question: string; answer: string; position?: number }) => {
+    const response = await api.put(`/me/faqs/${id}`, data);
+    return response.data as ProviderFAQ;
+  },
+  remove: async (id: number) => {
+    await api.delete(`/me/faqs/${id}`);
+  },
+  getForProfile: async (userId: number) => {
+    const response = await api.get(`/users/${userId}/faqs`);
+    return response.data as ProfileFAQs;
+  },
+  ask: async (providerId: number, question: string) => {
+    const response = await api.post(`/users/${providerId}/questions`, { question });
+    return response.data as ProviderQuestion;
+  },
+  listQuestions: async (status?: 'unanswered' | 'answered') => {
+    const response = await api.get('/me/questions', { params: status ? { status } : {} });
+    return response.data.questions as ProviderQuestion[];
+  },
+  answer: async (questionId: number, answer: string, isPublic: boolean) => {
+    const response = await api.post(`/me/questions/${questionId}/answer`, { answer, public: isPublic });
+    return response.data as ProviderQuestion;
+  },
+};
+
+// Success stories of funded connections
+export const stories = {
+  get: async (connectionId: number) => {
+    const response = await api.get(`/connections/${connectionId}/story`);
+    return response.data as SuccessStory;
+  },
+  save: async (connectionId: number, data: { title: string; body: string }) => {
+    const response = await api.put(`/connections/${connectionId}/story`, data);
+    return response.data as SuccessStory;
+  },
+  approve: async (connectionId: number) => {
+    const response = await api.post(`/connections/${connectionId}/story/approve`);
+    return response.data as SuccessStory;
+  },
+  withdraw: async (connectionId: number) => {
+    await api.delete(`/connections/${connectionId}/story`);
+  },
+  listPublic: async (page: number, pageSize = 12) => {
+    const response = await api.get('/public/stories', { params: { page, page_size: pageSize } });
+    return response.data as PublicStoriesPage;
+  },
+  getPublic: async (id: number) => {
+    const response = await api.get(`/public/stories/${id}`);
+    return response.data as PublicStory;
+  },
+};
+
+// Progress reports on funded connections
+export const reports = {
+  list: async (connectionId: number) => {
+    const response = await api.get(`/connections/${connectionId}/reports`);
+    return response.data as ImpactReports;
+  },
+  request: async (connectionId: number, data: { title: string; due_at: string; instructions?: string; metrics?: string[] }) => {
+    const response = await api.post(`/connections/${connectionId}/reports`, data);
+    return response.data as ImpactReport;
+  },
+  submit: async (connectionId: number, reportId: number, data: { narrative: string; metrics: Record<string, number> }) => {
+    const response = await api.put(`/connections/${connectionId}/reports/${reportId}/submission`, data);
+    return response.data as ImpactReport;
+  },
+  remove: async (connectionId: number, reportId: number) => {
+    await api.delete(`/connections/${connectionId}/reports/${reportId}`);
+  },
+  uploadAttachment: async (connectionId: number, reportId: number, file: File) => {
+    const formData = new FormData();
+    formData.append('file', file);
+    const response = await api.post(`/connections/${connectionId}/reports/${reportId}/attachments`, formData, {
+      headers: { 'Content-Type': 'multipart/form-data' },
+    });
+    return response.data as ReportAttachment;
+  },
+  downloadAttachment: async (connectionId: number, reportId: number, attachmentId: number) => {
+    const response = await api.get(`/connections/${connectionId}/reports/${reportId}/attachments/${attachmentId}`, { responseType: 'blob' });
+    return response.data as Blob;
+  },
+  removeAttachment: async (connectionId: number, reportId: number, attachmentId: number) => {
+    await api.delete(`/connections/${connectionId}/reports/${reportId}/attachments/${attachmentId}`);
+  },
+};
+
+// Plans, usage against their limits, and the features they meter
+export const plans = {
+  list: async () => {
+    const response = await api.get('/plans');
+    return response.data as Plan[];
+  },
+  getMine: async () => {
+    const response = await api.get('/me/plan');
+    return response.data as PlanUsage;
+  },
+  checkout: async (plan: PlanName) => {
+    const response = await api.post('/me/billing/checkout', { plan });
+    return response.data as { url: string };
+  },
+  openPortal: async () => {
+    const response = await api.post('/me/billing/portal');
+    return response.data as { url: string };
+  },
+  getInvoices: async (params?: { limit?: number; starting_after?: string }) => {
+    const response = await api.get('/me/billing/invoices', { params });
+    return response.data as InvoicesPage;
+  },
+  getBillingSettings: async () => {
+    const response = await api.get('/me/billing/settings');
+    return response.data as BillingSettings;
+  },
+  updateBillingSettings: async (billingEmail: string | null) => {
+    const response = await api.put('/me/billing/settings', { billing_email: billingEmail });
+    return response.data as BillingSettings;
+  },
+  exportConnections: async () => {
+    const response = await api.get('/me/exports/connections', { responseType: 'blob' });
+    return response.data as Blob;
+  },
+};
+
+export const messageTemplates = {
+  list: async () => {
+    const response = await api.get('/me/message-templates');
+    return response.data as MessageTemplate[];
+  },
+  create: async (data: { name: string; body: string }) => {
+    const response = await api.post('/me/message-templates', data);
+    return response.data as MessageTemplate;
+  },
+  update: async (id: number, data: { name: string; body: string }) => {
+    const response = await api.put(`/me/message-templates/${id}`, data);
+    return response.data as MessageTemplate;
+  },
+  remove: async (id: number) => {
+    await api.delete(`/me/message-templates/${id}`);
+  },
+};
+
+export const campaigns = {
+  list: async () => {
+    const response = await api.get('/me/campaigns');
+    return response.data as Campaign[];
+  },
+  get: async (id: number) => {
+    const response = await api.get(`/me/campaigns/${id}`);
+    return response.data as CampaignDetail;
+  },
+  preview: async (filter: CampaignFilter) => {
+    const response = await api.post('/me/campaigns/preview', filter);
+    return response.data as { recipients: number };
+  },
+  create: async (data: { content: string; filter?: CampaignFilter }) => {
+    const response = await api.post('/me/campaigns', data);
+    return response.data as Campaign;
+  },
+  cancel: async (id: number) => {
+    const response = await api.post(`/me/campaigns/${id}/cancel`);
+    return response.data as Campaign;
+  },
+};
+
+export const referrals = {
+  get: async () => {
+    const response = await api.get('/me/referrals');
+    return response.data as Referrals;
+  },
+};
@@ -0,0 +1,94 @@
+import { useEffect } from "react";
+import { Link, useSearchParams } from "react-router-dom";
+import { useQuery } from "@tanstack/react-query";
+import { Button } from "@/components/ui/button";
+import { Card } from "@/components/ui/card";
+import { Badge } from "@/components/ui/badge";
+import { directory } from "@/lib/api/config";
+
+// Public, crawlable list of providers that opted in to the directory
+const Directory = () => {
+  const [searchParams, setSearchParams] = useSearchParams();
+  const page = Math.max(1, parseInt(searchParams.get("page") ?? "1", 10) || 1);
+
+  useEffect(() => {
+    document.title = "Grant provider directory | Grant Matcherator";
+  }, []);
+
+  const { data, isLoading, error } = useQuery({
+    queryKey: ["directory", page],
+    queryFn: () => directory.listProviders(page),
+  });
+
+  const totalPages = data ? Math.max(1, Math.ceil(data.total / data.page_size)) : 1;
+
+  return (
+    <div className="min-h-screen bg-gray-50">
+      <main className="container mx-auto px-4 py-8">
+        <div className="flex justify-between items-center mb-6">
+          <h1 className="text-3xl font-bold">Grant provider directory</h1>
+          <Button asChild variant="outline">
+            <Link to="/">Sign up to get matched</Link>
+          </Button>
+        </div>
+
+        {isLoading && <div>Loading...</div>}
+        {error && <div>The directory could not be loaded. Please try again later.</div>}
+        {data && data.providers.length === 0 && <div>No providers are listed yet.</div>}
+
+        <div className="grid gap-4 md:grid-cols-2 lg:grid-cols-3">
+          {data?.providers.map((provider) => (
+            <Card key={provider.id} className="p-4">
+              <Link to={`/directory/${provider.id}`} className="flex items-start gap-4">
+                {provider.profile_picture_url && (
+                  <img
+                    src={provider.profile_picture_url}
+                    alt={provider.profile_picture_alt ?? ""}
+                    className="w-16 h-16 rounded-full object-cover"
+                  />
+                )}
+                <div>
+                  <h2 className="text-lg font-semibold">{provider.organization_name}</h2>
+                  {(provider.city || provider.state) && (
+                    <p className="text-sm text-gray-500">
+                      {[provider.city, provider.state].filter(Boolean).join(", ")}
+                    </p>
+                  )}
+                </div>
+              </Link>
+              <div className="mt-3 flex flex-wrap gap-1">
+                {provider.sectors.map((sector) => (
+                  <Badge key={sector} variant="secondary">{sector}</Badge>
+                ))}
+              </div>
+            </Card>
+          ))}
+        </div>
+
+        {data && totalPages > 1 && (
+          <nav className="mt-8 flex justify-center items-center gap-4" aria-label="Directory pages">
+            <Button
+              variant="outline"
+              disabled={page <= 1}
+              onClick={() => setSearchParams({ page: String(page - 1) })}
+            >
+              Previous
+            </Button>
+            <span className="text-sm text-gray-600">
+              Page {page} of {totalPages}
+            </span>
+            <Button
+              variant="outline"
+              disabled={page >= totalPages}
+              onClick={() => setSearchParams({ page: String(page + 1) })}
+            >
+              Next
+            </Button>
+          </nav>
+        )}
+      </main>
+    </div>
+  );
+};
+
+export default Directory;
@@ -0,0 +1,106 @@
+import { useEffect } from "react";
+import { Link, useParams } from "react-router-dom";
+import { useQuery } from "@tanstack/react-query";
+import { Button } from "@/components/ui/button";
+import { Card, CardContent, CardHeader } from "@/components/ui/card";
+import { Badge } from "@/components/ui/badge";
+import { directory } from "@/lib/api/config";
+
+// Public page for one provider in the directory
+const DirectoryProvider = () => {
+  const { providerId } = useParams();
+
+  const { data: provider, isLoading, error } = useQuery({
+    queryKey: ["directory-provider", providerId],
+    queryFn: () => directory.getProvider(parseInt(providerId!, 10)),
+    enabled: !!providerId,
+  });
+
+  useEffect(() => {
+    if (!provider) return;
+    document.title = `${provider.organization_name} | Grant Matcherator`;
+
+    let description = document.querySelector<HTMLMetaElement>('meta[name="description"]');
+    if (!description) {
+      description = document.createElement("meta");
+      description.name = "description";
+      document.head.appendChild(description);
+    }
+    description.content = provider.mission_statement.slice(0, 160);
+  }, [provider]);
+
+  return (
+    <div className="min-h-screen bg-gray-50">
+      <main className="container mx-auto px-4 py-8 max-w-3xl">
+        <Link to="/directory" className="text-sm text-gray-600 hover:underline">
+          ← All providers
+        </Link>
+
+        {isLoading && <div className="mt-4">Loading...</div>}
+        {error && <div className="mt-4">This provider is not listed in the directory.</div>}
+
+        {provider && (
+          <Card className="mt-4">
+            <CardHeader className="flex flex-row items-center gap-4">
+              {provider.profile_picture_url && (
+                <img
+                  src={provider.profile_picture_url}
+                  alt={provider.profile_picture_alt ?? ""}
+                  className="w-24 h-24 rounded-full object-cover"
+                />
+              )}
+              <div>
+                <h1 className="text-2xl font-bold">{provider.organization_name}</h1>
+                {(provider.city || provider.state || provider.location) && (
+                  <p className="text-gray-500">
+                    {[provider.city, provider.state].filter(Boolean).join(", ") || provider.location}
+                  </p>
+                )}
+              </div>
+            </CardHeader>
+            <CardContent className="space-y-4">
+              {provider.mission_statement && <p>{provider.mission_statement}</p>}
+
+              {provider.sectors.length > 0 && (
+                <section>
+                  <h2 className="font-semibold mb-2">Sectors</h2>
+                  <div className="flex flex-wrap gap-1">
+                    {provider.sectors.map((sector) => (
+                      <Badge key={sector} variant="secondary">{sector}</Badge>
+                    ))}
+                  </div>
+                </section>
+              )}
+
+              {provider.target_groups.length > 0 && (
+                <section>
+                  <h2 className="font-semibold mb-2">Target groups</h2>
+                  <div className="flex flex-wrap gap-1">
+                    {provider.target_groups.map((group) => (
+                      <Badge key={group} variant="outline">{group}</Badge>
+                    ))}
+                  </div>
+                </section>
+              )}
+
+              <div className="flex gap-2">
+                {provider.website_url && (
+                  <Button asChild variant="outline">
+                    <a href={provider.website_url} target="_blank" rel="noopener noreferrer">
+                      Visit website
+                    </a>
+                  </Button>
+                )}
+                <Button asChild>
+                  <Link to="/">Sign up to get matched</Link>
+                </Button>
+              </div>
+            </CardContent>
+          </Card>
+        )}
+      </main>
+    </div>
+  );
+};
+
+export default DirectoryProvider;
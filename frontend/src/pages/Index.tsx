@@ -1,10 +1,13 @@
 import { useState } from "react";
+import { useSearchParams } from "react-router-dom";
 import { LoginForm } from "@/components/auth/LoginForm";
 import { SignupForm } from "@/components/auth/SignupForm";
 import { Button } from "@/components/ui/button";
 
 const Index = () => {
-  const [isLogin, setIsLogin] = useState(true);
+  const [searchParams] = useSearchParams();
+  // Deep links such as the provider widget's "Match with us" open signup directly
+  const [isLogin, setIsLogin] = useState(!searchParams.has("signup"));
 
   return (
     <div className="min-h-screen flex flex-col items-center justify-center bg-gradient-to-br from-match-light/10 to-match-dark/10 p-4">
@@ -0,0 +1,92 @@
+import { useState } from "react";
+import { useNavigate } from "react-router-dom";
+import { Button } from "@/components/ui/button";
+import { Input } from "@/components/ui/input";
+import { useToast } from "@/hooks/use-toast";
+import { auth } from "@/lib/api/config";
+
+// Landing page for the "this wasn't me" link in login alert emails
+const LoginAlert = () => {
+  const navigate = useNavigate();
+  const { toast } = useToast();
+  const [alertToken] = useState(() => new URLSearchParams(window.location.hash.slice(1)).get("token") ?? "");
+  const [resetToken, setResetToken] = useState("");
+  const [password, setPassword] = useState("");
+  const [isLoading, setIsLoading] = useState(false);
+
+  const handleDeny = async () => {
+    setIsLoading(true);
+    try {
+      const response = await auth.denyLogin(alertToken);
+      // Drop the alert token from the address bar and history
+      window.history.replaceState(null, "", window.location.pathname);
+      setResetToken(response.reset_token);
+    } catch (error) {
+      toast({
+        title: "This link is invalid or has expired",
+        description: "Please contact support if you think your account is compromised",
+        variant: "destructive",
+      });
+    } finally {
+      setIsLoading(false);
+    }
+  };
+
+  const handleReset = async (e: React.FormEvent) => {
+    e.preventDefault();
+    setIsLoading(true);
+    try {
+      await auth.resetPassword({ token: resetToken, password });
+      toast({
+        title: "Password changed",
+        description: "Please log in with your new password",
+      });
+      navigate("/");
+    } catch (error) {
+      toast({
+        title: "Password reset failed",
+        description: "Passwords must be at least 8 characters",
+        variant: "destructive",
+      });
+    } finally {
+      setIsLoading(false);
+    }
+  };
+
+  return (
+    <div className="min-h-screen flex items-center justify-center p-4">
+      <div className="w-full max-w-sm space-y-4">
+        {!resetToken ? (
+          <>
+            <h1 className="text-2xl font-bold">Secure your account</h1>
+            <p className="text-muted-foreground">
+              If you didn't sign in recently, we'll sign out every session and ask you to choose a new password.
+            </p>
+            <Button className="w-full" onClick={handleDeny} disabled={isLoading || !alertToken}>
+              {isLoading ? "Securing..." : "This wasn't me"}
+            </Button>
+          </>
+        ) : (
+          <form onSubmit={handleReset} className="space-y-4">
+            <h1 className="text-2xl font-bold">Choose a new password</h1>
+            <p className="text-muted-foreground">All sessions have been signed out.</p>
+            <Input
+              type="password"
+              placeholder="New password"
+              value={password}
+              onChange={(e) => setPassword(e.target.value)}
+              minLength={8}
+              required
+              disabled={isLoading}
+            />
+            <Button type="submit" className="w-full" disabled={isLoading}>
+              {isLoading ? "Saving..." : "Set new password"}
+            </Button>
+          </form>
+        )}
+      </div>
+    </div>
+  );
+};
+
+export default LoginAlert;
@@ -46,6 +46,17 @@ const PROJECT_STAGES = [
 
 const LANGUAGES = ["English", "Spanish"];
 
+// Returned by GET /me/profile but not accepted by PUT /me/profile
+const READ_ONLY_PROFILE_FIELDS = [
+  "id",
+  "role",
+  "status",
+  "website",
+  "profile_picture_alt",
+  "mission_statement_translated",
+  "translated_to",
+];
+
 const ProfilePage = () => {
   const navigate = useNavigate();
   const [profile, setProfile] = useState<Profile>({
@@ -65,6 +76,7 @@ const ProfilePage = () => {
     website_url: "",
     contact_email: "",
     chat_opt_in: false,
+    public_listing: false,
     location: "",
     website: "",
     status: "active",
@@ -102,9 +114,14 @@ const ProfilePage = () => {
   const updateProfileMutation = useMutation({
     mutationFn: async (updatedProfile: Profile) => {
       console.log('Updating profile with data:', updatedProfile);
+      // The API rejects unknown fields, so leave out read-only ones
+      const editable: Record<string, unknown> = { ...updatedProfile };
+      for (const field of READ_ONLY_PROFILE_FIELDS) {
+        delete editable[field];
+      }
       const response = await apiRequest('/me/profile', {
         method: 'PUT',
-        body: JSON.stringify(updatedProfile),
+        body: JSON.stringify(editable),
       });
       console.log('Raw API response from update:', response);
       return response;
@@ -287,6 +304,55 @@ const ProfilePage = () => {
                   />
                 </div>
 
+                <div className="grid grid-cols-3 gap-4">
+                  <div>
+                    <label className="block text-sm font-medium mb-1">Annual Budget ($)</label>
+                    <Input
+                      type="number"
+                      min={0}
+                      value={profile.annual_budget ?? ""}
+                      onChange={(e) =>
+                        setProfile((prev) => ({
+                          ...prev,
+                          annual_budget: e.target.value === "" ? null : Number(e.target.value),
+                        }))
+                      }
+                      placeholder="e.g. 250000"
+                    />
+                  </div>
+                  <div>
+                    <label className="block text-sm font-medium mb-1">Staff Size</label>
+                    <Input
+                      type="number"
+                      min={0}
+                      value={profile.staff_size ?? ""}
+                      onChange={(e) =>
+                        setProfile((prev) => ({
+                          ...prev,
+                          staff_size: e.target.value === "" ? null : Number(e.target.value),
+                        }))
+                      }
+                      placeholder="e.g. 12"
+                    />
+                  </div>
+                  <div>
+                    <label className="block text-sm font-medium mb-1">Year Founded</label>
+                    <Input
+                      type="number"
+                      min={1600}
+                      max={new Date().getFullYear()}
+                      value={profile.founded_year ?? ""}
+                      onChange={(e) =>
+                        setProfile((prev) => ({
+                          ...prev,
+                          founded_year: e.target.value === "" ? null : Number(e.target.value),
+                        }))
+                      }
+                      placeholder="e.g. 2015"
+                    />
+                  </div>
+                </div>
+
                 <div>
                   <label className="block text-sm font-medium mb-1">EIN</label>
                   <Input
@@ -436,6 +502,22 @@ const ProfilePage = () => {
                   </label>
                 </div>
 
+                {profile.role === "provider" && (
+                  <div className="flex items-center space-x-2">
+                    <input
+                      type="checkbox"
+                      id="public_listing"
+                      checked={!!profile.public_listing}
+                      onChange={(e) =>
+                        setProfile((prev) => ({ ...prev, public_listing: e.target.checked }))
+                      }
+                    />
+                    <label htmlFor="public_listing" className="text-sm font-medium">
+                      List my organization in the public directory, visible to search engines
+                    </label>
+                  </div>
+                )}
+
                 <div className="flex justify-end space-x-4">
                   <Button
                     type="button"
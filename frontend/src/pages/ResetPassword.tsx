@@ -0,0 +1,107 @@
+import { useState } from "react";
+import { useNavigate } from "react-router-dom";
+import { Button } from "@/components/ui/button";
+import { Input } from "@/components/ui/input";
+import { useToast } from "@/hooks/use-toast";
+import { auth } from "@/lib/api/config";
+
+// Asks for a password reset link, or sets the new password when opened from one
+const ResetPassword = () => {
+  const navigate = useNavigate();
+  const { toast } = useToast();
+  const [resetToken] = useState(() => new URLSearchParams(window.location.hash.slice(1)).get("token") ?? "");
+  const [email, setEmail] = useState("");
+  const [password, setPassword] = useState("");
+  const [sent, setSent] = useState(false);
+  const [isLoading, setIsLoading] = useState(false);
+
+  const handleRequest = async (e: React.FormEvent) => {
+    e.preventDefault();
+    setIsLoading(true);
+    try {
+      await auth.forgotPassword({ email });
+      setSent(true);
+    } catch (error) {
+      toast({
+        title: "Could not send a reset link",
+        description: "Please try again later",
+        variant: "destructive",
+      });
+    } finally {
+      setIsLoading(false);
+    }
+  };
+
+  const handleReset = async (e: React.FormEvent) => {
+    e.preventDefault();
+    setIsLoading(true);
+    try {
+      await auth.resetPassword({ token: resetToken, password });
+      // Drop the reset token from the address bar and history
+      window.history.replaceState(null, "", window.location.pathname);
+      toast({
+        title: "Password changed",
+        description: "Please log in with your new password",
+      });
+      navigate("/");
+    } catch (error) {
+      toast({
+        title: "Password reset failed",
+        description: "The link may have expired. Passwords must be at least 8 characters",
+        variant: "destructive",
+      });
+    } finally {
+      setIsLoading(false);
+    }
+  };
+
+  return (
+    <div className="min-h-screen flex items-center justify-center p-4">
+      <div className="w-full max-w-sm space-y-4">
+        {resetToken ? (
+          <form onSubmit={handleReset} className="space-y-4">
+            <h1 className="text-2xl font-bold">Choose a new password</h1>
+            <p className="text-muted-foreground">Every device will be signed out.</p>
+            <Input
+              type="password"
+              placeholder="New password"
+              value={password}
+              onChange={(e) => setPassword(e.target.value)}
+              minLength={8}
+              required
+              disabled={isLoading}
+            />
+            <Button type="submit" className="w-full" disabled={isLoading}>
+              {isLoading ? "Saving..." : "Set new password"}
+            </Button>
+          </form>
+        ) : sent ? (
+          <>
+            <h1 className="text-2xl font-bold">Check your email</h1>
+            <p className="text-muted-foreground">
+              If an account exists for {email}, we sent it a link to choose a new password. It expires in an hour.
+            </p>
+          </>
+        ) : (
+          <form onSubmit={handleRequest} className="space-y-4">
+            <h1 className="text-2xl font-bold">Reset your password</h1>
+            <p className="text-muted-foreground">We'll email you a link to choose a new password.</p>
+            <Input
+              type="email"
+              placeholder="Email"
+              value={email}
+              onChange={(e) => setEmail(e.target.value)}
+              required
+              disabled={isLoading}
+            />
+            <Button type="submit" className="w-full" disabled={isLoading}>
+              {isLoading ? "Sending..." : "Send reset link"}
+            </Button>
+          </form>
+        )}
+      </div>
+    </div>
+  );
+};
+
+export default ResetPassword;
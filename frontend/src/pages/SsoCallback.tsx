@@ -0,0 +1,41 @@
+import { useEffect } from "react";
+import { useNavigate } from "react-router-dom";
+import { useToast } from "@/hooks/use-toast";
+
+// Receives the session issued by the backend's SAML assertion consumer service
+const SsoCallback = () => {
+  const navigate = useNavigate();
+  const { toast } = useToast();
+
+  useEffect(() => {
+    const params = new URLSearchParams(window.location.hash.slice(1));
+    const token = params.get("token");
+
+    // Drop the token from the address bar and history
+    window.history.replaceState(null, "", window.location.pathname);
+
+    if (!token) {
+      toast({
+        title: "Single sign-on failed",
+        description: "Please try again or contact your administrator",
+        variant: "destructive",
+      });
+      navigate("/");
+      return;
+    }
+
+    localStorage.setItem("token", token);
+    localStorage.setItem("refresh_token", params.get("refresh_token") ?? "");
+    localStorage.setItem("user", JSON.stringify({
+      id: Number(params.get("id")),
+      email: params.get("email"),
+      role: params.get("role")
+    }));
+
+    navigate("/dashboard");
+  }, [navigate, toast]);
+
+  return null;
+};
+
+export default SsoCallback;
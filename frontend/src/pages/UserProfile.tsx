@@ -6,7 +6,7 @@ import { Avatar, AvatarImage, AvatarFallback } from "@/components/ui/avatar";
 import { ScrollArea } from "@/components/ui/scroll-area";
 import { Header } from "@/components/Header";
 import { apiRequest } from "@/lib/api";
-import { Profile, RecipientData, ProviderData } from "@/types";
+import { Connection, Profile, RecipientData, ProviderData } from "@/types";
 import { useToast } from "@/hooks/use-toast";
 import { Handshake, X, MessageCircle } from "lucide-react";
 
@@ -44,7 +44,7 @@ const UserProfile = () => {
     queryFn: async () => {
       try {
         console.log('Fetching match status for user ID:', userId);
-        const connections = await apiRequest('/connections');
+        const connections = (await apiRequest('/connections?limit=200'))?.connections as Connection[] | undefined;
         console.log('Raw API response for connections:', connections);
         const currentUserId = parseInt(localStorage.getItem("user") ? JSON.parse(localStorage.getItem("user") || "{}").id : "0");
         console.log('Current user ID:', currentUserId);
@@ -254,7 +254,7 @@ const UserProfile = () => {
                 <Avatar className="h-32 w-32">
                   <AvatarImage
                     src={profile.profile_picture_url || "/placeholder.svg"}
-                    alt="Profile"
+                    alt={profile.profile_picture_alt || profile.organization_name || "Profile"}
                   />
                   <AvatarFallback>👤</AvatarFallback>
                 </Avatar>
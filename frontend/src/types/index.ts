@@ -4,6 +4,7 @@ export interface Profile {
   id: number;
   organization_name?: string;
   profile_picture_url: string | null;
+  profile_picture_alt?: string | null;
   mission_statement?: string;
   state?: string;
   city?: string;
@@ -17,10 +18,16 @@ export interface Profile {
   website_url?: string;
   contact_email: string;
   chat_opt_in: boolean;
+  public_listing?: boolean;
+  annual_budget?: number | null;
+  staff_size?: number | null;
+  founded_year?: number | null;
   location?: string;
   website?: string;
   role?: string;
   status?: string;
+  // Set when viewing someone else's profile
+  bookmarked?: boolean;
 }
 
 export interface RecipientData {
@@ -58,4 +65,505 @@ export interface Connection {
   other_user_name: string;
   other_user_picture: string;
   connection_type: 'following' | 'follower';
-}
\ No newline at end of file
+  funded_at: string | null;
+}
+
+// A queued recalculation of the user's matches; pending also covers waiting for a retry
+export interface Recalculation {
+  job_id: number;
+  status: 'pending' | 'running' | 'succeeded' | 'dead';
+  created_at: string;
+  completed_at: string | null;
+}
+
+// A match the user dismissed; restoring it lets it be suggested again
+export interface DismissedMatch {
+  match_id: number;
+  organization_name: string;
+  profile_picture_url: string | null;
+  reason: string | null;
+  comment: string | null;
+  dismissed_at: string;
+}
+
+export interface DismissedMatchesPage {
+  dismissed: DismissedMatch[];
+  total: number;
+  limit: number;
+  offset: number;
+}
+
+// Matches compared side by side: a row per attribute, a cell per match in the order of matches
+export interface MatchComparison {
+  matches: { id: number; organization_name: string; profile_picture_url: string | null; role: string; as_role: string }[];
+  rows: {
+    key: string;
+    group: 'score' | 'dimension' | 'funding' | 'location' | 'eligibility';
+    cells: { value: number | string | boolean | null; normalized?: number; best?: boolean; detail?: string }[];
+  }[];
+}
+export interface PublicProvider {
+  id: number;
+  organization_name: string;
+  profile_picture_url: string | null;
+  profile_picture_alt: string | null;
+  mission_statement: string;
+  location: string;
+  state: string;
+  city: string;
+  sectors: string[];
+  target_groups: string[];
+  website_url: string;
+  updated_at: string;
+  claimable: boolean;
+  faqs?: ProviderFAQs;
+}
+
+export interface DirectoryPage {
+  providers: PublicProvider[];
+  page: number;
+  page_size: number;
+  total: number;
+}
+
+// A provider as visitors without an account see it; listed ones have a directory page
+export interface BrowseProvider {
+  id: number;
+  organization_name: string;
+  sectors: string[];
+  funding_type: string;
+  listed: boolean;
+}
+
+export interface BrowsePage {
+  providers: BrowseProvider[];
+  page: number;
+  page_size: number;
+  total: number;
+}
+
+// An organization the user shortlisted; the organization isn't told
+export interface Bookmark {
+  user_id: number;
+  organization_name: string;
+  profile_picture_url: string | null;
+  role: 'provider' | 'recipient';
+  sectors: string[];
+  state: string;
+  city: string;
+  bookmarked_at: string;
+}
+
+export interface BookmarksPage {
+  bookmarks: Bookmark[];
+  total: number;
+  limit: number;
+  offset: number;
+}
+
+export type OnboardingStep = 'profile_basics' | 'funding_details' | 'preferences' | 'first_match_review';
+export type OnboardingStatus = 'pending' | 'completed' | 'skipped';
+
+export interface Onboarding {
+  steps: { step: OnboardingStep; status: OnboardingStatus; updated_at: string | null }[];
+  current_step: OnboardingStep | null;
+  finished: boolean;
+}
+
+export interface MatchPreferences {
+  excluded_sectors: string[];
+  excluded_states: string[];
+  excluded_applicant_types: string[];
+  excluded_funding_types: string[];
+  // Providers only: find, and be found by, other providers to co-fund with
+  open_to_cofunding: boolean;
+  // Recipients only: find, and be found by, other recipients to share knowledge with
+  open_to_peers: boolean;
+}
+
+// Another provider suggested as a co-funding partner
+export interface Partner {
+  id: number;
+  organization_name: string;
+  profile_picture_url: string | null;
+  state: string;
+  city: string;
+  funding_type: string;
+  shared_sectors: string[];
+  score: number;
+}
+
+// Another recipient in the same field or region
+export interface Peer {
+  id: number;
+  organization_name: string;
+  profile_picture_url: string | null;
+  state: string;
+  city: string;
+  applicant_type: string;
+  shared_sectors: string[];
+  shared_target_groups: string[];
+  score: number;
+}
+
+// Acceptable (recipients) or typical (providers) award size; null bounds are open
+export interface AwardRange {
+  award_min: number | null;
+  award_max: number | null;
+}
+
+// Recipient sizes and ages a provider funds; null bounds are open
+export interface EligibilityBands {
+  budget_min: number | null;
+  budget_max: number | null;
+  staff_min: number | null;
+  staff_max: number | null;
+  min_age_years: number | null;
+  max_age_years: number | null;
+}
+
+// A document a provider requires for a grant
+export interface GrantRequirement {
+  id: number;
+  grant_id: number;
+  name: string;
+  description: string;
+  position: number;
+  created_at: string;
+}
+
+export interface RequirementDocument {
+  id: number;
+  file_name: string;
+  content_type: string;
+  size_bytes: number;
+  uploaded_by: number;
+  uploaded_at: string;
+  scan_status: 'clean' | 'quarantined' | 'released';
+}
+
+// A grant's requirements and what the recipient has uploaded within a connection
+export interface RequirementChecklist {
+  grant_id: number;
+  grant_title: string;
+  items: (GrantRequirement & { document: RequirementDocument | null })[];
+  completed: number;
+  total: number;
+}
+
+export interface ConnectionChecklists {
+  connection_id: number;
+  provider_id: number;
+  recipient_id: number;
+  checklists: RequirementChecklist[];
+}
+
+// A follow-up shared between the two sides of a connection
+export interface SharedTask {
+  id: number;
+  connection_id: number;
+  created_by: number;
+  assignee_id: number | null;
+  title: string;
+  notes: string;
+  due_at: string;
+  completed_at: string | null;
+  completed_by: number | null;
+  overdue: boolean;
+  created_at: string;
+}
+
+export interface SharedTasks {
+  connection_id: number;
+  tasks: SharedTask[];
+  open: number;
+  overdue: number;
+}
+
+// An info session or webinar a provider hosts; null capacity is unlimited
+export interface ProviderEvent {
+  id: number;
+  provider_id: number;
+  provider_name: string;
+  title: string;
+  description: string;
+  starts_at: string;
+  link: string;
+  capacity: number | null;
+  rsvp_count: number;
+  spots_left: number | null;
+  rsvped: boolean;
+  created_at: string;
+}
+
+export interface EventAttendee {
+  user_id: number;
+  organization_name: string;
+  email: string;
+  rsvped_at: string;
+}
+
+// An organization found by a profile search; rank is 0 without a text query
+export interface ProfileSearchResult {
+  id: number;
+  organization_name: string;
+  profile_picture_url: string | null;
+  mission_statement: string;
+  role: 'provider' | 'recipient';
+  dual_role: boolean;
+  state: string;
+  city: string;
+  sectors: string[];
+  target_groups: string[];
+  rank: number;
+}
+
+export interface ProfileSearchPage {
+  profiles: ProfileSearchResult[];
+  total: number;
+  limit: number;
+  offset: number;
+}
+
+// An entry in a provider's FAQ
+export interface ProviderFAQ {
+  id: number;
+  question: string;
+  answer: string;
+  position: number;
+  created_at: string;
+  updated_at: string;
+}
+
+// A question a matched recipient asked a provider
+export interface ProviderQuestion {
+  id: number;
+  provider_id: number;
+  recipient_id: number;
+  recipient_name: string;
+  provider_name: string;
+  question: string;
+  answer: string | null;
+  visibility: 'private' | 'public' | null;
+  answered_at: string | null;
+  created_at: string;
+}
+
+export interface PublicAnswer {
+  id: number;
+  question: string;
+  answer: string;
+  answered_at: string;
+}
+
+export interface ProviderFAQs {
+  provider_id: number;
+  faqs: ProviderFAQ[];
+  public_answers: PublicAnswer[];
+}
+
+export interface ProfileFAQs extends ProviderFAQs {
+  my_questions: ProviderQuestion[];
+  can_ask: boolean;
+}
+
+// The success story of a funded connection
+export interface SuccessStory {
+  id: number;
+  connection_id: number;
+  author_id: number;
+  provider_id: number;
+  provider_name: string;
+  recipient_id: number;
+  recipient_name: string;
+  title: string;
+  body: string;
+  status: 'draft' | 'pending_review' | 'published' | 'rejected';
+  provider_approved: boolean;
+  recipient_approved: boolean;
+  review_note: string | null;
+  reviewed_at: string | null;
+  published_at: string | null;
+  created_at: string;
+  updated_at: string;
+}
+
+export interface PublicStory {
+  id: number;
+  title: string;
+  body: string;
+  provider_id: number;
+  provider_name: string;
+  provider_picture_url: string | null;
+  recipient_id: number;
+  recipient_name: string;
+  funded_at: string;
+  published_at: string;
+}
+
+export interface PublicStoriesPage {
+  stories: PublicStory[];
+  page: number;
+  page_size: number;
+  total: number;
+}
+
+export interface ReportAttachment {
+  id: number;
+  file_name: string;
+  content_type: string;
+  size_bytes: number;
+  uploaded_by: number;
+  uploaded_at: string;
+  scan_status: 'clean' | 'quarantined' | 'released';
+}
+
+// A progress report requested on a funded connection
+export interface ImpactReport {
+  id: number;
+  connection_id: number;
+  requested_by: number;
+  title: string;
+  instructions: string;
+  metrics: string[];
+  due_at: string;
+  narrative: string | null;
+  metric_values: Record<string, number> | null;
+  submitted_at: string | null;
+  overdue: boolean;
+  attachments: ReportAttachment[];
+  created_at: string;
+}
+
+export interface ImpactReports {
+  connection_id: number;
+  reports: ImpactReport[];
+  pending: number;
+  overdue: number;
+}
+
+export type PlanName = 'free' | 'pro';
+export type Quota = 'visible_matches' | 'message_templates' | 'monthly_exports' | 'monthly_campaigns';
+
+// A plan's limits per quota: -1 is unlimited, 0 means not included
+export interface Plan {
+  name: PlanName;
+  limits: Record<Quota, number>;
+}
+
+export interface PlanSubscription {
+  plan: PlanName;
+  status: 'active' | 'past_due' | 'canceled';
+  provider: string;
+  external_id?: string;
+  current_period_end: string | null;
+  cancel_at_period_end: boolean;
+  grace_until: string | null;
+  updated_at: string;
+}
+
+export interface QuotaUsage {
+  quota: Quota;
+  limit: number;
+  used: number;
+  remaining: number | null;
+  resets_at?: string;
+}
+
+export interface PlanUsage {
+  plan: PlanName;
+  subscription: PlanSubscription | null;
+  quotas: QuotaUsage[];
+}
+
+export interface MessageTemplate {
+  id: number;
+  name: string;
+  body: string;
+  created_at: string;
+  updated_at: string;
+}
+
+// Amounts are in the currency's smallest unit (e.g. cents)
+export interface Invoice {
+  id: string;
+  number: string;
+  status: 'draft' | 'open' | 'paid' | 'uncollectible' | 'void';
+  currency: string;
+  amount_due: number;
+  amount_paid: number;
+  created_at: string;
+  period_start: string | null;
+  period_end: string | null;
+  hosted_url: string;
+  pdf_url: string;
+}
+
+export interface InvoicesPage {
+  invoices: Invoice[];
+  has_more: boolean;
+}
+
+export interface BillingSettings {
+  billing_email: string | null;
+  login_email: string;
+}
+
+export interface Referral {
+  organization_name: string;
+  role: 'provider' | 'recipient';
+  signed_up_at: string;
+  completed_at: string | null;
+  reward: string | null;
+}
+
+export interface Referrals {
+  code: string;
+  link: string;
+  referrals: Referral[];
+  completed: number;
+}
+
+export interface Session {
+  id: number;
+  user_agent: string;
+  ip_address: string;
+  created_at: string;
+  last_used_at: string | null;
+  expires_at: string;
+  current: boolean;
+}
+
+export interface CampaignFilter {
+  sectors?: string[];
+  states?: string[];
+  connection_ids?: number[];
+}
+
+export interface Campaign {
+  id: number;
+  provider_id: number;
+  content: string;
+  filter: CampaignFilter;
+  status: 'queued' | 'sending' | 'sent' | 'canceled';
+  recipients: number;
+  delivered: number;
+  skipped: number;
+  read: number;
+  created_at: string;
+  completed_at: string | null;
+}
+
+export interface CampaignDelivery {
+  connection_id: number;
+  recipient_id: number;
+  recipient_name: string;
+  status: 'pending' | 'delivered' | 'skipped' | 'canceled';
+  message_id: number | null;
+  read: boolean;
+  delivered_at: string | null;
+}
+
+export interface CampaignDetail extends Campaign {
+  deliveries: CampaignDelivery[];
+}